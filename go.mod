@@ -6,6 +6,8 @@ toolchain go1.22.3
 
 require (
 	github.com/d2r2/go-i2c v0.0.0-20191123181816-73a8a799d6bc
+	github.com/yuin/gopher-lua v1.1.1
+	golang.org/x/exp v0.0.0-20240904232852-e7e105dedf7e
 	periph.io/x/conn/v3 v3.7.1
 )
 
@@ -0,0 +1,295 @@
+// Package aquarium собирает насосы и светильник на базе PCA9685 в единый
+// контроллер аквариума: дозаторы по расписанию, помпы течения с профилями
+// и свет с суточным фотопериодом. Контроллер описывается декларативно
+// через Config и запускается одним вызовом Run.
+package aquarium
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/snaart/go-pca9685/pkg/pca9685"
+)
+
+// Dose – одна суточная доза: насос работает Duration, начиная с At.
+type Dose struct {
+	At       pca9685.DailyTrigger
+	Duration time.Duration
+}
+
+// DoserConfig описывает дозирующий насос.
+type DoserConfig struct {
+	Name  string
+	Pump  *pca9685.Pump
+	Speed float64 // Скорость во время дозирования, % (по умолчанию 100)
+	Doses []Dose
+}
+
+// WaveShape – форма профиля течения.
+type WaveShape int
+
+const (
+	WaveConstant WaveShape = iota // Постоянная скорость Max
+	WaveSine                      // Синусоида между Min и Max
+	WaveSquare                    // Чередование Min и Max каждые полпериода
+	WaveTriangle                  // Линейный подъём от Min к Max и обратно
+)
+
+// FlowProfile – профиль скорости помпы течения.
+type FlowProfile struct {
+	Shape    WaveShape
+	Min, Max float64 // Скорость, %
+	Period   time.Duration
+}
+
+// At возвращает скорость (%) в момент elapsed от начала профиля.
+func (p FlowProfile) At(elapsed time.Duration) float64 {
+	if p.Shape == WaveConstant || p.Period <= 0 {
+		return p.Max
+	}
+	phase := math.Mod(float64(elapsed), float64(p.Period)) / float64(p.Period)
+	var k float64
+	switch p.Shape {
+	case WaveSine:
+		k = (1 - math.Cos(2*math.Pi*phase)) / 2
+	case WaveSquare:
+		if phase >= 0.5 {
+			k = 1
+		}
+	case WaveTriangle:
+		k = 1 - math.Abs(2*phase-1)
+	}
+	return p.Min + (p.Max-p.Min)*k
+}
+
+// FlowConfig описывает помпу течения или возвратную помпу.
+type FlowConfig struct {
+	Name    string
+	Pump    *pca9685.Pump
+	Profile FlowProfile
+}
+
+// LightConfig описывает светильник с суточным фотопериодом.
+// Рассвет и закат проходят по кривым pca9685.SunriseCurve и pca9685.SunsetCurve.
+type LightConfig struct {
+	Led         *pca9685.RGBLed
+	Photoperiod pca9685.Photoperiod
+}
+
+// Config – декларативное описание аквариума.
+type Config struct {
+	Dosers         []DoserConfig
+	Flow           []FlowConfig
+	Light          *LightConfig
+	UpdateInterval time.Duration  // Период обновления помп и света (по умолчанию 1 секунда)
+	Logger         pca9685.Logger // Если nil, используется стандартный логгер
+}
+
+// Tank – контроллер аквариума.
+type Tank struct {
+	cfg       Config
+	logger    pca9685.Logger
+	scheduler *pca9685.Scheduler
+	sunrise   *pca9685.DaylightSimulation
+	sunset    *pca9685.DaylightSimulation
+}
+
+// New проверяет конфигурацию и создаёт контроллер аквариума.
+func New(cfg Config) (*Tank, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = pca9685.NewDefaultLogger(pca9685.LogLevelBasic)
+	}
+	if cfg.UpdateInterval <= 0 {
+		cfg.UpdateInterval = time.Second
+	}
+	t := &Tank{
+		cfg:       cfg,
+		logger:    cfg.Logger,
+		scheduler: pca9685.NewScheduler(cfg.Logger),
+	}
+
+	for i := range t.cfg.Dosers {
+		d := &t.cfg.Dosers[i]
+		if d.Pump == nil {
+			return nil, fmt.Errorf("doser %q: pump is required", d.Name)
+		}
+		if d.Speed == 0 {
+			d.Speed = 100
+		}
+		if d.Speed < 0 || d.Speed > 100 {
+			return nil, fmt.Errorf("doser %q: speed must be between 0 and 100", d.Name)
+		}
+		for j, dose := range d.Doses {
+			if dose.Duration <= 0 {
+				return nil, fmt.Errorf("doser %q: dose %d: duration must be positive", d.Name, j)
+			}
+			if err := t.scheduler.Add(fmt.Sprintf("%s/%d", d.Name, j), dose.At, t.doseAction(*d, dose)); err != nil {
+				return nil, fmt.Errorf("doser %q: dose %d: %w", d.Name, j, err)
+			}
+		}
+	}
+
+	for _, f := range cfg.Flow {
+		if f.Pump == nil {
+			return nil, fmt.Errorf("flow pump %q: pump is required", f.Name)
+		}
+		p := f.Profile
+		if p.Min < 0 || p.Max > 100 || p.Min > p.Max {
+			return nil, fmt.Errorf("flow pump %q: invalid speed range %v-%v", f.Name, p.Min, p.Max)
+		}
+	}
+
+	if cfg.Light != nil {
+		if cfg.Light.Led == nil {
+			return nil, fmt.Errorf("light: LED is required")
+		}
+		pp := cfg.Light.Photoperiod
+		if err := pp.Validate(); err != nil {
+			return nil, fmt.Errorf("light: %w", err)
+		}
+		if pp.Ramp <= 0 {
+			return nil, fmt.Errorf("light: ramp must be positive")
+		}
+		var err error
+		opt := pca9685.WithDaylightInterval(cfg.UpdateInterval)
+		if t.sunrise, err = pca9685.NewDaylightSimulation(cfg.Light.Led, pca9685.SunriseCurve(), pp.Ramp, opt); err != nil {
+			return nil, fmt.Errorf("light: %w", err)
+		}
+		if t.sunset, err = pca9685.NewDaylightSimulation(cfg.Light.Led, pca9685.SunsetCurve(), pp.Ramp, opt); err != nil {
+			return nil, fmt.Errorf("light: %w", err)
+		}
+	}
+	return t, nil
+}
+
+// Run запускает все подсистемы аквариума и работает до отмены контекста или
+// первой ошибки управления. При выходе все насосы останавливаются.
+func (t *Tank) Run(ctx context.Context) error {
+	t.logger.Basic("aquarium: запуск контроллера")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	start := func(name string, run func(context.Context) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := run(ctx); err != nil && ctx.Err() == nil {
+				t.logger.Error("aquarium: %s: %v", name, err)
+				once.Do(func() { firstErr = fmt.Errorf("%s: %w", name, err) })
+				cancel()
+			}
+		}()
+	}
+
+	start("scheduler", t.scheduler.Run)
+	for _, f := range t.cfg.Flow {
+		f := f
+		start("flow pump "+f.Name, func(ctx context.Context) error { return t.runFlow(ctx, f) })
+	}
+	if t.cfg.Light != nil {
+		start("light", t.runLight)
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+	t.stopPumps()
+	t.logger.Basic("aquarium: контроллер остановлен")
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// doseAction возвращает действие планировщика для одной дозы.
+func (t *Tank) doseAction(d DoserConfig, dose Dose) func(context.Context) error {
+	return func(ctx context.Context) error {
+		t.logger.Basic("aquarium: дозатор %q: доза %v", d.Name, dose.Duration)
+		if err := d.Pump.SetSpeed(ctx, d.Speed); err != nil {
+			return err
+		}
+		timer := time.NewTimer(dose.Duration)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+		// Насос останавливается даже при отмене контекста.
+		return d.Pump.Stop(context.Background())
+	}
+}
+
+func (t *Tank) runFlow(ctx context.Context, f FlowConfig) error {
+	ticker := time.NewTicker(t.cfg.UpdateInterval)
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		if err := f.Pump.SetSpeed(ctx, f.Profile.At(time.Since(start))); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *Tank) runLight(ctx context.Context) error {
+	light := t.cfg.Light
+	for {
+		phase, elapsed, remaining := light.Photoperiod.Phase(time.Now())
+		t.logger.Detailed("aquarium: свет: фаза %v, прошло %v, осталось %v", phase, elapsed, remaining)
+
+		var err error
+		switch phase {
+		case pca9685.PhaseSunrise:
+			err = t.sunrise.Resume(ctx, elapsed)
+		case pca9685.PhaseSunset:
+			err = t.sunset.Resume(ctx, elapsed)
+		case pca9685.PhaseDay:
+			if err = t.sunrise.Resume(ctx, light.Photoperiod.Ramp); err == nil {
+				err = sleep(ctx, remaining)
+			}
+		default:
+			if err = light.Led.Off(ctx); err == nil {
+				err = sleep(ctx, remaining)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (t *Tank) stopPumps() {
+	ctx := context.Background()
+	for _, d := range t.cfg.Dosers {
+		if err := d.Pump.Stop(ctx); err != nil {
+			t.logger.Error("aquarium: не удалось остановить дозатор %q: %v", d.Name, err)
+		}
+	}
+	for _, f := range t.cfg.Flow {
+		if err := f.Pump.Stop(ctx); err != nil {
+			t.logger.Error("aquarium: не удалось остановить помпу %q: %v", f.Name, err)
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
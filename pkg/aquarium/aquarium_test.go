@@ -0,0 +1,104 @@
+package aquarium
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/snaart/go-pca9685/pkg/pca9685"
+)
+
+func at(t time.Time) pca9685.DailyTrigger {
+	return pca9685.DailyTrigger{Hour: t.Hour(), Minute: t.Minute(), Second: t.Second()}
+}
+
+func TestFlowProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile FlowProfile
+		elapsed time.Duration
+		want    float64
+	}{
+		{"Constant", FlowProfile{Shape: WaveConstant, Max: 70}, time.Minute, 70},
+		{"SineStart", FlowProfile{Shape: WaveSine, Min: 20, Max: 80, Period: time.Minute}, 0, 20},
+		{"SinePeak", FlowProfile{Shape: WaveSine, Min: 20, Max: 80, Period: time.Minute}, 30 * time.Second, 80},
+		{"SquareLow", FlowProfile{Shape: WaveSquare, Min: 10, Max: 90, Period: time.Minute}, 10 * time.Second, 10},
+		{"SquareHigh", FlowProfile{Shape: WaveSquare, Min: 10, Max: 90, Period: time.Minute}, 40 * time.Second, 90},
+		{"TriangleMid", FlowProfile{Shape: WaveTriangle, Min: 0, Max: 100, Period: time.Minute}, 15 * time.Second, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.profile.At(tt.elapsed); got < tt.want-0.001 || got > tt.want+0.001 {
+				t.Errorf("At(%v) = %v, want %v", tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTank(t *testing.T) {
+	pca, err := pca9685.New(pca9685.NewTestI2C(), pca9685.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	doser, _ := pca9685.NewPump(pca, 0)
+	wave, _ := pca9685.NewPump(pca, 1)
+	led, _ := pca9685.NewRGBLed(pca, 2, 3, 4)
+
+	if _, err := New(Config{Dosers: []DoserConfig{{Name: "ca"}}}); err == nil {
+		t.Error("New() expected error for doser without pump")
+	}
+	if _, err := New(Config{Flow: []FlowConfig{{Name: "wave", Pump: wave, Profile: FlowProfile{Min: 80, Max: 20}}}}); err == nil {
+		t.Error("New() expected error for inverted speed range")
+	}
+
+	now := time.Now()
+	var doseStarted atomic.Bool
+	tank, err := New(Config{
+		Dosers: []DoserConfig{{
+			Name:  "ca",
+			Pump:  doser,
+			Doses: []Dose{{At: at(now.Add(time.Second)), Duration: 50 * time.Millisecond}},
+		}},
+		Flow: []FlowConfig{{Name: "wave", Pump: wave, Profile: FlowProfile{Shape: WaveConstant, Max: 60}}},
+		Light: &LightConfig{
+			Led: led,
+			Photoperiod: pca9685.Photoperiod{
+				On:   at(now.Add(-time.Hour)),
+				Off:  at(now.Add(time.Hour)),
+				Ramp: 10 * time.Minute,
+			},
+		},
+		UpdateInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2500*time.Millisecond)
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			if speed, _ := doser.GetCurrentSpeed(); speed == 100 {
+				doseStarted.Store(true)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	if err := tank.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run() error = %v, want context.DeadlineExceeded", err)
+	}
+	if !doseStarted.Load() {
+		t.Error("dosing pump did not run at the scheduled time")
+	}
+	if _, _, off, _ := pca.GetChannelState(2); off != 4095 {
+		t.Errorf("light red channel during the day = %d, want 4095", off)
+	}
+	for _, pump := range []*pca9685.Pump{doser, wave} {
+		if speed, _ := pump.GetCurrentSpeed(); speed != 0 {
+			t.Errorf("pump still running after Run() returned: %v%%", speed)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package pca9685
+
+// AdapterOption определяет опцию конфигурации адаптера I2C.
+type AdapterOption func(*adapterConfig)
+
+// adapterConfig – общие настройки адаптеров.
+type adapterConfig struct {
+	logger Logger
+}
+
+// WithLogger задаёт логгер адаптера. Без этой опции адаптер до передачи в New
+// пишет в стандартный логгер с базовым уровнем, а после – в логгер контроллера.
+func WithLogger(logger Logger) AdapterOption {
+	return func(c *adapterConfig) {
+		c.logger = logger
+	}
+}
+
+// adapterLogger – логгер адаптера, который наследует логгер контроллера,
+// если не был задан явно.
+type adapterLogger struct {
+	Logger
+	explicit bool // логгер задан через WithLogger
+}
+
+// newAdapterLogger применяет опции и возвращает логгер адаптера. Если логгер
+// не задан, используется fallback.
+func newAdapterLogger(fallback Logger, opts []AdapterOption) adapterLogger {
+	var cfg adapterConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	l := adapterLogger{Logger: fallback}
+	if cfg.logger != nil {
+		l.Logger, l.explicit = cfg.logger, true
+	}
+	return l
+}
+
+// inherit заменяет логгер логгером контроллера, если он не был задан явно.
+func (l *adapterLogger) inherit(logger Logger) {
+	if l.explicit || logger == nil {
+		return
+	}
+	l.Logger = logger
+}
+
+// loggerInheritor – адаптер, принимающий логгер контроллера. New передаёт
+// адаптеру свой логгер, чтобы ошибки обмена по шине подчинялись настройкам
+// логирования приложения.
+type loggerInheritor interface {
+	inheritLogger(logger Logger)
+}
+
+// inheritLogger передаёт логгер адаптеру dev, если тот его принимает.
+func inheritLogger(dev I2C, logger Logger) {
+	if li, ok := dev.(loggerInheritor); ok {
+		li.inheritLogger(logger)
+	}
+}
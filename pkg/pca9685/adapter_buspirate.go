@@ -0,0 +1,318 @@
+package pca9685
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+func init() {
+	// Шина – путь к последовательному порту (/dev/ttyUSB0, \\.\COM3), заранее
+	// настроенному на 115200 бод 8N1 (stty или mode). Параметры: speed (5k,
+	// 50k, 100k, 400k), power и pullups (true/false).
+	RegisterAdapter("buspirate", func(cfg AdapterConfig, opts ...AdapterOption) (I2C, error) {
+		bp := BusPirateConfig{Address: cfg.Address}
+		if s, ok := cfg.Params["speed"]; ok {
+			speed, ok := busPirateSpeeds[s]
+			if !ok {
+				return nil, fmt.Errorf("invalid Bus Pirate speed: %q", s)
+			}
+			bp.Speed = speed
+		}
+		for key, dst := range map[string]*bool{"power": &bp.Power, "pullups": &bp.PullUps} {
+			if s, ok := cfg.Params[key]; ok {
+				v, err := strconv.ParseBool(s)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s value %q: %w", key, s, err)
+				}
+				*dst = v
+			}
+		}
+		port, err := os.OpenFile(cfg.Bus, os.O_RDWR, 0)
+		if err != nil {
+			return nil, err
+		}
+		a, err := NewI2CAdapterBusPirate(port, bp, opts...)
+		if err != nil {
+			port.Close()
+			return nil, err
+		}
+		return a, nil
+	})
+}
+
+// BusPirateSpeed – скорость шины I2C Bus Pirate.
+type BusPirateSpeed byte
+
+const (
+	BusPirate5kHz   BusPirateSpeed = iota + 1 // 5 кГц
+	BusPirate50kHz                            // 50 кГц
+	BusPirate100kHz                           // 100 кГц
+	BusPirate400kHz                           // 400 кГц
+)
+
+var busPirateSpeeds = map[string]BusPirateSpeed{
+	"5k": BusPirate5kHz, "50k": BusPirate50kHz, "100k": BusPirate100kHz, "400k": BusPirate400kHz,
+}
+
+// BusPirateConfig содержит настройки адаптера Bus Pirate.
+type BusPirateConfig struct {
+	Address uint8          // 7-битный адрес PCA9685 (по умолчанию 0x40)
+	Speed   BusPirateSpeed // Скорость шины (по умолчанию 100 кГц)
+	Power   bool           // Включить питание 3.3 В/5 В на разъёме Bus Pirate
+	PullUps bool           // Включить встроенные подтягивающие резисторы
+}
+
+// Команды двоичного режима Bus Pirate.
+const (
+	bpReset        = 0x00 // вход в режим bitbang / выход из I2C
+	bpEnterI2C     = 0x02
+	bpExit         = 0x0F // сброс Bus Pirate в терминальный режим
+	bpStart        = 0x02
+	bpStop         = 0x03
+	bpWriteThenRd  = 0x08
+	bpBulkWrite    = 0x10 // 0001xxxx: запись 1–16 байт
+	bpPeripherals  = 0x40 // 0100wxyz: питание, подтяжка, AUX, CS
+	bpSetSpeed     = 0x60 // 011000xx
+	bpOK           = 0x01
+	bpNACK         = 0x01
+	bpMaxBulk      = 16
+	bpMaxRead      = 4096
+	bpResetRetries = 20
+)
+
+// I2CAdapterBusPirate управляет PCA9685 через Bus Pirate в двоичном режиме
+// I2C по последовательному порту. Это недорогой способ работать с реальной
+// микросхемой на Windows и macOS во время разработки.
+//
+// Адаптер не открывает порт сам: передайте ему порт, открытый любой
+// библиотекой последовательного порта (115200 бод, 8N1).
+type I2CAdapterBusPirate struct {
+	port   io.ReadWriter
+	addr   uint8
+	logger adapterLogger
+
+	mu  sync.Mutex // транзакции Bus Pirate не допускают чередования
+	buf [1 + bpMaxBulk]byte
+}
+
+// NewI2CAdapterBusPirate переводит Bus Pirate на порту port в двоичный режим
+// I2C и настраивает шину. Логгер задаётся опцией WithLogger; без неё адаптер
+// использует логгер контроллера, которому передан.
+func NewI2CAdapterBusPirate(port io.ReadWriter, cfg BusPirateConfig, opts ...AdapterOption) (*I2CAdapterBusPirate, error) {
+	if cfg.Address == 0 {
+		cfg.Address = 0x40
+	}
+	if cfg.Address > 0x7F {
+		return nil, fmt.Errorf("invalid 7-bit I2C address: 0x%X", cfg.Address)
+	}
+	if cfg.Speed == 0 {
+		cfg.Speed = BusPirate100kHz
+	}
+	if cfg.Speed > BusPirate400kHz {
+		return nil, fmt.Errorf("invalid Bus Pirate speed: %d", cfg.Speed)
+	}
+	a := &I2CAdapterBusPirate{
+		port:   port,
+		addr:   cfg.Address,
+		logger: newAdapterLogger(NewDefaultLogger(LogLevelBasic), opts),
+	}
+
+	a.logger.Basic("I2CAdapterBusPirate: переход в двоичный режим I2C")
+	// Двадцать нулевых байт переводят Bus Pirate из терминала в режим
+	// bitbang; если он уже в двоичном режиме, на каждый байт приходит BBIO1.
+	// Лишние ответы пропускаются при ожидании I2C1.
+	if err := a.send(bytes.Repeat([]byte{bpReset}, bpResetRetries)...); err != nil {
+		return nil, err
+	}
+	if err := a.expect("BBIO1"); err != nil {
+		return nil, fmt.Errorf("failed to enter binary mode: %w", err)
+	}
+	if err := a.send(bpEnterI2C); err != nil {
+		return nil, err
+	}
+	if err := a.expect("I2C1"); err != nil {
+		return nil, fmt.Errorf("failed to enter I2C mode: %w", err)
+	}
+
+	var periph byte = bpPeripherals
+	if cfg.Power {
+		periph |= 0x08
+	}
+	if cfg.PullUps {
+		periph |= 0x04
+	}
+	for _, cmd := range []byte{bpSetSpeed | byte(cfg.Speed-1), periph} {
+		if err := a.command(cmd); err != nil {
+			return nil, fmt.Errorf("failed to configure Bus Pirate: %w", err)
+		}
+	}
+	return a, nil
+}
+
+func (a *I2CAdapterBusPirate) inheritLogger(logger Logger) {
+	a.logger.inherit(logger)
+}
+
+// WriteReg записывает data, начиная с регистра reg: START, адрес, регистр и
+// данные пакетами по 16 байт, STOP.
+func (a *I2CAdapterBusPirate) WriteReg(reg uint8, data []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.command(bpStart); err != nil {
+		return err
+	}
+	err := a.bulkWrite([]byte{a.addr << 1, reg})
+	for len(data) > 0 && err == nil {
+		n := len(data)
+		if n > bpMaxBulk {
+			n = bpMaxBulk
+		}
+		err = a.bulkWrite(data[:n])
+		data = data[n:]
+	}
+	// STOP отправляется и после ошибки, чтобы освободить шину.
+	if stopErr := a.command(bpStop); err == nil {
+		err = stopErr
+	}
+	if err != nil {
+		a.logger.Error("I2CAdapterBusPirate: WriteReg: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ReadReg читает регистр одной транзакцией с повторным START.
+func (a *I2CAdapterBusPirate) ReadReg(reg uint8, data []byte) error {
+	return a.WriteRead([]byte{reg}, data)
+}
+
+// WriteRead записывает w и читает r одной транзакцией командой Bus Pirate
+// «запись, затем чтение».
+func (a *I2CAdapterBusPirate) WriteRead(w, r []byte) error {
+	if len(w)+1 > bpMaxRead || len(r) > bpMaxRead {
+		return fmt.Errorf("transfer too long: write %d, read %d bytes", len(w), len(r))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	nw := len(w) + 1
+	hdr := []byte{bpWriteThenRd, byte(nw >> 8), byte(nw), byte(len(r) >> 8), byte(len(r)), a.addr << 1}
+	if err := a.send(append(hdr, w...)...); err != nil {
+		return err
+	}
+	status, err := a.readByte()
+	if err != nil {
+		return err
+	}
+	if status != bpOK {
+		err := fmt.Errorf("device 0x%X did not acknowledge", a.addr)
+		a.logger.Error("I2CAdapterBusPirate: WriteRead: %v", err)
+		return err
+	}
+	if _, err := io.ReadFull(a.port, r); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	return nil
+}
+
+// Capabilities сообщает возможности адаптера: запись любой длины (адаптер
+// сам делит её на пакеты) и чтение одной транзакцией.
+func (a *I2CAdapterBusPirate) Capabilities() I2CCapabilities {
+	return I2CCapabilities{CombinedWriteRead: true}
+}
+
+// Close возвращает Bus Pirate в терминальный режим и закрывает порт, если он
+// реализует io.Closer.
+func (a *I2CAdapterBusPirate) Close() error {
+	a.logger.Basic("I2CAdapterBusPirate: Closing device")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.send(bpReset)
+	if err == nil {
+		err = a.expect("BBIO1")
+	}
+	if err == nil {
+		err = a.command(bpExit)
+	}
+	if c, ok := a.port.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// bulkWrite отправляет до 16 байт командой пакетной записи и проверяет ACK
+// каждого байта.
+func (a *I2CAdapterBusPirate) bulkWrite(data []byte) error {
+	a.buf[0] = bpBulkWrite | byte(len(data)-1)
+	n := copy(a.buf[1:], data)
+	if err := a.send(a.buf[:n+1]...); err != nil {
+		return err
+	}
+	reply := a.buf[:n+1]
+	if _, err := io.ReadFull(a.port, reply); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if reply[0] != bpOK {
+		return fmt.Errorf("bulk write rejected: 0x%X", reply[0])
+	}
+	for i, ack := range reply[1:] {
+		if ack == bpNACK {
+			return fmt.Errorf("byte %d not acknowledged by device 0x%X", i, a.addr)
+		}
+	}
+	return nil
+}
+
+// command отправляет однобайтовую команду и ожидает подтверждения 0x01.
+func (a *I2CAdapterBusPirate) command(cmd byte) error {
+	if err := a.send(cmd); err != nil {
+		return err
+	}
+	reply, err := a.readByte()
+	if err != nil {
+		return err
+	}
+	if reply != bpOK {
+		return fmt.Errorf("command 0x%X rejected: 0x%X", cmd, reply)
+	}
+	return nil
+}
+
+func (a *I2CAdapterBusPirate) send(data ...byte) error {
+	if _, err := a.port.Write(data); err != nil {
+		return fmt.Errorf("failed to write to serial port: %w", err)
+	}
+	return nil
+}
+
+func (a *I2CAdapterBusPirate) readByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(a.port, b[:]); err != nil {
+		return 0, fmt.Errorf("failed to read response: %w", err)
+	}
+	return b[0], nil
+}
+
+// expect читает ответ, пока не встретит token. Число пропускаемых байт
+// ограничено, чтобы не зависнуть на постороннем выводе.
+func (a *I2CAdapterBusPirate) expect(token string) error {
+	var seen []byte
+	for len(seen) < 256 {
+		b, err := a.readByte()
+		if err != nil {
+			return err
+		}
+		seen = append(seen, b)
+		if bytes.HasSuffix(seen, []byte(token)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no %q in response", token)
+}
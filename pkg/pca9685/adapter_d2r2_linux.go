@@ -4,26 +4,52 @@ package pca9685
 
 import (
 	"fmt"
+	"strconv"
+
 	"github.com/d2r2/go-i2c"
 )
 
+func init() {
+	// Шина задаётся номером: "1" соответствует /dev/i2c-1 (по умолчанию).
+	RegisterAdapter("d2r2", func(cfg AdapterConfig, opts ...AdapterOption) (I2C, error) {
+		bus := 1
+		if cfg.Bus != "" {
+			n, err := strconv.Atoi(cfg.Bus)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bus number %q: %w", cfg.Bus, err)
+			}
+			bus = n
+		}
+		dev, err := i2c.NewI2C(cfg.Address, bus)
+		if err != nil {
+			return nil, err
+		}
+		return NewI2CAdapterD2r2(dev, opts...), nil
+	})
+}
+
 // I2CAdapterD2r2 оборачивает объект *i2c.I2C из библиотеки d2r2/go-i2c.
 type I2CAdapterD2r2 struct {
 	dev    *i2c.I2C
-	logger Logger
+	logger adapterLogger
 }
 
-// NewI2CAdapterD2r2 создаёт новый адаптер для d2r2/go-i2c.
-func NewI2CAdapterD2r2(dev *i2c.I2C) *I2CAdapterD2r2 {
+// NewI2CAdapterD2r2 создаёт новый адаптер для d2r2/go-i2c. Логгер задаётся опцией
+// WithLogger; без неё адаптер использует логгер контроллера, которому передан.
+func NewI2CAdapterD2r2(dev *i2c.I2C, opts ...AdapterOption) *I2CAdapterD2r2 {
 	return &I2CAdapterD2r2{
 		dev:    dev,
-		logger: NewDefaultLogger(LogLevelBasic),
+		logger: newAdapterLogger(NewDefaultLogger(LogLevelBasic), opts),
 	}
 }
 
+func (a *I2CAdapterD2r2) inheritLogger(logger Logger) {
+	a.logger.inherit(logger)
+}
+
 func (a *I2CAdapterD2r2) WriteReg(reg uint8, data []byte) error {
-	a.logger.Detailed("I2CAdapterD2r2: WriteReg: register=0x%X, data=%v", reg, data)
-	buf := append([]byte{reg}, data...)
+	pooled, buf := encodeFrame(reg, data)
+	defer releaseFrame(pooled)
 	n, err := a.dev.WriteBytes(buf)
 	if err != nil {
 		a.logger.Error("I2CAdapterD2r2: WriteReg: error writing bytes: %v", err)
@@ -34,12 +60,14 @@ func (a *I2CAdapterD2r2) WriteReg(reg uint8, data []byte) error {
 		a.logger.Error("I2CAdapterD2r2: WriteReg: %v", err)
 		return err
 	}
-	a.logger.Detailed("I2CAdapterD2r2: WriteReg: success")
 	return nil
 }
 
+// ReadReg читает регистр двумя транзакциями: запись указателя регистра и
+// чтение. Библиотека d2r2/go-i2c не поддерживает повторный START, поэтому
+// адаптер не реализует WriteRead; на общей шине его нужно оборачивать
+// SharedBus.Device.
 func (a *I2CAdapterD2r2) ReadReg(reg uint8, data []byte) error {
-	a.logger.Detailed("I2CAdapterD2r2: ReadReg: register=0x%X", reg)
 	_, err := a.dev.WriteBytes([]byte{reg})
 	if err != nil {
 		a.logger.Error("I2CAdapterD2r2: ReadReg: error writing register: %v", err)
@@ -55,10 +83,15 @@ func (a *I2CAdapterD2r2) ReadReg(reg uint8, data []byte) error {
 		a.logger.Error("I2CAdapterD2r2: ReadReg: %v", err)
 		return err
 	}
-	a.logger.Detailed("I2CAdapterD2r2: ReadReg: success, data=%v", data)
 	return nil
 }
 
+// Capabilities сообщает возможности адаптера: запись любой длины одной
+// транзакцией, но чтение регистра – отдельными записью указателя и чтением.
+func (a *I2CAdapterD2r2) Capabilities() I2CCapabilities {
+	return I2CCapabilities{}
+}
+
 func (a *I2CAdapterD2r2) Close() error {
 	a.logger.Basic("I2CAdapterD2r2: Closing device")
 	return a.dev.Close()
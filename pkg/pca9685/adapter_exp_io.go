@@ -0,0 +1,58 @@
+package pca9685
+
+import (
+	expi2c "golang.org/x/exp/io/i2c"
+)
+
+// I2CAdapterExpIO оборачивает устройство *i2c.Device из пакета
+// golang.org/x/exp/io/i2c.
+type I2CAdapterExpIO struct {
+	dev    *expi2c.Device
+	logger adapterLogger
+}
+
+// NewI2CAdapterExpIO создаёт новый адаптер для golang.org/x/exp/io/i2c. Логгер
+// задаётся опцией WithLogger; без неё адаптер использует логгер контроллера,
+// которому передан.
+func NewI2CAdapterExpIO(dev *expi2c.Device, opts ...AdapterOption) *I2CAdapterExpIO {
+	return &I2CAdapterExpIO{
+		dev:    dev,
+		logger: newAdapterLogger(NewDefaultLogger(LogLevelBasic), opts),
+	}
+}
+
+func (a *I2CAdapterExpIO) inheritLogger(logger Logger) {
+	a.logger.inherit(logger)
+}
+
+func (a *I2CAdapterExpIO) WriteReg(reg uint8, data []byte) error {
+	// Device.WriteReg выделяет память на каждый вызов, поэтому кадр
+	// формируется в буфере пула и передаётся через Write.
+	pooled, buf := encodeFrame(reg, data)
+	defer releaseFrame(pooled)
+	if err := a.dev.Write(buf); err != nil {
+		a.logger.Error("I2CAdapterExpIO: WriteReg: error writing bytes: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ReadReg читает регистр одной транзакцией с повторным START.
+func (a *I2CAdapterExpIO) ReadReg(reg uint8, data []byte) error {
+	if err := a.dev.ReadReg(reg, data); err != nil {
+		a.logger.Error("I2CAdapterExpIO: ReadReg: error reading register: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Capabilities сообщает возможности адаптера: запись любой длины, чтение
+// регистра одной транзакцией и 10-битные адреса (см. i2c.TenBit).
+func (a *I2CAdapterExpIO) Capabilities() I2CCapabilities {
+	return I2CCapabilities{CombinedWriteRead: true, TenBitAddress: true}
+}
+
+func (a *I2CAdapterExpIO) Close() error {
+	a.logger.Basic("I2CAdapterExpIO: Closing device")
+	return a.dev.Close()
+}
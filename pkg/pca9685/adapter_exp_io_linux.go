@@ -0,0 +1,22 @@
+//go:build linux
+
+package pca9685
+
+import (
+	expi2c "golang.org/x/exp/io/i2c"
+)
+
+func init() {
+	// Шина задаётся путём к устройству (по умолчанию /dev/i2c-1).
+	RegisterAdapter("exp-io", func(cfg AdapterConfig, opts ...AdapterOption) (I2C, error) {
+		path := cfg.Bus
+		if path == "" {
+			path = "/dev/i2c-1"
+		}
+		dev, err := expi2c.Open(&expi2c.Devfs{Dev: path}, int(cfg.Address))
+		if err != nil {
+			return nil, err
+		}
+		return NewI2CAdapterExpIO(dev, opts...), nil
+	})
+}
@@ -0,0 +1,232 @@
+package pca9685
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// MockMode определяет, как MockI2C обрабатывает операции, не совпадающие
+// с очередным ожиданием.
+type MockMode int
+
+const (
+	// MockStrict – каждая операция должна совпасть с очередным ожиданием;
+	// иначе она завершается ошибкой и фиксируется для ExpectationsWereMet.
+	MockStrict MockMode = iota
+	// MockLenient – неожиданные операции выполняются как на эмуляторе
+	// регистров, а ожидания проверяются как подпоследовательность.
+	MockLenient
+)
+
+type mockOp int
+
+const (
+	mockWrite mockOp = iota
+	mockRead
+	mockClose
+)
+
+// MockExpectation – ожидаемая операция MockI2C.
+type MockExpectation struct {
+	op      mockOp
+	reg     uint8
+	data    []byte
+	anyData bool
+	resp    []byte
+	err     error
+}
+
+// WithAnyData разрешает записи с любыми данными.
+func (e *MockExpectation) WithAnyData() *MockExpectation {
+	e.anyData = true
+	return e
+}
+
+// WillReturn задаёт данные, возвращаемые ожидаемым чтением. Без неё чтение
+// возвращает содержимое эмулируемых регистров.
+func (e *MockExpectation) WillReturn(data ...byte) *MockExpectation {
+	e.resp = data
+	return e
+}
+
+// WillReturnError задаёт ошибку, которую вернёт ожидаемая операция.
+func (e *MockExpectation) WillReturnError(err error) *MockExpectation {
+	e.err = err
+	return e
+}
+
+func (e *MockExpectation) String() string {
+	switch e.op {
+	case mockWrite:
+		if e.anyData {
+			return fmt.Sprintf("write 0x%02X <any>", e.reg)
+		}
+		return fmt.Sprintf("write 0x%02X %v", e.reg, e.data)
+	case mockRead:
+		return fmt.Sprintf("read 0x%02X", e.reg)
+	default:
+		return "close"
+	}
+}
+
+// matches сообщает, совпадает ли операция с ожиданием.
+func (e *MockExpectation) matches(op mockOp, reg uint8, data []byte) bool {
+	if e.op != op || e.reg != reg {
+		return false
+	}
+	switch op {
+	case mockWrite:
+		return e.anyData || bytes.Equal(e.data, data)
+	case mockRead:
+		return e.resp == nil || len(e.resp) == len(data)
+	}
+	return true
+}
+
+// MockI2C – адаптер для тестов приложения, проверяющий точную
+// последовательность обращений к устройству: тест объявляет ожидаемые записи
+// и чтения с заготовленными ответами, выполняет код и вызывает
+// ExpectationsWereMet. Все записи сохраняются в эмулируемых регистрах, как
+// в TestI2C.
+type MockI2C struct {
+	logger adapterLogger
+
+	mu         sync.Mutex
+	mode       MockMode
+	expected   []*MockExpectation
+	next       int
+	registers  [256]byte
+	unexpected []error
+}
+
+// NewMockI2C создаёт адаптер в строгом режиме без ожиданий.
+func NewMockI2C(opts ...AdapterOption) *MockI2C {
+	return &MockI2C{
+		logger: newAdapterLogger(NewDefaultLogger(LogLevelBasic), opts),
+	}
+}
+
+func (m *MockI2C) inheritLogger(logger Logger) {
+	m.logger.inherit(logger)
+}
+
+// SetMode переключает режим. Обычно инициализацию контроллера выполняют в
+// режиме MockLenient, а проверяемый код – в MockStrict.
+func (m *MockI2C) SetMode(mode MockMode) {
+	m.mu.Lock()
+	m.mode = mode
+	m.mu.Unlock()
+}
+
+// ExpectWrite добавляет ожидание записи data в регистр reg.
+func (m *MockI2C) ExpectWrite(reg uint8, data ...byte) *MockExpectation {
+	return m.expect(&MockExpectation{op: mockWrite, reg: reg, data: data})
+}
+
+// ExpectRead добавляет ожидание чтения регистра reg.
+func (m *MockI2C) ExpectRead(reg uint8) *MockExpectation {
+	return m.expect(&MockExpectation{op: mockRead, reg: reg})
+}
+
+// ExpectClose добавляет ожидание закрытия адаптера.
+func (m *MockI2C) ExpectClose() *MockExpectation {
+	return m.expect(&MockExpectation{op: mockClose})
+}
+
+func (m *MockI2C) expect(e *MockExpectation) *MockExpectation {
+	m.mu.Lock()
+	m.expected = append(m.expected, e)
+	m.mu.Unlock()
+	return e
+}
+
+// ExpectationsWereMet возвращает ошибку, если была неожиданная операция в
+// строгом режиме или выполнены не все ожидания.
+func (m *MockI2C) ExpectationsWereMet() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.unexpected) > 0 {
+		return m.unexpected[0]
+	}
+	if m.next < len(m.expected) {
+		return fmt.Errorf("expectation not met: %s (%d remaining)", m.expected[m.next], len(m.expected)-m.next)
+	}
+	return nil
+}
+
+// match сопоставляет операцию с очередным ожиданием. Возвращает ожидание
+// (nil, если операция неожиданная в мягком режиме) или ошибку строгого
+// режима. Вызывается с захваченным m.mu.
+func (m *MockI2C) match(op mockOp, reg uint8, data []byte) (*MockExpectation, error) {
+	if m.next < len(m.expected) && m.expected[m.next].matches(op, reg, data) {
+		e := m.expected[m.next]
+		m.next++
+		return e, nil
+	}
+	if m.mode == MockLenient {
+		return nil, nil
+	}
+	got := &MockExpectation{op: op, reg: reg, data: data}
+	want := "nothing"
+	if m.next < len(m.expected) {
+		want = m.expected[m.next].String()
+	}
+	err := fmt.Errorf("unexpected %s, expected %s", got, want)
+	m.unexpected = append(m.unexpected, err)
+	return nil, err
+}
+
+func (m *MockI2C) WriteReg(reg uint8, data []byte) error {
+	m.logger.Detailed("MockI2C: WriteReg: register=0x%X, data=%v", reg, data)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, err := m.match(mockWrite, reg, data)
+	if err != nil {
+		m.logger.Error("MockI2C: WriteReg: %v", err)
+		return err
+	}
+	if e != nil && e.err != nil {
+		return e.err
+	}
+	copy(m.registers[reg:], data)
+	return nil
+}
+
+func (m *MockI2C) ReadReg(reg uint8, data []byte) error {
+	m.logger.Detailed("MockI2C: ReadReg: register=0x%X", reg)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, err := m.match(mockRead, reg, data)
+	if err != nil {
+		m.logger.Error("MockI2C: ReadReg: %v", err)
+		return err
+	}
+	if e != nil && e.err != nil {
+		return e.err
+	}
+	if e != nil && e.resp != nil {
+		copy(data, e.resp)
+		return nil
+	}
+	n := copy(data, m.registers[reg:])
+	for i := n; i < len(data); i++ {
+		data[i] = 0
+	}
+	return nil
+}
+
+func (m *MockI2C) Close() error {
+	m.logger.Basic("MockI2C: Close called")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, err := m.match(mockClose, 0, nil)
+	if err != nil {
+		m.logger.Error("MockI2C: Close: %v", err)
+		return err
+	}
+	if e != nil {
+		return e.err
+	}
+	return nil
+}
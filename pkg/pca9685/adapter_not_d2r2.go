@@ -4,9 +4,12 @@ package pca9685
 
 import (
 	"fmt"
+	"strings"
 )
 
-// ПРЕДУПРЕЖДЕНИЕ: адаптер d2r2/go-i2c работает только на Linux. Используйте тестовый адаптер для вашей системы.
+// NewI2CAdapterD2r2 недоступен: библиотека d2r2/go-i2c работает только на
+// Linux. Ошибка перечисляет адаптеры, зарегистрированные на этой платформе
+// (см. OpenAdapter).
 func NewI2CAdapterD2r2() error {
-	return fmt.Errorf("ПРЕДУПРЕЖДЕНИЕ: адаптер d2r2/go-i2c работает только на Linux. Используйте тестовый адаптер для вашей системы.")
+	return fmt.Errorf("adapter d2r2 is only available on Linux; registered adapters: %s", strings.Join(Adapters(), ", "))
 }
@@ -2,9 +2,14 @@
 
 package pca9685
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
-// ПРЕДУПРЕЖДЕНИЕ: адаптер periph.io/go-i2c работает только на Linux. Используйте тестовый адаптер для вашей системы.
+// NewI2CAdapterPeriph недоступен: адаптер periph.io собирается только для
+// Linux. Ошибка перечисляет адаптеры, зарегистрированные на этой платформе
+// (см. OpenAdapter).
 func NewI2CAdapterPeriph() error {
-	return fmt.Errorf("ПРЕДУПРЕЖДЕНИЕ: адаптер periph.io/go-i2c работает только на Linux. Используйте тестовый адаптер для вашей системы.")
+	return fmt.Errorf("adapter periph is only available on Linux; registered adapters: %s", strings.Join(Adapters(), ", "))
 }
@@ -3,46 +3,85 @@
 package pca9685
 
 import (
+	"fmt"
+
 	periph_i2c "periph.io/x/conn/v3/i2c"
+	"periph.io/x/conn/v3/i2c/i2creg"
 )
 
+func init() {
+	// Шина задаётся именем из реестра periph ("" – первая найденная шина).
+	// Драйверы хоста должны быть инициализированы заранее (host.Init).
+	RegisterAdapter("periph", func(cfg AdapterConfig, opts ...AdapterOption) (I2C, error) {
+		bus, err := i2creg.Open(cfg.Bus)
+		if err != nil {
+			return nil, err
+		}
+		a := NewI2CAdapterPeriph(&periph_i2c.Dev{Bus: bus, Addr: uint16(cfg.Address)}, opts...)
+		a.bus = bus
+		return a, nil
+	})
+}
+
 // I2CAdapterPeriph реализует работу с I2C через periph.io.
 type I2CAdapterPeriph struct {
 	dev    *periph_i2c.Dev
-	logger Logger
+	bus    periph_i2c.BusCloser // шина, открытая OpenAdapter; закрывается в Close
+	logger adapterLogger
 }
 
-// NewI2CAdapterPeriph создаёт новый адаптер для periph.io.
-func NewI2CAdapterPeriph(dev *periph_i2c.Dev) *I2CAdapterPeriph {
+// NewI2CAdapterPeriph создаёт новый адаптер для periph.io. Логгер задаётся опцией
+// WithLogger; без неё адаптер использует логгер контроллера, которому передан.
+func NewI2CAdapterPeriph(dev *periph_i2c.Dev, opts ...AdapterOption) *I2CAdapterPeriph {
 	return &I2CAdapterPeriph{
 		dev:    dev,
-		logger: NewDefaultLogger(LogLevelBasic),
+		logger: newAdapterLogger(NewDefaultLogger(LogLevelBasic), opts),
 	}
 }
 
+func (a *I2CAdapterPeriph) inheritLogger(logger Logger) {
+	a.logger.inherit(logger)
+}
+
 func (a *I2CAdapterPeriph) WriteReg(reg uint8, data []byte) error {
-	a.logger.Detailed("I2CAdapterPeriph: WriteReg: register=0x%X, data=%v", reg, data)
-	buf := append([]byte{reg}, data...)
+	pooled, buf := encodeFrame(reg, data)
+	defer releaseFrame(pooled)
 	if err := a.dev.Tx(buf, nil); err != nil {
 		a.logger.Error("I2CAdapterPeriph: WriteReg: error during Tx: %v", err)
 		return err
 	}
-	a.logger.Detailed("I2CAdapterPeriph: WriteReg: success")
 	return nil
 }
 
+// ReadReg читает регистр одной транзакцией с повторным START (см. WriteRead).
 func (a *I2CAdapterPeriph) ReadReg(reg uint8, data []byte) error {
-	a.logger.Detailed("I2CAdapterPeriph: ReadReg: register=0x%X", reg)
-	if err := a.dev.Tx([]byte{reg}, data); err != nil {
-		a.logger.Error("I2CAdapterPeriph: ReadReg: error during Tx: %v", err)
+	if err := a.WriteRead([]byte{reg}, data); err != nil {
+		a.logger.Error("I2CAdapterPeriph: ReadReg: %v", err)
 		return err
 	}
-	a.logger.Detailed("I2CAdapterPeriph: ReadReg: success, data=%v", data)
 	return nil
 }
 
+// WriteRead записывает w и читает r одной транзакцией с повторным START.
+func (a *I2CAdapterPeriph) WriteRead(w, r []byte) error {
+	if err := a.dev.Tx(w, r); err != nil {
+		return fmt.Errorf("error during Tx: %w", err)
+	}
+	return nil
+}
+
+// Capabilities сообщает возможности адаптера: запись любой длины и чтение
+// регистра одной транзакцией Tx.
+func (a *I2CAdapterPeriph) Capabilities() I2CCapabilities {
+	return I2CCapabilities{CombinedWriteRead: true}
+}
+
 func (a *I2CAdapterPeriph) Close() error {
 	a.logger.Basic("I2CAdapterPeriph: Close called")
-	// Для periph.io обычно закрывать устройство не требуется.
+	// Для periph.io обычно закрывать устройство не требуется; шину закрывает
+	// тот, кто её открыл.
+	if a.bus != nil {
+		return a.bus.Close()
+	}
 	return nil
 }
@@ -0,0 +1,76 @@
+package pca9685
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AdapterConfig – параметры открытия адаптера по имени через OpenAdapter.
+type AdapterConfig struct {
+	Bus     string            // Шина: номер ("1"), путь ("/dev/i2c-1") или порт – зависит от адаптера
+	Address uint8             // 7-битный адрес PCA9685 (по умолчанию 0x40)
+	Params  map[string]string // Дополнительные параметры, специфичные для адаптера
+}
+
+// AdapterFactory открывает адаптер I2C по параметрам cfg.
+type AdapterFactory func(cfg AdapterConfig, opts ...AdapterOption) (I2C, error)
+
+var (
+	adaptersMu sync.RWMutex
+	adapters   = make(map[string]AdapterFactory)
+)
+
+// RegisterAdapter регистрирует фабрику адаптера под именем name. Сторонние
+// адаптеры (USB-мосты, SDK производителей) регистрируются из init своего
+// пакета и становятся доступны через OpenAdapter без изменения драйвера.
+// Повторная регистрация имени или nil-фабрика вызывают панику.
+func RegisterAdapter(name string, factory AdapterFactory) {
+	adaptersMu.Lock()
+	defer adaptersMu.Unlock()
+	if factory == nil {
+		panic("pca9685: RegisterAdapter factory is nil")
+	}
+	if _, dup := adapters[name]; dup {
+		panic("pca9685: RegisterAdapter called twice for adapter " + name)
+	}
+	adapters[name] = factory
+}
+
+// Adapters возвращает отсортированный список адаптеров, зарегистрированных
+// на текущей платформе.
+func Adapters() []string {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+	names := make([]string, 0, len(adapters))
+	for name := range adapters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenAdapter открывает зарегистрированный адаптер name.
+func OpenAdapter(name string, cfg AdapterConfig, opts ...AdapterOption) (I2C, error) {
+	adaptersMu.RLock()
+	factory, ok := adapters[name]
+	adaptersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown adapter %q (registered: %s)", name, strings.Join(Adapters(), ", "))
+	}
+	if cfg.Address == 0 {
+		cfg.Address = 0x40
+	}
+	dev, err := factory(cfg, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open adapter %q: %w", name, err)
+	}
+	return dev, nil
+}
+
+func init() {
+	RegisterAdapter("test", func(cfg AdapterConfig, opts ...AdapterOption) (I2C, error) {
+		return NewTestI2C(opts...), nil
+	})
+}
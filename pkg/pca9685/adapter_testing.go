@@ -1,53 +1,98 @@
 package pca9685
 
-import "sync"
+import (
+	"fmt"
+	"sync"
+)
 
 // TestI2C представляет адаптер-эмулятор I2C для MacOS/Windows или тестового устройства.
+// Регистры эмулируются с автоинкрементом адреса: запись и чтение нескольких
+// байт затрагивают последовательные регистры.
 type TestI2C struct {
 	mu        sync.RWMutex
-	registers map[uint8][]byte
-	logger    Logger
+	registers [256]byte
+	stress    *stressState // режим стресс-тестирования, см. EnableStress
+	logger    adapterLogger
 }
 
-// NewTestI2C создаёт новый адаптер-эмулятор I2C.
-func NewTestI2C() *TestI2C {
+// NewTestI2C создаёт новый адаптер-эмулятор I2C. Без опции WithLogger до
+// передачи в New используется подробный стандартный логгер, а после –
+// логгер контроллера.
+func NewTestI2C(opts ...AdapterOption) *TestI2C {
 	return &TestI2C{
-		registers: make(map[uint8][]byte),
-		logger:    NewDefaultLogger(LogLevelDetailed),
+		logger: newAdapterLogger(NewDefaultLogger(LogLevelDetailed), opts),
 	}
 }
 
-// WriteReg эмулирует запись в регистр, сохраняя данные в памяти.
+func (t *TestI2C) inheritLogger(logger Logger) {
+	t.logger.inherit(logger)
+}
+
+// Capabilities сообщает возможности эмулятора: запись любой длины и чтение
+// одной транзакцией.
+func (t *TestI2C) Capabilities() I2CCapabilities {
+	return I2CCapabilities{CombinedWriteRead: true}
+}
+
+// WriteReg эмулирует запись в регистры, сохраняя данные в памяти.
 func (t *TestI2C) WriteReg(reg uint8, data []byte) error {
 	t.logger.Detailed("TestI2C: WriteReg: Writing to register 0x%X, data: %v", reg, data)
+	s := t.stressState()
+	s.jitter()
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	buf := make([]byte, len(data))
-	copy(buf, data)
-	t.registers[reg] = buf
-	t.logger.Detailed("TestI2C: WriteReg: Successfully wrote to register 0x%X, data: %v", reg, buf)
+	if s != nil {
+		s.checkWrite(t.registers[RegMode1], reg, data)
+	}
+	copy(t.registers[reg:], data)
+	t.logger.Detailed("TestI2C: WriteReg: Successfully wrote to register 0x%X", reg)
 	return nil
 }
 
-// ReadReg эмулирует чтение из регистра. Если значение не найдено, возвращает нули.
+// ReadReg эмулирует чтение из регистров. Ещё не записанные регистры и
+// адреса за пределами карты регистров читаются как нули.
 func (t *TestI2C) ReadReg(reg uint8, data []byte) error {
 	t.logger.Detailed("TestI2C: ReadReg: Reading from register 0x%X, expecting %d bytes", reg, len(data))
+	// В стресс-режиме запись указателя и чтение – отдельные транзакции.
+	if s := t.stressState(); s != nil {
+		s.jitter()
+		seq := s.setPointer()
+		s.jitter()
+		s.checkPointer(seq, reg)
+	}
+	t.readRegisters(reg, data)
+	t.logger.Detailed("TestI2C: ReadReg: register 0x%X, data: %v", reg, data)
+	return nil
+}
+
+func (t *TestI2C) readRegisters(reg uint8, data []byte) {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
-	if buf, ok := t.registers[reg]; ok {
-		n := copy(data, buf)
-		// Если записанное значение короче запрошенного, дополняем нулями.
-		for i := n; i < len(data); i++ {
-			data[i] = 0
+	n := copy(data, t.registers[reg:])
+	for i := n; i < len(data); i++ {
+		data[i] = 0
+	}
+}
+
+// WriteRead эмулирует комбинированную транзакцию: первый байт w задаёт
+// указатель регистра, остальные записываются начиная с него, затем r
+// читается начиная с указателя.
+func (t *TestI2C) WriteRead(w, r []byte) error {
+	if len(w) == 0 {
+		return fmt.Errorf("register pointer is required")
+	}
+	if len(w) > 1 {
+		if err := t.WriteReg(w[0], w[1:]); err != nil {
+			return err
 		}
-		t.logger.Detailed("TestI2C: ReadReg: Found register 0x%X, data: %v", reg, data)
-		return nil
 	}
-	// Если регистр не найден, возвращаем нули.
-	for i := range data {
-		data[i] = 0
+	s := t.stressState()
+	s.jitter()
+	if s != nil {
+		s.setPointer()
 	}
-	t.logger.Detailed("TestI2C: ReadReg: Register 0x%X not found, returning zeros: %v", reg, data)
+	t.readRegisters(w[0], r)
+	t.logger.Detailed("TestI2C: WriteRead: register 0x%X, data: %v", w[0], r)
 	return nil
 }
 
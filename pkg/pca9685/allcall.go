@@ -0,0 +1,175 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultAllCallAddress – адрес ALLCALL после включения питания.
+const DefaultAllCallAddress = 0x70
+
+// DisableAllCall отключает ответ устройства на адрес ALLCALL.
+func (pca *PCA9685) DisableAllCall() error {
+	pca.logger.Detailed("Отключение режима All Call")
+	return pca.UpdateMode1(0, Mode1AllCall)
+}
+
+// SetAllCallAddress задаёт 7-битный адрес ALLCALL устройства.
+func (pca *PCA9685) SetAllCallAddress(addr uint8) error {
+	pca.logger.Basic("Установка адреса All Call: 0x%X", addr)
+	if addr > 0x7F {
+		pca.logger.Error("SetAllCallAddress: неверный адрес 0x%X", addr)
+		return fmt.Errorf("invalid 7-bit ALLCALL address: 0x%X", addr)
+	}
+	if err := pca.writeReg(pca.ctx, "SetAllCallAddress", -1, pca.chip.allCallReg(), []byte{addr << 1}); err != nil {
+		pca.logger.Error("SetAllCallAddress: не удалось записать адрес: %v", err)
+		return fmt.Errorf("failed to set ALLCALL address: %w", err)
+	}
+	return nil
+}
+
+// AllCallAddress возвращает текущий 7-битный адрес ALLCALL устройства.
+func (pca *PCA9685) AllCallAddress() (uint8, error) {
+	data := make([]byte, 1)
+	if err := pca.readReg(pca.ctx, "AllCallAddress", -1, pca.chip.allCallReg(), data); err != nil {
+		pca.logger.Error("AllCallAddress: не удалось прочитать адрес: %v", err)
+		return 0, fmt.Errorf("failed to read ALLCALL address: %w", err)
+	}
+	return data[0] >> 1, nil
+}
+
+// ControllerGroup объединяет несколько контроллеров на одной шине. Запись
+// через адрес ALLCALL обновляет все микросхемы группы одной транзакцией,
+// что позволяет синхронно гасить всю установку.
+type ControllerGroup struct {
+	mu      sync.Mutex
+	allCall I2C
+	master  float64
+	skew    time.Duration // окно последнего CommitFrame
+
+	// Состав группы меняется Add и Remove; members заменяется целиком, поэтому
+	// полученный list() срез можно обходить без блокировки.
+	membersMu   sync.RWMutex
+	members     []*PCA9685
+	offline     map[*PCA9685]bool // контроллеры, не ответившие Watch
+	base        *Config           // базовая конфигурация AddDevice
+	allCallAddr int               // адрес EnableAllCall или -1
+}
+
+// NewControllerGroup создаёт группу. allCall – адаптер, открытый на адрес
+// ALLCALL шины; он может быть nil, если групповая запись не нужна.
+func NewControllerGroup(allCall I2C, members ...*PCA9685) *ControllerGroup {
+	return &ControllerGroup{
+		allCall:     allCall,
+		members:     append([]*PCA9685(nil), members...),
+		master:      1,
+		offline:     make(map[*PCA9685]bool),
+		allCallAddr: -1,
+	}
+}
+
+// Members возвращает контроллеры группы.
+func (g *ControllerGroup) Members() []*PCA9685 {
+	return append([]*PCA9685(nil), g.list()...)
+}
+
+// list возвращает текущий состав группы. Срез не изменяется.
+func (g *ControllerGroup) list() []*PCA9685 {
+	g.membersMu.RLock()
+	defer g.membersMu.RUnlock()
+	return g.members
+}
+
+// EnableAllCall задаёт адрес ALLCALL и включает ответ на него у всех
+// контроллеров группы.
+// Адрес запоминается и применяется к контроллерам, добавленным позже или
+// вернувшимся на шину.
+func (g *ControllerGroup) EnableAllCall(addr uint8) error {
+	g.membersMu.Lock()
+	g.allCallAddr = int(addr)
+	g.membersMu.Unlock()
+	for i, pca := range g.list() {
+		if err := enableAllCall(pca, addr); err != nil {
+			return fmt.Errorf("controller %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// enableAllCall задаёт адрес ALLCALL контроллера и включает ответ на него.
+func enableAllCall(pca *PCA9685, addr uint8) error {
+	if err := pca.SetAllCallAddress(addr); err != nil {
+		return err
+	}
+	return pca.EnableAllCall()
+}
+
+// WriteAllCall устанавливает одинаковые значения on/off на всех каналах всех
+// контроллеров группы одной записью в регистр ALL_LED (у PCA9635 – в
+// регистры PWM) по адресу ALLCALL.
+// Учитывается мастер-яркость группы, но не мастер-яркость отдельных устройств.
+func (g *ControllerGroup) WriteAllCall(ctx context.Context, on, off uint16) error {
+	if g.allCall == nil {
+		return fmt.Errorf("controller group has no ALLCALL device")
+	}
+	if err := validatePWM(on, off); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Все члены группы блокируются, чтобы кэш совпадал с состоянием микросхем.
+	members := g.list()
+	for _, pca := range members {
+		pca.mu.Lock()
+		defer pca.mu.Unlock()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	won, woff := scalePWM(on, off, g.master)
+	// Групповая запись обошла бы ограничения каналов и затемнение
+	// (BlackoutAll), а микросхемы разных типов не понимают общую запись,
+	// поэтому такие группы обновляются по отдельности.
+	chip, separate := ChipPCA9685, false
+	for i, pca := range members {
+		if i == 0 {
+			chip = pca.chip
+		}
+		separate = separate || pca.chip != chip || pca.blackout.Load() || (pulseTicks(won, woff) > 0 && pca.hasLimits())
+		separate = separate || (g.master < 1 && pca.undimmed.Load() != 0)
+	}
+	if separate {
+		for _, pca := range members {
+			if err := pca.setAllLocked(ctx, "WriteAllCall", on, off); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var buf [16]byte
+	reg, data := chip.allFrame(won, woff, buf[:])
+	if err := g.allCall.WriteReg(reg, data); err != nil {
+		for i, pca := range members {
+			if i == 0 {
+				pca.logger.Error("WriteAllCall: не удалось выполнить групповую запись: %v", err)
+			}
+			pca.reportError("WriteAllCall", -1, err)
+		}
+		return fmt.Errorf("failed to write ALLCALL: %w", err)
+	}
+	now := time.Now()
+	for _, pca := range members {
+		pca.observeWrite(now, reg, data)
+		pca.cacheAll(on, off)
+	}
+	return nil
+}
+
+// Blackout синхронно выключает все каналы группы.
+func (g *ControllerGroup) Blackout(ctx context.Context) error {
+	return g.WriteAllCall(ctx, 0, 0)
+}
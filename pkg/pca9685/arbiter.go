@@ -0,0 +1,306 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOverridden возвращается командой источника, канал которого удерживает
+// источник с более высоким приоритетом (см. SetSourcePriority).
+var ErrOverridden = errors.New("channel is held by a higher-priority source")
+
+// ArbitrationMode определяет выбор значения канала среди источников с
+// одинаковым наивысшим приоритетом.
+type ArbitrationMode int
+
+const (
+	// ArbitrationLTP – действует последняя команда (Latest Takes Precedence).
+	ArbitrationLTP ArbitrationMode = iota
+	// ArbitrationHTP – действует наибольшее значение (Highest Takes
+	// Precedence), как в световых пультах.
+	ArbitrationHTP
+)
+
+func (m ArbitrationMode) String() string {
+	switch m {
+	case ArbitrationLTP:
+		return "LTP"
+	case ArbitrationHTP:
+		return "HTP"
+	default:
+		return fmt.Sprintf("ArbitrationMode(%d)", int(m))
+	}
+}
+
+// SourceClaim – последнее значение, заданное источником для канала.
+type SourceClaim struct {
+	Source   string    `json:"source"`
+	Priority int       `json:"priority"`
+	On       uint16    `json:"on"`
+	Off      uint16    `json:"off"`
+	Time     time.Time `json:"time"`
+	Active   bool      `json:"active"` // Значение источника выведено на канал
+}
+
+// arbiter хранит приоритеты источников и их значения каналов. Пока
+// приоритеты не заданы, арбитраж выключен и действует последняя запись.
+type arbiter struct {
+	mu         sync.Mutex
+	mode       ArbitrationMode
+	priorities map[string]int
+	claims     [16][]SourceClaim // в порядке последних команд
+}
+
+type arbitratedKey struct{}
+
+// arbitrated помечает контекст записи, значение которой уже выбрано арбитражем.
+func arbitrated(ctx context.Context) context.Context {
+	return context.WithValue(ctx, arbitratedKey{}, true)
+}
+
+// SetSourcePriority задаёт приоритет источника команд source (см.
+// WithSource). Имя без двоеточия относится ко всем источникам вида
+// "source:<имя>", например "scheduler" – ко всем заданиям планировщика;
+// точное имя имеет преимущество. Источники без заданного приоритета имеют
+// приоритет 0.
+//
+// Первый вызов включает арбитраж каналов: каждый источник, изменивший канал,
+// удерживает его до ReleaseSource. Команда источника с более низким
+// приоритетом, чем у удерживающего, не выводится и возвращает ошибку
+// ErrOverridden, но её значение запоминается и выводится, когда источники с
+// более высоким приоритетом освободят канал. Среди источников с одинаковым
+// приоритетом значение выбирается по SetArbitrationMode.
+//
+// Арбитраж применяется к SetPWM, SetMultiPWM, SetMultiPWMValues, SetAllPWM
+// и всей периферии, работающей через них. Аварийные команды
+// (EmergencyStop, BlackoutAll, безопасные значения) и групповые записи
+// ControllerGroup через ALLCALL выполняются без арбитража.
+func (pca *PCA9685) SetSourcePriority(source string, priority int) {
+	a := &pca.arb
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.priorities == nil {
+		a.priorities = make(map[string]int)
+	}
+	a.priorities[source] = priority
+	for ch := range a.claims {
+		for i := range a.claims[ch] {
+			a.claims[ch][i].Priority = a.priority(a.claims[ch][i].Source)
+		}
+	}
+	pca.logger.Basic("Приоритет источника %q: %d", source, priority)
+}
+
+// SetArbitrationMode задаёт выбор значения среди источников с одинаковым
+// приоритетом (по умолчанию ArbitrationLTP). Режим действует с
+// последующих команд.
+func (pca *PCA9685) SetArbitrationMode(mode ArbitrationMode) error {
+	if mode != ArbitrationLTP && mode != ArbitrationHTP {
+		return fmt.Errorf("unknown arbitration mode: %v", mode)
+	}
+	pca.arb.mu.Lock()
+	pca.arb.mode = mode
+	pca.arb.mu.Unlock()
+	pca.logger.Basic("Режим арбитража каналов: %v", mode)
+	return nil
+}
+
+// ResetArbitration выключает арбитраж: приоритеты и удерживаемые значения
+// сбрасываются, выходы не изменяются.
+func (pca *PCA9685) ResetArbitration() {
+	pca.arb.mu.Lock()
+	pca.arb.priorities = nil
+	pca.arb.claims = [16][]SourceClaim{}
+	pca.arb.mu.Unlock()
+	pca.logger.Basic("Арбитраж каналов выключен")
+}
+
+// ReleaseSource освобождает каналы channels (все, если не указаны),
+// удерживаемые источником source. Если значение источника было выведено,
+// канал получает значение источника, который теперь выигрывает арбитраж;
+// если других источников нет, канал сохраняет текущее значение.
+func (pca *PCA9685) ReleaseSource(ctx context.Context, source string, channels ...int) error {
+	for _, c := range channels {
+		if err := pca.validateChannel(c); err != nil {
+			pca.logger.Error("ReleaseSource: неверный номер канала %d: %v", c, err)
+			return err
+		}
+	}
+	if len(channels) == 0 {
+		channels = make([]int, len(pca.channels))
+		for i := range channels {
+			channels[i] = i
+		}
+	}
+	pca.logger.Detailed("ReleaseSource: источник %q освобождает каналы %v", source, channels)
+	var errs []error
+	for _, c := range channels {
+		next, ok := pca.arb.release(source, c)
+		if !ok {
+			continue
+		}
+		pca.logger.Detailed("ReleaseSource: канал %d переходит к источнику %q", c, next.Source)
+		err := pca.setPWM(arbitrated(ctx), c, next.On, next.Off)
+		pca.record(ctx, JournalEntry{Op: "ReleaseSource", Channel: c, On: next.On, Off: next.Off}, err)
+		if err != nil {
+			pca.logger.Error("ReleaseSource: не удалось восстановить канал %d: %v", c, err)
+			errs = append(errs, fmt.Errorf("channel %d: %w", c, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ChannelSources возвращает значения, заданные источниками для канала, в
+// порядке убывания приоритета, начиная с действующего.
+func (pca *PCA9685) ChannelSources(channel int) ([]SourceClaim, error) {
+	if err := pca.validateChannel(channel); err != nil {
+		return nil, err
+	}
+	return pca.arb.sources(channel), nil
+}
+
+// active сообщает, включён ли арбитраж.
+func (a *arbiter) active() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.priorities != nil
+}
+
+// priority возвращает приоритет источника. Вызывается с захваченным a.mu.
+func (a *arbiter) priority(source string) int {
+	if p, ok := a.priorities[source]; ok {
+		return p
+	}
+	if i := strings.IndexByte(source, ':'); i >= 0 {
+		return a.priorities[source[:i]]
+	}
+	return 0
+}
+
+// claim запоминает значение источника source для канала ch и возвращает
+// значение, которое следует вывести, или ошибку ErrOverridden.
+func (a *arbiter) claim(source string, ch int, on, off uint16) (uint16, uint16, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.priorities == nil {
+		return on, off, nil
+	}
+	list := a.claims[ch]
+	for i := range list {
+		if list[i].Source == source {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	c := SourceClaim{Source: source, Priority: a.priority(source), On: on, Off: off, Time: time.Now()}
+	a.claims[ch] = append(list, c)
+
+	win, _ := a.winner(ch)
+	if win.Priority > c.Priority {
+		return 0, 0, fmt.Errorf("%w: channel %d held by %q", ErrOverridden, ch, win.Source)
+	}
+	return win.On, win.Off, nil
+}
+
+// release удаляет значение источника source канала ch. Возвращает значение
+// нового победителя, если его нужно вывести.
+func (a *arbiter) release(source string, ch int) (SourceClaim, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	prev, had := a.winner(ch)
+	list := a.claims[ch]
+	found := false
+	for i := range list {
+		if list[i].Source == source {
+			a.claims[ch] = append(list[:i], list[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return SourceClaim{}, false
+	}
+	next, ok := a.winner(ch)
+	if !ok || !had || (next.On == prev.On && next.Off == prev.Off) {
+		return SourceClaim{}, false
+	}
+	return next, true
+}
+
+// winner возвращает действующее значение канала ch. Вызывается с захваченным
+// a.mu.
+func (a *arbiter) winner(ch int) (SourceClaim, bool) {
+	var win SourceClaim
+	found := false
+	for _, c := range a.claims[ch] {
+		switch {
+		case !found || c.Priority > win.Priority:
+			win, found = c, true
+		case c.Priority < win.Priority:
+		case a.mode == ArbitrationLTP || pulseTicks(c.On, c.Off) >= pulseTicks(win.On, win.Off):
+			// Список упорядочен по времени: при равенстве выигрывает более
+			// поздняя команда.
+			win = c
+		}
+	}
+	return win, found
+}
+
+func (a *arbiter) sources(ch int) []SourceClaim {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	win, _ := a.winner(ch)
+	list := make([]SourceClaim, len(a.claims[ch]))
+	copy(list, a.claims[ch])
+	for i := range list {
+		list[i].Active = list[i].Source == win.Source
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Active != list[j].Active {
+			return list[i].Active
+		}
+		return list[i].Priority > list[j].Priority
+	})
+	return list
+}
+
+// holder возвращает источник, значение которого выведено на канал ch, или
+// пустую строку.
+func (a *arbiter) holder(ch int) string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	win, _ := a.winner(ch)
+	return win.Source
+}
+
+// arbitrate выбирает значение канала для команды из контекста ctx. Запись,
+// уже прошедшая арбитраж, не проверяется повторно.
+func (pca *PCA9685) arbitrate(ctx context.Context, channel int, on, off uint16) (uint16, uint16, error) {
+	if ctx.Value(arbitratedKey{}) != nil {
+		return on, off, nil
+	}
+	return pca.arb.claim(SourceFromContext(ctx), channel, on, off)
+}
+
+// arbitrateValues пропускает values через арбитраж: возвращает значения для
+// вывода и ошибку ErrOverridden для каналов, удерживаемых другими
+// источниками.
+func (pca *PCA9685) arbitrateValues(ctx context.Context, op string, values []PWMValue) ([]PWMValue, error) {
+	out := make([]PWMValue, 0, len(values))
+	var errs []error
+	for _, v := range values {
+		on, off, err := pca.arbitrate(ctx, v.Channel, v.On, v.Off)
+		if err != nil {
+			pca.record(ctx, JournalEntry{Op: op, Channel: v.Channel, On: v.On, Off: v.Off}, err)
+			errs = append(errs, err)
+			continue
+		}
+		out = append(out, PWMValue{Channel: v.Channel, On: on, Off: off})
+	}
+	return out, errors.Join(errs...)
+}
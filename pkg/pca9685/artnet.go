@@ -0,0 +1,137 @@
+package pca9685
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+const (
+	// ArtNetPort – стандартный UDP порт Art-Net.
+	ArtNetPort = 6454
+	// ArtNetOpDmx – код операции пакета ArtDmx.
+	ArtNetOpDmx = 0x5000
+
+	artNetHeaderSize = 18
+)
+
+var artNetID = []byte("Art-Net\x00")
+
+// ErrArtNetNotDmx возвращается ParseArtDmx для корректных Art-Net пакетов,
+// не являющихся ArtDmx (ArtPoll, ArtSync и т.п.).
+var ErrArtNetNotDmx = errors.New("not an ArtDmx packet")
+
+// ArtNetReceiver принимает пакеты Art-Net (DMX поверх UDP) и передаёт
+// данные универсов в DMXMapper.
+type ArtNetReceiver struct {
+	mapper  *DMXMapper
+	logger  Logger
+	allowed []netip.Prefix // разрешённые отправители, пустой – любые
+}
+
+// ArtNetOption определяет опцию приёмника Art-Net.
+type ArtNetOption func(*ArtNetReceiver)
+
+// WithArtNetAllowedSources принимает пакеты только от отправителей из
+// подсетей prefixes; остальные пакеты отбрасываются. Art-Net не
+// предусматривает аутентификации, поэтому приёмник, доступный из общей
+// сети, следует ограничить адресами пультов и медиасерверов.
+func WithArtNetAllowedSources(prefixes ...netip.Prefix) ArtNetOption {
+	return func(r *ArtNetReceiver) {
+		r.allowed = append(r.allowed, prefixes...)
+	}
+}
+
+// NewArtNetReceiver создаёт приёмник Art-Net. Если logger равен nil,
+// используется стандартный логгер.
+func NewArtNetReceiver(mapper *DMXMapper, logger Logger, opts ...ArtNetOption) *ArtNetReceiver {
+	if logger == nil {
+		logger = NewDefaultLogger(LogLevelBasic)
+	}
+	r := &ArtNetReceiver{
+		mapper: mapper,
+		logger: logger,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// ListenAndServe открывает UDP сокет по адресу addr (например, ":6454")
+// и обрабатывает входящие пакеты до отмены контекста.
+func (r *ArtNetReceiver) ListenAndServe(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		r.logger.Error("ArtNetReceiver: не удалось открыть сокет %s: %v", addr, err)
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return r.Serve(ctx, conn)
+}
+
+// Serve обрабатывает пакеты из conn до отмены контекста. Соединение
+// закрывается при выходе.
+func (r *ArtNetReceiver) Serve(ctx context.Context, conn net.PacketConn) error {
+	r.logger.Basic("ArtNetReceiver: приём Art-Net на %v", conn.LocalAddr())
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	buf := make([]byte, artNetHeaderSize+DMXUniverseSize)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			r.logger.Error("ArtNetReceiver: ошибка чтения: %v", err)
+			return fmt.Errorf("failed to read Art-Net packet: %w", err)
+		}
+
+		if !sourceAllowed(r.allowed, from) {
+			r.logger.Detailed("ArtNetReceiver: пропущен пакет от %v: %v", from, ErrSourceNotAllowed)
+			continue
+		}
+		universe, data, err := ParseArtDmx(buf[:n])
+		if err != nil {
+			if !errors.Is(err, ErrArtNetNotDmx) {
+				r.logger.Detailed("ArtNetReceiver: пропущен пакет от %v: %v", from, err)
+			}
+			continue
+		}
+		r.logger.Detailed("ArtNetReceiver: ArtDmx от %v, универс %d, %d слотов", from, universe, len(data))
+		if err := r.mapper.Apply(ctx, universe, data); err != nil {
+			r.logger.Error("ArtNetReceiver: ошибка применения универса %d: %v", universe, err)
+		}
+	}
+}
+
+// ParseArtDmx разбирает пакет ArtDmx и возвращает 15-битный номер
+// универса (Port-Address) и данные слотов. Пакеты с нечётной или нулевой
+// длиной данных отклоняются.
+func ParseArtDmx(packet []byte) (universe uint16, data []byte, err error) {
+	if len(packet) < 10 || !bytes.Equal(packet[:8], artNetID) {
+		return 0, nil, fmt.Errorf("invalid Art-Net header")
+	}
+	if op := binary.LittleEndian.Uint16(packet[8:10]); op != ArtNetOpDmx {
+		return 0, nil, ErrArtNetNotDmx
+	}
+	if len(packet) < artNetHeaderSize {
+		return 0, nil, fmt.Errorf("ArtDmx packet too short: %d bytes", len(packet))
+	}
+
+	universe = uint16(packet[15]&0x7F)<<8 | uint16(packet[14])
+	length := int(binary.BigEndian.Uint16(packet[16:18]))
+	// Спецификация Art-Net требует чётную длину от 2 до 512.
+	if length < 2 || length > DMXUniverseSize || length%2 != 0 {
+		return 0, nil, fmt.Errorf("invalid ArtDmx length: %d", length)
+	}
+	if len(packet) < artNetHeaderSize+length {
+		return 0, nil, fmt.Errorf("ArtDmx packet truncated: want %d data bytes, got %d", length, len(packet)-artNetHeaderSize)
+	}
+	return universe, packet[artNetHeaderSize : artNetHeaderSize+length], nil
+}
@@ -0,0 +1,234 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// CommandPriority – приоритет команды асинхронной записи.
+type CommandPriority int
+
+const (
+	// PriorityFrame – кадры анимаций. При переполнении очереди отбрасываются самые старые.
+	PriorityFrame CommandPriority = iota
+	// PriorityNormal – обычные команды управления.
+	PriorityNormal
+	// PrioritySafety – команды безопасности (аварийная остановка, остановка насосов).
+	// Выполняются раньше всех остальных.
+	PrioritySafety
+
+	numPriorities = 3
+)
+
+// ErrQueueFull возвращается, если очередь команд заполнена.
+var ErrQueueFull = errors.New("command queue is full")
+
+// ErrWriterStopped возвращается Submit после завершения Run.
+var ErrWriterStopped = errors.New("async writer stopped")
+
+// ErrEmergencyStopped передаётся в канал результата обычной команды,
+// отменённой аварийной остановкой.
+var ErrEmergencyStopped = errors.New("command cancelled by emergency stop")
+
+// ErrFrameDropped передаётся в канал результата кадра, вытесненного более новым.
+var ErrFrameDropped = errors.New("frame dropped")
+
+// asyncCommand – команда в очереди асинхронной записи.
+type asyncCommand struct {
+	fn     func(ctx context.Context) error
+	result chan error
+}
+
+// AsyncWriter выполняет команды записи в фоновой горутине в порядке приоритета:
+// команды безопасности вытесняют накопившиеся кадры анимаций.
+type AsyncWriter struct {
+	pca        *PCA9685
+	frameLimit int
+	queueLimit int
+	mu         sync.Mutex
+	queues     [numPriorities][]asyncCommand
+	dropped    uint64
+	stopped    bool
+	wake       chan struct{}
+}
+
+// AsyncWriterOption определяет опцию конфигурации асинхронной записи.
+type AsyncWriterOption func(*AsyncWriter)
+
+// WithFrameQueueLimit ограничивает число ожидающих кадров (по умолчанию 4).
+func WithFrameQueueLimit(n int) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		if n > 0 {
+			w.frameLimit = n
+		}
+	}
+}
+
+// WithQueueLimit ограничивает число ожидающих обычных команд и команд
+// безопасности (по умолчанию 256 для каждого приоритета).
+func WithQueueLimit(n int) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		if n > 0 {
+			w.queueLimit = n
+		}
+	}
+}
+
+// NewAsyncWriter создаёт асинхронную запись для контроллера. Команды выполняются
+// только после запуска Run.
+func NewAsyncWriter(pca *PCA9685, opts ...AsyncWriterOption) *AsyncWriter {
+	w := &AsyncWriter{
+		pca:        pca,
+		frameLimit: 4,
+		queueLimit: 256,
+		wake:       make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Submit ставит команду в очередь с указанным приоритетом. В возвращаемый канал
+// будет передан результат выполнения команды. После завершения Run команды не
+// принимаются: возвращается ErrWriterStopped.
+func (w *AsyncWriter) Submit(priority CommandPriority, fn func(ctx context.Context) error) (<-chan error, error) {
+	if priority < PriorityFrame || priority > PrioritySafety {
+		return nil, fmt.Errorf("invalid command priority: %d", priority)
+	}
+	cmd := asyncCommand{fn: fn, result: make(chan error, 1)}
+
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return nil, ErrWriterStopped
+	}
+	q := w.queues[priority]
+	if priority == PriorityFrame {
+		for len(q) >= w.frameLimit {
+			q[0].result <- ErrFrameDropped
+			q = q[1:]
+			w.dropped++
+		}
+	} else if len(q) >= w.queueLimit {
+		w.mu.Unlock()
+		w.pca.logger.Error("AsyncWriter: очередь приоритета %d заполнена", priority)
+		return nil, ErrQueueFull
+	}
+	w.queues[priority] = append(q, cmd)
+	w.mu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return cmd.result, nil
+}
+
+// SetPWM ставит в очередь установку значения канала.
+func (w *AsyncWriter) SetPWM(priority CommandPriority, channel int, on, off uint16) (<-chan error, error) {
+	return w.Submit(priority, func(ctx context.Context) error {
+		return w.pca.SetPWM(ctx, channel, on, off)
+	})
+}
+
+// Frame ставит в очередь кадр анимации. Если очередь кадров заполнена,
+// самый старый кадр отбрасывается.
+func (w *AsyncWriter) Frame(values []PWMValue) (<-chan error, error) {
+	frame := append([]PWMValue(nil), values...)
+	return w.Submit(PriorityFrame, func(ctx context.Context) error {
+		return w.pca.SetMultiPWMValues(ctx, frame)
+	})
+}
+
+// EmergencyStop отбрасывает все ожидающие кадры (ErrFrameDropped) и обычные
+// команды (ErrEmergencyStopped), чтобы после остановки они не включили выходы
+// снова, и ставит аварийную остановку контроллера в очередь команд
+// безопасности. Ожидающие команды безопасности сохраняются.
+func (w *AsyncWriter) EmergencyStop() (<-chan error, error) {
+	w.pca.logger.Basic("AsyncWriter: аварийная остановка")
+	w.mu.Lock()
+	for _, cmd := range w.queues[PriorityFrame] {
+		cmd.result <- ErrFrameDropped
+		w.dropped++
+	}
+	for _, cmd := range w.queues[PriorityNormal] {
+		cmd.result <- ErrEmergencyStopped
+	}
+	w.queues[PriorityFrame] = nil
+	w.queues[PriorityNormal] = nil
+	w.mu.Unlock()
+	return w.Submit(PrioritySafety, w.pca.EmergencyStop)
+}
+
+// QueueDepth возвращает число ожидающих команд для каждого приоритета.
+func (w *AsyncWriter) QueueDepth() (frames, normal, safety int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.queues[PriorityFrame]), len(w.queues[PriorityNormal]), len(w.queues[PrioritySafety])
+}
+
+// Dropped возвращает общее число отброшенных кадров.
+func (w *AsyncWriter) Dropped() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
+
+// Run выполняет команды из очереди до отмены контекста. Оставшиеся команды
+// получают ошибку контекста, новые отклоняются Submit. Повторно Run не
+// запускается.
+func (w *AsyncWriter) Run(ctx context.Context) error {
+	w.pca.logger.Basic("AsyncWriter: запуск")
+	for {
+		cmd, ok := w.next()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				w.drain(ctx.Err())
+				w.pca.logger.Basic("AsyncWriter: остановка")
+				return ctx.Err()
+			case <-w.wake:
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			cmd.result <- ctx.Err()
+			continue
+		}
+
+		err := cmd.fn(ctx)
+		if err != nil {
+			w.pca.logger.Error("AsyncWriter: ошибка выполнения команды: %v", err)
+		}
+		cmd.result <- err
+	}
+}
+
+// next извлекает команду с наивысшим приоритетом.
+func (w *AsyncWriter) next() (asyncCommand, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for p := PrioritySafety; p >= PriorityFrame; p-- {
+		if q := w.queues[p]; len(q) > 0 {
+			w.queues[p] = q[1:]
+			return q[0], true
+		}
+	}
+	return asyncCommand{}, false
+}
+
+// drain завершает все ожидающие команды ошибкой err и закрывает очередь.
+func (w *AsyncWriter) drain(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	for p := range w.queues {
+		for _, cmd := range w.queues[p] {
+			cmd.result <- err
+		}
+		w.queues[p] = nil
+	}
+}
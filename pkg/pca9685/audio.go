@@ -0,0 +1,224 @@
+package pca9685
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// AudioLevelSource – источник уровня звука для светомузыки. AudioLevel
+// возвращает последний измеренный уровень (RMS или пик) от 0.0 до 1.0 и
+// вызывается в каждом кадре рендерера, поэтому не должен блокироваться.
+type AudioLevelSource interface {
+	AudioLevel() float64
+}
+
+// AudioLevelFunc позволяет использовать обычную функцию как AudioLevelSource.
+type AudioLevelFunc func() float64
+
+// AudioLevel вызывает f().
+func (f AudioLevelFunc) AudioLevel() float64 {
+	return f()
+}
+
+// AudioInput – AudioLevelSource, в который приложение передаёт отсчёты
+// уровня из своего потока обработки звука (колбэк аудиобиблиотеки, UDP от
+// анализатора и т.п.).
+type AudioInput struct {
+	level atomic.Uint64 // биты float64
+}
+
+// Push сохраняет очередной отсчёт уровня. Значения вне диапазона 0.0–1.0
+// ограничиваются.
+func (in *AudioInput) Push(level float64) {
+	in.level.Store(math.Float64bits(math.Max(0, math.Min(1, level))))
+}
+
+// AudioLevel возвращает последний отсчёт.
+func (in *AudioInput) AudioLevel() float64 {
+	return math.Float64frombits(in.level.Load())
+}
+
+// AudioMode – способ отображения уровня звука на каналы.
+type AudioMode int
+
+const (
+	// AudioFollow – все каналы группы светят пропорционально огибающей уровня.
+	AudioFollow AudioMode = iota
+	// AudioVU – индикатор уровня: каналы загораются по порядку, как шкала
+	// VU-метра, последний горящий канал – частично.
+	AudioVU
+	// AudioBeat – на каждом обнаруженном ударе (резком превышении среднего
+	// уровня) группа вспыхивает и затухает за Decay.
+	AudioBeat
+)
+
+// AudioEffectConfig содержит настройки светомузыкального эффекта.
+type AudioEffectConfig struct {
+	Source   AudioLevelSource
+	Mode     AudioMode
+	Channels []int     // Каналы группы; для AudioVU – в порядке шкалы
+	Weights  []float64 // Множители каналов (например, доли R, G, B цвета); nil – все 1.0
+	Gain     float64   // Усиление уровня (0 – 1.0)
+	Gamma    float64   // Гамма-коррекция яркости (0 – линейная)
+	Max      uint16    // Значение off при полной яркости (0 – 4095)
+
+	Attack  time.Duration // Время нарастания огибающей (по умолчанию 10 мс)
+	Release time.Duration // Время спада огибающей (по умолчанию 300 мс)
+
+	Threshold float64       // AudioBeat: удар – уровень выше среднего в Threshold раз (по умолчанию 1.5)
+	Decay     time.Duration // AudioBeat: время затухания вспышки (по умолчанию 200 мс)
+}
+
+// Параметры эффекта по умолчанию.
+const (
+	defaultAudioAttack    = 10 * time.Millisecond
+	defaultAudioRelease   = 300 * time.Millisecond
+	defaultAudioThreshold = 1.5
+	defaultAudioDecay     = 200 * time.Millisecond
+
+	audioAverageWindow = time.Second            // постоянная времени среднего уровня для AudioBeat
+	audioBeatHoldoff   = 100 * time.Millisecond // минимальный интервал между ударами
+	audioBeatFloor     = 0.05                   // уровень, ниже которого удары не ищутся
+)
+
+// AudioEffect – источник рендерера (RenderSource), отображающий уровень
+// звука на яркость группы каналов. Эффект подключается к рендереру
+// контроллера как любой другой слой, поэтому светомузыка сочетается с
+// остальными анимациями без отдельного цикла записи:
+//
+//	in := &pca9685.AudioInput{}
+//	vu, _ := pca9685.NewAudioEffect(pca9685.AudioEffectConfig{Source: in, Mode: pca9685.AudioVU, Channels: []int{0, 1, 2, 3}})
+//	renderer.Add("vu", vu)
+//	// в колбэке аудио: in.Push(rms)
+type AudioEffect struct {
+	cfg     AudioEffectConfig
+	stopped atomic.Bool
+
+	// Состояние кадров; изменяется только в Render.
+	last     time.Time
+	envelope float64
+	average  float64
+	beat     time.Time
+}
+
+// NewAudioEffect создаёт светомузыкальный эффект.
+func NewAudioEffect(cfg AudioEffectConfig) (*AudioEffect, error) {
+	if cfg.Source == nil {
+		return nil, fmt.Errorf("audio level source is required")
+	}
+	if cfg.Mode < AudioFollow || cfg.Mode > AudioBeat {
+		return nil, fmt.Errorf("unknown audio mode %d", cfg.Mode)
+	}
+	if len(cfg.Channels) == 0 {
+		return nil, fmt.Errorf("at least one channel is required")
+	}
+	for _, ch := range cfg.Channels {
+		if ch < 0 || ch > 15 {
+			return nil, fmt.Errorf("invalid channel number: %d", ch)
+		}
+	}
+	if cfg.Weights != nil && len(cfg.Weights) != len(cfg.Channels) {
+		return nil, fmt.Errorf("got %d weights for %d channels", len(cfg.Weights), len(cfg.Channels))
+	}
+	for _, w := range cfg.Weights {
+		if w < 0 || w > 1 {
+			return nil, fmt.Errorf("channel weights must be between 0 and 1")
+		}
+	}
+	if cfg.Gain < 0 || cfg.Gamma < 0 || cfg.Threshold < 0 || cfg.Max > 4095 {
+		return nil, fmt.Errorf("gain, gamma and threshold must not be negative and max must not exceed 4095")
+	}
+	if cfg.Gain == 0 {
+		cfg.Gain = 1
+	}
+	if cfg.Max == 0 {
+		cfg.Max = 4095
+	}
+	if cfg.Attack <= 0 {
+		cfg.Attack = defaultAudioAttack
+	}
+	if cfg.Release <= 0 {
+		cfg.Release = defaultAudioRelease
+	}
+	if cfg.Threshold == 0 {
+		cfg.Threshold = defaultAudioThreshold
+	}
+	if cfg.Decay <= 0 {
+		cfg.Decay = defaultAudioDecay
+	}
+	cfg.Channels = append([]int(nil), cfg.Channels...)
+	cfg.Weights = append([]float64(nil), cfg.Weights...)
+	return &AudioEffect{cfg: cfg}, nil
+}
+
+// Stop завершает эффект: рендерер удалит его в следующем кадре.
+func (e *AudioEffect) Stop() {
+	e.stopped.Store(true)
+}
+
+// Render реализует RenderSource.
+func (e *AudioEffect) Render(now time.Time, frame *RenderFrame) bool {
+	if e.stopped.Load() {
+		return false
+	}
+	level := math.Min(1, e.cfg.Source.AudioLevel()*e.cfg.Gain)
+	dt := time.Duration(0)
+	if !e.last.IsZero() {
+		dt = now.Sub(e.last)
+	}
+	e.last = now
+
+	// Огибающая: быстрое нарастание, медленный спад.
+	tau := e.cfg.Release
+	if level > e.envelope {
+		tau = e.cfg.Attack
+	}
+	e.envelope += (level - e.envelope) * smoothing(dt, tau)
+
+	switch e.cfg.Mode {
+	case AudioFollow:
+		for i := range e.cfg.Channels {
+			e.set(frame, i, e.envelope)
+		}
+	case AudioVU:
+		lit := e.envelope * float64(len(e.cfg.Channels))
+		for i := range e.cfg.Channels {
+			e.set(frame, i, math.Max(0, math.Min(1, lit-float64(i))))
+		}
+	case AudioBeat:
+		if level > audioBeatFloor && level > e.average*e.cfg.Threshold && now.Sub(e.beat) >= audioBeatHoldoff {
+			e.beat = now
+		}
+		e.average += (level - e.average) * smoothing(dt, audioAverageWindow)
+		pulse := 0.0
+		if !e.beat.IsZero() {
+			pulse = math.Exp(-3 * now.Sub(e.beat).Seconds() / e.cfg.Decay.Seconds())
+		}
+		for i := range e.cfg.Channels {
+			e.set(frame, i, pulse)
+		}
+	}
+	return true
+}
+
+// set задаёт яркость i-го канала группы с учётом множителя и гаммы.
+func (e *AudioEffect) set(frame *RenderFrame, i int, v float64) {
+	if len(e.cfg.Weights) > 0 {
+		v *= e.cfg.Weights[i]
+	}
+	if g := e.cfg.Gamma; g > 0 && g != 1 && v > 0 {
+		v = math.Pow(v, g)
+	}
+	frame.Set(e.cfg.Channels[i], 0, uint16(math.Round(v*float64(e.cfg.Max))))
+}
+
+// smoothing возвращает коэффициент экспоненциального сглаживания для шага dt
+// при постоянной времени tau.
+func smoothing(dt, tau time.Duration) float64 {
+	if dt <= 0 {
+		return 1
+	}
+	return 1 - math.Exp(-dt.Seconds()/tau.Seconds())
+}
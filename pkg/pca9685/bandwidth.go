@@ -0,0 +1,256 @@
+package pca9685
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Стоимость транзакций I2C в тактах шины: каждый байт передаётся девятью
+// тактами (8 бит и ACK), плюс условия START/STOP. Запись – адрес устройства,
+// адрес регистра и данные; чтение дополнительно содержит повторный START и
+// адрес устройства.
+const (
+	i2cByteBits   = 9
+	i2cWriteBits  = 2 + 2*i2cByteBits // START, адрес, регистр, STOP
+	i2cReadBits   = i2cWriteBits + 1 + i2cByteBits
+	defaultBusHz  = 100000 // Standard mode
+	defaultWindow = time.Second
+)
+
+// BandwidthStats – нагрузка на шину за последнее окно измерения.
+type BandwidthStats struct {
+	Transactions float64 // Транзакций в секунду
+	Bytes        float64 // Байт данных в секунду
+	Utilization  float64 // Доля пропускной способности шины (1.0 – шина занята полностью)
+}
+
+// BandwidthMonitor оборачивает адаптер I2C и оценивает нагрузку на шину:
+// число транзакций и байт в секунду и долю пропускной способности при
+// заданной скорости шины. При превышении порога монитор предупреждает
+// (логгер и обработчик перегрузки) и, если включено, притормаживает
+// транзакции, чтобы перегруженный цикл анимации явно замедлялся вместо
+// незаметного накопления отставания.
+type BandwidthMonitor struct {
+	dev          I2C
+	busHz        float64
+	threshold    float64
+	window       time.Duration
+	backpressure bool
+	logger       adapterLogger
+	onOverload   func(BandwidthStats)
+
+	mu          sync.Mutex
+	windowStart time.Time
+	txs, bytes  int
+	bits        float64
+	stats       BandwidthStats
+	warned      bool
+	tokens      float64 // запас тактов для ограничения нагрузки
+	lastRefill  time.Time
+}
+
+// BandwidthOption определяет опцию монитора нагрузки шины.
+type BandwidthOption func(*BandwidthMonitor)
+
+// WithBusSpeed задаёт тактовую частоту шины, Гц (по умолчанию 100 кГц).
+func WithBusSpeed(hz float64) BandwidthOption {
+	return func(m *BandwidthMonitor) {
+		if hz > 0 {
+			m.busHz = hz
+		}
+	}
+}
+
+// WithOverloadThreshold задаёт долю пропускной способности, при превышении
+// которой шина считается перегруженной (по умолчанию 0.9).
+func WithOverloadThreshold(fraction float64) BandwidthOption {
+	return func(m *BandwidthMonitor) {
+		if fraction > 0 && fraction <= 1 {
+			m.threshold = fraction
+		}
+	}
+}
+
+// WithBandwidthWindow задаёт окно усреднения нагрузки (по умолчанию 1 секунда).
+func WithBandwidthWindow(window time.Duration) BandwidthOption {
+	return func(m *BandwidthMonitor) {
+		if window > 0 {
+			m.window = window
+		}
+	}
+}
+
+// WithBackpressure включает торможение транзакций: нагрузка удерживается
+// на уровне порога перегрузки, а вызывающий код блокируется на время,
+// которое шина не успевает обслужить.
+func WithBackpressure(enabled bool) BandwidthOption {
+	return func(m *BandwidthMonitor) {
+		m.backpressure = enabled
+	}
+}
+
+// WithBandwidthLogger задаёт логгер предупреждений о перегрузке. По умолчанию
+// используется логгер контроллера, которому передан монитор.
+func WithBandwidthLogger(logger Logger) BandwidthOption {
+	return func(m *BandwidthMonitor) {
+		if logger != nil {
+			m.logger = adapterLogger{Logger: logger, explicit: true}
+		}
+	}
+}
+
+// WithOverloadHandler задаёт функцию, вызываемую по окончании каждого окна,
+// в котором нагрузка превысила порог.
+func WithOverloadHandler(fn func(BandwidthStats)) BandwidthOption {
+	return func(m *BandwidthMonitor) {
+		m.onOverload = fn
+	}
+}
+
+// NewBandwidthMonitor оборачивает адаптер dev. Полученный монитор передаётся
+// в New вместо исходного адаптера.
+func NewBandwidthMonitor(dev I2C, opts ...BandwidthOption) *BandwidthMonitor {
+	m := &BandwidthMonitor{
+		dev:       dev,
+		busHz:     defaultBusHz,
+		threshold: 0.9,
+		window:    defaultWindow,
+		logger:    adapterLogger{Logger: NewDefaultLogger(LogLevelBasic)},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	now := time.Now()
+	m.windowStart, m.lastRefill = now, now
+	return m
+}
+
+// Stats возвращает нагрузку за последнее завершённое окно. Если окно уже
+// истекло, но транзакций после этого не было, нагрузка считается по текущему окну.
+func (m *BandwidthMonitor) Stats() BandwidthStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now := time.Now(); now.Sub(m.windowStart) >= m.window {
+		return m.measure(now)
+	}
+	return m.stats
+}
+
+// measure возвращает нагрузку текущего окна на момент now. Вызывается с
+// захваченным m.mu.
+func (m *BandwidthMonitor) measure(now time.Time) BandwidthStats {
+	secs := now.Sub(m.windowStart).Seconds()
+	return BandwidthStats{
+		Transactions: float64(m.txs) / secs,
+		Bytes:        float64(m.bytes) / secs,
+		Utilization:  m.bits / secs / m.busHz,
+	}
+}
+
+// MaxFrameRate возвращает наибольшую частоту кадров, при которой запись
+// channels каналов за кадр (по отдельной транзакции на канал) укладывается
+// в порог перегрузки.
+func (m *BandwidthMonitor) MaxFrameRate(channels int) float64 {
+	if channels <= 0 {
+		return 0
+	}
+	frameBits := float64(channels) * float64(i2cWriteBits+4*i2cByteBits)
+	return m.busHz * m.threshold / frameBits
+}
+
+func (m *BandwidthMonitor) WriteReg(reg uint8, data []byte) error {
+	m.account(i2cWriteBits, len(data))
+	return m.dev.WriteReg(reg, data)
+}
+
+func (m *BandwidthMonitor) ReadReg(reg uint8, data []byte) error {
+	m.account(i2cReadBits, len(data))
+	return m.dev.ReadReg(reg, data)
+}
+
+// WriteRead передаёт комбинированную транзакцию адаптеру. Адаптер без
+// WriteRead получает чтение регистра через ReadReg.
+func (m *BandwidthMonitor) WriteRead(w, r []byte) error {
+	if len(w) == 0 {
+		return fmt.Errorf("register pointer is required")
+	}
+	m.account(i2cReadBits+(len(w)-1)*i2cByteBits, len(r))
+	if wr, ok := m.dev.(WriteReader); ok {
+		return wr.WriteRead(w, r)
+	}
+	if len(w) != 1 {
+		return fmt.Errorf("adapter does not support combined write-read of %d bytes", len(w))
+	}
+	return m.dev.ReadReg(w[0], r)
+}
+
+func (m *BandwidthMonitor) Close() error {
+	return m.dev.Close()
+}
+
+func (m *BandwidthMonitor) inheritLogger(logger Logger) {
+	m.logger.inherit(logger)
+	inheritLogger(m.dev, logger)
+}
+
+// Capabilities возвращает возможности обёрнутого адаптера.
+func (m *BandwidthMonitor) Capabilities() I2CCapabilities {
+	return capabilitiesOf(m.dev)
+}
+
+// account учитывает транзакцию и при включённом торможении выдерживает паузу,
+// если шина не успевает её обслужить.
+func (m *BandwidthMonitor) account(overhead, n int) {
+	cost := float64(overhead + n*i2cByteBits)
+	now := time.Now()
+
+	m.mu.Lock()
+	var overloaded *BandwidthStats
+	warn := false
+	if now.Sub(m.windowStart) >= m.window {
+		m.stats = m.measure(now)
+		m.txs, m.bytes, m.bits = 0, 0, 0
+		m.windowStart = now
+		if m.stats.Utilization > m.threshold {
+			stats := m.stats
+			overloaded = &stats
+		}
+		// Предупреждение в лог – только в начале перегрузки.
+		warn = overloaded != nil && !m.warned
+		m.warned = overloaded != nil
+	}
+	m.txs++
+	m.bytes += n
+	m.bits += cost
+
+	var wait time.Duration
+	if m.backpressure {
+		rate := m.busHz * m.threshold
+		// Запас не превышает 10% окна, чтобы всплеск не обходил ограничение.
+		limit := rate * m.window.Seconds() / 10
+		m.tokens += now.Sub(m.lastRefill).Seconds() * rate
+		if m.tokens > limit {
+			m.tokens = limit
+		}
+		m.lastRefill = now
+		m.tokens -= cost
+		if m.tokens < 0 {
+			wait = time.Duration(-m.tokens / rate * float64(time.Second))
+		}
+	}
+	m.mu.Unlock()
+
+	if overloaded != nil {
+		if warn {
+			m.logger.Error("Шина I2C перегружена: %.0f%% пропускной способности (%.0f транзакций/с, %.0f байт/с)",
+				overloaded.Utilization*100, overloaded.Transactions, overloaded.Bytes)
+		}
+		if m.onOverload != nil {
+			m.onOverload(*overloaded)
+		}
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
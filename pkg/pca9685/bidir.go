@@ -0,0 +1,167 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// defaultDeadTime – пауза между сменой направления вращения по умолчанию.
+const defaultDeadTime = 500 * time.Millisecond
+
+// BidirectionalPump представляет реверсивный насос, управляемый через
+// H-мост двумя каналами: прямое и обратное направление.
+type BidirectionalPump struct {
+	pca      *PCA9685
+	forward  int
+	reverse  int
+	deadTime time.Duration
+
+	mu    sync.Mutex
+	speed float64 // от -100 (реверс) до 100 (прямое направление)
+}
+
+// BidirectionalPumpOption определяет опцию реверсивного насоса.
+type BidirectionalPumpOption func(*BidirectionalPump)
+
+// WithDeadTime задаёт паузу с выключенными обоими плечами моста при смене
+// направления (по умолчанию 500 мс). Пауза исключает сквозной ток и даёт
+// ротору остановиться.
+func WithDeadTime(d time.Duration) BidirectionalPumpOption {
+	return func(p *BidirectionalPump) {
+		if d >= 0 {
+			p.deadTime = d
+		}
+	}
+}
+
+// NewBidirectionalPump создаёт реверсивный насос на каналах forward и reverse.
+func NewBidirectionalPump(pca *PCA9685, forward, reverse int, opts ...BidirectionalPumpOption) (*BidirectionalPump, error) {
+	pca.logger.Detailed("Создание реверсивного насоса на каналах: %d, %d", forward, reverse)
+	p := &BidirectionalPump{pca: pca, forward: forward, reverse: reverse, deadTime: defaultDeadTime}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if err := pca.claimChannels(p, fmt.Sprintf("bidirectional pump on channels %d, %d", forward, reverse), forward, reverse); err != nil {
+		pca.logger.Error("NewBidirectionalPump: каналы недоступны: %v", err)
+		return nil, err
+	}
+	if err := pca.EnableChannels(forward, reverse); err != nil {
+		pca.releaseChannels(p, forward, reverse)
+		pca.logger.Error("NewBidirectionalPump: не удалось включить каналы: %v", err)
+		return nil, fmt.Errorf("failed to enable channels: %w", err)
+	}
+	pca.logger.Basic("Реверсивный насос успешно создан на каналах: %d, %d", forward, reverse)
+	return p, nil
+}
+
+// Release освобождает каналы насоса. Насос после этого использовать нельзя.
+func (p *BidirectionalPump) Release() {
+	p.pca.logger.Basic("Освобождение каналов реверсивного насоса: %d, %d", p.forward, p.reverse)
+	p.pca.releaseChannels(p, p.forward, p.reverse)
+}
+
+// SetSpeed устанавливает скорость в процентах: положительные значения –
+// прямое направление, отрицательные – обратное. При смене направления насос
+// сначала останавливается на время паузы.
+func (p *BidirectionalPump) SetSpeed(ctx context.Context, percent float64) error {
+	if percent < -100 || percent > 100 {
+		err := fmt.Errorf("speed percentage must be between -100 and 100")
+		p.pca.logger.Error("SetSpeed: неверное значение скорости: %f%%", percent)
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.setSpeed(ctx, percent)
+}
+
+// setSpeed вызывается с захваченным p.mu.
+func (p *BidirectionalPump) setSpeed(ctx context.Context, percent float64) error {
+	if p.speed*percent < 0 {
+		if err := p.write(ctx, 0); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.deadTime):
+		}
+	}
+	if err := p.write(ctx, percent); err != nil {
+		return err
+	}
+	p.pca.logger.Detailed("SetSpeed: реверсивный насос, скорость %f%%", percent)
+	return nil
+}
+
+// write записывает оба плеча моста: активное получает скорость, другое
+// выключается.
+func (p *BidirectionalPump) write(ctx context.Context, percent float64) error {
+	value := uint16(math.Round(math.Abs(percent) * 4095 / 100))
+	fwd, rev := value, uint16(0)
+	if percent < 0 {
+		fwd, rev = 0, value
+	}
+	// Сначала выключается неактивное плечо, чтобы оба плеча не были включены
+	// одновременно.
+	order := []PWMValue{{Channel: p.forward, Off: fwd}, {Channel: p.reverse, Off: rev}}
+	if percent > 0 {
+		order[0], order[1] = order[1], order[0]
+	}
+	if err := p.pca.SetMultiPWMValues(ctx, order); err != nil {
+		p.pca.logger.Error("SetSpeed: ошибка установки PWM реверсивного насоса: %v", err)
+		return err
+	}
+	p.speed = percent
+	return nil
+}
+
+// Speed возвращает текущую скорость насоса в процентах.
+func (p *BidirectionalPump) Speed() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.speed
+}
+
+// Stop останавливает насос.
+func (p *BidirectionalPump) Stop(ctx context.Context) error {
+	return p.SetSpeed(ctx, 0)
+}
+
+// Backflush выполняет обратную промывку линии: насос работает в обратном
+// направлении со скоростью speed (0–100%) в течение duration с паузами при
+// смене направления, после чего восстанавливается прежняя скорость. При
+// отмене контекста насос останавливается.
+func (p *BidirectionalPump) Backflush(ctx context.Context, duration time.Duration, speed float64) (err error) {
+	if speed <= 0 || speed > 100 {
+		return fmt.Errorf("backflush speed must be between 0 and 100")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prior := p.speed
+	p.pca.logger.Basic("Backflush: обратная промывка %v на скорости %f%%", duration, speed)
+	defer func() {
+		if err != nil {
+			if stopErr := p.write(context.Background(), 0); stopErr != nil {
+				p.pca.logger.Error("Backflush: не удалось остановить насос: %v", stopErr)
+			}
+			p.pca.logger.Error("Backflush: промывка прервана: %v", err)
+		}
+	}()
+
+	if err := p.setSpeed(ctx, -speed); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(duration):
+	}
+	if err := p.setSpeed(ctx, prior); err != nil {
+		return err
+	}
+	p.pca.logger.Basic("Backflush: промывка завершена, скорость восстановлена: %f%%", prior)
+	return nil
+}
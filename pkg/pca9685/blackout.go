@@ -0,0 +1,171 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	// RegAllLedOffH – старший байт ALL_LED_OFF. Запись бита FULL_OFF в него
+	// устанавливает этот бит в регистрах LEDn_OFF_H всех каналов, не изменяя
+	// остальные байты.
+	RegAllLedOffH = RegAllLed + 3
+
+	ledFullOff = 0x1000 // бит FULL_OFF в значении off
+)
+
+// BlackoutAll выключает все выходы одной транзакцией, не изменяя кэш каналов:
+// у PCA9685 – записью бита FULL_OFF в регистр ALL_LED_OFF_H, у PCA9635 –
+// отключением драйверов в регистрах LEDOUT. Пока затемнение действует,
+// каналы можно менять как обычно: новые значения сохраняются в кэше и
+// записываются в устройство, но выходы остаются выключенными. Вызов во время
+// затемнения повторяет запись.
+//
+// Затемнение распространяется на все записи, включая безопасные значения
+// Failsafe и Close; EmergencyStop снимает его сам.
+func (pca *PCA9685) BlackoutAll(ctx context.Context) error {
+	pca.logger.Basic("BlackoutAll: затемнение всех выходов")
+	pca.mu.Lock()
+	err := pca.blackoutLocked(ctx, "BlackoutAll")
+	pca.mu.Unlock()
+	pca.record(ctx, JournalEntry{Op: "BlackoutAll", Channel: -1}, err)
+	if err != nil {
+		pca.logger.Error("BlackoutAll: не удалось выключить выходы: %v", err)
+	}
+	return err
+}
+
+// RestoreFromBlackout снимает затемнение BlackoutAll, возвращая выходам
+// значения из кэша: у PCA9635 – одной записью LEDOUT, у PCA9685 – записью
+// всех каналов транзакциями по I2CCapabilities.MaxTransfer (при отсутствии
+// ограничения – одной). Без затемнения ничего не делает.
+func (pca *PCA9685) RestoreFromBlackout(ctx context.Context) error {
+	pca.logger.Basic("RestoreFromBlackout: снятие затемнения")
+	pca.mu.Lock()
+	err := pca.liftBlackoutLocked(ctx, "RestoreFromBlackout", true)
+	pca.mu.Unlock()
+	pca.record(ctx, JournalEntry{Op: "RestoreFromBlackout", Channel: -1}, err)
+	if err != nil {
+		pca.logger.Error("RestoreFromBlackout: не удалось восстановить выходы: %v", err)
+	}
+	return err
+}
+
+// InBlackout сообщает, действует ли затемнение BlackoutAll.
+func (pca *PCA9685) InBlackout() bool {
+	return pca.blackout.Load()
+}
+
+// blackoutLocked выключает выходы и включает затемнение. Вызывается с
+// захваченным pca.mu; мьютексы каналов захватывает сама, чтобы запись канала,
+// начатая до затемнения, не включила выход после него.
+func (pca *PCA9685) blackoutLocked(ctx context.Context, op string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pca.lockChannels()
+	defer pca.unlockChannels()
+
+	reg, data := uint8(RegAllLedOffH), pca.allBuf[:1]
+	data[0] = ledFullOff >> 8
+	if pca.chip == ChipPCA9635 {
+		reg, data = pca9635AutoInc|RegPCA9635LEDOut0, pca.allBuf[:4]
+		data[0], data[1], data[2], data[3] = 0, 0, 0, 0
+	}
+	if err := pca.writeReg(ctx, op, -1, reg, data); err != nil {
+		return fmt.Errorf("failed to blackout outputs: %w", err)
+	}
+	pca.blackout.Store(true)
+	return nil
+}
+
+// liftBlackoutLocked снимает затемнение. У PCA9685 бит FULL_OFF остаётся в
+// регистрах каналов до их перезаписи, поэтому при rewrite все каналы
+// записываются из кэша; без rewrite вызывающий гарантирует, что кэш всех
+// каналов нулевой. Вызывается с захваченным pca.mu.
+func (pca *PCA9685) liftBlackoutLocked(ctx context.Context, op string, rewrite bool) error {
+	if !pca.blackout.Load() {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	pca.lockChannels()
+	defer pca.unlockChannels()
+
+	if pca.chip == ChipPCA9635 {
+		data := pca.allBuf[:4]
+		data[0], data[1], data[2], data[3] = pca9635LEDOutPWM, pca9635LEDOutPWM, pca9635LEDOutPWM, pca9635LEDOutPWM
+		if err := pca.writeReg(ctx, op, -1, pca9635AutoInc|RegPCA9635LEDOut0, data); err != nil {
+			return fmt.Errorf("failed to restore outputs: %w", err)
+		}
+		pca.blackout.Store(false)
+		return nil
+	}
+
+	pca.blackout.Store(false)
+	if !rewrite {
+		return nil
+	}
+	if err := pca.rewriteChannels(ctx, op); err != nil {
+		// Уже восстановленные каналы снова выключаются при повторе.
+		pca.blackout.Store(true)
+		return err
+	}
+	return nil
+}
+
+// rewriteChannels записывает все каналы из кэша с учётом мастер-яркости и
+// ограничений. Вызывается с захваченными блокировками всех каналов.
+func (pca *PCA9685) rewriteChannels(ctx context.Context, op string) error {
+	level := pca.masterLevel()
+	burst := pca.caps.burstChannels()
+	for first := 0; first < len(pca.channels); first += burst {
+		n := min(burst, len(pca.channels)-first)
+		pooled, frame := acquireFrame(4 * n)
+		for i := 0; i < n; i++ {
+			ch := &pca.channels[first+i]
+			on, off := ch.limits.clamp(pca.scaleChannel(first+i, ch.on, ch.off, level))
+			if err := pca.wakeFor(ctx, on, off); err != nil {
+				releaseFrame(pooled)
+				return err
+			}
+			frame[4*i], frame[4*i+1] = byte(on&0xFF), byte(on>>8)
+			frame[4*i+2], frame[4*i+3] = byte(off&0xFF), byte(off>>8)
+		}
+		reg, data := pca.chip.ledFrame(first, frame, frame)
+		err := pca.writeReg(ctx, op, first, reg, data)
+		releaseFrame(pooled)
+		if err != nil {
+			return fmt.Errorf("failed to restore channels %d-%d: %w", first, first+n-1, err)
+		}
+	}
+	return nil
+}
+
+// markBlackout устанавливает бит FULL_OFF в кадре каналов PCA9685 (по 4
+// байта on/off на канал), пока действует затемнение, и сообщает, был ли он
+// установлен. Выходы PCA9635 выключены регистрами LEDOUT, поэтому их кадры
+// не изменяются.
+func (pca *PCA9685) markBlackout(frame []byte) bool {
+	if pca.chip == ChipPCA9635 || !pca.blackout.Load() {
+		return false
+	}
+	for i := 3; i < len(frame); i += 4 {
+		frame[i] |= ledFullOff >> 8
+	}
+	return true
+}
+
+// lockChannels захватывает мьютексы всех каналов по возрастанию номера.
+func (pca *PCA9685) lockChannels() {
+	for i := range pca.channels {
+		pca.channels[i].mu.Lock()
+	}
+}
+
+func (pca *PCA9685) unlockChannels() {
+	for i := range pca.channels {
+		pca.channels[i].mu.Unlock()
+	}
+}
@@ -0,0 +1,42 @@
+package pca9685
+
+import "sync"
+
+// maxFrameSize – наибольший кадр записи, который формирует драйвер: адрес
+// регистра и регистры всех 16 каналов.
+const maxFrameSize = 1 + 4*16
+
+// frameBuf – буфер кадра записи регистров.
+type frameBuf [maxFrameSize]byte
+
+// framePool хранит буферы кадров, чтобы частые записи (анимации с высокой
+// частотой кадров) не создавали нагрузку на сборщик мусора.
+var framePool = sync.Pool{
+	New: func() interface{} { return new(frameBuf) },
+}
+
+// acquireFrame возвращает срез длиной n из буфера пула. Если n превышает
+// размер буфера, срез выделяется обычным образом, а buf равен nil. После
+// завершения транзакции буфер возвращается через releaseFrame.
+func acquireFrame(n int) (buf *frameBuf, frame []byte) {
+	if n > maxFrameSize {
+		return nil, make([]byte, n)
+	}
+	buf = framePool.Get().(*frameBuf)
+	return buf, buf[:n]
+}
+
+// releaseFrame возвращает буфер в пул. Допускает nil.
+func releaseFrame(buf *frameBuf) {
+	if buf != nil {
+		framePool.Put(buf)
+	}
+}
+
+// encodeFrame формирует кадр «адрес регистра + данные» в буфере пула.
+func encodeFrame(reg uint8, data []byte) (*frameBuf, []byte) {
+	buf, frame := acquireFrame(len(data) + 1)
+	frame[0] = reg
+	copy(frame[1:], data)
+	return buf, frame
+}
@@ -0,0 +1,90 @@
+package pca9685
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SharedBus сериализует транзакции нескольких устройств на одной физической
+// шине I2C. Без него запись указателя регистра одним драйвером может
+// вклиниться между записью указателя и чтением другого (например, в адаптере
+// d2r2), и чтение вернёт данные не того регистра.
+//
+// Сторонние драйверы на той же шине могут использовать SharedBus как
+// sync.Locker или через Do.
+type SharedBus struct {
+	mu sync.Mutex
+}
+
+// NewSharedBus создаёт общую блокировку шины.
+func NewSharedBus() *SharedBus {
+	return &SharedBus{}
+}
+
+// Lock захватывает шину.
+func (b *SharedBus) Lock() { b.mu.Lock() }
+
+// Unlock освобождает шину.
+func (b *SharedBus) Unlock() { b.mu.Unlock() }
+
+// Do выполняет fn с захваченной шиной.
+func (b *SharedBus) Do(fn func() error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return fn()
+}
+
+// Device оборачивает адаптер устройства так, что каждая его транзакция
+// выполняется с захваченной шиной.
+func (b *SharedBus) Device(dev I2C) I2C {
+	return &busDevice{bus: b, dev: dev}
+}
+
+// busDevice – адаптер устройства на общей шине.
+type busDevice struct {
+	bus *SharedBus
+	dev I2C
+}
+
+func (d *busDevice) WriteReg(reg uint8, data []byte) error {
+	d.bus.mu.Lock()
+	defer d.bus.mu.Unlock()
+	return d.dev.WriteReg(reg, data)
+}
+
+func (d *busDevice) ReadReg(reg uint8, data []byte) error {
+	d.bus.mu.Lock()
+	defer d.bus.mu.Unlock()
+	return d.dev.ReadReg(reg, data)
+}
+
+// WriteRead выполняет комбинированную транзакцию с захваченной шиной. Если
+// адаптер её не поддерживает, указатель регистра записывается и читается
+// через ReadReg – под блокировкой шины это так же безопасно.
+func (d *busDevice) WriteRead(w, r []byte) error {
+	d.bus.mu.Lock()
+	defer d.bus.mu.Unlock()
+	if wr, ok := d.dev.(WriteReader); ok {
+		return wr.WriteRead(w, r)
+	}
+	if len(w) != 1 {
+		return fmt.Errorf("adapter does not support combined write-read of %d bytes", len(w))
+	}
+	return d.dev.ReadReg(w[0], r)
+}
+
+func (d *busDevice) Close() error {
+	return d.dev.Close()
+}
+
+func (d *busDevice) inheritLogger(logger Logger) {
+	inheritLogger(d.dev, logger)
+}
+
+// Capabilities возвращает возможности обёрнутого адаптера. Чтение через
+// общую шину атомарно, даже если адаптер разделяет запись указателя и чтение.
+func (d *busDevice) Capabilities() I2CCapabilities {
+	caps := capabilitiesOf(d.dev)
+	caps.CombinedWriteRead = true
+	return caps
+}
@@ -0,0 +1,127 @@
+package pca9685
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CalibrationVersion – текущая версия формата файла калибровок.
+const CalibrationVersion = 1
+
+// Calibrations – калибровочные данные периферии, сохраняемые в JSON-файл.
+// Данные хранятся под именами периферии в Registry, поэтому файл можно
+// перенести на другую установку с той же конфигурацией.
+type Calibrations struct {
+	Version int                         `json:"version"`
+	Pumps   map[string]PumpCalibration  `json:"pumps,omitempty"`
+	LEDs    map[string]RGBCalibration   `json:"leds,omitempty"`
+	Servos  map[string]ServoCalibration `json:"servos,omitempty"`
+}
+
+// NewCalibrations создаёт пустой набор калибровок текущей версии.
+func NewCalibrations() *Calibrations {
+	return &Calibrations{
+		Version: CalibrationVersion,
+		Pumps:   make(map[string]PumpCalibration),
+		LEDs:    make(map[string]RGBCalibration),
+		Servos:  make(map[string]ServoCalibration),
+	}
+}
+
+// LoadCalibrations читает калибровки из файла. Файлы более новой версии,
+// чем поддерживает библиотека, отклоняются.
+func LoadCalibrations(path string) (*Calibrations, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calibrations: %w", err)
+	}
+	c := NewCalibrations()
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse calibrations: %w", err)
+	}
+	if c.Version < 1 || c.Version > CalibrationVersion {
+		return nil, fmt.Errorf("unsupported calibration file version %d", c.Version)
+	}
+	c.Version = CalibrationVersion
+	return c, nil
+}
+
+// Save атомарно записывает калибровки в файл: данные пишутся во временный
+// файл рядом с path, который затем переименовывается.
+func (c *Calibrations) Save(path string) error {
+	c.Version = CalibrationVersion
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode calibrations: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to save calibrations: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save calibrations: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save calibrations: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save calibrations: %w", err)
+	}
+	return nil
+}
+
+// Capture сохраняет текущие калибровки всей зарегистрированной периферии.
+func (c *Calibrations) Capture(reg *Registry) {
+	for _, name := range reg.Names() {
+		p, err := reg.Get(name)
+		if err != nil {
+			continue
+		}
+		switch p := p.(type) {
+		case *Pump:
+			c.Pumps[name] = p.Calibration()
+		case *RGBLed:
+			c.LEDs[name] = p.GetCalibration()
+		case *Servo:
+			c.Servos[name] = p.Calibration()
+		}
+	}
+}
+
+// Apply применяет калибровки к зарегистрированной периферии. Записи для
+// отсутствующей периферии пропускаются; несовпадение типа периферии считается
+// ошибкой.
+func (c *Calibrations) Apply(reg *Registry) error {
+	for _, name := range reg.Names() {
+		if cal, ok := c.Pumps[name]; ok {
+			pump, err := reg.Pump(name)
+			if err != nil {
+				return err
+			}
+			if err := pump.SetCalibration(cal); err != nil {
+				return fmt.Errorf("failed to apply calibration of %q: %w", name, err)
+			}
+		}
+		if cal, ok := c.LEDs[name]; ok {
+			led, err := reg.Led(name)
+			if err != nil {
+				return err
+			}
+			led.SetCalibration(cal)
+		}
+		if cal, ok := c.Servos[name]; ok {
+			servo, err := reg.Servo(name)
+			if err != nil {
+				return err
+			}
+			if err := servo.SetCalibration(cal); err != nil {
+				return fmt.Errorf("failed to apply calibration of %q: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"sync"
+)
+
+// Canvas отображает двумерную сетку RGB светильников (в том числе на
+// нескольких PCA9685) на каналы: пиксели рисуются в буфер методами SetPixel,
+// Fill и Draw, а Render выводит кадр пакетной записью по каждому контроллеру.
+// Подходит для низкоразрешающих пиксельных дисплеев и архитектурных массивов.
+type Canvas struct {
+	width, height int
+	writers       map[*PCA9685]*AsyncWriter
+
+	mu     sync.Mutex
+	leds   []*RGBLed
+	pixels [][3]uint8
+}
+
+// CanvasOption определяет опцию холста.
+type CanvasOption func(*Canvas)
+
+// WithCanvasWriter направляет кадры контроллера w через асинхронную запись
+// (AsyncWriter.Frame): устаревшие кадры отбрасываются, если шина не успевает.
+func WithCanvasWriter(w *AsyncWriter) CanvasOption {
+	return func(c *Canvas) {
+		c.writers[w.pca] = w
+	}
+}
+
+// NewCanvas создаёт холст размером width×height пикселей. Светильники
+// размещаются методом Place; пиксели без светильника пропускаются.
+func NewCanvas(width, height int, opts ...CanvasOption) (*Canvas, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("canvas size must be positive")
+	}
+	c := &Canvas{
+		width:   width,
+		height:  height,
+		writers: make(map[*PCA9685]*AsyncWriter),
+		leds:    make([]*RGBLed, width*height),
+		pixels:  make([][3]uint8, width*height),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Bounds возвращает размеры холста.
+func (c *Canvas) Bounds() (width, height int) {
+	return c.width, c.height
+}
+
+// index возвращает индекс пикселя или ошибку для координат вне холста.
+func (c *Canvas) index(x, y int) (int, error) {
+	if x < 0 || x >= c.width || y < 0 || y >= c.height {
+		return 0, fmt.Errorf("pixel (%d, %d) is outside the %dx%d canvas", x, y, c.width, c.height)
+	}
+	return y*c.width + x, nil
+}
+
+// Place размещает светильник в пикселе (x, y). nil убирает светильник.
+func (c *Canvas) Place(x, y int, led *RGBLed) error {
+	i, err := c.index(x, y)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leds[i] = led
+	return nil
+}
+
+// SetPixel задаёт цвет пикселя в буфере кадра.
+func (c *Canvas) SetPixel(x, y int, r, g, b uint8) error {
+	i, err := c.index(x, y)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pixels[i] = [3]uint8{r, g, b}
+	return nil
+}
+
+// Pixel возвращает цвет пикселя из буфера кадра.
+func (c *Canvas) Pixel(x, y int) (r, g, b uint8, err error) {
+	i, err := c.index(x, y)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := c.pixels[i]
+	return p[0], p[1], p[2], nil
+}
+
+// Fill заливает буфер кадра одним цветом.
+func (c *Canvas) Fill(r, g, b uint8) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range c.pixels {
+		c.pixels[i] = [3]uint8{r, g, b}
+	}
+}
+
+// Draw копирует в буфер кадра изображение img, начиная с его левого верхнего
+// угла. Части изображения за пределами холста отбрасываются.
+func (c *Canvas) Draw(img image.Image) {
+	b := img.Bounds()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for y := 0; y < c.height && y < b.Dy(); y++ {
+		for x := 0; x < c.width && x < b.Dx(); x++ {
+			rgba := color.RGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.RGBA)
+			c.pixels[y*c.width+x] = [3]uint8{rgba.R, rgba.G, rgba.B}
+		}
+	}
+}
+
+// Render выводит буфер кадра на светильники. Значения всех пикселей одного
+// контроллера записываются одним пакетом.
+func (c *Canvas) Render(ctx context.Context) error {
+	c.mu.Lock()
+	perDevice := make(map[*PCA9685][]PWMValue)
+	var order []*PCA9685
+	for i, led := range c.leds {
+		if led == nil {
+			continue
+		}
+		p := c.pixels[i]
+		led.mu.RLock()
+		values := led.pwmValues(p[0], p[1], p[2])
+		led.mu.RUnlock()
+		if _, ok := perDevice[led.pca]; !ok {
+			order = append(order, led.pca)
+		}
+		perDevice[led.pca] = append(perDevice[led.pca], values[:]...)
+	}
+	leds := append([]*RGBLed(nil), c.leds...)
+	pixels := append([][3]uint8(nil), c.pixels...)
+	c.mu.Unlock()
+
+	for _, pca := range order {
+		if w, ok := c.writers[pca]; ok {
+			if _, err := w.Frame(perDevice[pca]); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := pca.SetMultiPWMValues(ctx, perDevice[pca]); err != nil {
+			pca.logger.Error("Canvas: ошибка вывода кадра: %v", err)
+			return err
+		}
+	}
+	for i, led := range leds {
+		if led != nil {
+			led.tmu.Lock()
+			led.color = pixels[i]
+			led.tmu.Unlock()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package pca9685
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Chip – профиль микросхемы, выбираемый Config.Chip. Профиль задаёт карту
+// регистров каналов; кэш каналов, мастер-яркость, ограничения и периферия
+// (RGBLed, Pump, GrowLight) работают одинаково для всех микросхем и
+// оперируют 12-битными значениями on/off.
+type Chip int
+
+const (
+	// ChipPCA9685 – 16 каналов, 12 бит, частота PWM 24–1526 Гц.
+	ChipPCA9685 Chip = iota
+	// ChipPCA9635 – 16 каналов, 8 бит, фиксированная частота PWM около 97 кГц.
+	// Значения каналов переводятся в 8 бит, фаза (on) не поддерживается.
+	ChipPCA9635
+)
+
+func (c Chip) String() string {
+	switch c {
+	case ChipPCA9685:
+		return "PCA9685"
+	case ChipPCA9635:
+		return "PCA9635"
+	default:
+		return fmt.Sprintf("Chip(%d)", int(c))
+	}
+}
+
+// Регистры PCA9635. MODE1 и MODE2 совпадают с PCA9685 по адресу и битам
+// SLEEP, ALLCALL, INVRT и OUTDRV.
+const (
+	RegPCA9635PWM0    = 0x02 // PWM0–PWM15, по байту на канал
+	RegPCA9635LEDOut0 = 0x14 // LEDOUT0–LEDOUT3, по 2 бита на канал
+	RegPCA9635AllCall = 0x1B // Адрес ALLCALL (7 бит, сдвинутых влево на 1)
+
+	// PCA9635Frequency – фиксированная частота PWM PCA9635, Гц.
+	PCA9635Frequency = 97656.25
+
+	pca9635AutoInc    = 0x80 // флаг AI2 управляющего байта: автоинкремент всех регистров
+	pca9635LEDOutPWM  = 0xAA // все 4 канала регистра LEDOUT управляются своим PWMx
+	pca9635OscStartup = 500 * time.Microsecond
+)
+
+// ErrFixedFrequency возвращается SetPWMFreq и периферией, которой нужна
+// настраиваемая частота (Servo, ESC), если у микросхемы частота фиксирована.
+var ErrFixedFrequency = errors.New("chip has a fixed PWM frequency")
+
+// fixedFrequency возвращает фиксированную частоту PWM или 0, если частота
+// настраивается предделителем.
+func (c Chip) fixedFrequency() float64 {
+	if c == ChipPCA9635 {
+		return PCA9635Frequency
+	}
+	return 0
+}
+
+// allCallReg возвращает регистр адреса ALLCALL.
+func (c Chip) allCallReg() uint8 {
+	if c == ChipPCA9635 {
+		return RegPCA9635AllCall
+	}
+	return RegAllCall
+}
+
+// ledFrame возвращает регистр и данные записи каналов начиная с first.
+// frame содержит по 4 байта on/off на канал в формате PCA9685; для других
+// микросхем данные перекодируются в dst, вмещающий по байту на канал. dst
+// может совпадать с началом frame: байт канала записывается после чтения
+// его значений.
+func (c Chip) ledFrame(first int, frame, dst []byte) (uint8, []byte) {
+	if c != ChipPCA9635 {
+		return uint8(RegLed0 + 4*first), frame
+	}
+	n := len(frame) / 4
+	for i := 0; i < n; i++ {
+		on := uint16(frame[4*i]) | uint16(frame[4*i+1])<<8
+		off := uint16(frame[4*i+2]) | uint16(frame[4*i+3])<<8
+		dst[i] = duty8(on, off)
+	}
+	return pca9635AutoInc | uint8(RegPCA9635PWM0+first), dst[:n]
+}
+
+// allFrame возвращает регистр и данные записи одинакового значения во все
+// каналы. buf должен вмещать 16 байт.
+func (c Chip) allFrame(on, off uint16, buf []byte) (uint8, []byte) {
+	if c != ChipPCA9635 {
+		buf[0], buf[1], buf[2], buf[3] = byte(on&0xFF), byte(on>>8), byte(off&0xFF), byte(off>>8)
+		return RegAllLed, buf[:4]
+	}
+	d := duty8(on, off)
+	for i := 0; i < 16; i++ {
+		buf[i] = d
+	}
+	return pca9635AutoInc | RegPCA9635PWM0, buf[:16]
+}
+
+// duty8 переводит значения on/off PCA9685 в 8-битную скважность PCA9635.
+func duty8(on, off uint16) byte {
+	return byte(math.Round(float64(pulseTicks(on, off)) * 255 / PwmResolution))
+}
+
+// initFixed настраивает микросхему с фиксированной частотой после Reset:
+// все каналы переводятся под управление своих регистров PWM, осциллятор
+// запускается.
+func (pca *PCA9685) initFixed() error {
+	pca.modeMu.Lock()
+	defer pca.modeMu.Unlock()
+	ledout := []byte{pca9635LEDOutPWM, pca9635LEDOutPWM, pca9635LEDOutPWM, pca9635LEDOutPWM}
+	if err := pca.writeReg(pca.ctx, "New", -1, pca9635AutoInc|RegPCA9635LEDOut0, ledout); err != nil {
+		return fmt.Errorf("failed to configure LEDOUT: %w", err)
+	}
+	if err := pca.writeReg(pca.ctx, "New", -1, RegMode1, []byte{Mode1AutoInc}); err != nil {
+		return fmt.Errorf("failed to wake oscillator: %w", err)
+	}
+	time.Sleep(pca9635OscStartup)
+	freq := pca.chip.fixedFrequency()
+	pca.Freq = freq
+	pca.freq.Store(math.Float64bits(freq))
+	return nil
+}
+
+// requireFrequency возвращает ошибку, если периферии what нужна
+// настраиваемая частота, а у микросхемы она фиксирована.
+func (pca *PCA9685) requireFrequency(what string) error {
+	if pca.chip.fixedFrequency() == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s requires an adjustable PWM frequency: %w (%v)", what, ErrFixedFrequency, pca.chip)
+}
@@ -0,0 +1,189 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ColorSchedulePoint – опорная точка суточного расписания цвета.
+type ColorSchedulePoint struct {
+	At         DailyTrigger // Время суток
+	Kelvin     float64      // Цветовая температура, K
+	Brightness float64      // Яркость (от 0.0 до 1.0)
+}
+
+// ColorSchedule – суточная таблица цветовой температуры и яркости. Между
+// опорными точками значения интерполируются линейно, после последней точки
+// суток расписание плавно переходит к первой точке следующего дня.
+type ColorSchedule []ColorSchedulePoint
+
+// DayNightSchedule возвращает типовое расписание: холодный белый днём,
+// тёплый приглушённый свет вечером и слабый «лунный» свет ночью.
+func DayNightSchedule() ColorSchedule {
+	return ColorSchedule{
+		{At: DailyTrigger{Hour: 6}, Kelvin: 9000, Brightness: 0.02},
+		{At: DailyTrigger{Hour: 8}, Kelvin: 6500, Brightness: 1},
+		{At: DailyTrigger{Hour: 18}, Kelvin: 5500, Brightness: 1},
+		{At: DailyTrigger{Hour: 20}, Kelvin: 2700, Brightness: 0.3},
+		{At: DailyTrigger{Hour: 22}, Kelvin: 2200, Brightness: 0.1},
+		{At: DailyTrigger{Hour: 23}, Kelvin: 9000, Brightness: 0.02},
+	}
+}
+
+// At возвращает цветовую температуру и яркость в момент t.
+func (s ColorSchedule) At(t time.Time) (kelvin, brightness float64) {
+	if len(s) == 0 {
+		return 0, 0
+	}
+	y, m, d := t.Date()
+	tod := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+
+	// Ищем последнюю точку не позже tod; до первой точки суток действует
+	// отрезок от последней точки предыдущего дня.
+	i := sort.Search(len(s), func(i int) bool { return s[i].At.offset() > tod }) - 1
+	if i < 0 {
+		i = len(s) - 1
+	}
+	a, b := s[i], s[(i+1)%len(s)]
+	span := (b.At.offset() - a.At.offset() + 24*time.Hour) % (24 * time.Hour)
+	if span == 0 {
+		return a.Kelvin, a.Brightness
+	}
+	frac := float64((tod-a.At.offset()+24*time.Hour)%(24*time.Hour)) / float64(span)
+	return a.Kelvin + (b.Kelvin-a.Kelvin)*frac, a.Brightness + (b.Brightness-a.Brightness)*frac
+}
+
+// validate проверяет, что точки упорядочены по времени суток и значения
+// находятся в допустимых пределах.
+func (s ColorSchedule) validate() error {
+	if len(s) == 0 {
+		return fmt.Errorf("color schedule must contain at least one point")
+	}
+	for i, p := range s {
+		if _, err := p.At.Next(time.Time{}); err != nil {
+			return fmt.Errorf("point %d: %w", i, err)
+		}
+		if i > 0 && p.At.offset() <= s[i-1].At.offset() {
+			return fmt.Errorf("point %d: time of day must be after the previous point", i)
+		}
+		if p.Brightness < 0 || p.Brightness > 1 {
+			return fmt.Errorf("point %d: brightness must be between 0 and 1", i)
+		}
+		if p.Kelvin <= 0 {
+			return fmt.Errorf("point %d: color temperature must be positive", i)
+		}
+	}
+	return nil
+}
+
+// ColorScheduler применяет суточное расписание цвета к одному или нескольким
+// RGB светодиодам.
+type ColorScheduler struct {
+	leds     []*RGBLed
+	schedule ColorSchedule
+	interval time.Duration
+
+	mu         sync.RWMutex
+	kelvin     float64
+	brightness float64
+}
+
+// ColorScheduleOption определяет опцию конфигурации расписания цвета.
+type ColorScheduleOption func(*ColorScheduler)
+
+// WithColorScheduleInterval задаёт период обновления цвета (по умолчанию 1 минута).
+func WithColorScheduleInterval(interval time.Duration) ColorScheduleOption {
+	return func(c *ColorScheduler) {
+		if interval > 0 {
+			c.interval = interval
+		}
+	}
+}
+
+// NewColorScheduler создаёт контроллер, применяющий расписание schedule к светодиодам leds.
+func NewColorScheduler(schedule ColorSchedule, leds []*RGBLed, opts ...ColorScheduleOption) (*ColorScheduler, error) {
+	if len(leds) == 0 {
+		return nil, fmt.Errorf("at least one LED is required")
+	}
+	logger := leds[0].pca.logger
+	logger.Detailed("Создание суточного расписания цвета для %d светодиодов", len(leds))
+	if err := schedule.validate(); err != nil {
+		logger.Error("NewColorScheduler: неверное расписание: %v", err)
+		return nil, err
+	}
+
+	c := &ColorScheduler{
+		leds:     append([]*RGBLed(nil), leds...),
+		schedule: append(ColorSchedule(nil), schedule...),
+		interval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Current возвращает последние применённые цветовую температуру и яркость.
+func (c *ColorScheduler) Current() (kelvin, brightness float64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.kelvin, c.brightness
+}
+
+// Run обновляет цвет с заданным периодом до отмены контекста.
+func (c *ColorScheduler) Run(ctx context.Context) error {
+	logger := c.leds[0].pca.logger
+	logger.Basic("Расписание цвета: запуск")
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Update(ctx, time.Now()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			logger.Basic("Расписание цвета: остановка")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Schedule регистрирует в планировщике s задание name, обновляющее цвет с
+// периодом расписания. Задание сразу применяет текущий цвет.
+func (c *ColorScheduler) Schedule(ctx context.Context, s *Scheduler, name string) error {
+	if err := c.Update(ctx, time.Now()); err != nil {
+		return err
+	}
+	trigger := TriggerFunc(func(after time.Time) (time.Time, error) {
+		return after.Truncate(c.interval).Add(c.interval), nil
+	})
+	return s.Add(name, trigger, func(ctx context.Context) error {
+		return c.Update(ctx, time.Now())
+	})
+}
+
+// Update применяет цвет расписания на момент now ко всем светодиодам.
+func (c *ColorScheduler) Update(ctx context.Context, now time.Time) error {
+	kelvin, brightness := c.schedule.At(now)
+	r, g, b := KelvinToRGB(kelvin)
+	scale := func(v uint8) uint8 {
+		return uint8(math.Round(float64(v) * brightness))
+	}
+	c.leds[0].pca.logger.Detailed("Расписание цвета: %.0f K, яркость %.2f", kelvin, brightness)
+	for _, led := range c.leds {
+		if err := led.SetColor(ctx, scale(r), scale(g), scale(b)); err != nil {
+			led.pca.logger.Error("Расписание цвета: ошибка установки цвета: %v", err)
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.kelvin, c.brightness = kelvin, brightness
+	c.mu.Unlock()
+	return nil
+}
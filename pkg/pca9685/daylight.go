@@ -0,0 +1,353 @@
+package pca9685
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DaylightPoint – опорная точка кривой дневного света.
+type DaylightPoint struct {
+	At         float64 // Доля длительности кривой (от 0.0 до 1.0)
+	Kelvin     float64 // Цветовая температура, K
+	Brightness float64 // Яркость (от 0.0 до 1.0)
+}
+
+// DaylightCurve – кривая изменения цветовой температуры и яркости.
+// Между опорными точками значения интерполируются линейно.
+type DaylightCurve []DaylightPoint
+
+// SunriseCurve возвращает типовую кривую рассвета: от тёмно-красного к дневному белому.
+func SunriseCurve() DaylightCurve {
+	return DaylightCurve{
+		{At: 0, Kelvin: 1800, Brightness: 0},
+		{At: 0.3, Kelvin: 2400, Brightness: 0.15},
+		{At: 0.7, Kelvin: 4000, Brightness: 0.6},
+		{At: 1, Kelvin: 6500, Brightness: 1},
+	}
+}
+
+// SunsetCurve возвращает типовую кривую заката (рассвет в обратном порядке).
+func SunsetCurve() DaylightCurve {
+	sunrise := SunriseCurve()
+	curve := make(DaylightCurve, len(sunrise))
+	for i, p := range sunrise {
+		curve[len(sunrise)-1-i] = DaylightPoint{At: 1 - p.At, Kelvin: p.Kelvin, Brightness: p.Brightness}
+	}
+	return curve
+}
+
+// At возвращает цветовую температуру и яркость для доли progress (от 0.0 до 1.0).
+func (c DaylightCurve) At(progress float64) (kelvin, brightness float64) {
+	if len(c) == 0 {
+		return 0, 0
+	}
+	if progress <= c[0].At {
+		return c[0].Kelvin, c[0].Brightness
+	}
+	for i := 1; i < len(c); i++ {
+		if progress <= c[i].At {
+			a, b := c[i-1], c[i]
+			t := (progress - a.At) / (b.At - a.At)
+			return a.Kelvin + (b.Kelvin-a.Kelvin)*t, a.Brightness + (b.Brightness-a.Brightness)*t
+		}
+	}
+	last := c[len(c)-1]
+	return last.Kelvin, last.Brightness
+}
+
+// validate проверяет, что точки упорядочены и значения находятся в допустимых пределах.
+func (c DaylightCurve) validate() error {
+	if len(c) == 0 {
+		return fmt.Errorf("daylight curve must contain at least one point")
+	}
+	if !sort.SliceIsSorted(c, func(i, j int) bool { return c[i].At < c[j].At }) {
+		return fmt.Errorf("daylight curve points must be sorted by At")
+	}
+	for i, p := range c {
+		if p.At < 0 || p.At > 1 {
+			return fmt.Errorf("point %d: At must be between 0 and 1", i)
+		}
+		if p.Brightness < 0 || p.Brightness > 1 {
+			return fmt.Errorf("point %d: brightness must be between 0 and 1", i)
+		}
+		if p.Kelvin <= 0 {
+			return fmt.Errorf("point %d: color temperature must be positive", i)
+		}
+	}
+	return nil
+}
+
+// KelvinToRGB возвращает приближённый цвет излучения чёрного тела для температуры kelvin
+// (аппроксимация Таннера Хелланда, корректна в диапазоне 1000–40000 K).
+func KelvinToRGB(kelvin float64) (r, g, b uint8) {
+	t := math.Max(1000, math.Min(40000, kelvin)) / 100
+
+	clamp := func(v float64) uint8 {
+		return uint8(math.Round(math.Max(0, math.Min(255, v))))
+	}
+
+	var rf, gf, bf float64
+	if t <= 66 {
+		rf = 255
+		gf = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		rf = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		gf = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+	switch {
+	case t >= 66:
+		bf = 255
+	case t <= 19:
+		bf = 0
+	default:
+		bf = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+	return clamp(rf), clamp(gf), clamp(bf)
+}
+
+// DaylightSimulation плавно изменяет цвет и яркость RGB светодиода по кривой
+// дневного света (рассвет/закат) за заданное время.
+type DaylightSimulation struct {
+	led      *RGBLed
+	curve    DaylightCurve
+	duration time.Duration
+	interval time.Duration
+	state    string // файл момента начала кривой (WithDaylightStateFile)
+
+	mu      sync.RWMutex
+	elapsed time.Duration
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped bool
+}
+
+// DaylightOption определяет опцию конфигурации симуляции дневного света.
+type DaylightOption func(*DaylightSimulation)
+
+// WithDaylightInterval задаёт период обновления цвета (по умолчанию 1 секунда).
+func WithDaylightInterval(interval time.Duration) DaylightOption {
+	return func(d *DaylightSimulation) {
+		if interval > 0 {
+			d.interval = interval
+		}
+	}
+}
+
+// WithDaylightStateFile сохраняет в файл path момент начала кривой по
+// системным часам при каждом запуске Run и Resume. ResumeSaved продолжает
+// кривую с этого момента после перезапуска приложения, учитывая и время,
+// пока приложение не работало. Файл записывается атомарно, как снимок
+// каналов (SaveSnapshot), и удаляется по завершении кривой или вызовом Stop;
+// при отмене контекста он сохраняется.
+func WithDaylightStateFile(path string) DaylightOption {
+	return func(d *DaylightSimulation) {
+		d.state = path
+	}
+}
+
+// daylightState – содержимое файла WithDaylightStateFile.
+type daylightState struct {
+	Start time.Time `json:"start"`
+}
+
+// NewDaylightSimulation создаёт симуляцию, проходящую кривую curve за время duration.
+func NewDaylightSimulation(led *RGBLed, curve DaylightCurve, duration time.Duration, opts ...DaylightOption) (*DaylightSimulation, error) {
+	led.pca.logger.Detailed("Создание симуляции дневного света длительностью %v", duration)
+	if err := curve.validate(); err != nil {
+		led.pca.logger.Error("NewDaylightSimulation: неверная кривая: %v", err)
+		return nil, err
+	}
+	if duration <= 0 {
+		led.pca.logger.Error("NewDaylightSimulation: неверная длительность: %v", duration)
+		return nil, fmt.Errorf("duration must be positive")
+	}
+
+	d := &DaylightSimulation{
+		led:      led,
+		curve:    append(DaylightCurve(nil), curve...),
+		duration: duration,
+		interval: time.Second,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d, nil
+}
+
+// Elapsed возвращает пройденную часть кривой. Значение можно сохранить и
+// передать в Resume после перезапуска приложения; WithDaylightStateFile и
+// ResumeSaved делают это автоматически.
+func (d *DaylightSimulation) Elapsed() time.Duration {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.elapsed
+}
+
+// Run проходит кривую с самого начала.
+func (d *DaylightSimulation) Run(ctx context.Context) error {
+	return d.Resume(ctx, 0)
+}
+
+// Resume проходит кривую, начиная с момента elapsed от её начала.
+func (d *DaylightSimulation) Resume(ctx context.Context, elapsed time.Duration) error {
+	d.led.pca.logger.Basic("Симуляция дневного света: старт с %v из %v", elapsed, d.duration)
+	if elapsed < 0 || elapsed > d.duration {
+		err := fmt.Errorf("elapsed must be between 0 and %v", d.duration)
+		d.led.pca.logger.Error("DaylightSimulation: %v", err)
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	d.mu.Lock()
+	d.cancel, d.done, d.stopped = cancel, done, false
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.cancel, d.done = nil, nil
+		d.mu.Unlock()
+		cancel()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	start := time.Now().Add(-elapsed)
+	d.saveState(start)
+
+	for {
+		elapsed = time.Since(start)
+		if elapsed > d.duration {
+			elapsed = d.duration
+		}
+		if err := d.apply(ctx, elapsed); err != nil {
+			if d.isStopped() {
+				return nil
+			}
+			return err
+		}
+		if elapsed == d.duration {
+			d.led.pca.logger.Basic("Симуляция дневного света завершена")
+			d.clearState()
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if d.isStopped() {
+				return nil
+			}
+			d.led.pca.logger.Error("DaylightSimulation: контекст отменён: %v", ctx.Err())
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop прерывает выполняемую кривую и дожидается возврата из Run или Resume,
+// которые при этом возвращают nil. Файл WithDaylightStateFile удаляется, и
+// ResumeSaved после Stop начинает кривую с начала. Светодиод сохраняет цвет,
+// достигнутый к моменту остановки.
+func (d *DaylightSimulation) Stop() {
+	d.mu.Lock()
+	cancel, done := d.cancel, d.done
+	if cancel != nil {
+		d.stopped = true
+	}
+	d.mu.Unlock()
+	if cancel != nil {
+		d.led.pca.logger.Basic("Симуляция дневного света: остановка")
+		cancel()
+		<-done
+	}
+	d.clearState()
+}
+
+// isStopped сообщает, прервана ли текущая кривая вызовом Stop.
+func (d *DaylightSimulation) isStopped() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.stopped
+}
+
+// ResumeSaved продолжает кривую с момента начала, сохранённого в файле
+// WithDaylightStateFile. Если файла нет, кривая проходится с начала; если
+// кривая уже должна была закончиться, выставляется её конечная точка.
+func (d *DaylightSimulation) ResumeSaved(ctx context.Context) error {
+	if d.state == "" {
+		return fmt.Errorf("daylight state file is not configured")
+	}
+	data, err := os.ReadFile(d.state)
+	if os.IsNotExist(err) {
+		d.led.pca.logger.Basic("Симуляция дневного света: состояние %s не найдено, старт с начала", d.state)
+		return d.Run(ctx)
+	}
+	if err != nil {
+		d.led.pca.logger.Error("DaylightSimulation: %v", err)
+		return fmt.Errorf("failed to read daylight state: %w", err)
+	}
+	var state daylightState
+	if err := json.Unmarshal(data, &state); err != nil {
+		d.led.pca.logger.Error("DaylightSimulation: %v", err)
+		return fmt.Errorf("failed to parse daylight state: %w", err)
+	}
+	elapsed := time.Since(state.Start)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	if elapsed > d.duration {
+		elapsed = d.duration
+	}
+	return d.Resume(ctx, elapsed)
+}
+
+// saveState сохраняет момент начала кривой в файл WithDaylightStateFile.
+// Ошибка записи только логируется: симуляция продолжается без сохранения.
+func (d *DaylightSimulation) saveState(start time.Time) {
+	if d.state == "" {
+		return
+	}
+	data, err := json.Marshal(daylightState{Start: start})
+	if err == nil {
+		err = writeFileAtomic(d.state, append(data, '\n'))
+	}
+	if err != nil {
+		d.led.pca.logger.Error("DaylightSimulation: не удалось сохранить состояние в %s: %v", d.state, err)
+	}
+}
+
+// clearState удаляет файл WithDaylightStateFile, чтобы завершённая или
+// остановленная кривая не продолжилась после перезапуска.
+func (d *DaylightSimulation) clearState() {
+	if d.state == "" {
+		return
+	}
+	if err := os.Remove(d.state); err != nil && !os.IsNotExist(err) {
+		d.led.pca.logger.Error("DaylightSimulation: не удалось удалить состояние %s: %v", d.state, err)
+	}
+}
+
+// apply выставляет цвет, соответствующий моменту elapsed.
+func (d *DaylightSimulation) apply(ctx context.Context, elapsed time.Duration) error {
+	kelvin, brightness := d.curve.At(float64(elapsed) / float64(d.duration))
+	r, g, b := KelvinToRGB(kelvin)
+	scale := func(v uint8) uint8 {
+		return uint8(math.Round(float64(v) * brightness))
+	}
+	d.led.pca.logger.Detailed("DaylightSimulation: %v: %.0f K, яркость %.2f", elapsed, kelvin, brightness)
+	if err := d.led.SetColor(ctx, scale(r), scale(g), scale(b)); err != nil {
+		d.led.pca.logger.Error("DaylightSimulation: ошибка установки цвета: %v", err)
+		return err
+	}
+
+	d.mu.Lock()
+	d.elapsed = elapsed
+	d.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,110 @@
+package pca9685
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sync/atomic"
+)
+
+// DebugPath – путь, по которому принято подключать DebugHandler.
+const DebugPath = "/debug/pca9685"
+
+// Counters – внутренние счётчики контроллера для быстрой диагностики.
+type Counters struct {
+	Writes     uint64 `json:"writes"`      // Транзакции записи, включая неудачные и повторы
+	Reads      uint64 `json:"reads"`       // Транзакции чтения
+	Errors     uint64 `json:"errors"`      // Неудачные транзакции
+	Retries    uint64 `json:"retries"`     // Повторы отложенных записей деградированного режима
+	Frames     uint64 `json:"frames"`      // Кадры, выведенные рендерерами контроллера
+	Mismatches uint64 `json:"mismatches"`  // Несовпадения контрольного чтения (Config.VerifyWrites)
+	QueueDepth int    `json:"queue_depth"` // Записи в очереди деградированного режима
+	Degraded   bool   `json:"degraded"`    // Контроллер в деградированном режиме
+	DryRun     bool   `json:"dry_run"`     // Пробный режим: транзакции не доходят до шины
+
+	Power  float64 `json:"power"`  // Текущая мощность нагрузок, Вт (см. Energy)
+	Energy float64 `json:"energy"` // Энергия нагрузок с начала учёта, Вт·ч
+}
+
+// counters – атомарные счётчики контроллера.
+type counters struct {
+	writes     atomic.Uint64
+	reads      atomic.Uint64
+	errors     atomic.Uint64
+	retries    atomic.Uint64
+	frames     atomic.Uint64
+	mismatches atomic.Uint64
+}
+
+// Counters возвращает текущие значения счётчиков.
+func (pca *PCA9685) Counters() Counters {
+	degraded, pending := pca.Degraded()
+	energy := pca.Energy()
+	return Counters{
+		Writes:     pca.counters.writes.Load(),
+		Reads:      pca.counters.reads.Load(),
+		Errors:     pca.counters.errors.Load(),
+		Retries:    pca.counters.retries.Load(),
+		Frames:     pca.counters.frames.Load(),
+		Mismatches: pca.counters.mismatches.Load(),
+		QueueDepth: pending,
+		Degraded:   degraded,
+		DryRun:     pca.DryRun(),
+		Power:      energy.Power,
+		Energy:     energy.Energy,
+	}
+}
+
+// PublishExpvar публикует счётчики контроллера в expvar под именем name
+// (например, "pca9685" или "pca9685_0x41" для нескольких устройств). Они
+// становятся доступны на /debug/vars без полноценного Prometheus. Повторная
+// публикация того же имени вызывает панику expvar.
+func (pca *PCA9685) PublishExpvar(name string) {
+	pca.logger.Detailed("Публикация счётчиков в expvar под именем %q", name)
+	expvar.Publish(name, expvar.Func(func() interface{} { return pca.Counters() }))
+}
+
+// debugState – ответ DebugHandler.
+type debugState struct {
+	Counters    Counters            `json:"counters"`
+	Frequency   float64             `json:"frequency"`
+	Asleep      bool                `json:"asleep"`
+	Channels    []ChannelState      `json:"channels"`
+	Latency     []LatencyHistogram  `json:"latency"`
+	Duty        []ChannelDuty       `json:"duty"`
+	Energy      EnergyReport        `json:"energy"`
+	Maintenance []MaintenanceStatus `json:"maintenance"`
+}
+
+// DebugHandler возвращает обработчик HTTP, отдающий в JSON счётчики,
+// частоту, состояние каналов, гистограммы задержки, статистику работы
+// каналов (DutyStats), оценку энергии (Energy) и сроки обслуживания
+// (Maintenance). Состояние читается без блокировок контроллера,
+// поэтому опрос не мешает управляющим записям:
+//
+//	http.Handle(pca9685.DebugPath, pca.DebugHandler())
+func (pca *PCA9685) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		state := debugState{
+			Counters:    pca.Counters(),
+			Frequency:   pca.frequency(),
+			Asleep:      pca.asleep.Load(),
+			Channels:    pca.GetAllChannelStates(),
+			Latency:     pca.Latency(),
+			Duty:        pca.DutyStats(),
+			Energy:      pca.Energy(),
+			Maintenance: pca.Maintenance(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(state); err != nil {
+			pca.logger.Error("DebugHandler: не удалось отправить состояние: %v", err)
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDegradedQueueFull возвращается, если в деградированном режиме очередь
+// отложенных записей заполнена.
+var ErrDegradedQueueFull = errors.New("degraded mode write queue is full")
+
+// pendingWrite – отложенная запись регистра.
+type pendingWrite struct {
+	reg  uint8
+	data []byte
+}
+
+// degradedState реализует деградированный режим: при недоступности устройства
+// записи сохраняются в кэше каналов и в очереди, а после восстановления шины
+// повторяются в исходном порядке.
+type degradedState struct {
+	pca      *PCA9685
+	limit    int
+	interval time.Duration
+
+	mu     sync.Mutex
+	active bool
+	queue  []pendingWrite
+}
+
+func newDegradedState(pca *PCA9685, limit int, interval time.Duration) *degradedState {
+	if limit <= 0 {
+		limit = 64
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &degradedState{pca: pca, limit: limit, interval: interval}
+}
+
+// record ставит запись в очередь, если режим уже активен.
+func (d *degradedState) record(reg uint8, data []byte) (queued bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.active {
+		return false, nil
+	}
+	return true, d.enqueueLocked(reg, data)
+}
+
+// enter переводит контроллер в деградированный режим после ошибки записи.
+func (d *degradedState) enter(reg uint8, data []byte, cause error) error {
+	d.mu.Lock()
+	started := !d.active
+	d.active = true
+	err := d.enqueueLocked(reg, data)
+	pending := len(d.queue)
+	d.mu.Unlock()
+
+	if started {
+		d.pca.logger.Error("Устройство недоступно, переход в деградированный режим: %v", cause)
+		d.pca.emit(Event{Type: EventDegraded, Err: cause, Pending: pending})
+		go d.recoverLoop()
+	}
+	return err
+}
+
+// enqueueLocked добавляет запись, заменяя более ранние записи того же регистра,
+// которые она полностью перекрывает (пакетная запись нескольких каналов не
+// заменяется записью одного). Запись ALL_LED заменяет все отложенные записи каналов.
+// Записи MODE1 не заменяются: последовательность SLEEP → PRESCALE → пробуждение
+// должна повторяться целиком, иначе PRESCALE попадёт на работающую микросхему.
+func (d *degradedState) enqueueLocked(reg uint8, data []byte) error {
+	kept := d.queue[:0]
+	for _, w := range d.queue {
+		if (w.reg == reg && reg != RegMode1 && len(w.data) <= len(data)) || (reg == RegAllLed && w.reg >= RegLed0 && w.reg < RegLed0+4*16) {
+			continue
+		}
+		kept = append(kept, w)
+	}
+	d.queue = kept
+	if len(d.queue) >= d.limit {
+		d.pca.logger.Error("Деградированный режим: очередь записей заполнена (%d)", d.limit)
+		return ErrDegradedQueueFull
+	}
+	d.queue = append(d.queue, pendingWrite{reg: reg, data: append([]byte(nil), data...)})
+	return nil
+}
+
+// recoverLoop периодически пытается применить накопленные записи.
+func (d *degradedState) recoverLoop() {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.pca.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if d.replay() {
+			return
+		}
+	}
+}
+
+// replay повторяет записи из очереди. Возвращает true, если очередь пуста
+// и режим завершён.
+func (d *degradedState) replay() bool {
+	d.mu.Lock()
+	for i, w := range d.queue {
+		d.pca.counters.retries.Add(1)
+		if err := d.pca.doWrite(d.pca.ctx, w.reg, w.data); err != nil {
+			d.queue = d.queue[i:]
+			pending := len(d.queue)
+			d.mu.Unlock()
+			d.pca.logger.Detailed("Деградированный режим: устройство всё ещё недоступно (%d записей в очереди): %v", pending, err)
+			return false
+		}
+	}
+	d.queue = nil
+	d.active = false
+	d.mu.Unlock()
+
+	d.pca.logger.Basic("Связь с устройством восстановлена, отложенные записи применены")
+	d.pca.emit(Event{Type: EventRecovered})
+	return true
+}
+
+// Degraded сообщает, находится ли контроллер в деградированном режиме, и
+// возвращает число отложенных записей.
+func (pca *PCA9685) Degraded() (active bool, pending int) {
+	if pca.degraded == nil {
+		return false, 0
+	}
+	pca.degraded.mu.Lock()
+	defer pca.degraded.mu.Unlock()
+	return pca.degraded.active, len(pca.degraded.queue)
+}
+
+// writeDegraded выполняет запись с учётом деградированного режима.
+func (pca *PCA9685) writeDegraded(ctx context.Context, op string, channel int, reg uint8, data []byte) error {
+	if queued, err := pca.degraded.record(reg, data); queued {
+		return err
+	}
+	err := pca.writeVerified(ctx, op, channel, reg, data)
+	if err == nil || ctx.Err() != nil {
+		return pca.reportError(op, channel, err)
+	}
+	pca.reportError(op, channel, err)
+	return pca.degraded.enter(reg, data, err)
+}
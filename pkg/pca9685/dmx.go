@@ -0,0 +1,174 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DMXUniverseSize – количество слотов в одном DMX универсе.
+const DMXUniverseSize = 512
+
+// DMXPatch описывает привязку одного DMX слота к каналу PCA9685.
+type DMXPatch struct {
+	Universe uint16   // Номер универса (для Art-Net – 15-битный Port-Address)
+	Slot     int      // Номер слота DMX (от 1 до 512)
+	Device   *PCA9685 // Контроллер, на который выводится значение
+	Channel  int      // Канал контроллера (от 0 до 15)
+}
+
+// DMXMapper – общий слой отображения DMX слотов на каналы PCA9685 и приборы
+// с DMX-персональностью (DMXFixture).
+// Используется входными протоколами (Art-Net и т.п.), которые лишь
+// декодируют пакеты и передают данные универса в Apply.
+type DMXMapper struct {
+	mu       sync.RWMutex
+	patches  []DMXPatch
+	fixtures []dmxFixturePatch
+
+	lmu       sync.Mutex // защищает поля ниже
+	loss      DMXSignalLoss
+	universes map[uint16]*dmxUniverse
+}
+
+// NewDMXMapper создаёт пустую таблицу отображения DMX.
+func NewDMXMapper() *DMXMapper {
+	return &DMXMapper{}
+}
+
+// Patch привязывает слот DMX указанного универса к каналу контроллера.
+func (m *DMXMapper) Patch(universe uint16, slot int, pca *PCA9685, channel int) error {
+	if pca == nil {
+		return fmt.Errorf("device must not be nil")
+	}
+	if slot < 1 || slot > DMXUniverseSize {
+		pca.logger.Error("DMXMapper: неверный номер слота: %d", slot)
+		return fmt.Errorf("invalid DMX slot: %d", slot)
+	}
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("DMXMapper: неверный номер канала %d: %v", channel, err)
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.patches = append(m.patches, DMXPatch{
+		Universe: universe,
+		Slot:     slot,
+		Device:   pca,
+		Channel:  channel,
+	})
+	pca.logger.Detailed("DMXMapper: универс %d, слот %d -> канал %d", universe, slot, channel)
+	return nil
+}
+
+// Patches возвращает копию текущей таблицы отображения.
+func (m *DMXMapper) Patches() []DMXPatch {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	patches := make([]DMXPatch, len(m.patches))
+	copy(patches, m.patches)
+	return patches
+}
+
+// Apply выводит данные универса на привязанные каналы и приборы (AddFixture).
+// data[0] соответствует слоту 1. Слоты за пределами data не изменяются.
+// Каждый вызов считается приёмом кадра для отслеживания потери сигнала
+// (SetSignalLoss).
+func (m *DMXMapper) Apply(ctx context.Context, universe uint16, data []byte) error {
+	u, restored := m.received(universe, data)
+	if restored {
+		m.notify(universe, EventDMXSignalRestored)
+	}
+	if u != nil {
+		u.wmu.Lock()
+		defer u.wmu.Unlock()
+	}
+	return m.apply(ctx, universe, data)
+}
+
+func (m *DMXMapper) apply(ctx context.Context, universe uint16, data []byte) error {
+	if !hasSource(ctx) {
+		ctx = WithSource(ctx, SourceDMX)
+	}
+	m.mu.RLock()
+	perDevice := make(map[*PCA9685]map[int]struct{ On, Off uint16 })
+	for _, p := range m.patches {
+		if p.Universe != universe || p.Slot > len(data) {
+			continue
+		}
+		settings, ok := perDevice[p.Device]
+		if !ok {
+			settings = make(map[int]struct{ On, Off uint16 })
+			perDevice[p.Device] = settings
+		}
+		settings[p.Channel] = struct{ On, Off uint16 }{0, dmxToPWM(data[p.Slot-1])}
+	}
+	m.mu.RUnlock()
+
+	for pca, settings := range perDevice {
+		if err := pca.SetMultiPWM(ctx, settings); err != nil {
+			pca.logger.Error("DMXMapper: ошибка применения универса %d: %v", universe, err)
+			return fmt.Errorf("failed to apply DMX universe %d: %w", universe, err)
+		}
+	}
+	return m.applyFixtures(ctx, universe, data)
+}
+
+// dmxToPWM переводит 8-битное значение DMX в 12-битное значение PWM.
+func dmxToPWM(v byte) uint16 {
+	return uint16(uint32(v) * 4095 / 255)
+}
+
+// Blackout выключает выходы всех контроллеров таблицы (каналов и приборов)
+// через BlackoutAll, сохраняя значения каналов. Предназначен для команды
+// blackout пульта: RestoreFromBlackout мгновенно возвращает сцену, а данные
+// универсов, пришедшие во время затемнения, применяются к кэшу и проявятся
+// после него.
+func (m *DMXMapper) Blackout(ctx context.Context) error {
+	for _, pca := range m.devices() {
+		if err := pca.BlackoutAll(ctx); err != nil {
+			return fmt.Errorf("failed to blackout DMX outputs: %w", err)
+		}
+	}
+	return nil
+}
+
+// RestoreFromBlackout снимает затемнение Blackout.
+func (m *DMXMapper) RestoreFromBlackout(ctx context.Context) error {
+	for _, pca := range m.devices() {
+		if err := pca.RestoreFromBlackout(ctx); err != nil {
+			return fmt.Errorf("failed to restore DMX outputs: %w", err)
+		}
+	}
+	return nil
+}
+
+// devices возвращает контроллеры таблицы без повторов в порядке привязки.
+func (m *DMXMapper) devices() []*PCA9685 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var list []*PCA9685
+	for _, p := range m.patches {
+		list = appendController(list, p.Device)
+	}
+	for _, f := range m.fixtures {
+		if pca := fixtureDevice(f.fixture); pca != nil {
+			list = appendController(list, pca)
+		}
+	}
+	return list
+}
+
+// fixtureDevice возвращает контроллер встроенного прибора или nil.
+func fixtureDevice(fixture DMXFixture) *PCA9685 {
+	switch f := fixture.(type) {
+	case DMXDimmer:
+		return f.Device
+	case DMXRGB:
+		return f.Led.pca
+	case DMXServo:
+		return f.Servo.pca
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DMXLossAction – поведение выходов при потере сигнала DMX.
+type DMXLossAction int
+
+const (
+	// DMXLossHold – удерживать последний принятый кадр.
+	DMXLossHold DMXLossAction = iota
+	// DMXLossFade – плавно погасить выходы универса за DMXSignalLoss.Fade.
+	DMXLossFade
+	// DMXLossScene – плавно (за DMXSignalLoss.Fade) перейти к кадру
+	// DMXSignalLoss.Scene.
+	DMXLossScene
+)
+
+func (a DMXLossAction) String() string {
+	switch a {
+	case DMXLossHold:
+		return "hold"
+	case DMXLossFade:
+		return "fade"
+	case DMXLossScene:
+		return "scene"
+	default:
+		return fmt.Sprintf("DMXLossAction(%d)", int(a))
+	}
+}
+
+// dmxLossFrameRate – частота кадров затухания при потере сигнала (близка
+// к частоте обновления DMX).
+const dmxLossFrameRate = 40
+
+// DMXSignalLoss задаёт реакцию DMXMapper на потерю сигнала: если данные
+// универса не приходят дольше Timeout, выполняется Action.
+type DMXSignalLoss struct {
+	// Timeout – время без данных универса, после которого сигнал считается
+	// потерянным (0 – не отслеживать). Пульты Art-Net и sACN повторяют кадры
+	// не реже раза в секунду, поэтому обычно задают 2–3 секунды.
+	Timeout time.Duration
+	Action  DMXLossAction
+	// Fade – длительность перехода для DMXLossFade и DMXLossScene (0 –
+	// мгновенно).
+	Fade time.Duration
+	// Scene – кадр универса для DMXLossScene: Scene[0] соответствует слоту 1.
+	// Слоты за пределами Scene гаснут.
+	Scene []byte
+}
+
+// dmxUniverse – состояние приёма универса для отслеживания потери сигнала.
+type dmxUniverse struct {
+	wmu    sync.Mutex // сериализует вывод принятых кадров и кадров затухания
+	last   []byte     // последний принятый кадр
+	timer  *time.Timer
+	lost   bool
+	cancel context.CancelFunc // прерывает затухание при возобновлении сигнала
+}
+
+// SetSignalLoss задаёт реакцию на потерю сигнала DMX для всех универсов.
+// По умолчанию (и при нулевом Timeout) выходы удерживают последний кадр
+// бесконечно. Отсчёт начинается с первого кадра универса после вызова. При
+// потере сигнала контроллеры универса получают событие EventDMXSignalLost,
+// а с первым новым кадром затухание прерывается, кадр выводится как обычно
+// и генерируется EventDMXSignalRestored.
+func (m *DMXMapper) SetSignalLoss(cfg DMXSignalLoss) error {
+	if cfg.Timeout < 0 || cfg.Fade < 0 {
+		return fmt.Errorf("signal loss timeout and fade must not be negative")
+	}
+	if cfg.Action < DMXLossHold || cfg.Action > DMXLossScene {
+		return fmt.Errorf("unknown signal loss action: %v", cfg.Action)
+	}
+	if len(cfg.Scene) > DMXUniverseSize {
+		return fmt.Errorf("signal loss scene has %d slots, universe has %d", len(cfg.Scene), DMXUniverseSize)
+	}
+	cfg.Scene = append([]byte(nil), cfg.Scene...)
+
+	m.lmu.Lock()
+	defer m.lmu.Unlock()
+	m.loss = cfg
+	for _, u := range m.universes {
+		u.timer.Stop()
+		if u.cancel != nil {
+			u.cancel()
+		}
+	}
+	m.universes = nil
+	return nil
+}
+
+// received отмечает приём кадра universe и возвращает состояние универса,
+// если потеря сигнала отслеживается, и признак возобновления сигнала.
+func (m *DMXMapper) received(universe uint16, data []byte) (u *dmxUniverse, restored bool) {
+	m.lmu.Lock()
+	defer m.lmu.Unlock()
+	if m.loss.Timeout <= 0 {
+		return nil, false
+	}
+	if m.universes == nil {
+		m.universes = make(map[uint16]*dmxUniverse)
+	}
+	u = m.universes[universe]
+	if u == nil {
+		u = &dmxUniverse{}
+		timeout := m.loss.Timeout
+		u.timer = time.AfterFunc(timeout, func() { m.signalLost(universe, u) })
+		m.universes[universe] = u
+	} else {
+		u.timer.Reset(m.loss.Timeout)
+	}
+	u.last = append(u.last[:0], data...)
+	if u.lost {
+		u.lost = false
+		u.cancel()
+		u.cancel = nil
+		restored = true
+	}
+	return u, restored
+}
+
+// signalLost выполняет реакцию на потерю сигнала универса u.
+func (m *DMXMapper) signalLost(universe uint16, u *dmxUniverse) {
+	m.lmu.Lock()
+	if m.universes[universe] != u || u.lost {
+		m.lmu.Unlock()
+		return
+	}
+	cfg := m.loss
+	u.lost = true
+	ctx, cancel := context.WithCancel(context.Background())
+	u.cancel = cancel
+	from := append([]byte(nil), u.last...)
+	m.lmu.Unlock()
+
+	m.notify(universe, EventDMXSignalLost)
+	if cfg.Action == DMXLossHold {
+		return
+	}
+	to := make([]byte, max(len(from), len(cfg.Scene)))
+	if cfg.Action == DMXLossScene {
+		copy(to, cfg.Scene)
+	}
+	// Слоты, которых не было в последнем кадре, сразу получают значения сцены.
+	start := append(append([]byte(nil), from...), to[len(from):]...)
+
+	steps := FadeConfig{FrameRate: dmxLossFrameRate}.steps(cfg.Fade)
+	frame := make([]byte, len(to))
+	err := runFade(ctx, steps, cfg.Fade, func(step int) error {
+		for i := range frame {
+			frame[i] = byte(int(start[i]) + (int(to[i])-int(start[i]))*step/steps)
+		}
+		u.wmu.Lock()
+		defer u.wmu.Unlock()
+		// Кадр, принятый во время затухания, не перезаписывается.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return m.apply(ctx, universe, frame)
+	})
+	if err != nil && ctx.Err() == nil {
+		for i, pca := range m.universeDevices(universe) {
+			if i == 0 {
+				pca.logger.Error("DMXMapper: не удалось выполнить реакцию на потерю сигнала универса %d: %v", universe, err)
+			}
+		}
+	}
+}
+
+// notify сообщает контроллерам универса о потере или возобновлении сигнала.
+func (m *DMXMapper) notify(universe uint16, event EventType) {
+	for i, pca := range m.universeDevices(universe) {
+		if i == 0 {
+			if event == EventDMXSignalLost {
+				pca.logger.Error("DMXMapper: потерян сигнал универса %d", universe)
+			} else {
+				pca.logger.Basic("DMXMapper: сигнал универса %d восстановлен", universe)
+			}
+		}
+		pca.emit(Event{Type: event, Channel: -1, Name: fmt.Sprintf("DMX universe %d", universe)})
+	}
+}
+
+// universeDevices возвращает контроллеры, привязанные к универсу.
+func (m *DMXMapper) universeDevices(universe uint16) []*PCA9685 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var list []*PCA9685
+	for _, p := range m.patches {
+		if p.Universe == universe {
+			list = appendController(list, p.Device)
+		}
+	}
+	for _, f := range m.fixtures {
+		if f.universe != universe {
+			continue
+		}
+		if pca := fixtureDevice(f.fixture); pca != nil {
+			list = appendController(list, pca)
+		}
+	}
+	return list
+}
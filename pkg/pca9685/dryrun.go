@@ -0,0 +1,84 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+)
+
+// Регистры PCA9685, копируемые с микросхемы при включении пробного режима.
+const (
+	dryRunRegs    = RegLed0 + 4*16 // MODE1 … LED15_OFF_H
+	dryRunTailReg = RegAllLed      // ALL_LED … TestMode
+)
+
+// SetDryRun включает или выключает пробный режим. В пробном режиме все
+// операции выполняются полностью – проверка аргументов, арбитраж, кэш
+// каналов, события, журнал и логи, – но транзакции I2C не доходят до шины:
+// записи сохраняются во внутреннем эмуляторе регистров, а чтения возвращают
+// его содержимое. Так автоматизацию и расписания можно отрепетировать на
+// рабочей конфигурации, не изменяя выходы. Трассировка и счётчики Counters
+// учитывают транзакции эмулятора, записи журнала помечаются полем DryRun.
+//
+// При включении эмулятор однократно заполняется регистрами микросхемы
+// (только чтение), поэтому последующие чтения согласованы с устройством.
+// При выключении выходы приводятся к состоянию кэша через Reinitialize:
+// изменения, сделанные в пробном режиме, выводятся на микросхему.
+// Чтобы начать работу в пробном режиме без обращений к шине, задайте
+// Config.DryRun.
+func (pca *PCA9685) SetDryRun(ctx context.Context, enabled bool) error {
+	if enabled == pca.DryRun() {
+		return nil
+	}
+	if !enabled {
+		pca.logger.Basic("Пробный режим выключен, вывод состояния на устройство")
+		pca.dry.Store((*TestI2C)(nil))
+		return pca.Reinitialize(ctx)
+	}
+
+	shadow := NewTestI2C(WithLogger(pca.logger))
+	if err := pca.seedDryRun(ctx, shadow); err != nil {
+		pca.logger.Error("SetDryRun: не удалось прочитать регистры устройства: %v", err)
+		return fmt.Errorf("failed to read device registers: %w", err)
+	}
+	pca.dry.Store(shadow)
+	pca.logger.Basic("Пробный режим включён: записи на шину не выполняются")
+	return nil
+}
+
+// seedDryRun копирует регистры микросхемы в эмулятор по карте регистров
+// профиля. Эмулятор не разбирает управляющий байт PCA9635, поэтому её
+// регистры копируются дважды: по адресам без флага автоинкремента (MODE1,
+// MODE2) и с ним (каналы, LEDOUT, контрольное чтение).
+func (pca *PCA9685) seedDryRun(ctx context.Context, shadow *TestI2C) error {
+	if pca.chip == ChipPCA9635 {
+		regs := make([]byte, RegPCA9635AllCall+1)
+		if err := pca.readReg(ctx, "SetDryRun", -1, pca9635AutoInc|RegMode1, regs); err != nil {
+			return err
+		}
+		copy(shadow.registers[RegMode1:], regs)
+		copy(shadow.registers[pca9635AutoInc|RegMode1:], regs)
+		return nil
+	}
+	head := make([]byte, dryRunRegs)
+	tail := make([]byte, 256-dryRunTailReg)
+	if err := pca.readReg(ctx, "SetDryRun", -1, RegMode1, head); err != nil {
+		return err
+	}
+	if err := pca.readReg(ctx, "SetDryRun", -1, dryRunTailReg, tail); err != nil {
+		return err
+	}
+	copy(shadow.registers[RegMode1:], head)
+	copy(shadow.registers[dryRunTailReg:], tail)
+	return nil
+}
+
+// DryRun сообщает, включён ли пробный режим.
+func (pca *PCA9685) DryRun() bool {
+	return pca.dryDevice() != nil
+}
+
+// dryDevice возвращает эмулятор пробного режима или nil.
+func (pca *PCA9685) dryDevice() *TestI2C {
+	d, _ := pca.dry.Load().(*TestI2C)
+	return d
+}
@@ -0,0 +1,234 @@
+package pca9685
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// defaultDutyWindows – окна скользящих средних DutyStats по умолчанию.
+var defaultDutyWindows = []time.Duration{time.Minute, time.Hour, 24 * time.Hour}
+
+// DutyAverage – скользящее среднее скважности канала за окно.
+type DutyAverage struct {
+	Window time.Duration `json:"window"`
+	Duty   float64       `json:"duty"` // %
+}
+
+// ChannelDuty – накопленная статистика работы выхода канала.
+type ChannelDuty struct {
+	Channel    int           `json:"channel"`
+	Elapsed    time.Duration `json:"elapsed"`     // Время учёта (с создания контроллера или ResetDutyStats)
+	OnTime     time.Duration `json:"on_time"`     // Время работы в пересчёте на полную мощность (время × скважность)
+	ActiveTime time.Duration `json:"active_time"` // Время с ненулевым импульсом
+	Starts     uint64        `json:"starts"`      // Включения: переходы от нулевого импульса к ненулевому
+	Duty       float64       `json:"duty"`        // Текущая скважность выхода, %
+	Average    float64       `json:"average"`     // Средняя скважность за Elapsed, %
+	Averages   []DutyAverage `json:"averages"`    // Скользящие средние по окнам Config.DutyWindows
+}
+
+// dutyTracker ведёт модель регистров микросхемы по записям шины и
+// накапливает время работы выходов.
+type dutyTracker struct {
+	mu       sync.Mutex
+	chip     Chip
+	regs     [256]byte
+	windows  []time.Duration
+	start    time.Time
+	last     time.Time
+	loads    [16]float64 // мощность нагрузки при скважности 100%, Вт
+	channels [16]dutyChannel
+
+	maint []*maintenanceItem      // сроки обслуживания (SetMaintenance)
+	fired []MaintenanceStatus     // наступившие сроки, о которых сообщит unlock
+	onDue func(MaintenanceStatus) // обработчик наступления срока
+}
+
+type dutyChannel struct {
+	duty   float64 // текущая доля периода (0–1)
+	on     float64 // секунды работы в пересчёте на полную мощность
+	active float64 // секунды с ненулевым импульсом
+	energy float64 // Дж по заявленной мощности нагрузки
+	starts uint64
+	avg    []float64 // скользящие средние (доли) по окнам
+}
+
+func newDutyTracker(chip Chip, windows []time.Duration) *dutyTracker {
+	if len(windows) == 0 {
+		windows = defaultDutyWindows
+	}
+	now := time.Now()
+	t := &dutyTracker{
+		chip:    chip,
+		regs:    powerOnRegisters(chip),
+		windows: append([]time.Duration(nil), windows...),
+		start:   now,
+		last:    now,
+	}
+	for i := range t.channels {
+		t.channels[i].avg = make([]float64, len(t.windows))
+	}
+	return t
+}
+
+// observe учитывает успешную запись регистров, завершённую в момент now.
+func (t *dutyTracker) observe(now time.Time, reg uint8, data []byte) {
+	t.mu.Lock()
+	defer t.unlock()
+	applyRegisters(t.chip, &t.regs, reg, data)
+	var duties [16]float64
+	changed := false
+	for i := range duties {
+		duties[i] = t.output(i)
+		changed = changed || duties[i] != t.channels[i].duty
+	}
+	if !changed {
+		return
+	}
+	t.advance(now)
+	t.countStrokes(&duties)
+	for i := range t.channels {
+		c := &t.channels[i]
+		if c.duty == 0 && duties[i] > 0 {
+			c.starts++
+		}
+		c.duty = duties[i]
+	}
+}
+
+// output возвращает скважность выхода ch по модели регистров: в режиме SLEEP
+// осциллятор остановлен и выходы выключены.
+func (t *dutyTracker) output(ch int) float64 {
+	if t.regs[RegMode1]&Mode1Sleep != 0 {
+		return 0
+	}
+	return float64(pulseTicks(channelRegisters(t.chip, &t.regs, ch))) / PwmResolution
+}
+
+// advance накапливает время работы до момента now при неизменной скважности.
+func (t *dutyTracker) advance(now time.Time) {
+	dt := now.Sub(t.last).Seconds()
+	if dt <= 0 {
+		return
+	}
+	t.last = now
+	for i := range t.channels {
+		c := &t.channels[i]
+		c.on += c.duty * dt
+		c.energy += t.loads[i] * c.duty * dt
+		if c.duty > 0 {
+			c.active += dt
+		}
+		for k, w := range t.windows {
+			a := math.Exp(-dt / w.Seconds())
+			c.avg[k] = c.avg[k]*a + c.duty*(1-a)
+		}
+	}
+	t.advanceMaintenance(dt)
+}
+
+func (t *dutyTracker) stats(now time.Time) []ChannelDuty {
+	t.mu.Lock()
+	defer t.unlock()
+	t.advance(now)
+	elapsed := t.last.Sub(t.start)
+	stats := make([]ChannelDuty, len(t.channels))
+	for i := range t.channels {
+		c := &t.channels[i]
+		s := ChannelDuty{
+			Channel:    i,
+			Elapsed:    elapsed,
+			OnTime:     time.Duration(c.on * float64(time.Second)),
+			ActiveTime: time.Duration(c.active * float64(time.Second)),
+			Starts:     c.starts,
+			Duty:       c.duty * 100,
+			Averages:   make([]DutyAverage, len(t.windows)),
+		}
+		if elapsed > 0 {
+			s.Average = c.on / elapsed.Seconds() * 100
+		}
+		for k, w := range t.windows {
+			s.Averages[k] = DutyAverage{Window: w, Duty: c.avg[k] * 100}
+		}
+		stats[i] = s
+	}
+	return stats
+}
+
+func (t *dutyTracker) reset(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.start, t.last = now, now
+	for i := range t.channels {
+		c := &t.channels[i]
+		c.on, c.active, c.energy, c.starts = 0, 0, 0, 0
+		for k := range c.avg {
+			c.avg[k] = 0
+		}
+	}
+}
+
+// setLoad задаёт мощность нагрузки канала ch; энергия до момента now
+// считается по прежней мощности.
+func (t *dutyTracker) setLoad(ch int, watts float64, now time.Time) {
+	t.mu.Lock()
+	defer t.unlock()
+	t.advance(now)
+	t.loads[ch] = watts
+}
+
+// energy возвращает мощность нагрузки, текущую мощность (Вт) и энергию
+// (Вт·ч) канала ch на момент now.
+func (t *dutyTracker) energy(ch int, now time.Time) (load, power, energy float64) {
+	t.mu.Lock()
+	defer t.unlock()
+	t.advance(now)
+	c := &t.channels[ch]
+	return t.loads[ch], t.loads[ch] * c.duty, c.energy / 3600
+}
+
+// elapsed возвращает время учёта на момент now.
+func (t *dutyTracker) elapsed(now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.unlock()
+	t.advance(now)
+	return t.last.Sub(t.start)
+}
+
+// observeWrite передаёт успешную запись регистров в учёт времени работы.
+func (pca *PCA9685) observeWrite(now time.Time, reg uint8, data []byte) {
+	if pca.duty != nil {
+		pca.duty.observe(now, reg, data)
+	}
+}
+
+// DutyStats возвращает статистику работы выходов всех 16 каналов: время
+// работы в пересчёте на полную мощность (OnTime), время с ненулевым
+// импульсом, число включений и среднюю скважность за всё время учёта и по
+// окнам Config.DutyWindows. По ней оценивают износ светодиодов и наработку
+// насосов; расход энергии по заявленной мощности нагрузки считает Energy.
+//
+// Учитывается фактический выход по записям в микросхему: с мастер-яркостью,
+// ограничениями каналов, затемнением BlackoutAll, групповыми записями ALLCALL
+// и режимом сна, а не запрошенные значения. Скользящие средние
+// экспоненциальные, как средняя загрузка в uptime: вклад более старых
+// значений убывает с постоянной времени окна, а сразу после создания
+// контроллера средние занижены. Выходы, оставшиеся включёнными в микросхеме
+// до создания контроллера, не учитываются до первой записи канала.
+func (pca *PCA9685) DutyStats() []ChannelDuty {
+	if pca.duty == nil {
+		return nil
+	}
+	return pca.duty.stats(time.Now())
+}
+
+// ResetDutyStats обнуляет накопленную статистику работы каналов и энергию
+// (см. Energy), например после замены светодиодов или обслуживания насоса.
+// Текущие скважности и мощности нагрузки сохраняются.
+func (pca *PCA9685) ResetDutyStats() {
+	if pca.duty == nil {
+		return
+	}
+	pca.logger.Basic("ResetDutyStats: статистика работы каналов сброшена")
+	pca.duty.reset(time.Now())
+}
@@ -0,0 +1,140 @@
+package pca9685
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ChannelEnergy – оценка мощности и энергии нагрузки канала.
+type ChannelEnergy struct {
+	Channel int     `json:"channel"`
+	Label   string  `json:"label,omitempty"` // Метка канала (SetChannelLabel)
+	Load    float64 `json:"load"`            // Мощность нагрузки при скважности 100%, Вт
+	Power   float64 `json:"power"`           // Текущая мощность, Вт
+	Energy  float64 `json:"energy"`          // Энергия с начала учёта, Вт·ч
+}
+
+// PeripheralEnergy – суммарная оценка для каналов одной периферии.
+type PeripheralEnergy struct {
+	Name     string  `json:"name"` // Описание периферии, как в ChannelOwner
+	Channels []int   `json:"channels"`
+	Power    float64 `json:"power"`  // Вт
+	Energy   float64 `json:"energy"` // Вт·ч
+}
+
+// EnergyReport – оценка мощности и энергии нагрузок контроллера.
+type EnergyReport struct {
+	Time        time.Time          `json:"time"`
+	Elapsed     time.Duration      `json:"elapsed"` // Время учёта (см. DutyStats)
+	Power       float64            `json:"power"`   // Текущая мощность, Вт
+	Energy      float64            `json:"energy"`  // Энергия с начала учёта, Вт·ч
+	Channels    []ChannelEnergy    `json:"channels"`
+	Peripherals []PeripheralEnergy `json:"peripherals,omitempty"`
+}
+
+// GroupEnergyReport – оценка мощности и энергии контроллеров группы.
+type GroupEnergyReport struct {
+	Time    time.Time      `json:"time"`
+	Power   float64        `json:"power"`   // Вт
+	Energy  float64        `json:"energy"`  // Вт·ч
+	Devices []EnergyReport `json:"devices"` // В порядке Members
+}
+
+// SetChannelLoad задаёт мощность нагрузки канала при скважности 100%, Вт
+// (например, 12 для светодиодной ленты 12 Вт), или 0, чтобы исключить канал
+// из оценки. Энергия, накопленная до вызова, сохраняется.
+func (pca *PCA9685) SetChannelLoad(channel int, watts float64) error {
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("SetChannelLoad: неверный номер канала %d: %v", channel, err)
+		return err
+	}
+	if watts < 0 || math.IsNaN(watts) || math.IsInf(watts, 0) {
+		return fmt.Errorf("load must be a non-negative number of watts, got %v", watts)
+	}
+	if pca.duty == nil {
+		return fmt.Errorf("duty accounting is not available")
+	}
+	pca.duty.setLoad(channel, watts, time.Now())
+	pca.logger.Detailed("SetChannelLoad: канал %d, %v Вт", channel, watts)
+	return nil
+}
+
+// ChannelLoad возвращает мощность нагрузки канала, заданную
+// SetChannelLoad, или 0.
+func (pca *PCA9685) ChannelLoad(channel int) float64 {
+	if pca.validateChannel(channel) != nil || pca.duty == nil {
+		return 0
+	}
+	load, _, _ := pca.duty.energy(channel, time.Now())
+	return load
+}
+
+// Energy оценивает мощность и потребление нагрузок по мощности, заданной
+// SetChannelLoad, и фактической скважности выходов (см. DutyStats):
+// текущая мощность канала – мощность нагрузки, умноженная на скважность,
+// энергия накапливается с создания контроллера или ResetDutyStats. В отчёт
+// входят каналы с заданной мощностью или накопленной энергией, а также суммы
+// по периферии, занимающей каналы (RGBLed, Pump и т. п.).
+//
+// Оценка предполагает линейную зависимость мощности от скважности, что верно
+// для светодиодов и резистивных нагрузок и приблизительно – для моторов и
+// насосов.
+func (pca *PCA9685) Energy() EnergyReport {
+	now := time.Now()
+	report := EnergyReport{Time: now}
+	if pca.duty == nil {
+		return report
+	}
+	pca.mu.RLock()
+	owners := pca.owners
+	pca.mu.RUnlock()
+
+	peripherals := make(map[interface{}]int)
+	for i := range pca.channels {
+		load, power, energy := pca.duty.energy(i, now)
+		if load == 0 && energy == 0 {
+			continue
+		}
+		label, _ := pca.channels[i].label.Load().(string)
+		report.Channels = append(report.Channels, ChannelEnergy{
+			Channel: i,
+			Label:   label,
+			Load:    load,
+			Power:   power,
+			Energy:  energy,
+		})
+		report.Power += power
+		report.Energy += energy
+
+		o := owners[i]
+		if o.ref == nil {
+			continue
+		}
+		j, ok := peripherals[o.ref]
+		if !ok {
+			j = len(report.Peripherals)
+			peripherals[o.ref] = j
+			report.Peripherals = append(report.Peripherals, PeripheralEnergy{Name: o.name})
+		}
+		p := &report.Peripherals[j]
+		p.Channels = append(p.Channels, i)
+		p.Power += power
+		p.Energy += energy
+	}
+	report.Elapsed = pca.duty.elapsed(now)
+	return report
+}
+
+// Energy возвращает оценки мощности и энергии всех контроллеров группы и
+// их суммы.
+func (g *ControllerGroup) Energy() GroupEnergyReport {
+	report := GroupEnergyReport{Time: time.Now()}
+	for _, pca := range g.list() {
+		r := pca.Energy()
+		report.Power += r.Power
+		report.Energy += r.Energy
+		report.Devices = append(report.Devices, r)
+	}
+	return report
+}
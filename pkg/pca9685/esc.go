@@ -0,0 +1,251 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ESCCalibration содержит длительности импульсов нулевого и полного газа
+// регулятора хода (ESC).
+type ESCCalibration struct {
+	MinPulse time.Duration `json:"min_pulse"` // Импульс нулевого газа
+	MaxPulse time.Duration `json:"max_pulse"` // Импульс полного газа
+}
+
+// DefaultESCCalibration возвращает типовую калибровку ESC: 1–2 мс.
+func DefaultESCCalibration() ESCCalibration {
+	return ESCCalibration{MinPulse: 1000 * time.Microsecond, MaxPulse: 2000 * time.Microsecond}
+}
+
+func (c ESCCalibration) validate() error {
+	if c.MinPulse <= 0 || c.MaxPulse <= c.MinPulse {
+		return fmt.Errorf("ESC pulses must be positive and min must be less than max")
+	}
+	return nil
+}
+
+// ESC представляет регулятор хода бесколлекторного двигателя.
+type ESC struct {
+	pca     *PCA9685
+	channel int
+
+	mu       sync.RWMutex
+	cal      ESCCalibration
+	throttle float64
+	motion   MotionProfile // профиль RampTo
+}
+
+// NewESC создаёт регулятор хода на канале channel и сразу подаёт импульс
+// нулевого газа, необходимый для взведения ESC.
+func NewESC(ctx context.Context, pca *PCA9685, channel int, cal ESCCalibration) (*ESC, error) {
+	pca.logger.Detailed("Создание ESC на канале: %d", channel)
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("NewESC: неверный номер канала: %d", channel)
+		return nil, err
+	}
+	if err := cal.validate(); err != nil {
+		pca.logger.Error("NewESC: неверная калибровка: %v", err)
+		return nil, err
+	}
+	if err := pca.requireFrequency("ESC"); err != nil {
+		pca.logger.Error("NewESC: %v", err)
+		return nil, err
+	}
+
+	esc := &ESC{pca: pca, channel: channel, cal: cal}
+	if err := pca.claimChannels(esc, fmt.Sprintf("ESC on channel %d", channel), channel); err != nil {
+		pca.logger.Error("NewESC: канал %d недоступен: %v", channel, err)
+		return nil, err
+	}
+	if err := pca.checkPeripheralFrequency(esc); err != nil {
+		pca.releaseChannels(esc, channel)
+		pca.logger.Error("NewESC: %v", err)
+		return nil, err
+	}
+	if err := pca.EnableChannels(channel); err != nil {
+		pca.releaseChannels(esc, channel)
+		pca.logger.Error("NewESC: не удалось включить канал %d: %v", channel, err)
+		return nil, fmt.Errorf("failed to enable channel: %w", err)
+	}
+	if err := esc.setPulse(ctx, cal.MinPulse); err != nil {
+		pca.releaseChannels(esc, channel)
+		return nil, err
+	}
+
+	pca.logger.Basic("ESC успешно создан на канале: %d", channel)
+	return esc, nil
+}
+
+// Release освобождает канал ESC. ESC после этого использовать нельзя.
+func (e *ESC) Release() {
+	e.pca.logger.Basic("Освобождение канала ESC %d", e.channel)
+	e.pca.releaseChannels(e, e.channel)
+}
+
+// setPulse подаёт импульс длительностью d.
+func (e *ESC) setPulse(ctx context.Context, d time.Duration) error {
+	if err := e.pca.SetPWM(ctx, e.channel, 0, e.pca.durationTicks(d)); err != nil {
+		e.pca.logger.Error("ESC: ошибка установки импульса %v: %v", d, err)
+		return err
+	}
+	return nil
+}
+
+// SetThrottle устанавливает газ в процентах (0–100%).
+func (e *ESC) SetThrottle(ctx context.Context, percent float64) error {
+	if percent < 0 || percent > 100 {
+		err := fmt.Errorf("throttle percentage must be between 0 and 100")
+		e.pca.logger.Error("SetThrottle: неверное значение газа: %f%%", percent)
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	pulse := e.cal.MinPulse + time.Duration(float64(e.cal.MaxPulse-e.cal.MinPulse)*percent/100)
+	if err := e.setPulse(ctx, pulse); err != nil {
+		return err
+	}
+	e.throttle = percent
+	e.pca.logger.Detailed("SetThrottle: канал %d, газ %f%%", e.channel, percent)
+	return nil
+}
+
+// Throttle возвращает последний установленный газ в процентах.
+func (e *ESC) Throttle() float64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.throttle
+}
+
+// Calibration возвращает калибровку ESC.
+func (e *ESC) Calibration() ESCCalibration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.cal
+}
+
+// ESCCalibrationStep – шаг калибровки ESC.
+type ESCCalibrationStep int
+
+const (
+	// ESCStepMaxThrottle – подан полный газ, нужно подключить питание ESC и
+	// дождаться сигнала.
+	ESCStepMaxThrottle ESCCalibrationStep = iota
+	// ESCStepMinThrottle – подан нулевой газ, ESC запоминает нижнюю точку.
+	ESCStepMinThrottle
+	// ESCStepDone – калибровка завершена.
+	ESCStepDone
+)
+
+func (s ESCCalibrationStep) String() string {
+	switch s {
+	case ESCStepMaxThrottle:
+		return "max throttle"
+	case ESCStepMinThrottle:
+		return "min throttle"
+	case ESCStepDone:
+		return "done"
+	default:
+		return "unknown"
+	}
+}
+
+// escCalibrate – параметры калибровки ESC.
+type escCalibrate struct {
+	prompt  func(ESCCalibrationStep)
+	confirm func(ctx context.Context) error
+	maxHold time.Duration
+	minHold time.Duration
+}
+
+// ESCCalibrateOption определяет опцию калибровки ESC.
+type ESCCalibrateOption func(*escCalibrate)
+
+// WithESCPrompt задаёт функцию, вызываемую в начале каждого шага калибровки
+// (например, для вывода подсказки пользователю).
+func WithESCPrompt(fn func(ESCCalibrationStep)) ESCCalibrateOption {
+	return func(c *escCalibrate) { c.prompt = fn }
+}
+
+// WithESCConfirm задаёт функцию, ожидающую подтверждения пользователя, что
+// питание ESC подключено и прозвучал сигнал полного газа. Без неё шаг полного
+// газа длится фиксированное время (см. WithESCHold).
+func WithESCConfirm(fn func(ctx context.Context) error) ESCCalibrateOption {
+	return func(c *escCalibrate) { c.confirm = fn }
+}
+
+// WithESCHold задаёт длительность шагов полного и нулевого газа
+// (по умолчанию 5 и 3 секунды).
+func WithESCHold(max, min time.Duration) ESCCalibrateOption {
+	return func(c *escCalibrate) {
+		if max > 0 {
+			c.maxHold = max
+		}
+		if min > 0 {
+			c.minHold = min
+		}
+	}
+}
+
+// Calibrate выполняет стандартную калибровку конечных точек ESC: подаётся
+// полный газ, пользователь подключает питание ESC, после сигнала подаётся
+// нулевой газ. Двигатель во время калибровки должен быть без нагрузки (снимите
+// винт). При ошибке или отмене контекста сразу подаётся нулевой газ.
+func (e *ESC) Calibrate(ctx context.Context, opts ...ESCCalibrateOption) (err error) {
+	c := escCalibrate{
+		prompt:  func(ESCCalibrationStep) {},
+		maxHold: 5 * time.Second,
+		minHold: 3 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pca.logger.Basic("Calibrate: калибровка ESC на канале %d", e.channel)
+	defer func() {
+		if err != nil {
+			// Полный газ нельзя оставлять ни при каких ошибках.
+			if stopErr := e.setPulse(context.Background(), e.cal.MinPulse); stopErr != nil {
+				e.pca.logger.Error("Calibrate: не удалось подать нулевой газ: %v", stopErr)
+			}
+			e.pca.logger.Error("Calibrate: калибровка ESC прервана: %v", err)
+		}
+		e.throttle = 0
+	}()
+
+	wait := func(d time.Duration) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+			return nil
+		}
+	}
+
+	if err := e.setPulse(ctx, e.cal.MaxPulse); err != nil {
+		return err
+	}
+	c.prompt(ESCStepMaxThrottle)
+	if c.confirm != nil {
+		err = c.confirm(ctx)
+	} else {
+		err = wait(c.maxHold)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := e.setPulse(ctx, e.cal.MinPulse); err != nil {
+		return err
+	}
+	c.prompt(ESCStepMinThrottle)
+	if err := wait(c.minHold); err != nil {
+		return err
+	}
+	c.prompt(ESCStepDone)
+	e.pca.logger.Basic("Calibrate: калибровка ESC завершена")
+	return nil
+}
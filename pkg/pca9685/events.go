@@ -0,0 +1,108 @@
+package pca9685
+
+// EventType – тип события контроллера.
+type EventType int
+
+const (
+	// EventDegraded – устройство недоступно, записи накапливаются в очереди.
+	EventDegraded EventType = iota
+	// EventRecovered – связь восстановлена, накопленные записи применены.
+	EventRecovered
+	// EventSleep – микросхема автоматически переведена в режим SLEEP.
+	EventSleep
+	// EventWake – микросхема выведена из режима SLEEP перед записью.
+	EventWake
+	// EventFailsafe – пропущен сигнал Heartbeat, выходы переведены в безопасное состояние.
+	EventFailsafe
+	// EventPumpCutoff – насос остановлен по превышению времени работы.
+	EventPumpCutoff
+	// EventStall – нагрузка остановлена: ток вне допустимого диапазона.
+	EventStall
+	// EventFadeStarted – начато плавное изменение (FadeChannel, FadeMulti, FadeMaster).
+	EventFadeStarted
+	// EventFadeCompleted – плавное изменение дошло до конечного значения.
+	EventFadeCompleted
+	// EventFadeCancelled – плавное изменение прервано отменой контекста или ошибкой записи.
+	EventFadeCancelled
+	// EventAnimationLooped – Sequencer, TrajectoryPlayer или ProfileRunner начал очередной круг.
+	EventAnimationLooped
+	// EventSceneApplied – сцена применена ApplyScene (в том числе шагом Sequencer).
+	EventSceneApplied
+	// EventWriteMismatch – контрольное чтение не совпало с записью (Config.VerifyWrites).
+	EventWriteMismatch
+	// EventServoBlocked – сервопривод с обратной связью не достигает заданного угла.
+	EventServoBlocked
+	// EventDeviceLost – контроллер группы перестал отвечать на шине (ControllerGroup.Watch).
+	EventDeviceLost
+	// EventDeviceRestored – контроллер группы снова отвечает и повторно инициализирован.
+	EventDeviceRestored
+	// EventMaintenanceDue – наступил срок обслуживания периферии (SetMaintenance).
+	EventMaintenanceDue
+	// EventDMXSignalLost – данные универса DMX не приходят дольше DMXSignalLoss.Timeout.
+	EventDMXSignalLost
+	// EventDMXSignalRestored – после потери сигнала снова принят кадр универса.
+	EventDMXSignalRestored
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventDegraded:
+		return "degraded"
+	case EventRecovered:
+		return "recovered"
+	case EventSleep:
+		return "sleep"
+	case EventWake:
+		return "wake"
+	case EventFailsafe:
+		return "failsafe"
+	case EventPumpCutoff:
+		return "pump cutoff"
+	case EventStall:
+		return "stall"
+	case EventFadeStarted:
+		return "fade started"
+	case EventFadeCompleted:
+		return "fade completed"
+	case EventFadeCancelled:
+		return "fade cancelled"
+	case EventAnimationLooped:
+		return "animation looped"
+	case EventSceneApplied:
+		return "scene applied"
+	case EventWriteMismatch:
+		return "write mismatch"
+	case EventServoBlocked:
+		return "servo blocked"
+	case EventDeviceLost:
+		return "device lost"
+	case EventDeviceRestored:
+		return "device restored"
+	case EventMaintenanceDue:
+		return "maintenance due"
+	case EventDMXSignalLost:
+		return "DMX signal lost"
+	case EventDMXSignalRestored:
+		return "DMX signal restored"
+	default:
+		return "unknown"
+	}
+}
+
+// Event – событие контроллера, передаваемое в Config.OnEvent.
+type Event struct {
+	Type     EventType
+	Err      error  // Ошибка, вызвавшая событие (для EventDegraded, EventFailsafe, EventFadeCancelled, EventWriteMismatch, EventServoBlocked и EventDeviceLost)
+	Pending  int    // Число записей в очереди на момент события
+	Channel  int    // Канал периферии (для EventPumpCutoff, EventStall и EventServoBlocked), первый канал записи (для EventWriteMismatch), первый канал периферии (для EventMaintenanceDue) или единственный канал плавного изменения, иначе -1
+	Name     string // Операция (FadeChannel, FadeMulti, FadeMaster, операция записи для EventWriteMismatch), проигрыватель (Sequencer, TrajectoryPlayer, Profile), имя сцены, работы обслуживания или универса DMX ("DMX universe 1")
+	Channels []int  // Каналы плавного изменения, сцены или периферии (для EventMaintenanceDue) по возрастанию
+	Loop     int    // Номер начатого круга анимации, начиная с 1 (для EventAnimationLooped)
+}
+
+// emit передаёт событие в обработчик Config.OnEvent.
+func (pca *PCA9685) emit(e Event) {
+	if pca.onEvent != nil {
+		pca.onEvent(e)
+	}
+}
@@ -0,0 +1,166 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// defaultFadeSteps – количество шагов плавного изменения по умолчанию.
+const defaultFadeSteps = 20
+
+// FadeConfig задаёт разрешение плавных изменений. Если FrameRate больше нуля,
+// используется адаптивный режим: число шагов выбирается по длительности так,
+// чтобы частота кадров была около FrameRate. Иначе используется Steps шагов.
+type FadeConfig struct {
+	Steps     int     // Фиксированное число шагов (по умолчанию 20)
+	FrameRate float64 // Целевая частота кадров, кадров/с (0 – фиксированное число шагов)
+}
+
+// steps возвращает число шагов для изменения длительностью d.
+func (c FadeConfig) steps(d time.Duration) int {
+	if d <= 0 {
+		return 1
+	}
+	if c.FrameRate > 0 {
+		n := int(math.Round(d.Seconds() * c.FrameRate))
+		if n < 1 {
+			n = 1
+		}
+		return n
+	}
+	if c.Steps > 0 {
+		return c.Steps
+	}
+	return defaultFadeSteps
+}
+
+// FadeOption переопределяет разрешение для одного вызова FadeChannel или FadeMulti.
+type FadeOption func(*FadeConfig)
+
+// WithFadeSteps задаёт фиксированное число шагов.
+func WithFadeSteps(n int) FadeOption {
+	return func(c *FadeConfig) {
+		if n > 0 {
+			c.Steps = n
+			c.FrameRate = 0
+		}
+	}
+}
+
+// WithFadeFrameRate включает адаптивный режим с целевой частотой кадров fps.
+func WithFadeFrameRate(fps float64) FadeOption {
+	return func(c *FadeConfig) {
+		if fps > 0 {
+			c.FrameRate = fps
+		}
+	}
+}
+
+// fadeConfig возвращает настройки разрешения с учётом опций вызова.
+func (pca *PCA9685) fadeConfig(opts []FadeOption) FadeConfig {
+	cfg := pca.fade
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// FadeSpec – начальное и конечное значение off для одного канала.
+type FadeSpec struct {
+	Start, End uint16
+}
+
+// at возвращает значение на шаге step из steps.
+func (f FadeSpec) at(step, steps int) uint16 {
+	return uint16(int(f.Start) + (int(f.End)-int(f.Start))*step/steps)
+}
+
+// FadeMulti плавно изменяет несколько каналов за duration. Все каналы
+// обновляются одним тикером и записываются пакетом на каждом кадре, поэтому
+// изменения начинаются и заканчиваются одновременно.
+func (pca *PCA9685) FadeMulti(ctx context.Context, fades map[int]FadeSpec, duration time.Duration, opts ...FadeOption) error {
+	pca.logger.Basic("FadeMulti: плавное изменение %d каналов за %v", len(fades), duration)
+	channels := make([]int, 0, len(fades))
+	for ch := range fades {
+		if err := pca.validateChannel(ch); err != nil {
+			pca.logger.Error("FadeMulti: неверный номер канала %d: %v", ch, err)
+			return err
+		}
+		channels = append(channels, ch)
+	}
+	sort.Ints(channels)
+	if duration < 0 {
+		return fmt.Errorf("fade duration must not be negative")
+	}
+
+	steps := pca.fadeConfig(opts).steps(duration)
+	values := make([]PWMValue, len(channels))
+	begin := time.Now()
+	fctx := pca.quiet(ctx)
+	pca.fadeEvent(EventFadeStarted, "FadeMulti", channels, nil)
+	err := runFade(fctx, steps, duration, func(step int) error {
+		for i, ch := range channels {
+			values[i] = PWMValue{Channel: ch, Off: fades[ch].at(step, steps)}
+		}
+		if err := pca.SetMultiPWMValues(fctx, values); err != nil {
+			pca.logger.Error("FadeMulti: ошибка на шаге %d: %v", step, err)
+			return err
+		}
+		return nil
+	})
+	pca.fadeEvent(EventFadeCompleted, "FadeMulti", channels, err)
+	for _, ch := range channels {
+		pca.record(ctx, JournalEntry{Time: begin, Op: "FadeMulti", Channel: ch, Off: fades[ch].End, Value: duration.Seconds()}, err)
+	}
+	if err != nil {
+		return err
+	}
+	pca.logger.Basic("FadeMulti: плавное изменение завершено")
+	return nil
+}
+
+// fadeEvent сообщает о начале (err не используется) или завершении плавного
+// изменения name на каналах channels (nil для FadeMaster).
+func (pca *PCA9685) fadeEvent(t EventType, name string, channels []int, err error) {
+	if pca.onEvent == nil {
+		return
+	}
+	if t != EventFadeStarted && err != nil {
+		t = EventFadeCancelled
+	}
+	channel := -1
+	if len(channels) == 1 {
+		channel = channels[0]
+	}
+	pca.emit(Event{Type: t, Err: err, Channel: channel, Name: name, Channels: channels})
+}
+
+// runFade вызывает frame для шагов 0..steps, равномерно распределяя их по
+// duration. При нулевой длительности сразу применяется последний шаг; если
+// duration короче steps наносекунд, шаги следуют с интервалом 1 нс.
+func runFade(ctx context.Context, steps int, duration time.Duration, frame func(step int) error) error {
+	if steps < 1 {
+		return fmt.Errorf("fade must have at least one step, got %d", steps)
+	}
+	if duration <= 0 {
+		return frame(steps)
+	}
+	ticker := time.NewTicker(max(duration/time.Duration(steps), 1))
+	defer ticker.Stop()
+	for step := 0; ; step++ {
+		if err := frame(step); err != nil {
+			return err
+		}
+		if step == steps {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrHeartbeatMissed передаётся в событии EventFailsafe, если приложение не
+// вызвало Heartbeat до истечения таймаута.
+var ErrHeartbeatMissed = errors.New("heartbeat missed")
+
+// Failsafe реализует сторожевой таймер выходов («кнопку мертвеца»): приложение
+// должно периодически вызывать Heartbeat, иначе указанные каналы переводятся в
+// безопасные значения. Используются безопасные значения каналов
+// (SetChannelFailsafe) и значения safe, переданные при создании; остальные
+// каналы (например, освещение) сохраняют своё состояние.
+type Failsafe struct {
+	pca     *PCA9685
+	timeout time.Duration
+	safe    []PWMValue
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	tripped bool
+	stopped bool
+}
+
+// NewFailsafe создаёт и сразу взводит сторожевой таймер с таймаутом timeout.
+// safe – значения каналов, устанавливаемые при пропуске сигнала (насосы и
+// нагреватели обычно выключаются значением Off: 0).
+func NewFailsafe(pca *PCA9685, timeout time.Duration, safe ...PWMValue) (*Failsafe, error) {
+	if timeout <= 0 {
+		return nil, fmt.Errorf("failsafe timeout must be positive")
+	}
+	for _, v := range safe {
+		if err := pca.validateChannel(v.Channel); err != nil {
+			pca.logger.Error("NewFailsafe: неверный номер канала %d: %v", v.Channel, err)
+			return nil, err
+		}
+	}
+	f := &Failsafe{
+		pca:     pca,
+		timeout: timeout,
+		safe:    append([]PWMValue(nil), safe...),
+	}
+	f.timer = time.AfterFunc(timeout, f.trip)
+	pca.logger.Basic("Failsafe: сторожевой таймер взведён, таймаут %v, каналов %d", timeout, len(safe))
+	return f, nil
+}
+
+// Heartbeat сообщает, что приложение работает, и перезапускает таймер. После
+// срабатывания Heartbeat снова взводит таймер, но не восстанавливает выходы –
+// это остаётся за приложением.
+func (f *Failsafe) Heartbeat() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stopped {
+		return
+	}
+	if f.tripped {
+		f.pca.logger.Basic("Failsafe: сигнал получен после срабатывания, таймер взведён снова")
+		f.tripped = false
+	}
+	f.timer.Reset(f.timeout)
+}
+
+// Tripped сообщает, сработал ли сторожевой таймер после последнего Heartbeat.
+func (f *Failsafe) Tripped() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tripped
+}
+
+// Stop отключает сторожевой таймер.
+func (f *Failsafe) Stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = true
+	f.timer.Stop()
+	f.pca.logger.Basic("Failsafe: сторожевой таймер отключён")
+}
+
+// trip переводит каналы в безопасные значения.
+func (f *Failsafe) trip() {
+	f.mu.Lock()
+	if f.stopped || f.tripped {
+		f.mu.Unlock()
+		return
+	}
+	f.tripped = true
+	f.mu.Unlock()
+
+	f.pca.logger.Error("Failsafe: сигнал Heartbeat не получен за %v, перевод выходов в безопасное состояние", f.timeout)
+	ctx, cancel := context.WithTimeout(f.pca.ctx, f.timeout)
+	defer cancel()
+	if err := f.pca.applyFailsafe(ctx, f.safe); err != nil {
+		f.pca.logger.Error("Failsafe: ошибка установки безопасных значений: %v", err)
+	}
+	f.pca.emit(Event{Type: EventFailsafe, Err: ErrHeartbeatMissed})
+}
+
+// channelFailsafe – безопасное значение канала.
+type channelFailsafe struct {
+	set     bool
+	on, off uint16
+}
+
+// SetChannelFailsafe задаёт безопасное значение канала, которое вместо нуля
+// устанавливается при EmergencyStop, срабатывании Failsafe и Close (например,
+// заслонка в положение 90°, вентилятор на 30%).
+func (pca *PCA9685) SetChannelFailsafe(channel int, on, off uint16) error {
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("SetChannelFailsafe: неверный номер канала %d: %v", channel, err)
+		return err
+	}
+	if err := validatePWM(on, off); err != nil {
+		pca.logger.Error("SetChannelFailsafe: неверное значение канала %d: %v", channel, err)
+		return fmt.Errorf("channel %d: %w", channel, err)
+	}
+	ch := &pca.channels[channel]
+	ch.mu.Lock()
+	ch.failsafe = channelFailsafe{set: true, on: on, off: off}
+	ch.mu.Unlock()
+	pca.logger.Basic("SetChannelFailsafe: канал %d, on=%d, off=%d", channel, on, off)
+	return nil
+}
+
+// ClearChannelFailsafe удаляет безопасное значение канала.
+func (pca *PCA9685) ClearChannelFailsafe(channel int) error {
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("ClearChannelFailsafe: неверный номер канала %d: %v", channel, err)
+		return err
+	}
+	ch := &pca.channels[channel]
+	ch.mu.Lock()
+	ch.failsafe = channelFailsafe{}
+	ch.mu.Unlock()
+	return nil
+}
+
+// ChannelFailsafe возвращает безопасное значение канала; ok равно false,
+// если оно не задано.
+func (pca *PCA9685) ChannelFailsafe(channel int) (on, off uint16, ok bool) {
+	if pca.validateChannel(channel) != nil {
+		return 0, 0, false
+	}
+	ch := &pca.channels[channel]
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.failsafe.on, ch.failsafe.off, ch.failsafe.set
+}
+
+// ApplyFailsafe устанавливает безопасные значения всех каналов, для которых
+// они заданы. Используется, например, после обнаружения сброса микросхемы.
+func (pca *PCA9685) ApplyFailsafe(ctx context.Context) error {
+	pca.logger.Basic("ApplyFailsafe: установка безопасных значений")
+	return pca.applyFailsafe(ctx, nil)
+}
+
+// applyFailsafe устанавливает безопасные значения включённых каналов; значения
+// extra имеют приоритет над заданными через SetChannelFailsafe. Каналы
+// записываются по одному: ошибка записи одного канала не оставляет остальные
+// без безопасных значений. Возвращаются все ошибки (errors.Join).
+func (pca *PCA9685) applyFailsafe(ctx context.Context, extra []PWMValue) error {
+	var safe [16]*PWMValue
+	for i := range pca.channels {
+		ch := &pca.channels[i]
+		ch.mu.RLock()
+		fs, enabled := ch.failsafe, ch.enabled
+		ch.mu.RUnlock()
+		if fs.set && enabled {
+			safe[i] = &PWMValue{Channel: i, On: fs.on, Off: fs.off}
+		}
+	}
+	var errs []error
+	for _, v := range extra {
+		if err := pca.validateChannel(v.Channel); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		v := v
+		safe[v.Channel] = &v
+	}
+	// Безопасные значения выводятся независимо от приоритетов источников.
+	actx := arbitrated(ctx)
+	for _, v := range safe {
+		if v == nil {
+			continue
+		}
+		if err := pca.SetPWM(actx, v.Channel, v.On, v.Off); err != nil {
+			pca.logger.Error("Не удалось установить безопасное значение канала %d: %v", v.Channel, err)
+			errs = append(errs, fmt.Errorf("channel %d: %w", v.Channel, err))
+		}
+	}
+	return errors.Join(errs...)
+}
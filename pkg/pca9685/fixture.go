@@ -0,0 +1,133 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+)
+
+// DMXFixture – периферия с DMX-персональностью: занимает Footprint()
+// последовательных слотов и сама декодирует их значения.
+type DMXFixture interface {
+	// Footprint возвращает число занимаемых слотов DMX.
+	Footprint() int
+	// ApplyDMX применяет значения слотов прибора; len(slots) == Footprint().
+	ApplyDMX(ctx context.Context, slots []byte) error
+}
+
+// dmxFixturePatch – прибор, привязанный к начальному слоту универса.
+type dmxFixturePatch struct {
+	universe uint16
+	start    int
+	fixture  DMXFixture
+}
+
+// dmxLevel декодирует значение из 8-битного или 16-битного (грубый и точный
+// слоты) представления в долю от 0.0 до 1.0.
+func dmxLevel(slots []byte, fine bool) float64 {
+	if fine {
+		return float64(uint16(slots[0])<<8|uint16(slots[1])) / 0xFFFF
+	}
+	return float64(slots[0]) / 0xFF
+}
+
+// dmxWidth возвращает число слотов одного параметра.
+func dmxWidth(fine bool) int {
+	if fine {
+		return 2
+	}
+	return 1
+}
+
+// AddFixture привязывает прибор к универсу, начиная со слота start.
+// Прибор должен целиком помещаться в универс.
+func (m *DMXMapper) AddFixture(universe uint16, start int, fixture DMXFixture) error {
+	if fixture == nil {
+		return fmt.Errorf("fixture must not be nil")
+	}
+	if start < 1 || start+fixture.Footprint()-1 > DMXUniverseSize {
+		return fmt.Errorf("fixture at slot %d with footprint %d does not fit the universe", start, fixture.Footprint())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fixtures = append(m.fixtures, dmxFixturePatch{universe: universe, start: start, fixture: fixture})
+	return nil
+}
+
+// applyFixtures передаёт данные универса приборам, чьи слоты целиком
+// присутствуют в data.
+func (m *DMXMapper) applyFixtures(ctx context.Context, universe uint16, data []byte) error {
+	m.mu.RLock()
+	fixtures := make([]dmxFixturePatch, 0, len(m.fixtures))
+	for _, f := range m.fixtures {
+		if f.universe == universe && f.start-1+f.fixture.Footprint() <= len(data) {
+			fixtures = append(fixtures, f)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, f := range fixtures {
+		end := f.start - 1 + f.fixture.Footprint()
+		if err := f.fixture.ApplyDMX(ctx, data[f.start-1:end]); err != nil {
+			return fmt.Errorf("failed to apply DMX fixture at slot %d: %w", f.start, err)
+		}
+	}
+	return nil
+}
+
+// DMXDimmer – диммерный канал: 1 слот или 2 слота (грубый и точный) при Fine.
+type DMXDimmer struct {
+	Device  *PCA9685
+	Channel int
+	Fine    bool
+}
+
+// Footprint реализует DMXFixture.
+func (d DMXDimmer) Footprint() int { return dmxWidth(d.Fine) }
+
+// ApplyDMX реализует DMXFixture.
+func (d DMXDimmer) ApplyDMX(ctx context.Context, slots []byte) error {
+	value := uint16(dmxLevel(slots, d.Fine)*4095 + 0.5)
+	return d.Device.SetPWM(ctx, d.Channel, 0, value)
+}
+
+// DMXRGB – RGB светодиод: слоты R, G, B (по 2 слота на цвет при Fine).
+// Значения проходят через калибровку, гамму и яркость светодиода.
+type DMXRGB struct {
+	Led  *RGBLed
+	Fine bool
+}
+
+// Footprint реализует DMXFixture.
+func (f DMXRGB) Footprint() int { return 3 * dmxWidth(f.Fine) }
+
+// ApplyDMX реализует DMXFixture.
+func (f DMXRGB) ApplyDMX(ctx context.Context, slots []byte) error {
+	w := dmxWidth(f.Fine)
+	r, g, b := dmxLevel(slots, f.Fine), dmxLevel(slots[w:], f.Fine), dmxLevel(slots[2*w:], f.Fine)
+	l := f.Led
+	l.mu.RLock()
+	values := l.pwmLevels(r, g, b)
+	l.mu.RUnlock()
+	if err := l.pca.SetMultiPWMValues(ctx, values[:]); err != nil {
+		return err
+	}
+	l.tmu.Lock()
+	l.color = [3]uint8{uint8(r*255 + 0.5), uint8(g*255 + 0.5), uint8(b*255 + 0.5)}
+	l.tmu.Unlock()
+	return nil
+}
+
+// DMXServo – сервопривод: значение слота задаёт угол от 0 до полного
+// диапазона калибровки.
+type DMXServo struct {
+	Servo *Servo
+	Fine  bool
+}
+
+// Footprint реализует DMXFixture.
+func (f DMXServo) Footprint() int { return dmxWidth(f.Fine) }
+
+// ApplyDMX реализует DMXFixture.
+func (f DMXServo) ApplyDMX(ctx context.Context, slots []byte) error {
+	return f.Servo.SetAngle(ctx, dmxLevel(slots, f.Fine)*f.Servo.Calibration().Range)
+}
@@ -0,0 +1,250 @@
+package pca9685
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Частоты PWM для типовых применений. Подробности выбора – SuggestFrequency.
+const (
+	// FreqServo50Hz – аналоговые сервоприводы и ESC: период 20 мс, импульс
+	// 1–2 мс занимает около 200 шагов из 4096.
+	FreqServo50Hz = 50.0
+	// FreqLEDFlickerFree – светодиоды: наибольшая частота PCA9685, выше
+	// порога 1250 Гц, при котором по IEEE 1789 мерцание безопасно при любой
+	// глубине модуляции, и без полос на большинстве камер.
+	FreqLEDFlickerFree = 1526.0
+	// FreqFanPWM – вентиляторы и моторы через MOSFET. Стандартные 25 кГц
+	// 4-проводных вентиляторов PCA9685 недоступны; на наибольшей частоте
+	// свист обмоток тише всего, а большинство вентиляторов принимает такой
+	// сигнал управления.
+	FreqFanPWM = 1526.0
+)
+
+// Application – назначение выходов для SuggestFrequency.
+type Application int
+
+const (
+	AppServo Application = iota // Сервоприводы и ESC
+	AppLED                      // Светодиоды
+	AppFan                      // Вентиляторы, моторы и насосы через MOSFET
+)
+
+func (a Application) String() string {
+	switch a {
+	case AppServo:
+		return "servo"
+	case AppLED:
+		return "led"
+	case AppFan:
+		return "fan"
+	default:
+		return fmt.Sprintf("Application(%d)", int(a))
+	}
+}
+
+// FrequencySuggestion – рекомендуемая частота PWM для применения.
+type FrequencySuggestion struct {
+	Application Application
+	Frequency   float64       // Фактическая частота при Prescale (её и передают в SetPWMFreq)
+	Prescale    uint8         // Значение регистра PRE_SCALE
+	Step        time.Duration // Длительность одного шага скважности (1/4096 периода)
+	Tradeoff    string        // Чем оплачен выбор
+}
+
+// SuggestFrequency возвращает рекомендуемую частоту PWM для применения app
+// с фактической частотой, которую даст предделитель PCA9685 (без учёта
+// погрешности внутреннего осциллятора ±5%):
+//
+//   - AppServo – 50 Гц: стандарт аналоговых сервоприводов и ESC; разрешение
+//     импульса около 4.9 мкс, но светодиоды на той же микросхеме будут
+//     заметно мерцать;
+//   - AppLED – 1526 Гц: без видимого мерцания и полос на камерах, но
+//     сервоприводы на этой частоте работать не могут;
+//   - AppFan – 1526 Гц: тише всего для обмоток, хотя 25 кГц 4-проводных
+//     вентиляторов недостижимы; на низкой скорости возможен свист.
+//
+// Так как частота общая для всех 16 каналов, сервоприводы и светодиоды лучше
+// разносить по разным микросхемам (см. NewControllerGroupConfig).
+func SuggestFrequency(app Application) (FrequencySuggestion, error) {
+	var freq float64
+	var tradeoff string
+	switch app {
+	case AppServo:
+		freq = FreqServo50Hz
+		tradeoff = "standard 20 ms servo frame; LEDs on the same chip will flicker"
+	case AppLED:
+		freq = FreqLEDFlickerFree
+		tradeoff = "flicker-free above 1250 Hz; servos cannot be driven at this frequency"
+	case AppFan:
+		freq = FreqFanPWM
+		tradeoff = "25 kHz fan PWM is out of range; highest frequency minimises coil whine"
+	default:
+		return FrequencySuggestion{}, fmt.Errorf("unknown application: %v", app)
+	}
+	prescale, actual := prescaleFor(freq)
+	return FrequencySuggestion{
+		Application: app,
+		Frequency:   actual,
+		Prescale:    prescale,
+		Step:        time.Duration(float64(time.Second) / (actual * PwmResolution)),
+		Tradeoff:    tradeoff,
+	}, nil
+}
+
+// prescaleFor возвращает значение PRE_SCALE для частоты freq и частоту,
+// которую оно даёт.
+func prescaleFor(freq float64) (uint8, float64) {
+	prescale := math.Round(float64(OscClock)/(float64(PwmResolution)*freq)) - 1
+	prescale = math.Max(3, math.Min(255, prescale))
+	return uint8(prescale), float64(OscClock) / (PwmResolution * (prescale + 1))
+}
+
+// Границы частот для проверки периферии.
+const (
+	servoMinFreq   = 40   // ниже многие сервоприводы считают сигнал потерянным
+	servoMaxFreq   = 330  // выше не принимают даже цифровые сервоприводы
+	ledFlickerFreq = 1250 // ниже мерцание заметно (IEEE 1789) и видно на камерах
+)
+
+// ErrFrequencyMismatch – частота PWM не подходит периферии. Конкретную
+// периферию и допустимый диапазон описывает *FrequencyError.
+var ErrFrequencyMismatch = errors.New("PWM frequency does not suit the peripheral")
+
+// FrequencyError описывает несоответствие частоты PWM периферии.
+type FrequencyError struct {
+	Peripheral string        // Периферия, например "servo on channel 0"
+	Frequency  float64       // Проверенная частота, Гц
+	Min, Max   float64       // Подходящий периферии диапазон частот, Гц
+	Pulse      time.Duration // Наибольший импульс сервопривода или ESC; 0 для светодиодов
+}
+
+func (e *FrequencyError) Error() string {
+	switch {
+	case e.Pulse > 0 && time.Duration(float64(time.Second)/e.Frequency) <= e.Pulse:
+		return fmt.Sprintf("%s: %.0f Hz period is shorter than the %v pulse", e.Peripheral, e.Frequency, e.Pulse)
+	case e.Pulse > 0:
+		return fmt.Sprintf("%s: %.0f Hz is outside %.0f-%.0f Hz (use FreqServo50Hz)", e.Peripheral, e.Frequency, e.Min, e.Max)
+	default:
+		return fmt.Sprintf("%s: %.0f Hz is below %.0f Hz, LEDs may flicker (use FreqLEDFlickerFree)", e.Peripheral, e.Frequency, e.Min)
+	}
+}
+
+func (e *FrequencyError) Unwrap() error {
+	return ErrFrequencyMismatch
+}
+
+// blocking сообщает, что периферия на этой частоте не работает или
+// перегревается (сервопривод, ESC), а не только мерцает.
+func (e *FrequencyError) blocking() bool {
+	return e.Pulse > 0
+}
+
+// FrequencyWarnings возвращает предупреждения о несоответствии текущей
+// частоты PWM периферии, занимающей каналы: сервоприводам и ESC нужны
+// 40–330 Гц и период длиннее наибольшего импульса, светодиодам (RGBLed,
+// Segment, GrowLight) – не ниже 1250 Гц. Те же предупреждения пишутся в
+// лог при создании периферии и при смене частоты.
+func (pca *PCA9685) FrequencyWarnings() []string {
+	var warnings []string
+	for _, e := range pca.frequencyIssues(pca.frequency(), nil) {
+		warnings = append(warnings, e.Error())
+	}
+	return warnings
+}
+
+// CheckFrequency проверяет, подходит ли частота freq периферии контроллера,
+// не изменяя её. Возвращает nil или *FrequencyError (несколько – через
+// errors.Join), совместимые с errors.Is(err, ErrFrequencyMismatch).
+func (pca *PCA9685) CheckFrequency(freq float64) error {
+	var errs []error
+	for _, e := range pca.frequencyIssues(freq, nil) {
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
+
+// frequencyIssues проверяет частоту freq для периферии ref или, если ref
+// равен nil, для всей периферии контроллера.
+func (pca *PCA9685) frequencyIssues(freq float64, ref interface{}) []*FrequencyError {
+	if freq <= 0 {
+		return nil
+	}
+	pca.mu.RLock()
+	owners := pca.owners
+	pca.mu.RUnlock()
+
+	var issues []*FrequencyError
+	seen := make(map[interface{}]bool)
+	for _, o := range owners {
+		if o.ref == nil || seen[o.ref] || (ref != nil && o.ref != ref) {
+			continue
+		}
+		seen[o.ref] = true
+		e := &FrequencyError{Peripheral: o.name, Frequency: freq}
+		switch p := o.ref.(type) {
+		case *Servo:
+			p.mu.RLock()
+			e.Pulse = max(p.cal.MinPulse, p.cal.MaxPulse)
+			p.mu.RUnlock()
+		case *ESC:
+			p.mu.RLock()
+			e.Pulse = max(p.cal.MinPulse, p.cal.MaxPulse)
+			p.mu.RUnlock()
+		case *RGBLed, *Segment, *GrowLight:
+			if freq < ledFlickerFreq {
+				e.Min, e.Max = ledFlickerFreq, MaxFrequency
+				issues = append(issues, e)
+			}
+			continue
+		default:
+			continue
+		}
+		e.Min, e.Max = servoMinFreq, servoMaxFreq
+		if limit := float64(time.Second) / float64(e.Pulse); limit < e.Max {
+			e.Max = limit
+		}
+		if freq < servoMinFreq || freq > servoMaxFreq || freq >= e.Max {
+			issues = append(issues, e)
+		}
+	}
+	return issues
+}
+
+// checkPeripheralFrequency проверяет текущую частоту для новой периферии
+// ref. Несоответствие пишется в лог; с Config.StrictFrequency сервопривод
+// или ESC, которым частота не подходит, не создаются.
+func (pca *PCA9685) checkPeripheralFrequency(ref interface{}) error {
+	for _, e := range pca.frequencyIssues(pca.frequency(), ref) {
+		if pca.strictFreq && e.blocking() {
+			return e
+		}
+		pca.logger.Error("Частота PWM не подходит периферии: %v", e)
+	}
+	return nil
+}
+
+// checkFrequencyChange с Config.StrictFrequency запрещает частоту freq, на
+// которой не смогут работать подключённые сервоприводы и ESC.
+func (pca *PCA9685) checkFrequencyChange(freq float64) error {
+	if !pca.strictFreq {
+		return nil
+	}
+	var errs []error
+	for _, e := range pca.frequencyIssues(freq, nil) {
+		if e.blocking() {
+			errs = append(errs, e)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// warnFrequency пишет в лог несоответствия частоты freq периферии ref
+// (nil – всей периферии).
+func (pca *PCA9685) warnFrequency(freq float64, ref interface{}) {
+	for _, e := range pca.frequencyIssues(freq, ref) {
+		pca.logger.Error("Частота PWM не подходит периферии: %v", e)
+	}
+}
@@ -0,0 +1,119 @@
+package pca9685
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DeviceOption переопределяет параметр базовой конфигурации для одного
+// устройства ControllerGroup.
+type DeviceOption func(*Config)
+
+// WithDeviceFreq задаёт частоту PWM устройства (например, 50 Гц для платы
+// сервоприводов в группе со светодиодными платами на 1 кГц).
+func WithDeviceFreq(freq float64) DeviceOption {
+	return func(c *Config) {
+		c.InitialFreq = freq
+	}
+}
+
+// WithDeviceInvert задаёт инверсию выходной логики устройства.
+func WithDeviceInvert(invert bool) DeviceOption {
+	return func(c *Config) {
+		c.InvertLogic = invert
+	}
+}
+
+// WithDeviceOpenDrain задаёт режим выходов устройства: open-drain или
+// двухтактный (totem-pole).
+func WithDeviceOpenDrain(openDrain bool) DeviceOption {
+	return func(c *Config) {
+		c.OpenDrain = openDrain
+	}
+}
+
+// GroupDevice – устройство группы: адаптер и отличия от базовой конфигурации.
+type GroupDevice struct {
+	Dev     I2C
+	Options []DeviceOption
+}
+
+// NewControllerGroupConfig создаёт контроллеры group из общей базовой
+// конфигурации base (nil – DefaultConfig) с настройками каждого устройства и
+// объединяет их в группу. Логгер, журнал, обработчики событий и остальные
+// общие параметры берутся из base, частота, инверсия и режим выходов могут
+// различаться. Если создать устройство не удалось, уже созданные
+// контроллеры закрываются.
+func NewControllerGroupConfig(allCall I2C, base *Config, devices ...GroupDevice) (*ControllerGroup, error) {
+	if base == nil {
+		base = DefaultConfig()
+	}
+	members := make([]*PCA9685, 0, len(devices))
+	for i, d := range devices {
+		cfg := *base
+		for _, opt := range d.Options {
+			opt(&cfg)
+		}
+		pca, err := New(d.Dev, &cfg)
+		if err != nil {
+			errs := []error{fmt.Errorf("device %d: %w", i, err)}
+			for _, m := range members {
+				if cerr := m.Close(); cerr != nil {
+					errs = append(errs, cerr)
+				}
+			}
+			return nil, errors.Join(errs...)
+		}
+		members = append(members, pca)
+	}
+	g := NewControllerGroup(allCall, members...)
+	g.base = base
+	return g, nil
+}
+
+// Configure изменяет частоту, инверсию и режим выходов i-го контроллера
+// группы во время работы. Значения каналов сохраняются.
+func (g *ControllerGroup) Configure(i int, opts ...DeviceOption) error {
+	members := g.list()
+	if i < 0 || i >= len(members) {
+		return fmt.Errorf("controller index %d out of range", i)
+	}
+	pca := members[i]
+	mode2, err := pca.ReadMode2()
+	if err != nil {
+		return fmt.Errorf("controller %d: %w", i, err)
+	}
+	cur := Config{
+		InitialFreq: pca.frequency(),
+		InvertLogic: mode2&Mode2Invrt != 0,
+		OpenDrain:   mode2&Mode2OutDrv == 0,
+	}
+	cfg := cur
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.InvertLogic != cur.InvertLogic || cfg.OpenDrain != cur.OpenDrain {
+		var set, clear byte
+		if cfg.InvertLogic {
+			set |= Mode2Invrt
+		} else {
+			clear |= Mode2Invrt
+		}
+		if cfg.OpenDrain {
+			clear |= Mode2OutDrv
+		} else {
+			set |= Mode2OutDrv
+		}
+		if err := pca.UpdateMode2(set, clear); err != nil {
+			return fmt.Errorf("controller %d: %w", i, err)
+		}
+	}
+	if cfg.InitialFreq != cur.InitialFreq {
+		if err := pca.SetPWMFreq(cfg.InitialFreq); err != nil {
+			return fmt.Errorf("controller %d: %w", i, err)
+		}
+	}
+	pca.logger.Basic("ControllerGroup: контроллер %d: частота %v Гц, инверсия %v, open-drain %v", i, cfg.InitialFreq, cfg.InvertLogic, cfg.OpenDrain)
+	return nil
+}
@@ -0,0 +1,182 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// groupWrite – подготовленная запись соседних каналов одного контроллера.
+type groupWrite struct {
+	pca    *PCA9685
+	run    []PWMValue
+	frame  []byte
+	marked bool
+	reg    uint8
+	data   []byte
+}
+
+// CommitFrame выводит кадр анимации на все контроллеры группы так, чтобы он
+// появился на всех платах практически одновременно. frames[i] – значения
+// каналов контроллера Members()[i]; nil или пустой срез оставляет контроллер
+// без изменений. Сначала для всех плат вычисляются данные записи (с учётом
+// мастер-яркости, ограничений каналов и затемнения), затем записи выполняются
+// подряд без промежуточной работы. Если все платы получают одинаковые данные,
+// а у группы есть адаптер ALLCALL, кадр записывается одной групповой
+// транзакцией. Время от начала первой до конца последней записи возвращает
+// FrameSkew.
+//
+// При ошибке записи кэш обновляется только у контроллеров, запись которых
+// прошла; остальные платы сохраняют предыдущий кадр.
+func (g *ControllerGroup) CommitFrame(ctx context.Context, frames [][]PWMValue) error {
+	members := g.list()
+	if len(frames) > len(members) {
+		return fmt.Errorf("got frames for %d controllers, group has %d", len(frames), len(members))
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	sorted := make([][]PWMValue, len(frames))
+	for i, values := range frames {
+		if len(values) == 0 {
+			continue
+		}
+		pca := members[i]
+		sorted[i] = append([]PWMValue(nil), values...)
+		sort.Slice(sorted[i], func(a, b int) bool { return sorted[i][a].Channel < sorted[i][b].Channel })
+		for j, v := range sorted[i] {
+			if err := pca.validateChannel(v.Channel); err != nil {
+				pca.logger.Error("CommitFrame: неверный номер канала %d: %v", v.Channel, err)
+				return fmt.Errorf("controller %d: %w", i, err)
+			}
+			if err := validatePWM(v.On, v.Off); err != nil {
+				pca.logger.Error("CommitFrame: неверное значение канала %d: %v", v.Channel, err)
+				return fmt.Errorf("controller %d: channel %d: %w", i, v.Channel, err)
+			}
+			if j > 0 && sorted[i][j-1].Channel == v.Channel {
+				return fmt.Errorf("controller %d: channel %d is set twice", i, v.Channel)
+			}
+		}
+	}
+
+	// Каналы захватываются по возрастанию номера, контроллеры – в порядке группы.
+	for i, values := range sorted {
+		for _, v := range values {
+			members[i].channels[v.Channel].mu.Lock()
+		}
+	}
+	defer func() {
+		for i, values := range sorted {
+			for _, v := range values {
+				members[i].channels[v.Channel].mu.Unlock()
+			}
+		}
+	}()
+
+	var writes []groupWrite
+	for i, values := range sorted {
+		pca := members[i]
+		burst := pca.caps.burstChannels()
+		for start := 0; start < len(values); {
+			n := 1
+			for n < burst && start+n < len(values) && values[start+n].Channel == values[start].Channel+n {
+				n++
+			}
+			w := groupWrite{pca: pca, run: values[start : start+n], frame: make([]byte, 5*n)}
+			if err := pca.fillFrame(ctx, "CommitFrame", w.run, w.frame[:4*n]); err != nil {
+				return fmt.Errorf("controller %d: %w", i, err)
+			}
+			w.marked = pca.markBlackout(w.frame[:4*n])
+			w.reg, w.data = pca.chip.ledFrame(w.run[0].Channel, w.frame[:4*n], w.frame[4*n:])
+			writes = append(writes, w)
+			start += n
+		}
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+
+	begin := time.Now()
+	done, err := g.issue(ctx, members, writes)
+	skew := time.Since(begin)
+	g.mu.Lock()
+	g.skew = skew
+	g.mu.Unlock()
+
+	for j, w := range writes {
+		werr := err
+		if j < done {
+			w.pca.commitFrame(w.run, w.frame, w.marked)
+			werr = nil
+		}
+		if w.pca.journal != nil {
+			for _, v := range w.run {
+				w.pca.record(ctx, JournalEntry{Op: "CommitFrame", Channel: v.Channel, On: v.On, Off: v.Off}, werr)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	writes[0].pca.logger.Detailed("CommitFrame: %d записей на %d контроллеров за %v", len(writes), len(members), skew)
+	return nil
+}
+
+// issue выполняет подготовленные записи подряд и возвращает число
+// выполненных. Если все контроллеры группы получают одинаковые данные, кадр
+// записывается через адаптер ALLCALL.
+func (g *ControllerGroup) issue(ctx context.Context, members []*PCA9685, writes []groupWrite) (int, error) {
+	if shared := g.sharedWrites(members, writes); shared != nil {
+		for _, w := range shared {
+			if err := g.allCall.WriteReg(w.reg, w.data); err != nil {
+				for i, pca := range members {
+					if i == 0 {
+						pca.logger.Error("CommitFrame: не удалось выполнить групповую запись: %v", err)
+					}
+					pca.reportError("CommitFrame", w.run[0].Channel, err)
+				}
+				return 0, fmt.Errorf("failed to write ALLCALL: %w", err)
+			}
+			now := time.Now()
+			for _, pca := range members {
+				pca.observeWrite(now, w.reg, w.data)
+			}
+		}
+		return len(writes), nil
+	}
+	for j, w := range writes {
+		first := w.run[0].Channel
+		if err := w.pca.writeReg(ctx, "CommitFrame", first, w.reg, w.data); err != nil {
+			w.pca.logger.Error("CommitFrame: не удалось записать каналы %d–%d: %v", first, first+len(w.run)-1, err)
+			return j, fmt.Errorf("failed to set PWM for channels %d-%d: %w", first, first+len(w.run)-1, err)
+		}
+	}
+	return len(writes), nil
+}
+
+// sharedWrites возвращает записи первого контроллера, если у группы есть
+// адаптер ALLCALL и все контроллеры получают те же записи, иначе nil.
+func (g *ControllerGroup) sharedWrites(members []*PCA9685, writes []groupWrite) []groupWrite {
+	if g.allCall == nil || len(members) < 2 || len(writes)%len(members) != 0 {
+		return nil
+	}
+	per := len(writes) / len(members)
+	for i, pca := range members {
+		for j := 0; j < per; j++ {
+			w, ref := writes[i*per+j], writes[j]
+			if w.pca != pca || w.reg != ref.reg || string(w.data) != string(ref.data) {
+				return nil
+			}
+		}
+	}
+	return writes[:per]
+}
+
+// FrameSkew возвращает время от начала первой до конца последней записи
+// последнего CommitFrame – окно, в которое кадр попал на все платы.
+func (g *ControllerGroup) FrameSkew() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.skew
+}
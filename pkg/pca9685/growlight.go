@@ -0,0 +1,163 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// GrowLightConfig содержит настройки фитосветильника.
+type GrowLightConfig struct {
+	Channels    []int         // Каналы светильника (управляются одинаково)
+	Photoperiod Photoperiod   // Световой день с линейными рассветом и закатом
+	MaxPPFD     float64       // PPFD на уровне растений при 100% мощности, мкмоль/м²/с
+	TargetDLI   float64       // Целевой дневной световой интеграл, моль/м²/сутки (0 – без ограничения)
+	Ambient     ValueSource   // Необязательный датчик внешнего освещения, PPFD в мкмоль/м²/с
+	Interval    time.Duration // Период обновления (по умолчанию 1 минута)
+}
+
+// GrowLight управляет фитосветильником: фотопериод, плавные рассвет и закат,
+// а также поддержание целевого DLI с учётом внешнего освещения.
+type GrowLight struct {
+	pca *PCA9685
+	cfg GrowLightConfig
+
+	mu       sync.RWMutex
+	dli      float64
+	level    float64
+	lastTick time.Time
+	lit      bool
+}
+
+// NewGrowLight создаёт контроллер фитосветильника.
+func NewGrowLight(pca *PCA9685, cfg GrowLightConfig) (*GrowLight, error) {
+	pca.logger.Detailed("Создание фитосветильника на каналах: %v", cfg.Channels)
+	if len(cfg.Channels) == 0 {
+		pca.logger.Error("NewGrowLight: не заданы каналы")
+		return nil, fmt.Errorf("at least one channel is required")
+	}
+	for _, ch := range cfg.Channels {
+		if err := pca.validateChannel(ch); err != nil {
+			pca.logger.Error("NewGrowLight: неверный номер канала %d: %v", ch, err)
+			return nil, err
+		}
+	}
+	if err := cfg.Photoperiod.Validate(); err != nil {
+		pca.logger.Error("NewGrowLight: неверный фотопериод: %v", err)
+		return nil, err
+	}
+	if cfg.TargetDLI < 0 || (cfg.TargetDLI > 0 && cfg.MaxPPFD <= 0) {
+		pca.logger.Error("NewGrowLight: неверные параметры DLI: target=%v, maxPPFD=%v", cfg.TargetDLI, cfg.MaxPPFD)
+		return nil, fmt.Errorf("DLI control requires positive MaxPPFD and non-negative TargetDLI")
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	cfg.Channels = append([]int(nil), cfg.Channels...)
+
+	g := &GrowLight{pca: pca, cfg: cfg}
+	if err := pca.claimChannels(g, fmt.Sprintf("grow light on channels %v", cfg.Channels), cfg.Channels...); err != nil {
+		pca.logger.Error("NewGrowLight: каналы недоступны: %v", err)
+		return nil, err
+	}
+	if err := pca.EnableChannels(cfg.Channels...); err != nil {
+		pca.releaseChannels(g, cfg.Channels...)
+		pca.logger.Error("NewGrowLight: не удалось включить каналы: %v", err)
+		return nil, fmt.Errorf("failed to enable channels: %w", err)
+	}
+	pca.warnFrequency(pca.frequency(), g)
+	return g, nil
+}
+
+// Release освобождает каналы светильника.
+func (g *GrowLight) Release() {
+	g.pca.releaseChannels(g, g.cfg.Channels...)
+}
+
+// DLI возвращает накопленный за текущий световой день интеграл, моль/м².
+func (g *GrowLight) DLI() float64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.dli
+}
+
+// Level возвращает текущую мощность светильника (от 0.0 до 1.0).
+func (g *GrowLight) Level() float64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.level
+}
+
+// Run обновляет светильник с заданным периодом до отмены контекста.
+func (g *GrowLight) Run(ctx context.Context) error {
+	g.pca.logger.Basic("Фитосветильник: запуск")
+	ticker := time.NewTicker(g.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := g.Update(ctx, time.Now()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			g.pca.logger.Basic("Фитосветильник: остановка")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Update пересчитывает и применяет мощность светильника на момент now.
+func (g *GrowLight) Update(ctx context.Context, now time.Time) error {
+	ambient := 0.0
+	if g.cfg.Ambient != nil {
+		v, err := g.cfg.Ambient.Value(ctx)
+		if err != nil {
+			// Без датчика считаем, что внешнего света нет.
+			g.pca.logger.Error("Фитосветильник: ошибка чтения датчика освещённости: %v", err)
+		} else {
+			ambient = math.Max(0, v)
+		}
+	}
+
+	g.mu.Lock()
+	ramp := g.cfg.Photoperiod.Level(now)
+	remaining := g.cfg.Photoperiod.Remaining(now)
+
+	// Накопление DLI за прошедший интервал; обнуление в начале светового дня.
+	if ramp > 0 && !g.lit {
+		g.dli = 0
+	} else if g.lit && !g.lastTick.IsZero() {
+		dt := now.Sub(g.lastTick).Seconds()
+		g.dli += (g.level*g.cfg.MaxPPFD + ambient) * dt / 1e6
+	}
+	g.lit = ramp > 0
+	g.lastTick = now
+
+	level := ramp
+	if g.cfg.TargetDLI > 0 {
+		need := 0.0
+		if left := g.cfg.TargetDLI - g.dli; left > 0 && remaining > 0 {
+			need = left * 1e6 / remaining.Seconds()
+		}
+		// Внешнего света достаточно – лампа приостанавливается.
+		lamp := math.Max(0, need-ambient)
+		level = math.Min(ramp, lamp/g.cfg.MaxPPFD)
+	}
+	g.level = level
+	dli := g.dli
+	g.mu.Unlock()
+
+	value := uint16(math.Round(level * 4095))
+	settings := make(map[int]struct{ On, Off uint16 }, len(g.cfg.Channels))
+	for _, ch := range g.cfg.Channels {
+		settings[ch] = struct{ On, Off uint16 }{0, value}
+	}
+	g.pca.logger.Detailed("Фитосветильник: мощность %.2f, DLI %.2f моль/м², внешний свет %.0f", level, dli, ambient)
+	if err := g.pca.SetMultiPWM(ctx, settings); err != nil {
+		g.pca.logger.Error("Фитосветильник: ошибка установки мощности: %v", err)
+		return err
+	}
+	return nil
+}
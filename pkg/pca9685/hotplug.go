@@ -0,0 +1,258 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Reinitialize повторно настраивает микросхему после пропадания питания или
+// переподключения платы: как и New, выполняет сброс, записывает MODE2 и
+// частоту PWM из текущей конфигурации контроллера, затем записывает все
+// каналы из кэша. Затемнение BlackoutAll, действовавшее до потери связи,
+// восстанавливается вместо записи каналов. Режим сна, в который микросхему
+// перевёл драйвер, сохраняется.
+func (pca *PCA9685) Reinitialize(ctx context.Context) error {
+	pca.logger.Basic("Reinitialize: повторная инициализация устройства")
+	err := pca.reinitialize(ctx)
+	pca.record(ctx, JournalEntry{Op: "Reinitialize", Channel: -1}, err)
+	if err != nil {
+		pca.logger.Error("Reinitialize: %v", err)
+	}
+	return err
+}
+
+func (pca *PCA9685) reinitialize(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := pca.Reset(); err != nil {
+		return fmt.Errorf("failed to reset device: %w", err)
+	}
+	mode2 := byte(pca.mode2.Load())
+	if err := pca.writeReg(ctx, "Reinitialize", -1, RegMode2, []byte{mode2}); err != nil {
+		return fmt.Errorf("failed to configure MODE2: %w", err)
+	}
+	if pca.chip.fixedFrequency() > 0 {
+		if err := pca.initFixed(); err != nil {
+			return err
+		}
+	} else if err := pca.setPWMFreq(pca.frequency()); err != nil {
+		return fmt.Errorf("failed to set frequency: %w", err)
+	}
+
+	pca.mu.Lock()
+	defer pca.mu.Unlock()
+	if pca.blackout.Load() {
+		return pca.blackoutLocked(ctx, "Reinitialize")
+	}
+	pca.lockChannels()
+	defer pca.unlockChannels()
+	return pca.rewriteChannels(ctx, "Reinitialize")
+}
+
+// probe проверяет, что микросхема отвечает и не сбрасывалась. Чтение не
+// передаётся в Config.OnError: недоступность платы обрабатывает Watch.
+// Сброс питания PCA9685 распознаётся по снятому биту AI регистра MODE1,
+// который драйвер всегда устанавливает.
+func (pca *PCA9685) probe(ctx context.Context) (reset bool, err error) {
+	data := make([]byte, 1)
+	if err := pca.doRead(ctx, RegMode1, data); err != nil {
+		return false, err
+	}
+	return pca.chip == ChipPCA9685 && data[0]&Mode1AutoInc == 0, nil
+}
+
+// Add добавляет контроллер в работающую группу, например плату, появившуюся
+// на шине. Контроллеру назначаются мастер-яркость группы и адрес ALLCALL,
+// если он был задан EnableAllCall. Новый контроллер получает следующий
+// индекс Members и CommitFrame.
+func (g *ControllerGroup) Add(ctx context.Context, pca *PCA9685) error {
+	g.membersMu.RLock()
+	addr := g.allCallAddr
+	g.membersMu.RUnlock()
+	for _, m := range g.list() {
+		if m == pca {
+			return fmt.Errorf("controller is already in the group")
+		}
+	}
+	if level := g.Master(); level != 1 {
+		if err := pca.setGroupMaster(ctx, level); err != nil {
+			return err
+		}
+	}
+	if addr >= 0 {
+		if err := enableAllCall(pca, uint8(addr)); err != nil {
+			return err
+		}
+	}
+
+	g.membersMu.Lock()
+	defer g.membersMu.Unlock()
+	for _, m := range g.members {
+		if m == pca {
+			return fmt.Errorf("controller is already in the group")
+		}
+	}
+	members := make([]*PCA9685, len(g.members), len(g.members)+1)
+	copy(members, g.members)
+	g.members = append(members, pca)
+	pca.logger.Basic("Контроллер добавлен в группу (%d устройств)", len(g.members))
+	return nil
+}
+
+// AddDevice создаёт контроллер на адаптере dev из базовой конфигурации
+// группы (NewControllerGroupConfig; для NewControllerGroup – DefaultConfig)
+// с настройками opts и добавляет его в группу. Если добавить контроллер не
+// удалось, он закрывается.
+func (g *ControllerGroup) AddDevice(ctx context.Context, dev I2C, opts ...DeviceOption) (*PCA9685, error) {
+	base := g.base
+	if base == nil {
+		base = DefaultConfig()
+	}
+	cfg := *base
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	pca, err := New(dev, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.Add(ctx, pca); err != nil {
+		pca.Close()
+		return nil, err
+	}
+	return pca, nil
+}
+
+// Remove исключает контроллер из группы, например после окончательного
+// отключения платы. Контроллер не закрывается, мастер-яркость группы у него
+// сохраняется. Индексы следующих контроллеров в Members и CommitFrame
+// сдвигаются. Возвращает false, если контроллера нет в группе.
+func (g *ControllerGroup) Remove(pca *PCA9685) bool {
+	g.membersMu.Lock()
+	defer g.membersMu.Unlock()
+	for i, m := range g.members {
+		if m != pca {
+			continue
+		}
+		members := make([]*PCA9685, 0, len(g.members)-1)
+		members = append(members, g.members[:i]...)
+		g.members = append(members, g.members[i+1:]...)
+		delete(g.offline, pca)
+		pca.logger.Basic("Контроллер исключён из группы (%d устройств)", len(g.members))
+		return true
+	}
+	return false
+}
+
+// Offline возвращает контроллеры группы, которые по данным Watch сейчас не
+// отвечают на шине.
+func (g *ControllerGroup) Offline() []*PCA9685 {
+	g.membersMu.RLock()
+	defer g.membersMu.RUnlock()
+	var offline []*PCA9685
+	for _, pca := range g.members {
+		if g.offline[pca] {
+			offline = append(offline, pca)
+		}
+	}
+	return offline
+}
+
+// Watch с периодом interval опрашивает контроллеры группы до отмены ctx.
+// Контроллер, переставший отвечать, отмечается недоступным (Offline), о чём
+// сообщает событие EventDeviceLost в его Config.OnEvent. Когда плата снова
+// отвечает, Watch повторно инициализирует её (Reinitialize), восстанавливает
+// адрес ALLCALL группы и отправляет EventDeviceRestored; при неудаче попытка
+// повторяется на следующем опросе. Плата, потерявшая питание между опросами,
+// обнаруживается по сбросу регистров и восстанавливается так же. Записи в
+// недоступный контроллер по-прежнему возвращают ошибки (или накапливаются в
+// деградированном режиме), а кэш каналов после восстановления выводится
+// заново.
+func (g *ControllerGroup) Watch(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("watch interval must be positive")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		g.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll выполняет один опрос контроллеров группы.
+func (g *ControllerGroup) poll(ctx context.Context) {
+	for _, pca := range g.list() {
+		if ctx.Err() != nil {
+			return
+		}
+		reset, err := pca.probe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		g.membersMu.RLock()
+		lost, addr := g.offline[pca], g.allCallAddr
+		g.membersMu.RUnlock()
+
+		if err != nil {
+			if !lost {
+				pca.logger.Error("Watch: контроллер не отвечает: %v", err)
+				g.setOffline(pca, true)
+				pca.emit(Event{Type: EventDeviceLost, Channel: -1, Err: err})
+			}
+			continue
+		}
+		if !lost && !reset {
+			continue
+		}
+		if !lost {
+			pca.logger.Error("Watch: обнаружен сброс контроллера")
+		}
+		if err := g.restore(ctx, pca, addr); err != nil {
+			if !lost {
+				g.setOffline(pca, true)
+				pca.emit(Event{Type: EventDeviceLost, Channel: -1, Err: err})
+			}
+			continue
+		}
+		g.setOffline(pca, false)
+		pca.logger.Basic("Watch: контроллер снова доступен")
+		pca.emit(Event{Type: EventDeviceRestored, Channel: -1})
+	}
+}
+
+// restore повторно инициализирует вернувшийся контроллер.
+func (g *ControllerGroup) restore(ctx context.Context, pca *PCA9685, addr int) error {
+	if err := pca.Reinitialize(ctx); err != nil {
+		return err
+	}
+	if addr >= 0 {
+		if err := enableAllCall(pca, uint8(addr)); err != nil {
+			pca.logger.Error("Watch: не удалось восстановить адрес ALLCALL: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *ControllerGroup) setOffline(pca *PCA9685, offline bool) {
+	g.membersMu.Lock()
+	defer g.membersMu.Unlock()
+	if !offline {
+		delete(g.offline, pca)
+		return
+	}
+	// Контроллер мог быть исключён из группы во время опроса.
+	for _, m := range g.members {
+		if m == pca {
+			g.offline[pca] = true
+			return
+		}
+	}
+}
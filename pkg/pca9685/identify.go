@@ -0,0 +1,206 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// IdentifyPath – путь, по которому принято подключать IdentifyHandler.
+const IdentifyPath = "/pca9685/identify"
+
+// Параметры мигания Identify.
+const (
+	defaultIdentifyDuration = 5 * time.Second
+	maxIdentifyDuration     = time.Minute
+)
+
+// identifyPattern – двойная вспышка с паузой: такой ритм легко отличить от
+// мерцания эффектов и от обычного включения.
+var identifyPattern = []struct {
+	lit bool
+	d   time.Duration
+}{
+	{true, 150 * time.Millisecond},
+	{false, 150 * time.Millisecond},
+	{true, 150 * time.Millisecond},
+	{false, 550 * time.Millisecond},
+}
+
+// Identify мигает каналом в течение duration (двойная вспышка полной
+// яркостью раз в секунду), чтобы монтажник нашёл выход, подключённый к
+// каналу, а затем возвращает каналу прежнее значение. Отмена ctx досрочно
+// завершает мигание и ошибкой не считается. Identify блокирует до окончания
+// мигания; одновременные Identify или Pulse того же канала отклоняются.
+//
+// Мигание и возврат выполняются без арбитража источников (SetSourcePriority)
+// и не записываются в журнал покадрово. Каналы сервоприводов, ESC и насосов
+// не мигают: полная скважность для них опасна.
+func (pca *PCA9685) Identify(ctx context.Context, channel int, duration time.Duration) error {
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("Identify: неверный номер канала %d: %v", channel, err)
+		return err
+	}
+	pca.mu.RLock()
+	owner := pca.owners[channel]
+	pca.mu.RUnlock()
+	if err := identifySafe(owner.ref, owner.name); err != nil {
+		pca.logger.Error("Identify: %v", err)
+		return err
+	}
+	return pca.identify(ctx, []int{channel}, duration)
+}
+
+// IdentifyPeripheral мигает всеми каналами светодиодной периферии p
+// (RGBLed, Segment, GrowLight) одновременно, как Identify.
+func (pca *PCA9685) IdentifyPeripheral(ctx context.Context, p Peripheral, duration time.Duration) error {
+	var channels []int
+	var name string
+	pca.mu.RLock()
+	for ch, o := range pca.owners {
+		if o.ref == p {
+			channels = append(channels, ch)
+			name = o.name
+		}
+	}
+	pca.mu.RUnlock()
+	if len(channels) == 0 {
+		return fmt.Errorf("peripheral has no channels on this controller")
+	}
+	if err := identifySafe(p, name); err != nil {
+		pca.logger.Error("Identify: %v", err)
+		return err
+	}
+	return pca.identify(ctx, channels, duration)
+}
+
+// identifySafe проверяет, можно ли мигать каналами периферии ref.
+func identifySafe(ref interface{}, name string) error {
+	switch ref.(type) {
+	case nil, *RGBLed, *Segment, *GrowLight:
+		return nil
+	}
+	return fmt.Errorf("cannot identify %s: blinking at full duty is unsafe", name)
+}
+
+func (pca *PCA9685) identify(ctx context.Context, channels []int, duration time.Duration) error {
+	if duration <= 0 || duration > maxIdentifyDuration {
+		return fmt.Errorf("identify duration must be between 0 and %v", maxIdentifyDuration)
+	}
+	for i, c := range channels {
+		if !pca.channels[c].pulsing.CompareAndSwap(false, true) {
+			for _, prev := range channels[:i] {
+				pca.channels[prev].pulsing.Store(false)
+			}
+			return fmt.Errorf("pulse or identify already in progress on channel %d", c)
+		}
+	}
+	defer func() {
+		for _, c := range channels {
+			pca.channels[c].pulsing.Store(false)
+		}
+	}()
+
+	saved := make([]PWMValue, len(channels))
+	lit := make([]PWMValue, len(channels))
+	dark := make([]PWMValue, len(channels))
+	for i, c := range channels {
+		_, on, off := pca.channels[c].snapshot()
+		saved[i] = PWMValue{Channel: c, On: on, Off: off}
+		lit[i] = PWMValue{Channel: c, On: FullOn}
+		dark[i] = PWMValue{Channel: c}
+	}
+	pca.logger.Basic("Identify: мигание каналов %v в течение %v", channels, duration)
+
+	wctx := arbitrated(pca.quiet(ctx))
+	deadline := time.Now().Add(duration)
+	var err error
+	for i := 0; err == nil; i++ {
+		step := identifyPattern[i%len(identifyPattern)]
+		values := dark
+		if step.lit {
+			values = lit
+		}
+		if err = pca.SetMultiPWMValues(wctx, values); err != nil {
+			break
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		timer := time.NewTimer(min(step.d, remaining))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if ctx.Err() != nil {
+		err = nil
+	}
+
+	restoreCtx := ctx
+	if ctx.Err() != nil {
+		restoreCtx = pca.ctx
+	}
+	if rerr := pca.SetMultiPWMValues(arbitrated(pca.quiet(restoreCtx)), saved); rerr != nil {
+		pca.logger.Error("Identify: не удалось вернуть каналы %v в исходное значение: %v", channels, rerr)
+		err = errors.Join(err, fmt.Errorf("failed to restore channels after identify: %w", rerr))
+	}
+	for _, c := range channels {
+		pca.record(ctx, JournalEntry{Op: "Identify", Channel: c, Value: duration.Seconds()}, err)
+	}
+	return err
+}
+
+// IdentifyHandler возвращает обработчик HTTP, запускающий Identify:
+// POST с параметрами channel (номер канала) и duration (длительность в
+// формате time.ParseDuration, по умолчанию 5 с, не более минуты). Мигание
+// выполняется в фоне с контекстом контроллера, ответ 202 Accepted
+// отправляется сразу; ошибки мигания пишутся в лог.
+//
+//	http.Handle(pca9685.IdentifyPath, pca.IdentifyHandler())
+//	// curl -X POST 'http://host/pca9685/identify?channel=3&duration=10s'
+func (pca *PCA9685) IdentifyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		channel, err := strconv.Atoi(r.FormValue("channel"))
+		if err != nil || pca.validateChannel(channel) != nil {
+			http.Error(w, "invalid channel", http.StatusBadRequest)
+			return
+		}
+		duration := defaultIdentifyDuration
+		if s := r.FormValue("duration"); s != "" {
+			if duration, err = time.ParseDuration(s); err != nil || duration <= 0 || duration > maxIdentifyDuration {
+				http.Error(w, "invalid duration", http.StatusBadRequest)
+				return
+			}
+		}
+		pca.mu.RLock()
+		owner := pca.owners[channel]
+		pca.mu.RUnlock()
+		if err := identifySafe(owner.ref, owner.name); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if pca.channels[channel].pulsing.Load() {
+			http.Error(w, "channel is busy", http.StatusConflict)
+			return
+		}
+		ctx := WithSource(pca.ctx, "http:"+r.RemoteAddr)
+		go func() {
+			if err := pca.Identify(ctx, channel, duration); err != nil {
+				pca.logger.Error("IdentifyHandler: канал %d: %v", channel, err)
+			}
+		}()
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
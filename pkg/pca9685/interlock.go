@@ -0,0 +1,94 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrInterlocked возвращается, если насос не может быть запущен, пока
+// работает другой насос той же группы блокировки.
+var ErrInterlocked = errors.New("another pump of the interlock group is running")
+
+// InterlockMode определяет поведение SetSpeed, если другой насос группы работает.
+type InterlockMode int
+
+const (
+	// InterlockFail – SetSpeed сразу возвращает ErrInterlocked.
+	InterlockFail InterlockMode = iota
+	// InterlockQueue – SetSpeed ждёт остановки работающего насоса
+	// (или отмены контекста).
+	InterlockQueue
+)
+
+// PumpInterlock – группа взаимной блокировки: насосы группы никогда не
+// работают одновременно (например, дозаторы с общим коллектором).
+type PumpInterlock struct {
+	name string
+	mode InterlockMode
+
+	mu       sync.Mutex
+	owner    *Pump
+	released chan struct{}
+}
+
+// NewPumpInterlock создаёт группу блокировки с именем name.
+func NewPumpInterlock(name string, mode InterlockMode) *PumpInterlock {
+	return &PumpInterlock{name: name, mode: mode}
+}
+
+// Active возвращает работающий насос группы или nil.
+func (g *PumpInterlock) Active() *Pump {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.owner
+}
+
+// acquire закрепляет группу за насосом p. held сообщает, был ли насос
+// владельцем группы до вызова.
+func (g *PumpInterlock) acquire(ctx context.Context, p *Pump) (held bool, err error) {
+	for {
+		g.mu.Lock()
+		switch g.owner {
+		case p:
+			g.mu.Unlock()
+			return true, nil
+		case nil:
+			g.owner = p
+			g.released = make(chan struct{})
+			g.mu.Unlock()
+			return false, nil
+		}
+		if g.mode == InterlockFail {
+			owner := g.owner.channel
+			g.mu.Unlock()
+			return false, fmt.Errorf("%w: group %q, pump on channel %d", ErrInterlocked, g.name, owner)
+		}
+		released := g.released
+		g.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// release освобождает группу, если она закреплена за насосом p.
+func (g *PumpInterlock) release(p *Pump) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.owner == p {
+		g.owner = nil
+		close(g.released)
+	}
+}
+
+// WithInterlock включает насос в группу взаимной блокировки.
+func WithInterlock(g *PumpInterlock) PumpOption {
+	return func(p *Pump) {
+		p.interlock = g
+	}
+}
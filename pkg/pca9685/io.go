@@ -0,0 +1,217 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ContextI2C – необязательное расширение интерфейса I2C для адаптеров,
+// поддерживающих отмену транзакции через контекст. Если адаптер реализует
+// этот интерфейс, дедлайн IOTimeout передаётся ему через контекст.
+type ContextI2C interface {
+	WriteRegContext(ctx context.Context, reg uint8, data []byte) error
+	ReadRegContext(ctx context.Context, reg uint8, data []byte) error
+}
+
+// WriteReader – необязательное расширение интерфейса I2C для адаптеров,
+// выполняющих запись и чтение одной транзакцией с повторным START. Драйвер
+// читает регистры через WriteRead, поэтому между записью указателя регистра
+// и чтением не может вклиниться транзакция другого устройства на той же шине.
+type WriteReader interface {
+	WriteRead(w, r []byte) error
+}
+
+// I2CCapabilities описывает возможности адаптера, от которых зависит способ
+// записи регистров.
+type I2CCapabilities struct {
+	// MaxTransfer – наибольшая длина данных одной записи в байтах (без адреса
+	// регистра); 0 – без ограничения. Пакетная запись соседних каналов
+	// выполняется, только если в одну запись помещается больше одного канала.
+	MaxTransfer int
+	// CombinedWriteRead – чтение регистра выполняется одной транзакцией с
+	// повторным START. Без этого запись указателя и чтение – отдельные
+	// транзакции, и общую шину нужно защищать SharedBus.
+	CombinedWriteRead bool
+	// TenBitAddress – адаптер поддерживает 10-битные адреса устройств.
+	TenBitAddress bool
+}
+
+// CapableI2C – необязательное расширение интерфейса I2C, сообщающее
+// возможности адаптера. Для адаптеров без этого интерфейса драйвер
+// предполагает наиболее осторожный вариант: один канал на запись и
+// раздельные запись указателя и чтение.
+type CapableI2C interface {
+	Capabilities() I2CCapabilities
+}
+
+// capabilitiesOf возвращает возможности адаптера dev.
+func capabilitiesOf(dev I2C) I2CCapabilities {
+	if c, ok := dev.(CapableI2C); ok {
+		return c.Capabilities()
+	}
+	_, combined := dev.(WriteReader)
+	return I2CCapabilities{MaxTransfer: 4, CombinedWriteRead: combined}
+}
+
+// readRegister читает регистр адаптера dev, по возможности одной
+// комбинированной транзакцией.
+func readRegister(dev I2C, reg uint8, data []byte) error {
+	wr, ok := dev.(WriteReader)
+	if !ok {
+		return dev.ReadReg(reg, data)
+	}
+	pooled, w := acquireFrame(1)
+	defer releaseFrame(pooled)
+	w[0] = reg
+	return wr.WriteRead(w, data)
+}
+
+// burstChannels возвращает, сколько соседних каналов помещается в одну
+// запись (не больше 16).
+func (c I2CCapabilities) burstChannels() int {
+	if c.MaxTransfer <= 0 || c.MaxTransfer >= 4*16 {
+		return 16
+	}
+	return c.MaxTransfer / 4
+}
+
+// ErrIOTimeout возвращается, если транзакция I2C не завершилась за IOTimeout.
+var ErrIOTimeout = errors.New("i2c transaction timed out")
+
+// writeReg выполняет запись в регистр с учётом IOTimeout. op и channel
+// (-1, если операция не относится к каналу) передаются в Config.OnError.
+func (pca *PCA9685) writeReg(ctx context.Context, op string, channel int, reg uint8, data []byte) error {
+	if pca.degraded != nil {
+		return pca.writeDegraded(ctx, op, channel, reg, data)
+	}
+	return pca.reportError(op, channel, pca.writeVerified(ctx, op, channel, reg, data))
+}
+
+// readReg выполняет чтение регистра с учётом IOTimeout.
+func (pca *PCA9685) readReg(ctx context.Context, op string, channel int, reg uint8, data []byte) error {
+	return pca.reportError(op, channel, pca.doRead(ctx, reg, data))
+}
+
+// reportError передаёт ошибку операции I2C в обработчик OnError.
+func (pca *PCA9685) reportError(op string, channel int, err error) error {
+	if err != nil && pca.onError != nil {
+		pca.onError(op, channel, err)
+	}
+	return err
+}
+
+// doWrite выполняет транзакцию записи и учитывает её в счётчиках,
+// гистограмме задержки и трассировке.
+func (pca *PCA9685) doWrite(ctx context.Context, reg uint8, data []byte) error {
+	pca.counters.writes.Add(1)
+	start := time.Now()
+	err := pca.transferWrite(ctx, reg, data)
+	d := time.Since(start)
+	pca.latency.write.observe(d)
+	if t := pca.tracer(); t != nil {
+		t.record(start, d, TraceWrite, reg, data, err)
+	}
+	if err == nil {
+		pca.observeWrite(start.Add(d), reg, data)
+	}
+	return pca.countError(err)
+}
+
+// doRead выполняет транзакцию чтения и учитывает её в счётчиках,
+// гистограмме задержки и трассировке.
+func (pca *PCA9685) doRead(ctx context.Context, reg uint8, data []byte) error {
+	pca.counters.reads.Add(1)
+	start := time.Now()
+	err := pca.transferRead(ctx, reg, data)
+	d := time.Since(start)
+	pca.latency.read.observe(d)
+	if t := pca.tracer(); t != nil {
+		t.record(start, d, TraceRead, reg, data, err)
+	}
+	return pca.countError(err)
+}
+
+func (pca *PCA9685) countError(err error) error {
+	if err != nil {
+		pca.counters.errors.Add(1)
+	}
+	return err
+}
+
+func (pca *PCA9685) transferWrite(ctx context.Context, reg uint8, data []byte) error {
+	if d := pca.dryDevice(); d != nil {
+		return d.WriteReg(reg, data)
+	}
+	if pca.ioTimeout <= 0 {
+		if pca.ctxDev != nil {
+			return pca.ctxDev.WriteRegContext(ctx, reg, data)
+		}
+		return pca.dev.WriteReg(reg, data)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, pca.ioTimeout)
+	defer cancel()
+	var err error
+	if pca.ctxDev != nil {
+		err = pca.ctxDev.WriteRegContext(tctx, reg, data)
+	} else {
+		// Буфер копируется: зависшая запись не должна видеть последующие изменения.
+		// Копию возвращает в пул сама операция, когда адаптер её завершит.
+		pooled, buf := acquireFrame(len(data))
+		copy(buf, data)
+		err = awaitIO(tctx, func() error {
+			defer releaseFrame(pooled)
+			return pca.dev.WriteReg(reg, buf)
+		})
+	}
+	return pca.ioError(ctx, err)
+}
+
+func (pca *PCA9685) transferRead(ctx context.Context, reg uint8, data []byte) error {
+	if d := pca.dryDevice(); d != nil {
+		return d.ReadReg(reg, data)
+	}
+	if pca.ioTimeout <= 0 {
+		if pca.ctxDev != nil {
+			return pca.ctxDev.ReadRegContext(ctx, reg, data)
+		}
+		return readRegister(pca.dev, reg, data)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, pca.ioTimeout)
+	defer cancel()
+	if pca.ctxDev != nil {
+		return pca.ioError(ctx, pca.ctxDev.ReadRegContext(tctx, reg, data))
+	}
+	buf := make([]byte, len(data))
+	err := awaitIO(tctx, func() error { return readRegister(pca.dev, reg, buf) })
+	if err == nil {
+		copy(data, buf)
+	}
+	return pca.ioError(ctx, err)
+}
+
+// ioError превращает истечение IOTimeout в ErrIOTimeout. Отмена внешнего
+// контекста возвращается без изменений.
+func (pca *PCA9685) ioError(parent context.Context, err error) error {
+	if err != nil && errors.Is(err, context.DeadlineExceeded) && parent.Err() == nil {
+		pca.logger.Error("Транзакция I2C не завершилась за %v", pca.ioTimeout)
+		return fmt.Errorf("%w after %v", ErrIOTimeout, pca.ioTimeout)
+	}
+	return err
+}
+
+// awaitIO выполняет блокирующую операцию адаптера, не дожидаясь её дольше,
+// чем позволяет контекст. Зависшая операция продолжает выполняться в фоне.
+func awaitIO(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,218 @@
+package pca9685
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Источники команд.
+const (
+	SourceAPI = "api" // По умолчанию
+	SourceDMX = "dmx" // DMXMapper, если источник не задан в контексте
+)
+
+// JournalEntry – запись журнала изменений: одна команда для одного канала
+// (или для устройства целиком, если Channel равен -1).
+type JournalEntry struct {
+	Time    time.Time `json:"time"`
+	Source  string    `json:"source"`            // api, mqtt, scheduler:<задание>, rule:<правило> и т.п.
+	Op      string    `json:"op"`                // Имя метода контроллера
+	Channel int       `json:"channel"`           // Номер канала или -1
+	On      uint16    `json:"on"`                // Заданные значения канала
+	Off     uint16    `json:"off"`               //
+	Value   float64   `json:"value,omitempty"`   // Частота, мастер-яркость или длительность плавного изменения, с
+	OK      bool      `json:"ok"`                // Результат команды
+	Error   string    `json:"error,omitempty"`   // Текст ошибки, если команда не выполнена
+	DryRun  bool      `json:"dry_run,omitempty"` // Команда выполнена в пробном режиме (SetDryRun)
+}
+
+type sourceKey struct{}
+
+type quietKey struct{}
+
+// WithSource возвращает контекст, команды с которым записываются в журнал с
+// источником source. Транспорты (MQTT, HTTP) и планировщики помечают им
+// контекст перед вызовом методов контроллера.
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// hasSource сообщает, задан ли источник команды в контексте.
+func hasSource(ctx context.Context) bool {
+	_, ok := ctx.Value(sourceKey{}).(string)
+	return ok
+}
+
+// SourceFromContext возвращает источник команды из контекста (по умолчанию SourceAPI).
+func SourceFromContext(ctx context.Context) string {
+	if s, ok := ctx.Value(sourceKey{}).(string); ok {
+		return s
+	}
+	return SourceAPI
+}
+
+// WithoutJournal возвращает контекст, команды с которым не записываются в
+// журнал. Используется для отдельных кадров анимаций, когда в журнал уже
+// записана команда, запустившая анимацию.
+func WithoutJournal(ctx context.Context) context.Context {
+	return context.WithValue(ctx, quietKey{}, true)
+}
+
+// Journal – журнал изменений состояния, записываемый построчно в формате
+// JSON только на добавление. Позволяет выяснить, кто и когда изменил канал
+// (например, почему насос включился в 03:00).
+type Journal struct {
+	mu      sync.Mutex
+	w       io.Writer
+	file    *os.File // файл журнала, открытый OpenJournal
+	path    string
+	maxSize int64
+	backups int
+	size    int64
+}
+
+// JournalOption определяет опцию журнала, открытого OpenJournal.
+type JournalOption func(*Journal)
+
+// WithJournalMaxSize задаёт размер файла, при превышении которого журнал
+// ротируется (по умолчанию 10 МиБ; 0 – без ротации).
+func WithJournalMaxSize(bytes int64) JournalOption {
+	return func(j *Journal) {
+		if bytes >= 0 {
+			j.maxSize = bytes
+		}
+	}
+}
+
+// WithJournalBackups задаёт число хранимых ротированных файлов path.1 …
+// path.N (по умолчанию 3).
+func WithJournalBackups(n int) JournalOption {
+	return func(j *Journal) {
+		if n >= 0 {
+			j.backups = n
+		}
+	}
+}
+
+// NewJournal создаёт журнал, записывающий в w. Ротация не выполняется.
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{w: w}
+}
+
+// OpenJournal открывает файл журнала path для добавления записей.
+func OpenJournal(path string, opts ...JournalOption) (*Journal, error) {
+	j := &Journal{path: path, maxSize: 10 << 20, backups: 3}
+	for _, opt := range opts {
+		opt(j)
+	}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) open() error {
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	j.file, j.w, j.size = f, f, info.Size()
+	return nil
+}
+
+// Record добавляет запись в журнал. Нулевое время заменяется текущим.
+func (j *Journal) Record(e JournalEntry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.w == nil {
+		return fmt.Errorf("journal is closed")
+	}
+	if j.file != nil && j.maxSize > 0 && j.size > 0 && j.size+int64(len(line)) > j.maxSize {
+		if err := j.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := j.w.Write(line)
+	j.size += int64(n)
+	return err
+}
+
+// rotate переименовывает path в path.1, сдвигая старые файлы, и открывает
+// новый файл. Вызывается с захваченным j.mu.
+func (j *Journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("failed to rotate journal: %w", err)
+	}
+	j.file, j.w = nil, nil
+	if j.backups == 0 {
+		os.Remove(j.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", j.path, j.backups))
+		for i := j.backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", j.path, i), fmt.Sprintf("%s.%d", j.path, i+1))
+		}
+		if err := os.Rename(j.path, j.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate journal: %w", err)
+		}
+	}
+	return j.open()
+}
+
+// Close закрывает файл журнала, открытый OpenJournal. Журнал поверх
+// io.Writer не закрывает его.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.w = nil
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// record записывает команду в журнал контроллера, если он задан и контекст
+// не помечен WithoutJournal.
+func (pca *PCA9685) record(ctx context.Context, e JournalEntry, err error) {
+	if pca.journal == nil || ctx.Value(quietKey{}) != nil {
+		return
+	}
+	e.Source = SourceFromContext(ctx)
+	e.OK = err == nil
+	e.DryRun = pca.DryRun()
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if jerr := pca.journal.Record(e); jerr != nil {
+		pca.logger.Error("Не удалось записать команду %s в журнал: %v", e.Op, jerr)
+	}
+}
+
+// quiet возвращает контекст для кадров анимации: при включённом журнале
+// кадры не записываются, так как записана сама команда.
+func (pca *PCA9685) quiet(ctx context.Context) context.Context {
+	if pca.journal == nil {
+		return ctx
+	}
+	return WithoutJournal(ctx)
+}
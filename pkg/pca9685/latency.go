@@ -0,0 +1,173 @@
+package pca9685
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Операции, для которых измеряется задержка.
+const (
+	LatencyWrite = "write" // Транзакция записи I2C
+	LatencyRead  = "read"  // Транзакция чтения I2C
+	LatencyFrame = "frame" // Кадр Renderer целиком: сборка слоёв и запись
+)
+
+// latencyBounds – верхние границы корзин гистограммы. Последняя корзина
+// гистограммы не ограничена сверху.
+var latencyBounds = [...]time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	200 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// LatencyBucket – корзина гистограммы: число измерений не длиннее Le
+// (без накопления по предыдущим корзинам). У последней корзины Le равно 0
+// – она принимает всё, что длиннее предыдущей границы.
+type LatencyBucket struct {
+	Le    time.Duration `json:"le"`
+	Count uint64        `json:"count"`
+}
+
+// LatencyHistogram – распределение задержки одной операции контроллера.
+type LatencyHistogram struct {
+	Adapter string          `json:"adapter"` // Тип адаптера, например I2CAdapterD2r2
+	Op      string          `json:"op"`      // LatencyWrite, LatencyRead или LatencyFrame
+	Count   uint64          `json:"count"`
+	Sum     time.Duration   `json:"sum"`
+	Min     time.Duration   `json:"min"`
+	Max     time.Duration   `json:"max"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// Mean возвращает среднюю задержку.
+func (h LatencyHistogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile возвращает оценку квантиля q (0…1) – верхнюю границу корзины, в
+// которую он попадает, но не больше Max. Например, Quantile(0.99) для
+// LatencyWrite показывает, укладываются ли записи в период кадра анимации.
+func (h LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.Count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for _, b := range h.Buckets {
+		seen += b.Count
+		if seen >= rank {
+			if b.Le == 0 || b.Le > h.Max {
+				return h.Max
+			}
+			return b.Le
+		}
+	}
+	return h.Max
+}
+
+// String возвращает краткую сводку, например
+// "I2CAdapterD2r2 write: n=120 mean=410µs p50=500µs p99=1ms max=1.2ms".
+func (h LatencyHistogram) String() string {
+	return fmt.Sprintf("%s %s: n=%d mean=%v p50=%v p99=%v max=%v",
+		h.Adapter, h.Op, h.Count, h.Mean(), h.Quantile(0.5), h.Quantile(0.99), h.Max)
+}
+
+// latencyHist – гистограмма задержки с атомарными счётчиками, пригодная для
+// обновления без блокировок из горячего пути ввода-вывода.
+type latencyHist struct {
+	count   atomic.Uint64
+	sum     atomic.Int64
+	min     atomic.Int64 // 0 – измерений ещё не было
+	max     atomic.Int64
+	buckets [len(latencyBounds) + 1]atomic.Uint64
+}
+
+func (h *latencyHist) observe(d time.Duration) {
+	if d <= 0 {
+		d = 1
+	}
+	i := 0
+	for i < len(latencyBounds) && d > latencyBounds[i] {
+		i++
+	}
+	h.buckets[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+	for {
+		cur := h.min.Load()
+		if cur != 0 && cur <= int64(d) || h.min.CompareAndSwap(cur, int64(d)) {
+			break
+		}
+	}
+	for {
+		cur := h.max.Load()
+		if cur >= int64(d) || h.max.CompareAndSwap(cur, int64(d)) {
+			break
+		}
+	}
+}
+
+func (h *latencyHist) snapshot(adapter, op string) LatencyHistogram {
+	s := LatencyHistogram{
+		Adapter: adapter,
+		Op:      op,
+		Buckets: make([]LatencyBucket, len(h.buckets)),
+	}
+	for i := range h.buckets {
+		s.Buckets[i].Count = h.buckets[i].Load()
+		s.Count += s.Buckets[i].Count
+		if i < len(latencyBounds) {
+			s.Buckets[i].Le = latencyBounds[i]
+		}
+	}
+	s.Sum = time.Duration(h.sum.Load())
+	s.Min = time.Duration(h.min.Load())
+	s.Max = time.Duration(h.max.Load())
+	return s
+}
+
+// latencies – гистограммы задержки контроллера по типам операций.
+type latencies struct {
+	write, read, frame latencyHist
+}
+
+// Latency возвращает гистограммы задержки транзакций записи и чтения
+// (измеряются вокруг вызова адаптера, включая IOTimeout и повторы шины) и
+// кадров Renderer (сборка слоёв и запись целиком). Сравнение задержки кадра
+// с суммой задержек его записей показывает, что ограничивает частоту кадров
+// анимации: медленная шина или накладные расходы драйвера. Гистограммы
+// подписаны типом адаптера, поэтому сводки нескольких контроллеров можно
+// объединять по адаптерам.
+func (pca *PCA9685) Latency() []LatencyHistogram {
+	adapter := adapterName(pca.dev)
+	return []LatencyHistogram{
+		pca.latency.write.snapshot(adapter, LatencyWrite),
+		pca.latency.read.snapshot(adapter, LatencyRead),
+		pca.latency.frame.snapshot(adapter, LatencyFrame),
+	}
+}
+
+// adapterName возвращает имя типа адаптера без пакета и указателя.
+func adapterName(dev I2C) string {
+	name := fmt.Sprintf("%T", dev)
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimLeft(name, "*")
+}
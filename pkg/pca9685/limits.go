@@ -0,0 +1,107 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetChannelLimits ограничивает длительность импульса канала диапазоном
+// [min, max] тиков (от 0 до 4096). Ограничение применяется при каждой записи
+// в устройство независимо от того, каким методом задано значение, после
+// мастер-яркости. Полностью выключенный канал (нулевой импульс) разрешён
+// всегда, чтобы Off и EmergencyStop продолжали работать; ненулевой импульс
+// короче min увеличивается до min. Кэш канала хранит запрошенное значение.
+func (pca *PCA9685) SetChannelLimits(channel int, min, max uint16) error {
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("SetChannelLimits: неверный номер канала %d: %v", channel, err)
+		return err
+	}
+	if max > PwmResolution || min > max {
+		err := fmt.Errorf("invalid channel limits: min %d, max %d", min, max)
+		pca.logger.Error("SetChannelLimits: %v", err)
+		return err
+	}
+	pca.logger.Basic("SetChannelLimits: канал %d ограничен диапазоном %d..%d", channel, min, max)
+	return pca.setLimits(channel, channelLimits{set: true, min: min, max: max})
+}
+
+// ClearChannelLimits снимает ограничения длительности импульса канала.
+func (pca *PCA9685) ClearChannelLimits(channel int) error {
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("ClearChannelLimits: неверный номер канала %d: %v", channel, err)
+		return err
+	}
+	pca.logger.Basic("ClearChannelLimits: ограничения канала %d сняты", channel)
+	return pca.setLimits(channel, channelLimits{})
+}
+
+// ChannelLimits возвращает ограничения канала; ok равно false, если
+// ограничения не заданы.
+func (pca *PCA9685) ChannelLimits(channel int) (min, max uint16, ok bool) {
+	if pca.validateChannel(channel) != nil {
+		return 0, 0, false
+	}
+	ch := &pca.channels[channel]
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.limits.min, ch.limits.max, ch.limits.set
+}
+
+// channelLimits – ограничения длительности импульса канала.
+type channelLimits struct {
+	set      bool
+	min, max uint16
+}
+
+// setLimits сохраняет ограничения и сразу применяет их к текущему значению.
+func (pca *PCA9685) setLimits(channel int, limits channelLimits) error {
+	ch := &pca.channels[channel]
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.limits = limits
+	if !ch.enabled {
+		return nil
+	}
+	return pca.writeChannel(context.Background(), "SetChannelLimits", channel, ch.on, ch.off)
+}
+
+// hasLimits сообщает, ограничен ли хотя бы один канал.
+func (pca *PCA9685) hasLimits() bool {
+	for i := range pca.channels {
+		ch := &pca.channels[i]
+		ch.mu.RLock()
+		set := ch.limits.set
+		ch.mu.RUnlock()
+		if set {
+			return true
+		}
+	}
+	return false
+}
+
+// clamp приводит длительность импульса on/off к диапазону ограничений,
+// сохраняя фазу начала импульса.
+func (l channelLimits) clamp(on, off uint16) (uint16, uint16) {
+	if !l.set {
+		return on, off
+	}
+	width := pulseTicks(on, off)
+	switch {
+	case width == 0:
+		return on, off
+	case width < int(l.min):
+		width = int(l.min)
+	case width > int(l.max):
+		width = int(l.max)
+	default:
+		return on, off
+	}
+	phase := on & 0x0FFF
+	switch width {
+	case 0:
+		return 0, 0x1000
+	case PwmResolution:
+		return phase | 0x1000, 0
+	}
+	return phase, uint16((int(phase) + width) % PwmResolution)
+}
@@ -20,6 +20,22 @@ type Logger interface {
 	Error(msg string, args ...interface{})
 }
 
+// detailedReporter – необязательный интерфейс логгера, сообщающий, выводит ли он
+// подробные сообщения. Драйвер использует его, чтобы не формировать аргументы
+// подробных сообщений в часто вызываемых методах.
+type detailedReporter interface {
+	DetailedEnabled() bool
+}
+
+// detailedEnabled возвращает false, только если логгер явно сообщает, что
+// подробные сообщения отключены.
+func detailedEnabled(l Logger) bool {
+	if r, ok := l.(detailedReporter); ok {
+		return r.DetailedEnabled()
+	}
+	return true
+}
+
 type defaultLogger struct {
 	level LogLevel
 }
@@ -33,6 +49,11 @@ func (l *defaultLogger) Basic(msg string, args ...interface{}) {
 	log.Printf("[INFO] "+msg, args...)
 }
 
+// DetailedEnabled сообщает, выводятся ли подробные сообщения.
+func (l *defaultLogger) DetailedEnabled() bool {
+	return l.level >= LogLevelDetailed
+}
+
 func (l *defaultLogger) Detailed(msg string, args ...interface{}) {
 	if l.level >= LogLevelDetailed {
 		log.Printf("[DEBUG] "+msg, args...)
@@ -0,0 +1,321 @@
+package pca9685
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaintenanceKind – счётчик, по которому наступает срок обслуживания.
+type MaintenanceKind int
+
+const (
+	// MaintenancePumpHours – часы работы насоса (время с ненулевой скоростью).
+	MaintenancePumpHours MaintenanceKind = iota
+	// MaintenanceLEDHours – часы работы светодиодов (время, когда включён
+	// хотя бы один канал светильника).
+	MaintenanceLEDHours
+	// MaintenanceServoCycles – ходы сервопривода: перемещения с изменением
+	// направления. Плавное движение из множества шагов считается одним ходом.
+	MaintenanceServoCycles
+)
+
+func (k MaintenanceKind) String() string {
+	switch k {
+	case MaintenancePumpHours:
+		return "pump hours"
+	case MaintenanceLEDHours:
+		return "LED hours"
+	case MaintenanceServoCycles:
+		return "servo cycles"
+	default:
+		return fmt.Sprintf("MaintenanceKind(%d)", int(k))
+	}
+}
+
+// MaintenanceStatus – состояние счётчика обслуживания периферии.
+type MaintenanceStatus struct {
+	Name       string          `json:"name"`       // Работа, например "replace dosing tube"
+	Peripheral string          `json:"peripheral"` // Описание периферии, как в ChannelOwner
+	Channels   []int           `json:"channels"`
+	Kind       MaintenanceKind `json:"kind"`
+	Value      float64         `json:"value"`     // Часы или ходы с последнего обслуживания
+	Threshold  float64         `json:"threshold"` // Срок обслуживания в тех же единицах
+	Since      time.Time       `json:"since"`     // Начало отсчёта (SetMaintenance или ResetMaintenance)
+	Due        bool            `json:"due"`       // Срок обслуживания наступил
+}
+
+// maintenanceItem – счётчик обслуживания в учёте dutyTracker.
+type maintenanceItem struct {
+	ref    interface{}
+	status MaintenanceStatus
+	mask   uint16  // каналы периферии
+	last   float64 // последняя ненулевая скважность сервопривода
+	dir    int     // направление последнего хода сервопривода
+}
+
+// MaintenanceOption определяет опцию SetMaintenance.
+type MaintenanceOption func(*MaintenanceStatus)
+
+// WithMaintenanceValue задаёт начальное значение счётчика, например
+// сохранённое до перезапуска программы (MaintenanceStatus.Value).
+func WithMaintenanceValue(value float64) MaintenanceOption {
+	return func(s *MaintenanceStatus) {
+		if value >= 0 {
+			s.Value = value
+		}
+	}
+}
+
+// WithMaintenanceSince задаёт время последнего обслуживания, сохранённое до
+// перезапуска программы (MaintenanceStatus.Since).
+func WithMaintenanceSince(t time.Time) MaintenanceOption {
+	return func(s *MaintenanceStatus) {
+		s.Since = t
+	}
+}
+
+// SetMaintenance задаёт срок обслуживания name периферии p: threshold часов
+// работы для Pump (MaintenancePumpHours), для RGBLed, Segment и GrowLight
+// (MaintenanceLEDHours) или ходов для Servo (MaintenanceServoCycles). Одной
+// периферии можно задать несколько работ с разными именами; повторный вызов
+// с тем же именем меняет срок, сохраняя счётчик.
+//
+// Счётчики ведутся по фактическому выходу каналов (см. DutyStats) и
+// проверяются при каждой записи в микросхему и каждом запросе статистики.
+// Когда счётчик достигает срока, генерируется событие EventMaintenanceDue, а
+// работа отмечается в Maintenance и в ChannelState.Maintenance каналов
+// периферии до вызова ResetMaintenance. Счётчики хранятся в памяти: чтобы
+// они пережили перезапуск, сохраняйте Maintenance и восстанавливайте
+// опциями WithMaintenanceValue и WithMaintenanceSince.
+func (pca *PCA9685) SetMaintenance(p Peripheral, name string, threshold float64, opts ...MaintenanceOption) error {
+	if name == "" {
+		return fmt.Errorf("maintenance name must not be empty")
+	}
+	if threshold <= 0 {
+		return fmt.Errorf("maintenance threshold must be positive")
+	}
+	var kind MaintenanceKind
+	switch p.(type) {
+	case *Pump:
+		kind = MaintenancePumpHours
+	case *RGBLed, *Segment, *GrowLight:
+		kind = MaintenanceLEDHours
+	case *Servo:
+		kind = MaintenanceServoCycles
+	default:
+		return fmt.Errorf("maintenance is not supported for %T", p)
+	}
+	if pca.duty == nil {
+		return fmt.Errorf("duty accounting is not available")
+	}
+
+	pca.mu.RLock()
+	item := &maintenanceItem{ref: p, status: MaintenanceStatus{Name: name, Kind: kind, Threshold: threshold}}
+	for ch, o := range pca.owners {
+		if o.ref == p {
+			item.mask |= 1 << ch
+			item.status.Channels = append(item.status.Channels, ch)
+			item.status.Peripheral = o.name
+		}
+	}
+	pca.mu.RUnlock()
+	if item.mask == 0 {
+		return fmt.Errorf("peripheral has no channels on this controller")
+	}
+
+	pca.duty.addMaintenance(item, opts, time.Now())
+	pca.logger.Basic("SetMaintenance: %s – %q через %v (%v)", item.status.Peripheral, name, threshold, kind)
+	return nil
+}
+
+// ResetMaintenance отмечает выполнение работы name периферии p: счётчик
+// обнуляется, а отметка о наступившем сроке снимается.
+func (pca *PCA9685) ResetMaintenance(p Peripheral, name string) error {
+	if pca.duty == nil || !pca.duty.resetMaintenance(p, name, time.Now()) {
+		return fmt.Errorf("no maintenance %q for this peripheral", name)
+	}
+	pca.logger.Basic("ResetMaintenance: работа %q выполнена", name)
+	return nil
+}
+
+// ClearMaintenance удаляет срок обслуживания name периферии p. Возвращает
+// false, если его не было.
+func (pca *PCA9685) ClearMaintenance(p Peripheral, name string) bool {
+	return pca.duty != nil && pca.duty.clearMaintenance(p, name)
+}
+
+// Maintenance возвращает состояние всех сроков обслуживания в порядке их
+// задания.
+func (pca *PCA9685) Maintenance() []MaintenanceStatus {
+	if pca.duty == nil {
+		return nil
+	}
+	return pca.duty.maintenance(time.Now(), false)
+}
+
+// MaintenanceDue возвращает работы, срок которых наступил.
+func (pca *PCA9685) MaintenanceDue() []MaintenanceStatus {
+	if pca.duty == nil {
+		return nil
+	}
+	return pca.duty.maintenance(time.Now(), true)
+}
+
+// maintenanceDue сообщает о наступлении срока обслуживания.
+func (pca *PCA9685) maintenanceDue(s MaintenanceStatus) {
+	pca.logger.Error("Требуется обслуживание: %s – %q (%.0f из %.0f, %v)", s.Peripheral, s.Name, s.Value, s.Threshold, s.Kind)
+	pca.emit(Event{Type: EventMaintenanceDue, Channel: s.Channels[0], Channels: s.Channels, Name: s.Name})
+}
+
+func (t *dutyTracker) addMaintenance(item *maintenanceItem, opts []MaintenanceOption, now time.Time) {
+	t.mu.Lock()
+	defer t.unlock()
+	t.advance(now)
+	for _, it := range t.maint {
+		if it.ref == item.ref && it.status.Name == item.status.Name {
+			it.status.Threshold = item.status.Threshold
+			it.status.Due = false
+			for _, opt := range opts {
+				opt(&it.status)
+			}
+			t.checkDue(it)
+			return
+		}
+	}
+	item.status.Since = now
+	item.last = t.channels[item.status.Channels[0]].duty
+	for _, opt := range opts {
+		opt(&item.status)
+	}
+	t.maint = append(t.maint, item)
+	t.checkDue(item)
+}
+
+func (t *dutyTracker) resetMaintenance(ref interface{}, name string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.unlock()
+	t.advance(now)
+	for _, it := range t.maint {
+		if it.ref == ref && it.status.Name == name {
+			it.status.Value, it.status.Due, it.status.Since = 0, false, now
+			it.dir = 0
+			return true
+		}
+	}
+	return false
+}
+
+func (t *dutyTracker) clearMaintenance(ref interface{}, name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, it := range t.maint {
+		if it.ref == ref && it.status.Name == name {
+			t.maint = append(t.maint[:i:i], t.maint[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// maintenance возвращает копии состояний сроков (только наступившие, если
+// dueOnly).
+func (t *dutyTracker) maintenance(now time.Time, dueOnly bool) []MaintenanceStatus {
+	t.mu.Lock()
+	defer t.unlock()
+	t.advance(now)
+	var list []MaintenanceStatus
+	for _, it := range t.maint {
+		if dueOnly && !it.status.Due {
+			continue
+		}
+		s := it.status
+		s.Channels = append([]int(nil), s.Channels...)
+		list = append(list, s)
+	}
+	return list
+}
+
+// dueFor возвращает имена работ с наступившим сроком у периферии канала ch.
+func (t *dutyTracker) dueFor(ch int, now time.Time) []string {
+	t.mu.Lock()
+	defer t.unlock()
+	t.advance(now)
+	var names []string
+	for _, it := range t.maint {
+		if it.status.Due && it.mask&(1<<ch) != 0 {
+			names = append(names, it.status.Name)
+		}
+	}
+	return names
+}
+
+// advanceMaintenance добавляет dt секунд к счётчикам часов работы.
+// Вызывается из advance.
+func (t *dutyTracker) advanceMaintenance(dt float64) {
+	for _, it := range t.maint {
+		if it.status.Kind == MaintenanceServoCycles {
+			continue
+		}
+		for ch := range t.channels {
+			if it.mask&(1<<ch) != 0 && t.channels[ch].duty > 0 {
+				it.status.Value += dt / 3600
+				t.checkDue(it)
+				break
+			}
+		}
+	}
+}
+
+// countStrokes учитывает ходы сервоприводов при смене скважностей на
+// duties. Вызывается из observe до обновления скважностей.
+func (t *dutyTracker) countStrokes(duties *[16]float64) {
+	for _, it := range t.maint {
+		if it.status.Kind != MaintenanceServoCycles {
+			continue
+		}
+		ch := it.status.Channels[0]
+		next := duties[ch]
+		switch {
+		case next == 0:
+			// Без импульса сервопривод не удерживает положение.
+			it.dir = 0
+		case it.last > 0 && next != it.last:
+			dir := 1
+			if next < it.last {
+				dir = -1
+			}
+			if dir != it.dir {
+				it.dir = dir
+				it.status.Value++
+				t.checkDue(it)
+			}
+		}
+		if next > 0 {
+			it.last = next
+		}
+	}
+}
+
+// checkDue отмечает наступление срока обслуживания it.
+func (t *dutyTracker) checkDue(it *maintenanceItem) {
+	if it.status.Due || it.status.Value < it.status.Threshold {
+		return
+	}
+	it.status.Due = true
+	s := it.status
+	s.Channels = append([]int(nil), s.Channels...)
+	t.fired = append(t.fired, s)
+}
+
+// unlock освобождает t.mu и сообщает о наступивших сроках обслуживания вне
+// блокировки.
+func (t *dutyTracker) unlock() {
+	fired := t.fired
+	t.fired = nil
+	t.mu.Unlock()
+	if t.onDue != nil {
+		for _, s := range fired {
+			t.onDue(s)
+		}
+	}
+}
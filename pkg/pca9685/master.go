@@ -0,0 +1,163 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// scalePWM уменьшает длительность импульса on/off в level раз, сохраняя
+// фазу начала импульса. Флаг «полностью выключен» не изменяется, а импульс,
+// после округления занимающий весь период, остаётся полностью включённым.
+func scalePWM(on, off uint16, level float64) (uint16, uint16) {
+	if level >= 1 || off&0x1000 != 0 {
+		return on, off
+	}
+	var width int
+	if on&0x1000 != 0 {
+		// Полностью включённый канал соответствует импульсу на весь период.
+		on &= 0x0FFF
+		width = PwmResolution
+	} else {
+		width = (int(off) - int(on) + PwmResolution) % PwmResolution
+	}
+	w := int(math.Round(float64(width) * level))
+	if w >= PwmResolution {
+		return FullOn, 0
+	}
+	return on, uint16((int(on) + w) % PwmResolution)
+}
+
+// scaleChannel применяет мастер-яркость level к значению канала channel.
+// Каналы сервоприводов, ESC и насосов не масштабируются: мастер-яркость
+// изменила бы положение и скорость, а не яркость.
+func (pca *PCA9685) scaleChannel(channel int, on, off uint16, level float64) (uint16, uint16) {
+	if pca.undimmed.Load()&(1<<channel) != 0 {
+		return on, off
+	}
+	return scalePWM(on, off, level)
+}
+
+// masterLevel возвращает итоговый множитель мастер-яркости.
+func (pca *PCA9685) masterLevel() float64 {
+	return math.Float64frombits(pca.level.Load())
+}
+
+// Master возвращает мастер-яркость устройства (от 0.0 до 1.0).
+func (pca *PCA9685) Master() float64 {
+	pca.mu.RLock()
+	defer pca.mu.RUnlock()
+	return pca.master
+}
+
+// SetMaster задаёт мастер-яркость устройства (от 0.0 до 1.0). Множитель
+// применяется ко всем каналам, кроме каналов сервоприводов, ESC и насосов,
+// после яркости периферии и не изменяет
+// сохранённые значения каналов: при возврате к 1.0 восстанавливаются
+// исходные значения.
+func (pca *PCA9685) SetMaster(ctx context.Context, level float64) error {
+	if !(level >= 0 && level <= 1) {
+		pca.logger.Error("SetMaster: неверное значение %v", level)
+		return fmt.Errorf("master level must be between 0 and 1")
+	}
+	pca.logger.Detailed("SetMaster: мастер-яркость %.3f", level)
+	pca.mu.Lock()
+	pca.master = level
+	pca.level.Store(math.Float64bits(pca.master * pca.groupMaster))
+	pca.mu.Unlock()
+	err := pca.refreshChannels(ctx)
+	pca.record(ctx, JournalEntry{Op: "SetMaster", Channel: -1, Value: level}, err)
+	return err
+}
+
+// FadeMaster плавно изменяет мастер-яркость устройства до level за duration.
+func (pca *PCA9685) FadeMaster(ctx context.Context, level float64, duration time.Duration, opts ...FadeOption) error {
+	if !(level >= 0 && level <= 1) {
+		pca.logger.Error("FadeMaster: неверное значение %v", level)
+		return fmt.Errorf("master level must be between 0 and 1")
+	}
+	pca.logger.Basic("FadeMaster: изменение мастер-яркости до %.3f за %v", level, duration)
+	start := pca.Master()
+	steps := pca.fadeConfig(opts).steps(duration)
+	begin := time.Now()
+	fctx := pca.quiet(ctx)
+	pca.fadeEvent(EventFadeStarted, "FadeMaster", nil, nil)
+	err := runFade(fctx, steps, duration, func(step int) error {
+		return pca.SetMaster(fctx, start+(level-start)*float64(step)/float64(steps))
+	})
+	pca.fadeEvent(EventFadeCompleted, "FadeMaster", nil, err)
+	pca.record(ctx, JournalEntry{Time: begin, Op: "FadeMaster", Channel: -1, Value: level}, err)
+	return err
+}
+
+// setGroupMaster задаёт множитель группы, в которую входит устройство.
+func (pca *PCA9685) setGroupMaster(ctx context.Context, level float64) error {
+	pca.mu.Lock()
+	pca.groupMaster = level
+	pca.level.Store(math.Float64bits(pca.master * pca.groupMaster))
+	pca.mu.Unlock()
+	return pca.refreshChannels(ctx)
+}
+
+// refreshChannels перезаписывает все включённые каналы с текущей мастер-яркостью.
+func (pca *PCA9685) refreshChannels(ctx context.Context) error {
+	for i := range pca.channels {
+		ch := &pca.channels[i]
+		ch.mu.Lock()
+		var err error
+		if ch.enabled {
+			err = pca.writeChannel(ctx, "SetMaster", i, ch.on, ch.off)
+		}
+		ch.mu.Unlock()
+		if err != nil {
+			pca.logger.Error("SetMaster: не удалось обновить канал %d: %v", i, err)
+			return fmt.Errorf("failed to refresh channel %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Master возвращает мастер-яркость группы (от 0.0 до 1.0).
+func (g *ControllerGroup) Master() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.master
+}
+
+// SetMaster задаёт мастер-яркость группы. Она умножается на мастер-яркость
+// каждого устройства группы.
+func (g *ControllerGroup) SetMaster(ctx context.Context, level float64) error {
+	if !(level >= 0 && level <= 1) {
+		return fmt.Errorf("master level must be between 0 and 1")
+	}
+	g.mu.Lock()
+	g.master = level
+	g.mu.Unlock()
+	for i, pca := range g.list() {
+		if err := pca.setGroupMaster(ctx, level); err != nil {
+			return fmt.Errorf("controller %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// FadeMaster плавно изменяет мастер-яркость группы до level за duration.
+func (g *ControllerGroup) FadeMaster(ctx context.Context, level float64, duration time.Duration, opts ...FadeOption) error {
+	if !(level >= 0 && level <= 1) {
+		return fmt.Errorf("master level must be between 0 and 1")
+	}
+	// Шаги по умолчанию берутся из Config.Fade первого контроллера группы.
+	cfg := FadeConfig{}
+	if list := g.list(); len(list) > 0 {
+		cfg = list[0].fade
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	start := g.Master()
+	steps := cfg.steps(duration)
+	return runFade(ctx, steps, duration, func(step int) error {
+		return g.SetMaster(ctx, start+(level-start)*float64(step)/float64(steps))
+	})
+}
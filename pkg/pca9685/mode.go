@@ -0,0 +1,109 @@
+package pca9685
+
+import "fmt"
+
+// Дополнительные биты регистров MODE1 и MODE2.
+const (
+	Mode1Sub3   = 0x02 // Ответ на адрес SUBADR3
+	Mode1Sub2   = 0x04 // Ответ на адрес SUBADR2
+	Mode1Sub1   = 0x08 // Ответ на адрес SUBADR1
+	Mode1ExtClk = 0x40 // Внешний тактовый сигнал
+
+	Mode2OutNeHighZ = 0x02 // Выходы в высокоимпедансном состоянии при OE = 1
+	Mode2Och        = 0x08 // Обновление выходов по ACK вместо STOP
+)
+
+// ReadMode1 возвращает значение регистра MODE1.
+func (pca *PCA9685) ReadMode1() (byte, error) {
+	pca.mu.Lock()
+	defer pca.mu.Unlock()
+	pca.modeMu.Lock()
+	defer pca.modeMu.Unlock()
+	return pca.readMode1()
+}
+
+// ReadMode2 возвращает значение регистра MODE2.
+func (pca *PCA9685) ReadMode2() (byte, error) {
+	pca.mu.Lock()
+	defer pca.mu.Unlock()
+	return pca.readMode2()
+}
+
+// WriteMode1 записывает значение регистра MODE1 целиком. Запись выполняется
+// под блокировкой драйвера и не конкурирует с SetPWMFreq и другими методами,
+// изменяющими MODE1.
+func (pca *PCA9685) WriteMode1(value byte) error {
+	pca.logger.Detailed("WriteMode1: 0x%X", value)
+	pca.mu.Lock()
+	defer pca.mu.Unlock()
+	pca.modeMu.Lock()
+	defer pca.modeMu.Unlock()
+	return pca.writeMode("WriteMode1", RegMode1, value)
+}
+
+// WriteMode2 записывает значение регистра MODE2 целиком.
+func (pca *PCA9685) WriteMode2(value byte) error {
+	pca.logger.Detailed("WriteMode2: 0x%X", value)
+	pca.mu.Lock()
+	defer pca.mu.Unlock()
+	if err := pca.writeMode("WriteMode2", RegMode2, value); err != nil {
+		return err
+	}
+	pca.inverted.Store(value&Mode2Invrt != 0)
+	pca.mode2.Store(uint32(value))
+	return nil
+}
+
+// UpdateMode1 устанавливает биты set и сбрасывает биты clear регистра MODE1
+// за одно чтение-изменение-запись. Бит RESTART записывается, только если он
+// явно указан в set.
+func (pca *PCA9685) UpdateMode1(set, clear byte) error {
+	pca.mu.Lock()
+	defer pca.mu.Unlock()
+	pca.modeMu.Lock()
+	defer pca.modeMu.Unlock()
+	mode1, err := pca.readMode1()
+	if err != nil {
+		return err
+	}
+	value := (mode1&^clear | set) &^ (Mode1Restart &^ set)
+	pca.logger.Detailed("UpdateMode1: 0x%X -> 0x%X", mode1, value)
+	return pca.writeMode("UpdateMode1", RegMode1, value)
+}
+
+// UpdateMode2 устанавливает биты set и сбрасывает биты clear регистра MODE2.
+func (pca *PCA9685) UpdateMode2(set, clear byte) error {
+	pca.mu.Lock()
+	defer pca.mu.Unlock()
+	mode2, err := pca.readMode2()
+	if err != nil {
+		return err
+	}
+	value := mode2&^clear | set
+	pca.logger.Detailed("UpdateMode2: 0x%X -> 0x%X", mode2, value)
+	if err := pca.writeMode("UpdateMode2", RegMode2, value); err != nil {
+		return err
+	}
+	pca.inverted.Store(value&Mode2Invrt != 0)
+	pca.mode2.Store(uint32(value))
+	return nil
+}
+
+// readMode2 считывает значение регистра MODE2.
+func (pca *PCA9685) readMode2() (byte, error) {
+	data := make([]byte, 1)
+	if err := pca.readReg(pca.ctx, "ReadMode2", -1, RegMode2, data); err != nil {
+		pca.logger.Error("readMode2: не удалось прочитать MODE2: %v", err)
+		return 0, fmt.Errorf("failed to read MODE2: %w", err)
+	}
+	return data[0], nil
+}
+
+// writeMode записывает регистр режима. Вызывается с захваченным pca.mu.
+func (pca *PCA9685) writeMode(op string, reg uint8, value byte) error {
+	if err := pca.writeReg(pca.ctx, op, -1, reg, []byte{value}); err != nil {
+		pca.logger.Error("%s: не удалось записать регистр 0x%X: %v", op, reg, err)
+		return fmt.Errorf("failed to write mode register 0x%X: %w", reg, err)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// MotionProfile ограничивает скорость, ускорение и рывок плавных
+// перемещений периферии (Servo.MoveTo, Pump.RampTo, ESC.RampTo). Единицы –
+// градусы для сервопривода и проценты для насоса и ESC, в секунду, секунду²
+// и секунду³. Нулевое ограничение не действует; профиль без ограничений
+// выключен, и перемещение выполняется сразу.
+//
+// Перемещение следует S-образной кривой минимального рывка: скорость и
+// ускорение плавно нарастают от нуля и спадают до нуля, поэтому тяжёлая
+// нагрузка не раскачивается, как при равномерном (линейном) изменении.
+// Длительность перемещения – наименьшая, при которой кривая не превышает
+// ни одного из ограничений.
+type MotionProfile struct {
+	MaxVelocity float64 // Наибольшая скорость, единиц/с (0 – без ограничения)
+	MaxAccel    float64 // Наибольшее ускорение, единиц/с² (0 – без ограничения)
+	MaxJerk     float64 // Наибольший рывок, единиц/с³ (0 – без ограничения)
+}
+
+// Наибольшие скорость, ускорение и рывок кривой минимального рывка
+// s(t) = 10t³ − 15t⁴ + 6t⁵ при перемещении на 1 за время 1.
+const (
+	sCurveVelocity = 15.0 / 8
+	sCurveAccel    = 5.773502691896258 // 10/√3
+	sCurveJerk     = 60
+)
+
+// sCurve преобразует долю времени перемещения t (от 0 до 1) в долю пути.
+func sCurve(t float64) float64 {
+	return t * t * t * (10 + t*(6*t-15))
+}
+
+func (p MotionProfile) validate() error {
+	for _, v := range []float64{p.MaxVelocity, p.MaxAccel, p.MaxJerk} {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("motion profile limits must be finite and not negative")
+		}
+	}
+	return nil
+}
+
+// enabled сообщает, задано ли хотя бы одно ограничение.
+func (p MotionProfile) enabled() bool {
+	return p.MaxVelocity > 0 || p.MaxAccel > 0 || p.MaxJerk > 0
+}
+
+// Duration возвращает длительность перемещения на distance единиц.
+func (p MotionProfile) Duration(distance float64) time.Duration {
+	distance = math.Abs(distance)
+	var t float64
+	if p.MaxVelocity > 0 {
+		t = math.Max(t, sCurveVelocity*distance/p.MaxVelocity)
+	}
+	if p.MaxAccel > 0 {
+		t = math.Max(t, math.Sqrt(sCurveAccel*distance/p.MaxAccel))
+	}
+	if p.MaxJerk > 0 {
+		t = math.Max(t, math.Cbrt(sCurveJerk*distance/p.MaxJerk))
+	}
+	return time.Duration(t * float64(time.Second))
+}
+
+// move проводит значение от from до to по кривой профиля p, вызывая set на
+// каждом кадре. Кадры выводятся с частотой Config.Fade.FrameRate или 50
+// кадров/с. Последний кадр устанавливает to точно.
+func (pca *PCA9685) move(ctx context.Context, p MotionProfile, from, to float64, set func(context.Context, float64) error) error {
+	d := p.Duration(to - from)
+	cfg := pca.fade
+	if cfg.FrameRate <= 0 {
+		cfg.FrameRate = defaultTrajectoryFrameRate
+	}
+	steps := cfg.steps(d)
+	qctx := pca.quiet(ctx)
+	return runFade(ctx, steps, d, func(step int) error {
+		if step == steps {
+			return set(ctx, to)
+		}
+		return set(qctx, from+(to-from)*sCurve(float64(step)/float64(steps)))
+	})
+}
+
+// SetMotionProfile задаёт профиль перемещений MoveTo в градусах.
+func (s *Servo) SetMotionProfile(p MotionProfile) error {
+	if err := p.validate(); err != nil {
+		s.pca.logger.Error("SetMotionProfile: %v", err)
+		return err
+	}
+	s.mu.Lock()
+	s.motion = p
+	s.mu.Unlock()
+	s.pca.logger.Detailed("SetMotionProfile: сервопривод на канале %d: %+v", s.channel, p)
+	return nil
+}
+
+// MotionProfile возвращает профиль перемещений сервопривода.
+func (s *Servo) MotionProfile() MotionProfile {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.motion
+}
+
+// MoveTo плавно поворачивает сервопривод на угол angle по профилю
+// SetMotionProfile и возвращается по окончании поворота; без профиля
+// работает как SetAngle. При отмене ctx сервопривод остаётся в
+// достигнутом положении. В журнал записывается только конечный угол.
+func (s *Servo) MoveTo(ctx context.Context, angle float64) error {
+	s.mu.RLock()
+	from, p, limit := s.angle, s.motion, s.cal.Range
+	s.mu.RUnlock()
+	if angle < 0 || angle > limit {
+		err := fmt.Errorf("angle must be between 0 and %g", limit)
+		s.pca.logger.Error("MoveTo: %v", err)
+		return err
+	}
+	s.pca.logger.Detailed("MoveTo: канал %d, %g° → %g° за %v", s.channel, from, angle, p.Duration(angle-from))
+	return s.pca.move(ctx, p, from, angle, s.SetAngle)
+}
+
+// SetMotionProfile задаёт профиль изменения скорости RampTo в процентах.
+func (p *Pump) SetMotionProfile(m MotionProfile) error {
+	if err := m.validate(); err != nil {
+		p.pca.logger.Error("SetMotionProfile: %v", err)
+		return err
+	}
+	p.mu.Lock()
+	p.motion = m
+	p.mu.Unlock()
+	p.pca.logger.Detailed("SetMotionProfile: насос на канале %d: %+v", p.channel, m)
+	return nil
+}
+
+// MotionProfile возвращает профиль изменения скорости насоса.
+func (p *Pump) MotionProfile() MotionProfile {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.motion
+}
+
+// RampTo плавно изменяет скорость насоса до percent по профилю
+// SetMotionProfile, начиная с текущей скорости; без профиля работает как
+// SetSpeed. Ошибка любого шага (в том числе ErrPumpCutoff) прерывает
+// разгон.
+func (p *Pump) RampTo(ctx context.Context, percent float64) error {
+	if percent < 0 || percent > 100 {
+		p.pca.logger.Error("RampTo: неверное значение скорости: %f%%", percent)
+		return fmt.Errorf("speed percentage must be between 0 and 100")
+	}
+	from, err := p.GetCurrentSpeed()
+	if err != nil {
+		return err
+	}
+	return p.pca.move(ctx, p.MotionProfile(), from, percent, p.SetSpeed)
+}
+
+// SetMotionProfile задаёт профиль изменения газа RampTo в процентах.
+func (e *ESC) SetMotionProfile(p MotionProfile) error {
+	if err := p.validate(); err != nil {
+		e.pca.logger.Error("SetMotionProfile: %v", err)
+		return err
+	}
+	e.mu.Lock()
+	e.motion = p
+	e.mu.Unlock()
+	e.pca.logger.Detailed("SetMotionProfile: ESC на канале %d: %+v", e.channel, p)
+	return nil
+}
+
+// MotionProfile возвращает профиль изменения газа ESC.
+func (e *ESC) MotionProfile() MotionProfile {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.motion
+}
+
+// RampTo плавно изменяет газ до percent по профилю SetMotionProfile,
+// начиная с текущего значения; без профиля работает как SetThrottle.
+func (e *ESC) RampTo(ctx context.Context, percent float64) error {
+	if percent < 0 || percent > 100 {
+		e.pca.logger.Error("RampTo: неверное значение газа: %f%%", percent)
+		return fmt.Errorf("throttle percentage must be between 0 and 100")
+	}
+	return e.pca.move(ctx, e.MotionProfile(), e.Throttle(), percent, e.SetThrottle)
+}
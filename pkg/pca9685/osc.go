@@ -0,0 +1,495 @@
+package pca9685
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidCommand оборачивает ошибки проверки удалённых команд: неизвестный
+// адрес, устройство или периферия, неверные аргументы и значения вне диапазона.
+var ErrInvalidCommand = errors.New("invalid command")
+
+// ErrRateLimited возвращается, если клиент превысил допустимую частоту команд.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// ErrSourceNotAllowed возвращается для команд отправителя, не входящего в
+// список разрешённых источников.
+var ErrSourceNotAllowed = errors.New("source not allowed")
+
+// maxOSCClients – число клиентов, после которого ограничитель частоты
+// забывает простаивающих.
+const maxOSCClients = 1024
+
+// OSCMessage – разобранное OSC сообщение.
+// Аргументы имеют типы int32, float32, float64 или string.
+type OSCMessage struct {
+	Address string
+	Args    []interface{}
+}
+
+// OSCServer принимает OSC сообщения по UDP и преобразует их в вызовы драйвера.
+//
+// Поддерживаемые адреса:
+//
+//	/pca/<dev>/ch/<n> <value>                 – скважность канала (0.0–1.0)
+//	/pca/<dev>/led/<name>/color <r> <g> <b>   – цвет (int 0–255 или float 0.0–1.0)
+//	/pca/<dev>/led/<name>/brightness <value>  – яркость (0.0–1.0)
+//
+// Команды выполняются с источником osc:<адрес клиента> в журнале изменений.
+type OSCServer struct {
+	mu      sync.RWMutex
+	devices []*PCA9685
+	leds    map[int]map[string]*RGBLed
+	logger  Logger
+	onError func(*OSCError)
+	allowed []netip.Prefix // разрешённые отправители, пустой – любые
+
+	rate    float64 // команд в секунду на клиента, 0 – без ограничения
+	burst   float64
+	limitMu sync.Mutex
+	clients map[string]*oscClient
+}
+
+// oscClient – корзина токенов ограничителя частоты одного клиента.
+type oscClient struct {
+	tokens float64
+	last   time.Time
+}
+
+// OSCError – отклонённая или завершившаяся ошибкой команда OSC.
+type OSCError struct {
+	Client  string // Адрес отправителя без порта
+	Address string // Адрес OSC сообщения
+	Err     error  // Причина; errors.Is различает ErrInvalidCommand, ErrRateLimited и ErrSourceNotAllowed
+}
+
+func (e *OSCError) Error() string {
+	return fmt.Sprintf("OSC %s from %s: %v", e.Address, e.Client, e.Err)
+}
+
+func (e *OSCError) Unwrap() error {
+	return e.Err
+}
+
+// OSCOption определяет опцию OSC сервера.
+type OSCOption func(*OSCServer)
+
+// WithOSCRateLimit ограничивает частоту команд каждого клиента (по адресу
+// отправителя) величиной perSecond с допустимым всплеском burst. Лишние
+// команды отбрасываются с ошибкой ErrRateLimited, защищая нагрузки от
+// зациклившегося или враждебного отправителя.
+func WithOSCRateLimit(perSecond float64, burst int) OSCOption {
+	return func(s *OSCServer) {
+		if perSecond > 0 && burst > 0 {
+			s.rate, s.burst = perSecond, float64(burst)
+		}
+	}
+}
+
+// WithOSCAllowedSources принимает команды только от отправителей из
+// подсетей prefixes; команды остальных отклоняются с ошибкой
+// ErrSourceNotAllowed. OSC не предусматривает аутентификации, поэтому
+// сервер, доступный из общей сети, следует ограничить адресами пультов.
+func WithOSCAllowedSources(prefixes ...netip.Prefix) OSCOption {
+	return func(s *OSCServer) {
+		s.allowed = append(s.allowed, prefixes...)
+	}
+}
+
+// WithOSCErrorHandler задаёт функцию, получающую каждую отклонённую или
+// завершившуюся ошибкой команду (например, для метрик или ответа клиенту по
+// другому каналу). Ошибки также записываются в лог.
+func WithOSCErrorHandler(fn func(*OSCError)) OSCOption {
+	return func(s *OSCServer) {
+		s.onError = fn
+	}
+}
+
+// NewOSCServer создаёт OSC сервер. Если logger равен nil, используется стандартный логгер.
+func NewOSCServer(logger Logger, opts ...OSCOption) *OSCServer {
+	if logger == nil {
+		logger = NewDefaultLogger(LogLevelBasic)
+	}
+	s := &OSCServer{
+		leds:    make(map[int]map[string]*RGBLed),
+		logger:  logger,
+		clients: make(map[string]*oscClient),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// AddDevice регистрирует контроллер и возвращает его индекс в адресах OSC.
+func (s *OSCServer) AddDevice(pca *PCA9685) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices = append(s.devices, pca)
+	idx := len(s.devices) - 1
+	s.logger.Detailed("OSCServer: контроллер зарегистрирован как /pca/%d", idx)
+	return idx
+}
+
+// AddLed регистрирует RGB светодиод под именем name на контроллере с индексом device.
+func (s *OSCServer) AddLed(device int, name string, led *RGBLed) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid LED name: %q", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if device < 0 || device >= len(s.devices) {
+		return fmt.Errorf("unknown device index: %d", device)
+	}
+	if s.leds[device] == nil {
+		s.leds[device] = make(map[string]*RGBLed)
+	}
+	s.leds[device][name] = led
+	s.logger.Detailed("OSCServer: светодиод зарегистрирован как /pca/%d/led/%s", device, name)
+	return nil
+}
+
+// ListenAndServe открывает UDP сокет по адресу addr и обрабатывает сообщения до отмены контекста.
+func (s *OSCServer) ListenAndServe(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		s.logger.Error("OSCServer: не удалось открыть сокет %s: %v", addr, err)
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return s.Serve(ctx, conn)
+}
+
+// Serve обрабатывает пакеты из conn до отмены контекста. Соединение закрывается при выходе.
+func (s *OSCServer) Serve(ctx context.Context, conn net.PacketConn) error {
+	s.logger.Basic("OSCServer: приём OSC на %v", conn.LocalAddr())
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.logger.Error("OSCServer: ошибка чтения: %v", err)
+			return fmt.Errorf("failed to read OSC packet: %w", err)
+		}
+
+		msgs, err := ParseOSC(buf[:n])
+		if err != nil {
+			s.logger.Detailed("OSCServer: пропущен пакет от %v: %v", from, err)
+			continue
+		}
+		client := oscClientName(from)
+		cctx := WithSource(ctx, "osc:"+client)
+		permitted := sourceAllowed(s.allowed, from)
+		for _, msg := range msgs {
+			err := ErrSourceNotAllowed
+			if permitted {
+				err = ErrRateLimited
+				if s.allow(client, time.Now()) {
+					err = s.Dispatch(cctx, msg)
+				}
+			}
+			if err != nil {
+				s.reject(&OSCError{Client: client, Address: msg.Address, Err: err})
+			}
+		}
+	}
+}
+
+// reject записывает ошибку команды в лог и передаёт её обработчику.
+func (s *OSCServer) reject(e *OSCError) {
+	if errors.Is(e.Err, ErrRateLimited) || errors.Is(e.Err, ErrSourceNotAllowed) {
+		s.logger.Detailed("OSCServer: %v", e)
+	} else {
+		s.logger.Error("OSCServer: %v", e)
+	}
+	if s.onError != nil {
+		s.onError(e)
+	}
+}
+
+// allow расходует токен клиента client; false – частота команд превышена.
+func (s *OSCServer) allow(client string, now time.Time) bool {
+	if s.rate == 0 {
+		return true
+	}
+	s.limitMu.Lock()
+	defer s.limitMu.Unlock()
+	c := s.clients[client]
+	if c == nil {
+		if len(s.clients) >= maxOSCClients {
+			s.pruneClients(now)
+		}
+		c = &oscClient{tokens: s.burst, last: now}
+		s.clients[client] = c
+	}
+	c.tokens = math.Min(s.burst, c.tokens+now.Sub(c.last).Seconds()*s.rate)
+	c.last = now
+	if c.tokens < 1 {
+		return false
+	}
+	c.tokens--
+	return true
+}
+
+// pruneClients забывает клиентов, чья корзина уже восстановилась полностью.
+// Вызывается с захваченным limitMu.
+func (s *OSCServer) pruneClients(now time.Time) {
+	refill := time.Duration(s.burst / s.rate * float64(time.Second))
+	for name, c := range s.clients {
+		if now.Sub(c.last) >= refill {
+			delete(s.clients, name)
+		}
+	}
+}
+
+// oscClientName возвращает адрес отправителя без порта.
+func oscClientName(addr net.Addr) string {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return udp.IP.String()
+	}
+	if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+		return host
+	}
+	return addr.String()
+}
+
+// sourceAllowed сообщает, входит ли адрес отправителя в одну из подсетей
+// allowed. Пустой список разрешает любых отправителей.
+func sourceAllowed(allowed []netip.Prefix, addr net.Addr) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	var ip netip.Addr
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		ip, _ = netip.AddrFromSlice(udp.IP)
+	} else if ap, err := netip.ParseAddrPort(addr.String()); err == nil {
+		ip = ap.Addr()
+	}
+	ip = ip.Unmap()
+	for _, p := range allowed {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatch выполняет одно OSC сообщение. Команда проверяется до обращения
+// к драйверу: ошибки проверки оборачивают ErrInvalidCommand.
+func (s *OSCServer) Dispatch(ctx context.Context, msg OSCMessage) error {
+	s.logger.Detailed("OSCServer: %s %v", msg.Address, msg.Args)
+	parts := strings.Split(strings.TrimPrefix(msg.Address, "/"), "/")
+	if len(parts) < 4 || parts[0] != "pca" {
+		return fmt.Errorf("%w: unknown OSC address: %s", ErrInvalidCommand, msg.Address)
+	}
+	device, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fmt.Errorf("%w: invalid device index in %s", ErrInvalidCommand, msg.Address)
+	}
+
+	s.mu.RLock()
+	var pca *PCA9685
+	if device >= 0 && device < len(s.devices) {
+		pca = s.devices[device]
+	}
+	s.mu.RUnlock()
+	if pca == nil {
+		return fmt.Errorf("%w: unknown device index: %d", ErrInvalidCommand, device)
+	}
+
+	switch {
+	case parts[2] == "ch" && len(parts) == 4:
+		channel, err := strconv.Atoi(parts[3])
+		if err != nil || pca.validateChannel(channel) != nil {
+			return fmt.Errorf("%w: invalid channel in %s", ErrInvalidCommand, msg.Address)
+		}
+		value, err := oscFloatArgs(msg.Args, 1)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCommand, err)
+		}
+		if !(value[0] >= 0 && value[0] <= 1) {
+			return fmt.Errorf("%w: duty must be between 0 and 1, got %v", ErrInvalidCommand, value[0])
+		}
+		return pca.SetPWM(ctx, channel, 0, uint16(math.Round(value[0]*4095)))
+
+	case parts[2] == "led" && len(parts) == 5:
+		s.mu.RLock()
+		led := s.leds[device][parts[3]]
+		s.mu.RUnlock()
+		if led == nil {
+			return fmt.Errorf("%w: unknown LED: %s", ErrInvalidCommand, parts[3])
+		}
+		switch parts[4] {
+		case "color":
+			rgb, err := oscColorArgs(msg.Args)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidCommand, err)
+			}
+			return led.SetColor(ctx, rgb[0], rgb[1], rgb[2])
+		case "brightness":
+			value, err := oscFloatArgs(msg.Args, 1)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidCommand, err)
+			}
+			if !(value[0] >= 0 && value[0] <= 1) {
+				return fmt.Errorf("%w: brightness must be between 0 and 1, got %v", ErrInvalidCommand, value[0])
+			}
+			return led.SetBrightness(value[0])
+		}
+	}
+	return fmt.Errorf("%w: unknown OSC address: %s", ErrInvalidCommand, msg.Address)
+}
+
+// oscFloatArgs приводит ровно n числовых аргументов к float64.
+func oscFloatArgs(args []interface{}, n int) ([]float64, error) {
+	if len(args) != n {
+		return nil, fmt.Errorf("expected %d arguments, got %d", n, len(args))
+	}
+	values := make([]float64, n)
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case int32:
+			values[i] = float64(v)
+		case float32:
+			values[i] = float64(v)
+		case float64:
+			values[i] = v
+		default:
+			return nil, fmt.Errorf("argument %d is not a number", i)
+		}
+	}
+	return values, nil
+}
+
+// oscColorArgs разбирает три компоненты цвета: целые 0–255 или дробные 0.0–1.0.
+func oscColorArgs(args []interface{}) ([3]uint8, error) {
+	var rgb [3]uint8
+	if len(args) != 3 {
+		return rgb, fmt.Errorf("expected 3 arguments, got %d", len(args))
+	}
+	for i, arg := range args {
+		var v float64
+		switch a := arg.(type) {
+		case int32:
+			v = float64(a)
+		case float32:
+			v = float64(a) * 255
+		case float64:
+			v = a * 255
+		default:
+			return rgb, fmt.Errorf("argument %d is not a number", i)
+		}
+		// Сравнение в такой форме отклоняет и NaN.
+		if !(v >= 0 && v <= 255) {
+			return rgb, fmt.Errorf("color component %d out of range", i)
+		}
+		rgb[i] = uint8(math.Round(v))
+	}
+	return rgb, nil
+}
+
+// ParseOSC разбирает OSC пакет (сообщение или bundle) в список сообщений.
+func ParseOSC(packet []byte) ([]OSCMessage, error) {
+	if bytes.HasPrefix(packet, []byte("#bundle\x00")) {
+		if len(packet) < 16 {
+			return nil, fmt.Errorf("OSC bundle too short")
+		}
+		var msgs []OSCMessage
+		rest := packet[16:] // заголовок и time tag
+		for len(rest) > 0 {
+			if len(rest) < 4 {
+				return nil, fmt.Errorf("truncated OSC bundle element")
+			}
+			size := int(binary.BigEndian.Uint32(rest))
+			if size < 0 || size > len(rest)-4 {
+				return nil, fmt.Errorf("invalid OSC bundle element size: %d", size)
+			}
+			inner, err := ParseOSC(rest[4 : 4+size])
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, inner...)
+			rest = rest[4+size:]
+		}
+		return msgs, nil
+	}
+
+	address, rest, err := oscReadString(packet)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(address, "/") {
+		return nil, fmt.Errorf("invalid OSC address: %q", address)
+	}
+	msg := OSCMessage{Address: address}
+	if len(rest) == 0 {
+		return []OSCMessage{msg}, nil
+	}
+
+	tags, rest, err := oscReadString(rest)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(tags, ",") {
+		return nil, fmt.Errorf("invalid OSC type tag string: %q", tags)
+	}
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'i':
+			if len(rest) < 4 {
+				return nil, fmt.Errorf("truncated OSC int32 argument")
+			}
+			msg.Args = append(msg.Args, int32(binary.BigEndian.Uint32(rest)))
+			rest = rest[4:]
+		case 'f':
+			if len(rest) < 4 {
+				return nil, fmt.Errorf("truncated OSC float32 argument")
+			}
+			msg.Args = append(msg.Args, math.Float32frombits(binary.BigEndian.Uint32(rest)))
+			rest = rest[4:]
+		case 'd':
+			if len(rest) < 8 {
+				return nil, fmt.Errorf("truncated OSC float64 argument")
+			}
+			msg.Args = append(msg.Args, math.Float64frombits(binary.BigEndian.Uint64(rest)))
+			rest = rest[8:]
+		case 's':
+			var s string
+			if s, rest, err = oscReadString(rest); err != nil {
+				return nil, err
+			}
+			msg.Args = append(msg.Args, s)
+		default:
+			return nil, fmt.Errorf("unsupported OSC type tag: %q", tag)
+		}
+	}
+	return []OSCMessage{msg}, nil
+}
+
+// oscReadString читает строку OSC, завершённую нулём и выровненную до 4 байт.
+func oscReadString(b []byte) (string, []byte, error) {
+	end := bytes.IndexByte(b, 0)
+	if end < 0 {
+		return "", nil, fmt.Errorf("unterminated OSC string")
+	}
+	padded := (end + 4) &^ 3
+	if padded > len(b) {
+		return "", nil, fmt.Errorf("truncated OSC string padding")
+	}
+	return string(b[:end]), b[padded:], nil
+}
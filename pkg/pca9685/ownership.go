@@ -0,0 +1,78 @@
+package pca9685
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrChannelOwned возвращается при попытке занять канал, который уже
+// используется другой периферией.
+var ErrChannelOwned = errors.New("channel is already owned")
+
+// channelOwner – периферия, занимающая канал.
+type channelOwner struct {
+	ref  interface{} // указатель на периферию
+	name string      // описание для сообщений об ошибках
+}
+
+// claimChannels закрепляет каналы за периферией ref. Если хотя бы один
+// канал занят, ни один канал не закрепляется.
+func (pca *PCA9685) claimChannels(ref interface{}, name string, channels ...int) error {
+	pca.mu.Lock()
+	defer pca.mu.Unlock()
+	for i, ch := range channels {
+		if err := pca.validateChannel(ch); err != nil {
+			return err
+		}
+		if current := pca.owners[ch]; current.ref != nil {
+			pca.logger.Error("Канал %d уже занят: %s", ch, current.name)
+			return fmt.Errorf("%w: channel %d is used by %s", ErrChannelOwned, ch, current.name)
+		}
+		for _, prev := range channels[:i] {
+			if prev == ch {
+				return fmt.Errorf("channel %d is listed twice", ch)
+			}
+		}
+	}
+	for _, ch := range channels {
+		pca.owners[ch] = channelOwner{ref: ref, name: name}
+		if !dimmable(ref) {
+			pca.undimmed.Store(pca.undimmed.Load() | 1<<ch)
+		}
+	}
+	return nil
+}
+
+// dimmable сообщает, действует ли мастер-яркость на каналы периферии ref.
+// Для сервоприводов, ESC и насосов длительность импульса задаёт положение и
+// скорость, поэтому их каналы не масштабируются.
+func dimmable(ref interface{}) bool {
+	switch ref.(type) {
+	case *Servo, *ServoCalibrator, *ESC, *Pump, *BidirectionalPump:
+		return false
+	}
+	return true
+}
+
+// releaseChannels освобождает каналы, закреплённые за ref.
+func (pca *PCA9685) releaseChannels(ref interface{}, channels ...int) {
+	pca.mu.Lock()
+	defer pca.mu.Unlock()
+	for _, ch := range channels {
+		if ch >= 0 && ch < len(pca.owners) && pca.owners[ch].ref == ref {
+			pca.owners[ch] = channelOwner{}
+			pca.undimmed.Store(pca.undimmed.Load() &^ (1 << ch))
+		}
+	}
+}
+
+// ChannelOwner возвращает описание периферии, занимающей канал, или пустую
+// строку, если канал свободен.
+func (pca *PCA9685) ChannelOwner(channel int) string {
+	if pca.validateChannel(channel) != nil {
+		return ""
+	}
+	pca.mu.RLock()
+	defer pca.mu.RUnlock()
+	return pca.owners[channel].name
+}
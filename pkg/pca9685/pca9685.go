@@ -3,9 +3,13 @@ package pca9685
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,6 +34,7 @@ const (
 	// Регистр для каналов LED
 	RegLed0     = 0x06
 	RegAllLed   = 0xFA
+	RegAllCall  = 0x05 // Адрес ALLCALL (7 бит, сдвинутых влево на 1)
 	RegPrescale = 0xFE
 
 	// Константы
@@ -37,8 +42,18 @@ const (
 	MinFrequency  = 24
 	MaxFrequency  = 1526
 	OscClock      = 25000000 // 25 МГц
+
+	// Значения on/off с флагом FULL_ON или FULL_OFF (бит 12 регистров
+	// LEDn_ON_H/LEDn_OFF_H): канал включён или выключен на весь период
+	// независимо от счётчиков. FULL_OFF имеет приоритет над FULL_ON.
+	FullOn  = 0x1000
+	FullOff = 0x1000
 )
 
+// ErrInvalidPWM возвращается для значений on/off вне диапазона 0–4095,
+// кроме FullOn и FullOff.
+var ErrInvalidPWM = errors.New("invalid PWM value")
+
 // I2C – минимальный интерфейс для работы с I²C устройствами.
 type I2C interface {
 	WriteReg(reg uint8, data []byte) error
@@ -52,6 +67,26 @@ type Channel struct {
 	enabled bool
 	on      uint16
 	off     uint16
+	buf     [4]byte // буфер записи регистров канала, защищён mu
+
+	// Значения до отключения через DisableChannels.
+	savedOn, savedOff uint16
+	saved             bool
+
+	limits   channelLimits
+	failsafe channelFailsafe
+	rate     channelRate
+	pulsing  atomic.Bool // канал занят Pulse
+
+	// Копии состояния для чтения без блокировок (см. state.go).
+	snap  atomic.Uint64
+	label atomic.Value // string
+}
+
+// PWMValue – значения on/off для одного канала.
+type PWMValue struct {
+	Channel int
+	On, Off uint16
 }
 
 // PCA9685 представляет контроллер PCA9685.
@@ -62,7 +97,49 @@ type PCA9685 struct {
 	channels [16]Channel
 	ctx      context.Context
 	cancel   context.CancelFunc
-	logger   Logger // добавлен логгер
+	logger   Logger   // добавлен логгер
+	detailed bool     // включено ли подробное логирование
+	allBuf   [16]byte // буфер записи ALL_LED (16 байт PWM для PCA9635), защищён mu
+	chip     Chip
+
+	ctxDev    ContextI2C      // адаптер с поддержкой контекста, если dev его реализует
+	caps      I2CCapabilities // возможности адаптера (см. CapableI2C)
+	ioTimeout time.Duration   // ограничение длительности одной транзакции I2C
+	onError   func(op string, channel int, err error)
+	onEvent   func(Event)
+	degraded  *degradedState // nil, если деградированный режим выключен
+	fade      FadeConfig
+	journal   *Journal     // nil, если журнал изменений выключен
+	counters  counters     // счётчики для Counters и DebugHandler
+	latency   latencies    // гистограммы задержки для Latency
+	duty      *dutyTracker // учёт времени работы выходов для DutyStats
+	arb       arbiter      // приоритеты источников команд (SetSourcePriority)
+
+	verify        bool         // проверка записи контрольным чтением (Config.VerifyWrites)
+	verifyRetries int          // повторы записи при несовпадении
+	strictFreq    bool         // несовместимость частоты с сервоприводами – ошибка
+	trace         atomic.Value // *tracer; nil – трассировка выключена
+	dry           atomic.Value // *TestI2C; nil – пробный режим выключен (SetDryRun)
+	snapshotFile  string       // файл снимка каналов (Config.SnapshotFile)
+
+	master      float64       // мастер-яркость устройства, защищена mu
+	groupMaster float64       // мастер-яркость группы, защищена mu
+	level       atomic.Uint64 // итоговый множитель (биты float64)
+
+	owners [16]channelOwner // периферия, занимающая канал, защищено mu
+
+	inverted atomic.Bool   // включена инверсия выходной логики
+	mode2    atomic.Uint32 // последнее записанное значение MODE2 для Reinitialize
+	freq     atomic.Uint64 // копия Freq для чтения без блокировок (биты float64)
+
+	modeMu     sync.Mutex    // сериализует чтение-изменение-запись MODE1
+	autoSleep  time.Duration // период бездействия до автоматического сна
+	sleepTimer *time.Timer   // nil, если автоматический сон выключен
+	asleep     atomic.Bool   // микросхема переведена в сон драйвером
+	activeMask atomic.Uint32 // каналы с ненулевым импульсом
+
+	blackout atomic.Bool   // выходы отключены BlackoutAll
+	undimmed atomic.Uint32 // каналы периферии, на которую не действует мастер-яркость
 }
 
 // Config содержит настройки для инициализации PCA9685.
@@ -73,6 +150,75 @@ type Config struct {
 	Context     context.Context // Контекст для отмены операций
 	Logger      Logger          // Логгер. Если nil, будет использован стандартный.
 	LogLevel    LogLevel        // Уровень логирования.
+	IOTimeout   time.Duration   // Ограничение длительности одной транзакции I2C (0 – без ограничения).
+
+	// OnError вызывается при каждой неудачной операции I2C, в том числе из
+	// фоновых анимаций. op – имя операции, channel – номер канала или -1.
+	// Обработчик вызывается синхронно и не должен блокироваться.
+	OnError func(op string, channel int, err error)
+
+	// OnEvent вызывается при смене состояния контроллера (например, при входе
+	// в деградированный режим и выходе из него).
+	OnEvent func(Event)
+
+	// DegradedMode включает деградированный режим: если запись в устройство
+	// не удалась, она сохраняется в очереди, кэш каналов обновляется, а после
+	// восстановления шины записи повторяются автоматически.
+	DegradedMode       bool
+	DegradedQueueLimit int           // Максимальный размер очереди (по умолчанию 64)
+	RecoveryInterval   time.Duration // Период проверки связи (по умолчанию 1 секунда)
+
+	// Fade задаёт разрешение FadeChannel и FadeMulti по умолчанию.
+	Fade FadeConfig
+
+	// AutoSleep переводит микросхему в режим SLEEP, если все каналы выключены
+	// дольше заданного времени (0 – выключено). Следующая запись ненулевого
+	// значения автоматически выводит микросхему из сна.
+	AutoSleep time.Duration
+
+	// Journal – журнал изменений состояния (nil – выключен). В него
+	// записывается каждая команда изменения каналов, частоты и яркости с
+	// источником из контекста (см. WithSource) и результатом.
+	Journal *Journal
+
+	// Chip выбирает микросхему (по умолчанию ChipPCA9685). Для микросхем с
+	// фиксированной частотой InitialFreq не используется.
+	Chip Chip
+
+	// VerifyWrites включает проверку записи для электрически зашумлённых
+	// установок: после каждой записи регистров каналов они читаются обратно,
+	// при несовпадении генерируется событие EventWriteMismatch и запись
+	// повторяется. Проверка удваивает нагрузку на шину.
+	VerifyWrites  bool
+	VerifyRetries int // Число повторов при несовпадении: 0 – без повторов, меньше 0 – по умолчанию (2)
+
+	// Trace включает трассировку шины с момента создания (см. SetTrace).
+	Trace io.Writer
+
+	// StrictFrequency превращает несовместимость частоты PWM с сервоприводами
+	// и ESC из предупреждения в ошибку ErrFrequencyMismatch: NewServo и NewESC
+	// не создают периферию, а SetPWMFreq не устанавливает частоту, на которой
+	// подключённые сервоприводы гудели бы и перегревались.
+	StrictFrequency bool
+
+	// DutyWindows – окна скользящих средних скважности в DutyStats (по
+	// умолчанию 1 минута, 1 час и 24 часа).
+	DutyWindows []time.Duration
+
+	// DryRun создаёт контроллер в пробном режиме (см. SetDryRun): начиная с
+	// инициализации, ни одна транзакция не доходит до шины.
+	DryRun bool
+
+	// StartupState определяет состояние выходов после создания контроллера
+	// (по умолчанию StartupReset – сброс без записи каналов). StartupKeep
+	// не сбрасывает микросхему, чтобы выходы, оставленные работать при
+	// перезапуске службы, не прерывались.
+	StartupState StartupState
+	StartupScene *Scene // Сцена для StartupApplyScene
+
+	// SnapshotFile – файл снимка каналов: Close и SaveSnapshot сохраняют в
+	// него значения каналов, StartupRestore восстанавливает их.
+	SnapshotFile string
 }
 
 // DefaultConfig возвращает конфигурацию по умолчанию.
@@ -84,11 +230,33 @@ func DefaultConfig() *Config {
 		Context:     context.Background(),
 		LogLevel:    LogLevelBasic,
 		Logger:      NewDefaultLogger(LogLevelBasic),
+
+		VerifyRetries: defaultVerifyRetries,
 	}
 }
 
 // New создаёт новый экземпляр PCA9685 с указанной конфигурацией.
 func New(dev I2C, config *Config) (*PCA9685, error) {
+	return create(dev, config, false)
+}
+
+// Attach подключается к уже настроенной микросхеме, не прерывая работающие
+// выходы: частота PWM, MODE2 и значения каналов читаются в кэш, а MODE1,
+// MODE2 и PRE_SCALE не записываются (как StartupKeep). В отличие от
+// StartupKeep, ненастроенная микросхема (после включения питания) не
+// инициализируется – возвращается ошибка ErrNotConfigured. Attach нужен
+// процессам-наблюдателям, подключающимся к установке, которой управляет
+// другая служба. InitialFreq, InvertLogic, OpenDrain и StartupState
+// конфигурации не используются.
+func Attach(dev I2C, config *Config) (*PCA9685, error) {
+	return create(dev, config, true)
+}
+
+// ErrNotConfigured возвращается Attach, если микросхема не настроена
+// драйвером.
+var ErrNotConfigured = errors.New("device is not configured")
+
+func create(dev I2C, config *Config, attach bool) (*PCA9685, error) {
 	if config == nil {
 		config = DefaultConfig()
 	}
@@ -96,25 +264,106 @@ func New(dev I2C, config *Config) (*PCA9685, error) {
 	if config.Logger == nil {
 		config.Logger = NewDefaultLogger(config.LogLevel)
 	}
+	// Адаптер без явно заданного логгера пишет в логгер контроллера.
+	inheritLogger(dev, config.Logger)
 
 	ctx, cancel := context.WithCancel(config.Context)
 	pca := &PCA9685{
-		dev:    dev,
-		ctx:    ctx,
-		cancel: cancel,
-		logger: config.Logger,
+		dev:       dev,
+		ctx:       ctx,
+		cancel:    cancel,
+		logger:    config.Logger,
+		detailed:  detailedEnabled(config.Logger),
+		ioTimeout: config.IOTimeout,
+		onError:   config.OnError,
+		onEvent:   config.OnEvent,
+		fade:      config.Fade,
+		journal:   config.Journal,
+		chip:      config.Chip,
+		verify:    config.VerifyWrites,
+	}
+	pca.strictFreq = config.StrictFrequency
+	pca.duty = newDutyTracker(config.Chip, config.DutyWindows)
+	pca.duty.onDue = pca.maintenanceDue
+	pca.verifyRetries = config.VerifyRetries
+	if pca.verifyRetries < 0 {
+		pca.verifyRetries = defaultVerifyRetries
+	}
+	pca.master, pca.groupMaster = 1, 1
+	pca.level.Store(math.Float64bits(1))
+	if config.Trace != nil {
+		pca.trace.Store(&tracer{w: config.Trace})
+	}
+	if config.DryRun {
+		pca.dry.Store(NewTestI2C(WithLogger(config.Logger)))
+		pca.logger.Basic("Пробный режим: записи на шину не выполняются")
+	}
+	pca.ctxDev, _ = dev.(ContextI2C)
+	pca.caps = capabilitiesOf(dev)
+	if config.DegradedMode {
+		pca.degraded = newDegradedState(pca, config.DegradedQueueLimit, config.RecoveryInterval)
 	}
 
-	pca.logger.Basic("Создание экземпляра PCA9685, установка частоты: %v Гц", config.InitialFreq)
+	if config.Chip != ChipPCA9685 && config.Chip != ChipPCA9635 {
+		return nil, fmt.Errorf("unsupported chip: %v", config.Chip)
+	}
+	pca.snapshotFile = config.SnapshotFile
+	if attach {
+		pca.logger.Basic("Подключение к настроенной микросхеме %v без сброса", config.Chip)
+	} else {
+		if err := checkStartup(config); err != nil {
+			return nil, err
+		}
+		pca.logger.Basic("Создание экземпляра %v, установка частоты: %v Гц", config.Chip, config.InitialFreq)
+	}
 
 	// Инициализируем все каналы
 	for i := range pca.channels {
 		pca.channels[i].enabled = true
+		pca.channels[i].publish()
 	}
 
+	kept := false
+	if attach || config.StartupState == StartupKeep {
+		var err error
+		if kept, err = pca.adopt(pca.ctx); err != nil {
+			pca.logger.Error("Не удалось прочитать состояние устройства: %v", err)
+			return nil, err
+		}
+		switch {
+		case !kept && attach:
+			pca.logger.Error("Attach: устройство не настроено")
+			return nil, ErrNotConfigured
+		case !kept:
+			pca.logger.Basic("Устройство не настроено, выполняется инициализация")
+		}
+	}
+	if !kept {
+		if err := pca.initDevice(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.AutoSleep > 0 {
+		pca.autoSleep = config.AutoSleep
+		pca.sleepTimer = time.AfterFunc(config.AutoSleep, pca.autoSleepNow)
+	}
+
+	if err := pca.applyStartup(pca.ctx, config, kept); err != nil {
+		if pca.sleepTimer != nil {
+			pca.sleepTimer.Stop()
+		}
+		pca.logger.Error("Не удалось установить начальное состояние %v: %v", config.StartupState, err)
+		return nil, err
+	}
+	return pca, nil
+}
+
+// initDevice сбрасывает микросхему и настраивает MODE2 и частоту PWM.
+func (pca *PCA9685) initDevice(config *Config) error {
 	if err := pca.Reset(); err != nil {
 		pca.logger.Error("Не удалось выполнить сброс устройства: %v", err)
-		return nil, fmt.Errorf("failed to reset device: %w", err)
+		return fmt.Errorf("failed to reset device: %w", err)
 	}
 
 	// Настройка регистра MODE2
@@ -125,24 +374,43 @@ func New(dev I2C, config *Config) (*PCA9685, error) {
 	if config.InvertLogic {
 		mode2 |= Mode2Invrt
 	}
-	if err := pca.dev.WriteReg(RegMode2, []byte{mode2}); err != nil {
+	pca.inverted.Store(config.InvertLogic)
+	pca.mode2.Store(uint32(mode2))
+	if err := pca.writeReg(pca.ctx, "New", -1, RegMode2, []byte{mode2}); err != nil {
 		pca.logger.Error("Не удалось настроить MODE2: %v", err)
-		return nil, fmt.Errorf("failed to configure MODE2: %w", err)
+		return fmt.Errorf("failed to configure MODE2: %w", err)
 	}
 	pca.logger.Detailed("MODE2 установлен: 0x%X", mode2)
 
 	// Установка частоты PWM
-	if err := pca.SetPWMFreq(config.InitialFreq); err != nil {
+	if pca.chip.fixedFrequency() > 0 {
+		if err := pca.initFixed(); err != nil {
+			pca.logger.Error("Не удалось запустить %v: %v", pca.chip, err)
+			return err
+		}
+	} else if err := pca.SetPWMFreq(config.InitialFreq); err != nil {
 		pca.logger.Error("Не удалось установить частоту: %v", err)
-		return nil, fmt.Errorf("failed to set frequency: %w", err)
+		return fmt.Errorf("failed to set frequency: %w", err)
 	}
-
-	return pca, nil
+	return nil
 }
 
 // Close освобождает ресурсы и закрывает устройство.
 func (pca *PCA9685) Close() error {
 	pca.logger.Basic("Закрытие устройства")
+	if pca.sleepTimer != nil {
+		pca.sleepTimer.Stop()
+	}
+	// Снимок сохраняется до безопасных значений: при следующем запуске
+	// StartupRestore вернёт рабочее состояние.
+	if pca.snapshotFile != "" {
+		if err := pca.SaveSnapshot(); err != nil {
+			pca.logger.Error("Close: не удалось сохранить снимок каналов: %v", err)
+		}
+	}
+	if err := pca.applyFailsafe(pca.ctx, nil); err != nil {
+		pca.logger.Error("Close: не удалось установить безопасные значения: %v", err)
+	}
 	pca.cancel()
 	return pca.dev.Close()
 }
@@ -150,12 +418,7 @@ func (pca *PCA9685) Close() error {
 // EnableAllCall включает режим All Call.
 func (pca *PCA9685) EnableAllCall() error {
 	pca.logger.Detailed("Включение режима All Call")
-	mode1, err := pca.readMode1()
-	if err != nil {
-		pca.logger.Error("Ошибка чтения MODE1: %v", err)
-		return err
-	}
-	return pca.dev.WriteReg(RegMode1, []byte{mode1 | Mode1AllCall})
+	return pca.UpdateMode1(Mode1AllCall, 0)
 }
 
 // Reset инициализирует устройство с настройками по умолчанию.
@@ -163,8 +426,10 @@ func (pca *PCA9685) Reset() error {
 	pca.logger.Basic("Сброс устройства")
 	pca.mu.Lock()
 	defer pca.mu.Unlock()
+	pca.modeMu.Lock()
+	defer pca.modeMu.Unlock()
 
-	if err := pca.dev.WriteReg(RegMode1, []byte{Mode1Sleep | Mode1AutoInc}); err != nil {
+	if err := pca.writeReg(pca.ctx, "Reset", -1, RegMode1, []byte{Mode1Sleep | Mode1AutoInc}); err != nil {
 		pca.logger.Error("Ошибка при установке MODE1: %v", err)
 		return fmt.Errorf("failed to set MODE1: %w", err)
 	}
@@ -173,7 +438,25 @@ func (pca *PCA9685) Reset() error {
 
 // SetPWMFreq устанавливает частоту PWM в герцах (от 24 до 1526 Гц).
 func (pca *PCA9685) SetPWMFreq(freq float64) error {
+	err := pca.checkFrequencyChange(freq)
+	if err != nil {
+		pca.logger.Error("SetPWMFreq: частота %v Гц не подходит периферии: %v", freq, err)
+	} else {
+		err = pca.setPWMFreq(freq)
+	}
+	pca.record(pca.ctx, JournalEntry{Op: "SetPWMFreq", Channel: -1, Value: freq}, err)
+	if err == nil {
+		pca.warnFrequency(freq, nil)
+	}
+	return err
+}
+
+func (pca *PCA9685) setPWMFreq(freq float64) error {
 	pca.logger.Basic("Установка частоты PWM: %v Гц", freq)
+	if err := pca.requireFrequency("SetPWMFreq"); err != nil {
+		pca.logger.Error("Ошибка установки частоты: %v", err)
+		return err
+	}
 	if freq < MinFrequency || freq > MaxFrequency {
 		err := fmt.Errorf("frequency out of range (%d-%d Hz)", MinFrequency, MaxFrequency)
 		pca.logger.Error("Ошибка установки частоты: %v", err)
@@ -182,12 +465,11 @@ func (pca *PCA9685) SetPWMFreq(freq float64) error {
 
 	pca.mu.Lock()
 	defer pca.mu.Unlock()
+	pca.modeMu.Lock()
+	defer pca.modeMu.Unlock()
 
 	// Вычисляем значение предделителя.
-	prescale := math.Round(float64(OscClock)/(float64(PwmResolution)*freq)) - 1
-	if prescale < 3 {
-		prescale = 3
-	}
+	prescale, _ := prescaleFor(freq)
 	pca.logger.Detailed("Вычислен prescale: %v", prescale)
 
 	// Чтение текущего режима.
@@ -198,19 +480,24 @@ func (pca *PCA9685) SetPWMFreq(freq float64) error {
 	}
 
 	// Переводим устройство в режим сна для установки предделителя.
-	if err := pca.dev.WriteReg(RegMode1, []byte{(oldMode & 0x7F) | Mode1Sleep}); err != nil {
+	if err := pca.writeReg(pca.ctx, "SetPWMFreq", -1, RegMode1, []byte{(oldMode & 0x7F) | Mode1Sleep}); err != nil {
 		pca.logger.Error("Не удалось войти в режим сна: %v", err)
 		return fmt.Errorf("failed to enter sleep mode: %w", err)
 	}
 
 	// Записываем предделитель.
-	if err := pca.dev.WriteReg(RegPrescale, []byte{byte(prescale)}); err != nil {
+	if err := pca.writeReg(pca.ctx, "SetPWMFreq", -1, RegPrescale, []byte{prescale}); err != nil {
 		pca.logger.Error("Не удалось установить prescale: %v", err)
 		return fmt.Errorf("failed to set prescale: %w", err)
 	}
 
-	// Восстанавливаем прежний режим.
-	if err := pca.dev.WriteReg(RegMode1, []byte{oldMode}); err != nil {
+	// Восстанавливаем прежний режим. Режим сна после Reset снимается, если
+	// микросхема не была переведена в сон драйвером.
+	if !pca.asleep.Load() {
+		oldMode &^= Mode1Sleep
+	}
+	oldMode &^= Mode1Restart
+	if err := pca.writeReg(pca.ctx, "SetPWMFreq", -1, RegMode1, []byte{oldMode}); err != nil {
 		pca.logger.Error("Не удалось восстановить режим: %v", err)
 		return fmt.Errorf("failed to restore mode: %w", err)
 	}
@@ -219,23 +506,46 @@ func (pca *PCA9685) SetPWMFreq(freq float64) error {
 	time.Sleep(500 * time.Microsecond)
 
 	// Включаем автоинкремент и рестарт.
-	if err := pca.dev.WriteReg(RegMode1, []byte{oldMode | Mode1Restart | Mode1AutoInc}); err != nil {
+	if err := pca.writeReg(pca.ctx, "SetPWMFreq", -1, RegMode1, []byte{oldMode | Mode1Restart | Mode1AutoInc}); err != nil {
 		pca.logger.Error("Не удалось включить автоинкремент: %v", err)
 		return fmt.Errorf("failed to enable auto-increment: %w", err)
 	}
 
 	pca.Freq = freq
+	pca.freq.Store(math.Float64bits(freq))
 	pca.logger.Detailed("Частота успешно установлена: %v Гц", pca.Freq)
 	return nil
 }
 
-// SetPWM устанавливает значения PWM для указанного канала.
+// SetPWM устанавливает значения PWM для указанного канала: импульс начинается
+// на шаге on и заканчивается на шаге off (0–4095). Значение on больше off
+// допустимо – импульс переходит через границу периода, при on, равном off,
+// импульса нет. Канал полностью включается значением on, равным FullOn, и
+// полностью выключается значением off, равным FullOff. Другие значения
+// больше 4095 отклоняются с ошибкой ErrInvalidPWM.
 func (pca *PCA9685) SetPWM(ctx context.Context, channel int, on, off uint16) error {
-	pca.logger.Detailed("SetPWM: канал %d, on=%d, off=%d", channel, on, off)
+	err := pca.setPWM(ctx, channel, on, off)
+	pca.record(ctx, JournalEntry{Op: "SetPWM", Channel: channel, On: on, Off: off}, err)
+	return err
+}
+
+func (pca *PCA9685) setPWM(ctx context.Context, channel int, on, off uint16) error {
+	if pca.detailed {
+		pca.logger.Detailed("SetPWM: канал %d, on=%d, off=%d", channel, on, off)
+	}
 	if err := pca.validateChannel(channel); err != nil {
 		pca.logger.Error("SetPWM: неверный номер канала %d: %v", channel, err)
 		return err
 	}
+	if err := validatePWM(on, off); err != nil {
+		pca.logger.Error("SetPWM: неверное значение канала %d: %v", channel, err)
+		return fmt.Errorf("channel %d: %w", channel, err)
+	}
+	on, off, err := pca.arbitrate(ctx, channel, on, off)
+	if err != nil {
+		pca.logger.Detailed("SetPWM: %v", err)
+		return err
+	}
 
 	ch := &pca.channels[channel]
 	ch.mu.Lock()
@@ -253,135 +563,449 @@ func (pca *PCA9685) SetPWM(ctx context.Context, channel int, on, off uint16) err
 		pca.logger.Error("SetPWM: контекст отменён: %v", err)
 		return err
 	default:
-		baseReg := uint8(RegLed0 + 4*channel)
-		data := []byte{
-			byte(on & 0xFF),
-			byte(on >> 8),
-			byte(off & 0xFF),
-			byte(off >> 8),
-		}
-		if err := pca.dev.WriteReg(baseReg, data); err != nil {
+		if pca.coalesce(ctx, channel, on, off) {
+			return nil
+		}
+		if err := pca.writeChannel(ctx, "SetPWM", channel, on, off); err != nil {
 			pca.logger.Error("SetPWM: не удалось установить значения PWM: %v", err)
 			return fmt.Errorf("failed to set PWM values: %w", err)
 		}
 
 		ch.on = on
 		ch.off = off
-		pca.logger.Detailed("SetPWM: канал %d успешно установлен", channel)
+		ch.publish()
+		if pca.detailed {
+			pca.logger.Detailed("SetPWM: канал %d успешно установлен", channel)
+		}
 		return nil
 	}
 }
 
-// SetAllPWM устанавливает одинаковые значения PWM для всех каналов.
+// writeChannel записывает значения канала в устройство с учётом мастер-яркости
+// и ограничений канала, не изменяя кэш. Вызывается с захваченным мьютексом канала.
+func (pca *PCA9685) writeChannel(ctx context.Context, op string, channel int, on, off uint16) error {
+	ch := &pca.channels[channel]
+	on, off = ch.limits.clamp(pca.scaleChannel(channel, on, off, pca.masterLevel()))
+	if err := pca.wakeFor(ctx, on, off); err != nil {
+		return err
+	}
+	// Буфер канала переиспользуется, чтобы запись не выделяла память.
+	ch.buf = [4]byte{
+		byte(on & 0xFF),
+		byte(on >> 8),
+		byte(off & 0xFF),
+		byte(off >> 8),
+	}
+	pca.markBlackout(ch.buf[:])
+	reg, data := pca.chip.ledFrame(channel, ch.buf[:], ch.buf[:1])
+	if err := pca.writeReg(ctx, op, channel, reg, data); err != nil {
+		return err
+	}
+	pca.updateActive(channel, on, off)
+	return nil
+}
+
+// SetAllPWM устанавливает одинаковые значения PWM для всех каналов. Допустимые
+// значения on/off – как у SetPWM.
 func (pca *PCA9685) SetAllPWM(ctx context.Context, on, off uint16) error {
-	pca.logger.Basic("SetAllPWM: установка всех каналов: on=%d, off=%d", on, off)
-	pca.mu.Lock()
-	defer pca.mu.Unlock()
+	if pca.detailed {
+		pca.logger.Detailed("SetAllPWM: установка всех каналов: on=%d, off=%d", on, off)
+	}
+	err := validatePWM(on, off)
+	switch {
+	case err != nil:
+		pca.logger.Error("SetAllPWM: неверное значение: %v", err)
+	case pca.arb.active() && ctx.Value(arbitratedKey{}) == nil:
+		// Каналы, удерживаемые другими источниками, записываются поканально.
+		values := make([]PWMValue, 0, len(pca.channels))
+		for i := range pca.channels {
+			if enabled, _, _ := pca.channels[i].snapshot(); enabled {
+				values = append(values, PWMValue{Channel: i, On: on, Off: off})
+			}
+		}
+		err = pca.SetMultiPWMValues(pca.quiet(ctx), values)
+	default:
+		pca.mu.Lock()
+		err = pca.setAllLocked(ctx, "SetAllPWM", on, off)
+		pca.mu.Unlock()
+	}
+	pca.record(ctx, JournalEntry{Op: "SetAllPWM", Channel: -1, On: on, Off: off}, err)
+	return err
+}
 
+// setAllLocked устанавливает значения всех каналов. Если у каналов заданы
+// ограничения, ненулевое значение записывается поканально, иначе одной записью
+// в регистр ALL_LED. Вызывается с захваченным pca.mu.
+func (pca *PCA9685) setAllLocked(ctx context.Context, op string, on, off uint16) error {
 	select {
 	case <-ctx.Done():
 		err := ctx.Err()
 		pca.logger.Error("SetAllPWM: контекст отменён: %v", err)
 		return err
 	default:
-		data := []byte{
-			byte(on & 0xFF),
-			byte(on >> 8),
-			byte(off & 0xFF),
-			byte(off >> 8),
+		won, woff := scalePWM(on, off, pca.masterLevel())
+		// Каналы с ограничениями и каналы без мастер-яркости требуют
+		// собственных значений.
+		scaled := won != on || woff != off
+		if pulseTicks(won, woff) > 0 && (pca.hasLimits() || scaled && pca.undimmed.Load() != 0) {
+			for i := range pca.channels {
+				ch := &pca.channels[i]
+				ch.mu.Lock()
+				err := pca.writeChannel(ctx, op, i, on, off)
+				ch.mu.Unlock()
+				if err != nil {
+					pca.logger.Error("SetAllPWM: не удалось установить значения канала %d: %v", i, err)
+					return fmt.Errorf("failed to set all PWM values: %w", err)
+				}
+			}
+			pca.cacheAll(on, off)
+			return nil
+		}
+		if err := pca.wakeFor(ctx, won, woff); err != nil {
+			return err
 		}
-		if err := pca.dev.WriteReg(RegAllLed, data); err != nil {
+		reg, data := pca.chip.allFrame(won, woff, pca.allBuf[:])
+		pca.markBlackout(data)
+		if err := pca.writeReg(ctx, op, -1, reg, data); err != nil {
 			pca.logger.Error("SetAllPWM: не удалось установить значения для всех каналов: %v", err)
 			return fmt.Errorf("failed to set all PWM values: %w", err)
 		}
 
-		for i := range pca.channels {
-			if pca.channels[i].enabled {
-				pca.channels[i].on = on
-				pca.channels[i].off = off
-			}
-		}
+		pca.updateActive(-1, won, woff)
+		pca.cacheAll(on, off)
 		pca.logger.Detailed("SetAllPWM: значения успешно установлены для всех каналов")
 		return nil
 	}
 }
 
+// cacheAll обновляет кэш включённых каналов после записи ALL_LED.
+// Вызывается с захваченным pca.mu; мьютексы каналов захватывает сама, так как
+// SetPWM изменяет кэш канала без pca.mu.
+func (pca *PCA9685) cacheAll(on, off uint16) {
+	for i := range pca.channels {
+		ch := &pca.channels[i]
+		ch.mu.Lock()
+		if ch.enabled {
+			ch.on = on
+			ch.off = off
+			ch.publish()
+		}
+		ch.mu.Unlock()
+	}
+}
+
+// EmergencyStop немедленно выключает все выходы одной записью бита FULL_OFF в
+// регистр ALL_LED (как BlackoutAll), затем обнуляет все каналы и снимает
+// затемнение, после чего каналы с безопасными значениями (SetChannelFailsafe)
+// получают их. В отличие от BlackoutAll прежние значения каналов не
+// сохраняются.
+func (pca *PCA9685) EmergencyStop(ctx context.Context) error {
+	pca.logger.Basic("EmergencyStop: аварийное выключение всех каналов")
+	pca.mu.Lock()
+	err := pca.blackoutLocked(ctx, "EmergencyStop")
+	if err == nil {
+		err = pca.setAllLocked(ctx, "EmergencyStop", 0, 0)
+	}
+	if err == nil {
+		err = pca.liftBlackoutLocked(ctx, "EmergencyStop", false)
+	}
+	pca.mu.Unlock()
+	pca.record(ctx, JournalEntry{Op: "EmergencyStop", Channel: -1}, err)
+	if err != nil {
+		pca.logger.Error("EmergencyStop: не удалось выключить каналы: %v", err)
+		return err
+	}
+	if err := pca.applyFailsafe(ctx, nil); err != nil {
+		pca.logger.Error("EmergencyStop: не удалось установить безопасные значения: %v", err)
+		return err
+	}
+	return nil
+}
+
 // SetMultiPWM устанавливает значения PWM для нескольких каналов.
 func (pca *PCA9685) SetMultiPWM(ctx context.Context, settings map[int]struct{ On, Off uint16 }) error {
-	pca.logger.Basic("SetMultiPWM: установка нескольких каналов")
+	pca.logger.Detailed("SetMultiPWM: установка нескольких каналов")
 	// Проверяем корректность номеров каналов.
-	for channel := range settings {
+	for channel, values := range settings {
 		if err := pca.validateChannel(channel); err != nil {
 			pca.logger.Error("SetMultiPWM: неверный номер канала %d: %v", channel, err)
 			return err
 		}
+		if err := validatePWM(values.On, values.Off); err != nil {
+			pca.logger.Error("SetMultiPWM: неверное значение канала %d: %v", channel, err)
+			return fmt.Errorf("channel %d: %w", channel, err)
+		}
 	}
 
+	// Каналы, удерживаемые источниками с более высоким приоритетом, не
+	// прерывают запись остальных.
+	var overridden []error
 	for channel, values := range settings {
-		select {
-		case <-ctx.Done():
-			err := ctx.Err()
-			pca.logger.Error("SetMultiPWM: контекст отменён: %v", err)
+		if err := pca.setMultiOne(ctx, channel, values.On, values.Off); err != nil {
+			if errors.Is(err, ErrOverridden) {
+				overridden = append(overridden, err)
+				continue
+			}
+			return err
+		}
+	}
+	return errors.Join(overridden...)
+}
+
+// SetMultiPWMValues устанавливает значения PWM для нескольких каналов в заданном
+// порядке. В отличие от SetMultiPWM не требует построения map и не выделяет память,
+// поэтому предпочтителен для анимаций с высокой частотой кадров. Идущие подряд
+// соседние каналы записываются одной транзакцией, если адаптер это допускает
+// (см. I2CCapabilities.MaxTransfer).
+func (pca *PCA9685) SetMultiPWMValues(ctx context.Context, values []PWMValue) error {
+	if pca.detailed {
+		pca.logger.Detailed("SetMultiPWMValues: установка %d каналов", len(values))
+	}
+	for _, v := range values {
+		if err := pca.validateChannel(v.Channel); err != nil {
+			pca.logger.Error("SetMultiPWMValues: неверный номер канала %d: %v", v.Channel, err)
 			return err
-		default:
-			if err := pca.SetPWM(ctx, channel, values.On, values.Off); err != nil {
-				pca.logger.Error("SetMultiPWM: не удалось установить PWM для канала %d: %v", channel, err)
-				return fmt.Errorf("failed to set PWM for channel %d: %w", channel, err)
+		}
+		if err := validatePWM(v.On, v.Off); err != nil {
+			pca.logger.Error("SetMultiPWMValues: неверное значение канала %d: %v", v.Channel, err)
+			return fmt.Errorf("channel %d: %w", v.Channel, err)
+		}
+	}
+
+	burst := pca.caps.burstChannels()
+	// Каналы записываются в журнал как одна команда SetMultiPWMValues.
+	wctx := pca.quiet(ctx)
+	var overridden error
+	if pca.arb.active() && ctx.Value(arbitratedKey{}) == nil {
+		values, overridden = pca.arbitrateValues(ctx, "SetMultiPWMValues", values)
+		wctx = arbitrated(wctx)
+	}
+	for i := 0; i < len(values); {
+		n := 1
+		for n < burst && i+n < len(values) && values[i+n].Channel == values[i].Channel+n {
+			n++
+		}
+		var err error
+		if n == 1 {
+			err = pca.setMultiOne(wctx, values[i].Channel, values[i].On, values[i].Off)
+		} else {
+			err = pca.setBurst(wctx, values[i:i+n])
+		}
+		if pca.journal != nil {
+			for _, v := range values[i : i+n] {
+				pca.record(ctx, JournalEntry{Op: "SetMultiPWMValues", Channel: v.Channel, On: v.On, Off: v.Off}, err)
 			}
 		}
+		if err != nil {
+			return err
+		}
+		i += n
 	}
+	return overridden
+}
+
+// setBurst записывает соседние каналы run одной транзакцией, пользуясь
+// автоинкрементом адреса регистра.
+func (pca *PCA9685) setBurst(ctx context.Context, run []PWMValue) error {
+	select {
+	case <-ctx.Done():
+		err := ctx.Err()
+		pca.logger.Error("SetMultiPWM: контекст отменён: %v", err)
+		return err
+	default:
+	}
+
+	first := run[0].Channel
+	// Каналы захватываются по возрастанию номера, как и при любой другой
+	// групповой записи.
+	for i := range run {
+		pca.channels[first+i].mu.Lock()
+	}
+	defer func() {
+		for i := range run {
+			pca.channels[first+i].mu.Unlock()
+		}
+	}()
+
+	// Хвост буфера – байты PWM для микросхем с 8-битными каналами.
+	pooled, buf := acquireFrame(5 * len(run))
+	defer releaseFrame(pooled)
+	frame, duty := buf[:4*len(run)], buf[4*len(run):]
+	if err := pca.fillFrame(ctx, "SetMultiPWM", run, frame); err != nil {
+		return err
+	}
+	marked := pca.markBlackout(frame)
+	reg, data := pca.chip.ledFrame(first, frame, duty)
+	if err := pca.writeReg(ctx, "SetMultiPWM", first, reg, data); err != nil {
+		pca.logger.Error("SetMultiPWM: не удалось записать каналы %d–%d: %v", first, first+len(run)-1, err)
+		return fmt.Errorf("failed to set PWM for channels %d-%d: %w", first, first+len(run)-1, err)
+	}
+	pca.commitFrame(run, frame, marked)
 	return nil
 }
 
-// EnableChannels включает указанные каналы.
+// fillFrame заполняет frame значениями соседних каналов run с учётом
+// мастер-яркости и ограничений, при необходимости выводя микросхему из сна.
+// Вызывается с блокировками каналов run.
+func (pca *PCA9685) fillFrame(ctx context.Context, op string, run []PWMValue, frame []byte) error {
+	level := pca.masterLevel()
+	for i, v := range run {
+		ch := &pca.channels[v.Channel]
+		if !ch.enabled {
+			err := fmt.Errorf("channel %d is disabled", v.Channel)
+			pca.logger.Error("%s: канал отключён: %v", op, err)
+			return fmt.Errorf("failed to set PWM for channel %d: %w", v.Channel, err)
+		}
+		on, off := ch.limits.clamp(pca.scaleChannel(v.Channel, v.On, v.Off, level))
+		if err := pca.wakeFor(ctx, on, off); err != nil {
+			return err
+		}
+		frame[4*i] = byte(on & 0xFF)
+		frame[4*i+1] = byte(on >> 8)
+		frame[4*i+2] = byte(off & 0xFF)
+		frame[4*i+3] = byte(off >> 8)
+	}
+	return nil
+}
+
+// commitFrame обновляет кэш каналов run после записи frame. Вызывается с
+// блокировками каналов run.
+func (pca *PCA9685) commitFrame(run []PWMValue, frame []byte, marked bool) {
+	for i, v := range run {
+		ch := &pca.channels[v.Channel]
+		// Активность канала определяется его значением, а не затемнением.
+		off := binary.LittleEndian.Uint16(frame[4*i+2:])
+		if marked {
+			off &^= ledFullOff
+		}
+		pca.updateActive(v.Channel, binary.LittleEndian.Uint16(frame[4*i:]), off)
+		ch.on, ch.off = v.On, v.Off
+		ch.publish()
+	}
+}
+
+// Capabilities возвращает возможности адаптера, с которыми работает драйвер.
+func (pca *PCA9685) Capabilities() I2CCapabilities {
+	return pca.caps
+}
+
+// setMultiOne устанавливает один канал в составе групповой записи.
+func (pca *PCA9685) setMultiOne(ctx context.Context, channel int, on, off uint16) error {
+	select {
+	case <-ctx.Done():
+		err := ctx.Err()
+		pca.logger.Error("SetMultiPWM: контекст отменён: %v", err)
+		return err
+	default:
+	}
+	// Групповые записи не откладываются минимальным интервалом канала
+	// (контекст оборачивается только при заданном интервале, без выделения
+	// памяти в обычном случае).
+	if pca.ChannelMinInterval(channel) > 0 {
+		ctx = immediate(ctx)
+	}
+	if err := pca.SetPWM(ctx, channel, on, off); err != nil {
+		pca.logger.Error("SetMultiPWM: не удалось установить PWM для канала %d: %v", channel, err)
+		return fmt.Errorf("failed to set PWM for channel %d: %w", channel, err)
+	}
+	return nil
+}
+
+// EnableChannels включает указанные каналы. Если канал был отключён через
+// DisableChannels, восстанавливаются значения on/off, действовавшие до отключения.
 func (pca *PCA9685) EnableChannels(channels ...int) error {
 	pca.logger.Basic("Включение каналов: %v", channels)
-	for _, ch := range channels {
-		if err := pca.validateChannel(ch); err != nil {
-			pca.logger.Error("EnableChannels: неверный номер канала %d: %v", ch, err)
+	for _, c := range channels {
+		on, off, err := pca.enableChannel(c)
+		pca.record(pca.ctx, JournalEntry{Op: "EnableChannels", Channel: c, On: on, Off: off}, err)
+		if err != nil {
 			return err
 		}
-		pca.channels[ch].mu.Lock()
-		pca.channels[ch].enabled = true
-		pca.channels[ch].mu.Unlock()
 	}
 	return nil
 }
 
-// DisableChannels выключает указанные каналы.
+// enableChannel включает канал c и возвращает его значения после включения.
+func (pca *PCA9685) enableChannel(c int) (on, off uint16, err error) {
+	if err := pca.validateChannel(c); err != nil {
+		pca.logger.Error("EnableChannels: неверный номер канала %d: %v", c, err)
+		return 0, 0, err
+	}
+	ch := &pca.channels[c]
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if !ch.enabled && ch.saved {
+		if err := pca.writeChannel(pca.ctx, "EnableChannels", c, ch.savedOn, ch.savedOff); err != nil {
+			pca.logger.Error("EnableChannels: не удалось восстановить канал %d: %v", c, err)
+			return 0, 0, fmt.Errorf("failed to restore channel %d: %w", c, err)
+		}
+		ch.on, ch.off = ch.savedOn, ch.savedOff
+		pca.logger.Detailed("EnableChannels: канал %d восстановлен: on=%d, off=%d", c, ch.on, ch.off)
+	}
+	ch.saved = false
+	ch.enabled = true
+	ch.publish()
+	return ch.on, ch.off, nil
+}
+
+// DisableChannels выключает указанные каналы, обнуляя PWM. Значения on/off
+// запоминаются и восстанавливаются при последующем EnableChannels.
 func (pca *PCA9685) DisableChannels(channels ...int) error {
 	pca.logger.Basic("Отключение каналов: %v", channels)
-	for _, ch := range channels {
-		if err := pca.validateChannel(ch); err != nil {
-			pca.logger.Error("DisableChannels: неверный номер канала %d: %v", ch, err)
+	return pca.disableChannels("DisableChannels", false, channels)
+}
+
+// DisableChannelsHold выключает указанные каналы, обнуляя PWM, без
+// запоминания значений: после EnableChannels канал остаётся в нуле.
+func (pca *PCA9685) DisableChannelsHold(channels ...int) error {
+	pca.logger.Basic("Отключение каналов без сохранения значений: %v", channels)
+	return pca.disableChannels("DisableChannelsHold", true, channels)
+}
+
+func (pca *PCA9685) disableChannels(op string, hold bool, channels []int) error {
+	for _, c := range channels {
+		err := pca.disableChannel(op, hold, c)
+		pca.record(pca.ctx, JournalEntry{Op: op, Channel: c}, err)
+		if err != nil {
 			return err
 		}
-		pca.channels[ch].mu.Lock()
-		pca.channels[ch].enabled = false
-		// При отключении устанавливаем нулевые значения PWM.
-		if err := pca.SetPWM(pca.ctx, ch, 0, 0); err != nil {
-			pca.channels[ch].mu.Unlock()
-			pca.logger.Error("DisableChannels: не удалось отключить канал %d: %v", ch, err)
-			return fmt.Errorf("failed to disable channel %d: %w", ch, err)
-		}
-		pca.channels[ch].mu.Unlock()
 	}
 	return nil
 }
 
+func (pca *PCA9685) disableChannel(op string, hold bool, c int) error {
+	if err := pca.validateChannel(c); err != nil {
+		pca.logger.Error("%s: неверный номер канала %d: %v", op, c, err)
+		return err
+	}
+	ch := &pca.channels[c]
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if hold {
+		ch.saved = false
+	} else if ch.enabled {
+		ch.savedOn, ch.savedOff, ch.saved = ch.on, ch.off, true
+	}
+	// При отключении устанавливаем нулевые значения PWM.
+	if err := pca.writeChannel(pca.ctx, op, c, 0, 0); err != nil {
+		pca.logger.Error("%s: не удалось отключить канал %d: %v", op, c, err)
+		return fmt.Errorf("failed to disable channel %d: %w", c, err)
+	}
+	ch.on, ch.off = 0, 0
+	ch.enabled = false
+	ch.publish()
+	return nil
+}
+
 // GetChannelState возвращает состояние канала: включён ли, и текущие значения on/off.
+// Полное состояние канала возвращает GetChannel.
 func (pca *PCA9685) GetChannelState(channel int) (enabled bool, on, off uint16, err error) {
 	pca.logger.Detailed("GetChannelState: получение состояния канала %d", channel)
-	if err := pca.validateChannel(channel); err != nil {
-		pca.logger.Error("GetChannelState: неверный номер канала %d: %v", channel, err)
+	state, err := pca.GetChannel(channel)
+	if err != nil {
 		return false, 0, 0, err
 	}
-
-	ch := &pca.channels[channel]
-	ch.mu.RLock()
-	defer ch.mu.RUnlock()
-
-	return ch.enabled, ch.on, ch.off, nil
+	return state.Enabled, state.On, state.Off, nil
 }
 
 // validateChannel проверяет корректность номера канала (0–15).
@@ -392,10 +1016,24 @@ func (pca *PCA9685) validateChannel(channel int) error {
 	return nil
 }
 
+// validatePWM проверяет значения on/off: шаг 0–4095 или флаг FullOn/FullOff
+// без шага. Большие значения при записи в регистры потеряли бы старшие биты
+// или включили бы флаг FULL_ON/FULL_OFF вместо заданного шага.
+func validatePWM(on, off uint16) error {
+	if !validTicks(on) || !validTicks(off) {
+		return fmt.Errorf("%w: on=%d, off=%d (want 0-4095, FullOn or FullOff)", ErrInvalidPWM, on, off)
+	}
+	return nil
+}
+
+func validTicks(v uint16) bool {
+	return v < PwmResolution || v == FullOn
+}
+
 // readMode1 считывает значение регистра MODE1.
 func (pca *PCA9685) readMode1() (byte, error) {
 	data := make([]byte, 1)
-	if err := pca.dev.ReadReg(RegMode1, data); err != nil {
+	if err := pca.readReg(pca.ctx, "ReadMode1", -1, RegMode1, data); err != nil {
 		pca.logger.Error("readMode1: не удалось прочитать MODE1: %v", err)
 		return 0, fmt.Errorf("failed to read MODE1: %w", err)
 	}
@@ -404,23 +1042,32 @@ func (pca *PCA9685) readMode1() (byte, error) {
 }
 
 // FadeChannel плавно изменяет значение PWM для указанного канала от start до end за duration.
-func (pca *PCA9685) FadeChannel(ctx context.Context, channel int, start, end uint16, duration time.Duration) error {
+// Разрешение задаётся Config.Fade и может быть переопределено опциями вызова.
+func (pca *PCA9685) FadeChannel(ctx context.Context, channel int, start, end uint16, duration time.Duration, opts ...FadeOption) error {
 	pca.logger.Basic("Начало плавного изменения (fade) на канале %d от %d до %d за %v", channel, start, end, duration)
 	if err := pca.validateChannel(channel); err != nil {
 		pca.logger.Error("FadeChannel: неверный номер канала %d: %v", channel, err)
 		return err
 	}
-	steps := 20
-	stepDuration := duration / time.Duration(steps)
-	diff := int(end) - int(start)
-	for i := 0; i <= steps; i++ {
-		value := start + uint16(float64(diff)*float64(i)/float64(steps))
-		if err := pca.SetPWM(ctx, channel, 0, value); err != nil {
+	steps := pca.fadeConfig(opts).steps(duration)
+	fade := FadeSpec{Start: start, End: end}
+	// В журнал записывается сама команда, а не отдельные кадры.
+	begin := time.Now()
+	fctx := pca.quiet(ctx)
+	pca.fadeEvent(EventFadeStarted, "FadeChannel", []int{channel}, nil)
+	err := runFade(fctx, steps, duration, func(step int) error {
+		value := fade.at(step, steps)
+		if err := pca.SetPWM(fctx, channel, 0, value); err != nil {
 			pca.logger.Error("FadeChannel: не удалось установить PWM на канале %d: %v", channel, err)
 			return err
 		}
 		pca.logger.Detailed("FadeChannel: канал %d установлен на %d", channel, value)
-		time.Sleep(stepDuration)
+		return nil
+	})
+	pca.fadeEvent(EventFadeCompleted, "FadeChannel", []int{channel}, err)
+	pca.record(ctx, JournalEntry{Time: begin, Op: "FadeChannel", Channel: channel, Off: end, Value: duration.Seconds()}, err)
+	if err != nil {
+		return err
 	}
 	pca.logger.Basic("Завершено плавное изменение на канале %d", channel)
 	return nil
@@ -428,14 +1075,10 @@ func (pca *PCA9685) FadeChannel(ctx context.Context, channel int, start, end uin
 
 // DumpState возвращает строку с текущим состоянием контроллера (частота и состояние каналов).
 func (pca *PCA9685) DumpState() string {
-	pca.mu.RLock()
-	defer pca.mu.RUnlock()
-	state := fmt.Sprintf("Состояние PCA9685: Частота: %f Гц\n", pca.Freq)
+	state := fmt.Sprintf("Состояние PCA9685: Частота: %f Гц\n", pca.frequency())
 	for i := range pca.channels {
-		ch := &pca.channels[i] // получаем указатель на элемент, чтобы не копировать мьютекс
-		ch.mu.RLock()
-		state += fmt.Sprintf("Канал %d: enabled=%v, on=%d, off=%d\n", i, ch.enabled, ch.on, ch.off)
-		ch.mu.RUnlock()
+		enabled, on, off := pca.channels[i].snapshot()
+		state += fmt.Sprintf("Канал %d: enabled=%v, on=%d, off=%d\n", i, enabled, on, off)
 	}
 	pca.logger.Detailed("DumpState:\n%s", state)
 	return state
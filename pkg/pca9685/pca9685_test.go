@@ -1,15 +1,33 @@
 package pca9685
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
+	"image"
 	"image/color"
+	"io"
 	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	expi2c "golang.org/x/exp/io/i2c"
+	expdriver "golang.org/x/exp/io/i2c/driver"
 )
 
 func TestPCA9685_New(t *testing.T) {
@@ -205,6 +223,7 @@ func TestPump(t *testing.T) {
 		if err != nil {
 			t.Fatalf("NewPump() error = %v", err)
 		}
+		defer pump.Release()
 		if pump.MinSpeed != 1000 || pump.MaxSpeed != 3000 {
 			t.Errorf("Speed limits not set correctly, got min %v, max %v", pump.MinSpeed, pump.MaxSpeed)
 		}
@@ -216,6 +235,7 @@ func TestPump(t *testing.T) {
 		if err != nil {
 			t.Fatalf("NewPump() error = %v", err)
 		}
+		defer pump.Release()
 
 		tests := []struct {
 			name    string
@@ -245,6 +265,7 @@ func TestPump(t *testing.T) {
 		if err != nil {
 			t.Fatalf("NewPump() error = %v", err)
 		}
+		defer pump.Release()
 		targetSpeed := 50.0
 
 		if err := pump.SetSpeed(ctx, targetSpeed); err != nil {
@@ -268,6 +289,7 @@ func TestPump(t *testing.T) {
 		if err != nil {
 			t.Fatalf("NewPump() error = %v", err)
 		}
+		defer pump.Release()
 
 		if err := pump.SetSpeed(ctx, 50); err != nil {
 			t.Fatalf("SetSpeed() error = %v", err)
@@ -313,6 +335,7 @@ func TestContextCancellation(t *testing.T) {
 
 func TestConcurrency(t *testing.T) {
 	adapter := NewTestI2C()
+	adapter.EnableStress(100*time.Microsecond, 1)
 	t.Log("Using TestI2C adapter for testing")
 	pca, err := New(adapter, DefaultConfig())
 
@@ -342,6 +365,9 @@ func TestConcurrency(t *testing.T) {
 	}
 
 	wg.Wait()
+	if err := adapter.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
 }
 
 func TestPCA9685_FadeChannel(t *testing.T) {
@@ -721,6 +747,7 @@ func TestMultipleChannelsConcurrent(t *testing.T) {
 // TestConcurrentFrequencyChange проверяет устойчивость к изменениям частоты
 func TestConcurrentFrequencyChange(t *testing.T) {
 	adapter := NewTestI2C()
+	adapter.EnableStress(200*time.Microsecond, 2)
 	pca, err := New(adapter, DefaultConfig())
 	if err != nil {
 		t.Fatalf("Failed to create PCA9685: %v", err)
@@ -765,7 +792,10 @@ func TestConcurrentFrequencyChange(t *testing.T) {
 				for ch := 0; ch < 16; ch++ {
 					value := uint16(ch * 256)
 					if err := pca.SetPWM(ctx, ch, 0, value); err != nil {
-						errorsList <- fmt.Errorf("PWM error on channel %d: %v", ch, err)
+						// Истечение контекста завершает тест, а не является ошибкой.
+						if ctx.Err() == nil {
+							errorsList <- fmt.Errorf("PWM error on channel %d: %v", ch, err)
+						}
 						return
 					}
 				}
@@ -811,4 +841,7259 @@ func TestConcurrentFrequencyChange(t *testing.T) {
 			t.Errorf("Error %d: %v", i+1, err)
 		}
 	}
+	if err := adapter.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+func buildArtDmx(universe uint16, data []byte) []byte {
+	packet := append([]byte("Art-Net\x00"), 0x00, 0x50, 0, 14, 0, 0)
+	packet = append(packet, byte(universe), byte(universe>>8), byte(len(data)>>8), byte(len(data)))
+	return append(packet, data...)
+}
+
+func TestParseArtDmx(t *testing.T) {
+	universe, data, err := ParseArtDmx(buildArtDmx(0x0103, []byte{10, 20, 30, 40}))
+	if err != nil {
+		t.Fatalf("ParseArtDmx() error = %v", err)
+	}
+	if universe != 0x0103 {
+		t.Errorf("ParseArtDmx() universe = %#x, want %#x", universe, 0x0103)
+	}
+	if string(data) != string([]byte{10, 20, 30, 40}) {
+		t.Errorf("ParseArtDmx() data = %v", data)
+	}
+
+	poll := append([]byte("Art-Net\x00"), 0x00, 0x20, 0, 14, 0, 0)
+	if _, _, err := ParseArtDmx(poll); !errors.Is(err, ErrArtNetNotDmx) {
+		t.Errorf("ParseArtDmx(ArtPoll) error = %v, want ErrArtNetNotDmx", err)
+	}
+	if _, _, err := ParseArtDmx([]byte("garbage")); err == nil {
+		t.Error("ParseArtDmx() expected error for invalid header")
+	}
+	truncated := buildArtDmx(0, []byte{1, 2, 3, 4})
+	if _, _, err := ParseArtDmx(truncated[:len(truncated)-1]); err == nil {
+		t.Error("ParseArtDmx() expected error for truncated packet")
+	}
+	if _, _, err := ParseArtDmx(buildArtDmx(0, []byte{1, 2, 3})); err == nil {
+		t.Error("ParseArtDmx() expected error for odd length")
+	}
+	if _, _, err := ParseArtDmx(buildArtDmx(0, nil)); err == nil {
+		t.Error("ParseArtDmx() expected error for zero length")
+	}
+}
+
+func TestArtNetReceiver(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+
+	mapper := NewDMXMapper()
+	if err := mapper.Patch(1, 1, pca, 0); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	if err := mapper.Patch(1, 3, pca, 5); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	if err := mapper.Patch(1, 513, pca, 0); err == nil {
+		t.Error("Patch() expected error for slot 513")
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP loopback unavailable: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	receiver := NewArtNetReceiver(mapper, nil)
+	done := make(chan error, 1)
+	go func() { done <- receiver.Serve(ctx, conn) }()
+
+	sender, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer sender.Close()
+	if _, err := sender.Write(buildArtDmx(1, []byte{255, 0, 51, 0})); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, _, off0, _ := pca.GetChannelState(0)
+		_, _, off5, _ := pca.GetChannelState(5)
+		if off0 == 4095 && off5 == 819 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Art-Net frame not applied: ch0=%d, ch5=%d", off0, off5)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Serve() error = %v, want context.Canceled", err)
+	}
+}
+
+func oscString(s string) []byte {
+	b := append([]byte(s), 0)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func buildOSC(address string, args ...interface{}) []byte {
+	tags := ","
+	var payload []byte
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case int32:
+			tags += "i"
+			payload = binary.BigEndian.AppendUint32(payload, uint32(v))
+		case float32:
+			tags += "f"
+			payload = binary.BigEndian.AppendUint32(payload, math.Float32bits(v))
+		}
+	}
+	packet := append(oscString(address), oscString(tags)...)
+	return append(packet, payload...)
+}
+
+func TestParseOSC(t *testing.T) {
+	msgs, err := ParseOSC(buildOSC("/pca/0/ch/5", float32(0.75)))
+	if err != nil {
+		t.Fatalf("ParseOSC() error = %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].Address != "/pca/0/ch/5" || msgs[0].Args[0] != float32(0.75) {
+		t.Errorf("ParseOSC() = %+v", msgs)
+	}
+
+	inner := buildOSC("/pca/0/led/bar/color", int32(1), int32(2), int32(3))
+	bundle := append([]byte("#bundle\x00"), make([]byte, 8)...)
+	bundle = binary.BigEndian.AppendUint32(bundle, uint32(len(inner)))
+	bundle = append(bundle, inner...)
+	msgs, err = ParseOSC(bundle)
+	if err != nil {
+		t.Fatalf("ParseOSC(bundle) error = %v", err)
+	}
+	if len(msgs) != 1 || len(msgs[0].Args) != 3 || msgs[0].Args[2] != int32(3) {
+		t.Errorf("ParseOSC(bundle) = %+v", msgs)
+	}
+
+	if _, err := ParseOSC([]byte("/pca")); err == nil {
+		t.Error("ParseOSC() expected error for unterminated address")
+	}
+}
+
+func TestOSCServer_Dispatch(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	led, err := NewRGBLed(pca, 0, 1, 2)
+	if err != nil {
+		t.Fatalf("NewRGBLed() error = %v", err)
+	}
+
+	server := NewOSCServer(nil)
+	idx := server.AddDevice(pca)
+	if err := server.AddLed(idx, "bar", led); err != nil {
+		t.Fatalf("AddLed() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if err := server.Dispatch(ctx, OSCMessage{"/pca/0/ch/5", []interface{}{float32(0.5)}}); err != nil {
+		t.Fatalf("Dispatch(ch) error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(5); off != 2048 {
+		t.Errorf("channel 5 off = %d, want 2048", off)
+	}
+
+	if err := server.Dispatch(ctx, OSCMessage{"/pca/0/led/bar/color", []interface{}{int32(255), int32(0), float32(1)}}); err != nil {
+		t.Fatalf("Dispatch(color) error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 4095 {
+		t.Errorf("red channel off = %d, want 4095", off)
+	}
+	if _, _, off, _ := pca.GetChannelState(2); off != 4095 {
+		t.Errorf("blue channel off = %d, want 4095", off)
+	}
+
+	if err := server.Dispatch(ctx, OSCMessage{"/pca/0/led/bar/brightness", []interface{}{float32(0.25)}}); err != nil {
+		t.Fatalf("Dispatch(brightness) error = %v", err)
+	}
+	if b := led.GetBrightness(); b != 0.25 {
+		t.Errorf("brightness = %v, want 0.25", b)
+	}
+
+	for _, msg := range []OSCMessage{
+		{"/pca/1/ch/0", []interface{}{float32(0.5)}},
+		{"/pca/0/ch/0", []interface{}{float32(1.5)}},
+		{"/pca/0/led/missing/color", []interface{}{int32(0), int32(0), int32(0)}},
+		{"/other/0/ch/0", []interface{}{float32(0.5)}},
+		{"/pca/0/ch/16", []interface{}{float32(0.5)}},
+		{"/pca/0/led/bar/brightness", []interface{}{float32(2)}},
+		{"/pca/0/led/bar/color", []interface{}{"red"}},
+		{"/pca/0/ch/5", []interface{}{float32(math.NaN())}},
+		{"/pca/0/led/bar/brightness", []interface{}{float32(math.NaN())}},
+		{"/pca/0/led/bar/color", []interface{}{float32(math.NaN()), int32(0), int32(0)}},
+	} {
+		if err := server.Dispatch(ctx, msg); !errors.Is(err, ErrInvalidCommand) {
+			t.Errorf("Dispatch(%s %v) error = %v, want ErrInvalidCommand", msg.Address, msg.Args, err)
+		}
+	}
+	if _, _, off, _ := pca.GetChannelState(5); off != 2048 {
+		t.Errorf("channel 5 off after NaN = %d, want 2048", off)
+	}
+	if b := led.GetBrightness(); b != 0.25 {
+		t.Errorf("brightness after NaN = %v, want 0.25", b)
+	}
+}
+
+// brokenConn – сокет, чтение из которого сразу завершается ошибкой.
+type brokenConn struct {
+	net.PacketConn
+	closes atomic.Int32
+}
+
+func (c *brokenConn) ReadFrom([]byte) (int, net.Addr, error) {
+	return 0, nil, errors.New("socket failure")
+}
+
+func (c *brokenConn) LocalAddr() net.Addr { return &net.UDPAddr{} }
+
+func (c *brokenConn) Close() error {
+	c.closes.Add(1)
+	return nil
+}
+
+func TestOSCServerReadError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn := &brokenConn{}
+	if err := NewOSCServer(nil).Serve(ctx, conn); err == nil || errors.Is(err, context.Canceled) {
+		t.Fatalf("Serve() error = %v, want read error", err)
+	}
+
+	// После выхода из Serve отмена контекста не должна трогать сокет.
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	if n := conn.closes.Load(); n != 1 {
+		t.Errorf("Close() called %d times, want 1", n)
+	}
+}
+
+func TestArtNetReceiverReadError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn := &brokenConn{}
+	if err := NewArtNetReceiver(NewDMXMapper(), nil).Serve(ctx, conn); err == nil || errors.Is(err, context.Canceled) {
+		t.Fatalf("Serve() error = %v, want read error", err)
+	}
+
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	if n := conn.closes.Load(); n != 1 {
+		t.Errorf("Close() called %d times, want 1", n)
+	}
+}
+
+func TestOSCServerAllowedSources(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	rejected := make(chan *OSCError, 1)
+	server := NewOSCServer(nil,
+		WithOSCAllowedSources(netip.MustParsePrefix("192.168.1.0/24")),
+		WithOSCErrorHandler(func(e *OSCError) { rejected <- e }))
+	server.AddDevice(pca)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP loopback unavailable: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ctx, conn) }()
+
+	sender, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer sender.Close()
+	if _, err := sender.Write(buildOSC("/pca/0/ch/1", float32(0.5))); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	select {
+	case e := <-rejected:
+		if !errors.Is(e, ErrSourceNotAllowed) || e.Client != "127.0.0.1" {
+			t.Errorf("rejected = %v, want ErrSourceNotAllowed", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("command from a foreign source was not rejected")
+	}
+	if _, _, off, _ := pca.GetChannelState(1); off != 0 {
+		t.Errorf("channel 1 off = %d, want 0", off)
+	}
+	cancel()
+	<-done
+}
+
+func TestSourceAllowed(t *testing.T) {
+	lan := []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24"), netip.MustParsePrefix("fd00::/8")}
+	tests := []struct {
+		addr    net.Addr
+		allowed []netip.Prefix
+		want    bool
+	}{
+		{&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 6454}, nil, true},
+		{&net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: 6454}, lan, true},
+		{&net.UDPAddr{IP: net.IPv4(192, 168, 1, 20).To16(), Port: 6454}, lan, true},
+		{&net.UDPAddr{IP: net.ParseIP("192.168.2.20"), Port: 6454}, lan, false},
+		{&net.UDPAddr{IP: net.ParseIP("fd00::1"), Port: 6454}, lan, true},
+		{&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 6454}, lan, false},
+	}
+	for _, tt := range tests {
+		if got := sourceAllowed(tt.allowed, tt.addr); got != tt.want {
+			t.Errorf("sourceAllowed(%v, %v) = %v, want %v", tt.allowed, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestOSCServerRateLimit(t *testing.T) {
+	var journal bytes.Buffer
+	config := DefaultConfig()
+	config.Journal = NewJournal(&journal)
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	rejected := make(chan *OSCError, 8)
+	server := NewOSCServer(nil, WithOSCRateLimit(0.001, 2), WithOSCErrorHandler(func(e *OSCError) { rejected <- e }))
+	server.AddDevice(pca)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("UDP loopback unavailable: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ctx, conn) }()
+
+	sender, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer sender.Close()
+	for _, packet := range [][]byte{
+		buildOSC("/pca/0/ch/1", float32(0.5)),
+		buildOSC("/pca/0/ch/1", float32(3)),
+		buildOSC("/pca/0/ch/2", float32(1)),
+	} {
+		if _, err := sender.Write(packet); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	for _, want := range []error{ErrInvalidCommand, ErrRateLimited} {
+		select {
+		case e := <-rejected:
+			if !errors.Is(e, want) || e.Client != "127.0.0.1" || e.Address == "" {
+				t.Errorf("rejected = %v, want %v", e, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no rejection for %v", want)
+		}
+	}
+	if _, _, off, _ := pca.GetChannelState(1); off != 2048 {
+		t.Errorf("channel 1 off = %d, want 2048", off)
+	}
+	if _, _, off, _ := pca.GetChannelState(2); off != 0 {
+		t.Errorf("rate-limited channel 2 off = %d, want 0", off)
+	}
+	cancel()
+	<-done
+	if !strings.Contains(journal.String(), `"source":"osc:127.0.0.1"`) {
+		t.Errorf("journal = %s, want osc source", journal.String())
+	}
+}
+
+func TestSequencer(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+
+	steps := []SequenceStep{
+		{Scene: Scene{Name: "dim", Values: map[int]uint16{0: 1000, 1: 0}}, Duration: 10 * time.Millisecond},
+		{Scene: Scene{Name: "bright", Values: map[int]uint16{0: 4000, 1: 2000}}, Crossfade: 40 * time.Millisecond, Duration: 10 * time.Millisecond},
+	}
+
+	if _, err := NewSequencer(pca, nil); err == nil {
+		t.Error("NewSequencer() expected error for empty sequence")
+	}
+	if _, err := NewSequencer(pca, []SequenceStep{{Scene: Scene{Values: map[int]uint16{16: 0}}}}); err == nil {
+		t.Error("NewSequencer() expected error for invalid channel")
+	}
+
+	t.Run("PlayToEnd", func(t *testing.T) {
+		seq, err := NewSequencer(pca, steps)
+		if err != nil {
+			t.Fatalf("NewSequencer() error = %v", err)
+		}
+		if err := seq.Play(ctx); err != nil {
+			t.Fatalf("Play() error = %v", err)
+		}
+		if err := seq.Wait(); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		if seq.State() != SequencerStopped {
+			t.Errorf("State() = %v, want stopped", seq.State())
+		}
+		if _, _, off, _ := pca.GetChannelState(0); off != 4000 {
+			t.Errorf("channel 0 off = %d, want 4000", off)
+		}
+		if _, _, off, _ := pca.GetChannelState(1); off != 2000 {
+			t.Errorf("channel 1 off = %d, want 2000", off)
+		}
+	})
+
+	t.Run("CrossfadeDuration", func(t *testing.T) {
+		config := DefaultConfig()
+		config.Fade = FadeConfig{Steps: 4}
+		dev, err := New(NewTestI2C(), config)
+		if err != nil {
+			t.Fatalf("Failed to create PCA9685: %v", err)
+		}
+		seq, err := NewSequencer(dev, []SequenceStep{
+			{Scene: Scene{Name: "off", Values: map[int]uint16{0: 0}}},
+			{Scene: Scene{Name: "on", Values: map[int]uint16{0: 4000}}, Crossfade: 80 * time.Millisecond},
+		})
+		if err != nil {
+			t.Fatalf("NewSequencer() error = %v", err)
+		}
+		start := time.Now()
+		if err := seq.Play(ctx); err != nil {
+			t.Fatalf("Play() error = %v", err)
+		}
+		if err := seq.Wait(); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		// Все четыре кадра перехода занимают полный интервал Crossfade.
+		if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+			t.Errorf("crossfade took %v, want at least 80ms", elapsed)
+		}
+		if _, _, off, _ := dev.GetChannelState(0); off != 4000 {
+			t.Errorf("channel 0 off = %d, want 4000", off)
+		}
+	})
+
+	t.Run("PauseSkipStop", func(t *testing.T) {
+		long := []SequenceStep{
+			{Scene: Scene{Name: "a", Values: map[int]uint16{2: 100}}, Duration: time.Hour},
+			{Scene: Scene{Name: "b", Values: map[int]uint16{2: 200}}, Duration: time.Hour},
+		}
+		seq, err := NewSequencer(pca, long, WithLoop(true))
+		if err != nil {
+			t.Fatalf("NewSequencer() error = %v", err)
+		}
+		if err := seq.Play(ctx); err != nil {
+			t.Fatalf("Play() error = %v", err)
+		}
+		seq.Pause()
+		if seq.State() != SequencerPaused {
+			t.Errorf("State() = %v, want paused", seq.State())
+		}
+		seq.Skip()
+		if err := seq.Play(ctx); err != nil {
+			t.Fatalf("Play() error = %v", err)
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for seq.CurrentStep() != 1 {
+			if time.Now().After(deadline) {
+				t.Fatal("Skip() did not advance to the next step")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		seq.Stop()
+		if seq.State() != SequencerStopped {
+			t.Errorf("State() after Stop() = %v, want stopped", seq.State())
+		}
+		if err := seq.Wait(); err != nil {
+			t.Errorf("Wait() after Stop() error = %v", err)
+		}
+	})
+}
+
+func TestKelvinToRGB(t *testing.T) {
+	if r, g, b := KelvinToRGB(6600); r != 255 || g < 250 || b != 255 {
+		t.Errorf("KelvinToRGB(6600) = %d,%d,%d, want near white", r, g, b)
+	}
+	if r, _, b := KelvinToRGB(1800); r != 255 || b != 0 {
+		t.Errorf("KelvinToRGB(1800) = %d,_,%d, want warm red", r, b)
+	}
+}
+
+func TestDaylightSimulation(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	led, err := NewRGBLed(pca, 0, 1, 2)
+	if err != nil {
+		t.Fatalf("NewRGBLed() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := NewDaylightSimulation(led, DaylightCurve{{At: 0.5, Kelvin: 2000}, {At: 0.1, Kelvin: 3000}}, time.Second); err == nil {
+		t.Error("NewDaylightSimulation() expected error for unsorted curve")
+	}
+
+	if k, b := SunsetCurve().At(0); k != 6500 || b != 1 {
+		t.Errorf("SunsetCurve().At(0) = %v, %v", k, b)
+	}
+
+	sim, err := NewDaylightSimulation(led, SunriseCurve(), 50*time.Millisecond, WithDaylightInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewDaylightSimulation() error = %v", err)
+	}
+	if err := sim.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if sim.Elapsed() != 50*time.Millisecond {
+		t.Errorf("Elapsed() = %v, want 50ms", sim.Elapsed())
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 4095 {
+		t.Errorf("red channel at end of sunrise = %d, want 4095", off)
+	}
+
+	t.Run("ResumeMidCurve", func(t *testing.T) {
+		sim, err := NewDaylightSimulation(led, SunsetCurve(), time.Hour, WithDaylightInterval(5*time.Millisecond))
+		if err != nil {
+			t.Fatalf("NewDaylightSimulation() error = %v", err)
+		}
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if err := sim.Resume(ctx, 30*time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Resume() error = %v, want context.DeadlineExceeded", err)
+		}
+		if sim.Elapsed() < 30*time.Minute {
+			t.Errorf("Elapsed() = %v, want >= 30m", sim.Elapsed())
+		}
+		if err := sim.Resume(ctx, 2*time.Hour); err == nil {
+			t.Error("Resume() expected error for elapsed beyond duration")
+		}
+	})
+
+	t.Run("StateFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sunrise.json")
+		sim, err := NewDaylightSimulation(led, SunriseCurve(), time.Hour, WithDaylightInterval(5*time.Millisecond), WithDaylightStateFile(path))
+		if err != nil {
+			t.Fatalf("NewDaylightSimulation() error = %v", err)
+		}
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := sim.Resume(cctx, 20*time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Resume() error = %v, want context.DeadlineExceeded", err)
+		}
+
+		// После «перезапуска» кривая продолжается с сохранённого момента начала.
+		restarted, err := NewDaylightSimulation(led, SunriseCurve(), time.Hour, WithDaylightInterval(5*time.Millisecond), WithDaylightStateFile(path))
+		if err != nil {
+			t.Fatalf("NewDaylightSimulation() error = %v", err)
+		}
+		cctx, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := restarted.ResumeSaved(cctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("ResumeSaved() error = %v, want context.DeadlineExceeded", err)
+		}
+		if e := restarted.Elapsed(); e < 20*time.Minute || e > 21*time.Minute {
+			t.Errorf("Elapsed() after ResumeSaved = %v, want about 20m", e)
+		}
+
+		// Кривая, закончившаяся во время простоя, выставляет конечную точку.
+		data, _ := json.Marshal(daylightState{Start: time.Now().Add(-2 * time.Hour)})
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := restarted.ResumeSaved(ctx); err != nil {
+			t.Fatalf("ResumeSaved() error = %v", err)
+		}
+		if restarted.Elapsed() != time.Hour {
+			t.Errorf("Elapsed() = %v, want 1h", restarted.Elapsed())
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("state file after completion: Stat() error = %v, want not exist", err)
+		}
+
+		// Завершённая кривая не продолжается: следующий запуск идёт с начала.
+		cctx, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := restarted.ResumeSaved(cctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("ResumeSaved() after completion error = %v, want context.DeadlineExceeded", err)
+		}
+		if e := restarted.Elapsed(); e > time.Minute {
+			t.Errorf("Elapsed() after completed curve = %v, want restart from the beginning", e)
+		}
+
+		// Stop прерывает кривую без ошибки и удаляет состояние.
+		errc := make(chan error, 1)
+		go func() { errc <- restarted.Resume(ctx, 10*time.Minute) }()
+		for i := 0; i < 100; i++ {
+			if _, err := os.Stat(path); err == nil && restarted.Elapsed() >= 10*time.Minute {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		restarted.Stop()
+		if err := <-errc; err != nil {
+			t.Errorf("Resume() after Stop error = %v", err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("state file after Stop: Stat() error = %v, want not exist", err)
+		}
+
+		unsaved, _ := NewDaylightSimulation(led, SunriseCurve(), time.Hour)
+		if err := unsaved.ResumeSaved(ctx); err == nil {
+			t.Error("ResumeSaved() expected error without state file")
+		}
+	})
+}
+
+func TestSolarTime(t *testing.T) {
+	london := time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		event SolarEvent
+		want  time.Time
+	}{
+		{Sunrise, time.Date(2024, 6, 21, 3, 43, 0, 0, time.UTC)},
+		{SolarNoon, time.Date(2024, 6, 21, 12, 2, 0, 0, time.UTC)},
+		{Sunset, time.Date(2024, 6, 21, 20, 21, 0, 0, time.UTC)},
+		{CivilDusk, time.Date(2024, 6, 21, 21, 5, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event.String(), func(t *testing.T) {
+			got, err := SolarTime(tt.event, london, 51.5074, -0.1278)
+			if err != nil {
+				t.Fatalf("SolarTime() error = %v", err)
+			}
+			if diff := got.Sub(tt.want); diff < -5*time.Minute || diff > 5*time.Minute {
+				t.Errorf("SolarTime() = %v, want about %v", got, tt.want)
+			}
+		})
+	}
+
+	// Полярный день в Тромсё.
+	if _, err := SolarTime(Sunset, london, 69.65, 18.96); !errors.Is(err, ErrNoSolarEvent) {
+		t.Errorf("SolarTime() in polar day error = %v, want ErrNoSolarEvent", err)
+	}
+	if _, err := SolarTime(Sunrise, london, 91, 0); err == nil {
+		t.Error("SolarTime() expected error for invalid latitude")
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	t.Run("DailyTrigger", func(t *testing.T) {
+		after := time.Date(2024, 3, 10, 19, 0, 0, 0, time.UTC)
+		next, err := DailyTrigger{Hour: 8}.Next(after)
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		if want := time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC); !next.Equal(want) {
+			t.Errorf("Next() = %v, want %v", next, want)
+		}
+		if _, err := (DailyTrigger{Hour: 24}).Next(after); err == nil {
+			t.Error("Next() expected error for invalid hour")
+		}
+	})
+
+	t.Run("SolarTrigger", func(t *testing.T) {
+		trigger := SolarTrigger{Event: CivilDusk, Latitude: 51.5074, Longitude: -0.1278, Offset: -10 * time.Minute}
+		after := time.Date(2024, 6, 21, 22, 0, 0, 0, time.UTC)
+		next, err := trigger.Next(after)
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		if next.Day() != 22 || next.Hour() != 20 {
+			t.Errorf("Next() = %v, want next evening around 20:55 UTC", next)
+		}
+
+		polar := SolarTrigger{Event: Sunset, Latitude: 69.65, Longitude: 18.96}
+		next, err = polar.Next(time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatalf("Next() in polar day error = %v", err)
+		}
+		if next.Month() != time.July {
+			t.Errorf("Next() in polar day = %v, want first sunset in late July", next)
+		}
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		s := NewScheduler(nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		fired := make(chan string, 10)
+		every := TriggerFunc(func(after time.Time) (time.Time, error) {
+			return after.Add(10 * time.Millisecond), nil
+		})
+		if err := s.Add("tick", every, func(context.Context) error {
+			fired <- "tick"
+			return errors.New("action errors must not stop the scheduler")
+		}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- s.Run(ctx) }()
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-fired:
+			case <-time.After(2 * time.Second):
+				t.Fatal("scheduled action did not fire")
+			}
+		}
+		s.Remove("tick")
+		if _, ok := s.Next("tick"); ok {
+			t.Error("Next() reported a removed job")
+		}
+
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("Run() error = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("LongAction", func(t *testing.T) {
+		s := NewScheduler(nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		every := TriggerFunc(func(after time.Time) (time.Time, error) {
+			return after.Add(5 * time.Millisecond), nil
+		})
+		var sunrise atomic.Int32
+		release := make(chan struct{})
+		if err := s.Add("sunrise", every, func(ctx context.Context) error {
+			sunrise.Add(1)
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+		fired := make(chan struct{}, 100)
+		if err := s.Add("tick", every, func(context.Context) error {
+			fired <- struct{}{}
+			return nil
+		}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- s.Run(ctx) }()
+
+		// Пока длится «рассвет», остальные задания продолжают срабатывать.
+		for i := 0; i < 3; i++ {
+			select {
+			case <-fired:
+			case <-time.After(2 * time.Second):
+				t.Fatal("tick did not fire while a long action was running")
+			}
+		}
+		if n := sunrise.Load(); n != 1 {
+			t.Errorf("long action started %d times, want 1 while still running", n)
+		}
+		s.Remove("tick")
+
+		// Run возвращается только после завершения запущенных действий.
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("Run() error = %v, want context.Canceled", err)
+		}
+		close(release)
+	})
+}
+
+func TestRuleEngine(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := NewRuleEngine(0, nil); err == nil {
+		t.Error("NewRuleEngine() expected error for zero tick")
+	}
+	engine, err := NewRuleEngine(time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("NewRuleEngine() error = %v", err)
+	}
+
+	temperature := 20.0
+	sensor := ValueSourceFunc(func(context.Context) (float64, error) { return temperature, nil })
+	fired := 0
+	if err := engine.Add(Rule{
+		Name: "overheat",
+		When: Above(sensor, 30),
+		Then: ActionFunc(func(context.Context) error { fired++; return nil }),
+	}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	message := NewMessageCondition("aquarium/scene", "evening")
+	if err := engine.Add(Rule{
+		Name: "scene",
+		When: message,
+		Then: ApplySceneAction(pca, Scene{Name: "evening", Values: map[int]uint16{4: 1234}}),
+	}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := engine.Add(Rule{Name: "scene", When: message, Then: ActionFunc(nil)}); err == nil {
+		t.Error("Add() expected error for duplicate rule name")
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := engine.Evaluate(ctx); err != nil {
+			t.Fatalf("Evaluate() error = %v", err)
+		}
+	}
+	if fired != 0 {
+		t.Errorf("rule fired %d times below threshold", fired)
+	}
+
+	temperature = 35
+	for i := 0; i < 3; i++ {
+		_ = engine.Evaluate(ctx)
+	}
+	if fired != 1 {
+		t.Errorf("on-change rule fired %d times, want 1", fired)
+	}
+
+	message.Publish("aquarium/scene", "morning")
+	message.Publish("garden/scene", "evening")
+	_ = engine.Evaluate(ctx)
+	if _, _, off, _ := pca.GetChannelState(4); off != 0 {
+		t.Errorf("scene applied for another topic: channel 4 off = %d", off)
+	}
+	message.Publish("aquarium/scene", "evening")
+	_ = engine.Evaluate(ctx)
+	if _, _, off, _ := pca.GetChannelState(4); off != 1234 {
+		t.Errorf("scene not applied: channel 4 off = %d", off)
+	}
+
+	// Действие может изменять набор правил без взаимоблокировки.
+	trigger := NewMessageCondition("rules", "add")
+	_ = engine.Add(Rule{Name: "installer", When: trigger, Then: ActionFunc(func(context.Context) error {
+		engine.Remove("installer")
+		return engine.Add(Rule{Name: "installed", When: trigger, Then: ActionFunc(func(context.Context) error { return nil })})
+	})})
+	trigger.Publish("rules", "add")
+	done := make(chan error, 1)
+	go func() { done <- engine.Evaluate(ctx) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Evaluate() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Evaluate() deadlocked when an action changed the rules")
+	}
+	engine.Remove("installed")
+
+	failing := ValueSourceFunc(func(context.Context) (float64, error) { return 0, errors.New("sensor offline") })
+	engine.Remove("overheat")
+	_ = engine.Add(Rule{Name: "broken", When: Below(failing, 1), Then: SetPWMAction(pca, 0, 0, 0)})
+	if err := engine.Evaluate(ctx); err == nil {
+		t.Error("Evaluate() expected error from failing condition")
+	}
+}
+
+func TestPhotoperiod(t *testing.T) {
+	day := Photoperiod{On: DailyTrigger{Hour: 8}, Off: DailyTrigger{Hour: 20}, Ramp: time.Hour}
+	if err := day.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	night := Photoperiod{On: DailyTrigger{Hour: 22}, Off: DailyTrigger{Hour: 6}, Ramp: 30 * time.Minute}
+
+	tests := []struct {
+		name      string
+		p         Photoperiod
+		hour, min int
+		phase     PhotoperiodPhase
+		elapsed   time.Duration
+		remaining time.Duration
+	}{
+		{"BeforeSunrise", day, 7, 0, PhaseNight, 11 * time.Hour, time.Hour},
+		{"Sunrise", day, 8, 15, PhaseSunrise, 15 * time.Minute, 45 * time.Minute},
+		{"Day", day, 12, 0, PhaseDay, 3 * time.Hour, 7 * time.Hour},
+		{"Sunset", day, 19, 30, PhaseSunset, 30 * time.Minute, 30 * time.Minute},
+		{"AcrossMidnight", night, 1, 0, PhaseDay, 150 * time.Minute, 270 * time.Minute},
+		{"AcrossMidnightNight", night, 12, 0, PhaseNight, 6 * time.Hour, 10 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			phase, elapsed, remaining := tt.p.Phase(time.Date(2024, 5, 1, tt.hour, tt.min, 0, 0, time.UTC))
+			if phase != tt.phase || elapsed != tt.elapsed || remaining != tt.remaining {
+				t.Errorf("Phase() = %v, %v, %v; want %v, %v, %v", phase, elapsed, remaining, tt.phase, tt.elapsed, tt.remaining)
+			}
+		})
+	}
+
+	if err := (Photoperiod{On: DailyTrigger{Hour: 8}, Off: DailyTrigger{Hour: 9}, Ramp: time.Hour}).Validate(); err == nil {
+		t.Error("Validate() expected error when ramps do not fit")
+	}
+}
+
+func TestGrowLight(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	period := Photoperiod{On: DailyTrigger{Hour: 6}, Off: DailyTrigger{Hour: 18}, Ramp: time.Hour}
+
+	if _, err := NewGrowLight(pca, GrowLightConfig{Photoperiod: period}); err == nil {
+		t.Error("NewGrowLight() expected error without channels")
+	}
+
+	ambient := 0.0
+	g, err := NewGrowLight(pca, GrowLightConfig{
+		Channels:    []int{8, 9},
+		Photoperiod: period,
+		MaxPPFD:     500,
+		TargetDLI:   10,
+		Ambient:     ValueSourceFunc(func(context.Context) (float64, error) { return ambient, nil }),
+	})
+	if err != nil {
+		t.Fatalf("NewGrowLight() error = %v", err)
+	}
+
+	at := func(h, m int) time.Time { return time.Date(2024, 5, 1, h, m, 0, 0, time.UTC) }
+
+	if err := g.Update(ctx, at(3, 0)); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if g.Level() != 0 {
+		t.Errorf("Level() at night = %v, want 0", g.Level())
+	}
+
+	// 10 моль за оставшиеся 9 часов требуют ~309 мкмоль/м²/с, т.е. ~62% мощности.
+	if err := g.Update(ctx, at(9, 0)); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if l := g.Level(); l < 0.6 || l > 0.64 {
+		t.Errorf("Level() for DLI target = %v, want about 0.62", l)
+	}
+	_, _, off8, _ := pca.GetChannelState(8)
+	_, _, off9, _ := pca.GetChannelState(9)
+	if off8 == 0 || off8 != off9 {
+		t.Errorf("channels not driven together: %d, %d", off8, off9)
+	}
+
+	// Яркое солнце: лампа приостанавливается, но DLI продолжает накапливаться.
+	ambient = 1500
+	if err := g.Update(ctx, at(10, 0)); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if g.Level() != 0 {
+		t.Errorf("Level() with sufficient ambient light = %v, want 0", g.Level())
+	}
+	before := g.DLI()
+	if err := g.Update(ctx, at(11, 0)); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if g.DLI()-before < 5 {
+		t.Errorf("DLI() grew by %v over an hour of sunlight, want about 5.4", g.DLI()-before)
+	}
+
+	ambient = 0
+	if err := g.Update(ctx, at(6, 30)); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if g.Level() > 0.5 {
+		t.Errorf("Level() during sunrise ramp = %v, want <= 0.5", g.Level())
+	}
+}
+
+// nopI2C – адаптер без побочных эффектов для измерения накладных расходов драйвера.
+type nopI2C struct{}
+
+func (nopI2C) WriteReg(reg uint8, data []byte) error { return nil }
+func (nopI2C) ReadReg(reg uint8, data []byte) error  { return nil }
+func (nopI2C) Close() error                          { return nil }
+
+// burstNopI2C – nopI2C, допускающий пакетную запись любой длины.
+type burstNopI2C struct{ nopI2C }
+
+func (burstNopI2C) Capabilities() I2CCapabilities { return I2CCapabilities{} }
+
+func newBenchPCA(b *testing.B) *PCA9685 {
+	b.Helper()
+	config := DefaultConfig()
+	config.Logger = NewDefaultLogger(LogLevelBasic)
+	pca, err := New(nopI2C{}, config)
+	if err != nil {
+		b.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	return pca
+}
+
+func BenchmarkSetPWM(b *testing.B) {
+	pca := newBenchPCA(b)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := pca.SetPWM(ctx, i&15, 0, uint16(i&4095)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSetMultiPWM(b *testing.B) {
+	pca := newBenchPCA(b)
+	ctx := context.Background()
+	settings := make(map[int]struct{ On, Off uint16 }, 16)
+	for ch := 0; ch < 16; ch++ {
+		settings[ch] = struct{ On, Off uint16 }{0, uint16(ch * 256)}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := pca.SetMultiPWM(ctx, settings); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSetMultiPWMValues(b *testing.B) {
+	pca := newBenchPCA(b)
+	ctx := context.Background()
+	values := make([]PWMValue, 16)
+	for ch := range values {
+		values[ch] = PWMValue{Channel: ch, Off: uint16(ch * 256)}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := pca.SetMultiPWMValues(ctx, values); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestSetPWM_NoAllocs(t *testing.T) {
+	config := DefaultConfig()
+	config.Logger = NewDefaultLogger(LogLevelBasic)
+	pca, err := New(nopI2C{}, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	values := []PWMValue{{Channel: 0, Off: 1000}, {Channel: 1, On: 10, Off: 3000}}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = pca.SetPWM(ctx, 3, 0, 4000)
+		_ = pca.SetMultiPWMValues(ctx, values)
+		_ = pca.SetAllPWM(ctx, 0, 2000)
+	})
+	if allocs != 0 {
+		t.Errorf("write path allocates %v times per run, want 0", allocs)
+	}
+
+	// Пакетная запись соседних каналов также не выделяет память.
+	burst, err := New(burstNopI2C{}, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	allocs = testing.AllocsPerRun(100, func() {
+		_ = burst.SetMultiPWMValues(ctx, values)
+	})
+	if allocs != 0 {
+		t.Errorf("burst write allocates %v times per run, want 0", allocs)
+	}
+}
+
+func TestAsyncWriter(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	w := NewAsyncWriter(pca, WithFrameQueueLimit(2), WithQueueLimit(1))
+
+	// До запуска Run команды только накапливаются.
+	var order []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error { order = append(order, name); return nil }
+	}
+	first, _ := w.Frame([]PWMValue{{Channel: 0, Off: 100}})
+	if _, err := w.Submit(PriorityFrame, record("frame-2")); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if _, err := w.Submit(PriorityFrame, record("frame-3")); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if err := <-first; !errors.Is(err, ErrFrameDropped) {
+		t.Errorf("oldest frame result = %v, want ErrFrameDropped", err)
+	}
+	if _, err := w.Submit(PriorityNormal, record("normal")); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if _, err := w.Submit(PriorityNormal, record("normal-2")); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Submit() over limit error = %v, want ErrQueueFull", err)
+	}
+	stop, err := w.Submit(PrioritySafety, record("safety"))
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if frames, normal, safety := w.QueueDepth(); frames != 2 || normal != 1 || safety != 1 {
+		t.Errorf("QueueDepth() = %d, %d, %d", frames, normal, safety)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+	if err := <-stop; err != nil {
+		t.Fatalf("safety command error = %v", err)
+	}
+	last, _ := w.SetPWM(PriorityFrame, 1, 0, 2048)
+	if err := <-last; err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+
+	want := []string{"safety", "normal", "frame-2", "frame-3"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Errorf("execution order = %v, want %v", order, want)
+	}
+	if w.Dropped() != 1 {
+		t.Errorf("Dropped() = %d, want 1", w.Dropped())
+	}
+
+	t.Run("EmergencyStop", func(t *testing.T) {
+		if err := pca.SetPWM(ctx, 2, 0, 3000); err != nil {
+			t.Fatalf("SetPWM() error = %v", err)
+		}
+		result, err := w.EmergencyStop()
+		if err != nil {
+			t.Fatalf("EmergencyStop() error = %v", err)
+		}
+		if err := <-result; err != nil {
+			t.Fatalf("EmergencyStop() result = %v", err)
+		}
+		if _, _, off, _ := pca.GetChannelState(2); off != 0 {
+			t.Errorf("channel 2 after emergency stop = %d, want 0", off)
+		}
+
+		// Обычная команда, ожидающая в очереди, не включает выход после остановки.
+		gate, started := make(chan struct{}), make(chan struct{})
+		busy, _ := w.Submit(PriorityNormal, func(context.Context) error {
+			close(started)
+			<-gate
+			return nil
+		})
+		<-started
+		pending, err := w.SetPWM(PriorityNormal, 2, 0, 3000)
+		if err != nil {
+			t.Fatalf("SetPWM() error = %v", err)
+		}
+		result, err = w.EmergencyStop()
+		if err != nil {
+			t.Fatalf("EmergencyStop() error = %v", err)
+		}
+		close(gate)
+		if err := <-busy; err != nil {
+			t.Errorf("running command error = %v", err)
+		}
+		if err := <-pending; !errors.Is(err, ErrEmergencyStopped) {
+			t.Errorf("pending command result = %v, want ErrEmergencyStopped", err)
+		}
+		if err := <-result; err != nil {
+			t.Fatalf("EmergencyStop() result = %v", err)
+		}
+		if _, _, off, _ := pca.GetChannelState(2); off != 0 {
+			t.Errorf("channel 2 after emergency stop = %d, want 0", off)
+		}
+	})
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want context.Canceled", err)
+	}
+	if _, err := w.SetPWM(PriorityNormal, 1, 0, 0); !errors.Is(err, ErrWriterStopped) {
+		t.Errorf("SetPWM() after Run error = %v, want ErrWriterStopped", err)
+	}
+}
+
+// hangI2C зависает на записи, пока открыт канал hang.
+type hangI2C struct {
+	*TestI2C
+	hang chan struct{}
+}
+
+func (h *hangI2C) WriteReg(reg uint8, data []byte) error {
+	if h.hang != nil {
+		<-h.hang
+	}
+	return h.TestI2C.WriteReg(reg, data)
+}
+
+// ctxI2C реализует ContextI2C и запоминает дедлайн последней транзакции.
+type ctxI2C struct {
+	*TestI2C
+	deadline bool
+}
+
+func (c *ctxI2C) WriteRegContext(ctx context.Context, reg uint8, data []byte) error {
+	_, c.deadline = ctx.Deadline()
+	return c.WriteReg(reg, data)
+}
+
+func (c *ctxI2C) ReadRegContext(ctx context.Context, reg uint8, data []byte) error {
+	_, c.deadline = ctx.Deadline()
+	return c.ReadReg(reg, data)
+}
+
+func TestIOTimeout(t *testing.T) {
+	config := DefaultConfig()
+	config.IOTimeout = 20 * time.Millisecond
+
+	dev := &hangI2C{TestI2C: NewTestI2C()}
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	if err := pca.SetPWM(ctx, 0, 0, 1000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+
+	dev.hang = make(chan struct{})
+	defer close(dev.hang)
+	start := time.Now()
+	err = pca.SetPWM(ctx, 0, 0, 2000)
+	if !errors.Is(err, ErrIOTimeout) {
+		t.Fatalf("SetPWM() on hung bus error = %v, want ErrIOTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("SetPWM() blocked for %v", elapsed)
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 1000 {
+		t.Errorf("cached off after timeout = %d, want 1000", off)
+	}
+
+	// Канал не остаётся заблокированным после таймаута.
+	if err := pca.SetAllPWM(ctx, 0, 0); !errors.Is(err, ErrIOTimeout) {
+		t.Errorf("SetAllPWM() on hung bus error = %v, want ErrIOTimeout", err)
+	}
+
+	t.Run("ContextAdapter", func(t *testing.T) {
+		dev := &ctxI2C{TestI2C: NewTestI2C()}
+		pca, err := New(dev, config)
+		if err != nil {
+			t.Fatalf("Failed to create PCA9685: %v", err)
+		}
+		if err := pca.SetPWM(ctx, 1, 0, 100); err != nil {
+			t.Fatalf("SetPWM() error = %v", err)
+		}
+		if !dev.deadline {
+			t.Error("context adapter did not receive a deadline")
+		}
+	})
+}
+
+// failI2C возвращает ошибку записи, пока установлен fail.
+type failI2C struct {
+	*TestI2C
+	fail atomic.Bool
+}
+
+func (f *failI2C) WriteReg(reg uint8, data []byte) error {
+	if f.fail.Load() {
+		return errors.New("bus error")
+	}
+	return f.TestI2C.WriteReg(reg, data)
+}
+
+func TestOnError(t *testing.T) {
+	type report struct {
+		op      string
+		channel int
+	}
+	var (
+		mu      sync.Mutex
+		reports []report
+	)
+	config := DefaultConfig()
+	config.OnError = func(op string, channel int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, report{op, channel})
+	}
+
+	dev := &failI2C{TestI2C: NewTestI2C()}
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	if err := pca.SetPWM(ctx, 2, 0, 100); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if len(reports) != 0 {
+		t.Fatalf("OnError called for successful writes: %v", reports)
+	}
+
+	dev.fail.Store(true)
+	_ = pca.SetPWM(ctx, 2, 0, 200)
+	_ = pca.SetAllPWM(ctx, 0, 0)
+	_ = pca.FadeChannel(ctx, 5, 0, 4095, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) < 3 {
+		t.Fatalf("OnError reports = %v, want at least 3", reports)
+	}
+	want := []report{{"SetPWM", 2}, {"SetAllPWM", -1}, {"SetPWM", 5}}
+	for i, w := range want {
+		if reports[i] != w {
+			t.Errorf("report %d = %v, want %v", i, reports[i], w)
+		}
+	}
+}
+
+func TestDegradedMode(t *testing.T) {
+	events := make(chan Event, 4)
+	config := DefaultConfig()
+	config.DegradedMode = true
+	config.DegradedQueueLimit = 3
+	config.RecoveryInterval = 5 * time.Millisecond
+	config.OnEvent = func(e Event) { events <- e }
+
+	dev := &failI2C{TestI2C: NewTestI2C()}
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	dev.fail.Store(true)
+	if err := pca.SetPWM(ctx, 0, 0, 1000); err != nil {
+		t.Fatalf("SetPWM() in degraded mode error = %v", err)
+	}
+	e := <-events
+	if e.Type != EventDegraded || e.Err == nil {
+		t.Errorf("event = %+v, want EventDegraded with error", e)
+	}
+	// Повторная запись того же канала заменяет отложенную.
+	if err := pca.SetPWM(ctx, 0, 0, 2000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if err := pca.SetPWM(ctx, 1, 0, 3000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if active, pending := pca.Degraded(); !active || pending != 2 {
+		t.Errorf("Degraded() = %v, %d, want true, 2", active, pending)
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 2000 {
+		t.Errorf("cached off = %d, want 2000", off)
+	}
+	_ = pca.SetPWM(ctx, 2, 0, 1)
+	if err := pca.SetPWM(ctx, 3, 0, 1); !errors.Is(err, ErrDegradedQueueFull) {
+		t.Errorf("SetPWM() over queue limit error = %v, want ErrDegradedQueueFull", err)
+	}
+
+	dev.fail.Store(false)
+	select {
+	case e := <-events:
+		if e.Type != EventRecovered {
+			t.Errorf("event = %+v, want EventRecovered", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no recovery event")
+	}
+	if active, _ := pca.Degraded(); active {
+		t.Error("still degraded after recovery")
+	}
+	data := make([]byte, 4)
+	_ = dev.ReadReg(RegLed0, data)
+	if off := binary.LittleEndian.Uint16(data[2:]); off != 2000 {
+		t.Errorf("replayed channel 0 off = %d, want 2000", off)
+	}
+}
+
+func TestDegradedModePrescaleReplay(t *testing.T) {
+	events := make(chan Event, 4)
+	config := DefaultConfig()
+	config.DegradedMode = true
+	config.RecoveryInterval = 5 * time.Millisecond
+	config.OnEvent = func(e Event) { events <- e }
+
+	dev := &failI2C{TestI2C: NewTestI2C()}
+	dev.EnableStress(0, 1)
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+
+	dev.fail.Store(true)
+	for _, freq := range []float64{100, 300} {
+		if err := pca.SetPWMFreq(freq); err != nil {
+			t.Fatalf("SetPWMFreq(%g) in degraded mode error = %v", freq, err)
+		}
+	}
+	dev.fail.Store(false)
+	for e := range events {
+		if e.Type == EventRecovered {
+			break
+		}
+	}
+
+	// Отложенные записи MODE1 не сливаются, и PRESCALE повторяется в SLEEP.
+	if err := dev.CheckInvariants(); err != nil {
+		t.Errorf("replay broke simulator invariants: %v", err)
+	}
+	want, _ := prescaleFor(300)
+	data := make([]byte, 1)
+	_ = dev.ReadReg(RegPrescale, data)
+	if data[0] != want {
+		t.Errorf("replayed PRESCALE = %d, want %d", data[0], want)
+	}
+	_ = dev.ReadReg(RegMode1, data)
+	if data[0]&Mode1Sleep != 0 {
+		t.Errorf("MODE1 = 0x%02X after replay, want awake", data[0])
+	}
+}
+
+// overlapI2C фиксирует одновременные транзакции на общей шине.
+type overlapI2C struct {
+	*TestI2C
+	busy    *atomic.Int32
+	overlap *atomic.Bool
+}
+
+func (o overlapI2C) WriteReg(reg uint8, data []byte) error {
+	if o.busy.Add(1) > 1 {
+		o.overlap.Store(true)
+	}
+	defer o.busy.Add(-1)
+	time.Sleep(10 * time.Microsecond)
+	return o.TestI2C.WriteReg(reg, data)
+}
+
+func TestSharedBus(t *testing.T) {
+	var busy atomic.Int32
+	var overlap atomic.Bool
+	bus := NewSharedBus()
+
+	var pcas []*PCA9685
+	for i := 0; i < 3; i++ {
+		dev := overlapI2C{TestI2C: NewTestI2C(), busy: &busy, overlap: &overlap}
+		pca, err := New(bus.Device(dev), DefaultConfig())
+		if err != nil {
+			t.Fatalf("Failed to create PCA9685: %v", err)
+		}
+		pcas = append(pcas, pca)
+	}
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for _, pca := range pcas {
+		wg.Add(1)
+		go func(pca *PCA9685) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_ = pca.SetPWM(ctx, i%16, 0, uint16(i))
+			}
+		}(pca)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_ = bus.Do(func() error {
+				if busy.Load() != 0 {
+					overlap.Store(true)
+				}
+				return nil
+			})
+		}
+	}()
+	wg.Wait()
+
+	if overlap.Load() {
+		t.Error("transactions on the shared bus overlapped")
+	}
+}
+
+func TestAllCall(t *testing.T) {
+	adapter := NewTestI2C()
+	pca, err := New(adapter, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	if err := pca.SetAllCallAddress(0x71); err != nil {
+		t.Fatalf("SetAllCallAddress() error = %v", err)
+	}
+	if addr, err := pca.AllCallAddress(); err != nil || addr != 0x71 {
+		t.Errorf("AllCallAddress() = 0x%X, %v, want 0x71", addr, err)
+	}
+	if err := pca.SetAllCallAddress(0x80); err == nil {
+		t.Error("SetAllCallAddress(0x80) expected error")
+	}
+
+	if err := pca.EnableAllCall(); err != nil {
+		t.Fatalf("EnableAllCall() error = %v", err)
+	}
+	if mode1, _ := pca.readMode1(); mode1&Mode1AllCall == 0 {
+		t.Error("ALLCALL bit not set")
+	}
+	if err := pca.DisableAllCall(); err != nil {
+		t.Fatalf("DisableAllCall() error = %v", err)
+	}
+	if mode1, _ := pca.readMode1(); mode1&Mode1AllCall != 0 {
+		t.Error("ALLCALL bit still set")
+	}
+}
+
+func TestControllerGroup_WriteAllCall(t *testing.T) {
+	ctx := context.Background()
+	var members []*PCA9685
+	for i := 0; i < 2; i++ {
+		pca, err := New(NewTestI2C(), DefaultConfig())
+		if err != nil {
+			t.Fatalf("Failed to create PCA9685: %v", err)
+		}
+		if err := pca.SetPWM(ctx, 3, 0, 4000); err != nil {
+			t.Fatalf("SetPWM() error = %v", err)
+		}
+		members = append(members, pca)
+	}
+
+	if err := NewControllerGroup(nil, members...).Blackout(ctx); err == nil {
+		t.Error("WriteAllCall() without ALLCALL device expected error")
+	}
+
+	allCall := NewTestI2C()
+	group := NewControllerGroup(allCall, members...)
+	if err := group.EnableAllCall(DefaultAllCallAddress); err != nil {
+		t.Fatalf("EnableAllCall() error = %v", err)
+	}
+	if err := group.WriteAllCall(ctx, 0, 1234); err != nil {
+		t.Fatalf("WriteAllCall() error = %v", err)
+	}
+	data := make([]byte, 4)
+	_ = allCall.ReadReg(RegAllLed, data)
+	if off := binary.LittleEndian.Uint16(data[2:]); off != 1234 {
+		t.Errorf("ALLCALL ALL_LED off = %d, want 1234", off)
+	}
+	for i, pca := range group.Members() {
+		if _, _, off, _ := pca.GetChannelState(3); off != 1234 {
+			t.Errorf("member %d cached off = %d, want 1234", i, off)
+		}
+	}
+}
+
+func TestFadeMulti(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	fades := map[int]FadeSpec{
+		0: {Start: 0, End: 4095},
+		1: {Start: 4095, End: 0},
+		7: {Start: 100, End: 200},
+	}
+	start := time.Now()
+	if err := pca.FadeMulti(ctx, fades, 40*time.Millisecond); err != nil {
+		t.Fatalf("FadeMulti() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("FadeMulti() finished in %v, want at least 40ms", elapsed)
+	}
+	for ch, spec := range fades {
+		if _, _, off, _ := pca.GetChannelState(ch); off != spec.End {
+			t.Errorf("channel %d off = %d, want %d", ch, off, spec.End)
+		}
+	}
+
+	if err := pca.FadeMulti(ctx, map[int]FadeSpec{16: {}}, time.Millisecond); err == nil {
+		t.Error("FadeMulti() with invalid channel expected error")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := pca.FadeMulti(ctx, fades, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("FadeMulti() with cancelled context error = %v", err)
+	}
+}
+
+func TestFadeSpec_At(t *testing.T) {
+	f := FadeSpec{Start: 4095, End: 0}
+	if got := f.at(10, 20); got != 2048 {
+		t.Errorf("at(10, 20) = %d, want 2048", got)
+	}
+	if got := f.at(20, 20); got != 0 {
+		t.Errorf("at(20, 20) = %d, want 0", got)
+	}
+}
+
+// countI2C считает записи в регистры.
+type countI2C struct {
+	*TestI2C
+	writes atomic.Int32
+}
+
+func (c *countI2C) WriteReg(reg uint8, data []byte) error {
+	c.writes.Add(1)
+	return c.TestI2C.WriteReg(reg, data)
+}
+
+func TestFadeConfig_Steps(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  FadeConfig
+		d    time.Duration
+		want int
+	}{
+		{"default", FadeConfig{}, time.Second, 20},
+		{"fixed", FadeConfig{Steps: 100}, time.Second, 100},
+		{"adaptive long", FadeConfig{FrameRate: 50}, 10 * time.Second, 500},
+		{"adaptive short", FadeConfig{FrameRate: 50}, 10 * time.Millisecond, 1},
+		{"zero duration", FadeConfig{Steps: 100}, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.cfg.steps(tt.d); got != tt.want {
+			t.Errorf("%s: steps() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFadeChannel_Resolution(t *testing.T) {
+	dev := &countI2C{TestI2C: NewTestI2C()}
+	config := DefaultConfig()
+	config.Fade = FadeConfig{Steps: 5}
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+
+	count := func(fn func() error) int32 {
+		t.Helper()
+		before := dev.writes.Load()
+		if err := fn(); err != nil {
+			t.Fatalf("fade error = %v", err)
+		}
+		return dev.writes.Load() - before
+	}
+
+	if n := count(func() error { return pca.FadeChannel(ctx, 0, 0, 4095, 10*time.Millisecond) }); n != 6 {
+		t.Errorf("global config: %d writes, want 6", n)
+	}
+	if n := count(func() error {
+		return pca.FadeChannel(ctx, 0, 4095, 0, 10*time.Millisecond, WithFadeSteps(2))
+	}); n != 3 {
+		t.Errorf("WithFadeSteps(2): %d writes, want 3", n)
+	}
+	if n := count(func() error {
+		return pca.FadeMulti(ctx, map[int]FadeSpec{1: {0, 10}}, 40*time.Millisecond, WithFadeFrameRate(100))
+	}); n != 5 {
+		t.Errorf("WithFadeFrameRate(100): %d writes, want 5", n)
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 0 {
+		t.Errorf("channel 0 off = %d, want 0", off)
+	}
+}
+
+func TestScalePWM(t *testing.T) {
+	tests := []struct {
+		on, off       uint16
+		level         float64
+		wantOn, wantO uint16
+	}{
+		{0, 4000, 1, 0, 4000},
+		{0, 4000, 0.5, 0, 2000},
+		{0, 4000, 0, 0, 0},
+		{1000, 3000, 0.5, 1000, 2000},
+		{3000, 1000, 0.5, 3000, 4048},
+		{0x1000, 0, 0.5, 0, 2048},
+		{0, 0x1000, 0.5, 0, 0x1000},
+	}
+	for _, tt := range tests {
+		on, off := scalePWM(tt.on, tt.off, tt.level)
+		if on != tt.wantOn || off != tt.wantO {
+			t.Errorf("scalePWM(%d, %d, %v) = %d, %d, want %d, %d", tt.on, tt.off, tt.level, on, off, tt.wantOn, tt.wantO)
+		}
+	}
+}
+
+func TestMasterDimmer(t *testing.T) {
+	adapter := NewTestI2C()
+	pca, err := New(adapter, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	written := func(ch int) uint16 {
+		data := make([]byte, 4)
+		_ = adapter.ReadReg(uint8(RegLed0+4*ch), data)
+		return binary.LittleEndian.Uint16(data[2:])
+	}
+
+	if err := pca.SetPWM(ctx, 0, 0, 4000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if err := pca.SetMaster(ctx, 0.5); err != nil {
+		t.Fatalf("SetMaster() error = %v", err)
+	}
+	if got := written(0); got != 2000 {
+		t.Errorf("written off at master 0.5 = %d, want 2000", got)
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 4000 {
+		t.Errorf("cached off = %d, want 4000", off)
+	}
+	if err := pca.SetPWM(ctx, 1, 0, 1000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if got := written(1); got != 500 {
+		t.Errorf("written off for new value = %d, want 500", got)
+	}
+	if err := pca.SetMaster(ctx, 1.5); err == nil {
+		t.Error("SetMaster(1.5) expected error")
+	}
+	if err := pca.SetMaster(ctx, math.NaN()); err == nil {
+		t.Error("SetMaster(NaN) expected error")
+	}
+
+	if err := pca.FadeMaster(ctx, 1, 10*time.Millisecond); err != nil {
+		t.Fatalf("FadeMaster() error = %v", err)
+	}
+	if got := written(0); got != 4000 {
+		t.Errorf("written off after fade to 1 = %d, want 4000", got)
+	}
+
+	t.Run("Group", func(t *testing.T) {
+		other, err := New(NewTestI2C(), DefaultConfig())
+		if err != nil {
+			t.Fatalf("Failed to create PCA9685: %v", err)
+		}
+		group := NewControllerGroup(nil, pca, other)
+		if err := pca.SetMaster(ctx, 0.5); err != nil {
+			t.Fatalf("SetMaster() error = %v", err)
+		}
+		if err := group.SetMaster(ctx, 0.5); err != nil {
+			t.Fatalf("group SetMaster() error = %v", err)
+		}
+		if got := written(0); got != 1000 {
+			t.Errorf("written off at device 0.5 and group 0.5 = %d, want 1000", got)
+		}
+		if err := group.FadeMaster(ctx, 0, 10*time.Millisecond); err != nil {
+			t.Fatalf("group FadeMaster() error = %v", err)
+		}
+		if got := written(0); got != 0 {
+			t.Errorf("written off after group blackout = %d, want 0", got)
+		}
+		if group.Master() != 0 || pca.Master() != 0.5 {
+			t.Errorf("Master() = %v, %v", group.Master(), pca.Master())
+		}
+		if err := group.SetMaster(ctx, math.NaN()); err == nil {
+			t.Error("group SetMaster(NaN) expected error")
+		}
+	})
+
+	t.Run("GroupFadeConfig", func(t *testing.T) {
+		dev := &countI2C{TestI2C: NewTestI2C()}
+		config := DefaultConfig()
+		config.Fade = FadeConfig{Steps: 2}
+		member, err := New(dev, config)
+		if err != nil {
+			t.Fatalf("Failed to create PCA9685: %v", err)
+		}
+		if err := member.SetPWM(ctx, 0, 0, 4000); err != nil {
+			t.Fatalf("SetPWM() error = %v", err)
+		}
+		group := NewControllerGroup(nil, member)
+		before := dev.writes.Load()
+		if err := group.SetMaster(ctx, 1); err != nil {
+			t.Fatalf("group SetMaster() error = %v", err)
+		}
+		perStep := dev.writes.Load() - before
+		before = dev.writes.Load()
+		if err := group.FadeMaster(ctx, 0, 10*time.Millisecond); err != nil {
+			t.Fatalf("group FadeMaster() error = %v", err)
+		}
+		if n := dev.writes.Load() - before; n != 3*perStep {
+			t.Errorf("group FadeMaster with Config.Fade{Steps: 2}: %d writes, want %d", n, 3*perStep)
+		}
+	})
+}
+
+func TestWhitePointGains(t *testing.T) {
+	gains, err := WhitePointGains([3]float64{100, 200, 50}, [3]float64{1, 1, 1})
+	if err != nil {
+		t.Fatalf("WhitePointGains() error = %v", err)
+	}
+	want := [3]float64{0.5, 0.25, 1}
+	for i := range want {
+		if math.Abs(gains[i]-want[i]) > 1e-9 {
+			t.Errorf("gain[%d] = %v, want %v", i, gains[i], want[i])
+		}
+	}
+	if _, err := WhitePointGains([3]float64{0, 1, 1}, [3]float64{1, 1, 1}); err == nil {
+		t.Error("WhitePointGains() with zero measurement expected error")
+	}
+	if _, err := WhitePointGains([3]float64{1, 1, 1}, [3]float64{}); err == nil {
+		t.Error("WhitePointGains() with zero target expected error")
+	}
+	// Нулевой множитель означал бы 1.0, поэтому нулевая доля канала отклоняется.
+	if _, err := WhitePointGains([3]float64{1, 1, 1}, [3]float64{1, 1, 0}); err == nil {
+		t.Error("WhitePointGains() with zero blue target expected error")
+	}
+}
+
+func TestRGBLed_CalibrateWhitePoint(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	led, err := NewRGBLed(pca, 0, 1, 2)
+	if err != nil {
+		t.Fatalf("NewRGBLed() error = %v", err)
+	}
+	if err := led.CalibrateWhitePoint([3]float64{100, 200, 50}, [3]float64{1, 1, 1}); err != nil {
+		t.Fatalf("CalibrateWhitePoint() error = %v", err)
+	}
+	if err := led.SetColor(context.Background(), 255, 255, 255); err != nil {
+		t.Fatalf("SetColor() error = %v", err)
+	}
+	for ch, want := range map[int]uint16{0: 2047, 1: 1023, 2: 4095} {
+		if _, _, off, _ := pca.GetChannelState(ch); off != want {
+			t.Errorf("channel %d off = %d, want %d", ch, off, want)
+		}
+	}
+	if cal := led.GetCalibration(); cal.BlueGain != 1 || cal.RedMax != 4095 {
+		t.Errorf("GetCalibration() = %+v", cal)
+	}
+}
+
+func TestRGBLed_PerChannelGamma(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	led, err := NewRGBLed(pca, 0, 1, 2)
+	if err != nil {
+		t.Fatalf("NewRGBLed() error = %v", err)
+	}
+	cal := DefaultRGBCalibration()
+	cal.RedGamma = 2.0
+	cal.BlueGamma = 3.0
+	led.SetCalibration(cal)
+
+	if err := led.SetColor(context.Background(), 128, 128, 128); err != nil {
+		t.Fatalf("SetColor() error = %v", err)
+	}
+	// 128/255 ≈ 0.502: линейный зелёный, квадрат для красного, куб для синего.
+	want := map[int]uint16{0: 1031, 1: 2055, 2: 517}
+	for ch, w := range want {
+		if _, _, off, _ := pca.GetChannelState(ch); off != w {
+			t.Errorf("channel %d off = %d, want %d", ch, off, w)
+		}
+	}
+
+	if err := led.SetColor(context.Background(), 255, 255, 255); err != nil {
+		t.Fatalf("SetColor() error = %v", err)
+	}
+	for ch := 0; ch < 3; ch++ {
+		if _, _, off, _ := pca.GetChannelState(ch); off != 4095 {
+			t.Errorf("channel %d off at full = %d, want 4095", ch, off)
+		}
+	}
+}
+
+func TestRGBLed_FadeToPolicies(t *testing.T) {
+	newLed := func(t *testing.T, policy TransitionPolicy) *RGBLed {
+		t.Helper()
+		pca, err := New(NewTestI2C(), DefaultConfig())
+		if err != nil {
+			t.Fatalf("Failed to create PCA9685: %v", err)
+		}
+		led, err := NewRGBLed(pca, 0, 1, 2)
+		if err != nil {
+			t.Fatalf("NewRGBLed() error = %v", err)
+		}
+		led.SetTransitionPolicy(policy)
+		return led
+	}
+	ctx := context.Background()
+
+	t.Run("Queue", func(t *testing.T) {
+		led := newLed(t, TransitionQueue)
+		first := make(chan error, 1)
+		start := time.Now()
+		go func() { first <- led.FadeTo(ctx, 255, 0, 0, 30*time.Millisecond) }()
+		// Второй переход ставится в очередь только после начала первого.
+		for r, _, _ := led.Color(); r == 0; r, _, _ = led.Color() {
+			time.Sleep(100 * time.Microsecond)
+		}
+		if err := led.FadeTo(ctx, 0, 0, 255, 10*time.Millisecond); err != nil {
+			t.Fatalf("second FadeTo() error = %v", err)
+		}
+		if err := <-first; err != nil {
+			t.Fatalf("first FadeTo() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+			t.Errorf("queued transition finished after %v, want it to wait for the first", elapsed)
+		}
+		if r, g, b := led.Color(); r != 0 || g != 0 || b != 255 {
+			t.Errorf("Color() = %d, %d, %d, want 0, 0, 255", r, g, b)
+		}
+	})
+
+	for _, policy := range []TransitionPolicy{TransitionReplace, TransitionBlend} {
+		policy := policy
+		t.Run(fmt.Sprint(policy), func(t *testing.T) {
+			led := newLed(t, policy)
+			first := make(chan error, 1)
+			go func() { first <- led.FadeTo(ctx, 255, 255, 255, time.Second) }()
+			time.Sleep(20 * time.Millisecond)
+			start := time.Now()
+			if err := led.FadeTo(ctx, 0, 100, 0, 20*time.Millisecond); err != nil {
+				t.Fatalf("second FadeTo() error = %v", err)
+			}
+			if err := <-first; !errors.Is(err, ErrTransitionReplaced) {
+				t.Errorf("first FadeTo() error = %v, want ErrTransitionReplaced", err)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("replacing transition took %v", elapsed)
+			}
+			if r, g, b := led.Color(); r != 0 || g != 100 || b != 0 {
+				t.Errorf("Color() = %d, %d, %d, want 0, 100, 0", r, g, b)
+			}
+		})
+	}
+
+	t.Run("SetColorQueued", func(t *testing.T) {
+		led := newLed(t, TransitionQueue)
+		first := make(chan error, 1)
+		go func() { first <- led.FadeTo(ctx, 255, 0, 0, 30*time.Millisecond) }()
+		for r, _, _ := led.Color(); r == 0; r, _, _ = led.Color() {
+			time.Sleep(100 * time.Microsecond)
+		}
+		if err := led.SetColor(ctx, 0, 255, 0); err != nil {
+			t.Fatalf("SetColor() error = %v", err)
+		}
+		if err := <-first; err != nil {
+			t.Fatalf("FadeTo() error = %v", err)
+		}
+		// SetColor ждёт окончания перехода и не перезаписывается его кадрами.
+		if r, g, b := led.Color(); r != 0 || g != 255 || b != 0 {
+			t.Errorf("Color() = %d, %d, %d, want 0, 255, 0", r, g, b)
+		}
+	})
+
+	t.Run("TinyDuration", func(t *testing.T) {
+		led := newLed(t, TransitionQueue)
+		if err := led.FadeTo(ctx, 10, 20, 30, 10*time.Nanosecond); err != nil {
+			t.Fatalf("FadeTo() error = %v", err)
+		}
+		if r, g, b := led.Color(); r != 10 || g != 20 || b != 30 {
+			t.Errorf("Color() = %d, %d, %d, want 10, 20, 30", r, g, b)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		led := newLed(t, TransitionQueue)
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := led.FadeTo(cctx, 255, 0, 0, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("FadeTo() error = %v, want DeadlineExceeded", err)
+		}
+	})
+}
+
+func TestTransition_BlendAt(t *testing.T) {
+	start := time.Now()
+	old := &transition{from: [3]float64{0, 0, 0}, to: [3]float64{200, 0, 0}, start: start, dur: 100 * time.Millisecond}
+	blend := &transition{to: [3]float64{0, 0, 100}, blend: old, start: start.Add(50 * time.Millisecond), dur: 100 * time.Millisecond}
+
+	// В момент начала смешивания цвет совпадает с прежней траекторией.
+	if c := blend.at(blend.start); c != old.at(blend.start) {
+		t.Errorf("at(start) = %v, want %v", c, old.at(blend.start))
+	}
+	if c := blend.at(blend.start.Add(100 * time.Millisecond)); c != blend.to {
+		t.Errorf("at(end) = %v, want %v", c, blend.to)
+	}
+}
+
+func TestChannelOwnership(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+
+	led, err := NewRGBLed(pca, 0, 1, 2)
+	if err != nil {
+		t.Fatalf("NewRGBLed() error = %v", err)
+	}
+	if owner := pca.ChannelOwner(1); !strings.Contains(owner, "RGB LED") {
+		t.Errorf("ChannelOwner(1) = %q", owner)
+	}
+
+	if _, err := NewPump(pca, 2); !errors.Is(err, ErrChannelOwned) {
+		t.Errorf("NewPump() on owned channel error = %v, want ErrChannelOwned", err)
+	}
+	// Неудачный захват не занимает ни одного канала.
+	if _, err := NewRGBLed(pca, 3, 4, 0); !errors.Is(err, ErrChannelOwned) {
+		t.Errorf("NewRGBLed() overlapping error = %v, want ErrChannelOwned", err)
+	}
+	if owner := pca.ChannelOwner(3); owner != "" {
+		t.Errorf("channel 3 owned by %q after failed claim", owner)
+	}
+	if _, err := NewRGBLed(pca, 5, 5, 6); err == nil {
+		t.Error("NewRGBLed() with duplicate channel expected error")
+	}
+
+	led.Release()
+	pump, err := NewPump(pca, 2)
+	if err != nil {
+		t.Fatalf("NewPump() after Release() error = %v", err)
+	}
+	// Повторное освобождение старой периферии не затрагивает нового владельца.
+	led.Release()
+	if owner := pca.ChannelOwner(2); !strings.Contains(owner, "pump") {
+		t.Errorf("ChannelOwner(2) = %q, want pump", owner)
+	}
+	pump.Release()
+	if owner := pca.ChannelOwner(2); owner != "" {
+		t.Errorf("ChannelOwner(2) after Release() = %q", owner)
+	}
+}
+
+func TestDisableEnableChannels_Restore(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	state := func(ch int) (bool, uint16, uint16) {
+		enabled, on, off, _ := pca.GetChannelState(ch)
+		return enabled, on, off
+	}
+
+	if err := pca.SetPWM(ctx, 0, 10, 3000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if err := pca.SetPWM(ctx, 1, 0, 2000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+
+	if err := pca.DisableChannels(0); err != nil {
+		t.Fatalf("DisableChannels() error = %v", err)
+	}
+	if err := pca.DisableChannelsHold(1); err != nil {
+		t.Fatalf("DisableChannelsHold() error = %v", err)
+	}
+	for ch := 0; ch < 2; ch++ {
+		if enabled, _, off := state(ch); enabled || off != 0 {
+			t.Errorf("channel %d after disable: enabled=%v off=%d", ch, enabled, off)
+		}
+	}
+	if err := pca.SetPWM(ctx, 0, 0, 100); err == nil {
+		t.Error("SetPWM() on disabled channel expected error")
+	}
+	// Повторное отключение не затирает сохранённые значения.
+	if err := pca.DisableChannels(0); err != nil {
+		t.Fatalf("DisableChannels() error = %v", err)
+	}
+
+	if err := pca.EnableChannels(0, 1); err != nil {
+		t.Fatalf("EnableChannels() error = %v", err)
+	}
+	if enabled, on, off := state(0); !enabled || on != 10 || off != 3000 {
+		t.Errorf("channel 0 after enable: enabled=%v on=%d off=%d, want restored 10/3000", enabled, on, off)
+	}
+	if enabled, _, off := state(1); !enabled || off != 0 {
+		t.Errorf("channel 1 after enable: enabled=%v off=%d, want held at 0", enabled, off)
+	}
+}
+
+func TestChannelStates(t *testing.T) {
+	config := DefaultConfig()
+	config.InitialFreq = 50
+	config.InvertLogic = true
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	if err := pca.SetPWM(ctx, 3, 0, 2048); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if err := pca.SetChannelLabel(3, "servo"); err != nil {
+		t.Fatalf("SetChannelLabel() error = %v", err)
+	}
+
+	state, err := pca.GetChannel(3)
+	if err != nil {
+		t.Fatalf("GetChannel() error = %v", err)
+	}
+	if !state.Enabled || state.Off != 2048 || state.Duty != 50 || !state.Inverted || state.Label != "servo" {
+		t.Errorf("GetChannel() = %+v", state)
+	}
+	if want := 10 * time.Millisecond; state.PulseWidth < want-100*time.Microsecond || state.PulseWidth > want+100*time.Microsecond {
+		t.Errorf("PulseWidth = %v, want about %v", state.PulseWidth, want)
+	}
+	if _, err := pca.GetChannel(16); err == nil {
+		t.Error("GetChannel(16) expected error")
+	}
+
+	if err := pca.DisableChannels(5, 6); err != nil {
+		t.Fatalf("DisableChannels() error = %v", err)
+	}
+	states := pca.GetAllChannelStates()
+	if len(states) != 16 || states[3].Label != "servo" || states[5].Enabled {
+		t.Errorf("GetAllChannelStates() = %+v", states)
+	}
+	if enabled := pca.EnabledChannels(); len(enabled) != 14 || enabled[5] != 7 {
+		t.Errorf("EnabledChannels() = %v", enabled)
+	}
+
+	tests := []struct {
+		on, off uint16
+		want    int
+	}{
+		{0, 0, 0},
+		{0, 4095, 4095},
+		{0x1000, 0, 4096},
+		{0, 0x1000, 0},
+		{4000, 100, 196},
+	}
+	for _, tt := range tests {
+		if got := pulseTicks(tt.on, tt.off); got != tt.want {
+			t.Errorf("pulseTicks(%d, %d) = %d, want %d", tt.on, tt.off, got, tt.want)
+		}
+	}
+}
+
+func TestModeAccessors(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+
+	mode1, err := pca.ReadMode1()
+	if err != nil {
+		t.Fatalf("ReadMode1() error = %v", err)
+	}
+	if mode1&Mode1AutoInc == 0 {
+		t.Errorf("MODE1 = 0x%X, want auto-increment set", mode1)
+	}
+
+	if err := pca.UpdateMode1(Mode1Sub1, Mode1AutoInc); err != nil {
+		t.Fatalf("UpdateMode1() error = %v", err)
+	}
+	mode1, _ = pca.ReadMode1()
+	if mode1&Mode1Sub1 == 0 || mode1&Mode1AutoInc != 0 || mode1&Mode1Restart != 0 {
+		t.Errorf("MODE1 after UpdateMode1 = 0x%X", mode1)
+	}
+
+	if err := pca.WriteMode2(Mode2Invrt | Mode2Och); err != nil {
+		t.Fatalf("WriteMode2() error = %v", err)
+	}
+	if mode2, _ := pca.ReadMode2(); mode2 != Mode2Invrt|Mode2Och {
+		t.Errorf("MODE2 = 0x%X, want 0x%X", mode2, Mode2Invrt|Mode2Och)
+	}
+	if state, _ := pca.GetChannel(0); !state.Inverted {
+		t.Error("ChannelState.Inverted not updated after WriteMode2")
+	}
+	if err := pca.UpdateMode2(Mode2OutDrv, Mode2Invrt); err != nil {
+		t.Fatalf("UpdateMode2() error = %v", err)
+	}
+	if mode2, _ := pca.ReadMode2(); mode2 != Mode2OutDrv|Mode2Och {
+		t.Errorf("MODE2 after UpdateMode2 = 0x%X", mode2)
+	}
+	if err := pca.WriteMode1(Mode1AutoInc); err != nil {
+		t.Fatalf("WriteMode1() error = %v", err)
+	}
+	if mode1, _ := pca.ReadMode1(); mode1 != Mode1AutoInc {
+		t.Errorf("MODE1 after WriteMode1 = 0x%X", mode1)
+	}
+}
+
+func TestAutoSleep(t *testing.T) {
+	events := make(chan Event, 4)
+	config := DefaultConfig()
+	config.AutoSleep = 20 * time.Millisecond
+	config.OnEvent = func(e Event) { events <- e }
+
+	dev := NewTestI2C()
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	mode1, _ := pca.ReadMode1()
+	if mode1&Mode1Sleep != 0 {
+		t.Errorf("MODE1 after New = 0x%X, want SLEEP cleared", mode1)
+	}
+
+	if err := pca.SetPWM(ctx, 0, 0, 1000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %v while a channel is active", e.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := pca.SetPWM(ctx, 0, 0, 0); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	select {
+	case e := <-events:
+		if e.Type != EventSleep {
+			t.Fatalf("event = %v, want sleep", e.Type)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("controller did not go to sleep")
+	}
+	if !pca.IsSleeping() {
+		t.Error("IsSleeping() = false after EventSleep")
+	}
+	if mode1, _ := pca.ReadMode1(); mode1&Mode1Sleep == 0 {
+		t.Errorf("MODE1 = 0x%X, want SLEEP set", mode1)
+	}
+
+	// Запись нуля не будит микросхему.
+	if err := pca.SetPWM(ctx, 1, 0, 0); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if !pca.IsSleeping() {
+		t.Error("zero write woke the controller")
+	}
+
+	if err := pca.SetPWM(ctx, 1, 0, 2048); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if e := <-events; e.Type != EventWake {
+		t.Errorf("event = %v, want wake", e.Type)
+	}
+	if pca.IsSleeping() {
+		t.Error("IsSleeping() = true after non-zero write")
+	}
+	if mode1, _ := pca.ReadMode1(); mode1&Mode1Sleep != 0 {
+		t.Errorf("MODE1 = 0x%X, want SLEEP cleared", mode1)
+	}
+}
+
+func TestSoftStart(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	values := []PWMValue{{Channel: 2, Off: 4095}, {Channel: 0, Off: 1000}, {Channel: 1, On: 100, Off: 2000}}
+	start := time.Now()
+	if err := pca.SoftStart(ctx, values, WithStartInterval(20*time.Millisecond), WithStartRamp(10*time.Millisecond, WithFadeSteps(5))); err != nil {
+		t.Fatalf("SoftStart() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("SoftStart() took %v, want channels staggered", elapsed)
+	}
+	for _, v := range values {
+		_, on, off, _ := pca.GetChannelState(v.Channel)
+		if on != v.On || off != v.Off {
+			t.Errorf("channel %d = (%d, %d), want (%d, %d)", v.Channel, on, off, v.On, v.Off)
+		}
+	}
+
+	if err := pca.SoftStart(ctx, []PWMValue{{Channel: 16}}); err == nil {
+		t.Error("SoftStart() with invalid channel: expected error")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := pca.SoftStart(cctx, []PWMValue{{Channel: 3, Off: 100}, {Channel: 4, Off: 100}}); err == nil {
+		t.Error("SoftStart() with cancelled context: expected error")
+	}
+}
+
+func TestFailsafe(t *testing.T) {
+	events := make(chan Event, 4)
+	config := DefaultConfig()
+	config.OnEvent = func(e Event) { events <- e }
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	if _, err := NewFailsafe(pca, 0); err == nil {
+		t.Error("NewFailsafe() with zero timeout: expected error")
+	}
+	if _, err := NewFailsafe(pca, time.Second, PWMValue{Channel: 16}); err == nil {
+		t.Error("NewFailsafe() with invalid channel: expected error")
+	}
+
+	_ = pca.SetPWM(ctx, 0, 0, 3000) // насос
+	_ = pca.SetPWM(ctx, 1, 0, 2000) // освещение
+	fs, err := NewFailsafe(pca, 30*time.Millisecond, PWMValue{Channel: 0})
+	if err != nil {
+		t.Fatalf("NewFailsafe() error = %v", err)
+	}
+	defer fs.Stop()
+
+	for i := 0; i < 4; i++ {
+		time.Sleep(10 * time.Millisecond)
+		fs.Heartbeat()
+	}
+	if fs.Tripped() {
+		t.Fatal("failsafe tripped despite heartbeats")
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != EventFailsafe || !errors.Is(e.Err, ErrHeartbeatMissed) {
+			t.Errorf("event = %+v, want failsafe", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("failsafe did not trip")
+	}
+	if !fs.Tripped() {
+		t.Error("Tripped() = false after EventFailsafe")
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 0 {
+		t.Errorf("pump channel off = %d, want 0", off)
+	}
+	if _, _, off, _ := pca.GetChannelState(1); off != 2000 {
+		t.Errorf("light channel off = %d, want 2000 (hold)", off)
+	}
+
+	fs.Heartbeat()
+	if fs.Tripped() {
+		t.Error("Tripped() = true after Heartbeat")
+	}
+}
+
+func TestChannelLimits(t *testing.T) {
+	dev := NewTestI2C()
+	pca, err := New(dev, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	regOff := func(channel int) uint16 {
+		data := make([]byte, 4)
+		_ = dev.ReadReg(uint8(RegLed0+4*channel), data)
+		return uint16(data[2]) | uint16(data[3])<<8
+	}
+
+	if err := pca.SetChannelLimits(0, 3000, 2000); err == nil {
+		t.Error("SetChannelLimits() with min > max: expected error")
+	}
+	if err := pca.SetChannelLimits(0, 0, 4097); err == nil {
+		t.Error("SetChannelLimits() with max > 4096: expected error")
+	}
+	if err := pca.SetChannelLimits(0, 500, 2000); err != nil {
+		t.Fatalf("SetChannelLimits() error = %v", err)
+	}
+	if min, max, ok := pca.ChannelLimits(0); !ok || min != 500 || max != 2000 {
+		t.Errorf("ChannelLimits() = %d, %d, %v", min, max, ok)
+	}
+
+	tests := []struct {
+		off, want uint16
+	}{
+		{4000, 2000},
+		{100, 500},
+		{1500, 1500},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		if err := pca.SetPWM(ctx, 0, 0, tt.off); err != nil {
+			t.Fatalf("SetPWM() error = %v", err)
+		}
+		if got := regOff(0); got != tt.want {
+			t.Errorf("SetPWM(off=%d): register off = %d, want %d", tt.off, got, tt.want)
+		}
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 0 {
+		t.Errorf("cached off = %d, want requested value", off)
+	}
+
+	// Групповая запись не обходит ограничения.
+	if err := pca.SetAllPWM(ctx, 0, 4095); err != nil {
+		t.Fatalf("SetAllPWM() error = %v", err)
+	}
+	if got := regOff(0); got != 2000 {
+		t.Errorf("SetAllPWM: channel 0 off = %d, want 2000", got)
+	}
+	if got := regOff(1); got != 4095 {
+		t.Errorf("SetAllPWM: channel 1 off = %d, want 4095", got)
+	}
+
+	if err := pca.ClearChannelLimits(0); err != nil {
+		t.Fatalf("ClearChannelLimits() error = %v", err)
+	}
+	if got := regOff(0); got != 4095 {
+		t.Errorf("after ClearChannelLimits off = %d, want 4095", got)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+
+	pump, err := NewPump(pca, 0)
+	if err != nil {
+		t.Fatalf("NewPump() error = %v", err)
+	}
+	led, err := NewRGBLed(pca, 1, 2, 3)
+	if err != nil {
+		t.Fatalf("NewRGBLed() error = %v", err)
+	}
+
+	reg := NewRegistry()
+	if err := reg.Register("doser-ca", pump); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := reg.Register("hood", led); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := reg.Register("hood", pump); err == nil {
+		t.Error("Register() with duplicate name: expected error")
+	}
+	if err := reg.Register("", pump); err == nil {
+		t.Error("Register() with empty name: expected error")
+	}
+
+	if got, err := reg.Pump("doser-ca"); err != nil || got != pump {
+		t.Errorf("Pump() = %v, %v", got, err)
+	}
+	if got, err := reg.Led("hood"); err != nil || got != led {
+		t.Errorf("Led() = %v, %v", got, err)
+	}
+	if _, err := reg.Pump("hood"); err == nil {
+		t.Error("Pump() for an LED: expected error")
+	}
+	if _, err := reg.Led("missing"); !errors.Is(err, ErrPeripheralNotFound) {
+		t.Errorf("Led() for missing name error = %v, want ErrPeripheralNotFound", err)
+	}
+	if names := reg.Names(); len(names) != 2 || names[0] != "doser-ca" || names[1] != "hood" {
+		t.Errorf("Names() = %v", names)
+	}
+
+	reg.ReleaseAll()
+	if len(reg.Names()) != 0 {
+		t.Error("registry not empty after ReleaseAll")
+	}
+	if owner := pca.ChannelOwner(0); owner != "" {
+		t.Errorf("channel 0 still owned by %q after ReleaseAll", owner)
+	}
+}
+
+func TestCalibrations(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+
+	pump, _ := NewPump(pca, 0)
+	defer pump.Release()
+	led, _ := NewRGBLed(pca, 1, 2, 3)
+	defer led.Release()
+	reg := NewRegistry()
+	_ = reg.Register("doser-ca", pump)
+	_ = reg.Register("hood", led)
+
+	if err := pump.SetCalibration(PumpCalibration{MinSpeed: 500, MaxSpeed: 4000, FlowRate: 1.25}); err != nil {
+		t.Fatalf("SetCalibration() error = %v", err)
+	}
+	ledCal := DefaultRGBCalibration()
+	ledCal.BlueGain, ledCal.RedGamma = 0.8, 2.2
+	led.SetCalibration(ledCal)
+
+	cals := NewCalibrations()
+	cals.Capture(reg)
+	path := filepath.Join(t.TempDir(), "calibrations.json")
+	if err := cals.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	_ = pump.SetCalibration(PumpCalibration{MaxSpeed: 4095})
+	led.SetCalibration(DefaultRGBCalibration())
+
+	loaded, err := LoadCalibrations(path)
+	if err != nil {
+		t.Fatalf("LoadCalibrations() error = %v", err)
+	}
+	if err := loaded.Apply(reg); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if got := pump.Calibration(); got != (PumpCalibration{MinSpeed: 500, MaxSpeed: 4000, FlowRate: 1.25}) {
+		t.Errorf("pump calibration = %+v", got)
+	}
+	if got := led.GetCalibration(); got != ledCal {
+		t.Errorf("LED calibration = %+v, want %+v", got, ledCal)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version": 99}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCalibrations(path); err == nil {
+		t.Error("LoadCalibrations() with future version: expected error")
+	}
+
+	// Калибровка насоса под именем светодиода – ошибка типа.
+	bad := NewCalibrations()
+	bad.Pumps["hood"] = PumpCalibration{MaxSpeed: 4095}
+	if err := bad.Apply(reg); err == nil {
+		t.Error("Apply() with mismatched peripheral type: expected error")
+	}
+}
+
+func TestServoCalibration(t *testing.T) {
+	config := DefaultConfig()
+	config.InitialFreq = 50
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	cal, err := StartCalibration(ctx, pca, 0)
+	if err != nil {
+		t.Fatalf("StartCalibration() error = %v", err)
+	}
+	if _, err := NewServo(pca, 0, DefaultServoCalibration()); !errors.Is(err, ErrChannelOwned) {
+		t.Errorf("NewServo() during calibration error = %v, want ErrChannelOwned", err)
+	}
+	if _, err := cal.Finish(180); err == nil {
+		t.Error("Finish() without marks: expected error")
+	}
+
+	_ = cal.SetPulse(ctx, 600*time.Microsecond)
+	cal.MarkMin()
+	_ = cal.SetPulse(ctx, 2400*time.Microsecond)
+	cal.MarkMax()
+	for i := 0; i < 4; i++ {
+		_ = cal.Nudge(ctx, -200*time.Microsecond)
+	}
+	if got := cal.Pulse(); got != 1600*time.Microsecond {
+		t.Errorf("Pulse() after Nudge = %v, want 1.6ms", got)
+	}
+	cal.MarkCenter()
+	result, err := cal.Finish(180)
+	if err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	want := ServoCalibration{MinPulse: 600 * time.Microsecond, CenterPulse: 1600 * time.Microsecond, MaxPulse: 2400 * time.Microsecond, Range: 180}
+	if result != want {
+		t.Errorf("Finish() = %+v, want %+v", result, want)
+	}
+
+	servo, err := NewServo(pca, 0, result)
+	if err != nil {
+		t.Fatalf("NewServo() error = %v", err)
+	}
+	defer servo.Release()
+	tests := []struct {
+		angle float64
+		pulse time.Duration
+	}{
+		{0, 600 * time.Microsecond},
+		{90, 1600 * time.Microsecond},
+		{135, 2000 * time.Microsecond},
+		{180, 2400 * time.Microsecond},
+	}
+	for _, tt := range tests {
+		if err := servo.SetAngle(ctx, tt.angle); err != nil {
+			t.Fatalf("SetAngle(%g) error = %v", tt.angle, err)
+		}
+		state, _ := pca.GetChannel(0)
+		if diff := state.PulseWidth - tt.pulse; diff < -10*time.Microsecond || diff > 10*time.Microsecond {
+			t.Errorf("SetAngle(%g): pulse = %v, want %v", tt.angle, state.PulseWidth, tt.pulse)
+		}
+	}
+	if err := servo.SetAngle(ctx, 181); err == nil {
+		t.Error("SetAngle() out of range: expected error")
+	}
+	if _, err := NewServo(pca, 1, ServoCalibration{MinPulse: 1, CenterPulse: 3, MaxPulse: 2, Range: 90}); err == nil {
+		t.Error("NewServo() with inconsistent calibration: expected error")
+	}
+}
+
+func TestESCCalibrate(t *testing.T) {
+	config := DefaultConfig()
+	config.InitialFreq = 50
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	esc, err := NewESC(ctx, pca, 0, DefaultESCCalibration())
+	if err != nil {
+		t.Fatalf("NewESC() error = %v", err)
+	}
+	defer esc.Release()
+	pulse := func() time.Duration {
+		state, _ := pca.GetChannel(0)
+		return state.PulseWidth.Round(10 * time.Microsecond)
+	}
+	if got := pulse(); got != time.Millisecond {
+		t.Errorf("pulse after NewESC = %v, want 1ms", got)
+	}
+
+	var steps []ESCCalibrationStep
+	var maxPulse time.Duration
+	err = esc.Calibrate(ctx,
+		WithESCPrompt(func(s ESCCalibrationStep) { steps = append(steps, s) }),
+		WithESCConfirm(func(context.Context) error {
+			maxPulse = pulse()
+			return nil
+		}),
+		WithESCHold(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatalf("Calibrate() error = %v", err)
+	}
+	if maxPulse != 2*time.Millisecond {
+		t.Errorf("pulse during max step = %v, want 2ms", maxPulse)
+	}
+	if len(steps) != 3 || steps[0] != ESCStepMaxThrottle || steps[2] != ESCStepDone {
+		t.Errorf("steps = %v", steps)
+	}
+	if got := pulse(); got != time.Millisecond {
+		t.Errorf("pulse after Calibrate = %v, want 1ms", got)
+	}
+
+	// Отмена на шаге полного газа возвращает нулевой газ.
+	cctx, cancel := context.WithCancel(ctx)
+	err = esc.Calibrate(cctx, WithESCConfirm(func(ctx context.Context) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Calibrate() with cancel error = %v", err)
+	}
+	if got := pulse(); got != time.Millisecond {
+		t.Errorf("pulse after cancelled Calibrate = %v, want 1ms", got)
+	}
+
+	if err := esc.SetThrottle(ctx, 50); err != nil {
+		t.Fatalf("SetThrottle() error = %v", err)
+	}
+	if got := pulse(); got != 1500*time.Microsecond {
+		t.Errorf("pulse at 50%% = %v, want 1.5ms", got)
+	}
+}
+
+func TestTrajectoryPlayer(t *testing.T) {
+	config := DefaultConfig()
+	config.InitialFreq = 50
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	arm, _ := NewServo(pca, 0, DefaultServoCalibration())
+	defer arm.Release()
+	wrist, _ := NewServo(pca, 1, DefaultServoCalibration())
+	defer wrist.Release()
+
+	if _, err := NewTrajectoryPlayer([]ServoTrack{{Servo: arm, Keyframes: []Keyframe{{At: time.Second}, {At: 0}}}}); err == nil {
+		t.Error("NewTrajectoryPlayer() with unordered keyframes: expected error")
+	}
+	if _, err := NewTrajectoryPlayer([]ServoTrack{{Servo: arm, Keyframes: []Keyframe{{Angle: 200}}}}); err == nil {
+		t.Error("NewTrajectoryPlayer() with angle out of range: expected error")
+	}
+
+	player, err := NewTrajectoryPlayer([]ServoTrack{
+		{Servo: arm, Keyframes: []Keyframe{{At: 0, Angle: 0}, {At: 100 * time.Millisecond, Angle: 180}}},
+		{Servo: wrist, Keyframes: []Keyframe{{At: 0, Angle: 90}, {At: 40 * time.Millisecond, Angle: 0, Easing: EaseInOut}}},
+	}, WithTrajectoryFrameRate(200))
+	if err != nil {
+		t.Fatalf("NewTrajectoryPlayer() error = %v", err)
+	}
+	if player.Duration() != 100*time.Millisecond {
+		t.Errorf("Duration() = %v", player.Duration())
+	}
+
+	// Перемотка без воспроизведения сразу выводит сервоприводы в положение.
+	if err := player.Seek(ctx, 50*time.Millisecond); err != nil {
+		t.Fatalf("Seek() error = %v", err)
+	}
+	if arm.Angle() != 90 || wrist.Angle() != 0 {
+		t.Errorf("after Seek angles = %g, %g, want 90, 0", arm.Angle(), wrist.Angle())
+	}
+	if err := player.Seek(ctx, time.Second); err == nil {
+		t.Error("Seek() beyond duration: expected error")
+	}
+
+	if err := player.Play(ctx); err != nil {
+		t.Fatalf("Play() error = %v", err)
+	}
+	player.Pause()
+	paused := player.Position()
+	time.Sleep(30 * time.Millisecond)
+	if player.State() != SequencerPaused || player.Position() != paused {
+		t.Errorf("position advanced while paused: %v -> %v", paused, player.Position())
+	}
+	_ = player.Play(ctx)
+	if err := player.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if arm.Angle() != 180 || wrist.Angle() != 0 {
+		t.Errorf("final angles = %g, %g, want 180, 0", arm.Angle(), wrist.Angle())
+	}
+	if player.State() != SequencerStopped {
+		t.Errorf("State() = %v, want stopped", player.State())
+	}
+}
+
+func TestEasing(t *testing.T) {
+	for _, e := range []Easing{EaseLinear, EaseInOut, EaseIn, EaseOut, EaseStep} {
+		if e.apply(0) != 0 || math.Abs(e.apply(1)-1) > 1e-9 {
+			t.Errorf("easing %d: endpoints = %g, %g", e, e.apply(0), e.apply(1))
+		}
+	}
+	if got := EaseInOut.apply(0.5); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("EaseInOut(0.5) = %g", got)
+	}
+	if EaseIn.apply(0.5) >= 0.5 || EaseOut.apply(0.5) <= 0.5 {
+		t.Error("EaseIn/EaseOut have the wrong curvature")
+	}
+}
+
+// regFailI2C отклоняет записи в регистр reg (-1 – ни в какой).
+type regFailI2C struct {
+	*TestI2C
+	reg int
+}
+
+func (f *regFailI2C) WriteReg(reg uint8, data []byte) error {
+	if int(reg) == f.reg {
+		return errors.New("bus error")
+	}
+	return f.TestI2C.WriteReg(reg, data)
+}
+
+func TestApplyFailsafeContinuesAfterError(t *testing.T) {
+	dev := &regFailI2C{TestI2C: NewTestI2C(), reg: -1}
+	pca, err := New(dev, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	for _, ch := range []int{0, 2, 4} {
+		_ = pca.SetPWM(ctx, ch, 0, 4095)
+		if err := pca.SetChannelFailsafe(ch, 0, 100); err != nil {
+			t.Fatalf("SetChannelFailsafe() error = %v", err)
+		}
+	}
+
+	// Ошибка записи канала 2 не мешает установить остальные.
+	dev.reg = RegLed0 + 4*2
+	err = pca.ApplyFailsafe(ctx)
+	if err == nil || !strings.Contains(err.Error(), "channel 2") {
+		t.Errorf("ApplyFailsafe() error = %v, want channel 2 failure", err)
+	}
+	for _, ch := range []int{0, 4} {
+		if _, _, off, _ := pca.GetChannelState(ch); off != 100 {
+			t.Errorf("channel %d off after ApplyFailsafe = %d, want 100", ch, off)
+		}
+	}
+}
+
+func TestChannelFailsafe(t *testing.T) {
+	config := DefaultConfig()
+	config.InitialFreq = 50
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	damper, _ := NewServo(pca, 0, DefaultServoCalibration())
+	defer damper.Release()
+	if err := damper.SetFailsafeAngle(90); err != nil {
+		t.Fatalf("SetFailsafeAngle() error = %v", err)
+	}
+	if err := pca.SetChannelFailsafe(1, 0, 1228); err != nil { // вентилятор 30%
+		t.Fatalf("SetChannelFailsafe() error = %v", err)
+	}
+	if _, off, ok := pca.ChannelFailsafe(1); !ok || off != 1228 {
+		t.Errorf("ChannelFailsafe(1) = %d, %v", off, ok)
+	}
+	_ = damper.SetAngle(ctx, 0)
+	_ = pca.SetPWM(ctx, 1, 0, 4095)
+	_ = pca.SetPWM(ctx, 2, 0, 4095)
+
+	if err := pca.EmergencyStop(ctx); err != nil {
+		t.Fatalf("EmergencyStop() error = %v", err)
+	}
+	if state, _ := pca.GetChannel(0); state.PulseWidth.Round(10*time.Microsecond) != 1500*time.Microsecond {
+		t.Errorf("damper pulse after EmergencyStop = %v, want 1.5ms", state.PulseWidth)
+	}
+	if _, _, off, _ := pca.GetChannelState(1); off != 1228 {
+		t.Errorf("fan off after EmergencyStop = %d, want 1228", off)
+	}
+	if _, _, off, _ := pca.GetChannelState(2); off != 0 {
+		t.Errorf("channel 2 off after EmergencyStop = %d, want 0", off)
+	}
+
+	// Сторожевой таймер применяет те же значения; явные значения имеют приоритет.
+	_ = pca.SetPWM(ctx, 1, 0, 4095)
+	fs, _ := NewFailsafe(pca, 10*time.Millisecond, PWMValue{Channel: 1, Off: 100})
+	defer fs.Stop()
+	fanOff := func() uint16 {
+		_, _, off, _ := pca.GetChannelState(1)
+		return off
+	}
+	deadline := time.Now().Add(time.Second)
+	for fanOff() != 100 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if off := fanOff(); off != 100 {
+		t.Errorf("fan off after failsafe trip = %d, want 100", off)
+	}
+
+	if err := pca.ClearChannelFailsafe(1); err != nil {
+		t.Fatalf("ClearChannelFailsafe() error = %v", err)
+	}
+	if _, _, ok := pca.ChannelFailsafe(1); ok {
+		t.Error("ChannelFailsafe(1) still set after Clear")
+	}
+}
+
+func TestPumpInterlock(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	t.Run("Fail", func(t *testing.T) {
+		group := NewPumpInterlock("manifold", InterlockFail)
+		a, _ := NewPump(pca, 0, WithInterlock(group))
+		defer a.Release()
+		b, _ := NewPump(pca, 1, WithInterlock(group))
+		defer b.Release()
+
+		if err := a.SetSpeed(ctx, 50); err != nil {
+			t.Fatalf("SetSpeed(a) error = %v", err)
+		}
+		if err := a.SetSpeed(ctx, 80); err != nil {
+			t.Errorf("SetSpeed(a) while holding the group error = %v", err)
+		}
+		if err := b.SetSpeed(ctx, 50); !errors.Is(err, ErrInterlocked) {
+			t.Errorf("SetSpeed(b) error = %v, want ErrInterlocked", err)
+		}
+		if err := b.Stop(ctx); err != nil {
+			t.Errorf("Stop(b) error = %v", err)
+		}
+		if group.Active() != a {
+			t.Error("Active() != a")
+		}
+		_ = a.Stop(ctx)
+		if err := b.SetSpeed(ctx, 50); err != nil {
+			t.Errorf("SetSpeed(b) after a stopped error = %v", err)
+		}
+		_ = b.Stop(ctx)
+	})
+
+	t.Run("Queue", func(t *testing.T) {
+		group := NewPumpInterlock("dosers", InterlockQueue)
+		a, _ := NewPump(pca, 2, WithInterlock(group))
+		defer a.Release()
+		b, _ := NewPump(pca, 3, WithInterlock(group))
+		defer b.Release()
+
+		_ = a.SetSpeed(ctx, 100)
+		started := make(chan error, 1)
+		go func() { started <- b.SetSpeed(ctx, 100) }()
+		select {
+		case err := <-started:
+			t.Fatalf("b started while a runs: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		_ = a.Stop(ctx)
+		if err := <-started; err != nil {
+			t.Fatalf("queued SetSpeed(b) error = %v", err)
+		}
+		if group.Active() != b {
+			t.Error("Active() != b after queue")
+		}
+
+		cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := a.SetSpeed(cctx, 100); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("queued SetSpeed(a) with deadline error = %v", err)
+		}
+		b.Release()
+		if group.Active() != nil {
+			t.Error("Release() did not free the interlock")
+		}
+	})
+}
+
+func TestPumpMaxRuntime(t *testing.T) {
+	events := make(chan Event, 4)
+	config := DefaultConfig()
+	config.OnEvent = func(e Event) { events <- e }
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	pump, err := NewPump(pca, 4, WithMaxRuntime(30*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewPump() error = %v", err)
+	}
+	defer pump.Release()
+
+	// Остановка до истечения времени сбрасывает отсчёт.
+	_ = pump.SetSpeed(ctx, 50)
+	time.Sleep(10 * time.Millisecond)
+	_ = pump.Stop(ctx)
+	time.Sleep(30 * time.Millisecond)
+	if pump.CutoffTripped() {
+		t.Fatal("cutoff tripped for a stopped pump")
+	}
+
+	_ = pump.SetSpeed(ctx, 50)
+	_ = pump.SetSpeed(ctx, 70) // изменение скорости не продлевает время работы
+	select {
+	case e := <-events:
+		if e.Type != EventPumpCutoff || e.Channel != 4 {
+			t.Errorf("event = %+v, want pump cutoff on channel 4", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pump was not cut off")
+	}
+	if _, _, off, _ := pca.GetChannelState(4); off != 0 {
+		t.Errorf("pump off = %d after cutoff, want 0", off)
+	}
+	if err := pump.SetSpeed(ctx, 50); !errors.Is(err, ErrPumpCutoff) {
+		t.Errorf("SetSpeed() after cutoff error = %v, want ErrPumpCutoff", err)
+	}
+	if err := pump.Stop(ctx); err != nil {
+		t.Errorf("Stop() after cutoff error = %v", err)
+	}
+
+	pump.ResetCutoff()
+	if err := pump.SetSpeed(ctx, 50); err != nil {
+		t.Errorf("SetSpeed() after ResetCutoff error = %v", err)
+	}
+	_ = pump.Stop(ctx)
+}
+
+func TestPumpCutoffBypassesArbitration(t *testing.T) {
+	events := make(chan Event, 4)
+	config := DefaultConfig()
+	config.OnEvent = func(e Event) { events <- e }
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	pca.SetSourcePriority("scheduler", 10)
+
+	pump, err := NewPump(pca, 4, WithMaxRuntime(30*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewPump() error = %v", err)
+	}
+	defer pump.Release()
+	if err := pump.SetSpeed(WithSource(context.Background(), "scheduler"), 50); err != nil {
+		t.Fatalf("SetSpeed() error = %v", err)
+	}
+	select {
+	case e := <-events:
+		if e.Type != EventPumpCutoff || e.Err != nil {
+			t.Errorf("event = %+v, want pump cutoff without error", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pump was not cut off")
+	}
+	// Канал, удерживаемый источником с высоким приоритетом, всё равно выключен.
+	if _, _, off, _ := pca.GetChannelState(4); off != 0 {
+		t.Errorf("pump off = %d after cutoff, want 0", off)
+	}
+}
+
+func TestPumpCalibrate(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	pump, _ := NewPump(pca, 5)
+	defer pump.Release()
+
+	rate, err := pump.Calibrate(ctx, 20*time.Millisecond, func(context.Context) (float64, error) {
+		return 0.5, nil
+	})
+	if err != nil {
+		t.Fatalf("Calibrate() error = %v", err)
+	}
+	if math.Abs(rate-25) > 1e-9 {
+		t.Errorf("Calibrate() rate = %g, want 25 ml/s", rate)
+	}
+	if got := pump.Calibration().FlowRate; got != rate {
+		t.Errorf("Calibration().FlowRate = %g, want %g", got, rate)
+	}
+	if _, _, off, _ := pca.GetChannelState(5); off != 0 {
+		t.Errorf("pump off = %d after calibration, want 0", off)
+	}
+
+	if _, err := pump.Calibrate(ctx, 10*time.Millisecond, func(context.Context) (float64, error) { return 0, nil }); err == nil {
+		t.Error("Calibrate() with zero volume: expected error")
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	if _, err := pump.Calibrate(cctx, time.Second, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Calibrate() with deadline error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(5); off != 0 {
+		t.Errorf("pump off = %d after cancelled calibration, want 0", off)
+	}
+}
+
+// fakeCurrentSensor – датчик тока с задаваемым значением.
+type fakeCurrentSensor struct {
+	amps atomic.Uint64
+}
+
+func (s *fakeCurrentSensor) set(a float64) { s.amps.Store(math.Float64bits(a)) }
+
+func (s *fakeCurrentSensor) Current(context.Context) (float64, error) {
+	return math.Float64frombits(s.amps.Load()), nil
+}
+
+func TestStallDetector(t *testing.T) {
+	events := make(chan Event, 4)
+	config := DefaultConfig()
+	config.OnEvent = func(e Event) { events <- e }
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pump, _ := NewPump(pca, 6)
+	defer pump.Release()
+	sensor := &fakeCurrentSensor{}
+	if _, err := pump.StallDetector(sensor, StallConfig{Min: 1, Max: 0.5}); err == nil {
+		t.Error("StallDetector() with inverted band: expected error")
+	}
+	det, err := pump.StallDetector(sensor, StallConfig{Min: 0.2, Max: 1, Hold: 20 * time.Millisecond, Interval: 2 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("StallDetector() error = %v", err)
+	}
+	go det.Run(ctx)
+
+	// Остановленный насос с нулевым током – не сухой ход.
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %v for a stopped pump", e.Type)
+	default:
+	}
+
+	sensor.set(0.5)
+	_ = pump.SetSpeed(ctx, 80)
+	time.Sleep(30 * time.Millisecond)
+	if pump.CutoffTripped() {
+		t.Fatal("stall detected with current inside the band")
+	}
+
+	sensor.set(0.05) // сухой ход
+	select {
+	case e := <-events:
+		if e.Type != EventStall || e.Channel != 6 || !errors.Is(e.Err, ErrStall) {
+			t.Errorf("event = %+v, want stall on channel 6", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("dry run not detected")
+	}
+	if !pump.CutoffTripped() {
+		t.Error("pump not latched after stall")
+	}
+	if _, _, off, _ := pca.GetChannelState(6); off != 0 {
+		t.Errorf("pump off = %d after stall, want 0", off)
+	}
+}
+
+func TestBidirectionalPumpBackflush(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	pump, err := NewBidirectionalPump(pca, 7, 8, WithDeadTime(15*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewBidirectionalPump() error = %v", err)
+	}
+	defer pump.Release()
+	offs := func() (uint16, uint16) {
+		_, _, fwd, _ := pca.GetChannelState(7)
+		_, _, rev, _ := pca.GetChannelState(8)
+		return fwd, rev
+	}
+
+	if err := pump.SetSpeed(ctx, 50); err != nil {
+		t.Fatalf("SetSpeed() error = %v", err)
+	}
+	if fwd, rev := offs(); fwd != 2048 || rev != 0 {
+		t.Errorf("forward 50%%: channels = %d, %d", fwd, rev)
+	}
+
+	start := time.Now()
+	if err := pump.Backflush(ctx, 10*time.Millisecond, 100); err != nil {
+		t.Fatalf("Backflush() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Backflush() took %v, want two dead times plus duration", elapsed)
+	}
+	if pump.Speed() != 50 {
+		t.Errorf("Speed() after Backflush = %g, want 50", pump.Speed())
+	}
+	if fwd, rev := offs(); fwd != 2048 || rev != 0 {
+		t.Errorf("after Backflush channels = %d, %d, want prior state", fwd, rev)
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := pump.Backflush(cctx, time.Second, 80); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Backflush() with deadline error = %v", err)
+	}
+	if fwd, rev := offs(); fwd != 0 || rev != 0 {
+		t.Errorf("after cancelled Backflush channels = %d, %d, want stopped", fwd, rev)
+	}
+	if err := pump.SetSpeed(ctx, -101); err == nil {
+		t.Error("SetSpeed(-101): expected error")
+	}
+}
+
+func TestCanvas(t *testing.T) {
+	pcaA, _ := New(NewTestI2C(), DefaultConfig())
+	defer pcaA.Close()
+	pcaB, _ := New(NewTestI2C(), DefaultConfig())
+	defer pcaB.Close()
+	ctx := context.Background()
+
+	// Холст 2×2: верхний ряд на первом контроллере, нижний – на втором.
+	canvas, err := NewCanvas(2, 2)
+	if err != nil {
+		t.Fatalf("NewCanvas() error = %v", err)
+	}
+	var leds []*RGBLed
+	for i, pca := range []*PCA9685{pcaA, pcaA, pcaB, pcaB} {
+		base := (i % 2) * 3
+		led, err := NewRGBLed(pca, base, base+1, base+2)
+		if err != nil {
+			t.Fatalf("NewRGBLed() error = %v", err)
+		}
+		defer led.Release()
+		leds = append(leds, led)
+		if err := canvas.Place(i%2, i/2, led); err != nil {
+			t.Fatalf("Place() error = %v", err)
+		}
+	}
+	if err := canvas.Place(2, 0, leds[0]); err == nil {
+		t.Error("Place() outside the canvas: expected error")
+	}
+
+	canvas.Fill(0, 0, 255)
+	if err := canvas.SetPixel(1, 1, 255, 0, 0); err != nil {
+		t.Fatalf("SetPixel() error = %v", err)
+	}
+	if err := canvas.Render(ctx); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if _, _, off, _ := pcaB.GetChannelState(3); off != 4095 {
+		t.Errorf("pixel (1,1) red = %d, want 4095", off)
+	}
+	if _, _, off, _ := pcaA.GetChannelState(2); off != 4095 {
+		t.Errorf("pixel (0,0) blue = %d, want 4095", off)
+	}
+	if r, g, b := leds[3].Color(); r != 255 || g != 0 || b != 0 {
+		t.Errorf("LED color after Render = %d,%d,%d", r, g, b)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	img.Set(0, 1, color.RGBA{G: 255, A: 255})
+	canvas.Draw(img)
+	if r, g, b, _ := canvas.Pixel(0, 1); r != 0 || g != 255 || b != 0 {
+		t.Errorf("Pixel(0,1) after Draw = %d,%d,%d", r, g, b)
+	}
+}
+
+func TestDMXFixtures(t *testing.T) {
+	config := DefaultConfig()
+	config.InitialFreq = 50
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	led, _ := NewRGBLed(pca, 0, 1, 2)
+	defer led.Release()
+	servo, _ := NewServo(pca, 3, DefaultServoCalibration())
+	defer servo.Release()
+
+	mapper := NewDMXMapper()
+	fixtures := []struct {
+		start   int
+		fixture DMXFixture
+	}{
+		{1, DMXRGB{Led: led}},                               // слоты 1–3
+		{4, DMXDimmer{Device: pca, Channel: 4, Fine: true}}, // слоты 4–5
+		{6, DMXServo{Servo: servo}},                         // слот 6
+		{8, DMXRGB{Led: led, Fine: true}},                   // слоты 8–13, в кадре отсутствуют
+	}
+	for _, f := range fixtures {
+		if err := mapper.AddFixture(1, f.start, f.fixture); err != nil {
+			t.Fatalf("AddFixture(%d) error = %v", f.start, err)
+		}
+	}
+	if err := mapper.AddFixture(1, 511, DMXRGB{Led: led}); err == nil {
+		t.Error("AddFixture() past the universe end: expected error")
+	}
+
+	data := []byte{255, 0, 51, 0x80, 0x00, 0, 0}
+	if err := mapper.Apply(ctx, 1, data); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 4095 {
+		t.Errorf("red = %d, want 4095", off)
+	}
+	if _, _, off, _ := pca.GetChannelState(2); off != 819 {
+		t.Errorf("blue = %d, want 819", off)
+	}
+	if _, _, off, _ := pca.GetChannelState(4); off != 2048 {
+		t.Errorf("16-bit dimmer = %d, want 2048", off)
+	}
+	if servo.Angle() != 0 {
+		t.Errorf("servo angle = %g, want 0", servo.Angle())
+	}
+	if err := mapper.Apply(ctx, 2, data); err != nil {
+		t.Fatalf("Apply() for another universe error = %v", err)
+	}
+
+	if got := (DMXRGB{Fine: true}).Footprint(); got != 6 {
+		t.Errorf("fine RGB footprint = %d, want 6", got)
+	}
+}
+
+func TestColorSchedule(t *testing.T) {
+	schedule := ColorSchedule{
+		{At: DailyTrigger{Hour: 8}, Kelvin: 6000, Brightness: 1},
+		{At: DailyTrigger{Hour: 20}, Kelvin: 3000, Brightness: 0.5},
+		{At: DailyTrigger{Hour: 22}, Kelvin: 8000, Brightness: 0.1},
+	}
+	at := func(hour, min int) time.Time { return time.Date(2024, 5, 1, hour, min, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name           string
+		hour, min      int
+		kelvin, bright float64
+	}{
+		{"AtPoint", 8, 0, 6000, 1},
+		{"Between", 21, 0, 5500, 0.3},
+		{"AcrossMidnight", 3, 0, 7000, 0.55},
+		{"BeforeFirst", 7, 0, 6200, 0.91},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, b := schedule.At(at(tt.hour, tt.min))
+			if math.Abs(k-tt.kelvin) > 1e-6 || math.Abs(b-tt.bright) > 1e-6 {
+				t.Errorf("At() = %v, %v; want %v, %v", k, b, tt.kelvin, tt.bright)
+			}
+		})
+	}
+
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := NewColorScheduler(ColorSchedule{schedule[1], schedule[0]}, nil); err == nil {
+		t.Error("NewColorScheduler() expected error without LEDs")
+	}
+	a, err := NewRGBLed(pca, 0, 1, 2)
+	if err != nil {
+		t.Fatalf("NewRGBLed() error = %v", err)
+	}
+	b, err := NewRGBLed(pca, 3, 4, 5)
+	if err != nil {
+		t.Fatalf("NewRGBLed() error = %v", err)
+	}
+	if _, err := NewColorScheduler(ColorSchedule{schedule[1], schedule[0]}, []*RGBLed{a}); err == nil {
+		t.Error("NewColorScheduler() expected error for unsorted schedule")
+	}
+
+	cs, err := NewColorScheduler(schedule, []*RGBLed{a, b})
+	if err != nil {
+		t.Fatalf("NewColorScheduler() error = %v", err)
+	}
+	if err := cs.Update(ctx, at(12, 0)); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if k, br := cs.Current(); k != 5000 || math.Abs(br-5.0/6) > 1e-9 {
+		t.Errorf("Current() = %v, %v", k, br)
+	}
+	ar, ag, ab := a.Color()
+	br, bg, bb := b.Color()
+	if ar != br || ag != bg || ab != bb || ar == 0 {
+		t.Errorf("LED colors = (%d,%d,%d) and (%d,%d,%d), want equal non-zero", ar, ag, ab, br, bg, bb)
+	}
+}
+
+func TestRenderer(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	r := NewRenderer(pca, WithRenderFrameRate(100))
+
+	if err := r.Set(0, 0, 1000); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := r.Set(16, 0, 1000); err == nil {
+		t.Error("Set() expected error for invalid channel")
+	}
+	start := time.Now()
+	r.Add("ramp", RenderFunc(func(now time.Time, f *RenderFrame) bool {
+		step := uint16(now.Sub(start) / time.Second)
+		f.Set(1, 0, 100*step)
+		f.Set(2, 0, 500)
+		return step < 3
+	}))
+	r.Add("override", RenderFunc(func(now time.Time, f *RenderFrame) bool {
+		f.Set(2, 0, 700)
+		return true
+	}))
+
+	for i := 0; i < 2; i++ {
+		if err := r.Render(ctx, start); err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+	}
+	if frames, writes := r.Stats(); frames != 2 || writes != 3 {
+		t.Errorf("Stats() = %d, %d; want 2 frames, 3 writes", frames, writes)
+	}
+	if _, _, off, _ := pca.GetChannelState(2); off != 700 {
+		t.Errorf("channel 2 = %d, want override value 700", off)
+	}
+
+	if err := r.Render(ctx, start.Add(2*time.Second)); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if _, writes := r.Stats(); writes != 4 {
+		t.Errorf("writes = %d, want only the changed channel written", writes)
+	}
+	if err := r.Render(ctx, start.Add(3*time.Second)); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(1); off != 300 {
+		t.Errorf("channel 1 = %d, want 300", off)
+	}
+
+	// Источник ramp завершён; после Invalidate записываются все заданные каналы.
+	r.Invalidate()
+	if err := r.Render(ctx, start.Add(4*time.Second)); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if _, writes := r.Stats(); writes != 7 {
+		t.Errorf("writes = %d, want 7 after invalidate", writes)
+	}
+
+	r.Add("bad", RenderFunc(func(now time.Time, f *RenderFrame) bool {
+		f.Set(3, 0, 5000)
+		return true
+	}))
+	if err := r.Render(ctx, start); err == nil {
+		t.Error("Render() expected error for invalid frame value")
+	}
+}
+
+func TestStateReadsDoNotBlock(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	if err := pca.SetPWM(context.Background(), 3, 0, 1234); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if err := pca.SetChannelLabel(3, "pump"); err != nil {
+		t.Fatalf("SetChannelLabel() error = %v", err)
+	}
+
+	// Имитируем длительную запись: мьютексы контроллера и канала заняты.
+	pca.mu.Lock()
+	pca.channels[3].mu.Lock()
+	done := make(chan ChannelState)
+	go func() {
+		state, _ := pca.GetChannel(3)
+		pca.DumpState()
+		pca.GetAllChannelStates()
+		done <- state
+	}()
+	select {
+	case state := <-done:
+		if state.Off != 1234 || state.Label != "pump" || state.PulseWidth == 0 {
+			t.Errorf("GetChannel() = %+v", state)
+		}
+	case <-time.After(time.Second):
+		t.Error("state reads blocked by the write path")
+	}
+	pca.channels[3].mu.Unlock()
+	pca.mu.Unlock()
+}
+
+func TestFramePool(t *testing.T) {
+	buf, frame := encodeFrame(RegLed0, []byte{1, 2, 3, 4})
+	if !bytes.Equal(frame, []byte{RegLed0, 1, 2, 3, 4}) {
+		t.Errorf("encodeFrame() = %v", frame)
+	}
+	releaseFrame(buf)
+
+	if buf, frame := acquireFrame(maxFrameSize + 1); buf != nil || len(frame) != maxFrameSize+1 {
+		t.Errorf("acquireFrame() for oversized frame returned pooled buffer")
+	}
+
+	data := make([]byte, 4*16)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ := encodeFrame(RegLed0, data)
+		releaseFrame(buf)
+	})
+	if allocs != 0 {
+		t.Errorf("encodeFrame allocates %v times per run, want 0", allocs)
+	}
+}
+
+func TestBandwidthMonitor(t *testing.T) {
+	var overloads []BandwidthStats
+	mon := NewBandwidthMonitor(nopI2C{},
+		WithBusSpeed(100000),
+		WithBandwidthWindow(20*time.Millisecond),
+		WithBandwidthLogger(NewDefaultLogger(LogLevelBasic)),
+		WithOverloadHandler(func(s BandwidthStats) { overloads = append(overloads, s) }))
+
+	if rate := mon.MaxFrameRate(16); rate < 100 || rate > 200 {
+		t.Errorf("MaxFrameRate(16) = %v, want about 144 at 100 kHz", rate)
+	}
+
+	// Без ограничения запись без пауз заведомо превышает возможности шины.
+	data := make([]byte, 4)
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		_ = mon.WriteReg(RegLed0, data)
+	}
+	if s := mon.Stats(); s.Utilization <= 1 || s.Bytes <= 0 || s.Transactions <= 0 {
+		t.Errorf("Stats() = %+v, want utilization above 1", s)
+	}
+	if len(overloads) == 0 {
+		t.Error("overload handler was not called")
+	}
+
+	// С торможением нагрузка удерживается на пороге.
+	limited := NewBandwidthMonitor(nopI2C{},
+		WithBusSpeed(100000),
+		WithOverloadThreshold(0.5),
+		WithBandwidthWindow(20*time.Millisecond),
+		WithBackpressure(true))
+	start := time.Now()
+	for i := 0; i < 200; i++ {
+		_ = limited.WriteReg(RegLed0, data)
+	}
+	// 200 транзакций по 65 тактов при 50 кГц занимают не меньше ~0.24 с.
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("backpressure did not slow down writes: %v", elapsed)
+	}
+	if u := limited.Stats().Utilization; u > 0.6 {
+		t.Errorf("Utilization with backpressure = %v, want about 0.5", u)
+	}
+}
+
+// limitedI2C – адаптер с ограниченной длиной записи.
+type limitedI2C struct {
+	countI2C
+	maxTransfer int
+}
+
+func (l *limitedI2C) Capabilities() I2CCapabilities {
+	return I2CCapabilities{MaxTransfer: l.maxTransfer}
+}
+
+func TestBurstWrite(t *testing.T) {
+	dev := &limitedI2C{countI2C: countI2C{TestI2C: NewTestI2C()}, maxTransfer: 8}
+	pca, err := New(dev, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	if caps := pca.Capabilities(); caps.MaxTransfer != 8 {
+		t.Errorf("Capabilities() = %+v", caps)
+	}
+	if err := pca.SetChannelLimits(2, 0, 2000); err != nil {
+		t.Fatalf("SetChannelLimits() error = %v", err)
+	}
+	ctx := context.Background()
+
+	values := []PWMValue{
+		{Channel: 0, Off: 100}, {Channel: 1, Off: 200}, {Channel: 2, Off: 3000},
+		{Channel: 3, Off: 400}, {Channel: 4, Off: 500}, {Channel: 9, Off: 900},
+	}
+	dev.writes.Store(0)
+	if err := pca.SetMultiPWMValues(ctx, values); err != nil {
+		t.Fatalf("SetMultiPWMValues() error = %v", err)
+	}
+	// Каналы 0–1 и 2–3 – пакетами по два, 4 и 9 – по одному.
+	if n := dev.writes.Load(); n != 4 {
+		t.Errorf("writes = %d, want 4", n)
+	}
+	data := make([]byte, 4)
+	for _, want := range []struct{ ch, off int }{{0, 100}, {1, 200}, {2, 2000}, {3, 400}, {4, 500}, {9, 900}} {
+		_ = dev.ReadReg(uint8(RegLed0+4*want.ch), data)
+		if off := binary.LittleEndian.Uint16(data[2:]); int(off) != want.off {
+			t.Errorf("channel %d register off = %d, want %d", want.ch, off, want.off)
+		}
+	}
+	if _, _, off, _ := pca.GetChannelState(2); off != 3000 {
+		t.Errorf("channel 2 cached off = %d, want requested 3000", off)
+	}
+
+	if err := pca.DisableChannels(1); err != nil {
+		t.Fatalf("DisableChannels() error = %v", err)
+	}
+	if err := pca.SetMultiPWMValues(ctx, values[:2]); err == nil {
+		t.Error("SetMultiPWMValues() expected error for disabled channel in burst")
+	}
+
+	// Без CapableI2C каждый канал записывается отдельно.
+	plain := &plainI2C{}
+	pca2, err := New(plain, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	plain.writes = 0
+	if err := pca2.SetMultiPWMValues(ctx, values); err != nil {
+		t.Fatalf("SetMultiPWMValues() error = %v", err)
+	}
+	if plain.writes != len(values) {
+		t.Errorf("writes without capabilities = %d, want %d", plain.writes, len(values))
+	}
+}
+
+// plainI2C считает записи и не сообщает возможностей.
+type plainI2C struct {
+	writes int
+}
+
+func (p *plainI2C) WriteReg(reg uint8, data []byte) error { p.writes++; return nil }
+func (p *plainI2C) ReadReg(reg uint8, data []byte) error  { return nil }
+func (p *plainI2C) Close() error                          { return nil }
+
+// recordLogger запоминает сообщения, не выводя их.
+type recordLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (r *recordLogger) record(msg string, args ...interface{}) {
+	r.mu.Lock()
+	r.messages = append(r.messages, fmt.Sprintf(msg, args...))
+	r.mu.Unlock()
+}
+
+func (r *recordLogger) Basic(msg string, args ...interface{})    { r.record(msg, args...) }
+func (r *recordLogger) Detailed(msg string, args ...interface{}) { r.record(msg, args...) }
+func (r *recordLogger) Error(msg string, args ...interface{})    { r.record(msg, args...) }
+
+func (r *recordLogger) contains(substr string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.messages {
+		if strings.Contains(m, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAdapterLogger(t *testing.T) {
+	// Без WithLogger адаптер пишет в логгер контроллера.
+	parent := &recordLogger{}
+	config := DefaultConfig()
+	config.Logger = parent
+	inherited := NewTestI2C()
+	if _, err := New(NewSharedBus().Device(inherited), config); err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	if !parent.contains("TestI2C: WriteReg") {
+		t.Error("adapter traffic was not logged to the controller logger")
+	}
+
+	// Явно заданный логгер не заменяется.
+	own := &recordLogger{}
+	parent = &recordLogger{}
+	config = DefaultConfig()
+	config.Logger = parent
+	if _, err := New(NewTestI2C(WithLogger(own)), config); err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	if !own.contains("TestI2C: WriteReg") || parent.contains("TestI2C: WriteReg") {
+		t.Error("explicit adapter logger was overridden by the controller logger")
+	}
+}
+
+// writeReadI2C считает комбинированные транзакции.
+type writeReadI2C struct {
+	*TestI2C
+	combined, reads int
+}
+
+func (w *writeReadI2C) WriteRead(wb, rb []byte) error {
+	w.combined++
+	return w.TestI2C.WriteRead(wb, rb)
+}
+
+func (w *writeReadI2C) ReadReg(reg uint8, data []byte) error {
+	w.reads++
+	return w.TestI2C.ReadReg(reg, data)
+}
+
+func TestWriteRead(t *testing.T) {
+	dev := &writeReadI2C{TestI2C: NewTestI2C()}
+	pca, err := New(dev, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	dev.combined, dev.reads = 0, 0
+	if _, err := pca.ReadMode1(); err != nil {
+		t.Fatalf("ReadMode1() error = %v", err)
+	}
+	if dev.combined != 1 || dev.reads != 0 {
+		t.Errorf("combined = %d, reads = %d; want register read through WriteRead", dev.combined, dev.reads)
+	}
+
+	// TestI2C: запись после указателя и чтение одной транзакцией.
+	r := make([]byte, 2)
+	if err := dev.TestI2C.WriteRead([]byte{0x20, 7, 9}, r); err != nil || r[0] != 7 || r[1] != 9 {
+		t.Errorf("WriteRead() = %v, %v", r, err)
+	}
+
+	// Общая шина даёт комбинированное чтение и адаптеру без WriteRead.
+	plain := &plainI2C{}
+	if capabilitiesOf(plain).CombinedWriteRead {
+		t.Error("adapter without WriteRead reported combined write-read")
+	}
+	shared := NewSharedBus().Device(plain)
+	if _, ok := shared.(WriteReader); !ok || !capabilitiesOf(shared).CombinedWriteRead {
+		t.Error("shared bus device does not provide combined write-read")
+	}
+	if err := shared.(WriteReader).WriteRead([]byte{RegMode1}, r[:1]); err != nil {
+		t.Errorf("WriteRead() through shared bus error = %v", err)
+	}
+	if err := shared.(WriteReader).WriteRead([]byte{RegMode1, 0}, r[:1]); err == nil {
+		t.Error("WriteRead() expected error for multi-byte write on adapter without WriteRead")
+	}
+}
+
+// expConn – соединение golang.org/x/exp/io/i2c поверх TestI2C.
+type expConn struct {
+	dev *TestI2C
+	txs int
+}
+
+func (c *expConn) Open(addr int, tenbit bool) (expdriver.Conn, error) { return c, nil }
+
+func (c *expConn) Tx(w, r []byte) error {
+	c.txs++
+	if len(r) == 0 {
+		return c.dev.WriteReg(w[0], w[1:])
+	}
+	return c.dev.WriteRead(w, r)
+}
+
+func (c *expConn) Close() error { return nil }
+
+func TestI2CAdapterExpIO(t *testing.T) {
+	conn := &expConn{dev: NewTestI2C()}
+	dev, err := expi2c.Open(conn, 0x40)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	adapter := NewI2CAdapterExpIO(dev)
+	pca, err := New(adapter, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	if err := pca.SetPWM(context.Background(), 5, 0, 2048); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	data := make([]byte, 4)
+	if err := adapter.ReadReg(uint8(RegLed0+4*5), data); err != nil {
+		t.Fatalf("ReadReg() error = %v", err)
+	}
+	if off := binary.LittleEndian.Uint16(data[2:]); off != 2048 {
+		t.Errorf("channel 5 off = %d, want 2048", off)
+	}
+	if caps := pca.Capabilities(); !caps.CombinedWriteRead || caps.MaxTransfer != 0 {
+		t.Errorf("Capabilities() = %+v", caps)
+	}
+	if err := pca.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+// busPirate эмулирует Bus Pirate в двоичном режиме I2C поверх TestI2C.
+// Ответы формируются синхронно при записи и читаются через Read.
+type busPirate struct {
+	dev     *TestI2C
+	addr    uint8
+	mode    string // "", "bbio", "i2c"
+	pending []byte // незавершённая многобайтовая команда
+	tx      []byte // байты текущей транзакции между START и STOP
+	out     bytes.Buffer
+	closed  bool
+}
+
+func (b *busPirate) Read(p []byte) (int, error) {
+	if b.out.Len() == 0 {
+		return 0, io.EOF
+	}
+	return b.out.Read(p)
+}
+
+func (b *busPirate) Close() error {
+	b.closed = true
+	return nil
+}
+
+func (b *busPirate) Write(p []byte) (int, error) {
+	for _, c := range p {
+		b.pending = append(b.pending, c)
+		b.step()
+	}
+	return len(p), nil
+}
+
+func (b *busPirate) step() {
+	cmd := b.pending[0]
+	done := true
+	switch {
+	case b.mode != "i2c" && cmd == 0x00:
+		b.mode = "bbio"
+		b.out.WriteString("BBIO1")
+	case b.mode == "bbio" && cmd == 0x02:
+		b.mode = "i2c"
+		b.out.WriteString("I2C1")
+	case b.mode == "bbio" && cmd == 0x0F:
+		b.mode = ""
+		b.out.WriteByte(0x01)
+	case b.mode == "i2c" && cmd == 0x00:
+		b.mode = "bbio"
+		b.out.WriteString("BBIO1")
+	case b.mode == "i2c" && cmd == 0x02:
+		b.tx = b.tx[:0]
+		b.out.WriteByte(0x01)
+	case b.mode == "i2c" && cmd == 0x03:
+		if len(b.tx) >= 2 && b.tx[0] == b.addr<<1 {
+			_ = b.dev.WriteReg(b.tx[1], b.tx[2:])
+		}
+		b.out.WriteByte(0x01)
+	case b.mode == "i2c" && cmd&0xF0 == 0x10:
+		n := int(cmd&0x0F) + 1
+		if done = len(b.pending) == n+1; done {
+			b.out.WriteByte(0x01)
+			for _, c := range b.pending[1:] {
+				b.tx = append(b.tx, c)
+				if b.tx[0] == b.addr<<1 {
+					b.out.WriteByte(0x00)
+				} else {
+					b.out.WriteByte(0x01)
+				}
+			}
+		}
+	case b.mode == "i2c" && cmd == 0x08:
+		if len(b.pending) < 5 {
+			done = false
+			break
+		}
+		nw := int(b.pending[1])<<8 | int(b.pending[2])
+		nr := int(b.pending[3])<<8 | int(b.pending[4])
+		if done = len(b.pending) == 5+nw; done {
+			w := b.pending[5:]
+			if w[0] != b.addr<<1 {
+				b.out.WriteByte(0x00)
+				break
+			}
+			r := make([]byte, nr)
+			_ = b.dev.ReadReg(w[1], r)
+			b.out.WriteByte(0x01)
+			b.out.Write(r)
+		}
+	case b.mode == "i2c" && (cmd&0xF0 == 0x40 || cmd&0xFC == 0x60):
+		b.out.WriteByte(0x01)
+	default:
+		b.out.WriteByte(0x00)
+	}
+	if done {
+		b.pending = b.pending[:0]
+	}
+}
+
+func TestI2CAdapterBusPirate(t *testing.T) {
+	port := &busPirate{dev: NewTestI2C(), addr: 0x40}
+	adapter, err := NewI2CAdapterBusPirate(port, BusPirateConfig{Speed: BusPirate400kHz, Power: true})
+	if err != nil {
+		t.Fatalf("NewI2CAdapterBusPirate() error = %v", err)
+	}
+	if port.mode != "i2c" {
+		t.Fatalf("Bus Pirate mode = %q, want i2c", port.mode)
+	}
+	pca, err := New(adapter, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	if err := pca.SetPWM(ctx, 3, 0, 1234); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	// Запись всех каналов превышает пакет Bus Pirate в 16 байт.
+	values := make([]PWMValue, 16)
+	for i := range values {
+		values[i] = PWMValue{Channel: i, Off: uint16(100 * i)}
+	}
+	if err := pca.SetMultiPWMValues(ctx, values); err != nil {
+		t.Fatalf("SetMultiPWMValues() error = %v", err)
+	}
+	data := make([]byte, 64)
+	if err := adapter.ReadReg(RegLed0, data); err != nil {
+		t.Fatalf("ReadReg() error = %v", err)
+	}
+	for i := range values {
+		if off := binary.LittleEndian.Uint16(data[4*i+2:]); off != uint16(100*i) {
+			t.Errorf("channel %d off = %d, want %d", i, off, 100*i)
+		}
+	}
+
+	other, err := NewI2CAdapterBusPirate(&busPirate{dev: NewTestI2C(), addr: 0x41}, BusPirateConfig{})
+	if err != nil {
+		t.Fatalf("NewI2CAdapterBusPirate() error = %v", err)
+	}
+	other.inheritLogger(&recordLogger{})
+	if err := other.WriteReg(RegMode1, []byte{0}); err == nil {
+		t.Error("WriteReg() to absent device: expected error")
+	}
+	if err := other.ReadReg(RegMode1, data[:1]); err == nil {
+		t.Error("ReadReg() from absent device: expected error")
+	}
+
+	if err := pca.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if !port.closed || port.mode != "" {
+		t.Errorf("after Close: closed = %v, mode = %q", port.closed, port.mode)
+	}
+}
+
+func TestAdapterRegistry(t *testing.T) {
+	var got AdapterConfig
+	RegisterAdapter("registry-test", func(cfg AdapterConfig, opts ...AdapterOption) (I2C, error) {
+		got = cfg
+		return NewTestI2C(opts...), nil
+	})
+	t.Cleanup(func() {
+		adaptersMu.Lock()
+		delete(adapters, "registry-test")
+		adaptersMu.Unlock()
+	})
+	names := Adapters()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("Adapters() = %v, want sorted", names)
+	}
+	for _, want := range []string{"buspirate", "registry-test", "test"} {
+		if i := sort.SearchStrings(names, want); i == len(names) || names[i] != want {
+			t.Errorf("Adapters() = %v, missing %q", names, want)
+		}
+	}
+
+	dev, err := OpenAdapter("registry-test", AdapterConfig{Bus: "7", Params: map[string]string{"k": "v"}})
+	if err != nil {
+		t.Fatalf("OpenAdapter() error = %v", err)
+	}
+	if got.Address != 0x40 || got.Bus != "7" || got.Params["k"] != "v" {
+		t.Errorf("factory config = %+v", got)
+	}
+	if _, err := New(dev, DefaultConfig()); err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+
+	_, err = OpenAdapter("no-such-adapter", AdapterConfig{})
+	if err == nil || !strings.Contains(err.Error(), "registry-test") {
+		t.Errorf("OpenAdapter(unknown) error = %v, want list of registered adapters", err)
+	}
+	if _, err := OpenAdapter("buspirate", AdapterConfig{Params: map[string]string{"speed": "1M"}}); err == nil {
+		t.Error("OpenAdapter(buspirate) with invalid speed: expected error")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate RegisterAdapter: expected panic")
+		}
+	}()
+	RegisterAdapter("test", func(AdapterConfig, ...AdapterOption) (I2C, error) { return nil, nil })
+}
+
+func TestMockI2C(t *testing.T) {
+	mock := NewMockI2C()
+	mock.SetMode(MockLenient)
+	pca, err := New(mock, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("lenient init: %v", err)
+	}
+
+	mock.SetMode(MockStrict)
+	ctx := context.Background()
+	mock.ExpectWrite(RegLed0+4*3, 0, 0, 0x00, 0x08)
+	mock.ExpectRead(RegMode1).WillReturn(Mode1Sleep)
+	mock.ExpectWrite(RegLed0 + 4*4).WithAnyData().WillReturnError(errors.New("bus error"))
+	if err := pca.SetPWM(ctx, 3, 0, 2048); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	mode := make([]byte, 1)
+	if err := mock.ReadReg(RegMode1, mode); err != nil || mode[0] != Mode1Sleep {
+		t.Errorf("ReadReg() = %v, %v; want canned response", mode, err)
+	}
+	if err := pca.SetPWM(ctx, 4, 0, 100); err == nil {
+		t.Error("SetPWM() expected scripted error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("ExpectationsWereMet() = %v", err)
+	}
+
+	// Строгий режим: неожиданная запись отклоняется и фиксируется.
+	mock.ExpectClose()
+	if err := pca.SetPWM(ctx, 5, 0, 1); err == nil {
+		t.Error("SetPWM() without expectation: expected error")
+	}
+	err = mock.ExpectationsWereMet()
+	if err == nil || !strings.Contains(err.Error(), "expected close") {
+		t.Errorf("ExpectationsWereMet() = %v, want unexpected write", err)
+	}
+
+	// Невыполненное ожидание.
+	pending := NewMockI2C()
+	pending.ExpectWrite(RegMode2, Mode2OutDrv)
+	if err := pending.ExpectationsWereMet(); err == nil || !strings.Contains(err.Error(), "not met") {
+		t.Errorf("ExpectationsWereMet() = %v, want unmet expectation", err)
+	}
+}
+
+func TestStressInvariants(t *testing.T) {
+	adapter := NewTestI2C()
+	adapter.EnableStress(200*time.Microsecond, 42)
+	config := DefaultConfig()
+	config.AutoSleep = time.Millisecond
+	pca, err := New(adapter, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	run := func(fn func(i int) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := fn(i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	run(func(i int) error { return pca.SetPWM(ctx, i%16, 0, uint16(i*80)) })
+	run(func(i int) error {
+		values := make([]PWMValue, 16)
+		for ch := range values {
+			values[ch] = PWMValue{Channel: ch, Off: uint16((i % 2) * 1000)}
+		}
+		return pca.SetMultiPWMValues(ctx, values)
+	})
+	run(func(i int) error { return pca.SetPWMFreq(float64(200 + 20*i)) })
+	run(func(i int) error {
+		_, err := pca.ReadMode1()
+		return err
+	})
+	run(func(i int) error { return pca.SetAllPWM(ctx, 0, uint16(i%2)*500) })
+	wg.Wait()
+
+	if err := adapter.CheckInvariants(); err != nil {
+		t.Errorf("driver broke simulator invariants: %v", err)
+	}
+
+	// Проверка самих инвариантов: нарушения фиксируются.
+	bad := NewTestI2C()
+	bad.EnableStress(0, 1)
+	_ = bad.WriteReg(RegLed0+1, []byte{1, 2, 3})
+	if err := bad.CheckInvariants(); err == nil || !strings.Contains(err.Error(), "unaligned LED") {
+		t.Errorf("CheckInvariants() = %v, want unaligned LED write", err)
+	}
+	_ = bad.WriteReg(RegPrescale, []byte{30})
+	if err := bad.CheckInvariants(); err == nil || !strings.Contains(err.Error(), "2 invariant violations") {
+		t.Errorf("CheckInvariants() = %v, want PRESCALE violation counted", err)
+	}
+
+	// Раздельные запись указателя и чтение без общей блокировки шины
+	// перемешиваются с записями, а через SharedBus – нет.
+	interleave := func(dev I2C) {
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				buf := make([]byte, 4)
+				for i := 0; i < 20; i++ {
+					_ = dev.WriteReg(RegLed0+4*uint8(g), []byte{0, 0, byte(i), 0})
+					_ = dev.ReadReg(RegLed0+4*uint8(g), buf)
+				}
+			}(g)
+		}
+		wg.Wait()
+	}
+	raw := NewTestI2C()
+	raw.EnableStress(200*time.Microsecond, 3)
+	interleave(raw)
+	if err := raw.CheckInvariants(); err == nil || !strings.Contains(err.Error(), "register pointer") {
+		t.Errorf("CheckInvariants() = %v, want interleaved register pointer", err)
+	}
+	shared := NewTestI2C()
+	shared.EnableStress(200*time.Microsecond, 3)
+	interleave(NewSharedBus().Device(shared))
+	if err := shared.CheckInvariants(); err != nil {
+		t.Errorf("CheckInvariants() through SharedBus = %v", err)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	var buf bytes.Buffer
+	config := DefaultConfig()
+	config.Journal = NewJournal(&buf)
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := pca.SetPWM(WithSource(ctx, "mqtt"), 2, 0, 1000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if err := pca.SetPWM(ctx, 20, 0, 1); err == nil {
+		t.Fatal("SetPWM() with invalid channel: expected error")
+	}
+	if err := pca.SetMultiPWMValues(ctx, []PWMValue{{Channel: 4, Off: 10}, {Channel: 5, Off: 20}}); err != nil {
+		t.Fatalf("SetMultiPWMValues() error = %v", err)
+	}
+	if err := pca.FadeChannel(ctx, 3, 0, 100, 20*time.Millisecond); err != nil {
+		t.Fatalf("FadeChannel() error = %v", err)
+	}
+	engine, err := NewRuleEngine(time.Second, nil)
+	if err != nil {
+		t.Fatalf("NewRuleEngine() error = %v", err)
+	}
+	always := ConditionFunc(func(context.Context) (bool, error) { return true, nil })
+	if err := engine.Add(Rule{Name: "night", When: always, Then: SetPWMAction(pca, 7, 0, 4095)}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := engine.Evaluate(ctx); err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+
+	var entries []JournalEntry
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e JournalEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		entries = append(entries, e)
+	}
+	want := []struct {
+		op, source string
+		channel    int
+		off        uint16
+		ok         bool
+	}{
+		{"SetPWMFreq", "api", -1, 0, true},
+		{"SetPWM", "mqtt", 2, 1000, true},
+		{"SetPWM", "api", 20, 1, false},
+		{"SetMultiPWMValues", "api", 4, 10, true},
+		{"SetMultiPWMValues", "api", 5, 20, true},
+		{"FadeChannel", "api", 3, 100, true},
+		{"SetPWM", "rule:night", 7, 4095, true},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("journal has %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Op != w.op || e.Source != w.source || e.Channel != w.channel || e.Off != w.off || e.OK != w.ok || e.Time.IsZero() {
+			t.Errorf("entry %d = %+v, want %+v", i, e, w)
+		}
+	}
+	if entries[2].Error == "" || entries[0].Value != 1000 {
+		t.Errorf("entries = %+v, want error text and frequency", entries[:3])
+	}
+
+	// Ротация файла журнала.
+	path := filepath.Join(t.TempDir(), "journal.log")
+	j, err := OpenJournal(path, WithJournalMaxSize(300), WithJournalBackups(2))
+	if err != nil {
+		t.Fatalf("OpenJournal() error = %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := j.Record(JournalEntry{Source: "test", Op: "SetPWM", Channel: i % 16, Off: uint16(i)}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("Stat(%s) error = %v", name, err)
+		}
+		if info.Size() == 0 || info.Size() > 300 {
+			t.Errorf("%s size = %d, want 1..300", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want at most 2 backups", path)
+	}
+	if err := j.Record(JournalEntry{}); err == nil {
+		t.Error("Record() after Close: expected error")
+	}
+}
+
+func TestDebugCounters(t *testing.T) {
+	config := DefaultConfig()
+	config.DegradedMode = true
+	config.RecoveryInterval = time.Hour // повторы запускаются вручную
+	dev := &failI2C{TestI2C: NewTestI2C()}
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	base := pca.Counters()
+	if base.Writes == 0 || base.Errors != 0 {
+		t.Fatalf("Counters() after New = %+v", base)
+	}
+
+	if err := pca.SetPWM(ctx, 1, 0, 100); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if _, err := pca.ReadMode1(); err != nil {
+		t.Fatalf("ReadMode1() error = %v", err)
+	}
+	renderer := NewRenderer(pca)
+	renderer.Set(2, 0, 200)
+	if err := renderer.Render(ctx, time.Now()); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	dev.fail.Store(true)
+	_ = pca.SetPWM(ctx, 3, 0, 300)
+	pca.degraded.replay()
+
+	c := pca.Counters()
+	want := Counters{
+		Writes:     base.Writes + 4, // SetPWM, кадр, неудачная запись, повтор
+		Reads:      base.Reads + 1,
+		Errors:     2,
+		Retries:    1,
+		Frames:     1,
+		QueueDepth: 1,
+		Degraded:   true,
+	}
+	if c != want {
+		t.Errorf("Counters() = %+v, want %+v", c, want)
+	}
+
+	srv := httptest.NewServer(pca.DebugHandler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + DebugPath)
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	defer resp.Body.Close()
+	var state struct {
+		Counters  Counters
+		Frequency float64
+		Channels  []ChannelState
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if state.Counters != want || state.Frequency != 1000 || len(state.Channels) != 16 || state.Channels[1].Off != 100 {
+		t.Errorf("debug state = %+v", state)
+	}
+	if resp, err := http.Post(srv.URL, "text/plain", nil); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %v, %v; want 405", resp, err)
+	}
+
+	pca.PublishExpvar("pca9685_test_counters")
+	if v := expvar.Get("pca9685_test_counters"); v == nil || !strings.Contains(v.String(), `"retries":1`) {
+		t.Errorf("expvar = %v", v)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHist
+	for _, d := range []time.Duration{30 * time.Microsecond, 80 * time.Microsecond, 80 * time.Microsecond, 3 * time.Millisecond, 300 * time.Millisecond} {
+		h.observe(d)
+	}
+	s := h.snapshot("TestI2C", LatencyWrite)
+	if s.Count != 5 || s.Min != 30*time.Microsecond || s.Max != 300*time.Millisecond {
+		t.Fatalf("snapshot = %+v", s)
+	}
+	if got := s.Buckets[0].Count + s.Buckets[1].Count; got != 3 {
+		t.Errorf("fast buckets = %d, want 3", got)
+	}
+	if last := s.Buckets[len(s.Buckets)-1]; last.Le != 0 || last.Count != 1 {
+		t.Errorf("overflow bucket = %+v", last)
+	}
+	if q := s.Quantile(0.5); q != 100*time.Microsecond {
+		t.Errorf("Quantile(0.5) = %v, want 100µs", q)
+	}
+	if q := s.Quantile(0.8); q != 5*time.Millisecond {
+		t.Errorf("Quantile(0.8) = %v, want 5ms", q)
+	}
+	if q := s.Quantile(1); q != 300*time.Millisecond {
+		t.Errorf("Quantile(1) = %v, want max", q)
+	}
+	if m := s.Mean(); m != (30+80+80+3000+300000)*time.Microsecond/5 {
+		t.Errorf("Mean() = %v", m)
+	}
+
+	pca, err := New(NewTestI2C(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	before := pca.Latency()
+	if err := pca.SetPWM(ctx, 0, 0, 100); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	renderer := NewRenderer(pca)
+	renderer.Set(1, 0, 200)
+	if err := renderer.Render(ctx, time.Now()); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	after := pca.Latency()
+	if len(after) != 3 {
+		t.Fatalf("Latency() returned %d histograms", len(after))
+	}
+	for i, want := range []struct {
+		op    string
+		delta uint64
+	}{{LatencyWrite, 2}, {LatencyRead, 0}, {LatencyFrame, 1}} {
+		h := after[i]
+		if h.Adapter != "TestI2C" || h.Op != want.op || h.Count-before[i].Count != want.delta {
+			t.Errorf("Latency()[%d] = %v, want %s +%d", i, h, want.op, want.delta)
+		}
+	}
+}
+
+func TestAnimationEvents(t *testing.T) {
+	var mu sync.Mutex
+	var events []Event
+	config := DefaultConfig()
+	config.OnEvent = func(e Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	take := func() []Event {
+		mu.Lock()
+		defer mu.Unlock()
+		got := events
+		events = nil
+		return got
+	}
+	ctx := context.Background()
+
+	if err := pca.FadeChannel(ctx, 3, 0, 1000, 0); err != nil {
+		t.Fatalf("FadeChannel() error = %v", err)
+	}
+	got := take()
+	if len(got) != 2 || got[0].Type != EventFadeStarted || got[1].Type != EventFadeCompleted ||
+		got[1].Name != "FadeChannel" || got[1].Channel != 3 || !reflect.DeepEqual(got[1].Channels, []int{3}) {
+		t.Errorf("FadeChannel events = %+v", got)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = pca.FadeMulti(cctx, map[int]FadeSpec{5: {0, 100}, 2: {0, 100}}, time.Second)
+	got = take()
+	if !errors.Is(err, context.Canceled) || len(got) != 2 || got[1].Type != EventFadeCancelled ||
+		!errors.Is(got[1].Err, context.Canceled) || got[1].Channel != -1 || !reflect.DeepEqual(got[1].Channels, []int{2, 5}) {
+		t.Errorf("FadeMulti events = %+v, err = %v", got, err)
+	}
+
+	if err := pca.FadeMaster(ctx, 0.5, 0); err != nil {
+		t.Fatalf("FadeMaster() error = %v", err)
+	}
+	if got := take(); len(got) != 2 || got[1].Type != EventFadeCompleted || got[1].Name != "FadeMaster" || got[1].Channels != nil {
+		t.Errorf("FadeMaster events = %+v", got)
+	}
+
+	scene := Scene{Name: "night", Values: map[int]uint16{7: 10, 1: 20}}
+	seq, err := NewSequencer(pca, []SequenceStep{{Scene: scene, Duration: 5 * time.Millisecond}}, WithLoop(true))
+	if err != nil {
+		t.Fatalf("NewSequencer() error = %v", err)
+	}
+	if err := seq.Play(ctx); err != nil {
+		t.Fatalf("Play() error = %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	seq.Stop()
+	seq.Wait()
+	var applied, looped int
+	for _, e := range take() {
+		switch e.Type {
+		case EventSceneApplied:
+			if e.Name != "night" || !reflect.DeepEqual(e.Channels, []int{1, 7}) {
+				t.Errorf("scene event = %+v", e)
+			}
+			applied++
+		case EventAnimationLooped:
+			looped++
+			if e.Name != "Sequencer" || e.Loop != looped+1 {
+				t.Errorf("loop event = %+v", e)
+			}
+		}
+	}
+	if looped < 1 || applied < looped || applied > looped+1 {
+		t.Errorf("applied %d scenes, looped %d times", applied, looped)
+	}
+	if s := EventFadeCancelled.String(); s != "fade cancelled" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+// orderI2C записывает имя адаптера в order при закрытии.
+type orderI2C struct {
+	*TestI2C
+	name  string
+	order *[]string
+}
+
+func (d orderI2C) Close() error {
+	*d.order = append(*d.order, d.name)
+	return d.TestI2C.Close()
+}
+
+func TestShutdownAll(t *testing.T) {
+	ctx := context.Background()
+	var order []string
+	first, err := New(orderI2C{NewTestI2C(), "first", &order}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	second, err := New(orderI2C{NewTestI2C(), "second", &order}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+
+	var speeds []float64
+	var mu sync.Mutex
+	pump, err := NewPump(second, 0)
+	if err != nil {
+		t.Fatalf("NewPump() error = %v", err)
+	}
+	if err := pump.SetSpeed(ctx, 80); err != nil {
+		t.Fatalf("SetSpeed() error = %v", err)
+	}
+	servo, err := NewServo(second, 1, DefaultServoCalibration())
+	if err != nil {
+		t.Fatalf("NewServo() error = %v", err)
+	}
+	if err := servo.SetFailsafeAngle(45); err != nil {
+		t.Fatalf("SetFailsafeAngle() error = %v", err)
+	}
+	if err := servo.SetAngle(ctx, 170); err != nil {
+		t.Fatalf("SetAngle() error = %v", err)
+	}
+	_, parked, _ := second.ChannelFailsafe(1)
+	if err := first.SetChannelFailsafe(5, 0, 123); err != nil {
+		t.Fatalf("SetChannelFailsafe() error = %v", err)
+	}
+	if err := first.SetPWM(ctx, 5, 0, 4000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	seq, err := NewSequencer(first, []SequenceStep{{Scene: Scene{Values: map[int]uint16{5: 4000}}, Duration: time.Millisecond}}, WithLoop(true))
+	if err != nil {
+		t.Fatalf("NewSequencer() error = %v", err)
+	}
+	if err := seq.Play(ctx); err != nil {
+		t.Fatalf("Play() error = %v", err)
+	}
+
+	reg := NewRegistry()
+	reg.AddController(first)
+	reg.AddStopper(seq)
+	reg.Register("pump", pump)
+	reg.Register("servo", servo)
+	go func() {
+		for {
+			s, _ := pump.GetCurrentSpeed()
+			mu.Lock()
+			speeds = append(speeds, s)
+			n := len(speeds)
+			mu.Unlock()
+			if s == 0 || n > 1000 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if err := reg.ShutdownAll(ctx, WithShutdownRamp(40*time.Millisecond, WithFadeSteps(4))); err != nil {
+		t.Fatalf("ShutdownAll() error = %v", err)
+	}
+	if seq.State() != SequencerStopped {
+		t.Errorf("sequencer state = %v, want stopped", seq.State())
+	}
+	if s, _ := pump.GetCurrentSpeed(); s != 0 {
+		t.Errorf("pump speed = %v, want 0", s)
+	}
+	mu.Lock()
+	intermediate := false
+	for _, s := range speeds {
+		intermediate = intermediate || (s > 0 && s < 80)
+	}
+	mu.Unlock()
+	if !intermediate {
+		t.Errorf("pump speeds %v, want a ramp down from 80", speeds)
+	}
+	if _, _, off, _ := second.GetChannelState(1); off != parked {
+		t.Errorf("servo off = %d, want failsafe %d", off, parked)
+	}
+	if _, _, off, _ := first.GetChannelState(5); off != 123 {
+		t.Errorf("channel 5 off = %d, want failsafe 123", off)
+	}
+	if !reflect.DeepEqual(order, []string{"first", "second"}) {
+		t.Errorf("close order = %v", order)
+	}
+	if names := reg.Names(); len(names) != 0 || second.ChannelOwner(0) != "" {
+		t.Errorf("registry after ShutdownAll: %v, owner %q", names, second.ChannelOwner(0))
+	}
+}
+
+func TestChipPCA9635(t *testing.T) {
+	dev := NewTestI2C()
+	config := DefaultConfig()
+	config.Chip = ChipPCA9635
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9635: %v", err)
+	}
+	ctx := context.Background()
+	reg := func(r uint8, n int) []byte {
+		data := make([]byte, n)
+		dev.ReadReg(r, data)
+		return data
+	}
+	// Запись с флагом автоинкремента эмулятор сохраняет по адресу управляющего байта.
+	pwm := func(ch int) byte { return reg(pca9635AutoInc|uint8(RegPCA9635PWM0+ch), 1)[0] }
+
+	if got := reg(pca9635AutoInc|RegPCA9635LEDOut0, 4); !bytes.Equal(got, []byte{0xAA, 0xAA, 0xAA, 0xAA}) {
+		t.Errorf("LEDOUT = % X, want individual PWM", got)
+	}
+	if mode1 := reg(RegMode1, 1)[0]; mode1&Mode1Sleep != 0 {
+		t.Errorf("MODE1 = 0x%02X, oscillator asleep", mode1)
+	}
+	if pca.frequency() != PCA9635Frequency {
+		t.Errorf("frequency = %v, want %v", pca.frequency(), PCA9635Frequency)
+	}
+
+	if err := pca.SetPWM(ctx, 3, 0, 2048); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if d := pwm(3); d != 128 {
+		t.Errorf("PWM3 = %d, want 128", d)
+	}
+	if _, _, off, _ := pca.GetChannelState(3); off != 2048 {
+		t.Errorf("cached off = %d, want 2048", off)
+	}
+	if err := pca.SetMultiPWMValues(ctx, []PWMValue{{Channel: 5, Off: 4095}, {Channel: 6, On: 0x1000}, {Channel: 7, Off: 1024}}); err != nil {
+		t.Fatalf("SetMultiPWMValues() error = %v", err)
+	}
+	if got := reg(pca9635AutoInc|uint8(RegPCA9635PWM0+5), 3); !bytes.Equal(got, []byte{255, 255, 64}) {
+		t.Errorf("PWM5-7 = %v, want [255 255 64]", got)
+	}
+	if err := pca.SetAllPWM(ctx, 0, 0x1000); err != nil {
+		t.Fatalf("SetAllPWM() error = %v", err)
+	}
+	if got := reg(pca9635AutoInc|RegPCA9635PWM0, 16); !bytes.Equal(got, make([]byte, 16)) {
+		t.Errorf("PWM after SetAllPWM(off) = %v", got)
+	}
+	if reg(RegAllLed, 4)[3] != 0 {
+		t.Error("ALL_LED written on PCA9635")
+	}
+
+	led, err := NewRGBLed(pca, 0, 1, 2)
+	if err != nil {
+		t.Fatalf("NewRGBLed() error = %v", err)
+	}
+	if err := led.SetColor(ctx, 255, 0, 0); err != nil {
+		t.Fatalf("SetColor() error = %v", err)
+	}
+	if d := pwm(0); d != 255 {
+		t.Errorf("red PWM = %d, want 255", d)
+	}
+
+	if err := pca.SetPWMFreq(200); !errors.Is(err, ErrFixedFrequency) {
+		t.Errorf("SetPWMFreq() error = %v, want ErrFixedFrequency", err)
+	}
+	if _, err := NewServo(pca, 8, DefaultServoCalibration()); !errors.Is(err, ErrFixedFrequency) {
+		t.Errorf("NewServo() error = %v, want ErrFixedFrequency", err)
+	}
+	if err := pca.SetAllCallAddress(0x71); err != nil {
+		t.Fatalf("SetAllCallAddress() error = %v", err)
+	}
+	if addr, err := pca.AllCallAddress(); err != nil || addr != 0x71 || reg(RegPCA9635AllCall, 1)[0] != 0x71<<1 {
+		t.Errorf("AllCallAddress() = 0x%X, %v", addr, err)
+	}
+
+	config = DefaultConfig()
+	config.Chip = Chip(7)
+	if _, err := New(NewTestI2C(), config); err == nil {
+		t.Error("New() expected error for unknown chip")
+	}
+	if s := ChipPCA9635.String(); s != "PCA9635" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestChannelMinInterval(t *testing.T) {
+	dev := NewTestI2C()
+	pca, err := New(dev, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	if err := pca.SetChannelMinInterval(0, -time.Second); err == nil {
+		t.Error("SetChannelMinInterval() with negative interval should fail")
+	}
+	if err := pca.SetChannelMinInterval(2, 50*time.Millisecond); err != nil {
+		t.Fatalf("SetChannelMinInterval() error = %v", err)
+	}
+	if got := pca.ChannelMinInterval(2); got != 50*time.Millisecond {
+		t.Errorf("ChannelMinInterval() = %v, want 50ms", got)
+	}
+
+	base := pca.Counters().Writes
+	for i := 1; i <= 20; i++ {
+		if err := pca.SetPWM(ctx, 2, 0, uint16(i*100)); err != nil {
+			t.Fatalf("SetPWM() error = %v", err)
+		}
+	}
+	// Первая запись выполняется сразу, остальные откладываются, но кэш
+	// отражает последнее значение.
+	if got := pca.Counters().Writes - base; got != 1 {
+		t.Errorf("writes during burst = %d, want 1", got)
+	}
+	if _, _, off, _ := pca.GetChannelState(2); off != 2000 {
+		t.Errorf("cached off = %d, want 2000", off)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for pca.Counters().Writes-base < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := pca.Counters().Writes - base; got != 2 {
+		t.Fatalf("writes after interval = %d, want 2", got)
+	}
+	regs := make([]byte, 4)
+	if err := dev.ReadReg(RegLed0+4*2, regs); err != nil {
+		t.Fatalf("ReadReg() error = %v", err)
+	}
+	if off := uint16(regs[2]) | uint16(regs[3])<<8; off != 2000 {
+		t.Errorf("device off = %d, want final value 2000", off)
+	}
+
+	// Отключение ограничения сразу записывает отложенное значение.
+	_ = pca.SetChannelMinInterval(2, time.Hour)
+	_ = pca.SetPWM(ctx, 2, 0, 500)
+	base = pca.Counters().Writes
+	if err := pca.SetChannelMinInterval(2, 0); err != nil {
+		t.Fatalf("SetChannelMinInterval(0) error = %v", err)
+	}
+	if got := pca.Counters().Writes - base; got != 1 {
+		t.Errorf("writes on disable = %d, want 1", got)
+	}
+	base = pca.Counters().Writes
+	_ = pca.SetPWM(ctx, 2, 0, 600)
+	_ = pca.SetPWM(ctx, 2, 0, 700)
+	if got := pca.Counters().Writes - base; got != 2 {
+		t.Errorf("writes without limit = %d, want 2", got)
+	}
+
+	// Групповые и защитные записи выполняются сразу, даже внутри интервала.
+	deviceOff := func() uint16 {
+		_ = dev.ReadReg(RegLed0+4*2, regs)
+		return uint16(regs[2]) | uint16(regs[3])<<8
+	}
+	_ = pca.SetChannelMinInterval(2, time.Hour)
+	_ = pca.SetPWM(ctx, 2, 0, 800)
+	_ = pca.SetPWM(ctx, 2, 0, 900) // отложено
+	if err := pca.SetMultiPWMValues(ctx, []PWMValue{{Channel: 2, Off: 1000}}); err != nil {
+		t.Fatalf("SetMultiPWMValues() error = %v", err)
+	}
+	if off := deviceOff(); off != 1000 {
+		t.Errorf("device off after single-value batch = %d, want 1000", off)
+	}
+	if err := pca.SetMultiPWM(ctx, map[int]struct{ On, Off uint16 }{2: {0, 1100}}); err != nil {
+		t.Fatalf("SetMultiPWM() error = %v", err)
+	}
+	if off := deviceOff(); off != 1100 {
+		t.Errorf("device off after SetMultiPWM = %d, want 1100", off)
+	}
+	_ = pca.SetPWM(ctx, 2, 0, 1200) // отложено
+	if err := pca.SetChannelFailsafe(2, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.ApplyFailsafe(ctx); err != nil {
+		t.Fatalf("ApplyFailsafe() error = %v", err)
+	}
+	if off := deviceOff(); off != 0 {
+		t.Errorf("device off after ApplyFailsafe = %d, want 0", off)
+	}
+	if _, _, off, _ := pca.GetChannelState(2); off != 0 {
+		t.Errorf("cached off after ApplyFailsafe = %d, want 0", off)
+	}
+}
+
+func TestBlackout(t *testing.T) {
+	dev := NewTestI2C()
+	pca, err := New(dev, DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	reg := func(r uint8, n int) []byte {
+		data := make([]byte, n)
+		dev.ReadReg(r, data)
+		return data
+	}
+	offH := func(ch int) byte { return reg(uint8(RegLed0+4*ch+3), 1)[0] }
+
+	_ = pca.SetPWM(ctx, 0, 0, 1000)
+	_ = pca.SetPWM(ctx, 5, 0, 2000)
+	if err := pca.BlackoutAll(ctx); err != nil {
+		t.Fatalf("BlackoutAll() error = %v", err)
+	}
+	if !pca.InBlackout() {
+		t.Error("InBlackout() = false after BlackoutAll")
+	}
+	if got := reg(RegAllLedOffH, 1)[0]; got != 0x10 {
+		t.Errorf("ALL_LED_OFF_H = 0x%02X, want FULL_OFF", got)
+	}
+	if _, _, off, _ := pca.GetChannelState(5); off != 2000 {
+		t.Errorf("cached off after BlackoutAll = %d, want 2000", off)
+	}
+
+	// Записи во время затемнения попадают в кэш, но выход остаётся выключенным.
+	if err := pca.SetPWM(ctx, 5, 0, 3000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if err := pca.SetMultiPWMValues(ctx, []PWMValue{{Channel: 6, Off: 100}, {Channel: 7, Off: 200}}); err != nil {
+		t.Fatalf("SetMultiPWMValues() error = %v", err)
+	}
+	for _, ch := range []int{5, 6, 7} {
+		if offH(ch)&0x10 == 0 {
+			t.Errorf("channel %d written without FULL_OFF during blackout", ch)
+		}
+	}
+
+	if err := pca.RestoreFromBlackout(ctx); err != nil {
+		t.Fatalf("RestoreFromBlackout() error = %v", err)
+	}
+	if pca.InBlackout() {
+		t.Error("InBlackout() = true after RestoreFromBlackout")
+	}
+	for ch, want := range map[int]uint16{0: 1000, 5: 3000, 6: 100, 7: 200, 9: 0} {
+		data := reg(uint8(RegLed0+4*ch), 4)
+		if off := uint16(data[2]) | uint16(data[3])<<8; off != want {
+			t.Errorf("channel %d off after restore = %#x, want %d", ch, off, want)
+		}
+	}
+
+	// EmergencyStop не сохраняет значения и снимает затемнение.
+	_ = pca.BlackoutAll(ctx)
+	if err := pca.EmergencyStop(ctx); err != nil {
+		t.Fatalf("EmergencyStop() error = %v", err)
+	}
+	if pca.InBlackout() {
+		t.Error("InBlackout() = true after EmergencyStop")
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 0 {
+		t.Errorf("cached off after EmergencyStop = %d, want 0", off)
+	}
+
+	// PCA9635 выключает выходы регистрами LEDOUT.
+	dev9635 := NewTestI2C()
+	config := DefaultConfig()
+	config.Chip = ChipPCA9635
+	pca9635, err := New(dev9635, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9635: %v", err)
+	}
+	ledout := func() []byte {
+		data := make([]byte, 4)
+		dev9635.ReadReg(pca9635AutoInc|RegPCA9635LEDOut0, data)
+		return data
+	}
+	_ = pca9635.SetPWM(ctx, 1, 0, 4095)
+	if err := pca9635.BlackoutAll(ctx); err != nil {
+		t.Fatalf("PCA9635 BlackoutAll() error = %v", err)
+	}
+	if got := ledout(); !bytes.Equal(got, make([]byte, 4)) {
+		t.Errorf("LEDOUT during blackout = % X, want drivers off", got)
+	}
+	if err := pca9635.RestoreFromBlackout(ctx); err != nil {
+		t.Fatalf("PCA9635 RestoreFromBlackout() error = %v", err)
+	}
+	if got := ledout(); !bytes.Equal(got, []byte{0xAA, 0xAA, 0xAA, 0xAA}) {
+		t.Errorf("LEDOUT after restore = % X", got)
+	}
+
+	// DMXMapper затемняет все привязанные контроллеры.
+	mapper := NewDMXMapper()
+	_ = mapper.Patch(1, 1, pca, 0)
+	_ = mapper.AddFixture(1, 2, DMXDimmer{Device: pca9635, Channel: 2})
+	if err := mapper.Blackout(ctx); err != nil {
+		t.Fatalf("DMXMapper.Blackout() error = %v", err)
+	}
+	if !pca.InBlackout() || !pca9635.InBlackout() {
+		t.Error("DMXMapper.Blackout() left a controller lit")
+	}
+	if err := mapper.RestoreFromBlackout(ctx); err != nil {
+		t.Fatalf("DMXMapper.RestoreFromBlackout() error = %v", err)
+	}
+	if pca.InBlackout() || pca9635.InBlackout() {
+		t.Error("DMXMapper.RestoreFromBlackout() left a controller dark")
+	}
+}
+
+// noisyI2C искажает первые corrupt записей регистров каналов, как помеха на шине.
+type noisyI2C struct {
+	*TestI2C
+	corrupt atomic.Int32
+}
+
+func (n *noisyI2C) WriteReg(reg uint8, data []byte) error {
+	if reg >= RegLed0 && reg < RegLed0+4*16 && n.corrupt.Add(-1) >= 0 {
+		bad := append([]byte(nil), data...)
+		bad[len(bad)-2] ^= 0x04
+		return n.TestI2C.WriteReg(reg, bad)
+	}
+	return n.TestI2C.WriteReg(reg, data)
+}
+
+func TestVerifyWrites(t *testing.T) {
+	var mismatches []Event
+	config := DefaultConfig()
+	config.VerifyWrites = true
+	config.OnEvent = func(e Event) {
+		if e.Type == EventWriteMismatch {
+			mismatches = append(mismatches, e)
+		}
+	}
+	dev := &noisyI2C{TestI2C: NewTestI2C()}
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	offOf := func(ch int) uint16 {
+		data := make([]byte, 4)
+		dev.ReadReg(uint8(RegLed0+4*ch), data)
+		return uint16(data[2]) | uint16(data[3])<<8
+	}
+
+	// Искажённая запись обнаруживается и повторяется.
+	dev.corrupt.Store(1)
+	if err := pca.SetPWM(ctx, 3, 0, 1000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if got := offOf(3); got != 1000 {
+		t.Errorf("off after verified write = %d, want 1000", got)
+	}
+	if len(mismatches) != 1 || mismatches[0].Channel != 3 || mismatches[0].Name != "SetPWM" || !errors.Is(mismatches[0].Err, ErrWriteMismatch) {
+		t.Errorf("mismatch events = %+v", mismatches)
+	}
+	if c := pca.Counters(); c.Mismatches != 1 {
+		t.Errorf("Counters().Mismatches = %d, want 1", c.Mismatches)
+	}
+
+	// Пакетная запись проверяется целиком; ALL_LED не читается обратно.
+	if err := pca.SetMultiPWMValues(ctx, []PWMValue{{Channel: 4, Off: 200}, {Channel: 5, Off: 300}}); err != nil {
+		t.Fatalf("SetMultiPWMValues() error = %v", err)
+	}
+	if err := pca.SetAllPWM(ctx, 0, 0); err != nil {
+		t.Fatalf("SetAllPWM() error = %v", err)
+	}
+
+	// Устойчивое искажение возвращает ошибку после всех повторов.
+	mismatches = nil
+	dev.corrupt.Store(100)
+	err = pca.SetPWM(ctx, 6, 0, 500)
+	if !errors.Is(err, ErrWriteMismatch) {
+		t.Fatalf("SetPWM() error = %v, want ErrWriteMismatch", err)
+	}
+	if len(mismatches) != defaultVerifyRetries+1 {
+		t.Errorf("mismatch events = %d, want %d", len(mismatches), defaultVerifyRetries+1)
+	}
+	if _, _, off, _ := pca.GetChannelState(6); off != 0 {
+		t.Errorf("cached off after failed write = %d, want 0", off)
+	}
+
+	// Нулевое число повторов – проверка без повторной записи.
+	config.VerifyRetries = 0
+	dev = &noisyI2C{TestI2C: NewTestI2C()}
+	if pca, err = New(dev, config); err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	mismatches = nil
+	dev.corrupt.Store(1)
+	if err := pca.SetPWM(ctx, 7, 0, 500); !errors.Is(err, ErrWriteMismatch) {
+		t.Errorf("SetPWM() without retries error = %v, want ErrWriteMismatch", err)
+	}
+	if len(mismatches) != 1 {
+		t.Errorf("mismatch events without retries = %d, want 1", len(mismatches))
+	}
+}
+
+func TestBusTrace(t *testing.T) {
+	var initTrace bytes.Buffer
+	config := DefaultConfig()
+	config.Trace = &initTrace
+	dev := &failI2C{TestI2C: NewTestI2C()}
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	if records, err := ReadTrace(&initTrace); err != nil || len(records) == 0 {
+		t.Fatalf("initialization trace = %d records, %v", len(records), err)
+	}
+
+	var trace bytes.Buffer
+	pca.SetTrace(&trace)
+	ctx := context.Background()
+	_ = pca.SetPWM(ctx, 0, 0, 1000)
+	_, _ = pca.ReadMode1()
+	dev.fail.Store(true)
+	_ = pca.SetPWM(ctx, 1, 0, 2000)
+	dev.fail.Store(false)
+	pca.SetTrace(nil)
+	_ = pca.SetPWM(ctx, 2, 0, 3000)
+
+	records, err := ReadTrace(&trace)
+	if err != nil {
+		t.Fatalf("ReadTrace() error = %v\n%s", err, trace.String())
+	}
+	if len(records) != 3 {
+		t.Fatalf("trace has %d records, want 3:\n%s", len(records), trace.String())
+	}
+	want := []TraceRecord{
+		{Dir: TraceWrite, Reg: RegLed0, Data: []byte{0, 0, 0xE8, 0x03}},
+		{Dir: TraceRead, Reg: RegMode1, Data: records[1].Data},
+		{Dir: TraceWrite, Reg: RegLed0 + 4, Data: []byte{0, 0, 0xD0, 0x07}, Err: "bus error"},
+	}
+	for i, rec := range records {
+		if rec.Dir != want[i].Dir || rec.Reg != want[i].Reg || !bytes.Equal(rec.Data, want[i].Data) || rec.Err != want[i].Err {
+			t.Errorf("record %d = %+v, want %+v", i, rec, want[i])
+		}
+		if rec.Time.IsZero() || rec.Duration <= 0 {
+			t.Errorf("record %d has no time or duration: %+v", i, rec)
+		}
+	}
+	if len(records[1].Data) != 1 {
+		t.Errorf("read record data = %x, want 1 byte", records[1].Data)
+	}
+
+	for _, line := range []string{
+		"dir=write reg=0x06 data= dur=1ms result=ok",
+		"time=2026-10-16T08:00:00.000000Z dir=erase reg=0x06 data= dur=1ms result=ok",
+		"time=2026-10-16T08:00:00.000000Z dir=write reg=0x06 data=zz dur=1ms result=ok",
+		"time=2026-10-16T08:00:00.000000Z dir=write reg=0x06 data= dur=1ms result=error",
+	} {
+		if _, err := ParseTraceLine(line); err == nil {
+			t.Errorf("ParseTraceLine(%q) succeeded", line)
+		}
+	}
+}
+
+func TestSegment(t *testing.T) {
+	var events []Event
+	config := DefaultConfig()
+	config.OnEvent = func(e Event) { events = append(events, e) }
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := NewSegment(pca, SegmentConfig{}); err == nil {
+		t.Error("NewSegment() without channels should fail")
+	}
+	if _, err := NewSegment(pca, SegmentConfig{Channels: []int{0}, Min: 100, Max: 50}); err == nil {
+		t.Error("NewSegment() with Min > Max should fail")
+	}
+	seg, err := NewSegment(pca, SegmentConfig{Channels: []int{6, 4, 5}, Gamma: 2})
+	if err != nil {
+		t.Fatalf("NewSegment() error = %v", err)
+	}
+	if _, err := NewSegment(pca, SegmentConfig{Channels: []int{5}}); !errors.Is(err, ErrChannelOwned) {
+		t.Errorf("NewSegment() on owned channel error = %v, want ErrChannelOwned", err)
+	}
+	if got := seg.Channels(); !reflect.DeepEqual(got, []int{6, 4, 5}) {
+		t.Errorf("Channels() = %v", got)
+	}
+	off := func(ch int) uint16 {
+		_, _, off, _ := pca.GetChannelState(ch)
+		return off
+	}
+
+	if err := seg.SetLevel(ctx, 0.5); err != nil {
+		t.Fatalf("SetLevel() error = %v", err)
+	}
+	for _, ch := range []int{4, 5, 6} {
+		if got := off(ch); got != 1024 { // 0.5² × 4095
+			t.Errorf("channel %d off = %d, want 1024", ch, got)
+		}
+	}
+	if err := seg.SetMaster(ctx, 0.5); err != nil {
+		t.Fatalf("SetMaster() error = %v", err)
+	}
+	if got := off(4); got != 256 { // 0.25² × 4095
+		t.Errorf("off with master 0.5 = %d, want 256", got)
+	}
+	if seg.Level() != 0.5 || seg.Master() != 0.5 {
+		t.Errorf("Level() = %v, Master() = %v", seg.Level(), seg.Master())
+	}
+	if err := seg.SetLevel(ctx, 1.5); err == nil {
+		t.Error("SetLevel(1.5) should fail")
+	}
+
+	_ = seg.SetMaster(ctx, 1)
+	events = nil
+	if err := seg.Fade(ctx, 1, 20*time.Millisecond, WithFadeSteps(4)); err != nil {
+		t.Fatalf("Fade() error = %v", err)
+	}
+	if got := off(6); got != 4095 {
+		t.Errorf("off after Fade = %d, want 4095", got)
+	}
+	if len(events) != 2 || events[0].Type != EventFadeStarted || events[1].Type != EventFadeCompleted ||
+		events[1].Name != "FadeSegment" || !reflect.DeepEqual(events[1].Channels, []int{4, 5, 6}) {
+		t.Errorf("Fade events = %+v", events)
+	}
+
+	registry := NewRegistry()
+	_ = registry.Register("shelf", seg)
+	if got, err := registry.Segment("shelf"); err != nil || got != seg {
+		t.Errorf("Registry.Segment() = %v, %v", got, err)
+	}
+	seg.Release()
+	if owner := pca.ChannelOwner(5); owner != "" {
+		t.Errorf("channel 5 owner after Release = %q", owner)
+	}
+}
+
+func TestAudioEffect(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := NewAudioEffect(AudioEffectConfig{Channels: []int{0}}); err == nil {
+		t.Error("NewAudioEffect() expected error without source")
+	}
+	in := &AudioInput{}
+	if _, err := NewAudioEffect(AudioEffectConfig{Source: in, Channels: []int{0, 1}, Weights: []float64{1}}); err == nil {
+		t.Error("NewAudioEffect() expected error for weights length mismatch")
+	}
+
+	r := NewRenderer(pca)
+	vu, err := NewAudioEffect(AudioEffectConfig{Source: in, Mode: AudioVU, Channels: []int{0, 1, 2, 3}})
+	if err != nil {
+		t.Fatalf("NewAudioEffect() error = %v", err)
+	}
+	color, err := NewAudioEffect(AudioEffectConfig{Source: in, Channels: []int{4, 5}, Weights: []float64{1, 0.5}})
+	if err != nil {
+		t.Fatalf("NewAudioEffect() error = %v", err)
+	}
+	r.Add("vu", vu)
+	r.Add("color", color)
+
+	// Первый кадр принимает уровень сразу; дальше огибающая сглаживается.
+	in.Push(0.5)
+	start := time.Now()
+	if err := r.Render(ctx, start); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	want := map[int]uint16{0: 4095, 1: 4095, 2: 0, 3: 0, 4: 2048, 5: 1024}
+	for ch, w := range want {
+		if _, _, off, _ := pca.GetChannelState(ch); off != w {
+			t.Errorf("channel %d = %d, want %d", ch, off, w)
+		}
+	}
+
+	// Спад огибающей медленнее нарастания.
+	in.Push(0)
+	if err := r.Render(ctx, start.Add(10*time.Millisecond)); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(4); off == 0 || off >= 2048 {
+		t.Errorf("channel 4 after release step = %d, want between 0 and 2048", off)
+	}
+
+	vu.Stop()
+	color.Stop()
+	beat, err := NewAudioEffect(AudioEffectConfig{Source: in, Mode: AudioBeat, Channels: []int{6}, Decay: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewAudioEffect() error = %v", err)
+	}
+	r.Add("beat", beat)
+	in.Push(0.1)
+	now := start.Add(time.Second)
+	for i := 0; i < 10; i++ {
+		now = now.Add(20 * time.Millisecond)
+		in.Push(0.1)
+		if err := r.Render(ctx, now); err != nil {
+			t.Fatalf("Render() error = %v", err)
+		}
+	}
+	// Ровный уровень после первого удара затухает.
+	if _, _, off, _ := pca.GetChannelState(6); off > 100 {
+		t.Errorf("channel 6 with steady level = %d, want decayed pulse", off)
+	}
+	in.Push(0.9)
+	now = now.Add(20 * time.Millisecond)
+	if err := r.Render(ctx, now); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(6); off != 4095 {
+		t.Errorf("channel 6 on beat = %d, want 4095", off)
+	}
+	if vu.Render(now, &RenderFrame{}) {
+		t.Error("Render() after Stop should report the effect as finished")
+	}
+}
+
+func TestPulse(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+	if err := pca.SetPWM(ctx, 0, 0, 300); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- pca.Pulse(ctx, 0, 4095, 50*time.Millisecond) }()
+	time.Sleep(10 * time.Millisecond)
+	if _, _, off, _ := pca.GetChannelState(0); off != 4095 {
+		t.Errorf("channel 0 during pulse = %d, want 4095", off)
+	}
+	if err := pca.Pulse(ctx, 0, 4095, time.Millisecond); err == nil {
+		t.Error("Pulse() expected error for overlapping pulse")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Pulse() error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 300 {
+		t.Errorf("channel 0 after pulse = %d, want previous value 300", off)
+	}
+
+	// Отмена прерывает импульс, но канал всё равно возвращается.
+	if err := pca.SetChannelFailsafe(1, 0, 100); err != nil {
+		t.Fatalf("SetChannelFailsafe() error = %v", err)
+	}
+	if err := pca.SetPWM(ctx, 1, 0, 2000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = pca.Pulse(cctx, 1, 4095, time.Hour, WithPulseSafeRestore())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Pulse() error = %v, want context.DeadlineExceeded", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Pulse() did not stop on cancellation")
+	}
+	if _, _, off, _ := pca.GetChannelState(1); off != 100 {
+		t.Errorf("channel 1 after cancelled pulse = %d, want failsafe value 100", off)
+	}
+
+	if err := pca.Pulse(ctx, 2, 4095, 0); err == nil {
+		t.Error("Pulse() expected error for zero duration")
+	}
+	if err := pca.Pulse(ctx, 16, 4095, time.Millisecond); err == nil {
+		t.Error("Pulse() expected error for invalid channel")
+	}
+}
+
+func TestProfileRunner(t *testing.T) {
+	var events []Event
+	var mu sync.Mutex
+	config := DefaultConfig()
+	config.OnEvent = func(e Event) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	}
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := NewProfileRunner(pca, 0, nil); err == nil {
+		t.Error("NewProfileRunner() expected error for empty profile")
+	}
+	if _, err := NewProfileRunner(pca, 0, []ProfileSegment{{Target: 5000}}); err == nil {
+		t.Error("NewProfileRunner() expected error for target above 4095")
+	}
+	if _, err := NewProfileRunner(pca, 0, []ProfileSegment{{Target: 100}}, WithProfileLoop(true)); err == nil {
+		t.Error("NewProfileRunner() expected error for zero-length looped profile")
+	}
+
+	if err := pca.SetPWM(ctx, 0, 0, 1000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	r, err := NewProfileRunner(pca, 0, []ProfileSegment{
+		{Target: 2000, Ramp: 20 * time.Millisecond, Hold: 200 * time.Millisecond},
+		{Target: 500},
+	}, WithProfileFade(WithFadeSteps(4)))
+	if err != nil {
+		t.Fatalf("NewProfileRunner() error = %v", err)
+	}
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := r.Start(ctx); err == nil {
+		t.Error("Start() expected error while running")
+	}
+	time.Sleep(80 * time.Millisecond)
+	if i, holding := r.Segment(); i != 0 || !holding {
+		t.Errorf("Segment() = %d, %v; want holding segment 0", i, holding)
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 2000 {
+		t.Errorf("channel 0 during hold = %d, want 2000", off)
+	}
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if r.Running() {
+		t.Error("Running() = true after profile finished")
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 500 {
+		t.Errorf("channel 0 after profile = %d, want 500", off)
+	}
+	mu.Lock()
+	if len(events) != 2 || events[0].Type != EventFadeStarted || events[1].Type != EventFadeCompleted || events[1].Name != "Profile" {
+		t.Errorf("events = %v, want Profile started and completed", events)
+	}
+	events = nil
+	mu.Unlock()
+
+	// Stop прерывает профиль, канал сохраняет достигнутое значение.
+	loop, err := NewProfileRunner(pca, 1, []ProfileSegment{{Target: 4000, Ramp: time.Hour}}, WithProfileLoop(true))
+	if err != nil {
+		t.Fatalf("NewProfileRunner() error = %v", err)
+	}
+	if err := loop.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	loop.Stop()
+	if err := loop.Wait(); err != nil {
+		t.Errorf("Wait() after Stop error = %v, want nil", err)
+	}
+	mu.Lock()
+	if len(events) != 2 || events[1].Type != EventFadeCancelled {
+		t.Errorf("events = %v, want cancelled profile", events)
+	}
+	mu.Unlock()
+}
+
+func TestSensorPoller(t *testing.T) {
+	p := NewSensorPoller(nil)
+	var temp atomic.Int64
+	temp.Store(25)
+	var fail atomic.Bool
+	err := p.Add("water", ValueSourceFunc(func(ctx context.Context) (float64, error) {
+		if fail.Load() {
+			return 0, errors.New("bus error")
+		}
+		return float64(temp.Load()), nil
+	}), 5*time.Millisecond, WithSensorUnit("°C"))
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := p.Add("water", ValueSourceFunc(nil), time.Second); err == nil {
+		t.Error("Add() expected error for duplicate name")
+	}
+	if err := p.AddCurrent("pump", nil, time.Second); err == nil {
+		t.Error("AddCurrent() expected error for nil sensor")
+	}
+
+	src, err := p.Source("water")
+	if err != nil {
+		t.Fatalf("Source() error = %v", err)
+	}
+	ctx := context.Background()
+	if _, err := src.Value(ctx); !errors.Is(err, ErrNoReading) {
+		t.Errorf("Value() before polling error = %v, want ErrNoReading", err)
+	}
+
+	readings := make(chan SensorReading, 100)
+	if err := p.Subscribe("water", func(r SensorReading) { readings <- r }); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	if err := p.Poll(ctx); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if v, err := src.Value(ctx); err != nil || v != 25 {
+		t.Errorf("Value() = %v, %v; want 25", v, err)
+	}
+	if r := <-readings; r.Value != 25 || r.Unit != "°C" || r.Samples != 1 {
+		t.Errorf("subscriber reading = %+v", r)
+	}
+	if ok, err := Above(src, 24).Check(ctx); !ok || err != nil {
+		t.Errorf("Above().Check() = %v, %v; want true", ok, err)
+	}
+
+	// Фоновый опрос обновляет значение; ошибка датчика сохраняет последнее.
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- p.Run(runCtx) }()
+	temp.Store(27)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, _ := src.Value(ctx); v == 27 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background polling did not update the value")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	fail.Store(true)
+	time.Sleep(30 * time.Millisecond)
+	if v, err := src.Value(ctx); !errors.Is(err, ErrStaleReading) || v != 27 {
+		t.Errorf("Value() of failing sensor = %v, %v; want stale 27", v, err)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want context.Canceled", err)
+	}
+
+	state := p.State()
+	if len(state) != 1 || state[0].Errors == 0 || state[0].Err == "" || state[0].Value != 27 {
+		t.Errorf("State() = %+v", state)
+	}
+	rec := httptest.NewRecorder()
+	p.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sensors", nil))
+	var got []SensorReading
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || len(got) != 1 || got[0].Name != "water" {
+		t.Errorf("Handler() body = %s, err = %v", rec.Body.String(), err)
+	}
+	if _, err := p.Source("air"); err == nil {
+		t.Error("Source() expected error for unknown sensor")
+	}
+}
+
+type positionFunc func(ctx context.Context) (float64, error)
+
+func (f positionFunc) Position(ctx context.Context) (float64, error) { return f(ctx) }
+
+func TestServoFeedback(t *testing.T) {
+	events := make(chan Event, 10)
+	config := DefaultConfig()
+	config.OnEvent = func(e Event) {
+		if e.Type == EventServoBlocked {
+			events <- e
+		}
+	}
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	servo, err := NewServo(pca, 0, DefaultServoCalibration())
+	if err != nil {
+		t.Fatalf("NewServo() error = %v", err)
+	}
+	if _, err := servo.Feedback(nil, ServoFeedbackConfig{}); err == nil {
+		t.Error("Feedback() expected error without sensor")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Механизм отстаёт на 3°: коррекция дрейфа компенсирует отставание.
+	drifting := positionFunc(func(context.Context) (float64, error) {
+		return servo.Angle() + servo.Trim() - 3, nil
+	})
+	fb, err := servo.Feedback(drifting, ServoFeedbackConfig{
+		Tolerance: 1, Settle: 5 * time.Millisecond, Hold: 50 * time.Millisecond,
+		Interval: 2 * time.Millisecond, MaxCorrection: 5,
+	})
+	if err != nil {
+		t.Fatalf("Feedback() error = %v", err)
+	}
+	if err := servo.SetAngle(ctx, 60); err != nil {
+		t.Fatalf("SetAngle() error = %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- fb.Run(ctx) }()
+	if err := fb.SetAngleVerified(ctx, 90); err != nil {
+		t.Errorf("SetAngleVerified() with drift correction error = %v", err)
+	}
+	if trim := servo.Trim(); trim < 2 || trim > 5 {
+		t.Errorf("Trim() = %v, want drift compensated within 2..5", trim)
+	}
+	if fb.Blocked() {
+		t.Error("Blocked() = true for corrected drift")
+	}
+	cancel()
+	<-done
+
+	// Заблокированный механизм: событие и снятие импульса.
+	servo2, err := NewServo(pca, 1, DefaultServoCalibration())
+	if err != nil {
+		t.Fatalf("NewServo() error = %v", err)
+	}
+	stuck := positionFunc(func(context.Context) (float64, error) { return 10, nil })
+	fb2, err := servo2.Feedback(stuck, ServoFeedbackConfig{
+		Settle: 5 * time.Millisecond, Hold: 10 * time.Millisecond, Interval: 2 * time.Millisecond, StopOnBlock: true,
+	})
+	if err != nil {
+		t.Fatalf("Feedback() error = %v", err)
+	}
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	go func() { _ = fb2.Run(ctx2) }()
+	if err := fb2.SetAngleVerified(ctx2, 90); !errors.Is(err, ErrServoBlocked) {
+		t.Errorf("SetAngleVerified() error = %v, want ErrServoBlocked", err)
+	}
+	select {
+	case e := <-events:
+		if e.Channel != 1 || !errors.Is(e.Err, ErrServoBlocked) {
+			t.Errorf("event = %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("EventServoBlocked not emitted")
+	}
+	if !fb2.Blocked() || fb2.Position() != 10 {
+		t.Errorf("Blocked() = %v, Position() = %v; want blocked at 10", fb2.Blocked(), fb2.Position())
+	}
+	if _, _, off, _ := pca.GetChannelState(1); off != 0 {
+		t.Errorf("channel 1 = %d, want pulse removed on block", off)
+	}
+}
+
+func TestControllerGroup_CommitFrame(t *testing.T) {
+	ctx := context.Background()
+	var devs []*TestI2C
+	var members []*PCA9685
+	for i := 0; i < 2; i++ {
+		dev := NewTestI2C()
+		pca, err := New(dev, DefaultConfig())
+		if err != nil {
+			t.Fatalf("Failed to create PCA9685: %v", err)
+		}
+		devs = append(devs, dev)
+		members = append(members, pca)
+	}
+	allCall := NewTestI2C()
+	group := NewControllerGroup(allCall, members...)
+
+	readOff := func(dev I2C, ch int) uint16 {
+		data := make([]byte, 4)
+		_ = dev.ReadReg(uint8(RegLed0+4*ch), data)
+		return binary.LittleEndian.Uint16(data[2:])
+	}
+
+	err := group.CommitFrame(ctx, [][]PWMValue{
+		{{Channel: 1, Off: 200}, {Channel: 0, Off: 100}},
+		{{Channel: 5, Off: 300}},
+	})
+	if err != nil {
+		t.Fatalf("CommitFrame() error = %v", err)
+	}
+	for _, c := range []struct {
+		member, channel int
+		want            uint16
+	}{{0, 0, 100}, {0, 1, 200}, {1, 5, 300}} {
+		if got := readOff(devs[c.member], c.channel); got != c.want {
+			t.Errorf("member %d channel %d register = %d, want %d", c.member, c.channel, got, c.want)
+		}
+		if _, _, off, _ := members[c.member].GetChannelState(c.channel); off != c.want {
+			t.Errorf("member %d channel %d cache = %d, want %d", c.member, c.channel, off, c.want)
+		}
+	}
+	if group.FrameSkew() <= 0 {
+		t.Error("FrameSkew() = 0 after commit")
+	}
+
+	// Одинаковые кадры уходят одной транзакцией ALLCALL.
+	before := members[0].Counters().Writes
+	same := []PWMValue{{Channel: 2, Off: 4000}, {Channel: 3, Off: 50}}
+	if err := group.CommitFrame(ctx, [][]PWMValue{same, same}); err != nil {
+		t.Fatalf("CommitFrame() error = %v", err)
+	}
+	if got := readOff(allCall, 2); got != 4000 {
+		t.Errorf("ALLCALL channel 2 register = %d, want 4000", got)
+	}
+	if writes := members[0].Counters().Writes; writes != before {
+		t.Errorf("member writes = %d, want %d: identical frame should use ALLCALL", writes, before)
+	}
+	for i, pca := range members {
+		if _, _, off, _ := pca.GetChannelState(3); off != 50 {
+			t.Errorf("member %d channel 3 cache = %d, want 50", i, off)
+		}
+	}
+
+	if err := group.CommitFrame(ctx, make([][]PWMValue, 3)); err == nil {
+		t.Error("CommitFrame() expected error for too many frames")
+	}
+	if err := group.CommitFrame(ctx, [][]PWMValue{{{Channel: 16}}}); err == nil {
+		t.Error("CommitFrame() expected error for invalid channel")
+	}
+	if err := group.CommitFrame(ctx, [][]PWMValue{{{Channel: 1}, {Channel: 1}}}); err == nil {
+		t.Error("CommitFrame() expected error for duplicate channel")
+	}
+}
+
+func TestControllerGroupConfig(t *testing.T) {
+	base := DefaultConfig()
+	base.InitialFreq = 1000
+	group, err := NewControllerGroupConfig(nil, base,
+		GroupDevice{Dev: NewTestI2C(), Options: []DeviceOption{WithDeviceFreq(50)}},
+		GroupDevice{Dev: NewTestI2C(), Options: []DeviceOption{WithDeviceInvert(true), WithDeviceOpenDrain(true)}},
+	)
+	if err != nil {
+		t.Fatalf("NewControllerGroupConfig() error = %v", err)
+	}
+	servos, leds := group.Members()[0], group.Members()[1]
+	if servos.frequency() != 50 || leds.frequency() != 1000 {
+		t.Errorf("frequencies = %v, %v; want 50, 1000", servos.frequency(), leds.frequency())
+	}
+	if base.InitialFreq != 1000 {
+		t.Error("device override modified the base config")
+	}
+	mode2, err := leds.ReadMode2()
+	if err != nil {
+		t.Fatalf("ReadMode2() error = %v", err)
+	}
+	if mode2&Mode2Invrt == 0 || mode2&Mode2OutDrv != 0 {
+		t.Errorf("MODE2 = 0x%X, want inverted open-drain", mode2)
+	}
+
+	ctx := context.Background()
+	if err := leds.SetPWM(ctx, 2, 0, 1500); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if err := group.Configure(1, WithDeviceInvert(false), WithDeviceFreq(200)); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	if mode2, _ := leds.ReadMode2(); mode2&Mode2Invrt != 0 || mode2&Mode2OutDrv != 0 {
+		t.Errorf("MODE2 after Configure = 0x%X, want non-inverted open-drain", mode2)
+	}
+	if leds.frequency() != 200 {
+		t.Errorf("frequency = %v, want 200", leds.frequency())
+	}
+	if _, _, off, _ := leds.GetChannelState(2); off != 1500 {
+		t.Errorf("channel 2 after Configure = %d, want 1500", off)
+	}
+	if err := group.Configure(2); err == nil {
+		t.Error("Configure() expected error for invalid index")
+	}
+	if err := group.Configure(0, WithDeviceFreq(5)); err == nil {
+		t.Error("Configure() expected error for out-of-range frequency")
+	}
+
+	_, err = NewControllerGroupConfig(nil, base,
+		GroupDevice{Dev: NewTestI2C()},
+		GroupDevice{Dev: NewTestI2C(), Options: []DeviceOption{WithDeviceFreq(5)}},
+	)
+	if err == nil || !strings.Contains(err.Error(), "device 1") {
+		t.Errorf("NewControllerGroupConfig() error = %v, want device 1 failure", err)
+	}
+}
+
+// unplugI2C эмулирует плату, которую отключают от шины: пока unplugged,
+// транзакции завершаются ошибкой.
+type unplugI2C struct {
+	*TestI2C
+	unplugged atomic.Bool
+}
+
+func (u *unplugI2C) WriteReg(reg uint8, data []byte) error {
+	if u.unplugged.Load() {
+		return errors.New("no ACK")
+	}
+	return u.TestI2C.WriteReg(reg, data)
+}
+
+func (u *unplugI2C) ReadReg(reg uint8, data []byte) error {
+	if u.unplugged.Load() {
+		return errors.New("no ACK")
+	}
+	return u.TestI2C.ReadReg(reg, data)
+}
+
+func (u *unplugI2C) WriteRead(w, r []byte) error {
+	if u.unplugged.Load() {
+		return errors.New("no ACK")
+	}
+	return u.TestI2C.WriteRead(w, r)
+}
+
+// powerOn возвращает регистры в состояние после включения питания.
+func (u *unplugI2C) powerOn() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.registers = [256]byte{}
+	u.registers[RegMode1] = Mode1Sleep | Mode1AllCall
+}
+
+func TestControllerGroupHotPlug(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []EventType
+	)
+	base := DefaultConfig()
+	base.OnEvent = func(e Event) {
+		mu.Lock()
+		events = append(events, e.Type)
+		mu.Unlock()
+	}
+	dev := &unplugI2C{TestI2C: NewTestI2C()}
+	group, err := NewControllerGroupConfig(nil, base,
+		GroupDevice{Dev: NewTestI2C()},
+		GroupDevice{Dev: dev, Options: []DeviceOption{WithDeviceFreq(50), WithDeviceInvert(true)}},
+	)
+	if err != nil {
+		t.Fatalf("NewControllerGroupConfig() error = %v", err)
+	}
+	if err := group.EnableAllCall(0x71); err != nil {
+		t.Fatalf("EnableAllCall() error = %v", err)
+	}
+	board := group.Members()[1]
+	ctx := context.Background()
+	if err := board.SetPWM(ctx, 3, 0, 2000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	want := dev.registers
+
+	dev.unplugged.Store(true)
+	group.poll(ctx)
+	if off := group.Offline(); len(off) != 1 || off[0] != board {
+		t.Fatalf("Offline() = %v, want the unplugged board", off)
+	}
+	group.poll(ctx)
+
+	dev.powerOn()
+	dev.unplugged.Store(false)
+	group.poll(ctx)
+	if off := group.Offline(); len(off) != 0 {
+		t.Fatalf("Offline() after replug = %v, want none", off)
+	}
+	for _, reg := range []uint8{RegMode2, RegPrescale, RegAllCall, RegLed0 + 4*3 + 2, RegLed0 + 4*3 + 3} {
+		if dev.registers[reg] != want[reg] {
+			t.Errorf("register 0x%X after restore = 0x%X, want 0x%X", reg, dev.registers[reg], want[reg])
+		}
+	}
+	if dev.registers[RegMode1]&(Mode1Sleep|Mode1AllCall) != Mode1AllCall {
+		t.Errorf("MODE1 after restore = 0x%X, want awake with ALLCALL", dev.registers[RegMode1])
+	}
+
+	// Сброс питания между опросами без ошибки чтения.
+	dev.powerOn()
+	group.poll(ctx)
+	if dev.registers[RegLed0+4*3+2] != want[RegLed0+4*3+2] || dev.registers[RegPrescale] != want[RegPrescale] {
+		t.Error("board reset between polls was not restored")
+	}
+	mu.Lock()
+	got := fmt.Sprint(events)
+	mu.Unlock()
+	if want := fmt.Sprint([]EventType{EventDeviceLost, EventDeviceRestored, EventDeviceRestored}); got != want {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	added, err := group.AddDevice(ctx, NewTestI2C(), WithDeviceFreq(200))
+	if err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+	if len(group.Members()) != 3 || added.frequency() != 200 {
+		t.Errorf("AddDevice(): %d members, frequency %v", len(group.Members()), added.frequency())
+	}
+	if addr, _ := added.AllCallAddress(); addr != 0x71 {
+		t.Errorf("added ALLCALL address = 0x%X, want 0x71", addr)
+	}
+	if err := group.Add(ctx, added); err == nil {
+		t.Error("Add() expected error for a duplicate controller")
+	}
+	dev.unplugged.Store(true)
+	group.poll(ctx)
+	if !group.Remove(board) || group.Remove(board) {
+		t.Error("Remove() should succeed exactly once")
+	}
+	if len(group.Members()) != 2 || len(group.Offline()) != 0 {
+		t.Errorf("after Remove: %d members, %d offline", len(group.Members()), len(group.Offline()))
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := group.Watch(wctx, 5*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Watch() error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var session bytes.Buffer
+	config := DefaultConfig()
+	config.InitialFreq = 200
+	config.Trace = &session
+	dev := NewTestI2C()
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+	if err := pca.SetPWM(ctx, 2, 0, 1000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	mid := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	if err := pca.SetPWM(ctx, 2, 0, 3000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if err := pca.SetMultiPWMValues(ctx, []PWMValue{{Channel: 4, Off: 2048}, {Channel: 5, Off: 100}}); err != nil {
+		t.Fatalf("SetMultiPWMValues() error = %v", err)
+	}
+	if err := pca.BlackoutAll(ctx); err != nil {
+		t.Fatalf("BlackoutAll() error = %v", err)
+	}
+	if err := pca.RestoreFromBlackout(ctx); err != nil {
+		t.Fatalf("RestoreFromBlackout() error = %v", err)
+	}
+
+	replay, err := LoadReplay(bytes.NewReader(session.Bytes()))
+	if err != nil {
+		t.Fatalf("LoadReplay() error = %v", err)
+	}
+	if f := replay.Frequency(replay.End()); math.Abs(f-200) > 5 {
+		t.Errorf("Frequency() = %v, want about 200", f)
+	}
+	regs := replay.Registers(replay.End())
+	for reg := RegLed0; reg < RegLed0+64; reg++ {
+		if regs[reg] != dev.registers[reg] {
+			t.Errorf("register 0x%X = 0x%X, want 0x%X", reg, regs[reg], dev.registers[reg])
+		}
+	}
+	if s := replay.Channels(mid)[2]; s.Off != 1000 || !s.Enabled {
+		t.Errorf("channel 2 at mid-session = %+v, want off 1000", s)
+	}
+	if s := replay.Channels(replay.End())[4]; s.Duty != 50 || s.PulseWidth <= 0 {
+		t.Errorf("channel 4 at end = %+v, want 50%% duty", s)
+	}
+
+	points, err := replay.Timeline(2)
+	if err != nil {
+		t.Fatalf("Timeline() error = %v", err)
+	}
+	var offs []uint16
+	for _, p := range points {
+		offs = append(offs, p.Off)
+	}
+	// Включение питания, две записи, затемнение (ALL_LED_OFF_H заменяет
+	// старший байт off) и восстановление.
+	if want := []uint16{ledFullOff, 1000, 3000, 3000&0xFF | ledFullOff, 3000}; fmt.Sprint(offs) != fmt.Sprint(want) {
+		t.Errorf("Timeline(2) off values = %v, want %v", offs, want)
+	}
+	if _, err := replay.Timeline(16); err == nil {
+		t.Error("Timeline() expected error for invalid channel")
+	}
+
+	if sim := replay.Simulator(mid); sim.registers[RegLed0+4*2+2] != 1000&0xFF || sim.registers[RegLed0+4*2+3] != 1000>>8 {
+		t.Error("Simulator() registers do not match mid-session state")
+	}
+	sim := NewTestI2C()
+	if err := replay.Play(ctx, sim, 0); err != nil {
+		t.Fatalf("Play() error = %v", err)
+	}
+	if sim.registers[RegPrescale] != dev.registers[RegPrescale] || sim.registers[RegLed0+4*4+3] != dev.registers[RegLed0+4*4+3] {
+		t.Error("Play() did not reproduce the session")
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := replay.Play(cctx, NewTestI2C(), 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("Play() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestTestPatterns(t *testing.T) {
+	ramp, err := PatternRamp.Frame(0)
+	if err != nil {
+		t.Fatalf("Frame() error = %v", err)
+	}
+	if ramp[0].Off != 256 || ramp[7].Off != 2048 || ramp[15].On != 0x1000 {
+		t.Errorf("ramp frame = %v", ramp)
+	}
+	if shifted, _ := PatternRamp.Frame(1); shifted[0].Off != 512 || shifted[14].On != 0x1000 {
+		t.Errorf("ramp step 1 = %v", shifted)
+	}
+	alt, _ := PatternAlternating.Frame(1)
+	if alt[0].On != 0 || alt[1].On != 0x1000 {
+		t.Errorf("alternating step 1 = %v", alt)
+	}
+	board, _ := PatternCheckerboard.Frame(0)
+	for _, i := range []int{0, 2, 5, 7, 8, 13} {
+		if board[i].On != 0x1000 {
+			t.Errorf("checkerboard channel %d is off", i)
+		}
+	}
+	for _, i := range []int{1, 4, 6, 12} {
+		if board[i].On != 0 {
+			t.Errorf("checkerboard channel %d is on", i)
+		}
+	}
+	if _, err := TestPattern(7).Frame(0); err == nil {
+		t.Error("Frame() expected error for unknown pattern")
+	}
+	if p, err := ParseTestPattern("checkerboard"); err != nil || p != PatternCheckerboard {
+		t.Errorf("ParseTestPattern() = %v, %v", p, err)
+	}
+
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+	if err := pca.SetPWM(ctx, 3, 0, 1234); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	if err := pca.ShowTestPattern(ctx, PatternAlternating, 0); err != nil {
+		t.Fatalf("ShowTestPattern() error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(3); off != 0 {
+		t.Errorf("channel 3 in pattern off = %d, want 0", off)
+	}
+	if err := pca.RunTestPattern(ctx, PatternRamp, time.Millisecond, 3); err != nil {
+		t.Fatalf("RunTestPattern() error = %v", err)
+	}
+	// Восстанавливается состояние на момент запуска – кадр ShowTestPattern.
+	if _, on, _, _ := pca.GetChannelState(2); on != 0x1000 {
+		t.Errorf("channel 2 after RunTestPattern on = 0x%X, want full on", on)
+	}
+	if err := pca.SetPWM(ctx, 3, 0, 1234); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	cctx, cancel := context.WithTimeout(ctx, 15*time.Millisecond)
+	defer cancel()
+	if err := pca.RunTestPattern(cctx, PatternCheckerboard, time.Millisecond, 0); err != nil {
+		t.Errorf("RunTestPattern() until cancel error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(3); off != 1234 {
+		t.Errorf("channel 3 after cancelled RunTestPattern off = %d, want 1234", off)
+	}
+
+	var freqs []float64
+	err = pca.SweepFrequency(ctx, 100, 400, WithSweepSteps(2), WithSweepDwell(0), WithSweepLog(),
+		WithSweepCallback(func(f float64) { freqs = append(freqs, f) }))
+	if err != nil {
+		t.Fatalf("SweepFrequency() error = %v", err)
+	}
+	if len(freqs) != 3 || freqs[0] != 100 || math.Abs(freqs[1]-200) > 1e-9 || freqs[2] != 400 {
+		t.Errorf("swept frequencies = %v, want [100 200 400]", freqs)
+	}
+	if pca.frequency() != DefaultConfig().InitialFreq {
+		t.Errorf("frequency after sweep = %v, want restored %v", pca.frequency(), DefaultConfig().InitialFreq)
+	}
+	if _, _, off, _ := pca.GetChannelState(3); off != 1234 {
+		t.Errorf("channel 3 after sweep off = %d, want 1234", off)
+	}
+	if err := pca.SweepFrequency(ctx, 10, 400); err == nil {
+		t.Error("SweepFrequency() expected error for out-of-range frequency")
+	}
+}
+
+func TestSegmentRatios(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+	// Королевский синий на канале 9, холодный белый на канале 8.
+	fixture, err := NewSegment(pca, SegmentConfig{Channels: []int{9, 8}, Max: 4000, Ratios: []float64{1, 0.5}})
+	if err != nil {
+		t.Fatalf("NewSegment() error = %v", err)
+	}
+	if err := fixture.SetLevel(ctx, 0.8); err != nil {
+		t.Fatalf("SetLevel() error = %v", err)
+	}
+	offs := func() (uint16, uint16) {
+		_, _, blue, _ := pca.GetChannelState(9)
+		_, _, white, _ := pca.GetChannelState(8)
+		return blue, white
+	}
+	if blue, white := offs(); blue != 3200 || white != 1600 {
+		t.Errorf("at 80%%: blue=%d white=%d, want 3200 and 1600", blue, white)
+	}
+	if err := fixture.SetRatios(ctx, []float64{0.25, 1}); err != nil {
+		t.Fatalf("SetRatios() error = %v", err)
+	}
+	if blue, white := offs(); blue != 800 || white != 3200 {
+		t.Errorf("after SetRatios: blue=%d white=%d, want 800 and 3200", blue, white)
+	}
+	if got := fmt.Sprint(fixture.Ratios()); got != "[0.25 1]" {
+		t.Errorf("Ratios() = %v, want [0.25 1]", got)
+	}
+	if err := fixture.SetRatios(ctx, []float64{1}); err == nil {
+		t.Error("SetRatios() expected error for wrong count")
+	}
+	if err := fixture.SetRatios(ctx, []float64{1, 1.5}); err == nil {
+		t.Error("SetRatios() expected error for ratio above 1")
+	}
+	if got := fmt.Sprint(fixture.Ratios()); got != "[0.25 1]" {
+		t.Errorf("Ratios() after rejected update = %v", got)
+	}
+	fixture.Release()
+	if _, err := NewSegment(pca, SegmentConfig{Channels: []int{1, 2}, Ratios: []float64{1}}); err == nil {
+		t.Error("NewSegment() expected error for ratio count mismatch")
+	}
+}
+
+func TestSuggestFrequency(t *testing.T) {
+	servo, err := SuggestFrequency(AppServo)
+	if err != nil {
+		t.Fatalf("SuggestFrequency() error = %v", err)
+	}
+	if servo.Prescale != 121 || math.Abs(servo.Frequency-50) > 0.5 || servo.Tradeoff == "" {
+		t.Errorf("servo suggestion = %+v", servo)
+	}
+	led, _ := SuggestFrequency(AppLED)
+	if led.Prescale != 3 || led.Frequency < 1250 || led.Step > 200*time.Nanosecond {
+		t.Errorf("LED suggestion = %+v", led)
+	}
+	if _, err := SuggestFrequency(Application(9)); err == nil {
+		t.Error("SuggestFrequency() expected error for unknown application")
+	}
+
+	logger := &recordLogger{}
+	config := DefaultConfig()
+	config.InitialFreq = FreqServo50Hz
+	config.Logger = logger
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := NewServo(pca, 0, DefaultServoCalibration()); err != nil {
+		t.Fatalf("NewServo() error = %v", err)
+	}
+	if w := pca.FrequencyWarnings(); len(w) != 0 {
+		t.Errorf("FrequencyWarnings() with a servo at 50 Hz = %v", w)
+	}
+	if _, err := NewRGBLed(pca, 4, 5, 6); err != nil {
+		t.Fatalf("NewRGBLed() error = %v", err)
+	}
+	if !logger.contains("LEDs may flicker") {
+		t.Error("NewRGBLed() at 50 Hz did not log a flicker warning")
+	}
+	if err := pca.SetPWMFreq(FreqLEDFlickerFree); err != nil {
+		t.Fatalf("SetPWMFreq() error = %v", err)
+	}
+	w := pca.FrequencyWarnings()
+	if len(w) != 1 || !strings.Contains(w[0], "servo on channel 0") || !strings.Contains(w[0], "shorter than") {
+		t.Errorf("FrequencyWarnings() at 1526 Hz = %v, want one servo warning", w)
+	}
+	if err := pca.SetPWMFreq(400); err != nil {
+		t.Fatalf("SetPWMFreq() error = %v", err)
+	}
+	if w := pca.FrequencyWarnings(); len(w) != 2 || !strings.Contains(strings.Join(w, "\n"), "outside 40-330 Hz") {
+		t.Errorf("FrequencyWarnings() at 400 Hz = %v, want servo and LED warnings", w)
+	}
+}
+
+func TestStrictFrequency(t *testing.T) {
+	config := DefaultConfig()
+	config.StrictFrequency = true
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	_, err = NewServo(pca, 0, DefaultServoCalibration())
+	var ferr *FrequencyError
+	if !errors.Is(err, ErrFrequencyMismatch) || !errors.As(err, &ferr) {
+		t.Fatalf("NewServo() at 1000 Hz error = %v, want *FrequencyError", err)
+	}
+	if ferr.Frequency != 1000 || ferr.Min != 40 || ferr.Max != 330 || ferr.Pulse != DefaultServoCalibration().MaxPulse {
+		t.Errorf("FrequencyError = %+v", ferr)
+	}
+	if owner := pca.ChannelOwner(0); owner != "" {
+		t.Errorf("channel 0 owner after rejected servo = %q, want free", owner)
+	}
+	ctx := context.Background()
+	if _, err := NewESC(ctx, pca, 1, DefaultESCCalibration()); !errors.Is(err, ErrFrequencyMismatch) {
+		t.Errorf("NewESC() at 1000 Hz error = %v, want ErrFrequencyMismatch", err)
+	}
+	// Светодиоды только предупреждают даже в строгом режиме.
+	if err := pca.SetPWMFreq(FreqServo50Hz); err != nil {
+		t.Fatalf("SetPWMFreq() error = %v", err)
+	}
+	if _, err := NewRGBLed(pca, 4, 5, 6); err != nil {
+		t.Fatalf("NewRGBLed() at 50 Hz error = %v", err)
+	}
+	if _, err := NewServo(pca, 0, DefaultServoCalibration()); err != nil {
+		t.Fatalf("NewServo() at 50 Hz error = %v", err)
+	}
+	if err := pca.SetPWMFreq(1000); !errors.Is(err, ErrFrequencyMismatch) {
+		t.Errorf("SetPWMFreq(1000) with a servo error = %v, want ErrFrequencyMismatch", err)
+	}
+	if pca.frequency() != FreqServo50Hz {
+		t.Errorf("frequency after rejected change = %v, want 50", pca.frequency())
+	}
+	if err := pca.CheckFrequency(200); err == nil || !strings.Contains(err.Error(), "LEDs may flicker") {
+		t.Errorf("CheckFrequency(200) = %v, want LED warning only", err)
+	}
+
+	// Без StrictFrequency несовместимость только пишется в лог.
+	loose, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := NewServo(loose, 0, DefaultServoCalibration()); err != nil {
+		t.Errorf("NewServo() without StrictFrequency error = %v", err)
+	}
+	if err := loose.CheckFrequency(1000); !errors.Is(err, ErrFrequencyMismatch) {
+		t.Errorf("CheckFrequency() = %v, want ErrFrequencyMismatch", err)
+	}
+}
+
+func TestSetPWMValidation(t *testing.T) {
+	dev := NewTestI2C()
+	pca, err := New(dev, DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+	if err := pca.SetPWM(ctx, 0, 100, 2000); err != nil {
+		t.Fatalf("SetPWM() error = %v", err)
+	}
+	// 5000 = 0x1388 записалось бы как FULL_OFF с шагом 0x388.
+	for _, v := range [][2]uint16{{0, 4096 + 1}, {0, 5000}, {5000, 0}, {0, 0x2000}, {0xFFFF, 0}} {
+		if err := pca.SetPWM(ctx, 0, v[0], v[1]); !errors.Is(err, ErrInvalidPWM) {
+			t.Errorf("SetPWM(%d, %d) error = %v, want ErrInvalidPWM", v[0], v[1], err)
+		}
+	}
+	if _, on, off, _ := pca.GetChannelState(0); on != 100 || off != 2000 {
+		t.Errorf("channel 0 after rejected writes = %d/%d, want 100/2000", on, off)
+	}
+	if got := dev.registers[RegLed0+3]; got != 2000>>8 {
+		t.Errorf("LED0_OFF_H after rejected writes = %#x, want %#x", got, 2000>>8)
+	}
+
+	// Флаги, переход через границу периода и одинаковые on/off допустимы.
+	for _, v := range [][2]uint16{{FullOn, 0}, {0, FullOff}, {FullOn, FullOff}, {3000, 1000}, {4095, 4095}} {
+		if err := pca.SetPWM(ctx, 1, v[0], v[1]); err != nil {
+			t.Errorf("SetPWM(%d, %d) error = %v", v[0], v[1], err)
+		}
+	}
+	if err := pca.SetPWM(ctx, 1, FullOn, 0); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := pca.GetChannel(1); state.Duty != 100 {
+		t.Errorf("FullOn duty = %v, want 100", state.Duty)
+	}
+
+	if err := pca.SetAllPWM(ctx, 0, 4097); !errors.Is(err, ErrInvalidPWM) {
+		t.Errorf("SetAllPWM() error = %v, want ErrInvalidPWM", err)
+	}
+	if err := pca.SetMultiPWMValues(ctx, []PWMValue{{Channel: 2, Off: 100}, {Channel: 3, Off: 6000}}); !errors.Is(err, ErrInvalidPWM) {
+		t.Errorf("SetMultiPWMValues() error = %v, want ErrInvalidPWM", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(2); off == 100 {
+		t.Error("SetMultiPWMValues() wrote channel 2 before rejecting channel 3")
+	}
+	if err := pca.SetMultiPWM(ctx, map[int]struct{ On, Off uint16 }{4: {On: 4100}}); !errors.Is(err, ErrInvalidPWM) {
+		t.Errorf("SetMultiPWM() error = %v, want ErrInvalidPWM", err)
+	}
+	if err := pca.SetChannelFailsafe(5, 0, 8000); !errors.Is(err, ErrInvalidPWM) {
+		t.Errorf("SetChannelFailsafe() error = %v, want ErrInvalidPWM", err)
+	}
+
+	var frame RenderFrame
+	frame.Set(6, FullOn, 0)
+	if _, _, ok := frame.Get(6); !ok || frame.err != nil {
+		t.Errorf("RenderFrame.Set(FullOn) rejected: %v", frame.err)
+	}
+	frame.Set(7, 0, 4097)
+	if !errors.Is(frame.err, ErrInvalidPWM) {
+		t.Errorf("RenderFrame.Set(4097) error = %v, want ErrInvalidPWM", frame.err)
+	}
+}
+
+func TestDutyStats(t *testing.T) {
+	tr := newDutyTracker(ChipPCA9685, []time.Duration{time.Minute})
+	t0 := tr.start
+	tr.observe(t0, RegMode1, []byte{Mode1AutoInc})
+	// Канал 0 – 25%, канал 1 включён полностью.
+	tr.observe(t0, RegLed0, []byte{0, 0, 0, 4})
+	tr.observe(t0, RegLed0+4, []byte{0, 0x10, 0, 0})
+	tr.observe(t0.Add(40*time.Second), RegLed0+4, []byte{0, 0, 0, 0x10})
+	tr.observe(t0.Add(50*time.Second), RegMode1, []byte{Mode1Sleep | Mode1AutoInc})
+	tr.observe(t0.Add(60*time.Second), RegMode1, []byte{Mode1AutoInc})
+
+	stats := tr.stats(t0.Add(100 * time.Second))
+	c0, c1 := stats[0], stats[1]
+	if c0.Elapsed != 100*time.Second {
+		t.Errorf("Elapsed = %v, want 100s", c0.Elapsed)
+	}
+	// Канал 0 работал 90 с из 100 (10 с сна) со скважностью 25%.
+	if c0.OnTime != 22500*time.Millisecond || c0.ActiveTime != 90*time.Second || c0.Starts != 2 {
+		t.Errorf("channel 0 stats = %+v", c0)
+	}
+	if math.Abs(c0.Average-22.5) > 1e-9 || c0.Duty != 25 {
+		t.Errorf("channel 0 average = %v, duty = %v, want 22.5, 25", c0.Average, c0.Duty)
+	}
+	if c1.OnTime != 40*time.Second || c1.Starts != 1 || c1.Duty != 0 {
+		t.Errorf("channel 1 stats = %+v", c1)
+	}
+	if avg := c0.Averages[0]; avg.Window != time.Minute || avg.Duty <= 0 || avg.Duty >= 25 {
+		t.Errorf("channel 0 1-minute average = %+v", avg)
+	}
+	// Скользящее среднее сходится к постоянной скважности.
+	if avg := tr.stats(t0.Add(time.Hour))[0].Averages[0].Duty; math.Abs(avg-25) > 0.01 {
+		t.Errorf("channel 0 1-minute average after an hour = %v, want 25", avg)
+	}
+
+	tr.reset(t0.Add(time.Hour))
+	if s := tr.stats(t0.Add(time.Hour))[0]; s.OnTime != 0 || s.Starts != 0 || s.Duty != 25 {
+		t.Errorf("channel 0 after reset = %+v", s)
+	}
+
+	// Учитывается фактический выход: мастер-яркость и затемнение.
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+	if err := pca.SetPWM(ctx, 3, 0, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if s := pca.DutyStats()[3]; s.Duty != 50 || s.Starts != 1 {
+		t.Errorf("channel 3 after SetPWM = %+v", s)
+	}
+	if err := pca.SetMaster(ctx, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if s := pca.DutyStats()[3]; s.Duty != 25 {
+		t.Errorf("channel 3 duty at master 0.5 = %v, want 25", s.Duty)
+	}
+	if err := pca.BlackoutAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s := pca.DutyStats()[3]; s.Duty != 0 {
+		t.Errorf("channel 3 duty during blackout = %v, want 0", s.Duty)
+	}
+	pca.ResetDutyStats()
+	if s := pca.DutyStats()[3]; s.OnTime > time.Millisecond || s.Starts != 0 {
+		t.Errorf("channel 3 after ResetDutyStats = %+v", s)
+	}
+}
+
+func TestEnergyReport(t *testing.T) {
+	tr := newDutyTracker(ChipPCA9685, nil)
+	t0 := tr.start
+	tr.observe(t0, RegMode1, []byte{Mode1AutoInc})
+	tr.setLoad(0, 12, t0)
+	tr.observe(t0, RegLed0, []byte{0, 0, 0, 8}) // 50%
+	tr.setLoad(0, 24, t0.Add(time.Hour))
+	load, power, energy := tr.energy(0, t0.Add(2*time.Hour))
+	// 12 Вт × 50% × 1 ч + 24 Вт × 50% × 1 ч.
+	if load != 24 || power != 12 || math.Abs(energy-18) > 1e-9 {
+		t.Errorf("energy() = %v W, %v W, %v Wh, want 24, 12, 18", load, power, energy)
+	}
+
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := pca.SetChannelLoad(0, -1); err == nil {
+		t.Error("SetChannelLoad(-1): expected error")
+	}
+	led, err := NewRGBLed(pca, 0, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ch, w := range map[int]float64{0: 3, 1: 3, 2: 3, 5: 10} {
+		if err := pca.SetChannelLoad(ch, w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := pca.ChannelLoad(5); got != 10 {
+		t.Errorf("ChannelLoad(5) = %v, want 10", got)
+	}
+	ctx := context.Background()
+	if err := led.SetColor(ctx, 255, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.SetPWM(ctx, 5, 0, 1024); err != nil {
+		t.Fatal(err)
+	}
+	r := pca.Energy()
+	if len(r.Channels) != 4 || math.Abs(r.Power-(3*4095.0/4096+2.5)) > 0.01 {
+		t.Errorf("Energy() = %+v, want 4 channels, %.2f W", r, 3*4095.0/4096+2.5)
+	}
+	if len(r.Peripherals) != 1 || !reflect.DeepEqual(r.Peripherals[0].Channels, []int{0, 1, 2}) || math.Abs(r.Peripherals[0].Power-3) > 0.01 {
+		t.Errorf("Energy().Peripherals = %+v", r.Peripherals)
+	}
+	if s, _ := pca.GetChannel(5); s.Load != 10 || s.Power != 2.5 {
+		t.Errorf("GetChannel(5) load/power = %v/%v, want 10/2.5", s.Load, s.Power)
+	}
+	if c := pca.Counters(); math.Abs(c.Power-r.Power) > 0.01 {
+		t.Errorf("Counters().Power = %v, want %v", c.Power, r.Power)
+	}
+
+	other, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	g := NewControllerGroup(nil, pca, other)
+	if gr := g.Energy(); len(gr.Devices) != 2 || math.Abs(gr.Power-r.Power) > 0.01 {
+		t.Errorf("group Energy() = %+v", gr)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	var events []Event
+	var mu sync.Mutex
+	config := DefaultConfig()
+	config.InitialFreq = 50
+	config.OnEvent = func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Type == EventMaintenanceDue {
+			events = append(events, e)
+		}
+	}
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ctx := context.Background()
+	pump, err := NewPump(pca, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	servo, err := NewServo(pca, 0, DefaultServoCalibration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.SetMaintenance(pump, "", 500); err == nil {
+		t.Error("SetMaintenance() without name: expected error")
+	}
+	// Счётчик восстановлен почти у срока: до замены трубки осталось 3.6 мс работы.
+	if err := pca.SetMaintenance(pump, "replace dosing tube", 500, WithMaintenanceValue(500-1e-6)); err != nil {
+		t.Fatalf("SetMaintenance(pump) error = %v", err)
+	}
+	if err := pca.SetMaintenance(servo, "lubricate gears", 3); err != nil {
+		t.Fatalf("SetMaintenance(servo) error = %v", err)
+	}
+	if due := pca.MaintenanceDue(); len(due) != 0 {
+		t.Fatalf("MaintenanceDue() before running = %+v", due)
+	}
+
+	if err := pump.SetSpeed(ctx, 50); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	due := pca.MaintenanceDue()
+	if len(due) != 1 || due[0].Name != "replace dosing tube" || due[0].Kind != MaintenancePumpHours || !reflect.DeepEqual(due[0].Channels, []int{3}) {
+		t.Fatalf("MaintenanceDue() after running = %+v", due)
+	}
+	if s, _ := pca.GetChannel(3); !reflect.DeepEqual(s.Maintenance, []string{"replace dosing tube"}) {
+		t.Errorf("GetChannel(3).Maintenance = %v", s.Maintenance)
+	}
+
+	// 0→90→180 – один ход, 180→90→0 – второй, 0→45 – третий.
+	for _, angle := range []float64{90, 180, 90, 0} {
+		if err := servo.SetAngle(ctx, angle); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := pca.Maintenance()[1]; s.Value != 2 || s.Due {
+		t.Errorf("servo maintenance after two strokes = %+v", s)
+	}
+	if err := servo.SetAngle(ctx, 45); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(events) != 2 || events[0].Channel != 3 || events[1].Name != "lubricate gears" || events[1].Channel != 0 {
+		t.Errorf("maintenance events = %+v", events)
+	}
+	mu.Unlock()
+
+	if err := pca.ResetMaintenance(pump, "replace dosing tube"); err != nil {
+		t.Fatal(err)
+	}
+	if s := pca.Maintenance()[0]; s.Due || s.Value > 1e-3 {
+		t.Errorf("pump maintenance after reset = %+v", s)
+	}
+	if err := pca.ResetMaintenance(pump, "unknown"); err == nil {
+		t.Error("ResetMaintenance(unknown): expected error")
+	}
+	if !pca.ClearMaintenance(servo, "lubricate gears") || len(pca.Maintenance()) != 1 {
+		t.Error("ClearMaintenance() did not remove the servo item")
+	}
+}
+
+func TestDMXSignalLoss(t *testing.T) {
+	events := make(chan Event, 8)
+	config := DefaultConfig()
+	config.OnEvent = func(e Event) {
+		if e.Type == EventDMXSignalLost || e.Type == EventDMXSignalRestored {
+			events <- e
+		}
+	}
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	mapper := NewDMXMapper()
+	if err := mapper.Patch(1, 1, pca, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := mapper.Patch(1, 3, pca, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := mapper.SetSignalLoss(DMXSignalLoss{Timeout: -time.Second}); err == nil {
+		t.Error("SetSignalLoss() with negative timeout: expected error")
+	}
+	if err := mapper.SetSignalLoss(DMXSignalLoss{Timeout: 20 * time.Millisecond, Action: DMXLossFade}); err != nil {
+		t.Fatalf("SetSignalLoss() error = %v", err)
+	}
+
+	waitEvent := func(want EventType) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.Type != want || e.Name != "DMX universe 1" {
+				t.Fatalf("event = %v %q, want %v", e.Type, e.Name, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %v event", want)
+		}
+	}
+	waitOff := func(ch int, want uint16) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			_, _, off, _ := pca.GetChannelState(ch)
+			if off == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("channel %d off = %d, want %d", ch, off, want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if err := mapper.Apply(ctx, 1, []byte{255, 0, 51}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	waitEvent(EventDMXSignalLost)
+	waitOff(0, 0)
+	waitOff(5, 0)
+
+	// Новый кадр восстанавливает вывод.
+	if err := mapper.Apply(ctx, 1, []byte{255, 0, 51}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	waitEvent(EventDMXSignalRestored)
+	waitOff(0, 4095)
+
+	// Дежурная сцена: канал 0 гаснет, канал 5 переходит к значению сцены.
+	if err := mapper.SetSignalLoss(DMXSignalLoss{
+		Timeout: 20 * time.Millisecond,
+		Action:  DMXLossScene,
+		Fade:    50 * time.Millisecond,
+		Scene:   []byte{0, 0, 102},
+	}); err != nil {
+		t.Fatalf("SetSignalLoss(scene) error = %v", err)
+	}
+	if err := mapper.Apply(ctx, 1, []byte{255, 0, 51}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	waitEvent(EventDMXSignalLost)
+	waitOff(0, 0)
+	waitOff(5, 1638)
+
+	if err := mapper.SetSignalLoss(DMXSignalLoss{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSourceArbitration(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+	scheduler := WithSource(ctx, "scheduler:feed")
+	mqtt := WithSource(ctx, "mqtt")
+	local := WithSource(ctx, "local")
+	off := func(ch int) uint16 {
+		t.Helper()
+		_, _, off, _ := pca.GetChannelState(ch)
+		return off
+	}
+
+	// Без приоритетов действует последняя запись.
+	if err := pca.SetPWM(mqtt, 0, 0, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.SetPWM(scheduler, 0, 0, 200); err != nil || off(0) != 200 {
+		t.Fatalf("SetPWM() without arbitration: err = %v, off = %d", err, off(0))
+	}
+
+	pca.SetSourcePriority("scheduler", 10)
+	pca.SetSourcePriority("mqtt", 20)
+	pca.SetSourcePriority("local", 30)
+
+	if err := pca.SetPWM(mqtt, 0, 0, 1000); err != nil {
+		t.Fatalf("SetPWM(mqtt) error = %v", err)
+	}
+	if err := pca.SetPWM(scheduler, 0, 0, 500); !errors.Is(err, ErrOverridden) {
+		t.Fatalf("SetPWM(scheduler) error = %v, want ErrOverridden", err)
+	}
+	if off(0) != 1000 {
+		t.Errorf("off = %d after overridden command, want 1000", off(0))
+	}
+	if s, _ := pca.GetChannel(0); s.Source != "mqtt" {
+		t.Errorf("GetChannel().Source = %q, want mqtt", s.Source)
+	}
+
+	// Местное управление перехватывает канал и после освобождения возвращает
+	// его MQTT, затем планировщику с последним заданным им значением.
+	if err := pca.SetPWM(local, 0, 0, 3000); err != nil || off(0) != 3000 {
+		t.Fatalf("SetPWM(local): err = %v, off = %d", err, off(0))
+	}
+	if err := pca.ReleaseSource(ctx, "local"); err != nil || off(0) != 1000 {
+		t.Fatalf("ReleaseSource(local): err = %v, off = %d, want 1000", err, off(0))
+	}
+	if err := pca.ReleaseSource(ctx, "mqtt", 0); err != nil || off(0) != 500 {
+		t.Fatalf("ReleaseSource(mqtt): err = %v, off = %d, want 500", err, off(0))
+	}
+	sources, _ := pca.ChannelSources(0)
+	if len(sources) != 1 || sources[0].Source != "scheduler:feed" || !sources[0].Active || sources[0].Priority != 10 {
+		t.Errorf("ChannelSources() = %+v", sources)
+	}
+
+	// Групповая запись выводит только каналы, не удерживаемые другими источниками.
+	if err := pca.SetPWM(mqtt, 1, 0, 1500); err != nil {
+		t.Fatal(err)
+	}
+	err = pca.SetMultiPWMValues(scheduler, []PWMValue{{Channel: 1, Off: 100}, {Channel: 2, Off: 200}})
+	if !errors.Is(err, ErrOverridden) || off(1) != 1500 || off(2) != 200 {
+		t.Errorf("SetMultiPWMValues(scheduler): err = %v, ch1 = %d, ch2 = %d", err, off(1), off(2))
+	}
+	if err := pca.SetAllPWM(scheduler, 0, 4000); !errors.Is(err, ErrOverridden) || off(1) != 1500 || off(5) != 4000 {
+		t.Errorf("SetAllPWM(scheduler): err = %v, ch1 = %d, ch5 = %d", err, off(1), off(5))
+	}
+
+	// HTP: среди источников одного приоритета действует наибольшее значение.
+	if err := pca.SetArbitrationMode(ArbitrationHTP); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.ReleaseSource(ctx, "scheduler:feed", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.SetPWM(WithSource(ctx, "scheduler:dim"), 3, 0, 800); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.SetPWM(WithSource(ctx, "scheduler:night"), 3, 0, 300); err != nil || off(3) != 800 {
+		t.Errorf("HTP: err = %v, off = %d, want 800", err, off(3))
+	}
+
+	// Безопасные значения выводятся независимо от приоритетов.
+	if err := pca.SetChannelFailsafe(1, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.ApplyFailsafe(ctx); err != nil || off(1) != 0 {
+		t.Errorf("ApplyFailsafe(): err = %v, off = %d", err, off(1))
+	}
+
+	pca.ResetArbitration()
+	if err := pca.SetPWM(scheduler, 0, 0, 42); err != nil || off(0) != 42 {
+		t.Errorf("SetPWM() after ResetArbitration: err = %v, off = %d", err, off(0))
+	}
+}
+
+func TestCaptureScene(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	led, err := NewRGBLed(pca, 0, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pump, err := NewPump(pca, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := led.SetColor(ctx, 255, 0, 51); err != nil {
+		t.Fatal(err)
+	}
+	if err := pump.SetSpeed(ctx, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.SetPWM(ctx, 9, 1000, 1500); err != nil {
+		t.Fatal(err)
+	}
+
+	scene, err := pca.CaptureScene("evening", CapturePeripherals(led), CaptureChannels(9))
+	if err != nil {
+		t.Fatalf("CaptureScene() error = %v", err)
+	}
+	_, _, red, _ := pca.GetChannelState(0)
+	_, _, blue, _ := pca.GetChannelState(2)
+	want := map[int]uint16{0: red, 1: 0, 2: blue, 9: 500}
+	if scene.Name != "evening" || !reflect.DeepEqual(scene.Values, want) {
+		t.Fatalf("CaptureScene() = %+v, want values %v", scene, want)
+	}
+	if _, err := pca.CaptureScene("bad", CaptureChannels(16)); err == nil {
+		t.Error("CaptureScene() with channel 16: expected error")
+	}
+
+	// Полностью включённый канал снимается как 4095; без опций – все включённые каналы.
+	if err := pca.SetPWM(ctx, 5, FullOn, 0); err != nil {
+		t.Fatal(err)
+	}
+	all, err := pca.CaptureScene("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Values) != 16 || all.Values[5] != 4095 {
+		t.Errorf("CaptureScene() without options: %d channels, ch5 = %d", len(all.Values), all.Values[5])
+	}
+
+	// Сохранённая сцена восстанавливает образ.
+	data, err := json.Marshal(scene)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded Scene
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if err := led.SetColor(ctx, 0, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.ApplyScene(ctx, loaded); err != nil {
+		t.Fatalf("ApplyScene() error = %v", err)
+	}
+	if _, on, off, _ := pca.GetChannelState(0); on != 0 || off != red {
+		t.Errorf("channel 0 after ApplyScene = %d/%d, want 0/%d", on, off, red)
+	}
+}
+
+func TestSceneTiming(t *testing.T) {
+	var mu sync.Mutex
+	var applied []string
+	config := DefaultConfig()
+	config.OnEvent = func(e Event) {
+		if e.Type == EventSceneApplied {
+			mu.Lock()
+			applied = append(applied, e.Name)
+			mu.Unlock()
+		}
+	}
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+	off := func(ch int) uint16 {
+		t.Helper()
+		_, _, off, _ := pca.GetChannelState(ch)
+		return off
+	}
+
+	// Фон (каналы 0, 1) загорается за 1 с, акцент (канал 2) – через 1 с за 2 с.
+	scene := Scene{
+		Name:   "evening",
+		Values: map[int]uint16{0: 4000, 1: 2000, 2: 3000},
+		Fade:   time.Second,
+		Timing: map[int]SceneTiming{2: {Delay: time.Second, Fade: 2 * time.Second}},
+	}
+	if d := scene.Duration(); d != 3*time.Second {
+		t.Errorf("Duration() = %v, want 3s", d)
+	}
+	r := NewRenderer(pca)
+	if err := r.ApplyScene(Scene{Values: map[int]uint16{0: 4096}, Fade: time.Second}); !errors.Is(err, ErrInvalidPWM) {
+		t.Errorf("ApplyScene() with FullOff value: error = %v, want ErrInvalidPWM", err)
+	}
+	if err := r.ApplyScene(Scene{Values: map[int]uint16{0: 1}, Timing: map[int]SceneTiming{3: {Fade: time.Second}}}); err == nil {
+		t.Error("ApplyScene() with timing for a channel without value: expected error")
+	}
+	if err := r.ApplyScene(scene); err != nil {
+		t.Fatalf("ApplyScene() error = %v", err)
+	}
+
+	start := time.Now()
+	steps := []struct {
+		at         time.Duration
+		ch0, ch1   uint16
+		ch2        uint16
+		sceneIsSet bool
+	}{
+		{0, 0, 0, 0, false},
+		{500 * time.Millisecond, 2000, 1000, 0, false},
+		{time.Second, 4000, 2000, 0, false},
+		{2 * time.Second, 4000, 2000, 1500, false},
+		{3 * time.Second, 4000, 2000, 3000, true},
+	}
+	for _, s := range steps {
+		if err := r.Render(ctx, start.Add(s.at)); err != nil {
+			t.Fatalf("Render(%v) error = %v", s.at, err)
+		}
+		if off(0) != s.ch0 || off(1) != s.ch1 || off(2) != s.ch2 {
+			t.Errorf("at %v: channels = %d/%d/%d, want %d/%d/%d", s.at, off(0), off(1), off(2), s.ch0, s.ch1, s.ch2)
+		}
+		mu.Lock()
+		got := len(applied) == 1
+		mu.Unlock()
+		if got != s.sceneIsSet {
+			t.Errorf("at %v: EventSceneApplied emitted = %v", s.at, got)
+		}
+	}
+	// После перехода значения сцены остаются базовыми значениями рендерера.
+	if on, off, ok := r.base.Get(2); !ok || on != 0 || off != 3000 {
+		t.Errorf("base value of channel 2 = %d/%d/%v", on, off, ok)
+	}
+
+	// ApplyScene контроллера проигрывает переход целиком.
+	began := time.Now()
+	err = pca.ApplyScene(ctx, Scene{
+		Name:   "night",
+		Values: map[int]uint16{0: 100, 2: 200},
+		Timing: map[int]SceneTiming{2: {Delay: 30 * time.Millisecond, Fade: 30 * time.Millisecond}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyScene() error = %v", err)
+	}
+	if time.Since(began) < 60*time.Millisecond || off(0) != 100 || off(2) != 200 {
+		t.Errorf("ApplyScene() returned after %v with channels %d/%d", time.Since(began), off(0), off(2))
+	}
+	mu.Lock()
+	if !reflect.DeepEqual(applied, []string{"evening", "night"}) {
+		t.Errorf("EventSceneApplied names = %v", applied)
+	}
+	mu.Unlock()
+}
+
+func TestRandomEffect(t *testing.T) {
+	if _, err := NewRandomEffect(RandomEffectConfig{Mode: RandomTwinkle}); err == nil {
+		t.Error("NewRandomEffect() without channels: expected error")
+	}
+	if _, err := NewRandomEffect(RandomEffectConfig{Channels: []int{0}, Params: RandomParams{Min: 100, Max: 50}}); err == nil {
+		t.Error("NewRandomEffect() with min > max: expected error")
+	}
+
+	// play выводит 200 кадров по 20 мс и возвращает значения каналов 0–3.
+	play := func(e *RandomEffect) [][4]uint16 {
+		start := time.Unix(1700000000, 0)
+		out := make([][4]uint16, 200)
+		for i := range out {
+			var frame RenderFrame
+			if !e.Render(start.Add(time.Duration(i)*20*time.Millisecond), &frame) {
+				t.Fatal("Render() finished unexpectedly")
+			}
+			if frame.err != nil {
+				t.Fatalf("frame error: %v", frame.err)
+			}
+			for ch := range out[i] {
+				_, out[i][ch], _ = frame.Get(ch)
+			}
+		}
+		return out
+	}
+	for _, mode := range []RandomMode{RandomTwinkle, RandomFireflies, RandomLightning} {
+		cfg := RandomEffectConfig{
+			Mode:     mode,
+			Channels: []int{0, 1, 2, 3},
+			Seed:     42,
+			Params:   RandomParams{Density: 1, Min: 100, Max: 3000},
+		}
+		a, err := NewRandomEffect(cfg)
+		if err != nil {
+			t.Fatalf("NewRandomEffect(%v) error = %v", mode, err)
+		}
+		b, _ := NewRandomEffect(cfg)
+		cfg.Seed = 7
+		c, _ := NewRandomEffect(cfg)
+		framesA, framesB, framesC := play(a), play(b), play(c)
+		if !reflect.DeepEqual(framesA, framesB) {
+			t.Errorf("%v: effects with the same seed differ", mode)
+		}
+		if reflect.DeepEqual(framesA, framesC) {
+			t.Errorf("%v: effects with different seeds are identical", mode)
+		}
+		lit := false
+		for _, f := range framesA {
+			for _, v := range f {
+				if v < 100 || v > 3000 {
+					t.Fatalf("%v: value %d outside 100-3000", mode, v)
+				}
+				lit = lit || v > 100
+			}
+		}
+		if !lit {
+			t.Errorf("%v: no flashes in 4 s at density 1", mode)
+		}
+	}
+
+	// Пиксель RGB получает цвет из заданного диапазона; параметры меняются на ходу.
+	e, err := NewRandomEffect(RandomEffectConfig{
+		Mode:   RandomLightning,
+		RGB:    [][3]int{{4, 5, 6}},
+		Params: RandomParams{Density: 1, ColorFrom: color.RGBA{R: 255}, ColorTo: color.RGBA{R: 255}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.SetParams(RandomParams{Density: 2}); err == nil {
+		t.Error("SetParams() with density 2: expected error")
+	}
+	if err := e.SetParams(RandomParams{Density: 1, Speed: 2, ColorFrom: color.RGBA{R: 255}, ColorTo: color.RGBA{R: 255}}); err != nil {
+		t.Fatal(err)
+	}
+	if p := e.Params(); p.Speed != 2 || p.Max != 4095 {
+		t.Errorf("Params() = %+v", p)
+	}
+	start := time.Unix(1700000000, 0)
+	red := false
+	for i := 0; i < 500; i++ {
+		var frame RenderFrame
+		e.Render(start.Add(time.Duration(i)*10*time.Millisecond), &frame)
+		_, r, _ := frame.Get(4)
+		_, g, _ := frame.Get(5)
+		_, b, _ := frame.Get(6)
+		if g != 0 || b != 0 {
+			t.Fatalf("green/blue = %d/%d, want 0", g, b)
+		}
+		red = red || r > 0
+	}
+	if !red {
+		t.Error("lightning never flashed")
+	}
+	e.Stop()
+	if e.Render(start, &RenderFrame{}) {
+		t.Error("Render() after Stop() = true")
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	config := DefaultConfig()
+	config.InitialFreq = 50
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	servo, err := NewServo(pca, 0, DefaultServoCalibration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.Identify(ctx, 0, time.Second); err == nil {
+		t.Error("Identify() on a servo channel: expected error")
+	}
+	if err := pca.IdentifyPeripheral(ctx, servo, time.Second); err == nil {
+		t.Error("IdentifyPeripheral(servo): expected error")
+	}
+	if err := pca.Identify(ctx, 3, 0); err == nil {
+		t.Error("Identify() with zero duration: expected error")
+	}
+
+	if err := pca.SetPWM(ctx, 3, 0, 1234); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- pca.Identify(ctx, 3, 200*time.Millisecond) }()
+	time.Sleep(50 * time.Millisecond)
+	if _, on, _, _ := pca.GetChannelState(3); on != FullOn {
+		t.Errorf("channel 3 during first flash: on = %#x, want FullOn", on)
+	}
+	if err := pca.Pulse(ctx, 3, 100, time.Millisecond); err == nil {
+		t.Error("Pulse() during Identify: expected error")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Identify() error = %v", err)
+	}
+	if _, on, off, _ := pca.GetChannelState(3); on != 0 || off != 1234 {
+		t.Errorf("channel 3 after Identify = %d/%d, want 0/1234", on, off)
+	}
+
+	// Отмена контекста завершает мигание досрочно и восстанавливает канал.
+	led, err := NewRGBLed(pca, 4, 5, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cctx, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	if err := pca.IdentifyPeripheral(cctx, led, time.Minute); err != nil {
+		t.Fatalf("IdentifyPeripheral() after cancel: error = %v", err)
+	}
+	for ch := 4; ch <= 6; ch++ {
+		if _, on, off, _ := pca.GetChannelState(ch); on != 0 || off != 0 {
+			t.Errorf("channel %d after cancelled identify = %d/%d", ch, on, off)
+		}
+	}
+
+	handler := pca.IdentifyHandler()
+	for _, tc := range []struct {
+		method, query string
+		want          int
+	}{
+		{http.MethodGet, "channel=3", http.StatusMethodNotAllowed},
+		{http.MethodPost, "channel=16", http.StatusBadRequest},
+		{http.MethodPost, "channel=3&duration=2h", http.StatusBadRequest},
+		{http.MethodPost, "channel=0", http.StatusConflict},
+		{http.MethodPost, "channel=3&duration=20ms", http.StatusAccepted},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tc.method, IdentifyPath+"?"+tc.query, nil))
+		if rec.Code != tc.want {
+			t.Errorf("%s ?%s: status = %d, want %d", tc.method, tc.query, rec.Code, tc.want)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for pca.channels[3].pulsing.Load() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	// Строгий мок без ожиданий: любая транзакция на шине – ошибка.
+	config := DefaultConfig()
+	config.DryRun = true
+	pca, err := New(NewMockI2C(), config)
+	if err != nil {
+		t.Fatalf("New() in dry run touched the bus: %v", err)
+	}
+	ctx := context.Background()
+	if err := pca.SetPWM(ctx, 2, 0, 1000); err != nil {
+		t.Fatalf("SetPWM() in dry run: %v", err)
+	}
+	if err := pca.SetPWM(ctx, 2, 0, 5000); !errors.Is(err, ErrInvalidPWM) {
+		t.Errorf("SetPWM(5000) in dry run = %v, want ErrInvalidPWM", err)
+	}
+
+	dev := NewTestI2C()
+	var journal bytes.Buffer
+	config = DefaultConfig()
+	config.Journal = NewJournal(&journal)
+	pca, err = New(dev, config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pca.Close()
+	if err := pca.SetPWM(ctx, 3, 0, 1234); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.SetDryRun(ctx, true); err != nil {
+		t.Fatalf("SetDryRun(true) error = %v", err)
+	}
+	if !pca.DryRun() || !pca.Counters().DryRun {
+		t.Error("DryRun() = false after SetDryRun(true)")
+	}
+	before := dev.registers
+	if err := pca.SetPWM(ctx, 3, 0, 3000); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.SetPWMFreq(200); err != nil {
+		t.Fatal(err)
+	}
+	if dev.registers != before {
+		t.Error("dry run wrote to the device")
+	}
+	if _, _, off, _ := pca.GetChannelState(3); off != 3000 {
+		t.Errorf("cached off in dry run = %d, want 3000", off)
+	}
+	if mode, err := pca.readMode1(); err != nil || mode&Mode1AutoInc == 0 {
+		t.Errorf("readMode1() in dry run = %#x, %v; want device registers", mode, err)
+	}
+
+	if err := pca.SetDryRun(ctx, false); err != nil {
+		t.Fatalf("SetDryRun(false) error = %v", err)
+	}
+	reg := RegLed0 + 4*3
+	if off := int(dev.registers[reg+2]) | int(dev.registers[reg+3])<<8; off != 3000 {
+		t.Errorf("device off after dry run = %d, want 3000", off)
+	}
+	var dry, live int
+	dec := json.NewDecoder(&journal)
+	for dec.More() {
+		var e JournalEntry
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Op != "SetPWM" {
+			continue
+		}
+		if e.DryRun {
+			dry++
+		} else {
+			live++
+		}
+	}
+	if dry != 1 || live != 1 {
+		t.Errorf("journal SetPWM entries: %d dry run, %d live; want 1 and 1", dry, live)
+	}
+}
+
+func TestDryRunPCA9635(t *testing.T) {
+	ctx := context.Background()
+	dev := NewTestI2C()
+	config := DefaultConfig()
+	config.Chip = ChipPCA9635
+	config.VerifyWrites = true
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("Failed to create PCA9635: %v", err)
+	}
+	defer pca.Close()
+	if err := pca.SetPWM(ctx, 3, 0, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.SetDryRun(ctx, true); err != nil {
+		t.Fatalf("SetDryRun(true) error = %v", err)
+	}
+
+	// Эмулятор заполнен по карте регистров PCA9635, а не PCA9685.
+	shadow := pca.dryDevice()
+	if d := shadow.registers[pca9635AutoInc|(RegPCA9635PWM0+3)]; d != 128 {
+		t.Errorf("dry run PWM3 = %d, want 128", d)
+	}
+	if got := shadow.registers[pca9635AutoInc|RegPCA9635LEDOut0 : pca9635AutoInc|RegPCA9635LEDOut0+4]; !bytes.Equal(got, []byte{0xAA, 0xAA, 0xAA, 0xAA}) {
+		t.Errorf("dry run LEDOUT = % X, want individual PWM", got)
+	}
+	before := dev.registers
+	if err := pca.SetPWM(ctx, 4, 0, 1024); err != nil {
+		t.Fatalf("SetPWM() in dry run error = %v", err)
+	}
+	if dev.registers != before {
+		t.Error("dry run wrote to the device")
+	}
+
+	if err := pca.SetDryRun(ctx, false); err != nil {
+		t.Fatalf("SetDryRun(false) error = %v", err)
+	}
+	if d := dev.registers[pca9635AutoInc|(RegPCA9635PWM0+4)]; d != 64 {
+		t.Errorf("device PWM4 after dry run = %d, want 64", d)
+	}
+}
+
+func TestStartupState(t *testing.T) {
+	ctx := context.Background()
+	dev := NewTestI2C()
+	config := DefaultConfig()
+	config.InitialFreq = 200
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := pca.SetPWM(ctx, 3, 0, 2000); err != nil {
+		t.Fatal(err)
+	}
+
+	// StartupKeep не обращается к регистрам на запись и принимает их в кэш.
+	before := dev.registers
+	config = DefaultConfig()
+	config.StartupState = StartupKeep
+	kept, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("New(StartupKeep) error = %v", err)
+	}
+	if dev.registers != before {
+		t.Error("StartupKeep wrote to the device")
+	}
+	if _, _, off, _ := kept.GetChannelState(3); off != 2000 {
+		t.Errorf("adopted channel 3 off = %d, want 2000", off)
+	}
+	if _, want := prescaleFor(200); kept.Freq != want {
+		t.Errorf("adopted frequency = %v, want %v", kept.Freq, want)
+	}
+
+	// Ненастроенная микросхема инициализируется.
+	fresh := NewTestI2C()
+	if _, err := New(fresh, config); err != nil {
+		t.Fatalf("New(StartupKeep) on a fresh chip error = %v", err)
+	}
+	if fresh.registers[RegMode1]&Mode1AutoInc == 0 || fresh.registers[RegPrescale] == 0 {
+		t.Error("StartupKeep did not initialize an unconfigured chip")
+	}
+
+	// Снимок сохраняется при Close и восстанавливается StartupRestore.
+	snapshot := filepath.Join(t.TempDir(), "snapshot.json")
+	config = DefaultConfig()
+	config.StartupState = StartupRestore
+	config.SnapshotFile = snapshot
+	first, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("New(StartupRestore) without snapshot error = %v", err)
+	}
+	if err := first.SetPWM(ctx, 5, 0, 1500); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	restoredDev := NewTestI2C()
+	restoredDev.registers[RegLed0+4*7+2] = 0xFF // старое значение в регистрах
+	restored, err := New(restoredDev, config)
+	if err != nil {
+		t.Fatalf("New(StartupRestore) error = %v", err)
+	}
+	if _, _, off, _ := restored.GetChannelState(5); off != 1500 {
+		t.Errorf("restored channel 5 off = %d, want 1500", off)
+	}
+	reg := RegLed0 + 4*5
+	if off := int(restoredDev.registers[reg+2]) | int(restoredDev.registers[reg+3])<<8; off != 1500 {
+		t.Errorf("device channel 5 off = %d, want 1500", off)
+	}
+	if restoredDev.registers[RegLed0+4*7+2] != 0 {
+		t.Error("StartupRestore left a stale channel running")
+	}
+
+	config = DefaultConfig()
+	config.StartupState = StartupApplyScene
+	config.StartupScene = &Scene{Name: "dawn", Values: map[int]uint16{1: 300}}
+	scene, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("New(StartupApplyScene) error = %v", err)
+	}
+	if _, _, off, _ := scene.GetChannelState(1); off != 300 {
+		t.Errorf("startup scene channel 1 off = %d, want 300", off)
+	}
+
+	config = DefaultConfig()
+	config.StartupState = StartupRestore
+	if _, err := New(NewTestI2C(), config); err == nil {
+		t.Error("StartupRestore without SnapshotFile: expected error")
+	}
+}
+
+func TestAttach(t *testing.T) {
+	ctx := context.Background()
+	dev := NewTestI2C()
+	config := DefaultConfig()
+	config.InitialFreq = 50
+	config.InvertLogic = true
+	owner, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := owner.SetPWM(ctx, 4, 100, 400); err != nil {
+		t.Fatal(err)
+	}
+	if err := owner.SetPWM(ctx, 9, FullOn, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Настройки Config не применяются: действует состояние микросхемы.
+	config = DefaultConfig()
+	config.StartupState = StartupRestore
+	pca, err := Attach(dev, config)
+	if err != nil {
+		t.Fatalf("Attach() error = %v", err)
+	}
+	if n := pca.Counters().Writes; n != 0 {
+		t.Errorf("Attach() made %d writes, want 0", n)
+	}
+	if _, want := prescaleFor(50); pca.Freq != want {
+		t.Errorf("attached frequency = %v, want %v", pca.Freq, want)
+	}
+	if !pca.inverted.Load() {
+		t.Error("attached controller lost inverted logic")
+	}
+	if _, on, off, _ := pca.GetChannelState(4); on != 100 || off != 400 {
+		t.Errorf("channel 4 = %d/%d, want 100/400", on, off)
+	}
+	if _, on, _, _ := pca.GetChannelState(9); on != FullOn {
+		t.Errorf("channel 9 on = %#x, want FullOn", on)
+	}
+
+	if _, err := Attach(NewTestI2C(), DefaultConfig()); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Attach() to an unconfigured chip = %v, want ErrNotConfigured", err)
+	}
+}
+
+func TestMotionProfile(t *testing.T) {
+	// Кривая не превышает ни одного ограничения профиля.
+	for _, p := range []MotionProfile{
+		{MaxVelocity: 90},
+		{MaxAccel: 200},
+		{MaxJerk: 5000},
+		{MaxVelocity: 120, MaxAccel: 400, MaxJerk: 3000},
+	} {
+		const distance = 90.0
+		d := p.Duration(distance).Seconds()
+		const n = 2000
+		dt := d / n
+		pos := func(i int) float64 { return distance * sCurve(float64(i)/n) }
+		var v, a, j float64
+		for i := 0; i+3 <= n; i++ {
+			v = math.Max(v, math.Abs(pos(i+1)-pos(i))/dt)
+			a = math.Max(a, math.Abs(pos(i+2)-2*pos(i+1)+pos(i))/(dt*dt))
+			j = math.Max(j, math.Abs(pos(i+3)-3*pos(i+2)+3*pos(i+1)-pos(i))/(dt*dt*dt))
+		}
+		const tolerance = 1.01
+		if p.MaxVelocity > 0 && v > p.MaxVelocity*tolerance ||
+			p.MaxAccel > 0 && a > p.MaxAccel*tolerance ||
+			p.MaxJerk > 0 && j > p.MaxJerk*tolerance {
+			t.Errorf("profile %+v: peak velocity %.1f, accel %.1f, jerk %.1f exceed limits", p, v, a, j)
+		}
+	}
+	if got := EaseSCurve.apply(0.5); got != 0.5 {
+		t.Errorf("EaseSCurve.apply(0.5) = %v, want 0.5", got)
+	}
+	if err := (MotionProfile{MaxAccel: -1}).validate(); err == nil {
+		t.Error("negative limit: expected error")
+	}
+
+	var journal bytes.Buffer
+	config := DefaultConfig()
+	config.InitialFreq = 50
+	config.Journal = NewJournal(&journal)
+	pca, err := New(NewTestI2C(), config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+
+	servo, err := NewServo(pca, 0, DefaultServoCalibration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := servo.SetAngle(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	profile := MotionProfile{MaxVelocity: 900, MaxAccel: 20000}
+	if err := servo.SetMotionProfile(profile); err != nil {
+		t.Fatal(err)
+	}
+	journal.Reset()
+	start := time.Now()
+	if err := servo.MoveTo(ctx, 90); err != nil {
+		t.Fatalf("MoveTo() error = %v", err)
+	}
+	if elapsed, want := time.Since(start), profile.Duration(90); elapsed < want*9/10 {
+		t.Errorf("MoveTo() took %v, want about %v", elapsed, want)
+	}
+	if servo.Angle() != 90 {
+		t.Errorf("Angle() after MoveTo = %v, want 90", servo.Angle())
+	}
+	if n := strings.Count(journal.String(), "\n"); n != 1 {
+		t.Errorf("MoveTo() journal entries = %d, want 1 for the final angle", n)
+	}
+	if err := servo.MoveTo(ctx, 500); err == nil {
+		t.Error("MoveTo() out of range: expected error")
+	}
+
+	pump, err := NewPump(pca, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pump.SetMotionProfile(MotionProfile{MaxVelocity: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pump.RampTo(ctx, 60); err != nil {
+		t.Fatalf("RampTo() error = %v", err)
+	}
+	if speed, _ := pump.GetCurrentSpeed(); speed != 60 {
+		t.Errorf("pump speed after RampTo = %v, want 60", speed)
+	}
+}
+
+func TestMasterExemptions(t *testing.T) {
+	dev := NewTestI2C()
+	config := DefaultConfig()
+	config.InitialFreq = 50
+	pca, err := New(dev, config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+	reg := func(ch int) []byte {
+		base := RegLed0 + 4*ch
+		return append([]byte(nil), dev.registers[base:base+4]...)
+	}
+
+	// Полностью включённый канал не гаснет при округлении почти единичной яркости.
+	if err := pca.SetPWM(ctx, 0, FullOn, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := pca.SetMaster(ctx, 0.9999); err != nil {
+		t.Fatal(err)
+	}
+	if got := reg(0); got[1]&0x10 == 0 {
+		t.Errorf("FullOn channel at master 0.9999 = % x, want FULL_ON", got)
+	}
+
+	// Мастер-яркость не изменяет импульс сервопривода.
+	if err := pca.SetMaster(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	servo, err := NewServo(pca, 5, DefaultServoCalibration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := servo.SetAngle(ctx, 30); err != nil {
+		t.Fatal(err)
+	}
+	want := reg(5)
+	if err := pca.SetMaster(ctx, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if got := reg(5); !bytes.Equal(got, want) {
+		t.Errorf("servo pulse after SetMaster(0.5) = % x, want % x", got, want)
+	}
+	if err := pca.SetAllPWM(ctx, 0, 2000); err != nil {
+		t.Fatal(err)
+	}
+	if got := reg(5); binary.LittleEndian.Uint16(got[2:]) != 2000 {
+		t.Errorf("servo channel after SetAllPWM at master 0.5 = % x, want off 2000", got)
+	}
+	if got := reg(6); binary.LittleEndian.Uint16(got[2:]) != 1000 {
+		t.Errorf("plain channel after SetAllPWM at master 0.5 = % x, want off 1000", got)
+	}
+}
+
+func TestFadeTinyDuration(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pca.Close()
+	ctx := context.Background()
+	if err := pca.FadeMulti(ctx, map[int]FadeSpec{1: {0, 4095}}, 10*time.Nanosecond); err != nil {
+		t.Fatalf("FadeMulti() with 10ns error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(1); off != 4095 {
+		t.Errorf("FadeMulti() with 10ns ended at %d, want 4095", off)
+	}
+	if err := pca.FadeMaster(ctx, 0.5, 5*time.Nanosecond); err != nil {
+		t.Fatalf("FadeMaster() with 5ns error = %v", err)
+	}
+	if err := runFade(ctx, 0, time.Second, func(int) error { return nil }); err == nil {
+		t.Error("runFade() with zero steps: expected error")
+	}
+}
+
+func TestFadeChannelTinyDuration(t *testing.T) {
+	pca, err := New(NewTestI2C(), DefaultConfig())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer pca.Close()
+	if err := pca.FadeChannel(context.Background(), 0, 0, 4095, 10*time.Nanosecond); err != nil {
+		t.Fatalf("FadeChannel() with 10ns error = %v", err)
+	}
+	if _, _, off, _ := pca.GetChannelState(0); off != 4095 {
+		t.Errorf("FadeChannel() with 10ns ended at %d, want 4095", off)
+	}
 }
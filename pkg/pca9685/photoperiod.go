@@ -0,0 +1,115 @@
+package pca9685
+
+import (
+	"fmt"
+	"time"
+)
+
+// PhotoperiodPhase – фаза светового дня.
+type PhotoperiodPhase int
+
+const (
+	PhaseNight PhotoperiodPhase = iota
+	PhaseSunrise
+	PhaseDay
+	PhaseSunset
+)
+
+func (p PhotoperiodPhase) String() string {
+	switch p {
+	case PhaseSunrise:
+		return "sunrise"
+	case PhaseDay:
+		return "day"
+	case PhaseSunset:
+		return "sunset"
+	default:
+		return "night"
+	}
+}
+
+// Photoperiod описывает суточный световой день: рассвет начинается в On,
+// закат заканчивается в Off, каждый из них длится Ramp. Световой день может
+// переходить через полночь.
+type Photoperiod struct {
+	On   DailyTrigger
+	Off  DailyTrigger
+	Ramp time.Duration
+}
+
+// Validate проверяет корректность светового дня.
+func (p Photoperiod) Validate() error {
+	for _, t := range []DailyTrigger{p.On, p.Off} {
+		if _, err := t.Next(time.Time{}); err != nil {
+			return err
+		}
+	}
+	length := p.length()
+	if length == 0 {
+		return fmt.Errorf("photoperiod must not be empty")
+	}
+	if p.Ramp < 0 || 2*p.Ramp > length {
+		return fmt.Errorf("ramp %v does not fit into photoperiod of %v", p.Ramp, length)
+	}
+	return nil
+}
+
+// Phase возвращает фазу в момент t, время с её начала и время до её окончания.
+func (p Photoperiod) Phase(t time.Time) (phase PhotoperiodPhase, elapsed, remaining time.Duration) {
+	y, m, d := t.Date()
+	tod := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	pos := (tod - p.On.offset() + 24*time.Hour) % (24 * time.Hour)
+	length := p.length()
+
+	switch {
+	case pos >= length:
+		return PhaseNight, pos - length, 24*time.Hour - pos
+	case pos < p.Ramp:
+		return PhaseSunrise, pos, p.Ramp - pos
+	case pos >= length-p.Ramp:
+		return PhaseSunset, pos - (length - p.Ramp), length - pos
+	default:
+		return PhaseDay, pos - p.Ramp, length - p.Ramp - pos
+	}
+}
+
+// length возвращает длительность светового дня.
+func (p Photoperiod) length() time.Duration {
+	return (p.Off.offset() - p.On.offset() + 24*time.Hour) % (24 * time.Hour)
+}
+
+// offset возвращает время от полуночи до момента срабатывания.
+func (d DailyTrigger) offset() time.Duration {
+	return time.Duration(d.Hour)*time.Hour + time.Duration(d.Minute)*time.Minute + time.Duration(d.Second)*time.Second
+}
+
+// Remaining возвращает время до окончания светового дня (0 ночью).
+func (p Photoperiod) Remaining(t time.Time) time.Duration {
+	phase, _, remaining := p.Phase(t)
+	switch phase {
+	case PhaseSunrise:
+		return remaining + p.length() - p.Ramp
+	case PhaseDay:
+		return remaining + p.Ramp
+	case PhaseSunset:
+		return remaining
+	default:
+		return 0
+	}
+}
+
+// Level возвращает относительную яркость (от 0.0 до 1.0) в момент t с учётом
+// линейных рассвета и заката.
+func (p Photoperiod) Level(t time.Time) float64 {
+	phase, elapsed, remaining := p.Phase(t)
+	switch phase {
+	case PhaseSunrise:
+		return float64(elapsed) / float64(p.Ramp)
+	case PhaseSunset:
+		return float64(remaining) / float64(p.Ramp)
+	case PhaseDay:
+		return 1
+	default:
+		return 0
+	}
+}
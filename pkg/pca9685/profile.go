@@ -0,0 +1,231 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ProfileSegment – отрезок профиля: переход от текущего значения канала к
+// Target за Ramp и удержание Target в течение Hold.
+type ProfileSegment struct {
+	Target uint16        // Значение off в конце перехода (0–4095)
+	Ramp   time.Duration // Длительность перехода (0 – мгновенно)
+	Hold   time.Duration // Время удержания после перехода
+	Easing Easing        // Сглаживание перехода (по умолчанию равномерно)
+}
+
+// ProfileRunner выполняет на канале профиль из отрезков «переход –
+// удержание»: ступенчатый прогрев печи или нагревателя, заполнение насоса,
+// поэтапный разгон вентилятора. Переходы начинаются от фактического значения
+// канала, поэтому профиль корректно продолжает ручную установку.
+type ProfileRunner struct {
+	pca      *PCA9685
+	channel  int
+	segments []ProfileSegment
+	loop     bool
+	fade     []FadeOption
+
+	mu      sync.Mutex
+	current int
+	holding bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+}
+
+// ProfileOption определяет опцию ProfileRunner.
+type ProfileOption func(*ProfileRunner)
+
+// WithProfileLoop включает циклическое выполнение профиля.
+func WithProfileLoop(loop bool) ProfileOption {
+	return func(r *ProfileRunner) {
+		r.loop = loop
+	}
+}
+
+// WithProfileFade задаёт разрешение переходов (по умолчанию Config.Fade).
+func WithProfileFade(opts ...FadeOption) ProfileOption {
+	return func(r *ProfileRunner) {
+		r.fade = opts
+	}
+}
+
+// NewProfileRunner создаёт исполнителя профиля segments на канале channel.
+func NewProfileRunner(pca *PCA9685, channel int, segments []ProfileSegment, opts ...ProfileOption) (*ProfileRunner, error) {
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("NewProfileRunner: неверный номер канала %d: %v", channel, err)
+		return nil, err
+	}
+	if len(segments) == 0 {
+		pca.logger.Error("NewProfileRunner: пустой профиль")
+		return nil, fmt.Errorf("profile must contain at least one segment")
+	}
+	var total time.Duration
+	for i, seg := range segments {
+		if seg.Target > 4095 {
+			return nil, fmt.Errorf("segment %d: target %d exceeds 4095", i, seg.Target)
+		}
+		if seg.Ramp < 0 || seg.Hold < 0 {
+			return nil, fmt.Errorf("segment %d: ramp and hold must not be negative", i)
+		}
+		total += seg.Ramp + seg.Hold
+	}
+	r := &ProfileRunner{
+		pca:      pca,
+		channel:  channel,
+		segments: append([]ProfileSegment(nil), segments...),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.loop && total == 0 {
+		return nil, fmt.Errorf("looped profile must have a positive duration")
+	}
+	return r, nil
+}
+
+// Start запускает профиль с первого отрезка. Повторный запуск до окончания
+// предыдущего возвращает ошибку.
+func (r *ProfileRunner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		return fmt.Errorf("profile is already running on channel %d", r.channel)
+	}
+	r.pca.logger.Basic("ProfileRunner: запуск профиля из %d отрезков на канале %d", len(r.segments), r.channel)
+	runCtx, cancel := context.WithCancel(ctx)
+	r.cancel = cancel
+	r.done = make(chan struct{})
+	r.err = nil
+	r.current, r.holding = 0, false
+	go r.run(runCtx, r.done)
+	return nil
+}
+
+// Stop прерывает профиль и дожидается завершения. Канал сохраняет значение,
+// достигнутое к моменту остановки.
+func (r *ProfileRunner) Stop() {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	r.pca.logger.Basic("ProfileRunner: остановка профиля на канале %d", r.channel)
+	cancel()
+	<-done
+}
+
+// Wait блокируется до окончания профиля и возвращает его ошибку. Остановка
+// через Stop ошибкой не считается.
+func (r *ProfileRunner) Wait() error {
+	r.mu.Lock()
+	done := r.done
+	r.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	<-done
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Running сообщает, выполняется ли профиль.
+func (r *ProfileRunner) Running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cancel != nil
+}
+
+// Segment возвращает индекс текущего отрезка и признак удержания (false –
+// идёт переход).
+func (r *ProfileRunner) Segment() (index int, holding bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current, r.holding
+}
+
+func (r *ProfileRunner) run(ctx context.Context, done chan struct{}) {
+	channels := []int{r.channel}
+	r.pca.fadeEvent(EventFadeStarted, "Profile", channels, nil)
+	var err error
+	defer func() {
+		r.pca.fadeEvent(EventFadeCompleted, "Profile", channels, err)
+		r.mu.Lock()
+		if err != nil && !errors.Is(err, context.Canceled) {
+			r.err = err
+		}
+		r.cancel = nil
+		r.mu.Unlock()
+		close(done)
+	}()
+
+	for loop := 1; ; loop++ {
+		if loop > 1 {
+			r.pca.emit(Event{Type: EventAnimationLooped, Channel: r.channel, Name: "Profile", Loop: loop})
+		}
+		for i, seg := range r.segments {
+			r.setSegment(i, false)
+			r.pca.logger.Detailed("ProfileRunner: канал %d, отрезок %d: до %d за %v, удержание %v", r.channel, i, seg.Target, seg.Ramp, seg.Hold)
+			if err = r.ramp(ctx, seg); err == nil {
+				r.setSegment(i, true)
+				err = r.hold(ctx, seg.Hold)
+			}
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					r.pca.logger.Error("ProfileRunner: ошибка на отрезке %d канала %d: %v", i, r.channel, err)
+				}
+				return
+			}
+		}
+		if !r.loop {
+			r.pca.logger.Basic("ProfileRunner: профиль на канале %d завершён", r.channel)
+			return
+		}
+	}
+}
+
+func (r *ProfileRunner) setSegment(i int, holding bool) {
+	r.mu.Lock()
+	r.current, r.holding = i, holding
+	r.mu.Unlock()
+}
+
+// ramp плавно переводит канал к seg.Target. В журнал записывается отрезок
+// целиком, а не отдельные кадры.
+func (r *ProfileRunner) ramp(ctx context.Context, seg ProfileSegment) error {
+	_, _, from, err := r.pca.GetChannelState(r.channel)
+	if err != nil {
+		return err
+	}
+	begin := time.Now()
+	fctx := r.pca.quiet(ctx)
+	steps := r.pca.fadeConfig(r.fade).steps(seg.Ramp)
+	diff := float64(int(seg.Target) - int(from))
+	err = runFade(fctx, steps, seg.Ramp, func(step int) error {
+		value := uint16(math.Round(float64(from) + diff*seg.Easing.apply(float64(step)/float64(steps))))
+		return r.pca.SetPWM(fctx, r.channel, 0, value)
+	})
+	r.pca.record(ctx, JournalEntry{Time: begin, Op: "Profile", Channel: r.channel, Off: seg.Target, Value: seg.Ramp.Seconds()}, err)
+	return err
+}
+
+// hold ожидает d или отмены ctx.
+func (r *ProfileRunner) hold(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
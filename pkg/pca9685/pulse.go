@@ -0,0 +1,81 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// pulse – параметры Pulse.
+type pulse struct {
+	safe bool
+}
+
+// PulseOption определяет опцию Pulse.
+type PulseOption func(*pulse)
+
+// WithPulseSafeRestore завершает импульс переходом в безопасное значение
+// канала (SetChannelFailsafe) или в ноль, если оно не задано, вместо
+// значения до импульса.
+func WithPulseSafeRestore() PulseOption {
+	return func(p *pulse) {
+		p.safe = true
+	}
+}
+
+// Pulse устанавливает канал в значение duty (off при on = 0) на время
+// duration и возвращает его в значение до импульса – для срабатывания реле,
+// кормушек, затворов камер. Возврат выполняется и при отмене ctx или ошибке
+// записи импульса; при отменённом ctx возвращающая запись выполняется с
+// контекстом контроллера. Pulse блокирует
+// до окончания импульса; одновременный второй импульс на том же канале
+// отклоняется.
+func (pca *PCA9685) Pulse(ctx context.Context, channel int, duty uint16, duration time.Duration, opts ...PulseOption) error {
+	p := pulse{}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("Pulse: неверный номер канала %d: %v", channel, err)
+		return err
+	}
+	if duration <= 0 {
+		return fmt.Errorf("pulse duration must be positive")
+	}
+	ch := &pca.channels[channel]
+	if !ch.pulsing.CompareAndSwap(false, true) {
+		return fmt.Errorf("pulse already in progress on channel %d", channel)
+	}
+	defer ch.pulsing.Store(false)
+
+	ch.mu.RLock()
+	restoreOn, restoreOff := ch.on, ch.off
+	if p.safe {
+		restoreOn, restoreOff = ch.failsafe.on, ch.failsafe.off
+	}
+	ch.mu.RUnlock()
+
+	pca.logger.Basic("Pulse: канал %d, off=%d на %v", channel, duty, duration)
+	err := pca.SetPWM(ctx, channel, 0, duty)
+	if err == nil {
+		timer := time.NewTimer(duration)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
+			pca.logger.Error("Pulse: импульс на канале %d прерван: %v", channel, err)
+		}
+	}
+
+	restoreCtx := ctx
+	if ctx.Err() != nil {
+		restoreCtx = pca.ctx
+	}
+	if rerr := pca.SetPWM(restoreCtx, channel, restoreOn, restoreOff); rerr != nil {
+		pca.logger.Error("Pulse: не удалось вернуть канал %d в исходное значение: %v", channel, rerr)
+		return errors.Join(err, fmt.Errorf("failed to restore channel %d after pulse: %w", channel, rerr))
+	}
+	return err
+}
@@ -2,11 +2,18 @@ package pca9685
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"sync"
+	"time"
 )
 
+// ErrPumpCutoff возвращается при попытке запустить насос, остановленный
+// защитой (превышение времени работы, остановка или сухой ход), до вызова
+// ResetCutoff.
+var ErrPumpCutoff = errors.New("pump stopped by safety cutoff")
+
 // Pump представляет управление насосом.
 type Pump struct {
 	pca      *PCA9685
@@ -14,6 +21,23 @@ type Pump struct {
 	MinSpeed uint16
 	MaxSpeed uint16
 	mu       sync.RWMutex
+	flowRate float64       // производительность при 100%, мл/с (0 – не откалиброван)
+	motion   MotionProfile // профиль RampTo
+
+	interlock *PumpInterlock // группа взаимной блокировки (nil – нет)
+
+	rmu        sync.Mutex    // сериализует SetSpeed и защищает поля ниже
+	maxRuntime time.Duration // максимальное время непрерывной работы (0 – без ограничения)
+	running    bool
+	runTimer   *time.Timer
+	cutoff     bool
+}
+
+// PumpCalibration содержит калибровочные данные насоса.
+type PumpCalibration struct {
+	MinSpeed uint16  `json:"min_speed"`
+	MaxSpeed uint16  `json:"max_speed"`
+	FlowRate float64 `json:"flow_rate,omitempty"` // мл/с при скорости 100%
 }
 
 // NewPump создает новый контроллер насоса.
@@ -38,8 +62,14 @@ func NewPump(pca *PCA9685, channel int, opts ...PumpOption) (*Pump, error) {
 		opt(pump)
 	}
 
+	if err := pca.claimChannels(pump, fmt.Sprintf("pump on channel %d", channel), channel); err != nil {
+		pca.logger.Error("NewPump: канал %d недоступен: %v", channel, err)
+		return nil, err
+	}
+
 	// Включение канала.
 	if err := pca.EnableChannels(channel); err != nil {
+		pca.releaseChannels(pump, channel)
 		pca.logger.Error("NewPump: не удалось включить канал %d: %v", channel, err)
 		return nil, fmt.Errorf("failed to enable channel: %w", err)
 	}
@@ -48,6 +78,19 @@ func NewPump(pca *PCA9685, channel int, opts ...PumpOption) (*Pump, error) {
 	return pump, nil
 }
 
+// Release освобождает канал насоса, чтобы его можно было использовать для
+// другой периферии. Насос после этого использовать нельзя.
+func (p *Pump) Release() {
+	p.pca.logger.Basic("Освобождение канала насоса %d", p.channel)
+	p.rmu.Lock()
+	p.trackRuntime(false)
+	p.rmu.Unlock()
+	if p.interlock != nil {
+		p.interlock.release(p)
+	}
+	p.pca.releaseChannels(p, p.channel)
+}
+
 // PumpOption определяет опцию конфигурации насоса.
 type PumpOption func(*Pump)
 
@@ -66,6 +109,87 @@ func WithSpeedLimits(min, max uint16) PumpOption {
 	}
 }
 
+// WithMaxRuntime ограничивает время непрерывной работы насоса. По истечении d
+// насос останавливается, генерируется событие EventPumpCutoff, а повторный
+// запуск возможен только после ResetCutoff. Защищает, например, от опустошения
+// ёмкости дозатора в аквариум из-за ошибки в логике.
+func WithMaxRuntime(d time.Duration) PumpOption {
+	return func(p *Pump) {
+		if d > 0 {
+			p.maxRuntime = d
+		}
+	}
+}
+
+// trackRuntime запускает или останавливает отсчёт времени непрерывной работы.
+// Вызывается с захваченным p.rmu.
+func (p *Pump) trackRuntime(running bool) {
+	if running == p.running {
+		return
+	}
+	p.running = running
+	if p.maxRuntime <= 0 {
+		return
+	}
+	if running {
+		p.runTimer = time.AfterFunc(p.maxRuntime, p.cutoffRuntime)
+	} else if p.runTimer != nil {
+		p.runTimer.Stop()
+		p.runTimer = nil
+	}
+}
+
+// cutoffRuntime останавливает насос по превышению времени работы.
+func (p *Pump) cutoffRuntime() {
+	if p.trip(EventPumpCutoff, nil) {
+		p.pca.logger.Error("Насос на канале %d работал дольше %v и остановлен", p.channel, p.maxRuntime)
+	}
+}
+
+// trip останавливает работающий насос защитой: повторный запуск возможен
+// только после ResetCutoff. Возвращает false, если насос уже остановлен.
+func (p *Pump) trip(event EventType, cause error) bool {
+	p.rmu.Lock()
+	if !p.running {
+		p.rmu.Unlock()
+		return false
+	}
+	p.cutoff = true
+	p.trackRuntime(false)
+	// Защитная остановка выводится независимо от приоритетов источников.
+	err := p.pca.SetPWM(arbitrated(p.pca.ctx), p.channel, 0, 0)
+	if p.interlock != nil {
+		p.interlock.release(p)
+	}
+	p.rmu.Unlock()
+
+	if err != nil {
+		p.pca.logger.Error("Не удалось остановить насос на канале %d: %v", p.channel, err)
+		if cause == nil {
+			cause = err
+		}
+	}
+	p.pca.emit(Event{Type: event, Channel: p.channel, Err: cause})
+	return true
+}
+
+// CutoffTripped сообщает, остановлен ли насос защитой.
+func (p *Pump) CutoffTripped() bool {
+	p.rmu.Lock()
+	defer p.rmu.Unlock()
+	return p.cutoff
+}
+
+// ResetCutoff разрешает повторный запуск насоса после срабатывания защиты.
+func (p *Pump) ResetCutoff() {
+	p.rmu.Lock()
+	defer p.rmu.Unlock()
+	if p.cutoff {
+		p.pca.logger.Basic("ResetCutoff: насос на канале %d снова разрешён", p.channel)
+	}
+	p.cutoff = false
+}
+
 // SetSpeed устанавливает скорость насоса в процентах (0–100%).
 func (p *Pump) SetSpeed(ctx context.Context, percent float64) error {
 	p.pca.logger.Detailed("SetSpeed: установка скорости насоса на %f%%", percent)
@@ -75,6 +199,13 @@ func (p *Pump) SetSpeed(ctx context.Context, percent float64) error {
 		return err
 	}
 
+	p.rmu.Lock()
+	defer p.rmu.Unlock()
+	if p.cutoff && percent > 0 {
+		p.pca.logger.Error("SetSpeed: насос на канале %d остановлен по времени работы", p.channel)
+		return ErrPumpCutoff
+	}
+
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
@@ -87,10 +218,28 @@ func (p *Pump) SetSpeed(ctx context.Context, percent float64) error {
 
 	value := scale(percent, p.MinSpeed, p.MaxSpeed)
 	p.pca.logger.Detailed("SetSpeed: вычисленное значение PWM: %d", value)
+
+	// Запуск насоса из группы блокировки возможен, только когда остальные
+	// насосы группы остановлены.
+	held := true
+	if p.interlock != nil && percent > 0 {
+		var err error
+		if held, err = p.interlock.acquire(ctx, p); err != nil {
+			p.pca.logger.Error("SetSpeed: насос на канале %d заблокирован: %v", p.channel, err)
+			return err
+		}
+	}
 	if err := p.pca.SetPWM(ctx, p.channel, 0, value); err != nil {
+		if !held {
+			p.interlock.release(p)
+		}
 		p.pca.logger.Error("SetSpeed: ошибка установки PWM: %v", err)
 		return err
 	}
+	if p.interlock != nil && percent == 0 {
+		p.interlock.release(p)
+	}
+	p.trackRuntime(percent > 0)
 	p.pca.logger.Basic("SetSpeed: скорость насоса установлена на %f%%", percent)
 	return nil
 }
@@ -152,3 +301,71 @@ func (p *Pump) SetSpeedLimits(min, max uint16) error {
 	p.pca.logger.Basic("SetSpeedLimits: ограничения скорости успешно установлены: min=%d, max=%d", min, max)
 	return nil
 }
+
+// Calibration возвращает калибровочные данные насоса.
+func (p *Pump) Calibration() PumpCalibration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return PumpCalibration{MinSpeed: p.MinSpeed, MaxSpeed: p.MaxSpeed, FlowRate: p.flowRate}
+}
+
+// SetCalibration устанавливает калибровочные данные насоса.
+func (p *Pump) SetCalibration(cal PumpCalibration) error {
+	if cal.FlowRate < 0 {
+		err := fmt.Errorf("flow rate must not be negative")
+		p.pca.logger.Error("SetCalibration: %v", err)
+		return err
+	}
+	if err := p.SetSpeedLimits(cal.MinSpeed, cal.MaxSpeed); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.flowRate = cal.FlowRate
+	p.mu.Unlock()
+	return nil
+}
+
+// Calibrate измеряет производительность насоса: насос работает на полной
+// скорости runDuration, затем останавливается, и measure возвращает
+// фактически выданный объём в миллилитрах (например, введённый
+// пользователем). Вычисленная производительность в мл/с сохраняется в
+// калибровке насоса и попадает в файл калибровок (см. Calibrations).
+func (p *Pump) Calibrate(ctx context.Context, runDuration time.Duration, measure func(ctx context.Context) (float64, error)) (float64, error) {
+	if runDuration <= 0 {
+		return 0, fmt.Errorf("calibration run duration must be positive")
+	}
+	p.pca.logger.Basic("Calibrate: калибровка насоса на канале %d, работа %v", p.channel, runDuration)
+	if err := p.SetSpeed(ctx, 100); err != nil {
+		return 0, err
+	}
+	timer := time.NewTimer(runDuration)
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+	timer.Stop()
+	// Насос останавливается и при отмене контекста.
+	if err := p.Stop(context.Background()); err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if p.CutoffTripped() {
+		return 0, fmt.Errorf("%w during calibration run", ErrPumpCutoff)
+	}
+
+	volume, err := measure(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if volume <= 0 {
+		return 0, fmt.Errorf("measured volume must be positive")
+	}
+	rate := volume / runDuration.Seconds()
+	p.mu.Lock()
+	p.flowRate = rate
+	p.mu.Unlock()
+	p.pca.logger.Basic("Calibrate: производительность насоса на канале %d: %.3f мл/с", p.channel, rate)
+	return rate, nil
+}
@@ -0,0 +1,322 @@
+package pca9685
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RandomMode – вид случайного эффекта.
+type RandomMode int
+
+const (
+	// RandomTwinkle – мерцание звёзд: пиксели независимо коротко вспыхивают
+	// с быстрым нарастанием и плавным спадом.
+	RandomTwinkle RandomMode = iota
+	// RandomFireflies – светлячки: редкие медленные мягкие вспышки пикселей.
+	RandomFireflies
+	// RandomLightning – молния: серии из 1–4 коротких ярких вспышек всей
+	// группы со случайными паузами.
+	RandomLightning
+)
+
+func (m RandomMode) String() string {
+	switch m {
+	case RandomTwinkle:
+		return "twinkle"
+	case RandomFireflies:
+		return "fireflies"
+	case RandomLightning:
+		return "lightning"
+	default:
+		return fmt.Sprintf("RandomMode(%d)", int(m))
+	}
+}
+
+// RandomParams – параметры случайного эффекта, изменяемые во время работы
+// (RandomEffect.SetParams).
+type RandomParams struct {
+	Density float64 // Частота событий, 0–1 (0 – 0.3)
+	Speed   float64 // Множитель скорости: частоты событий и длительности вспышек (0 – 1.0)
+	Min     uint16  // Значение off между вспышками (фон)
+	Max     uint16  // Значение off на пике самой яркой вспышки (0 – 4095)
+
+	// Диапазон цвета пикселей RGB: цвет каждой вспышки выбирается случайно
+	// между ColorFrom и ColorTo. Если оба цвета нулевые – белый.
+	ColorFrom, ColorTo color.RGBA
+}
+
+// Параметры случайных эффектов по умолчанию.
+const (
+	defaultRandomDensity = 0.3
+
+	twinkleRate      = 3.0 // вспышек пикселя в секунду при Density 1
+	firefliesRate    = 0.5
+	lightningRate    = 0.3 // молний в секунду при Density 1
+	lightningFlashes = 4   // наибольшее число вспышек в молнии
+)
+
+// normalize проверяет параметры и подставляет значения по умолчанию.
+func (p *RandomParams) normalize() error {
+	if p.Density < 0 || p.Density > 1 {
+		return fmt.Errorf("density must be between 0 and 1")
+	}
+	if p.Speed < 0 {
+		return fmt.Errorf("speed must not be negative")
+	}
+	if p.Density == 0 {
+		p.Density = defaultRandomDensity
+	}
+	if p.Speed == 0 {
+		p.Speed = 1
+	}
+	if p.Max == 0 {
+		p.Max = 4095
+	}
+	if p.Max > 4095 || p.Min > p.Max {
+		return fmt.Errorf("brightness range %d-%d is invalid (want min <= max <= 4095)", p.Min, p.Max)
+	}
+	if p.ColorFrom == (color.RGBA{}) && p.ColorTo == (color.RGBA{}) {
+		p.ColorFrom = color.RGBA{255, 255, 255, 255}
+		p.ColorTo = p.ColorFrom
+	}
+	return nil
+}
+
+// RandomEffectConfig содержит настройки случайного эффекта. Пикселями
+// эффекта служат одиночные каналы Channels и тройки каналов RGB.
+type RandomEffectConfig struct {
+	Mode     RandomMode
+	Channels []int    // Одноцветные пиксели
+	RGB      [][3]int // Пиксели RGB: каналы красного, зелёного и синего
+	// Seed – начальное значение генератора случайных чисел. Эффект с тем же
+	// Seed и параметрами при тех же моментах кадров воспроизводится точно;
+	// для неповторяющихся показов задайте, например, time.Now().UnixNano().
+	Seed   int64
+	Params RandomParams
+}
+
+// RandomEffect – источник рендерера (RenderSource) со случайными
+// эффектами: мерцанием звёзд, светлячками и молнией. Случайность берётся из
+// генератора с заданным начальным значением, поэтому показ повторяется в
+// тестах и демонстрациях:
+//
+//	stars, _ := pca9685.NewRandomEffect(pca9685.RandomEffectConfig{
+//		Mode: pca9685.RandomTwinkle, Channels: []int{0, 1, 2, 3}, Seed: 42,
+//	})
+//	renderer.Add("stars", stars)
+type RandomEffect struct {
+	mode     RandomMode
+	channels []int
+	rgb      [][3]int
+	stopped  atomic.Bool
+
+	mu     sync.Mutex
+	params RandomParams
+
+	// Состояние кадров; изменяется только в Render.
+	rnd     *rand.Rand
+	last    time.Time
+	pixels  []randomPixel
+	flashes []randomFlash
+}
+
+// randomPixel – текущая вспышка пикселя.
+type randomPixel struct {
+	start, end time.Time // вспышки нет, если кадр не раньше end
+	peak       float64   // яркость пика, 0–1
+	color      [3]float64
+}
+
+// randomFlash – одна вспышка молнии.
+type randomFlash struct {
+	start, end time.Time
+	level      float64
+}
+
+// NewRandomEffect создаёт случайный эффект.
+func NewRandomEffect(cfg RandomEffectConfig) (*RandomEffect, error) {
+	if cfg.Mode < RandomTwinkle || cfg.Mode > RandomLightning {
+		return nil, fmt.Errorf("unknown random effect mode %d", cfg.Mode)
+	}
+	if len(cfg.Channels) == 0 && len(cfg.RGB) == 0 {
+		return nil, fmt.Errorf("at least one channel is required")
+	}
+	for _, ch := range cfg.Channels {
+		if ch < 0 || ch > 15 {
+			return nil, fmt.Errorf("invalid channel number: %d", ch)
+		}
+	}
+	for _, px := range cfg.RGB {
+		for _, ch := range px {
+			if ch < 0 || ch > 15 {
+				return nil, fmt.Errorf("invalid channel number: %d", ch)
+			}
+		}
+	}
+	if err := cfg.Params.normalize(); err != nil {
+		return nil, err
+	}
+	e := &RandomEffect{
+		mode:     cfg.Mode,
+		channels: append([]int(nil), cfg.Channels...),
+		rgb:      append([][3]int(nil), cfg.RGB...),
+		params:   cfg.Params,
+		rnd:      rand.New(rand.NewSource(cfg.Seed)),
+		pixels:   make([]randomPixel, len(cfg.Channels)+len(cfg.RGB)),
+	}
+	for i := range e.pixels {
+		e.pixels[i].color = e.pickColor(cfg.Params)
+	}
+	return e, nil
+}
+
+// Params возвращает текущие параметры эффекта.
+func (e *RandomEffect) Params() RandomParams {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.params
+}
+
+// SetParams изменяет плотность, скорость, яркость и цвет эффекта со
+// следующего кадра. Идущие вспышки доигрываются с прежней длительностью.
+func (e *RandomEffect) SetParams(p RandomParams) error {
+	if err := p.normalize(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.params = p
+	e.mu.Unlock()
+	return nil
+}
+
+// Stop завершает эффект: рендерер удалит его в следующем кадре.
+func (e *RandomEffect) Stop() {
+	e.stopped.Store(true)
+}
+
+// Render реализует RenderSource.
+func (e *RandomEffect) Render(now time.Time, frame *RenderFrame) bool {
+	if e.stopped.Load() {
+		return false
+	}
+	p := e.Params()
+	dt := 0.0
+	if !e.last.IsZero() {
+		dt = now.Sub(e.last).Seconds()
+	}
+	e.last = now
+
+	if e.mode == RandomLightning {
+		e.renderLightning(now, dt, p, frame)
+		return true
+	}
+	rate, shortest, longest := twinkleRate, 400*time.Millisecond, 900*time.Millisecond
+	if e.mode == RandomFireflies {
+		rate, shortest, longest = firefliesRate, 1500*time.Millisecond, 3*time.Second
+	}
+	for i := range e.pixels {
+		px := &e.pixels[i]
+		if !now.Before(px.end) && e.rnd.Float64() < chance(rate*p.Density*p.Speed, dt) {
+			px.start = now
+			px.end = now.Add(e.duration(shortest, longest, p.Speed))
+			px.peak = 0.5 + 0.5*e.rnd.Float64()
+			px.color = e.pickColor(p)
+		}
+		level := 0.0
+		if now.Before(px.end) {
+			x := float64(now.Sub(px.start)) / float64(px.end.Sub(px.start))
+			if e.mode == RandomFireflies {
+				s := math.Sin(math.Pi * x)
+				level = px.peak * s * s
+			} else if x < 0.2 {
+				level = px.peak * x / 0.2
+			} else {
+				level = px.peak * (1 - x) / 0.8
+			}
+		}
+		e.set(frame, i, level, p)
+	}
+	return true
+}
+
+// renderLightning выводит кадр молнии: вся группа вспыхивает вместе.
+func (e *RandomEffect) renderLightning(now time.Time, dt float64, p RandomParams, frame *RenderFrame) {
+	// Удаляем закончившиеся вспышки.
+	n := 0
+	for _, f := range e.flashes {
+		if now.Before(f.end) {
+			e.flashes[n] = f
+			n++
+		}
+	}
+	e.flashes = e.flashes[:n]
+
+	if len(e.flashes) == 0 && e.rnd.Float64() < chance(lightningRate*p.Density*p.Speed, dt) {
+		c := e.pickColor(p)
+		for i := range e.pixels {
+			e.pixels[i].color = c
+		}
+		at := now
+		for k := 1 + e.rnd.Intn(lightningFlashes); k > 0; k-- {
+			end := at.Add(e.duration(20*time.Millisecond, 80*time.Millisecond, p.Speed))
+			e.flashes = append(e.flashes, randomFlash{start: at, end: end, level: 0.6 + 0.4*e.rnd.Float64()})
+			at = end.Add(e.duration(40*time.Millisecond, 160*time.Millisecond, p.Speed))
+		}
+	}
+
+	level := 0.0
+	for _, f := range e.flashes {
+		if !now.Before(f.start) && now.Before(f.end) {
+			level = math.Max(level, f.level)
+		}
+	}
+	for i := range e.pixels {
+		e.set(frame, i, level, p)
+	}
+}
+
+// set задаёт яркость level (0–1) пикселя i.
+func (e *RandomEffect) set(frame *RenderFrame, i int, level float64, p RandomParams) {
+	v := float64(p.Min) + level*float64(p.Max-p.Min)
+	if i < len(e.channels) {
+		frame.Set(e.channels[i], 0, uint16(math.Round(v)))
+		return
+	}
+	px := &e.pixels[i]
+	for k, ch := range e.rgb[i-len(e.channels)] {
+		frame.Set(ch, 0, uint16(math.Round(v*px.color[k])))
+	}
+}
+
+// pickColor выбирает случайный цвет между ColorFrom и ColorTo (доли 0–1).
+func (e *RandomEffect) pickColor(p RandomParams) [3]float64 {
+	t := e.rnd.Float64()
+	from := [3]float64{float64(p.ColorFrom.R), float64(p.ColorFrom.G), float64(p.ColorFrom.B)}
+	to := [3]float64{float64(p.ColorTo.R), float64(p.ColorTo.G), float64(p.ColorTo.B)}
+	var c [3]float64
+	for k := range c {
+		c[k] = (from[k] + (to[k]-from[k])*t) / 255
+	}
+	return c
+}
+
+// duration возвращает случайную длительность от shortest до longest,
+// делённую на скорость speed.
+func (e *RandomEffect) duration(shortest, longest time.Duration, speed float64) time.Duration {
+	d := float64(shortest) + float64(longest-shortest)*e.rnd.Float64()
+	return time.Duration(d / speed)
+}
+
+// chance возвращает вероятность хотя бы одного события за dt секунд при
+// частоте rate событий в секунду.
+func chance(rate, dt float64) float64 {
+	if dt <= 0 {
+		return 0
+	}
+	return 1 - math.Exp(-rate*dt)
+}
@@ -0,0 +1,115 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// channelRate – ограничение частоты записи канала.
+type channelRate struct {
+	interval time.Duration
+	last     time.Time   // время последней записи в устройство
+	timer    *time.Timer // отложенная запись последнего значения, nil – нет
+}
+
+// SetChannelMinInterval задаёт минимальный интервал между записями канала в
+// устройство через SetPWM (0 – без ограничения). Значения, пришедшие чаще,
+// сразу сохраняются в кэше, но в устройство записывается только последнее
+// из них – по истечении интервала. Так источник, присылающий значения с
+// высокой частотой (например, фейдеры OSC на 200 Гц), не перегружает шину,
+// а итоговое значение всё равно применяется. Групповые записи (SetMultiPWM и
+// SetMultiPWMValues, в том числе из одного канала, SetAllPWM, Renderer) и
+// защитные записи (безопасные значения, остановка насоса защитой) не
+// ограничиваются: они выполняются сразу и заменяют отложенное значение.
+func (pca *PCA9685) SetChannelMinInterval(channel int, d time.Duration) error {
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("SetChannelMinInterval: неверный номер канала %d: %v", channel, err)
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf("minimum interval must not be negative")
+	}
+	pca.logger.Basic("SetChannelMinInterval: канал %d, интервал %v", channel, d)
+	ch := &pca.channels[channel]
+	ch.mu.Lock()
+	ch.rate.interval = d
+	pending := ch.rate.timer != nil && d == 0
+	ch.mu.Unlock()
+	if pending {
+		// Без ограничения отложенное значение записывается сразу.
+		pca.flushChannel(channel)
+	}
+	return nil
+}
+
+// ChannelMinInterval возвращает минимальный интервал между записями канала.
+func (pca *PCA9685) ChannelMinInterval(channel int) time.Duration {
+	if pca.validateChannel(channel) != nil {
+		return 0
+	}
+	ch := &pca.channels[channel]
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+	return ch.rate.interval
+}
+
+type immediateKey struct{}
+
+// immediate помечает контекст записи, которая не откладывается минимальным
+// интервалом канала (групповые записи).
+func immediate(ctx context.Context) context.Context {
+	return context.WithValue(ctx, immediateKey{}, true)
+}
+
+// coalesce откладывает запись канала, если с предыдущей записи не прошёл
+// минимальный интервал: значение сохраняется в кэше, а запись планируется
+// на конец интервала. Возвращает true, если запись отложена. Групповые и
+// защитные записи (immediate, arbitrated) не откладываются и отменяют
+// отложенную запись. Вызывается с захваченным мьютексом канала.
+func (pca *PCA9685) coalesce(ctx context.Context, channel int, on, off uint16) bool {
+	ch := &pca.channels[channel]
+	if ch.rate.interval <= 0 {
+		return false
+	}
+	now := time.Now()
+	if ctx.Value(immediateKey{}) != nil || ctx.Value(arbitratedKey{}) != nil {
+		if ch.rate.timer != nil {
+			ch.rate.timer.Stop()
+			ch.rate.timer = nil
+		}
+		ch.rate.last = now
+		return false
+	}
+	wait := ch.rate.last.Add(ch.rate.interval).Sub(now)
+	if wait <= 0 && ch.rate.timer == nil {
+		ch.rate.last = now
+		return false
+	}
+	ch.on, ch.off = on, off
+	ch.publish()
+	if ch.rate.timer == nil {
+		ch.rate.timer = time.AfterFunc(wait, func() { pca.flushChannel(channel) })
+	}
+	return true
+}
+
+// flushChannel записывает в устройство текущее значение канала, отложенное
+// coalesce.
+func (pca *PCA9685) flushChannel(channel int) {
+	ch := &pca.channels[channel]
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.rate.timer == nil {
+		return
+	}
+	ch.rate.timer.Stop()
+	ch.rate.timer = nil
+	ch.rate.last = time.Now()
+	if !ch.enabled || pca.ctx.Err() != nil {
+		return
+	}
+	if err := pca.writeChannel(pca.ctx, "SetPWM", channel, ch.on, ch.off); err != nil {
+		pca.logger.Error("SetPWM: не удалось записать отложенное значение канала %d: %v", channel, err)
+	}
+}
@@ -0,0 +1,160 @@
+package pca9685
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrPeripheralNotFound возвращается, если периферия с указанным именем не
+// зарегистрирована.
+var ErrPeripheralNotFound = errors.New("peripheral not found")
+
+// Peripheral – периферия, закрепляющая каналы контроллера (Pump, RGBLed,
+// GrowLight, Servo и т.д.).
+type Peripheral interface {
+	Release()
+}
+
+// Registry хранит созданную периферию под именами, чтобы загрузка
+// конфигурации, CLI, REST и MQTT обращались к устройствам единообразно
+// (например, registry.Pump("doser-ca")). Реестр не зависит от контроллера и
+// может содержать периферию нескольких PCA9685.
+type Registry struct {
+	mu          sync.RWMutex
+	items       map[string]Peripheral
+	stoppers    []Stopper  // фоновые процессы для ShutdownAll
+	controllers []*PCA9685 // контроллеры для ShutdownAll, добавленные явно
+}
+
+// NewRegistry создаёт пустой реестр периферии.
+func NewRegistry() *Registry {
+	return &Registry{items: make(map[string]Peripheral)}
+}
+
+// Register добавляет периферию под именем name. Имя должно быть уникальным.
+func (r *Registry) Register(name string, p Peripheral) error {
+	if name == "" {
+		return fmt.Errorf("peripheral name must not be empty")
+	}
+	if p == nil {
+		return fmt.Errorf("peripheral %q is nil", name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.items[name]; ok {
+		return fmt.Errorf("peripheral %q is already registered", name)
+	}
+	r.items[name] = p
+	return nil
+}
+
+// Unregister удаляет периферию из реестра. Каналы периферии не освобождаются.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.items, name)
+}
+
+// Get возвращает периферию по имени.
+func (r *Registry) Get(name string) (Peripheral, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.items[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrPeripheralNotFound, name)
+	}
+	return p, nil
+}
+
+// Names возвращает отсортированные имена зарегистрированной периферии.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.namesLocked()
+}
+
+func (r *Registry) namesLocked() []string {
+	names := make([]string, 0, len(r.items))
+	for name := range r.items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pump возвращает насос по имени.
+func (r *Registry) Pump(name string) (*Pump, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	pump, ok := p.(*Pump)
+	if !ok {
+		return nil, fmt.Errorf("peripheral %q is %T, not a pump", name, p)
+	}
+	return pump, nil
+}
+
+// Led возвращает RGB светодиод по имени.
+func (r *Registry) Led(name string) (*RGBLed, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	led, ok := p.(*RGBLed)
+	if !ok {
+		return nil, fmt.Errorf("peripheral %q is %T, not an RGB LED", name, p)
+	}
+	return led, nil
+}
+
+// GrowLight возвращает фитосветильник по имени.
+func (r *Registry) GrowLight(name string) (*GrowLight, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	light, ok := p.(*GrowLight)
+	if !ok {
+		return nil, fmt.Errorf("peripheral %q is %T, not a grow light", name, p)
+	}
+	return light, nil
+}
+
+// Segment возвращает сегмент светодиодных лент по имени.
+func (r *Registry) Segment(name string) (*Segment, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	segment, ok := p.(*Segment)
+	if !ok {
+		return nil, fmt.Errorf("peripheral %q is %T, not an LED segment", name, p)
+	}
+	return segment, nil
+}
+
+// Servo возвращает сервопривод по имени.
+func (r *Registry) Servo(name string) (*Servo, error) {
+	p, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	servo, ok := p.(*Servo)
+	if !ok {
+		return nil, fmt.Errorf("peripheral %q is %T, not a servo", name, p)
+	}
+	return servo, nil
+}
+
+// ReleaseAll освобождает каналы всей периферии и очищает реестр.
+func (r *Registry) ReleaseAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, p := range r.items {
+		p.Release()
+		delete(r.items, name)
+	}
+}
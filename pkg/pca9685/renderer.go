@@ -0,0 +1,272 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RenderFrame – желаемые значения каналов в одном кадре рендерера.
+type RenderFrame struct {
+	values [16]PWMValue
+	set    [16]bool
+	err    error
+}
+
+// Set задаёт значение канала в кадре. Более поздний вызов для того же канала
+// (в том числе из следующего источника) перекрывает предыдущий. Допустимые
+// значения on/off – как у PCA9685.SetPWM.
+func (f *RenderFrame) Set(channel int, on, off uint16) {
+	if channel < 0 || channel >= len(f.values) {
+		if f.err == nil {
+			f.err = fmt.Errorf("invalid frame value for channel %d: on=%d, off=%d", channel, on, off)
+		}
+		return
+	}
+	if err := validatePWM(on, off); err != nil {
+		if f.err == nil {
+			f.err = fmt.Errorf("invalid frame value for channel %d: %w", channel, err)
+		}
+		return
+	}
+	f.values[channel] = PWMValue{Channel: channel, On: on, Off: off}
+	f.set[channel] = true
+}
+
+// Get возвращает значение канала в кадре и признак того, что оно задано.
+func (f *RenderFrame) Get(channel int) (on, off uint16, ok bool) {
+	if channel < 0 || channel >= len(f.values) || !f.set[channel] {
+		return 0, 0, false
+	}
+	return f.values[channel].On, f.values[channel].Off, true
+}
+
+// RenderSource – источник значений каналов для рендерера (анимация, эффект,
+// периферия). Render вызывается в каждом кадре; возврат false означает, что
+// источник завершён и удаляется из рендерера. Render вызывается под блокировкой
+// рендерера и не должен вызывать его методы.
+type RenderSource interface {
+	Render(now time.Time, frame *RenderFrame) bool
+}
+
+// RenderFunc позволяет использовать обычную функцию как RenderSource.
+type RenderFunc func(now time.Time, frame *RenderFrame) bool
+
+// Render вызывает f(now, frame).
+func (f RenderFunc) Render(now time.Time, frame *RenderFrame) bool {
+	return f(now, frame)
+}
+
+// renderLayer – именованный источник рендерера.
+type renderLayer struct {
+	name   string
+	source RenderSource
+	done   func() // вызывается после вывода последнего кадра источника
+}
+
+// defaultRenderFrameRate – частота кадров рендерера по умолчанию.
+const defaultRenderFrameRate = 50
+
+// Renderer собирает значения всех активных источников в единый кадр с
+// постоянной частотой и записывает в контроллер только изменившиеся каналы
+// одной пакетной записью. Это заменяет независимые циклы анимаций одним
+// предсказуемым источником записи и ограничивает нагрузку на шину.
+type Renderer struct {
+	pca   *PCA9685
+	frame time.Duration
+
+	mu      sync.Mutex
+	base    RenderFrame
+	layers  []renderLayer
+	last    [16]PWMValue
+	written [16]bool
+	frames  uint64
+	writes  uint64
+}
+
+// RendererOption определяет опцию конфигурации рендерера.
+type RendererOption func(*Renderer)
+
+// WithRenderFrameRate задаёт частоту кадров рендерера, кадров/с (по умолчанию 50).
+func WithRenderFrameRate(fps float64) RendererOption {
+	return func(r *Renderer) {
+		if fps > 0 {
+			r.frame = time.Duration(float64(time.Second) / fps)
+		}
+	}
+}
+
+// NewRenderer создаёт рендерер для контроллера. Кадры выводятся только после запуска Run.
+func NewRenderer(pca *PCA9685, opts ...RendererOption) *Renderer {
+	r := &Renderer{pca: pca, frame: time.Second / defaultRenderFrameRate}
+	for _, opt := range opts {
+		opt(r)
+	}
+	pca.logger.Detailed("Создание рендерера с периодом кадра %v", r.frame)
+	return r
+}
+
+// Add добавляет источник name. Источники применяются в порядке добавления,
+// поэтому более поздние перекрывают более ранние. Источник с тем же именем
+// заменяется с сохранением позиции.
+func (r *Renderer) Add(name string, source RenderSource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addLocked(name, source, nil)
+}
+
+func (r *Renderer) addLocked(name string, source RenderSource, done func()) {
+	for i := range r.layers {
+		if r.layers[i].name == name {
+			r.layers[i].source, r.layers[i].done = source, done
+			return
+		}
+	}
+	r.layers = append(r.layers, renderLayer{name: name, source: source, done: done})
+}
+
+// has сообщает, активен ли источник name.
+func (r *Renderer) has(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.layers {
+		if r.layers[i].name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove удаляет источник name. Последние выведенные им значения остаются на
+// каналах, пока их не перекроет другой источник.
+func (r *Renderer) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removeLocked(name)
+}
+
+func (r *Renderer) removeLocked(name string) {
+	for i := range r.layers {
+		if r.layers[i].name == name {
+			r.layers = append(r.layers[:i], r.layers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Set задаёт постоянное базовое значение канала, поверх которого применяются источники.
+func (r *Renderer) Set(channel int, on, off uint16) error {
+	if err := r.pca.validateChannel(channel); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.base.Set(channel, on, off)
+	return r.base.err
+}
+
+// Invalidate сбрасывает сведения о последнем кадре: следующий кадр запишет
+// все заданные каналы, даже если их значения не изменились. Полезно после
+// записи в контроллер в обход рендерера.
+func (r *Renderer) Invalidate() {
+	r.mu.Lock()
+	r.written = [16]bool{}
+	r.mu.Unlock()
+}
+
+// Stats возвращает число выведенных кадров и записанных каналов.
+func (r *Renderer) Stats() (frames, writes uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.frames, r.writes
+}
+
+// Run выводит кадры с заданной частотой до отмены контекста.
+func (r *Renderer) Run(ctx context.Context) error {
+	r.pca.logger.Basic("Рендерер: запуск")
+	ticker := time.NewTicker(r.frame)
+	defer ticker.Stop()
+	for {
+		if err := r.Render(ctx, time.Now()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			r.pca.logger.Basic("Рендерер: остановка")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Render собирает и выводит один кадр на момент now.
+func (r *Renderer) Render(ctx context.Context, now time.Time) error {
+	start := time.Now()
+	r.mu.Lock()
+	frame := r.base
+	var finished []func()
+	for i := 0; i < len(r.layers); {
+		layer := r.layers[i]
+		if !layer.source.Render(now, &frame) {
+			r.pca.logger.Detailed("Рендерер: источник %q завершён", layer.name)
+			r.removeLocked(layer.name)
+			if layer.done != nil {
+				finished = append(finished, layer.done)
+			}
+			continue
+		}
+		i++
+	}
+	if frame.err != nil {
+		r.mu.Unlock()
+		r.pca.logger.Error("Рендерер: неверный кадр: %v", frame.err)
+		return frame.err
+	}
+
+	var changed [16]PWMValue
+	n := 0
+	for ch := range frame.values {
+		if !frame.set[ch] {
+			continue
+		}
+		if r.written[ch] && r.last[ch] == frame.values[ch] {
+			continue
+		}
+		changed[n] = frame.values[ch]
+		n++
+	}
+	r.frames++
+	r.mu.Unlock()
+	r.pca.counters.frames.Add(1)
+	defer func() { r.pca.latency.frame.observe(time.Since(start)) }()
+
+	if n == 0 {
+		runAll(finished)
+		return nil
+	}
+	// Кадры рендерера не записываются в журнал изменений.
+	if err := r.pca.SetMultiPWMValues(r.pca.quiet(ctx), changed[:n]); err != nil {
+		r.pca.logger.Error("Рендерер: ошибка записи кадра: %v", err)
+		// Состояние каналов неизвестно – следующий кадр запишет их заново.
+		r.Invalidate()
+		return err
+	}
+
+	r.mu.Lock()
+	for _, v := range changed[:n] {
+		r.last[v.Channel] = v
+		r.written[v.Channel] = true
+	}
+	r.writes += uint64(n)
+	r.mu.Unlock()
+	runAll(finished)
+	return nil
+}
+
+// runAll вызывает функции fns по порядку.
+func runAll(fns []func()) {
+	for _, fn := range fns {
+		fn()
+	}
+}
@@ -0,0 +1,277 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Replay воспроизводит записанный сеанс – трассировку шины SetTrace – на
+// модели регистров микросхемы. По трассировке, полученной с объекта,
+// восстанавливаются значения каналов во времени и содержимое регистров в
+// любой момент сеанса, а Simulator и Play позволяют продолжить отладку на
+// эмуляторе TestI2C.
+//
+// Воспроизведение детерминировано: записи применяются в порядке трассировки,
+// чтения и неудачные записи пропускаются. Регистры до первой записи имеют
+// значения после включения питания PCA9685 (у PCA9635 – нулевые, кроме
+// MODE1), поэтому трассировку лучше включать с момента создания контроллера
+// (Config.Trace).
+type Replay struct {
+	chip    Chip
+	records []TraceRecord
+}
+
+// ReplayOption определяет опцию Replay.
+type ReplayOption func(*Replay)
+
+// WithReplayChip задаёт микросхему, на которой записан сеанс (по умолчанию
+// ChipPCA9685).
+func WithReplayChip(chip Chip) ReplayOption {
+	return func(r *Replay) {
+		r.chip = chip
+	}
+}
+
+// ReplayPoint – значение канала после записи сеанса, изменившей его.
+type ReplayPoint struct {
+	Time    time.Time
+	On, Off uint16
+	Duty    float64 // Коэффициент заполнения, %
+}
+
+// NewReplay создаёт воспроизведение записей трассировки records.
+func NewReplay(records []TraceRecord, opts ...ReplayOption) *Replay {
+	r := &Replay{records: records}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// LoadReplay читает трассировку из src (см. ReadTrace) и создаёт её
+// воспроизведение.
+func LoadReplay(src io.Reader, opts ...ReplayOption) (*Replay, error) {
+	records, err := ReadTrace(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+	return NewReplay(records, opts...), nil
+}
+
+// Records возвращает записи сеанса.
+func (r *Replay) Records() []TraceRecord {
+	return r.records
+}
+
+// Start возвращает время первой записи сеанса.
+func (r *Replay) Start() time.Time {
+	if len(r.records) == 0 {
+		return time.Time{}
+	}
+	return r.records[0].Time
+}
+
+// End возвращает время завершения последней транзакции сеанса.
+func (r *Replay) End() time.Time {
+	if len(r.records) == 0 {
+		return time.Time{}
+	}
+	last := r.records[len(r.records)-1]
+	return last.Time.Add(last.Duration)
+}
+
+// Registers возвращает содержимое регистров после всех записей, начатых не
+// позже at.
+func (r *Replay) Registers(at time.Time) [256]byte {
+	regs := r.powerOn()
+	for _, rec := range r.records {
+		if replayed(rec) && !rec.Time.After(at) {
+			r.apply(&regs, rec.Reg, rec.Data)
+		}
+	}
+	return regs
+}
+
+// Frequency возвращает частоту PWM в момент at по регистру PRE_SCALE.
+func (r *Replay) Frequency(at time.Time) float64 {
+	regs := r.Registers(at)
+	return r.frequency(&regs)
+}
+
+// Channels возвращает состояние каналов в момент at. Поле Enabled отражает
+// наличие импульса, метки каналов в трассировке не сохраняются.
+func (r *Replay) Channels(at time.Time) []ChannelState {
+	regs := r.Registers(at)
+	freq := r.frequency(&regs)
+	states := make([]ChannelState, 16)
+	for i := range states {
+		on, off := r.channel(&regs, i)
+		ticks := pulseTicks(on, off)
+		states[i] = ChannelState{
+			Channel:  i,
+			Enabled:  ticks > 0,
+			On:       on,
+			Off:      off,
+			Duty:     float64(ticks) * 100 / PwmResolution,
+			Inverted: regs[RegMode2]&Mode2Invrt != 0,
+		}
+		if freq > 0 {
+			states[i].PulseWidth = time.Duration(float64(ticks) / PwmResolution / freq * float64(time.Second))
+		}
+	}
+	return states
+}
+
+// Timeline возвращает изменения значения канала за сеанс: первая точка –
+// значение до первой записи, затем по точке на каждую запись, изменившую
+// канал (в том числе групповую запись ALL_LED и затемнение).
+func (r *Replay) Timeline(channel int) ([]ReplayPoint, error) {
+	if channel < 0 || channel > 15 {
+		return nil, fmt.Errorf("invalid channel: %d", channel)
+	}
+	regs := r.powerOn()
+	on, off := r.channel(&regs, channel)
+	points := []ReplayPoint{r.point(r.Start(), on, off)}
+	for _, rec := range r.records {
+		if !replayed(rec) {
+			continue
+		}
+		r.apply(&regs, rec.Reg, rec.Data)
+		if non, noff := r.channel(&regs, channel); non != on || noff != off {
+			on, off = non, noff
+			points = append(points, r.point(rec.Time, on, off))
+		}
+	}
+	return points, nil
+}
+
+// Simulator возвращает эмулятор TestI2C с регистрами в момент at, например
+// для проверки чтений драйвера (ReadMode2, AllCallAddress, VerifyWrites) в
+// состоянии, в котором находилась установка на объекте.
+func (r *Replay) Simulator(at time.Time) *TestI2C {
+	sim := NewTestI2C()
+	sim.registers = r.Registers(at)
+	return sim
+}
+
+// Play повторяет записи сеанса на устройстве dev (например, эмуляторе или
+// стенде) с исходными интервалами, ускоренными в speed раз; при speed <= 0
+// записи выполняются без пауз. Возвращает ошибку первой неудачной записи
+// или отмены ctx.
+func (r *Replay) Play(ctx context.Context, dev I2C, speed float64) error {
+	start := time.Now()
+	for i, rec := range r.records {
+		if !replayed(rec) {
+			continue
+		}
+		if speed > 0 {
+			due := time.Duration(float64(rec.Time.Sub(r.Start())) / speed)
+			if wait := due - time.Since(start); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := dev.WriteReg(rec.Reg, rec.Data); err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// replayed сообщает, изменяет ли запись трассировки регистры.
+func replayed(rec TraceRecord) bool {
+	return rec.Dir == TraceWrite && rec.Err == ""
+}
+
+// powerOn возвращает регистры после включения питания.
+func (r *Replay) powerOn() [256]byte {
+	return powerOnRegisters(r.chip)
+}
+
+func (r *Replay) apply(regs *[256]byte, reg uint8, data []byte) {
+	applyRegisters(r.chip, regs, reg, data)
+}
+
+func (r *Replay) channel(regs *[256]byte, ch int) (on, off uint16) {
+	return channelRegisters(r.chip, regs, ch)
+}
+
+// powerOnRegisters возвращает регистры микросхемы chip после включения
+// питания.
+func powerOnRegisters(chip Chip) [256]byte {
+	var regs [256]byte
+	regs[RegMode1] = Mode1Sleep | Mode1AllCall
+	if chip == ChipPCA9635 {
+		return regs
+	}
+	regs[RegMode2] = Mode2OutDrv
+	regs[RegAllCall] = DefaultAllCallAddress << 1
+	for i := 0; i < 16; i++ {
+		regs[RegLed0+4*i+3] = ledFullOff >> 8
+	}
+	regs[RegAllLed+3] = ledFullOff >> 8
+	regs[RegPrescale] = 0x1E
+	return regs
+}
+
+// applyRegisters выполняет запись в модель регистров с автоинкрементом
+// адреса. У PCA9685 запись в ALL_LED изменяет регистры всех каналов, у
+// PCA9635 старшие биты управляющего байта (флаги автоинкремента) не входят в
+// адрес.
+func applyRegisters(chip Chip, regs *[256]byte, reg uint8, data []byte) {
+	for i, b := range data {
+		addr := int(reg) + i
+		if chip == ChipPCA9635 {
+			addr = (int(reg)&0x1F + i) % (RegPCA9635AllCall + 1)
+		}
+		if addr > 0xFF {
+			return
+		}
+		regs[addr] = b
+		if chip != ChipPCA9635 && addr >= RegAllLed && addr < RegAllLed+4 {
+			for ch := 0; ch < 16; ch++ {
+				regs[RegLed0+4*ch+addr-RegAllLed] = b
+			}
+		}
+	}
+}
+
+// channelRegisters возвращает значения on/off канала в формате PCA9685.
+func channelRegisters(chip Chip, regs *[256]byte, ch int) (on, off uint16) {
+	if chip != ChipPCA9635 {
+		base := RegLed0 + 4*ch
+		on = uint16(regs[base]) | uint16(regs[base+1])<<8
+		off = uint16(regs[base+2]) | uint16(regs[base+3])<<8
+		return on, off
+	}
+	switch regs[RegPCA9635LEDOut0+ch/4] >> (2 * (ch % 4)) & 3 {
+	case 0:
+		return 0, ledFullOff
+	case 1:
+		return FullOn, 0
+	default:
+		return 0, uint16(math.Round(float64(regs[RegPCA9635PWM0+ch]) * PwmResolution / 255))
+	}
+}
+
+func (r *Replay) frequency(regs *[256]byte) float64 {
+	if freq := r.chip.fixedFrequency(); freq > 0 {
+		return freq
+	}
+	return float64(OscClock) / (PwmResolution * (float64(regs[RegPrescale]) + 1))
+}
+
+func (r *Replay) point(t time.Time, on, off uint16) ReplayPoint {
+	return ReplayPoint{Time: t, On: on, Off: off, Duty: float64(pulseTicks(on, off)) * 100 / PwmResolution}
+}
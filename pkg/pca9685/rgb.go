@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"image/color"
+	"math"
 	"sync"
 )
 
@@ -14,13 +15,69 @@ type RGBLed struct {
 	brightness  float64
 	mu          sync.RWMutex
 	calibration RGBCalibration
+
+	tmu     sync.Mutex // защищает состояние переходов
+	color   [3]uint8
+	policy  TransitionPolicy
+	active  *transition
+	pending []*transition
+	tail    chan struct{}
 }
 
 // RGBCalibration содержит калибровочные данные для RGB светодиода.
 type RGBCalibration struct {
-	RedMin, RedMax     uint16
-	GreenMin, GreenMax uint16
-	BlueMin, BlueMax   uint16
+	RedMin   uint16 `json:"red_min"`
+	RedMax   uint16 `json:"red_max"`
+	GreenMin uint16 `json:"green_min"`
+	GreenMax uint16 `json:"green_max"`
+	BlueMin  uint16 `json:"blue_min"`
+	BlueMax  uint16 `json:"blue_max"`
+
+	// Множители каналов для точки белого (от 0.0 до 1.0): с ними цвет
+	// 255,255,255 отображается выбранным белым на светодиодах с разной
+	// эффективностью кристаллов. Нулевое значение означает 1.0.
+	RedGain   float64 `json:"red_gain,omitempty"`
+	GreenGain float64 `json:"green_gain,omitempty"`
+	BlueGain  float64 `json:"blue_gain,omitempty"`
+
+	// Гамма-коррекция каждого канала: значение (с учётом яркости) возводится
+	// в степень гаммы до применения множителей точки белого. Нулевое значение
+	// означает линейную характеристику (1.0).
+	RedGamma   float64 `json:"red_gamma,omitempty"`
+	GreenGamma float64 `json:"green_gamma,omitempty"`
+	BlueGamma  float64 `json:"blue_gamma,omitempty"`
+}
+
+// gain возвращает множитель с учётом нулевого значения по умолчанию.
+func gain(g float64) float64 {
+	if g == 0 {
+		return 1
+	}
+	return g
+}
+
+// WhitePointGains вычисляет множители каналов для точки белого. measured –
+// измеренная яркость (например, в люксах) каждого канала R, G, B при полной
+// мощности; target – требуемые доли каналов в белом цвете. Множители
+// нормируются так, чтобы наибольший из них был равен 1.0. Нулевые доли
+// отклоняются: нулевой множитель в калибровке означает 1.0, а не выключенный
+// канал.
+func WhitePointGains(measured, target [3]float64) ([3]float64, error) {
+	var gains [3]float64
+	top := 0.0
+	for i := range gains {
+		if measured[i] <= 0 || target[i] <= 0 {
+			return gains, fmt.Errorf("measured and target values must be positive")
+		}
+		gains[i] = target[i] / measured[i]
+		if gains[i] > top {
+			top = gains[i]
+		}
+	}
+	for i := range gains {
+		gains[i] /= top
+	}
+	return gains, nil
 }
 
 // DefaultRGBCalibration возвращает калибровку по умолчанию.
@@ -49,16 +106,30 @@ func NewRGBLed(pca *PCA9685, red, green, blue int) (*RGBLed, error) {
 		calibration: DefaultRGBCalibration(),
 	}
 
+	if err := pca.claimChannels(led, fmt.Sprintf("RGB LED on channels %d, %d, %d", red, green, blue), red, green, blue); err != nil {
+		pca.logger.Error("NewRGBLed: каналы недоступны: %v", err)
+		return nil, err
+	}
+
 	// Включение каналов.
 	if err := pca.EnableChannels(red, green, blue); err != nil {
+		pca.releaseChannels(led, red, green, blue)
 		pca.logger.Error("NewRGBLed: не удалось включить каналы: %v", err)
 		return nil, fmt.Errorf("failed to enable channels: %w", err)
 	}
 
+	pca.warnFrequency(pca.frequency(), led)
 	pca.logger.Basic("RGBLed успешно создан на каналах: %d, %d, %d", red, green, blue)
 	return led, nil
 }
 
+// Release освобождает каналы светодиода, чтобы их можно было использовать
+// для другой периферии. Светодиод после этого использовать нельзя.
+func (l *RGBLed) Release() {
+	l.pca.logger.Basic("Освобождение каналов RGBLed: %v", l.channels)
+	l.pca.releaseChannels(l, l.channels[:]...)
+}
+
 // SetCalibration устанавливает калибровочные данные для светодиода.
 func (l *RGBLed) SetCalibration(cal RGBCalibration) {
 	l.mu.Lock()
@@ -67,6 +138,21 @@ func (l *RGBLed) SetCalibration(cal RGBCalibration) {
 	l.calibration = cal
 }
 
+// CalibrateWhitePoint вычисляет множители точки белого по измерениям
+// (см. WhitePointGains) и сохраняет их в калибровке светодиода.
+func (l *RGBLed) CalibrateWhitePoint(measured, target [3]float64) error {
+	gains, err := WhitePointGains(measured, target)
+	if err != nil {
+		l.pca.logger.Error("CalibrateWhitePoint: ошибка калибровки: %v", err)
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calibration.RedGain, l.calibration.GreenGain, l.calibration.BlueGain = gains[0], gains[1], gains[2]
+	l.pca.logger.Basic("CalibrateWhitePoint: множители точки белого R=%.3f, G=%.3f, B=%.3f", gains[0], gains[1], gains[2])
+	return nil
+}
+
 // GetCalibration возвращает текущие калибровочные данные.
 func (l *RGBLed) GetCalibration() RGBCalibration {
 	l.mu.RLock()
@@ -76,34 +162,61 @@ func (l *RGBLed) GetCalibration() RGBCalibration {
 	return cal
 }
 
-// SetColor устанавливает цвет светодиода (значения RGB от 0 до 255).
+// SetColor устанавливает цвет светодиода (значения RGB от 0 до 255). Цвет
+// устанавливается как переход нулевой длительности (FadeTo) и подчиняется
+// политике переходов: при TransitionQueue он ждёт завершения выполняемых
+// переходов, при TransitionReplace и TransitionBlend прерывает их.
 func (l *RGBLed) SetColor(ctx context.Context, r, g, b uint8) error {
+	return l.FadeTo(ctx, r, g, b, 0)
+}
+
+// setColor выводит цвет на каналы в обход очереди переходов (кадр FadeTo).
+func (l *RGBLed) setColor(ctx context.Context, r, g, b uint8) error {
 	l.pca.logger.Detailed("SetColor: установка цвета R=%d, G=%d, B=%d", r, g, b)
 	l.mu.RLock()
 	defer l.mu.RUnlock()
 
-	// Масштабирование с учетом калибровки и яркости.
-	scale := func(value uint8, min, max uint16) uint16 {
-		v := float64(value) * l.brightness
-		scaled := uint16((v * float64(max-min) / 255.0) + float64(min))
+	values := l.pwmValues(r, g, b)
+	if err := l.pca.SetMultiPWMValues(ctx, values[:]); err != nil {
+		l.pca.logger.Error("SetColor: ошибка установки цвета: %v", err)
+		return err
+	}
+	l.tmu.Lock()
+	l.color = [3]uint8{r, g, b}
+	l.tmu.Unlock()
+	l.pca.logger.Detailed("SetColor: цвет успешно установлен")
+	return nil
+}
+
+// pwmValues вычисляет значения каналов для цвета с учётом калибровки, гаммы
+// и яркости. Вызывается с захваченным l.mu.
+func (l *RGBLed) pwmValues(r, g, b uint8) [3]PWMValue {
+	return l.pwmLevels(float64(r)/255, float64(g)/255, float64(b)/255)
+}
+
+// pwmLevels вычисляет значения каналов для уровней цвета от 0.0 до 1.0
+// (используется для 16-битных источников, например DMX). Вызывается с
+// захваченным l.mu.
+func (l *RGBLed) pwmLevels(r, g, b float64) [3]PWMValue {
+	scale := func(level float64, min, max uint16, gamma, k float64) uint16 {
+		v := level * l.brightness
+		if gamma > 0 && gamma != 1 {
+			v = math.Pow(v, gamma)
+		}
+		v *= gain(k)
+		scaled := uint16((v * float64(max-min)) + float64(min))
 		if scaled > max {
 			return max
 		}
 		return scaled
 	}
 
-	values := map[int]struct{ On, Off uint16 }{
-		l.channels[0]: {0, scale(r, l.calibration.RedMin, l.calibration.RedMax)},
-		l.channels[1]: {0, scale(g, l.calibration.GreenMin, l.calibration.GreenMax)},
-		l.channels[2]: {0, scale(b, l.calibration.BlueMin, l.calibration.BlueMax)},
-	}
-
-	if err := l.pca.SetMultiPWM(ctx, values); err != nil {
-		l.pca.logger.Error("SetColor: ошибка установки цвета: %v", err)
-		return err
+	cal := l.calibration
+	return [3]PWMValue{
+		{Channel: l.channels[0], Off: scale(r, cal.RedMin, cal.RedMax, cal.RedGamma, cal.RedGain)},
+		{Channel: l.channels[1], Off: scale(g, cal.GreenMin, cal.GreenMax, cal.GreenGamma, cal.GreenGain)},
+		{Channel: l.channels[2], Off: scale(b, cal.BlueMin, cal.BlueMax, cal.BlueGamma, cal.BlueGain)},
 	}
-	l.pca.logger.Detailed("SetColor: цвет успешно установлен")
-	return nil
 }
 
 // SetColorStdlib устанавливает цвет с использованием стандартного пакета color.
@@ -121,7 +234,7 @@ func (l *RGBLed) SetColorStdlib(ctx context.Context, c color.Color) error {
 // SetBrightness устанавливает яркость (от 0.0 до 1.0).
 func (l *RGBLed) SetBrightness(brightness float64) error {
 	l.pca.logger.Detailed("SetBrightness: установка яркости: %f", brightness)
-	if brightness < 0 || brightness > 1 {
+	if !(brightness >= 0 && brightness <= 1) {
 		err := fmt.Errorf("brightness must be between 0 and 1")
 		l.pca.logger.Error("SetBrightness: ошибка установки яркости: %v", err)
 		return err
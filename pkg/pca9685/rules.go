@@ -0,0 +1,241 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Condition – подключаемый источник условия правила.
+type Condition interface {
+	Check(ctx context.Context) (bool, error)
+}
+
+// ConditionFunc позволяет использовать обычную функцию как Condition.
+type ConditionFunc func(ctx context.Context) (bool, error)
+
+// Check вызывает f(ctx).
+func (f ConditionFunc) Check(ctx context.Context) (bool, error) {
+	return f(ctx)
+}
+
+// Action – действие, выполняемое при срабатывании правила.
+type Action interface {
+	Do(ctx context.Context) error
+}
+
+// ActionFunc позволяет использовать обычную функцию как Action.
+type ActionFunc func(ctx context.Context) error
+
+// Do вызывает f(ctx).
+func (f ActionFunc) Do(ctx context.Context) error {
+	return f(ctx)
+}
+
+// ValueSource – источник числового значения (например, показаний датчика).
+type ValueSource interface {
+	Value(ctx context.Context) (float64, error)
+}
+
+// ValueSourceFunc позволяет использовать обычную функцию как ValueSource.
+type ValueSourceFunc func(ctx context.Context) (float64, error)
+
+// Value вызывает f(ctx).
+func (f ValueSourceFunc) Value(ctx context.Context) (float64, error) {
+	return f(ctx)
+}
+
+// Above возвращает условие «значение источника больше threshold».
+func Above(source ValueSource, threshold float64) Condition {
+	return ConditionFunc(func(ctx context.Context) (bool, error) {
+		v, err := source.Value(ctx)
+		return err == nil && v > threshold, err
+	})
+}
+
+// Below возвращает условие «значение источника меньше threshold».
+func Below(source ValueSource, threshold float64) Condition {
+	return ConditionFunc(func(ctx context.Context) (bool, error) {
+		v, err := source.Value(ctx)
+		return err == nil && v < threshold, err
+	})
+}
+
+// MessageCondition срабатывает, если с момента предыдущей проверки было
+// опубликовано сообщение с ожидаемыми темой и нагрузкой. Publish вызывается
+// из обработчика внешнего транспорта (MQTT, HTTP и т.п.).
+type MessageCondition struct {
+	topic   string
+	payload string
+	mu      sync.Mutex
+	pending bool
+}
+
+// NewMessageCondition создаёт условие, ожидающее сообщение payload в теме
+// topic (например, теме MQTT или пути HTTP).
+func NewMessageCondition(topic, payload string) *MessageCondition {
+	return &MessageCondition{topic: topic, payload: payload}
+}
+
+// Publish сообщает условию о полученном сообщении payload в теме topic.
+func (m *MessageCondition) Publish(topic, payload string) {
+	if topic != m.topic || payload != m.payload {
+		return
+	}
+	m.mu.Lock()
+	m.pending = true
+	m.mu.Unlock()
+}
+
+// Check возвращает true один раз на каждое полученное подходящее сообщение.
+func (m *MessageCondition) Check(ctx context.Context) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fired := m.pending
+	m.pending = false
+	return fired, nil
+}
+
+// ApplySceneAction возвращает действие, применяющее сцену.
+func ApplySceneAction(pca *PCA9685, scene Scene) Action {
+	return ActionFunc(func(ctx context.Context) error {
+		return pca.ApplyScene(ctx, scene)
+	})
+}
+
+// SetPWMAction возвращает действие, устанавливающее значение канала.
+func SetPWMAction(pca *PCA9685, channel int, on, off uint16) Action {
+	return ActionFunc(func(ctx context.Context) error {
+		return pca.SetPWM(ctx, channel, on, off)
+	})
+}
+
+// RuleMode определяет, когда выполняется действие правила.
+type RuleMode int
+
+const (
+	// RuleOnChange – действие выполняется, когда условие становится истинным.
+	RuleOnChange RuleMode = iota
+	// RuleWhileTrue – действие выполняется на каждом такте, пока условие истинно.
+	RuleWhileTrue
+)
+
+// Rule – правило «когда условие, тогда действие».
+type Rule struct {
+	Name string
+	When Condition
+	Then Action
+	Mode RuleMode
+
+	active bool
+}
+
+// RuleEngine периодически вычисляет правила и выполняет их действия.
+type RuleEngine struct {
+	mu     sync.Mutex
+	rules  []*Rule
+	tick   time.Duration
+	logger Logger
+}
+
+// NewRuleEngine создаёт движок правил с периодом вычисления tick.
+// Если logger равен nil, используется стандартный логгер.
+func NewRuleEngine(tick time.Duration, logger Logger) (*RuleEngine, error) {
+	if logger == nil {
+		logger = NewDefaultLogger(LogLevelBasic)
+	}
+	if tick <= 0 {
+		logger.Error("NewRuleEngine: неверный период: %v", tick)
+		return nil, fmt.Errorf("tick must be positive")
+	}
+	return &RuleEngine{tick: tick, logger: logger}, nil
+}
+
+// Add добавляет правило. Имена правил должны быть уникальными.
+func (e *RuleEngine) Add(rule Rule) error {
+	if rule.Name == "" || rule.When == nil || rule.Then == nil {
+		return fmt.Errorf("rule must have a name, a condition and an action")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range e.rules {
+		if r.Name == rule.Name {
+			return fmt.Errorf("rule %q already exists", rule.Name)
+		}
+	}
+	rule.active = false
+	e.rules = append(e.rules, &rule)
+	e.logger.Basic("RuleEngine: добавлено правило %q", rule.Name)
+	return nil
+}
+
+// Remove удаляет правило name.
+func (e *RuleEngine) Remove(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, r := range e.rules {
+		if r.Name == name {
+			e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			e.logger.Basic("RuleEngine: удалено правило %q", name)
+			return
+		}
+	}
+}
+
+// Evaluate выполняет один проход по всем правилам. Ошибки отдельных правил
+// логируются и не мешают вычислению остальных; возвращается первая из них.
+// Команды действий записываются в журнал изменений с источником "rule:<имя>".
+// Условия и действия выполняются без блокировки движка, поэтому действие
+// может добавлять и удалять правила; изменения вступают в силу со
+// следующего прохода.
+func (e *RuleEngine) Evaluate(ctx context.Context) error {
+	e.mu.Lock()
+	rules := append([]*Rule(nil), e.rules...)
+	e.mu.Unlock()
+
+	var firstErr error
+	for _, r := range rules {
+		ok, err := r.When.Check(ctx)
+		if err != nil {
+			e.logger.Error("RuleEngine: ошибка условия правила %q: %v", r.Name, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("rule %q: %w", r.Name, err)
+			}
+			continue
+		}
+
+		e.mu.Lock()
+		fire := ok && (r.Mode == RuleWhileTrue || !r.active)
+		r.active = ok
+		e.mu.Unlock()
+		if !fire {
+			continue
+		}
+
+		e.logger.Detailed("RuleEngine: срабатывание правила %q", r.Name)
+		if err := r.Then.Do(WithSource(ctx, "rule:"+r.Name)); err != nil {
+			e.logger.Error("RuleEngine: ошибка действия правила %q: %v", r.Name, err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("rule %q: %w", r.Name, err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// Run вычисляет правила с заданным периодом до отмены контекста.
+func (e *RuleEngine) Run(ctx context.Context) error {
+	e.logger.Basic("RuleEngine: запуск с периодом %v", e.tick)
+	ticker := time.NewTicker(e.tick)
+	defer ticker.Stop()
+	for {
+		_ = e.Evaluate(ctx)
+		select {
+		case <-ctx.Done():
+			e.logger.Basic("RuleEngine: остановка")
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Scene – именованный набор значений каналов (значение off при on=0).
+// Сцена сериализуется в JSON, поэтому снятую CaptureScene сцену можно
+// сохранить в файл.
+type Scene struct {
+	Name   string         `json:"name"`
+	Values map[int]uint16 `json:"values"`
+	// Fade – длительность перехода каналов без собственного Timing (0 – сразу).
+	Fade time.Duration `json:"fade,omitempty"`
+	// Timing – задержка и длительность перехода отдельных каналов, например
+	// чтобы фон загорался первым, а акценты – позже.
+	Timing map[int]SceneTiming `json:"timing,omitempty"`
+}
+
+// SceneTiming – время перехода канала к значению сцены.
+type SceneTiming struct {
+	Delay time.Duration `json:"delay,omitempty"` // Задержка начала перехода
+	Fade  time.Duration `json:"fade,omitempty"`  // Длительность перехода
+}
+
+// timed сообщает, задано ли сцене время перехода.
+func (s Scene) timed() bool {
+	return s.Fade > 0 || len(s.Timing) > 0
+}
+
+// timing возвращает время перехода канала ch.
+func (s Scene) timing(ch int) SceneTiming {
+	if t, ok := s.Timing[ch]; ok {
+		return t
+	}
+	return SceneTiming{Fade: s.Fade}
+}
+
+// Duration возвращает длительность перехода сцены: время, за которое все
+// каналы достигают своих значений.
+func (s Scene) Duration() time.Duration {
+	var d time.Duration
+	for ch := range s.Values {
+		t := s.timing(ch)
+		d = max(d, t.Delay+t.Fade)
+	}
+	return d
+}
+
+// CaptureOption определяет опцию CaptureScene.
+type CaptureOption func(*capture)
+
+type capture struct {
+	channels []int
+	refs     []Peripheral
+}
+
+// CaptureChannels добавляет в сцену каналы channels.
+func CaptureChannels(channels ...int) CaptureOption {
+	return func(c *capture) {
+		c.channels = append(c.channels, channels...)
+	}
+}
+
+// CapturePeripherals добавляет в сцену все каналы периферии ps (RGBLed,
+// Servo, Pump и т.п.) на этом контроллере.
+func CapturePeripherals(ps ...Peripheral) CaptureOption {
+	return func(c *capture) {
+		c.refs = append(c.refs, ps...)
+	}
+}
+
+// CaptureScene снимает текущие значения каналов в сцену name, чтобы образ,
+// выставленный вручную (из CLI или панели управления), можно было сохранить
+// и затем применить ApplyScene. Без опций снимаются все включённые каналы.
+//
+// Снимаются значения, заданные каналам, без учёта мастер-яркости и
+// ограничений – ApplyScene применит их заново. Длительность импульса
+// сохраняется как значение off при on=0, поэтому сдвиг фазы канала не
+// сохраняется, а полностью включённый канал получает значение 4095.
+// Отключённые каналы пропускаются.
+func (pca *PCA9685) CaptureScene(name string, opts ...CaptureOption) (Scene, error) {
+	var c capture
+	for _, opt := range opts {
+		opt(&c)
+	}
+	for _, ch := range c.channels {
+		if err := pca.validateChannel(ch); err != nil {
+			pca.logger.Error("CaptureScene: неверный номер канала %d: %v", ch, err)
+			return Scene{}, err
+		}
+	}
+	channels := c.channels
+	if len(c.refs) > 0 {
+		pca.mu.RLock()
+		for _, p := range c.refs {
+			found := false
+			for ch, o := range pca.owners {
+				if o.ref == p {
+					channels = append(channels, ch)
+					found = true
+				}
+			}
+			if !found {
+				pca.mu.RUnlock()
+				return Scene{}, fmt.Errorf("peripheral %T has no channels on this controller", p)
+			}
+		}
+		pca.mu.RUnlock()
+	}
+	if len(c.channels) == 0 && len(c.refs) == 0 {
+		for ch := range pca.channels {
+			channels = append(channels, ch)
+		}
+	}
+
+	scene := Scene{Name: name, Values: make(map[int]uint16, len(channels))}
+	for _, ch := range channels {
+		enabled, on, off := pca.channels[ch].snapshot()
+		if !enabled {
+			continue
+		}
+		scene.Values[ch] = uint16(min(pulseTicks(on, off), PwmResolution-1))
+	}
+	pca.logger.Basic("CaptureScene: сцена %q снята, каналов: %d", name, len(scene.Values))
+	return scene, nil
+}
+
+// ApplyScene устанавливает значения всех каналов сцены. Сцена с временем
+// перехода (Fade, Timing) проигрывается целиком, как Renderer.ApplyScene:
+// вызов возвращается, когда последний канал достиг своего значения, или при
+// отмене контекста. Кадры перехода выводятся с частотой Config.Fade.FrameRate
+// (по умолчанию 50 кадров/с) и в журнал изменений не записываются.
+func (pca *PCA9685) ApplyScene(ctx context.Context, scene Scene) error {
+	pca.logger.Basic("ApplyScene: применение сцены %q", scene.Name)
+	if scene.timed() {
+		if err := pca.playScene(ctx, scene); err != nil {
+			pca.logger.Error("ApplyScene: ошибка применения сцены %q: %v", scene.Name, err)
+			return fmt.Errorf("failed to apply scene %q: %w", scene.Name, err)
+		}
+		return nil
+	}
+	settings := make(map[int]struct{ On, Off uint16 }, len(scene.Values))
+	for ch, value := range scene.Values {
+		settings[ch] = struct{ On, Off uint16 }{0, value}
+	}
+	if err := pca.SetMultiPWM(ctx, settings); err != nil {
+		pca.logger.Error("ApplyScene: ошибка применения сцены %q: %v", scene.Name, err)
+		return fmt.Errorf("failed to apply scene %q: %w", scene.Name, err)
+	}
+	pca.sceneApplied(scene)
+	return nil
+}
+
+// sceneApplied сообщает о применении сцены.
+func (pca *PCA9685) sceneApplied(scene Scene) {
+	if pca.onEvent != nil {
+		channels := make([]int, 0, len(scene.Values))
+		for ch := range scene.Values {
+			channels = append(channels, ch)
+		}
+		sort.Ints(channels)
+		pca.emit(Event{Type: EventSceneApplied, Channel: -1, Name: scene.Name, Channels: channels})
+	}
+}
@@ -0,0 +1,144 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// sceneLayer – имя источника рендерера, проигрывающего переход сцены.
+const sceneLayer = "scene"
+
+// sceneFade – источник рендерера, переводящий каналы к значениям сцены с
+// задержкой и длительностью перехода каждого канала.
+type sceneFade struct {
+	r     *Renderer
+	scene Scene
+	from  map[int]uint16
+	start time.Time // момент первого кадра
+}
+
+// Render реализует RenderSource.
+func (s *sceneFade) Render(now time.Time, frame *RenderFrame) bool {
+	if s.start.IsZero() {
+		s.start = now
+	}
+	t := now.Sub(s.start)
+	done := true
+	for ch, to := range s.scene.Values {
+		timing := s.scene.timing(ch)
+		from, value := s.from[ch], to
+		switch {
+		case t < timing.Delay:
+			value = from
+			done = false
+		case t < timing.Delay+timing.Fade:
+			value = uint16(int64(from) + (int64(to)-int64(from))*int64(t-timing.Delay)/int64(timing.Fade))
+			done = false
+		}
+		frame.Set(ch, 0, value)
+	}
+	if done {
+		// Значения сцены остаются на каналах после удаления источника.
+		for ch, to := range s.scene.Values {
+			s.r.base.Set(ch, 0, to)
+		}
+	}
+	return !done
+}
+
+// ApplyScene запускает на рендерере переход к сцене: каждый канал начинает
+// изменяться через Timing[ch].Delay от первого кадра и достигает значения
+// сцены за Timing[ch].Fade (для каналов без Timing – сразу за Scene.Fade).
+// Переход начинается с текущих значений каналов рендерера, поэтому новая
+// сцена, применённая во время перехода, плавно продолжает его, заменяя
+// прежнюю. По завершении значения сцены становятся базовыми значениями
+// рендерера (как Set) и генерируется событие EventSceneApplied.
+//
+// Вызов не ждёт завершения перехода; кадры выводит Run. Значения сцены с
+// временем перехода должны быть в диапазоне 0–4095.
+func (r *Renderer) ApplyScene(scene Scene) error {
+	if err := r.pca.validateScene(scene); err != nil {
+		r.pca.logger.Error("Рендерер: неверная сцена %q: %v", scene.Name, err)
+		return err
+	}
+	r.pca.logger.Detailed("Рендерер: переход к сцене %q за %v", scene.Name, scene.Duration())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fade := &sceneFade{r: r, scene: scene, from: make(map[int]uint16, len(scene.Values))}
+	for ch := range scene.Values {
+		fade.from[ch] = r.current(ch)
+	}
+	pca := r.pca
+	r.addLocked(sceneLayer, fade, func() { pca.sceneApplied(scene) })
+	return nil
+}
+
+// current возвращает длительность импульса канала ch, выведенную
+// рендерером, или текущее значение канала контроллера. Вызывается с
+// захваченным r.mu.
+func (r *Renderer) current(ch int) uint16 {
+	var on, off uint16
+	switch {
+	case r.written[ch]:
+		on, off = r.last[ch].On, r.last[ch].Off
+	case r.base.set[ch]:
+		on, off = r.base.values[ch].On, r.base.values[ch].Off
+	default:
+		_, on, off = r.pca.channels[ch].snapshot()
+	}
+	return uint16(min(pulseTicks(on, off), PwmResolution-1))
+}
+
+// validateScene проверяет сцену с временем перехода.
+func (pca *PCA9685) validateScene(scene Scene) error {
+	if scene.Fade < 0 {
+		return fmt.Errorf("scene fade must not be negative")
+	}
+	for ch, value := range scene.Values {
+		if err := pca.validateChannel(ch); err != nil {
+			return err
+		}
+		if value >= PwmResolution {
+			return fmt.Errorf("channel %d: %w: scene value %d (want 0-4095)", ch, ErrInvalidPWM, value)
+		}
+	}
+	for ch, t := range scene.Timing {
+		if _, ok := scene.Values[ch]; !ok {
+			return fmt.Errorf("timing for channel %d without a scene value", ch)
+		}
+		if t.Delay < 0 || t.Fade < 0 {
+			return fmt.Errorf("channel %d: scene delay and fade must not be negative", ch)
+		}
+	}
+	return nil
+}
+
+// playScene проигрывает переход сцены на временном рендерере до его
+// завершения.
+func (pca *PCA9685) playScene(ctx context.Context, scene Scene) error {
+	var opts []RendererOption
+	if pca.fade.FrameRate > 0 {
+		opts = append(opts, WithRenderFrameRate(pca.fade.FrameRate))
+	}
+	r := NewRenderer(pca, opts...)
+	if err := r.ApplyScene(scene); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(r.frame)
+	defer ticker.Stop()
+	for {
+		if err := r.Render(ctx, time.Now()); err != nil {
+			return err
+		}
+		if !r.has(sceneLayer) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ScheduleTrigger вычисляет момент следующего срабатывания задания.
+type ScheduleTrigger interface {
+	Next(after time.Time) (time.Time, error)
+}
+
+// TriggerFunc позволяет использовать обычную функцию как ScheduleTrigger.
+type TriggerFunc func(after time.Time) (time.Time, error)
+
+// Next вызывает f(after).
+func (f TriggerFunc) Next(after time.Time) (time.Time, error) {
+	return f(after)
+}
+
+// DailyTrigger срабатывает ежедневно в указанное время (в часовом поясе момента after).
+type DailyTrigger struct {
+	Hour, Minute, Second int
+}
+
+// Next возвращает ближайший момент после after.
+func (d DailyTrigger) Next(after time.Time) (time.Time, error) {
+	if d.Hour < 0 || d.Hour > 23 || d.Minute < 0 || d.Minute > 59 || d.Second < 0 || d.Second > 59 {
+		return time.Time{}, fmt.Errorf("invalid time of day: %02d:%02d:%02d", d.Hour, d.Minute, d.Second)
+	}
+	y, m, day := after.Date()
+	next := time.Date(y, m, day, d.Hour, d.Minute, d.Second, 0, after.Location())
+	if !next.After(after) {
+		next = time.Date(y, m, day+1, d.Hour, d.Minute, d.Second, 0, after.Location())
+	}
+	return next, nil
+}
+
+// SolarTrigger срабатывает в момент астрономического события для заданных координат,
+// например, для включения уличного освещения в сумерках. Offset сдвигает момент
+// срабатывания (отрицательное значение – раньше события).
+type SolarTrigger struct {
+	Event     SolarEvent
+	Latitude  float64
+	Longitude float64
+	Offset    time.Duration
+}
+
+// Next возвращает ближайший момент события после after. Дни, в которые событие
+// не наступает (полярный день или ночь), пропускаются.
+func (s SolarTrigger) Next(after time.Time) (time.Time, error) {
+	y, m, d := after.Date()
+	for i := -1; i <= 366; i++ {
+		day := time.Date(y, m, d+i, 12, 0, 0, 0, after.Location())
+		t, err := SolarTime(s.Event, day, s.Latitude, s.Longitude)
+		if errors.Is(err, ErrNoSolarEvent) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if t = t.Add(s.Offset); t.After(after) {
+			return t, nil
+		}
+	}
+	return time.Time{}, ErrNoSolarEvent
+}
+
+// scheduledJob – задание планировщика.
+type scheduledJob struct {
+	name    string
+	trigger ScheduleTrigger
+	action  func(ctx context.Context) error
+	next    time.Time
+	running bool // действие ещё выполняется
+}
+
+// Scheduler выполняет действия в моменты, вычисляемые триггерами.
+type Scheduler struct {
+	mu     sync.Mutex
+	jobs   map[string]*scheduledJob
+	wake   chan struct{}
+	logger Logger
+}
+
+// NewScheduler создаёт планировщик. Если logger равен nil, используется стандартный логгер.
+func NewScheduler(logger Logger) *Scheduler {
+	if logger == nil {
+		logger = NewDefaultLogger(LogLevelBasic)
+	}
+	return &Scheduler{
+		jobs:   make(map[string]*scheduledJob),
+		wake:   make(chan struct{}, 1),
+		logger: logger,
+	}
+}
+
+// Add регистрирует задание name. Задание с тем же именем заменяется. Команды
+// действия записываются в журнал изменений с источником "scheduler:<name>".
+func (s *Scheduler) Add(name string, trigger ScheduleTrigger, action func(ctx context.Context) error) error {
+	next, err := trigger.Next(time.Now())
+	if err != nil {
+		s.logger.Error("Scheduler: не удалось вычислить время задания %q: %v", name, err)
+		return fmt.Errorf("failed to schedule %q: %w", name, err)
+	}
+
+	s.mu.Lock()
+	s.jobs[name] = &scheduledJob{name: name, trigger: trigger, action: action, next: next}
+	s.mu.Unlock()
+	s.logger.Basic("Scheduler: задание %q запланировано на %v", name, next)
+	s.notify()
+	return nil
+}
+
+// Remove удаляет задание name.
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	delete(s.jobs, name)
+	s.mu.Unlock()
+	s.logger.Basic("Scheduler: задание %q удалено", name)
+	s.notify()
+}
+
+// Next возвращает время следующего срабатывания задания name.
+func (s *Scheduler) Next(name string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[name]
+	if !ok {
+		return time.Time{}, false
+	}
+	return job.next, true
+}
+
+// Run выполняет задания до отмены контекста. Каждое действие запускается в
+// отдельной горутине, поэтому долгое действие (например, рассвет) не
+// задерживает остальные задания. Срабатывание задания, предыдущее действие
+// которого ещё выполняется, пропускается. Ошибки действий логируются и не
+// прерывают работу планировщика. После отмены контекста Run дожидается
+// завершения запущенных действий.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.logger.Basic("Scheduler: запуск")
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		s.mu.Lock()
+		var due *scheduledJob
+		for _, job := range s.jobs {
+			if due == nil || job.next.Before(due.next) {
+				due = job
+			}
+		}
+		s.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if due != nil {
+			timer = time.NewTimer(due.next.Sub(time.Now()))
+			timeout = timer.C
+		}
+
+		fired := false
+		select {
+		case <-ctx.Done():
+		case <-s.wake:
+		case <-timeout:
+			fired = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			s.logger.Basic("Scheduler: остановка")
+			return ctx.Err()
+		}
+		if !fired {
+			continue
+		}
+
+		s.mu.Lock()
+		if s.jobs[due.name] != due {
+			s.mu.Unlock()
+			continue
+		}
+		next, err := due.trigger.Next(time.Now())
+		if err != nil {
+			s.logger.Error("Scheduler: задание %q больше не будет выполняться: %v", due.name, err)
+			delete(s.jobs, due.name)
+		} else {
+			due.next = next
+		}
+		busy := due.running
+		due.running = true
+		s.mu.Unlock()
+		if busy {
+			s.logger.Error("Scheduler: задание %q пропущено: предыдущее выполнение не завершено", due.name)
+			continue
+		}
+
+		s.logger.Detailed("Scheduler: выполнение задания %q", due.name)
+		wg.Add(1)
+		go func(job *scheduledJob) {
+			defer wg.Done()
+			if err := job.action(WithSource(ctx, "scheduler:"+job.name)); err != nil {
+				s.logger.Error("Scheduler: ошибка выполнения задания %q: %v", job.name, err)
+			}
+			s.mu.Lock()
+			job.running = false
+			s.mu.Unlock()
+		}(due)
+	}
+}
+
+// notify будит цикл Run для пересчёта ближайшего задания.
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,257 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SegmentConfig содержит настройки сегмента светодиодных лент.
+type SegmentConfig struct {
+	Channels []int   // Каналы сегмента в порядке следования
+	Gamma    float64 // Гамма-коррекция уровня (0 – линейная характеристика, обычно 2.2)
+	Min      uint16  // Значение off при минимальном ненулевом уровне
+	Max      uint16  // Значение off при полном уровне (0 – 4095)
+
+	// Ratios – доли каналов в порядке Channels (от 0 до 1), например 1.0 для
+	// королевского синего и 0.6 для холодного белого. Доля умножает выходную
+	// мощность канала после гамма-коррекции, поэтому соотношение спектра не
+	// зависит от уровня. nil – все каналы получают одинаковое значение.
+	Ratios []float64
+}
+
+// Segment – зона из нескольких каналов (например, белых светодиодных лент
+// или излучателей разного спектра одного светильника), которая диммируется
+// одним уровнем: каналы получают значения в заданных долях (Ratios) и
+// записываются пакетом. Уровень сегмента умножается на мастер-яркость
+// сегмента, проходит гамма-коррекцию, умножается на долю канала и
+// переводится в диапазон Min–Max; мастер-яркость контроллера применяется
+// поверх.
+type Segment struct {
+	pca    *PCA9685
+	cfg    SegmentConfig
+	sorted []int // каналы по возрастанию для записи и событий
+
+	mu     sync.Mutex // защищает уровни и сериализует записи сегмента
+	level  float64
+	master float64
+	ratios []float64 // доли каналов в порядке sorted
+	values []PWMValue
+}
+
+// NewSegment создаёт сегмент на указанных каналах.
+func NewSegment(pca *PCA9685, cfg SegmentConfig) (*Segment, error) {
+	pca.logger.Detailed("Создание сегмента на каналах: %v", cfg.Channels)
+	if len(cfg.Channels) == 0 {
+		pca.logger.Error("NewSegment: не заданы каналы")
+		return nil, fmt.Errorf("at least one channel is required")
+	}
+	for _, ch := range cfg.Channels {
+		if err := pca.validateChannel(ch); err != nil {
+			pca.logger.Error("NewSegment: неверный номер канала %d: %v", ch, err)
+			return nil, err
+		}
+	}
+	if cfg.Max == 0 {
+		cfg.Max = 4095
+	}
+	if cfg.Max > 4095 || cfg.Min > cfg.Max {
+		pca.logger.Error("NewSegment: неверный диапазон %d–%d", cfg.Min, cfg.Max)
+		return nil, fmt.Errorf("invalid segment range %d-%d", cfg.Min, cfg.Max)
+	}
+	if cfg.Gamma < 0 {
+		return nil, fmt.Errorf("gamma must not be negative")
+	}
+	cfg.Channels = append([]int(nil), cfg.Channels...)
+
+	s := &Segment{
+		pca:    pca,
+		cfg:    cfg,
+		sorted: append([]int(nil), cfg.Channels...),
+		master: 1,
+		values: make([]PWMValue, len(cfg.Channels)),
+	}
+	sort.Ints(s.sorted)
+	ratios, err := s.sortRatios(cfg.Ratios)
+	if err != nil {
+		pca.logger.Error("NewSegment: неверные доли каналов: %v", err)
+		return nil, err
+	}
+	s.ratios = ratios
+	s.cfg.Ratios = nil
+	if err := pca.claimChannels(s, fmt.Sprintf("LED segment on channels %v", cfg.Channels), cfg.Channels...); err != nil {
+		pca.logger.Error("NewSegment: каналы недоступны: %v", err)
+		return nil, err
+	}
+	if err := pca.EnableChannels(cfg.Channels...); err != nil {
+		pca.releaseChannels(s, cfg.Channels...)
+		pca.logger.Error("NewSegment: не удалось включить каналы: %v", err)
+		return nil, fmt.Errorf("failed to enable channels: %w", err)
+	}
+	pca.warnFrequency(pca.frequency(), s)
+	return s, nil
+}
+
+// Release освобождает каналы сегмента.
+func (s *Segment) Release() {
+	s.pca.logger.Basic("Освобождение каналов сегмента: %v", s.cfg.Channels)
+	s.pca.releaseChannels(s, s.cfg.Channels...)
+}
+
+// Channels возвращает каналы сегмента в порядке следования.
+func (s *Segment) Channels() []int {
+	return append([]int(nil), s.cfg.Channels...)
+}
+
+// Ratios возвращает доли каналов в порядке Channels.
+func (s *Segment) Ratios() []float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ratios := make([]float64, len(s.cfg.Channels))
+	for i, ch := range s.cfg.Channels {
+		ratios[i] = s.ratios[sort.SearchInts(s.sorted, ch)]
+	}
+	return ratios
+}
+
+// SetRatios изменяет доли каналов (в порядке Channels) и сразу применяет их
+// к текущему уровню, например для смены спектра светильника без изменения
+// общей яркости.
+func (s *Segment) SetRatios(ctx context.Context, ratios []float64) error {
+	sorted, err := s.sortRatios(ratios)
+	if err != nil {
+		s.pca.logger.Error("Segment.SetRatios: %v", err)
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.ratios
+	s.ratios = sorted
+	if err := s.applyLocked(ctx, s.level, s.master); err != nil {
+		s.ratios = prev
+		return err
+	}
+	return nil
+}
+
+// sortRatios проверяет доли каналов в порядке Channels и возвращает их в
+// порядке sorted. nil означает одинаковые доли 1.
+func (s *Segment) sortRatios(ratios []float64) ([]float64, error) {
+	sorted := make([]float64, len(s.sorted))
+	if ratios == nil {
+		for i := range sorted {
+			sorted[i] = 1
+		}
+		return sorted, nil
+	}
+	if len(ratios) != len(s.cfg.Channels) {
+		return nil, fmt.Errorf("got %d ratios for %d channels", len(ratios), len(s.cfg.Channels))
+	}
+	for i, r := range ratios {
+		if r < 0 || r > 1 || math.IsNaN(r) {
+			return nil, fmt.Errorf("ratio of channel %d must be between 0 and 1", s.cfg.Channels[i])
+		}
+		sorted[sort.SearchInts(s.sorted, s.cfg.Channels[i])] = r
+	}
+	return sorted, nil
+}
+
+// Level возвращает уровень сегмента (от 0.0 до 1.0).
+func (s *Segment) Level() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.level
+}
+
+// Master возвращает мастер-яркость сегмента (от 0.0 до 1.0).
+func (s *Segment) Master() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.master
+}
+
+// SetLevel устанавливает уровень сегмента (от 0.0 до 1.0).
+func (s *Segment) SetLevel(ctx context.Context, level float64) error {
+	if level < 0 || level > 1 {
+		s.pca.logger.Error("Segment.SetLevel: неверный уровень %v", level)
+		return fmt.Errorf("segment level must be between 0 and 1")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applyLocked(ctx, level, s.master)
+}
+
+// SetMaster задаёт мастер-яркость сегмента (от 0.0 до 1.0), на которую
+// умножается уровень. Уровень сохраняется, поэтому после возврата к 1.0
+// сегмент светит как прежде.
+func (s *Segment) SetMaster(ctx context.Context, master float64) error {
+	if master < 0 || master > 1 {
+		s.pca.logger.Error("Segment.SetMaster: неверное значение %v", master)
+		return fmt.Errorf("segment master must be between 0 and 1")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.applyLocked(ctx, s.level, master)
+}
+
+// Fade плавно изменяет уровень сегмента до level за duration. Все каналы
+// записываются пакетом на каждом кадре; разрешение задаётся как у
+// FadeChannel. Генерирует события плавного изменения с именем "FadeSegment".
+func (s *Segment) Fade(ctx context.Context, level float64, duration time.Duration, opts ...FadeOption) error {
+	if level < 0 || level > 1 {
+		s.pca.logger.Error("Segment.Fade: неверный уровень %v", level)
+		return fmt.Errorf("segment level must be between 0 and 1")
+	}
+	if duration < 0 {
+		return fmt.Errorf("fade duration must not be negative")
+	}
+	s.pca.logger.Basic("Segment.Fade: изменение уровня сегмента %v до %.3f за %v", s.cfg.Channels, level, duration)
+	start := s.Level()
+	steps := s.pca.fadeConfig(opts).steps(duration)
+	begin := time.Now()
+	fctx := s.pca.quiet(ctx)
+	s.pca.fadeEvent(EventFadeStarted, "FadeSegment", s.sorted, nil)
+	err := runFade(fctx, steps, duration, func(step int) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.applyLocked(fctx, start+(level-start)*float64(step)/float64(steps), s.master)
+	})
+	s.pca.fadeEvent(EventFadeCompleted, "FadeSegment", s.sorted, err)
+	for _, ch := range s.cfg.Channels {
+		s.pca.record(ctx, JournalEntry{Time: begin, Op: "FadeSegment", Channel: ch, Value: level}, err)
+	}
+	if err != nil {
+		s.pca.logger.Error("Segment.Fade: ошибка плавного изменения: %v", err)
+	}
+	return err
+}
+
+// applyLocked записывает каналы для уровня level и мастер-яркости master и
+// запоминает их после успешной записи. Вызывается с захваченным s.mu.
+func (s *Segment) applyLocked(ctx context.Context, level, master float64) error {
+	// Каналы по возрастанию, чтобы соседние записывались одной транзакцией.
+	for i, ch := range s.sorted {
+		s.values[i] = PWMValue{Channel: ch, Off: s.pwm(level*master, s.ratios[i])}
+	}
+	if err := s.pca.SetMultiPWMValues(ctx, s.values); err != nil {
+		s.pca.logger.Error("Segment: ошибка установки каналов %v: %v", s.cfg.Channels, err)
+		return err
+	}
+	s.level, s.master = level, master
+	return nil
+}
+
+// pwm переводит итоговый уровень в значение off канала с долей ratio с
+// учётом гаммы и диапазона. Нулевой уровень или доля всегда выключают канал.
+func (s *Segment) pwm(v, ratio float64) uint16 {
+	if v <= 0 || ratio <= 0 {
+		return 0
+	}
+	if g := s.cfg.Gamma; g > 0 && g != 1 {
+		v = math.Pow(v, g)
+	}
+	return uint16(math.Round(float64(s.cfg.Min) + ratio*v*float64(s.cfg.Max-s.cfg.Min)))
+}
@@ -0,0 +1,308 @@
+package pca9685
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrNoReading возвращается источником опрашиваемого датчика, если датчик
+// ещё не дал ни одного успешного измерения.
+var ErrNoReading = errors.New("sensor has no reading yet")
+
+// ErrStaleReading возвращается источником опрашиваемого датчика, если
+// последнее успешное измерение старше трёх интервалов опроса.
+var ErrStaleReading = errors.New("sensor reading is stale")
+
+// SensorReading – последнее состояние опрашиваемого датчика.
+type SensorReading struct {
+	Name     string        `json:"name"`
+	Unit     string        `json:"unit,omitempty"`
+	Value    float64       `json:"value"`           // Последнее успешное измерение
+	Time     time.Time     `json:"time"`            // Время последнего успешного измерения
+	Interval time.Duration `json:"interval"`        // Период опроса
+	Err      string        `json:"error,omitempty"` // Ошибка последнего опроса
+	Samples  uint64        `json:"samples"`         // Успешные измерения
+	Errors   uint64        `json:"errors"`          // Неудачные опросы
+}
+
+// polledSensor – датчик, зарегистрированный в SensorPoller.
+type polledSensor struct {
+	name     string
+	unit     string
+	source   ValueSource
+	interval time.Duration
+
+	mu          sync.Mutex
+	reading     SensorReading
+	err         error
+	subscribers []func(SensorReading)
+}
+
+// SensorOption определяет опцию датчика SensorPoller.
+type SensorOption func(*polledSensor)
+
+// WithSensorUnit задаёт единицу измерения датчика для State и REST
+// (например, "°C", "л/мин", "А", "лк").
+func WithSensorUnit(unit string) SensorOption {
+	return func(s *polledSensor) {
+		s.unit = unit
+	}
+}
+
+// SensorPoller опрашивает зарегистрированные датчики (температуры, расхода,
+// тока, освещённости) каждый со своим периодом и хранит последние значения.
+// Потребители – правила, ПИД-регуляторы, кривые вентиляторов – читают
+// значения через Source без обращения к шине датчика или получают каждое
+// измерение через Subscribe. Состояние доступно через State, Handler и
+// PublishExpvar.
+type SensorPoller struct {
+	mu      sync.RWMutex
+	sensors map[string]*polledSensor
+	logger  Logger
+	ctx     context.Context // контекст Run; nil, пока опрос не запущен
+	wg      sync.WaitGroup
+}
+
+// NewSensorPoller создаёт пустой опросчик датчиков. Если logger равен nil,
+// используется стандартный логгер.
+func NewSensorPoller(logger Logger) *SensorPoller {
+	if logger == nil {
+		logger = NewDefaultLogger(LogLevelBasic)
+	}
+	return &SensorPoller{sensors: make(map[string]*polledSensor), logger: logger}
+}
+
+// Add регистрирует датчик name с периодом опроса interval. Если опрос уже
+// запущен, датчик начинает опрашиваться сразу.
+func (p *SensorPoller) Add(name string, source ValueSource, interval time.Duration, opts ...SensorOption) error {
+	if name == "" || source == nil {
+		return fmt.Errorf("sensor must have a name and a source")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("sensor %q: poll interval must be positive", name)
+	}
+	s := &polledSensor{name: name, source: source, interval: interval}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.reading = SensorReading{Name: name, Unit: s.unit, Interval: interval}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.sensors[name]; ok {
+		return fmt.Errorf("sensor %q already exists", name)
+	}
+	p.sensors[name] = s
+	p.logger.Basic("SensorPoller: добавлен датчик %q с периодом %v", name, interval)
+	if p.ctx != nil {
+		p.start(s)
+	}
+	return nil
+}
+
+// AddCurrent регистрирует датчик тока (CurrentSensor) в амперах.
+func (p *SensorPoller) AddCurrent(name string, sensor CurrentSensor, interval time.Duration, opts ...SensorOption) error {
+	if sensor == nil {
+		return fmt.Errorf("sensor must have a name and a source")
+	}
+	opts = append([]SensorOption{WithSensorUnit("A")}, opts...)
+	return p.Add(name, ValueSourceFunc(sensor.Current), interval, opts...)
+}
+
+// Subscribe вызывает fn после каждого опроса датчика name, в том числе
+// неудачного (SensorReading.Err не пуст). fn вызывается из горутины опроса
+// и не должна блокироваться надолго.
+func (p *SensorPoller) Subscribe(name string, fn func(SensorReading)) error {
+	s, err := p.sensor(name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.subscribers = append(s.subscribers, fn)
+	s.mu.Unlock()
+	return nil
+}
+
+// Source возвращает ValueSource с последним успешным значением датчика name
+// для правил (Above, Below), ПИД-регуляторов и другой логики. Источник
+// возвращает ErrNoReading до первого измерения и ErrStaleReading, если
+// датчик не отвечает дольше трёх периодов опроса.
+func (p *SensorPoller) Source(name string) (ValueSource, error) {
+	s, err := p.sensor(name)
+	if err != nil {
+		return nil, err
+	}
+	return ValueSourceFunc(func(ctx context.Context) (float64, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch {
+		case s.reading.Samples == 0:
+			return 0, fmt.Errorf("sensor %q: %w", name, ErrNoReading)
+		case time.Since(s.reading.Time) > 3*s.interval:
+			return s.reading.Value, fmt.Errorf("sensor %q: %w: %v", name, ErrStaleReading, s.err)
+		}
+		return s.reading.Value, nil
+	}), nil
+}
+
+// Reading возвращает последнее состояние датчика name.
+func (p *SensorPoller) Reading(name string) (SensorReading, error) {
+	s, err := p.sensor(name)
+	if err != nil {
+		return SensorReading{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reading, nil
+}
+
+// State возвращает состояние всех датчиков, отсортированное по имени.
+func (p *SensorPoller) State() []SensorReading {
+	p.mu.RLock()
+	sensors := make([]*polledSensor, 0, len(p.sensors))
+	for _, s := range p.sensors {
+		sensors = append(sensors, s)
+	}
+	p.mu.RUnlock()
+	sort.Slice(sensors, func(i, j int) bool { return sensors[i].name < sensors[j].name })
+
+	state := make([]SensorReading, len(sensors))
+	for i, s := range sensors {
+		s.mu.Lock()
+		state[i] = s.reading
+		s.mu.Unlock()
+	}
+	return state
+}
+
+// Poll опрашивает все датчики один раз вне расписания. Ошибки отдельных
+// датчиков не мешают опросу остальных; возвращается первая из них.
+func (p *SensorPoller) Poll(ctx context.Context) error {
+	p.mu.RLock()
+	sensors := make([]*polledSensor, 0, len(p.sensors))
+	for _, s := range p.sensors {
+		sensors = append(sensors, s)
+	}
+	p.mu.RUnlock()
+
+	var firstErr error
+	for _, s := range sensors {
+		if err := p.sample(ctx, s); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Run опрашивает датчики по их расписаниям до отмены контекста.
+func (p *SensorPoller) Run(ctx context.Context) error {
+	p.mu.Lock()
+	if p.ctx != nil {
+		p.mu.Unlock()
+		return fmt.Errorf("sensor poller is already running")
+	}
+	p.ctx = ctx
+	p.logger.Basic("SensorPoller: запуск опроса %d датчиков", len(p.sensors))
+	for _, s := range p.sensors {
+		p.start(s)
+	}
+	p.mu.Unlock()
+
+	<-ctx.Done()
+	p.mu.Lock()
+	p.ctx = nil
+	p.mu.Unlock()
+	p.wg.Wait()
+	p.logger.Basic("SensorPoller: остановка")
+	return ctx.Err()
+}
+
+// start запускает горутину опроса датчика. Вызывается с p.mu.
+func (p *SensorPoller) start(s *polledSensor) {
+	ctx := p.ctx
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			_ = p.sample(ctx, s)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sample выполняет один опрос датчика и уведомляет подписчиков.
+func (p *SensorPoller) sample(ctx context.Context, s *polledSensor) error {
+	v, err := s.source.Value(ctx)
+	if err != nil && ctx.Err() != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.err = err
+	if err != nil {
+		s.reading.Errors++
+		s.reading.Err = err.Error()
+	} else {
+		s.reading.Samples++
+		s.reading.Value, s.reading.Time, s.reading.Err = v, time.Now(), ""
+	}
+	reading := s.reading
+	subscribers := s.subscribers // Subscribe только дописывает, срез до len неизменен
+	s.mu.Unlock()
+
+	if err != nil {
+		p.logger.Error("SensorPoller: ошибка опроса датчика %q: %v", s.name, err)
+		err = fmt.Errorf("sensor %q: %w", s.name, err)
+	} else {
+		p.logger.Detailed("SensorPoller: датчик %q = %g %s", s.name, v, s.unit)
+	}
+	for _, fn := range subscribers {
+		fn(reading)
+	}
+	return err
+}
+
+func (p *SensorPoller) sensor(name string) (*polledSensor, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	s, ok := p.sensors[name]
+	if !ok {
+		return nil, fmt.Errorf("sensor %q not found", name)
+	}
+	return s, nil
+}
+
+// Handler возвращает обработчик HTTP, отдающий State в JSON.
+func (p *SensorPoller) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(p.State()); err != nil {
+			p.logger.Error("SensorPoller: не удалось отправить состояние: %v", err)
+		}
+	})
+}
+
+// PublishExpvar публикует состояние датчиков в expvar под именем name.
+// Повторная публикация того же имени вызывает панику expvar.
+func (p *SensorPoller) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return p.State() }))
+}
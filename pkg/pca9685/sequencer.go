@@ -0,0 +1,329 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// SequencerState – состояние проигрывателя последовательностей.
+type SequencerState int
+
+const (
+	SequencerStopped SequencerState = iota
+	SequencerPlaying
+	SequencerPaused
+)
+
+func (s SequencerState) String() string {
+	switch s {
+	case SequencerPlaying:
+		return "playing"
+	case SequencerPaused:
+		return "paused"
+	default:
+		return "stopped"
+	}
+}
+
+// SequenceStep – один шаг последовательности.
+type SequenceStep struct {
+	Scene     Scene         // Значения каналов на этом шаге
+	Crossfade time.Duration // Длительность плавного перехода от предыдущих значений (если у сцены нет своего времени перехода)
+	Duration  time.Duration // Время удержания сцены после перехода
+}
+
+type sequencerCmd int
+
+const (
+	sequencerPause sequencerCmd = iota
+	sequencerResume
+	sequencerSkip
+)
+
+var errSequencerSkip = errors.New("step skipped")
+
+// Sequencer проигрывает упорядоченный список сцен с заданными длительностями,
+// плавными переходами и, при необходимости, по кругу.
+type Sequencer struct {
+	pca   *PCA9685
+	steps []SequenceStep
+	loop  bool
+
+	mu      sync.Mutex
+	state   SequencerState
+	current int
+	cmds    chan sequencerCmd
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+}
+
+// SequencerOption определяет опцию конфигурации проигрывателя.
+type SequencerOption func(*Sequencer)
+
+// WithLoop включает циклическое воспроизведение последовательности.
+func WithLoop(loop bool) SequencerOption {
+	return func(s *Sequencer) {
+		s.loop = loop
+	}
+}
+
+// NewSequencer создаёт проигрыватель для указанных шагов.
+func NewSequencer(pca *PCA9685, steps []SequenceStep, opts ...SequencerOption) (*Sequencer, error) {
+	pca.logger.Detailed("Создание проигрывателя последовательности из %d шагов", len(steps))
+	if len(steps) == 0 {
+		pca.logger.Error("NewSequencer: пустая последовательность")
+		return nil, fmt.Errorf("sequence must contain at least one step")
+	}
+	for i, step := range steps {
+		for ch := range step.Scene.Values {
+			if err := pca.validateChannel(ch); err != nil {
+				pca.logger.Error("NewSequencer: шаг %d: неверный номер канала %d: %v", i, ch, err)
+				return nil, fmt.Errorf("step %d: %w", i, err)
+			}
+		}
+	}
+
+	s := &Sequencer{
+		pca:   pca,
+		steps: append([]SequenceStep(nil), steps...),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Play запускает воспроизведение с первого шага или продолжает его после паузы.
+func (s *Sequencer) Play(ctx context.Context) error {
+	s.mu.Lock()
+	switch s.state {
+	case SequencerPlaying:
+		s.mu.Unlock()
+		return nil
+	case SequencerPaused:
+		s.pca.logger.Basic("Sequencer: продолжение воспроизведения")
+		s.state = SequencerPlaying
+		cmds, done := s.cmds, s.done
+		s.mu.Unlock()
+		s.send(cmds, done, sequencerResume)
+		return nil
+	}
+	defer s.mu.Unlock()
+
+	s.pca.logger.Basic("Sequencer: запуск воспроизведения")
+	runCtx, cancel := context.WithCancel(ctx)
+	s.cmds = make(chan sequencerCmd, 1)
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	s.err = nil
+	s.current = 0
+	s.state = SequencerPlaying
+	go s.run(runCtx, s.cmds, s.done)
+	return nil
+}
+
+// Pause приостанавливает воспроизведение на текущем кадре.
+func (s *Sequencer) Pause() {
+	s.mu.Lock()
+	if s.state != SequencerPlaying {
+		s.mu.Unlock()
+		return
+	}
+	s.pca.logger.Basic("Sequencer: пауза")
+	s.state = SequencerPaused
+	cmds, done := s.cmds, s.done
+	s.mu.Unlock()
+	s.send(cmds, done, sequencerPause)
+}
+
+// Skip немедленно переходит к следующему шагу.
+func (s *Sequencer) Skip() {
+	s.mu.Lock()
+	if s.state == SequencerStopped {
+		s.mu.Unlock()
+		return
+	}
+	s.pca.logger.Basic("Sequencer: переход к следующему шагу")
+	cmds, done := s.cmds, s.done
+	s.mu.Unlock()
+	s.send(cmds, done, sequencerSkip)
+}
+
+// send передаёт команду циклу воспроизведения, если он ещё работает.
+func (s *Sequencer) send(cmds chan sequencerCmd, done chan struct{}, cmd sequencerCmd) {
+	select {
+	case cmds <- cmd:
+	case <-done:
+	}
+}
+
+// Stop останавливает воспроизведение и дожидается завершения.
+func (s *Sequencer) Stop() {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	s.pca.logger.Basic("Sequencer: остановка")
+	cancel()
+	<-done
+}
+
+// Wait блокируется до окончания воспроизведения и возвращает его ошибку.
+// Остановка через Stop ошибкой не считается.
+func (s *Sequencer) Wait() error {
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	<-done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// State возвращает текущее состояние проигрывателя.
+func (s *Sequencer) State() SequencerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// CurrentStep возвращает индекс текущего шага.
+func (s *Sequencer) CurrentStep() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+func (s *Sequencer) run(ctx context.Context, cmds chan sequencerCmd, done chan struct{}) {
+	var err error
+	defer func() {
+		s.mu.Lock()
+		if err != nil && !errors.Is(err, context.Canceled) {
+			s.err = err
+		}
+		s.state = SequencerStopped
+		s.cancel = nil
+		s.mu.Unlock()
+		close(done)
+	}()
+
+	paused := false
+	for loop := 1; ; loop++ {
+		if loop > 1 {
+			s.pca.emit(Event{Type: EventAnimationLooped, Channel: -1, Name: "Sequencer", Loop: loop})
+		}
+		for i, step := range s.steps {
+			s.mu.Lock()
+			s.current = i
+			s.mu.Unlock()
+			s.pca.logger.Detailed("Sequencer: шаг %d (%q)", i, step.Scene.Name)
+
+			if err = s.playStep(ctx, cmds, &paused, step); err != nil && !errors.Is(err, errSequencerSkip) {
+				if !errors.Is(err, context.Canceled) {
+					s.pca.logger.Error("Sequencer: ошибка на шаге %d: %v", i, err)
+				}
+				return
+			}
+			err = nil
+		}
+		if !s.loop {
+			s.pca.logger.Basic("Sequencer: воспроизведение завершено")
+			return
+		}
+	}
+}
+
+func (s *Sequencer) playStep(ctx context.Context, cmds chan sequencerCmd, paused *bool, step SequenceStep) error {
+	// Сцена с собственным временем перехода проигрывает его в ApplyScene.
+	if step.Crossfade > 0 && !step.Scene.timed() {
+		from := make(map[int]uint16, len(step.Scene.Values))
+		for ch := range step.Scene.Values {
+			_, _, off, err := s.pca.GetChannelState(ch)
+			if err != nil {
+				return err
+			}
+			from[ch] = off
+		}
+
+		// Разрешение перехода задаётся Config.Fade, как у FadeChannel. Кадр
+		// выводится по окончании своего интервала, поэтому переход длится
+		// ровно Crossfade, а последний кадр совпадает со значениями сцены.
+		steps := s.pca.fadeConfig(nil).steps(step.Crossfade)
+		frame := max(step.Crossfade/time.Duration(steps), 1)
+		for i := 1; i <= steps; i++ {
+			if err := s.wait(ctx, cmds, paused, frame); err != nil {
+				return err
+			}
+			if i == steps {
+				break
+			}
+			settings := make(map[int]struct{ On, Off uint16 }, len(from))
+			for ch, start := range from {
+				diff := float64(int(step.Scene.Values[ch]) - int(start))
+				value := uint16(int(start) + int(diff*float64(i)/float64(steps)))
+				settings[ch] = struct{ On, Off uint16 }{0, value}
+			}
+			if err := s.pca.SetMultiPWM(ctx, settings); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.pca.ApplyScene(ctx, step.Scene); err != nil {
+		return err
+	}
+	return s.wait(ctx, cmds, paused, step.Duration)
+}
+
+// wait ожидает d без учёта времени, проведённого на паузе.
+// Состояние паузы сохраняется между вызовами через paused.
+func (s *Sequencer) wait(ctx context.Context, cmds chan sequencerCmd, paused *bool, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	remaining := d
+	started := time.Now()
+	if *paused && !timer.Stop() {
+		<-timer.C
+	}
+
+	for {
+		var timeout <-chan time.Time
+		if !*paused {
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return nil
+		case cmd := <-cmds:
+			switch cmd {
+			case sequencerPause:
+				if !*paused {
+					if !timer.Stop() {
+						<-timer.C
+					}
+					remaining -= time.Since(started)
+					*paused = true
+				}
+			case sequencerResume:
+				if *paused {
+					timer.Reset(remaining)
+					started = time.Now()
+					*paused = false
+				}
+			case sequencerSkip:
+				return errSequencerSkip
+			}
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ServoCalibration содержит длительности импульсов крайних и среднего
+// положений сервопривода.
+type ServoCalibration struct {
+	MinPulse    time.Duration `json:"min_pulse"`    // Импульс угла 0°
+	CenterPulse time.Duration `json:"center_pulse"` // Импульс угла Range/2
+	MaxPulse    time.Duration `json:"max_pulse"`    // Импульс угла Range
+	Range       float64       `json:"range"`        // Полный угол поворота, градусы
+}
+
+// DefaultServoCalibration возвращает типовую калибровку: 1–2 мс на 180°.
+func DefaultServoCalibration() ServoCalibration {
+	return ServoCalibration{
+		MinPulse:    1000 * time.Microsecond,
+		CenterPulse: 1500 * time.Microsecond,
+		MaxPulse:    2000 * time.Microsecond,
+		Range:       180,
+	}
+}
+
+// validate проверяет согласованность калибровки.
+func (c ServoCalibration) validate() error {
+	if c.Range <= 0 {
+		return fmt.Errorf("servo range must be positive")
+	}
+	if c.MinPulse <= 0 || c.CenterPulse <= 0 || c.MaxPulse <= 0 {
+		return fmt.Errorf("servo pulses must be positive")
+	}
+	// Сервопривод может быть установлен зеркально, поэтому допускается
+	// убывающая последовательность импульсов.
+	if (c.MinPulse-c.CenterPulse)*(c.CenterPulse-c.MaxPulse) <= 0 {
+		return fmt.Errorf("servo center pulse must lie strictly between min and max")
+	}
+	return nil
+}
+
+// pulse возвращает длительность импульса для угла angle. Половины диапазона
+// интерполируются отдельно, поэтому несимметричный сервопривод точно
+// попадает в среднее положение.
+func (c ServoCalibration) pulse(angle float64) time.Duration {
+	half := c.Range / 2
+	if angle <= half {
+		return c.MinPulse + time.Duration(float64(c.CenterPulse-c.MinPulse)*angle/half)
+	}
+	return c.CenterPulse + time.Duration(float64(c.MaxPulse-c.CenterPulse)*(angle-half)/half)
+}
+
+// durationTicks переводит длительность импульса в тики при текущей частоте.
+func (pca *PCA9685) durationTicks(d time.Duration) uint16 {
+	pca.mu.RLock()
+	freq := pca.Freq
+	pca.mu.RUnlock()
+	ticks := int(d.Seconds()*freq*PwmResolution + 0.5)
+	if ticks > PwmResolution-1 {
+		ticks = PwmResolution - 1
+	}
+	if ticks < 0 {
+		ticks = 0
+	}
+	return uint16(ticks)
+}
+
+// Servo представляет сервопривод, управляемый длительностью импульса.
+// Частота контроллера для сервоприводов обычно 50 Гц.
+type Servo struct {
+	pca     *PCA9685
+	channel int
+
+	mu    sync.RWMutex
+	cal   ServoCalibration
+	angle float64
+	trim  float64 // поправка угла по обратной связи (см. ServoFeedback)
+
+	motion MotionProfile // профиль MoveTo
+}
+
+// NewServo создаёт сервопривод на канале channel с калибровкой cal
+// (см. DefaultServoCalibration и StartCalibration).
+func NewServo(pca *PCA9685, channel int, cal ServoCalibration) (*Servo, error) {
+	pca.logger.Detailed("Создание сервопривода на канале: %d", channel)
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("NewServo: неверный номер канала: %d", channel)
+		return nil, err
+	}
+	if err := cal.validate(); err != nil {
+		pca.logger.Error("NewServo: неверная калибровка: %v", err)
+		return nil, err
+	}
+	if err := pca.requireFrequency("servo"); err != nil {
+		pca.logger.Error("NewServo: %v", err)
+		return nil, err
+	}
+
+	servo := &Servo{pca: pca, channel: channel, cal: cal, angle: cal.Range / 2}
+	if err := pca.claimChannels(servo, fmt.Sprintf("servo on channel %d", channel), channel); err != nil {
+		pca.logger.Error("NewServo: канал %d недоступен: %v", channel, err)
+		return nil, err
+	}
+	if err := pca.checkPeripheralFrequency(servo); err != nil {
+		pca.releaseChannels(servo, channel)
+		pca.logger.Error("NewServo: %v", err)
+		return nil, err
+	}
+	if err := pca.EnableChannels(channel); err != nil {
+		pca.releaseChannels(servo, channel)
+		pca.logger.Error("NewServo: не удалось включить канал %d: %v", channel, err)
+		return nil, fmt.Errorf("failed to enable channel: %w", err)
+	}
+
+	pca.logger.Basic("Сервопривод успешно создан на канале: %d", channel)
+	return servo, nil
+}
+
+// Release освобождает канал сервопривода. Сервопривод после этого
+// использовать нельзя.
+func (s *Servo) Release() {
+	s.pca.logger.Basic("Освобождение канала сервопривода %d", s.channel)
+	s.pca.releaseChannels(s, s.channel)
+}
+
+// SetAngle поворачивает сервопривод на угол angle (от 0 до Range).
+func (s *Servo) SetAngle(ctx context.Context, angle float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if angle < 0 || angle > s.cal.Range {
+		err := fmt.Errorf("angle must be between 0 and %g", s.cal.Range)
+		s.pca.logger.Error("SetAngle: %v", err)
+		return err
+	}
+	if err := s.drive(ctx, angle); err != nil {
+		s.pca.logger.Error("SetAngle: ошибка установки угла %g°: %v", angle, err)
+		return err
+	}
+	s.angle = angle
+	s.pca.logger.Detailed("SetAngle: канал %d, угол %g°", s.channel, angle)
+	return nil
+}
+
+// drive выводит импульс угла angle с учётом поправки trim. Вызывается с s.mu.
+func (s *Servo) drive(ctx context.Context, angle float64) error {
+	cmd := math.Max(0, math.Min(s.cal.Range, angle+s.trim))
+	return s.pca.SetPWM(ctx, s.channel, 0, s.pca.durationTicks(s.cal.pulse(cmd)))
+}
+
+// Angle возвращает последний установленный угол.
+func (s *Servo) Angle() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.angle
+}
+
+// Off снимает импульс, и сервопривод перестаёт удерживать положение.
+func (s *Servo) Off(ctx context.Context) error {
+	s.pca.logger.Basic("Off: отключение сервопривода на канале %d", s.channel)
+	return s.pca.SetPWM(ctx, s.channel, 0, 0)
+}
+
+// Calibration возвращает калибровку сервопривода.
+func (s *Servo) Calibration() ServoCalibration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cal
+}
+
+// SetCalibration заменяет калибровку сервопривода. Новая калибровка
+// применяется при следующем SetAngle.
+func (s *Servo) SetCalibration(cal ServoCalibration) error {
+	if err := cal.validate(); err != nil {
+		s.pca.logger.Error("SetCalibration: неверная калибровка: %v", err)
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cal = cal
+	if s.angle > cal.Range {
+		s.angle = cal.Range
+	}
+	return nil
+}
+
+// ServoCalibrator подбирает калибровку сервопривода по шагам: импульс
+// изменяется методами Nudge и SetPulse, а найденные положения отмечаются
+// MarkMin, MarkCenter и MarkMax. Удобен для интерактивных утилит.
+type ServoCalibrator struct {
+	pca     *PCA9685
+	channel int
+
+	mu     sync.Mutex
+	pulse  time.Duration
+	cal    ServoCalibration
+	marked [3]bool
+	done   bool
+}
+
+// StartCalibration начинает калибровку сервопривода на канале channel. Канал
+// закрепляется за калибратором до вызова Finish или Cancel; начальный импульс
+// соответствует среднему положению типового сервопривода (1,5 мс).
+func StartCalibration(ctx context.Context, pca *PCA9685, channel int) (*ServoCalibrator, error) {
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("StartCalibration: неверный номер канала: %d", channel)
+		return nil, err
+	}
+	c := &ServoCalibrator{pca: pca, channel: channel}
+	if err := pca.claimChannels(c, fmt.Sprintf("servo calibration on channel %d", channel), channel); err != nil {
+		pca.logger.Error("StartCalibration: канал %d недоступен: %v", channel, err)
+		return nil, err
+	}
+	if err := pca.EnableChannels(channel); err != nil {
+		pca.releaseChannels(c, channel)
+		return nil, fmt.Errorf("failed to enable channel: %w", err)
+	}
+	if err := c.SetPulse(ctx, DefaultServoCalibration().CenterPulse); err != nil {
+		pca.releaseChannels(c, channel)
+		return nil, err
+	}
+	pca.logger.Basic("StartCalibration: калибровка сервопривода на канале %d", channel)
+	return c, nil
+}
+
+// SetPulse устанавливает длительность импульса.
+func (c *ServoCalibrator) SetPulse(ctx context.Context, pulse time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return fmt.Errorf("servo calibration is finished")
+	}
+	if pulse <= 0 {
+		return fmt.Errorf("servo pulse must be positive")
+	}
+	if err := c.pca.SetPWM(ctx, c.channel, 0, c.pca.durationTicks(pulse)); err != nil {
+		c.pca.logger.Error("ServoCalibrator: ошибка установки импульса %v: %v", pulse, err)
+		return err
+	}
+	c.pulse = pulse
+	c.pca.logger.Detailed("ServoCalibrator: канал %d, импульс %v", c.channel, pulse)
+	return nil
+}
+
+// Nudge изменяет текущий импульс на delta (например, ±10 мкс).
+func (c *ServoCalibrator) Nudge(ctx context.Context, delta time.Duration) error {
+	return c.SetPulse(ctx, c.Pulse()+delta)
+}
+
+// Pulse возвращает текущую длительность импульса.
+func (c *ServoCalibrator) Pulse() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pulse
+}
+
+// MarkMin отмечает текущий импульс как положение 0°.
+func (c *ServoCalibrator) MarkMin() { c.mark(0, &c.cal.MinPulse) }
+
+// MarkCenter отмечает текущий импульс как среднее положение.
+func (c *ServoCalibrator) MarkCenter() { c.mark(1, &c.cal.CenterPulse) }
+
+// MarkMax отмечает текущий импульс как крайнее положение.
+func (c *ServoCalibrator) MarkMax() { c.mark(2, &c.cal.MaxPulse) }
+
+func (c *ServoCalibrator) mark(i int, dst *time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*dst = c.pulse
+	c.marked[i] = true
+	c.pca.logger.Basic("ServoCalibrator: отмечено положение %d, импульс %v", i, c.pulse)
+}
+
+// Finish завершает калибровку и освобождает канал. rangeDeg – угол между
+// отмеченными крайними положениями. Если среднее положение не отмечено, оно
+// вычисляется как середина между крайними.
+func (c *ServoCalibrator) Finish(rangeDeg float64) (ServoCalibration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.marked[0] || !c.marked[2] {
+		return ServoCalibration{}, fmt.Errorf("servo min and max positions must be marked")
+	}
+	cal := c.cal
+	cal.Range = rangeDeg
+	if !c.marked[1] {
+		cal.CenterPulse = (cal.MinPulse + cal.MaxPulse) / 2
+	}
+	if err := cal.validate(); err != nil {
+		return ServoCalibration{}, err
+	}
+	c.done = true
+	c.pca.releaseChannels(c, c.channel)
+	c.pca.logger.Basic("ServoCalibrator: калибровка завершена: %+v", cal)
+	return cal, nil
+}
+
+// Cancel прерывает калибровку и освобождает канал.
+func (c *ServoCalibrator) Cancel() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done = true
+	c.pca.releaseChannels(c, c.channel)
+}
+
+// SetFailsafeAngle задаёт угол, в который сервопривод переводится при
+// EmergencyStop, срабатывании Failsafe и Close.
+func (s *Servo) SetFailsafeAngle(angle float64) error {
+	s.mu.RLock()
+	cal := s.cal
+	s.mu.RUnlock()
+	if angle < 0 || angle > cal.Range {
+		return fmt.Errorf("angle must be between 0 and %g", cal.Range)
+	}
+	return s.pca.SetChannelFailsafe(s.channel, 0, s.pca.durationTicks(cal.pulse(angle)))
+}
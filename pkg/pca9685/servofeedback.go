@@ -0,0 +1,218 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrServoBlocked передаётся в событии EventServoBlocked и возвращается
+// SetAngleVerified: сервопривод не достиг заданного угла (механизм
+// заблокирован, привод перегружен или остановился).
+var ErrServoBlocked = errors.New("servo did not reach commanded angle")
+
+// PositionSensor – необязательный датчик фактического положения
+// сервопривода (аналоговый выход обратной связи, энкодер).
+type PositionSensor interface {
+	// Position возвращает угол в градусах в той же шкале, что и SetAngle.
+	Position(ctx context.Context) (float64, error)
+}
+
+// ServoFeedbackConfig задаёт параметры контроля положения.
+type ServoFeedbackConfig struct {
+	Tolerance     float64       // Допустимое отклонение, градусы (по умолчанию 2)
+	Settle        time.Duration // Время отработки после SetAngle до начала контроля (по умолчанию 500 мс)
+	Hold          time.Duration // Сколько отклонение должно сохраняться до EventServoBlocked (по умолчанию 1 с)
+	Interval      time.Duration // Период опроса датчика (по умолчанию 100 мс)
+	MaxCorrection float64       // Предельная поправка угла при коррекции дрейфа, градусы (0 – без коррекции)
+	StopOnBlock   bool          // Снимать импульс при блокировке, чтобы не перегружать механизм
+}
+
+// ServoFeedback контролирует положение сервопривода по датчику: исправляет
+// медленный дрейф поправкой угла (в пределах MaxCorrection) и сообщает
+// событием EventServoBlocked, если привод дольше Hold не достигает заданного
+// угла.
+type ServoFeedback struct {
+	servo  *Servo
+	sensor PositionSensor
+	cfg    ServoFeedbackConfig
+
+	mu       sync.Mutex
+	position float64
+	blocked  bool
+}
+
+// Feedback создаёт контроль положения сервопривода по датчику sensor.
+// Контроль работает в Run.
+func (s *Servo) Feedback(sensor PositionSensor, cfg ServoFeedbackConfig) (*ServoFeedback, error) {
+	if sensor == nil {
+		return nil, fmt.Errorf("position sensor is required")
+	}
+	if cfg.Tolerance < 0 || cfg.MaxCorrection < 0 {
+		return nil, fmt.Errorf("tolerance and max correction must not be negative")
+	}
+	if cfg.Tolerance == 0 {
+		cfg.Tolerance = 2
+	}
+	if cfg.Settle <= 0 {
+		cfg.Settle = 500 * time.Millisecond
+	}
+	if cfg.Hold <= 0 {
+		cfg.Hold = time.Second
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 100 * time.Millisecond
+	}
+	return &ServoFeedback{servo: s, sensor: sensor, cfg: cfg}, nil
+}
+
+// Trim возвращает текущую поправку угла, накопленную коррекцией дрейфа.
+func (s *Servo) Trim() float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trim
+}
+
+// Position возвращает последнее измеренное положение.
+func (f *ServoFeedback) Position() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.position
+}
+
+// Blocked сообщает, считается ли сервопривод заблокированным.
+func (f *ServoFeedback) Blocked() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.blocked
+}
+
+// SetAngleVerified поворачивает сервопривод и ожидает, пока датчик не
+// покажет заданный угол с точностью Tolerance. Если за Settle+Hold угол не
+// достигнут, возвращается ошибка, оборачивающая ErrServoBlocked.
+func (f *ServoFeedback) SetAngleVerified(ctx context.Context, angle float64) error {
+	if err := f.servo.SetAngle(ctx, angle); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(f.cfg.Settle + f.cfg.Hold)
+	ticker := time.NewTicker(f.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		pos, err := f.read(ctx)
+		if err == nil && math.Abs(angle-pos) <= f.cfg.Tolerance {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return fmt.Errorf("failed to verify servo angle: %w", err)
+			}
+			return fmt.Errorf("%w: channel %d at %.1f°, commanded %.1f°", ErrServoBlocked, f.servo.channel, pos, angle)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run опрашивает датчик до отмены контекста. Контроль приостанавливается на
+// время Settle после каждого изменения угла и пока импульс снят. Ошибки
+// чтения датчика журналируются и не прерывают работу.
+func (f *ServoFeedback) Run(ctx context.Context) error {
+	s := f.servo
+	s.pca.logger.Basic("ServoFeedback: контроль положения сервопривода на канале %d", s.channel)
+	ticker := time.NewTicker(f.cfg.Interval)
+	defer ticker.Stop()
+	target := s.Angle()
+	changed := time.Now()
+	var since time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		now := time.Now()
+		if a := s.Angle(); a != target {
+			target, changed, since = a, now, time.Time{}
+			f.setBlocked(false)
+		}
+		if _, _, off, _ := s.pca.GetChannelState(s.channel); off == 0 || now.Sub(changed) < f.cfg.Settle {
+			continue
+		}
+		pos, err := f.read(ctx)
+		if err != nil {
+			s.pca.logger.Error("ServoFeedback: ошибка чтения датчика положения: %v", err)
+			continue
+		}
+		diff := target - pos
+		if math.Abs(diff) <= f.cfg.Tolerance {
+			since = time.Time{}
+			f.setBlocked(false)
+			continue
+		}
+		if f.cfg.MaxCorrection > 0 {
+			f.correct(ctx, target, diff)
+		}
+		if since.IsZero() {
+			since = now
+		}
+		if now.Sub(since) >= f.cfg.Hold && !f.Blocked() {
+			f.block(fmt.Errorf("%w: channel %d at %.1f°, commanded %.1f°", ErrServoBlocked, s.channel, pos, target))
+		}
+	}
+}
+
+// read опрашивает датчик и запоминает положение.
+func (f *ServoFeedback) read(ctx context.Context) (float64, error) {
+	pos, err := f.sensor.Position(ctx)
+	if err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	f.position = pos
+	f.mu.Unlock()
+	return pos, nil
+}
+
+// correct смещает поправку угла на половину отклонения, не выходя за
+// MaxCorrection, и повторно выводит заданный угол.
+func (f *ServoFeedback) correct(ctx context.Context, target, diff float64) {
+	s := f.servo
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trim := math.Max(-f.cfg.MaxCorrection, math.Min(f.cfg.MaxCorrection, s.trim+diff/2))
+	if trim == s.trim || s.angle != target {
+		return
+	}
+	s.trim = trim
+	if err := s.drive(ctx, target); err != nil {
+		s.pca.logger.Error("ServoFeedback: не удалось применить поправку %.1f° на канале %d: %v", trim, s.channel, err)
+		return
+	}
+	s.pca.logger.Detailed("ServoFeedback: канал %d, поправка дрейфа %.1f°", s.channel, trim)
+}
+
+func (f *ServoFeedback) setBlocked(blocked bool) {
+	f.mu.Lock()
+	f.blocked = blocked
+	f.mu.Unlock()
+}
+
+// block отмечает блокировку, при необходимости снимает импульс и генерирует
+// событие EventServoBlocked.
+func (f *ServoFeedback) block(cause error) {
+	s := f.servo
+	f.setBlocked(true)
+	s.pca.logger.Error("Сервопривод на канале %d заблокирован: %v", s.channel, cause)
+	if f.cfg.StopOnBlock {
+		if err := s.Off(s.pca.ctx); err != nil {
+			s.pca.logger.Error("Не удалось снять импульс сервопривода на канале %d: %v", s.channel, err)
+		}
+	}
+	s.pca.emit(Event{Type: EventServoBlocked, Channel: s.channel, Err: cause})
+}
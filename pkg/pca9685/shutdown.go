@@ -0,0 +1,215 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Stopper – фоновый процесс (Sequencer, TrajectoryPlayer, Failsafe и т.п.),
+// который ShutdownAll останавливает до того, как начнёт гасить выходы.
+type Stopper interface {
+	Stop()
+}
+
+// shutdown – параметры ShutdownAll.
+type shutdown struct {
+	ramp time.Duration
+	fade []FadeOption
+}
+
+// ShutdownOption определяет опцию ShutdownAll.
+type ShutdownOption func(*shutdown)
+
+// WithShutdownRamp задаёт время плавной остановки насосов и регуляторов хода
+// (по умолчанию 2 секунды; 0 – мгновенная остановка). Разрешение задаётся
+// опциями fade.
+func WithShutdownRamp(d time.Duration, fade ...FadeOption) ShutdownOption {
+	return func(s *shutdown) {
+		if d >= 0 {
+			s.ramp = d
+			s.fade = fade
+		}
+	}
+}
+
+// AddStopper добавляет фоновые процессы, которые ShutdownAll останавливает
+// первыми (в обратном порядке добавления).
+func (r *Registry) AddStopper(stoppers ...Stopper) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stoppers = append(r.stoppers, stoppers...)
+}
+
+// AddController добавляет контроллеры, которые ShutdownAll закрывает в
+// порядке добавления. Контроллеры зарегистрированной периферии добавляются
+// автоматически после явно добавленных.
+func (r *Registry) AddController(pcas ...*PCA9685) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.controllers = append(r.controllers, pcas...)
+}
+
+// ShutdownAll выполняет упорядоченную остановку установки для штатного
+// завершения сервиса:
+//
+//  1. останавливает фоновые процессы, добавленные AddStopper;
+//  2. плавно останавливает насосы (Pump, BidirectionalPump) и регуляторы
+//     хода (ESC) – одновременно, за время WithShutdownRamp; насосы и ESC
+//     с профилем SetMotionProfile – по S-образной кривой;
+//  3. переводит сервоприводы в безопасные углы (SetFailsafeAngle);
+//  4. закрывает контроллеры по порядку: Close устанавливает безопасные
+//     значения каналов (SetChannelFailsafe) и закрывает адаптер;
+//  5. освобождает каналы всей периферии и очищает реестр.
+//
+// Ошибка одного шага не прерывает остановку; возвращаются все ошибки. При
+// отмене ctx плавная остановка заменяется мгновенной, а контроллеры всё
+// равно закрываются.
+func (r *Registry) ShutdownAll(ctx context.Context, opts ...ShutdownOption) error {
+	s := shutdown{ramp: 2 * time.Second}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	r.mu.RLock()
+	stoppers := append([]Stopper(nil), r.stoppers...)
+	controllers := append([]*PCA9685(nil), r.controllers...)
+	peripherals := make([]Peripheral, 0, len(r.items))
+	for _, name := range r.namesLocked() {
+		peripherals = append(peripherals, r.items[name])
+	}
+	r.mu.RUnlock()
+
+	for i := len(stoppers) - 1; i >= 0; i-- {
+		stoppers[i].Stop()
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	fail := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range peripherals {
+		pca := peripheralController(p)
+		if pca == nil {
+			continue
+		}
+		controllers = appendController(controllers, pca)
+		var from float64
+		var set func(ctx context.Context, v float64) error
+		var motion MotionProfile
+		switch p := p.(type) {
+		case *Pump:
+			from, _ = p.GetCurrentSpeed()
+			set = p.SetSpeed
+			motion = p.MotionProfile()
+		case *BidirectionalPump:
+			from = p.Speed()
+			set = p.SetSpeed
+		case *ESC:
+			from = p.Throttle()
+			set = p.SetThrottle
+			motion = p.MotionProfile()
+		default:
+			continue
+		}
+		// Нагрузка с профилем перемещений останавливается по S-образной кривой.
+		ease := EaseLinear
+		if motion.enabled() {
+			ease = EaseSCurve
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := rampDown(ctx, pca, s, from, ease, set); err != nil {
+				fail(fmt.Errorf("failed to stop %T: %w", p, err))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, p := range peripherals {
+		if servo, ok := p.(*Servo); ok {
+			if err := servo.park(ctx); err != nil {
+				fail(fmt.Errorf("failed to park servo on channel %d: %w", servo.channel, err))
+			}
+		}
+	}
+
+	for _, pca := range controllers {
+		pca.logger.Basic("ShutdownAll: закрытие контроллера")
+		if err := pca.Close(); err != nil {
+			fail(fmt.Errorf("failed to close controller: %w", err))
+		}
+	}
+	r.ReleaseAll()
+	r.mu.Lock()
+	r.stoppers, r.controllers = nil, nil
+	r.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// rampDown плавно снижает значение from до нуля за s.ramp со сглаживанием
+// ease. При отмене ctx значение сбрасывается в ноль сразу.
+func rampDown(ctx context.Context, pca *PCA9685, s shutdown, from float64, ease Easing, set func(context.Context, float64) error) error {
+	if from == 0 {
+		return nil
+	}
+	steps := pca.fadeConfig(s.fade).steps(s.ramp)
+	err := runFade(ctx, steps, s.ramp, func(step int) error {
+		return set(ctx, from*(1-ease.apply(float64(step)/float64(steps))))
+	})
+	if err != nil && ctx.Err() != nil {
+		return set(pca.ctx, 0)
+	}
+	return err
+}
+
+// park переводит сервопривод в безопасный угол, если он задан.
+func (s *Servo) park(ctx context.Context) error {
+	on, off, ok := s.pca.ChannelFailsafe(s.channel)
+	if !ok {
+		return nil
+	}
+	if ctx.Err() != nil {
+		ctx = s.pca.ctx
+	}
+	s.pca.logger.Basic("ShutdownAll: сервопривод на канале %d переводится в безопасное положение", s.channel)
+	return s.pca.SetPWM(ctx, s.channel, on, off)
+}
+
+// peripheralController возвращает контроллер периферии известного типа.
+func peripheralController(p Peripheral) *PCA9685 {
+	switch p := p.(type) {
+	case *Pump:
+		return p.pca
+	case *BidirectionalPump:
+		return p.pca
+	case *ESC:
+		return p.pca
+	case *Servo:
+		return p.pca
+	case *RGBLed:
+		return p.pca
+	case *GrowLight:
+		return p.pca
+	case *Segment:
+		return p.pca
+	}
+	return nil
+}
+
+func appendController(list []*PCA9685, pca *PCA9685) []*PCA9685 {
+	for _, c := range list {
+		if c == pca {
+			return list
+		}
+	}
+	return append(list, pca)
+}
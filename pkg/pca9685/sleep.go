@@ -0,0 +1,98 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// oscillatorStartup – время запуска осциллятора после выхода из SLEEP.
+const oscillatorStartup = 500 * time.Microsecond
+
+// IsSleeping сообщает, переведена ли микросхема в режим SLEEP автоматически.
+func (pca *PCA9685) IsSleeping() bool {
+	return pca.asleep.Load()
+}
+
+// updateActive отмечает, формирует ли канал (или все каналы при channel < 0)
+// ненулевой импульс, и управляет таймером автоматического сна.
+func (pca *PCA9685) updateActive(channel int, on, off uint16) {
+	if pca.sleepTimer == nil {
+		return
+	}
+	active := pulseTicks(on, off) > 0
+	var mask uint32
+	for {
+		old := pca.activeMask.Load()
+		switch {
+		case channel < 0 && active:
+			mask = 0xFFFF
+		case channel < 0:
+			mask = 0
+		case active:
+			mask = old | 1<<channel
+		default:
+			mask = old &^ (1 << channel)
+		}
+		if pca.activeMask.CompareAndSwap(old, mask) {
+			break
+		}
+	}
+	if mask == 0 {
+		pca.sleepTimer.Reset(pca.autoSleep)
+	} else {
+		pca.sleepTimer.Stop()
+	}
+}
+
+// wakeFor выводит микросхему из сна перед записью ненулевого значения.
+func (pca *PCA9685) wakeFor(ctx context.Context, on, off uint16) error {
+	if !pca.asleep.Load() || pulseTicks(on, off) == 0 {
+		return nil
+	}
+	pca.modeMu.Lock()
+	defer pca.modeMu.Unlock()
+	if !pca.asleep.Load() {
+		return nil
+	}
+
+	pca.logger.Detailed("Выход из автоматического сна")
+	mode1, err := pca.readMode1()
+	if err != nil {
+		return err
+	}
+	if err := pca.writeReg(ctx, "Wake", -1, RegMode1, []byte{mode1 &^ (Mode1Sleep | Mode1Restart)}); err != nil {
+		pca.logger.Error("Не удалось выйти из режима сна: %v", err)
+		return fmt.Errorf("failed to wake up: %w", err)
+	}
+	time.Sleep(oscillatorStartup)
+	if mode1&Mode1Restart != 0 {
+		if err := pca.writeReg(ctx, "Wake", -1, RegMode1, []byte{mode1&^Mode1Sleep | Mode1Restart}); err != nil {
+			pca.logger.Error("Не удалось перезапустить PWM: %v", err)
+			return fmt.Errorf("failed to restart PWM: %w", err)
+		}
+	}
+	pca.asleep.Store(false)
+	pca.emit(Event{Type: EventWake})
+	return nil
+}
+
+// autoSleepNow переводит микросхему в сон, если все выходы по-прежнему выключены.
+func (pca *PCA9685) autoSleepNow() {
+	pca.modeMu.Lock()
+	defer pca.modeMu.Unlock()
+	if pca.activeMask.Load() != 0 || pca.asleep.Load() || pca.ctx.Err() != nil {
+		return
+	}
+	mode1, err := pca.readMode1()
+	if err != nil {
+		return
+	}
+	if err := pca.writeReg(pca.ctx, "AutoSleep", -1, RegMode1, []byte{mode1&^Mode1Restart | Mode1Sleep}); err != nil {
+		pca.logger.Error("Не удалось перейти в режим сна: %v", err)
+		return
+	}
+	pca.asleep.Store(true)
+	pca.logger.Basic("Все выходы выключены %v, микросхема переведена в режим сна", pca.autoSleep)
+	pca.emit(Event{Type: EventSleep})
+}
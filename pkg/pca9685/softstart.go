@@ -0,0 +1,81 @@
+package pca9685
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultStartInterval – пауза между включением каналов при плавном старте.
+const defaultStartInterval = 100 * time.Millisecond
+
+// softStart – параметры плавного старта.
+type softStart struct {
+	interval time.Duration
+	ramp     time.Duration
+	fade     []FadeOption
+}
+
+// SoftStartOption определяет опцию плавного старта.
+type SoftStartOption func(*softStart)
+
+// WithStartInterval задаёт паузу между включением соседних каналов
+// (по умолчанию 100 мс).
+func WithStartInterval(d time.Duration) SoftStartOption {
+	return func(s *softStart) {
+		if d >= 0 {
+			s.interval = d
+		}
+	}
+}
+
+// WithStartRamp включает плавное нарастание каждого канала от нуля до
+// начального значения за d. Разрешение нарастания задаётся опциями fade.
+func WithStartRamp(d time.Duration, fade ...FadeOption) SoftStartOption {
+	return func(s *softStart) {
+		if d >= 0 {
+			s.ramp = d
+			s.fade = fade
+		}
+	}
+}
+
+// SoftStart поочерёдно выводит каналы на начальные значения в порядке values,
+// чтобы избежать броска тока при одновременном включении всех нагрузок. Между
+// каналами выдерживается пауза WithStartInterval; с WithStartRamp каждый канал
+// нарастает плавно. При отмене контекста уже включённые каналы сохраняют свои
+// значения.
+func (pca *PCA9685) SoftStart(ctx context.Context, values []PWMValue, opts ...SoftStartOption) error {
+	s := softStart{interval: defaultStartInterval}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	pca.logger.Basic("SoftStart: включение %d каналов с интервалом %v", len(values), s.interval)
+	for _, v := range values {
+		if err := pca.validateChannel(v.Channel); err != nil {
+			pca.logger.Error("SoftStart: неверный номер канала %d: %v", v.Channel, err)
+			return err
+		}
+	}
+
+	steps := pca.fadeConfig(s.fade).steps(s.ramp)
+	for i, v := range values {
+		if i > 0 && s.interval > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.interval):
+			}
+		}
+		spec := FadeSpec{End: v.Off}
+		err := runFade(ctx, steps, s.ramp, func(step int) error {
+			return pca.SetPWM(ctx, v.Channel, v.On, spec.at(step, steps))
+		})
+		if err != nil {
+			pca.logger.Error("SoftStart: ошибка включения канала %d: %v", v.Channel, err)
+			return fmt.Errorf("failed to start channel %d: %w", v.Channel, err)
+		}
+	}
+	pca.logger.Basic("SoftStart: все каналы включены")
+	return nil
+}
@@ -0,0 +1,100 @@
+package pca9685
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// SolarEvent – астрономическое событие, используемое для расписаний.
+type SolarEvent int
+
+const (
+	CivilDawn SolarEvent = iota // Начало гражданских сумерек (Солнце на 6° ниже горизонта)
+	Sunrise                     // Восход
+	SolarNoon                   // Истинный полдень
+	Sunset                      // Заход
+	CivilDusk                   // Конец гражданских сумерек
+)
+
+func (e SolarEvent) String() string {
+	switch e {
+	case CivilDawn:
+		return "civil dawn"
+	case Sunrise:
+		return "sunrise"
+	case SolarNoon:
+		return "solar noon"
+	case Sunset:
+		return "sunset"
+	case CivilDusk:
+		return "civil dusk"
+	default:
+		return fmt.Sprintf("SolarEvent(%d)", int(e))
+	}
+}
+
+// ErrNoSolarEvent возвращается, когда событие не наступает в указанный день
+// (полярный день или полярная ночь).
+var ErrNoSolarEvent = errors.New("solar event does not occur on this date")
+
+// SolarTime вычисляет время события event для даты date (в её часовом поясе)
+// и координат lat/lon в градусах (северная широта и восточная долгота положительны).
+// Точность – несколько минут, чего достаточно для управления освещением.
+func SolarTime(event SolarEvent, date time.Time, lat, lon float64) (time.Time, error) {
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return time.Time{}, fmt.Errorf("invalid coordinates: %v, %v", lat, lon)
+	}
+
+	const (
+		deg      = math.Pi / 180
+		j2000    = 2451545.0
+		unixJD   = 2440587.5
+		tilt     = 23.4397 * deg
+		secInDay = 86400
+	)
+
+	// Номер дня относительно J2000 для местного полудня указанной даты.
+	y, m, d := date.Date()
+	noon := time.Date(y, m, d, 12, 0, 0, 0, date.Location())
+	jd := float64(noon.Unix())/secInDay + unixJD
+	n := math.Round(jd - j2000 + lon/360)
+
+	meanSolarNoon := n - lon/360
+	M := math.Mod(357.5291+0.98560028*meanSolarNoon, 360) * deg
+	C := 1.9148*math.Sin(M) + 0.0200*math.Sin(2*M) + 0.0003*math.Sin(3*M)
+	lambda := math.Mod(M/deg+C+180+102.9372, 360) * deg
+	transit := j2000 + meanSolarNoon + 0.0053*math.Sin(M) - 0.0069*math.Sin(2*lambda)
+
+	toTime := func(julian float64) time.Time {
+		sec := (julian - unixJD) * secInDay
+		return time.Unix(0, int64(sec*float64(time.Second))).In(date.Location()).Round(time.Second)
+	}
+
+	var altitude float64
+	switch event {
+	case SolarNoon:
+		return toTime(transit), nil
+	case Sunrise, Sunset:
+		altitude = -0.833 * deg
+	case CivilDawn, CivilDusk:
+		altitude = -6 * deg
+	default:
+		return time.Time{}, fmt.Errorf("unknown solar event: %v", event)
+	}
+
+	sinDecl := math.Sin(lambda) * math.Sin(tilt)
+	cosDecl := math.Cos(math.Asin(sinDecl))
+	phi := lat * deg
+	cosHour := (math.Sin(altitude) - math.Sin(phi)*sinDecl) / (math.Cos(phi) * cosDecl)
+	if cosHour < -1 || cosHour > 1 {
+		return time.Time{}, ErrNoSolarEvent
+	}
+	hour := math.Acos(cosHour) / deg / 360
+
+	if event == Sunrise || event == CivilDawn {
+		return toTime(transit - hour), nil
+	}
+	return toTime(transit + hour), nil
+}
@@ -0,0 +1,121 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStall передаётся в событии EventStall: ток нагрузки долго находился вне
+// допустимого диапазона (заклинивание или сухой ход).
+var ErrStall = errors.New("load current out of range")
+
+// CurrentSensor – необязательный датчик тока нагрузки (например, INA219),
+// используемый для обнаружения остановки и сухого хода.
+type CurrentSensor interface {
+	// Current возвращает ток нагрузки в амперах.
+	Current(ctx context.Context) (float64, error)
+}
+
+// StallConfig задаёт допустимый диапазон тока работающей нагрузки.
+type StallConfig struct {
+	Min      float64       // Ток ниже Min – сухой ход или обрыв, А
+	Max      float64       // Ток выше Max – заклинивание, А
+	Hold     time.Duration // Сколько ток должен быть вне диапазона до срабатывания
+	Interval time.Duration // Период опроса датчика (по умолчанию 200 мс)
+}
+
+// StallDetector опрашивает датчик тока, пока нагрузка работает, и
+// останавливает её, если ток дольше Hold находится вне диапазона.
+type StallDetector struct {
+	pca     *PCA9685
+	channel int
+	sensor  CurrentSensor
+	cfg     StallConfig
+	active  func() bool
+	stop    func(cause error)
+}
+
+// newStallDetector проверяет конфигурацию и создаёт детектор.
+func newStallDetector(pca *PCA9685, channel int, sensor CurrentSensor, cfg StallConfig, active func() bool, stop func(cause error)) (*StallDetector, error) {
+	if sensor == nil {
+		return nil, fmt.Errorf("current sensor is required")
+	}
+	if cfg.Min < 0 || cfg.Max <= cfg.Min {
+		return nil, fmt.Errorf("invalid current band: min %g, max %g", cfg.Min, cfg.Max)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 200 * time.Millisecond
+	}
+	return &StallDetector{pca: pca, channel: channel, sensor: sensor, cfg: cfg, active: active, stop: stop}, nil
+}
+
+// StallDetector создаёт детектор остановки и сухого хода насоса. При
+// срабатывании насос останавливается защитой (см. ResetCutoff) и
+// генерируется событие EventStall. Детектор работает в Run.
+func (p *Pump) StallDetector(sensor CurrentSensor, cfg StallConfig) (*StallDetector, error) {
+	return newStallDetector(p.pca, p.channel, sensor, cfg,
+		func() bool {
+			p.rmu.Lock()
+			defer p.rmu.Unlock()
+			return p.running
+		},
+		func(cause error) {
+			if p.trip(EventStall, cause) {
+				p.pca.logger.Error("Насос на канале %d остановлен: %v", p.channel, cause)
+			}
+		})
+}
+
+// StallDetector создаёт детектор остановки двигателя. При срабатывании газ
+// сбрасывается в ноль и генерируется событие EventStall.
+func (e *ESC) StallDetector(sensor CurrentSensor, cfg StallConfig) (*StallDetector, error) {
+	return newStallDetector(e.pca, e.channel, sensor, cfg,
+		func() bool { return e.Throttle() > 0 },
+		func(cause error) {
+			err := e.SetThrottle(e.pca.ctx, 0)
+			if err != nil {
+				e.pca.logger.Error("Не удалось остановить двигатель на канале %d: %v", e.channel, err)
+			}
+			e.pca.logger.Error("Двигатель на канале %d остановлен: %v", e.channel, cause)
+			e.pca.emit(Event{Type: EventStall, Channel: e.channel, Err: cause})
+		})
+}
+
+// Run опрашивает датчик до отмены контекста. Ошибки чтения датчика
+// журналируются и не прерывают работу.
+func (d *StallDetector) Run(ctx context.Context) error {
+	d.pca.logger.Basic("StallDetector: контроль тока на канале %d", d.channel)
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+	var since time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if !d.active() {
+			since = time.Time{}
+			continue
+		}
+		current, err := d.sensor.Current(ctx)
+		if err != nil {
+			d.pca.logger.Error("StallDetector: ошибка чтения датчика тока: %v", err)
+			continue
+		}
+		if current >= d.cfg.Min && current <= d.cfg.Max {
+			since = time.Time{}
+			continue
+		}
+		now := time.Now()
+		if since.IsZero() {
+			since = now
+		}
+		if now.Sub(since) >= d.cfg.Hold {
+			d.stop(fmt.Errorf("%w: %.3f A outside %.3f..%.3f A", ErrStall, current, d.cfg.Min, d.cfg.Max))
+			since = time.Time{}
+		}
+	}
+}
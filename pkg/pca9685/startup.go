@@ -0,0 +1,248 @@
+package pca9685
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// StartupState определяет, в каком состоянии New оставляет выходы
+// (Config.StartupState).
+type StartupState int
+
+const (
+	// StartupReset – сброс микросхемы и настройка частоты без записи каналов
+	// (по умолчанию). На время сброса выходы выключаются, после него
+	// микросхема выводит прежние значения регистров, а кэш каналов нулевой.
+	StartupReset StartupState = iota
+	// StartupAllOff – после сброса все каналы выключаются.
+	StartupAllOff
+	// StartupRestore – после сброса каналы получают значения снимка
+	// Config.SnapshotFile (см. SaveSnapshot); без снимка каналы выключаются.
+	StartupRestore
+	// StartupApplyScene – после сброса все каналы выключаются и применяется
+	// сцена Config.StartupScene, в том числе с временем перехода.
+	StartupApplyScene
+	// StartupKeep – микросхема не сбрасывается и не перенастраивается:
+	// частота, MODE2 и значения каналов читаются из регистров в кэш, и
+	// выходы, оставленные работать при перезапуске службы, не прерываются.
+	// Если микросхема не была настроена (после включения питания), она
+	// инициализируется как при StartupReset.
+	StartupKeep
+)
+
+func (s StartupState) String() string {
+	switch s {
+	case StartupReset:
+		return "reset"
+	case StartupAllOff:
+		return "all-off"
+	case StartupRestore:
+		return "restore"
+	case StartupApplyScene:
+		return "scene"
+	case StartupKeep:
+		return "keep"
+	default:
+		return fmt.Sprintf("StartupState(%d)", int(s))
+	}
+}
+
+// snapshotScene – имя сцены в файле снимка.
+const snapshotScene = "snapshot"
+
+// SaveSnapshot атомарно сохраняет значения включённых каналов (как
+// CaptureScene) в файл Config.SnapshotFile, из которого их восстанавливает
+// StartupRestore. Close сохраняет снимок автоматически; чтобы снимок
+// переживал аварийное завершение, вызывайте SaveSnapshot периодически или
+// после значимых изменений.
+func (pca *PCA9685) SaveSnapshot() error {
+	if pca.snapshotFile == "" {
+		return fmt.Errorf("snapshot file is not configured")
+	}
+	scene, err := pca.CaptureScene(snapshotScene)
+	if err != nil {
+		return err
+	}
+	if err := saveScene(pca.snapshotFile, scene); err != nil {
+		pca.logger.Error("SaveSnapshot: %v", err)
+		return err
+	}
+	pca.logger.Detailed("SaveSnapshot: снимок каналов сохранён в %s", pca.snapshotFile)
+	return nil
+}
+
+// saveScene атомарно записывает сцену в файл path.
+func saveScene(path string, scene Scene) error {
+	data, err := json.MarshalIndent(scene, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic записывает data во временный файл рядом с path и
+// переименовывает его, чтобы при сбое файл не остался записанным частично.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadSnapshot читает снимок каналов. Отсутствие файла ошибкой не считается.
+func loadSnapshot(path string) (*Scene, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	var scene Scene
+	if err := json.Unmarshal(data, &scene); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+	return &scene, nil
+}
+
+// checkStartup проверяет параметры начального состояния до обращения к
+// микросхеме.
+func checkStartup(config *Config) error {
+	switch config.StartupState {
+	case StartupReset, StartupAllOff, StartupKeep:
+	case StartupRestore:
+		if config.SnapshotFile == "" {
+			return fmt.Errorf("startup state %v requires SnapshotFile", config.StartupState)
+		}
+	case StartupApplyScene:
+		if config.StartupScene == nil {
+			return fmt.Errorf("startup state %v requires StartupScene", config.StartupState)
+		}
+	default:
+		return fmt.Errorf("unknown startup state: %v", config.StartupState)
+	}
+	return nil
+}
+
+// applyStartup приводит каналы к начальному состоянию после инициализации.
+func (pca *PCA9685) applyStartup(ctx context.Context, config *Config, kept bool) error {
+	if kept {
+		for i := range pca.channels {
+			_, on, off := pca.channels[i].snapshot()
+			pca.updateActive(i, on, off)
+		}
+		return nil
+	}
+	var scene *Scene
+	switch config.StartupState {
+	case StartupReset, StartupKeep:
+		return nil
+	case StartupRestore:
+		var err error
+		if scene, err = loadSnapshot(config.SnapshotFile); err != nil {
+			return err
+		}
+		if scene == nil {
+			pca.logger.Basic("Снимок каналов %s не найден, каналы выключаются", config.SnapshotFile)
+		}
+	case StartupApplyScene:
+		scene = config.StartupScene
+	}
+
+	pca.mu.Lock()
+	err := pca.setAllLocked(ctx, "New", 0, 0)
+	pca.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to switch channels off: %w", err)
+	}
+	if scene == nil {
+		return nil
+	}
+	pca.logger.Basic("Начальное состояние: сцена %q", scene.Name)
+	if err := pca.ApplyScene(ctx, *scene); err != nil {
+		return fmt.Errorf("failed to apply startup scene %q: %w", scene.Name, err)
+	}
+	return nil
+}
+
+// adopt читает состояние настроенной ранее микросхемы в кэш вместо сброса
+// (StartupKeep). Возвращает false, если микросхема не настроена и её нужно
+// инициализировать.
+func (pca *PCA9685) adopt(ctx context.Context) (bool, error) {
+	var regs [256]byte
+	if pca.chip == ChipPCA9635 {
+		data := regs[:RegPCA9635AllCall+1]
+		if err := pca.readReg(ctx, "New", -1, pca9635AutoInc|RegMode1, data); err != nil {
+			return false, fmt.Errorf("failed to read registers: %w", err)
+		}
+		for _, b := range regs[RegPCA9635LEDOut0 : RegPCA9635LEDOut0+4] {
+			if b != pca9635LEDOutPWM {
+				return false, nil
+			}
+		}
+	} else {
+		if err := pca.readReg(ctx, "New", -1, RegMode1, regs[:RegLed0+4*16]); err != nil {
+			return false, fmt.Errorf("failed to read registers: %w", err)
+		}
+		// Бит AI регистра MODE1 устанавливает только драйвер (см. probe).
+		if regs[RegMode1]&Mode1AutoInc == 0 {
+			return false, nil
+		}
+		if err := pca.readReg(ctx, "New", -1, RegPrescale, regs[RegPrescale:RegPrescale+1]); err != nil {
+			return false, fmt.Errorf("failed to read prescale: %w", err)
+		}
+	}
+
+	freq := pca.chip.fixedFrequency()
+	if freq == 0 {
+		freq = float64(OscClock) / (PwmResolution * (float64(regs[RegPrescale]) + 1))
+	}
+	pca.Freq = freq
+	pca.freq.Store(math.Float64bits(freq))
+	mode2 := regs[RegMode2]
+	pca.mode2.Store(uint32(mode2))
+	pca.inverted.Store(mode2&Mode2Invrt != 0)
+	pca.asleep.Store(regs[RegMode1]&Mode1Sleep != 0)
+
+	for i := range pca.channels {
+		var on, off uint16
+		if pca.chip == ChipPCA9635 {
+			off = uint16(math.Round(float64(regs[RegPCA9635PWM0+i]) * (PwmResolution - 1) / 255))
+		} else {
+			on, off = channelRegisters(pca.chip, &regs, i)
+			on, off = adoptTicks(on), adoptTicks(off)
+		}
+		ch := &pca.channels[i]
+		ch.mu.Lock()
+		ch.on, ch.off = on, off
+		ch.publish()
+		ch.mu.Unlock()
+	}
+	pca.logger.Basic("Состояние микросхемы сохранено: частота %.1f Гц, MODE2 0x%X", freq, mode2)
+	return true, nil
+}
+
+// adoptTicks приводит значение регистров канала к допустимому значению
+// on/off: бит FULL_ON/FULL_OFF сохраняется без младших битов.
+func adoptTicks(v uint16) uint16 {
+	if v&FullOn != 0 {
+		return FullOn
+	}
+	return v & (PwmResolution - 1)
+}
@@ -0,0 +1,130 @@
+package pca9685
+
+import (
+	"math"
+	"time"
+)
+
+// ChannelState – состояние одного канала.
+type ChannelState struct {
+	Channel     int
+	Enabled     bool
+	On, Off     uint16
+	Duty        float64       // Коэффициент заполнения, %
+	PulseWidth  time.Duration // Длительность импульса при текущей частоте
+	Inverted    bool          // Включена инверсия выходной логики (MODE2.INVRT)
+	Label       string        // Метка канала, заданная SetChannelLabel
+	Load        float64       // Мощность нагрузки при скважности 100%, Вт (SetChannelLoad)
+	Power       float64       // Текущая мощность нагрузки, Вт (см. Energy)
+	Energy      float64       // Энергия с начала учёта, Вт·ч
+	Maintenance []string      // Работы обслуживания периферии канала, срок которых наступил
+	Source      string        // Источник действующего значения при арбитраже (SetSourcePriority)
+}
+
+// pulseTicks возвращает длительность импульса в тиках (от 0 до 4096) с учётом
+// флагов «полностью включён» и «полностью выключен».
+func pulseTicks(on, off uint16) int {
+	switch {
+	case off&0x1000 != 0:
+		return 0
+	case on&0x1000 != 0:
+		return PwmResolution
+	default:
+		return (int(off&0x0FFF) - int(on&0x0FFF) + PwmResolution) % PwmResolution
+	}
+}
+
+// SetChannelLabel задаёт произвольную метку канала (например, «насос CO2»).
+func (pca *PCA9685) SetChannelLabel(channel int, label string) error {
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("SetChannelLabel: неверный номер канала %d: %v", channel, err)
+		return err
+	}
+	pca.channels[channel].label.Store(label)
+	return nil
+}
+
+// GetChannel возвращает состояние канала.
+func (pca *PCA9685) GetChannel(channel int) (ChannelState, error) {
+	if err := pca.validateChannel(channel); err != nil {
+		pca.logger.Error("GetChannel: неверный номер канала %d: %v", channel, err)
+		return ChannelState{}, err
+	}
+	return pca.channelState(channel, pca.frequency()), nil
+}
+
+// GetAllChannelStates возвращает состояние всех 16 каналов.
+func (pca *PCA9685) GetAllChannelStates() []ChannelState {
+	freq := pca.frequency()
+	states := make([]ChannelState, len(pca.channels))
+	for i := range pca.channels {
+		states[i] = pca.channelState(i, freq)
+	}
+	return states
+}
+
+// EnabledChannels возвращает номера включённых каналов.
+func (pca *PCA9685) EnabledChannels() []int {
+	var enabled []int
+	for i := range pca.channels {
+		if on, _, _ := pca.channels[i].snapshot(); on {
+			enabled = append(enabled, i)
+		}
+	}
+	return enabled
+}
+
+// Чтение состояния не захватывает мьютексы: запись канала держит мьютекс
+// на время транзакции I2C, и частый опрос состояния (телеметрия) иначе
+// конкурировал бы с управляющими записями. Каждый канал после изменения
+// кэша публикует его атомарную копию, частота и флаг инверсии также
+// хранятся в атомарных полях. Мощность и энергия берутся из учёта DutyStats,
+// мьютекс которого не удерживается во время транзакций.
+
+// publish обновляет атомарную копию состояния канала. Вызывается после
+// каждого изменения enabled/on/off.
+func (ch *Channel) publish() {
+	v := uint64(ch.on)<<16 | uint64(ch.off)
+	if ch.enabled {
+		v |= 1 << 32
+	}
+	ch.snap.Store(v)
+}
+
+// snapshot возвращает последнюю опубликованную копию состояния канала.
+func (ch *Channel) snapshot() (enabled bool, on, off uint16) {
+	v := ch.snap.Load()
+	return v&(1<<32) != 0, uint16(v >> 16), uint16(v)
+}
+
+// frequency возвращает текущую частоту PWM без захвата pca.mu.
+func (pca *PCA9685) frequency() float64 {
+	return math.Float64frombits(pca.freq.Load())
+}
+
+func (pca *PCA9685) channelState(channel int, freq float64) ChannelState {
+	ch := &pca.channels[channel]
+	enabled, on, off := ch.snapshot()
+	label, _ := ch.label.Load().(string)
+
+	ticks := pulseTicks(on, off)
+	state := ChannelState{
+		Channel:  channel,
+		Enabled:  enabled,
+		On:       on,
+		Off:      off,
+		Duty:     float64(ticks) * 100 / PwmResolution,
+		Inverted: pca.inverted.Load(),
+		Label:    label,
+		Source:   pca.arb.holder(channel),
+	}
+	if freq > 0 {
+		state.PulseWidth = time.Duration(float64(ticks) / PwmResolution / freq * float64(time.Second))
+	}
+	if pca.duty != nil {
+		now := time.Now()
+		state.Load, state.Power, state.Energy = pca.duty.energy(channel, now)
+		state.Maintenance = pca.duty.dueFor(channel, now)
+	}
+	return state
+}
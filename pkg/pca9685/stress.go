@@ -0,0 +1,133 @@
+package pca9685
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// maxViolations – сколько нарушений инвариантов сохраняет эмулятор.
+const maxViolations = 100
+
+// stressState – состояние режима стресс-тестирования TestI2C.
+type stressState struct {
+	maxJitter time.Duration
+
+	mu         sync.Mutex
+	rnd        *rand.Rand
+	seq        uint64 // номер последней транзакции, менявшей указатель регистра
+	violations []error
+	total      int
+}
+
+// EnableStress включает режим стресс-тестирования эмулятора. Перед каждой
+// транзакцией выдерживается случайная пауза до maxJitter (при нуле –
+// уступка планировщику), что перемешивает порядок конкурентных операций,
+// а эмулятор проверяет инварианты, которые драйвер обязан соблюдать:
+//
+//   - запись в регистры LEDn и ALL_LED – целыми каналами по 4 байта с
+//     выровненного адреса;
+//   - PRESCALE записывается только в режиме SLEEP;
+//   - указатель регистра, установленный ReadReg, не перезаписывается другой
+//     транзакцией до чтения данных (ReadReg эмулируется как две отдельные
+//     транзакции, WriteRead – как одна комбинированная).
+//
+// Нарушения возвращает CheckInvariants. Режим включается до начала работы с
+// эмулятором; seed делает последовательность пауз воспроизводимой.
+func (t *TestI2C) EnableStress(maxJitter time.Duration, seed int64) {
+	t.mu.Lock()
+	t.stress = &stressState{maxJitter: maxJitter, rnd: rand.New(rand.NewSource(seed))}
+	t.mu.Unlock()
+}
+
+// CheckInvariants возвращает ошибку с первым нарушением инвариантов и их
+// общим числом или nil, если нарушений не было (или стресс-режим выключен).
+func (t *TestI2C) CheckInvariants() error {
+	s := t.stressState()
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch s.total {
+	case 0:
+		return nil
+	case 1:
+		return s.violations[0]
+	}
+	return fmt.Errorf("%d invariant violations, first: %w", s.total, s.violations[0])
+}
+
+func (t *TestI2C) stressState() *stressState {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.stress
+}
+
+// jitter выдерживает случайную паузу перед транзакцией.
+func (s *stressState) jitter() {
+	if s == nil {
+		return
+	}
+	if s.maxJitter <= 0 {
+		runtime.Gosched()
+		return
+	}
+	s.mu.Lock()
+	d := time.Duration(s.rnd.Int63n(int64(s.maxJitter)))
+	s.mu.Unlock()
+	time.Sleep(d)
+}
+
+// setPointer отмечает транзакцию, устанавливающую указатель регистра, и
+// возвращает её номер.
+func (s *stressState) setPointer() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	return s.seq
+}
+
+// checkPointer фиксирует нарушение, если после транзакции seq указатель
+// регистра был перезаписан.
+func (s *stressState) checkPointer(seq uint64, reg uint8) {
+	s.mu.Lock()
+	interleaved := s.seq != seq
+	s.mu.Unlock()
+	if interleaved {
+		s.violate(fmt.Errorf("register pointer 0x%02X overwritten between pointer write and read", reg))
+	}
+}
+
+// checkWrite проверяет инварианты записи. mode1 – текущее значение MODE1.
+// Вызывается с захваченным t.mu.
+func (s *stressState) checkWrite(mode1, reg uint8, data []byte) {
+	s.setPointer()
+	end := int(reg) + len(data)
+	switch {
+	case reg >= RegLed0 && reg < RegLed0+4*16:
+		if (reg-RegLed0)%4 != 0 || len(data)%4 != 0 || end > RegLed0+4*16 {
+			s.violate(fmt.Errorf("unaligned LED write: register 0x%02X, %d bytes", reg, len(data)))
+		}
+	case reg >= RegAllLed && reg < RegPrescale:
+		if (reg != RegAllLed || len(data) != 4) && (reg != RegAllLedOffH || len(data) != 1) {
+			s.violate(fmt.Errorf("unaligned ALL_LED write: register 0x%02X, %d bytes", reg, len(data)))
+		}
+	case reg < RegLed0 && end > RegLed0:
+		s.violate(fmt.Errorf("write to register 0x%02X spills into LED registers", reg))
+	}
+	if reg <= RegPrescale && end > RegPrescale && mode1&Mode1Sleep == 0 {
+		s.violate(fmt.Errorf("PRESCALE written while not in SLEEP (MODE1=0x%02X)", mode1))
+	}
+}
+
+func (s *stressState) violate(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total++
+	if len(s.violations) < maxViolations {
+		s.violations = append(s.violations, err)
+	}
+}
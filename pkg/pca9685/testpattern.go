@@ -0,0 +1,242 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// TestPattern – испытательный шаблон каналов для пусконаладки с
+// осциллографом или логическим анализатором.
+type TestPattern int
+
+const (
+	// PatternRamp – скважность растёт с номером канала: канал i имеет
+	// скважность (i+1)/16, канал 15 включён полностью. С каждым шагом шаблон
+	// сдвигается на канал.
+	PatternRamp TestPattern = iota
+	// PatternAlternating – чётные каналы включены полностью, нечётные
+	// выключены; каждый шаг меняет их местами.
+	PatternAlternating
+	// PatternCheckerboard – каналы как поле 4×4 (канал i – строка i/4,
+	// столбец i%4) включены в шахматном порядке; каждый шаг инвертирует поле.
+	PatternCheckerboard
+)
+
+func (p TestPattern) String() string {
+	switch p {
+	case PatternRamp:
+		return "ramp"
+	case PatternAlternating:
+		return "alternating"
+	case PatternCheckerboard:
+		return "checkerboard"
+	default:
+		return fmt.Sprintf("TestPattern(%d)", int(p))
+	}
+}
+
+// ParseTestPattern возвращает шаблон по имени (ramp, alternating,
+// checkerboard).
+func ParseTestPattern(name string) (TestPattern, error) {
+	for p := PatternRamp; p <= PatternCheckerboard; p++ {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown test pattern %q", name)
+}
+
+// Frame возвращает значения всех 16 каналов на шаге step.
+func (p TestPattern) Frame(step int) ([]PWMValue, error) {
+	if p < PatternRamp || p > PatternCheckerboard {
+		return nil, fmt.Errorf("unknown test pattern: %v", p)
+	}
+	step = (step%16 + 16) % 16
+	values := make([]PWMValue, 16)
+	for i := range values {
+		values[i].Channel = i
+		var lit bool
+		switch p {
+		case PatternRamp:
+			level := (i+step)%16 + 1
+			if level < 16 {
+				values[i].Off = uint16(level * PwmResolution / 16)
+				continue
+			}
+			lit = true
+		case PatternAlternating:
+			lit = (i+step)%2 == 0
+		case PatternCheckerboard:
+			lit = (i/4+i%4+step)%2 == 0
+		}
+		if lit {
+			values[i].On = 0x1000 // FULL_ON
+		}
+	}
+	return values, nil
+}
+
+// ShowTestPattern выводит шаг step шаблона pattern на все каналы.
+func (pca *PCA9685) ShowTestPattern(ctx context.Context, pattern TestPattern, step int) error {
+	values, err := pattern.Frame(step)
+	if err != nil {
+		pca.logger.Error("ShowTestPattern: %v", err)
+		return err
+	}
+	pca.logger.Detailed("ShowTestPattern: шаблон %v, шаг %d", pattern, step)
+	return pca.SetMultiPWMValues(ctx, values)
+}
+
+// RunTestPattern выводит шаги шаблона pattern с периодом period: steps шагов
+// или, при steps <= 0, до отмены ctx. По завершении (в том числе при отмене
+// ctx) каналы возвращаются к значениям, которые были до запуска, а отмена не
+// считается ошибкой.
+func (pca *PCA9685) RunTestPattern(ctx context.Context, pattern TestPattern, period time.Duration, steps int) error {
+	if period <= 0 {
+		return fmt.Errorf("test pattern period must be positive")
+	}
+	if _, err := pattern.Frame(0); err != nil {
+		pca.logger.Error("RunTestPattern: %v", err)
+		return err
+	}
+	pca.logger.Basic("RunTestPattern: шаблон %v, период %v", pattern, period)
+	saved := pca.cachedValues()
+
+	qctx := pca.quiet(ctx)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	var err error
+	for step := 0; steps <= 0 || step < steps; step++ {
+		if err = pca.ShowTestPattern(qctx, pattern, step); err != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+			continue
+		}
+		break
+	}
+	if err != nil && ctx.Err() != nil {
+		err = nil
+	}
+	if rerr := pca.SetMultiPWMValues(pca.quiet(pca.ctx), saved); rerr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to restore channels: %w", rerr))
+	}
+	pca.record(ctx, JournalEntry{Op: "RunTestPattern", Channel: -1, Value: float64(pattern)}, err)
+	return err
+}
+
+// cachedValues возвращает значения всех каналов из кэша.
+func (pca *PCA9685) cachedValues() []PWMValue {
+	values := make([]PWMValue, len(pca.channels))
+	for i := range pca.channels {
+		_, on, off := pca.channels[i].snapshot()
+		values[i] = PWMValue{Channel: i, On: on, Off: off}
+	}
+	return values
+}
+
+// sweep – параметры SweepFrequency.
+type sweep struct {
+	steps int
+	dwell time.Duration
+	log   bool
+	each  func(freq float64)
+}
+
+// SweepOption определяет опцию SweepFrequency.
+type SweepOption func(*sweep)
+
+// WithSweepSteps задаёт число шагов между начальной и конечной частотой
+// (по умолчанию 10).
+func WithSweepSteps(n int) SweepOption {
+	return func(s *sweep) {
+		if n > 0 {
+			s.steps = n
+		}
+	}
+}
+
+// WithSweepDwell задаёт время на каждой частоте (по умолчанию 1 секунда).
+func WithSweepDwell(d time.Duration) SweepOption {
+	return func(s *sweep) {
+		if d >= 0 {
+			s.dwell = d
+		}
+	}
+}
+
+// WithSweepLog включает логарифмический шаг частоты: каждая следующая
+// частота больше предыдущей в одно и то же число раз.
+func WithSweepLog() SweepOption {
+	return func(s *sweep) {
+		s.log = true
+	}
+}
+
+// WithSweepCallback задаёт функцию, вызываемую после установки каждой
+// частоты, например для снятия показаний прибора.
+func WithSweepCallback(fn func(freq float64)) SweepOption {
+	return func(s *sweep) {
+		s.each = fn
+	}
+}
+
+// SweepFrequency проходит частоты PWM от from до to (в любую сторону),
+// задерживаясь на каждой на WithSweepDwell, – например, чтобы найти частоту
+// без мерцания на камере или свиста двигателя. Значения каналов сохраняются,
+// а по завершении (в том числе при отмене ctx) восстанавливается исходная
+// частота. Отмена не считается ошибкой.
+func (pca *PCA9685) SweepFrequency(ctx context.Context, from, to float64, opts ...SweepOption) error {
+	s := sweep{steps: 10, dwell: time.Second}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	if err := pca.requireFrequency("SweepFrequency"); err != nil {
+		pca.logger.Error("SweepFrequency: %v", err)
+		return err
+	}
+	for _, f := range []float64{from, to} {
+		if f < MinFrequency || f > MaxFrequency {
+			err := fmt.Errorf("frequency out of range (%d-%d Hz)", MinFrequency, MaxFrequency)
+			pca.logger.Error("SweepFrequency: %v", err)
+			return err
+		}
+	}
+	pca.logger.Basic("SweepFrequency: %v–%v Гц, %d шагов по %v", from, to, s.steps, s.dwell)
+	orig := pca.frequency()
+
+	var err error
+	for i := 0; i <= s.steps; i++ {
+		freq := from + (to-from)*float64(i)/float64(s.steps)
+		if s.log {
+			freq = from * math.Pow(to/from, float64(i)/float64(s.steps))
+		}
+		if err = pca.setPWMFreq(freq); err != nil {
+			break
+		}
+		if s.each != nil {
+			s.each(freq)
+		}
+		if i == s.steps {
+			break
+		}
+		timer := time.NewTimer(s.dwell)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+			continue
+		}
+		break
+	}
+	if rerr := pca.setPWMFreq(orig); rerr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to restore frequency: %w", rerr))
+	}
+	pca.record(ctx, JournalEntry{Op: "SweepFrequency", Channel: -1, Value: to}, err)
+	return err
+}
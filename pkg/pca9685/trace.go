@@ -0,0 +1,154 @@
+package pca9685
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Направления транзакций в трассировке шины.
+const (
+	TraceWrite = "write"
+	TraceRead  = "read"
+)
+
+// traceTimeLayout – формат времени записи трассировки (UTC, микросекунды).
+const traceTimeLayout = "2006-01-02T15:04:05.000000Z"
+
+// tracer выводит транзакции шины в io.Writer, по строке на транзакцию.
+type tracer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+// SetTrace включает трассировку шины: каждая транзакция контроллера (запись,
+// чтение, повторы деградированного режима и контрольные чтения VerifyWrites)
+// выводится в w строкой вида
+//
+//	time=2026-10-16T08:00:00.000123Z dir=write reg=0x06 data=0000e803 dur=412µs result=ok
+//	time=2026-10-16T08:00:00.000901Z dir=read reg=0x00 data= dur=1.2ms result=error err="bus error"
+//
+// Поля разделены пробелами в формате key=value и разбираются ParseTraceLine.
+// data – байты в шестнадцатеричном виде (у неудачного чтения пусто), dur –
+// длительность в формате time.Duration. SetTrace(nil) выключает трассировку;
+// переключать её можно во время работы. Запись в w выполняется синхронно в
+// пути ввода-вывода, поэтому w должен быть быстрым (например, bufio.Writer
+// или файл). Ошибки записи в w игнорируются.
+func (pca *PCA9685) SetTrace(w io.Writer) {
+	if w == nil {
+		pca.logger.Basic("Трассировка шины выключена")
+		pca.trace.Store((*tracer)(nil))
+		return
+	}
+	pca.logger.Basic("Трассировка шины включена")
+	pca.trace.Store(&tracer{w: w})
+}
+
+// tracer возвращает текущую трассировку или nil.
+func (pca *PCA9685) tracer() *tracer {
+	t, _ := pca.trace.Load().(*tracer)
+	return t
+}
+
+// record выводит транзакцию, начатую в start и длившуюся d.
+func (t *tracer) record(start time.Time, d time.Duration, dir string, reg uint8, data []byte, err error) {
+	if dir == TraceRead && err != nil {
+		data = nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := append(t.buf[:0], "time="...)
+	b = start.UTC().AppendFormat(b, traceTimeLayout)
+	b = fmt.Appendf(b, " dir=%s reg=0x%02X data=%x dur=%v", dir, reg, data, d)
+	if err != nil {
+		b = fmt.Appendf(b, " result=error err=%q\n", err.Error())
+	} else {
+		b = append(b, " result=ok\n"...)
+	}
+	t.w.Write(b)
+	t.buf = b
+}
+
+// TraceRecord – разобранная строка трассировки шины.
+type TraceRecord struct {
+	Time     time.Time
+	Dir      string // TraceWrite или TraceRead
+	Reg      uint8
+	Data     []byte
+	Duration time.Duration
+	Err      string // Текст ошибки; пусто, если транзакция успешна
+}
+
+// ParseTraceLine разбирает строку, выведенную SetTrace.
+func ParseTraceLine(line string) (TraceRecord, error) {
+	var rec TraceRecord
+	line = strings.TrimRight(line, "\r\n")
+	// Текст ошибки – последнее поле и может содержать пробелы.
+	if i := strings.Index(line, " err="); i >= 0 {
+		msg, err := strconv.Unquote(line[i+len(" err="):])
+		if err != nil {
+			return rec, fmt.Errorf("invalid trace error field: %w", err)
+		}
+		rec.Err, line = msg, line[:i]
+	}
+	fields := make(map[string]string)
+	for _, f := range strings.Fields(line) {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok {
+			return rec, fmt.Errorf("invalid trace field %q", f)
+		}
+		fields[key] = value
+	}
+	for _, key := range []string{"time", "dir", "reg", "data", "dur", "result"} {
+		if _, ok := fields[key]; !ok {
+			return rec, fmt.Errorf("trace line has no %q field", key)
+		}
+	}
+
+	var err error
+	if rec.Time, err = time.Parse(traceTimeLayout, fields["time"]); err != nil {
+		return rec, fmt.Errorf("invalid trace time: %w", err)
+	}
+	rec.Dir = fields["dir"]
+	if rec.Dir != TraceWrite && rec.Dir != TraceRead {
+		return rec, fmt.Errorf("invalid trace direction %q", rec.Dir)
+	}
+	reg, err := strconv.ParseUint(fields["reg"], 0, 8)
+	if err != nil {
+		return rec, fmt.Errorf("invalid trace register: %w", err)
+	}
+	rec.Reg = uint8(reg)
+	if rec.Data, err = hex.DecodeString(fields["data"]); err != nil {
+		return rec, fmt.Errorf("invalid trace data: %w", err)
+	}
+	if rec.Duration, err = time.ParseDuration(fields["dur"]); err != nil {
+		return rec, fmt.Errorf("invalid trace duration: %w", err)
+	}
+	if (fields["result"] == "ok") != (rec.Err == "") {
+		return rec, fmt.Errorf("trace result %q does not match error field", fields["result"])
+	}
+	return rec, nil
+}
+
+// ReadTrace разбирает трассировку из r построчно, пропуская пустые строки.
+func ReadTrace(r io.Reader) ([]TraceRecord, error) {
+	var records []TraceRecord
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		rec, err := ParseTraceLine(sc.Text())
+		if err != nil {
+			return records, fmt.Errorf("line %d: %w", n, err)
+		}
+		records = append(records, rec)
+	}
+	return records, sc.Err()
+}
@@ -0,0 +1,319 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Easing – функция сглаживания движения между ключевыми кадрами.
+type Easing int
+
+const (
+	EaseLinear Easing = iota // Равномерное движение
+	EaseInOut                // Плавный разгон и торможение
+	EaseIn                   // Плавный разгон
+	EaseOut                  // Плавное торможение
+	EaseStep                 // Мгновенный переход в конце отрезка
+	EaseSCurve               // Разгон и торможение с ограниченным рывком (см. MotionProfile)
+)
+
+// apply преобразует долю времени отрезка t (от 0 до 1) в долю пути.
+func (e Easing) apply(t float64) float64 {
+	switch e {
+	case EaseInOut:
+		return (1 - math.Cos(math.Pi*t)) / 2
+	case EaseIn:
+		return t * t
+	case EaseOut:
+		return t * (2 - t)
+	case EaseStep:
+		if t < 1 {
+			return 0
+		}
+		return 1
+	case EaseSCurve:
+		return sCurve(t)
+	default:
+		return t
+	}
+}
+
+// Keyframe – положение сервопривода в момент At от начала траектории.
+// Easing задаёт сглаживание движения от предыдущего кадра к этому.
+type Keyframe struct {
+	At     time.Duration
+	Angle  float64
+	Easing Easing
+}
+
+// ServoTrack – ключевые кадры одного сервопривода.
+type ServoTrack struct {
+	Servo     *Servo
+	Keyframes []Keyframe
+}
+
+// angleAt возвращает угол дорожки в момент pos.
+func (t ServoTrack) angleAt(pos time.Duration) float64 {
+	kf := t.Keyframes
+	if pos <= kf[0].At {
+		return kf[0].Angle
+	}
+	for i := 1; i < len(kf); i++ {
+		if pos < kf[i].At {
+			a, b := kf[i-1], kf[i]
+			frac := float64(pos-a.At) / float64(b.At-a.At)
+			return a.Angle + (b.Angle-a.Angle)*b.Easing.apply(frac)
+		}
+	}
+	return kf[len(kf)-1].Angle
+}
+
+// defaultTrajectoryFrameRate – частота обновления сервоприводов по умолчанию.
+const defaultTrajectoryFrameRate = 50
+
+// TrajectoryPlayer проигрывает согласованные траектории нескольких
+// сервоприводов (аниматроника, хореография манипулятора) с паузой,
+// продолжением и перемоткой.
+type TrajectoryPlayer struct {
+	tracks   []ServoTrack
+	duration time.Duration
+	frame    time.Duration
+	loop     bool
+
+	mu       sync.Mutex
+	state    SequencerState
+	position time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+}
+
+// TrajectoryOption определяет опцию проигрывателя траекторий.
+type TrajectoryOption func(*TrajectoryPlayer)
+
+// WithTrajectoryFrameRate задаёт частоту обновления сервоприводов, кадров/с
+// (по умолчанию 50).
+func WithTrajectoryFrameRate(fps float64) TrajectoryOption {
+	return func(p *TrajectoryPlayer) {
+		if fps > 0 {
+			p.frame = time.Duration(float64(time.Second) / fps)
+		}
+	}
+}
+
+// WithTrajectoryLoop включает циклическое воспроизведение траектории.
+func WithTrajectoryLoop(loop bool) TrajectoryOption {
+	return func(p *TrajectoryPlayer) {
+		p.loop = loop
+	}
+}
+
+// NewTrajectoryPlayer создаёт проигрыватель для дорожек tracks. Ключевые кадры
+// каждой дорожки должны идти по возрастанию времени, а углы – лежать в
+// диапазоне сервопривода. Длительность траектории равна времени последнего
+// ключевого кадра среди всех дорожек.
+func NewTrajectoryPlayer(tracks []ServoTrack, opts ...TrajectoryOption) (*TrajectoryPlayer, error) {
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("trajectory must contain at least one track")
+	}
+	p := &TrajectoryPlayer{frame: time.Second / defaultTrajectoryFrameRate}
+	for i, track := range tracks {
+		if track.Servo == nil || len(track.Keyframes) == 0 {
+			return nil, fmt.Errorf("track %d: servo and at least one keyframe are required", i)
+		}
+		limit := track.Servo.Calibration().Range
+		for j, kf := range track.Keyframes {
+			if j > 0 && kf.At <= track.Keyframes[j-1].At {
+				return nil, fmt.Errorf("track %d: keyframe %d is not after the previous one", i, j)
+			}
+			if kf.At < 0 || kf.Angle < 0 || kf.Angle > limit {
+				return nil, fmt.Errorf("track %d: keyframe %d is out of range", i, j)
+			}
+		}
+		if last := track.Keyframes[len(track.Keyframes)-1].At; last > p.duration {
+			p.duration = last
+		}
+		track.Keyframes = append([]Keyframe(nil), track.Keyframes...)
+		p.tracks = append(p.tracks, track)
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
+}
+
+// Duration возвращает длительность траектории.
+func (p *TrajectoryPlayer) Duration() time.Duration {
+	return p.duration
+}
+
+// Position возвращает текущее положение воспроизведения.
+func (p *TrajectoryPlayer) Position() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.position
+}
+
+// State возвращает состояние проигрывателя.
+func (p *TrajectoryPlayer) State() SequencerState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Play запускает воспроизведение с текущего положения (после окончания –
+// с начала) или продолжает его после паузы.
+func (p *TrajectoryPlayer) Play(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch p.state {
+	case SequencerPlaying:
+		return nil
+	case SequencerPaused:
+		p.state = SequencerPlaying
+		return nil
+	}
+	if p.position >= p.duration {
+		p.position = 0
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	p.cancel = cancel
+	p.done = make(chan struct{})
+	p.err = nil
+	p.state = SequencerPlaying
+	go p.run(runCtx, p.done)
+	return nil
+}
+
+// Pause приостанавливает воспроизведение; сервоприводы удерживают положение.
+func (p *TrajectoryPlayer) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state == SequencerPlaying {
+		p.state = SequencerPaused
+	}
+}
+
+// Seek перематывает траекторию в положение pos и сразу выводит на него
+// сервоприводы. Работает в любом состоянии проигрывателя.
+func (p *TrajectoryPlayer) Seek(ctx context.Context, pos time.Duration) error {
+	if pos < 0 || pos > p.duration {
+		return fmt.Errorf("position must be between 0 and %v", p.duration)
+	}
+	p.mu.Lock()
+	p.position = pos
+	p.mu.Unlock()
+	return p.apply(ctx, pos)
+}
+
+// Stop останавливает воспроизведение и дожидается завершения.
+func (p *TrajectoryPlayer) Stop() {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// Wait блокируется до окончания воспроизведения и возвращает его ошибку.
+// Остановка через Stop ошибкой не считается.
+func (p *TrajectoryPlayer) Wait() error {
+	p.mu.Lock()
+	done := p.done
+	p.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	<-done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// emit передаёт событие в обработчики всех контроллеров, чьи сервоприводы
+// участвуют в траектории.
+func (p *TrajectoryPlayer) emit(e Event) {
+	seen := make(map[*PCA9685]bool, 1)
+	for _, track := range p.tracks {
+		if pca := track.Servo.pca; !seen[pca] {
+			seen[pca] = true
+			pca.emit(e)
+		}
+	}
+}
+
+// apply выводит все сервоприводы в положение траектории pos.
+func (p *TrajectoryPlayer) apply(ctx context.Context, pos time.Duration) error {
+	for _, track := range p.tracks {
+		if err := track.Servo.SetAngle(ctx, track.angleAt(pos)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *TrajectoryPlayer) run(ctx context.Context, done chan struct{}) {
+	var err error
+	defer func() {
+		p.mu.Lock()
+		if err != nil && !errors.Is(err, context.Canceled) {
+			p.err = err
+		}
+		p.state = SequencerStopped
+		p.cancel = nil
+		p.mu.Unlock()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(p.frame)
+	defer ticker.Stop()
+	last := time.Now()
+	loop := 1
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		if p.state == SequencerPlaying {
+			p.position += now.Sub(last)
+		}
+		last = now
+		finished, looped := false, false
+		if p.position >= p.duration {
+			if p.loop && p.duration > 0 {
+				p.position %= p.duration
+				loop++
+				looped = true
+			} else {
+				p.position = p.duration
+				finished = true
+			}
+		}
+		pos, playing := p.position, p.state == SequencerPlaying
+		p.mu.Unlock()
+		if looped {
+			p.emit(Event{Type: EventAnimationLooped, Channel: -1, Name: "TrajectoryPlayer", Loop: loop})
+		}
+
+		if playing {
+			if err = p.apply(ctx, pos); err != nil {
+				return
+			}
+		}
+		if finished {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package pca9685
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// TransitionPolicy определяет, как RGBLed обрабатывает новый переход цвета,
+// пока выполняется предыдущий.
+type TransitionPolicy int
+
+const (
+	// TransitionQueue – переходы выполняются по очереди в порядке вызова.
+	TransitionQueue TransitionPolicy = iota
+	// TransitionReplace – текущий и ожидающие переходы прерываются, новый
+	// начинается от отображаемого сейчас цвета.
+	TransitionReplace
+	// TransitionBlend – новый переход начинается немедленно и плавно
+	// смешивается с прерванным: в начале цвет следует прежней траектории,
+	// в конце – приходит к новой цели.
+	TransitionBlend
+)
+
+func (p TransitionPolicy) String() string {
+	switch p {
+	case TransitionReplace:
+		return "replace"
+	case TransitionBlend:
+		return "blend"
+	default:
+		return "queue"
+	}
+}
+
+// ErrTransitionReplaced возвращается FadeTo, если переход был прерван более
+// новым переходом.
+var ErrTransitionReplaced = errors.New("color transition replaced")
+
+// transition – один переход цвета RGBLed.
+type transition struct {
+	from  [3]float64
+	to    [3]float64
+	blend *transition // переход, с которым выполняется смешивание
+	start time.Time
+	dur   time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// at возвращает цвет перехода в момент now.
+func (t *transition) at(now time.Time) [3]float64 {
+	p := 1.0
+	if t.dur > 0 {
+		p = math.Min(1, float64(now.Sub(t.start))/float64(t.dur))
+	}
+	if p >= 1 {
+		return t.to
+	}
+	from := t.from
+	if t.blend != nil {
+		from = t.blend.at(now)
+	}
+	var c [3]float64
+	for i := range c {
+		c[i] = from[i] + (t.to[i]-from[i])*p
+	}
+	return c
+}
+
+// SetTransitionPolicy задаёт политику обработки переходов (по умолчанию
+// TransitionQueue).
+func (l *RGBLed) SetTransitionPolicy(p TransitionPolicy) {
+	l.tmu.Lock()
+	defer l.tmu.Unlock()
+	l.policy = p
+}
+
+// Color возвращает последний установленный цвет.
+func (l *RGBLed) Color() (r, g, b uint8) {
+	l.tmu.Lock()
+	defer l.tmu.Unlock()
+	return l.color[0], l.color[1], l.color[2]
+}
+
+// FadeTo плавно переводит светодиод в цвет r, g, b за duration. Одновременные
+// вызовы обрабатываются согласно политике переходов, поэтому несколько
+// подсистем, управляющих одним светодиодом, не конфликтуют. Нулевая
+// длительность означает установку цвета в порядке очереди.
+func (l *RGBLed) FadeTo(ctx context.Context, r, g, b uint8, duration time.Duration) error {
+	l.pca.logger.Detailed("FadeTo: переход к цвету R=%d, G=%d, B=%d за %v", r, g, b, duration)
+	tctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	t := &transition{
+		to:     [3]float64{float64(r), float64(g), float64(b)},
+		dur:    duration,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	defer close(t.done)
+
+	// Переход ждёт завершения предыдущего, а при прерывании – всех прерванных,
+	// чтобы их последние кадры не перезаписали новый цвет.
+	var waits []chan struct{}
+	l.tmu.Lock()
+	if l.policy == TransitionQueue {
+		if l.tail != nil {
+			waits = append(waits, l.tail)
+		}
+	} else {
+		for _, p := range l.pending {
+			p.cancel()
+			waits = append(waits, p.done)
+		}
+		if l.policy == TransitionBlend {
+			t.blend = l.active
+		}
+	}
+	l.tail = t.done
+	l.pending = append(l.pending, t)
+	l.tmu.Unlock()
+	defer l.removePending(t)
+
+	for _, wait := range waits {
+		select {
+		case <-wait:
+		case <-tctx.Done():
+			return l.transitionError(ctx)
+		}
+	}
+
+	l.tmu.Lock()
+	if err := tctx.Err(); err != nil {
+		l.tmu.Unlock()
+		return l.transitionError(ctx)
+	}
+	t.start = time.Now()
+	for i, v := range l.color {
+		t.from[i] = float64(v)
+	}
+	l.active = t
+	l.tmu.Unlock()
+
+	steps := l.pca.fadeConfig(nil).steps(duration)
+	err := runFade(tctx, steps, duration, func(step int) error {
+		c := t.to
+		if step < steps {
+			c = t.at(time.Now())
+		}
+		return l.setColor(tctx, uint8(math.Round(c[0])), uint8(math.Round(c[1])), uint8(math.Round(c[2])))
+	})
+	if err != nil && tctx.Err() != nil {
+		return l.transitionError(ctx)
+	}
+	return err
+}
+
+// transitionError возвращает ошибку прерванного перехода.
+func (l *RGBLed) transitionError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.pca.logger.Detailed("FadeTo: переход прерван новым переходом")
+	return ErrTransitionReplaced
+}
+
+// removePending удаляет завершённый переход из списка.
+func (l *RGBLed) removePending(t *transition) {
+	l.tmu.Lock()
+	defer l.tmu.Unlock()
+	for i, p := range l.pending {
+		if p == t {
+			l.pending = append(l.pending[:i], l.pending[i+1:]...)
+			break
+		}
+	}
+	if l.active == t {
+		l.active = nil
+	}
+	if l.tail == t.done {
+		l.tail = nil
+	}
+}
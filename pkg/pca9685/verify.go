@@ -0,0 +1,58 @@
+package pca9685
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrWriteMismatch возвращается в режиме проверки записи (Config.VerifyWrites),
+// если контрольное чтение не совпало с записанными данными после всех
+// повторов.
+var ErrWriteMismatch = errors.New("register readback does not match written data")
+
+// defaultVerifyRetries – число повторов записи по умолчанию при несовпадении
+// контрольного чтения.
+const defaultVerifyRetries = 2
+
+// readback сообщает, можно ли проверить запись n байт начиная с reg
+// контрольным чтением. Проверяются только регистры каналов: ALL_LED
+// читается как ноль, а MODE1 микросхема изменяет сама.
+func (c Chip) readback(reg uint8, n int) bool {
+	if c == ChipPCA9635 {
+		base := int(reg &^ pca9635AutoInc)
+		return base >= RegPCA9635PWM0 && base+n <= RegPCA9635LEDOut0+4
+	}
+	return int(reg) >= RegLed0 && int(reg)+n <= RegLed0+4*16
+}
+
+// writeVerified выполняет запись и, если включена проверка записи, читает
+// регистры обратно. При несовпадении генерируется событие
+// EventWriteMismatch и запись повторяется до Config.VerifyRetries раз.
+func (pca *PCA9685) writeVerified(ctx context.Context, op string, channel int, reg uint8, data []byte) error {
+	err := pca.doWrite(ctx, reg, data)
+	if err != nil || !pca.verify || !pca.chip.readback(reg, len(data)) {
+		return err
+	}
+	pooled, got := acquireFrame(len(data))
+	defer releaseFrame(pooled)
+	for attempt := 0; ; attempt++ {
+		if err := pca.doRead(ctx, reg, got); err != nil {
+			return fmt.Errorf("failed to verify register 0x%02X: %w", reg, err)
+		}
+		if bytes.Equal(got, data) {
+			return nil
+		}
+		pca.counters.mismatches.Add(1)
+		mismatch := fmt.Errorf("%w: register 0x%02X, wrote % X, read % X", ErrWriteMismatch, reg, data, got)
+		pca.logger.Error("%s: контрольное чтение не совпало с записью (попытка %d): %v", op, attempt+1, mismatch)
+		pca.emit(Event{Type: EventWriteMismatch, Err: mismatch, Channel: channel, Name: op})
+		if attempt >= pca.verifyRetries {
+			return mismatch
+		}
+		if err := pca.doWrite(ctx, reg, data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Package pid реализует ПИД-регулятор для замкнутых контуров вокруг каналов
+// PCA9685 и произвольных датчиков: нагреватель и термометр, насос и
+// расходомер, вентилятор и датчик влажности. Регулятор не зависит от
+// контроллера: Update принимает измерение и возвращает выход, а Run
+// связывает его с датчиком и исполнительным устройством.
+package pid
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Config – параметры регулятора.
+type Config struct {
+	Kp, Ki, Kd float64 // Коэффициенты; Ki и Kd – в единицах на секунду
+
+	OutMin, OutMax float64 // Ограничения выхода (оба 0 – от 0 до 100, например скорость насоса в %)
+
+	// SetpointRate ограничивает скорость изменения уставки, единиц в
+	// секунду (0 – уставка применяется сразу). Рабочая уставка начинается с
+	// первого измерения и плавно догоняет заданную, поэтому ни запуск, ни
+	// скачок уставки не вызывают броска выхода.
+	SetpointRate float64
+
+	// Reverse включает обратное действие: выход растёт, когда измерение
+	// выше уставки (охлаждение, вытяжка).
+	Reverse bool
+}
+
+// Controller – ПИД-регулятор с ограничением выхода, защитой от насыщения
+// интегратора и безударным изменением параметров. Дифференциальная
+// составляющая считается по измерению, а не по ошибке, поэтому изменение
+// уставки не вызывает выброса. Методы безопасны для одновременного вызова.
+type Controller struct {
+	mu  sync.Mutex
+	cfg Config
+
+	target  float64 // заданная уставка
+	current float64 // рабочая уставка с учётом SetpointRate
+
+	iterm    float64 // накопленная интегральная составляющая в единицах выхода
+	lastMeas float64
+	lastErr  float64
+	lastRate float64 // скорость изменения измерения с учётом направления
+	last     time.Time
+	started  bool
+	output   float64
+}
+
+// New создаёт регулятор.
+func New(cfg Config) (*Controller, error) {
+	if err := validate(&cfg); err != nil {
+		return nil, err
+	}
+	return &Controller{cfg: cfg}, nil
+}
+
+func validate(cfg *Config) error {
+	if cfg.OutMin == 0 && cfg.OutMax == 0 {
+		cfg.OutMax = 100
+	}
+	if cfg.OutMin >= cfg.OutMax {
+		return fmt.Errorf("output min %v must be less than max %v", cfg.OutMin, cfg.OutMax)
+	}
+	if cfg.Kp < 0 || cfg.Ki < 0 || cfg.Kd < 0 {
+		return fmt.Errorf("gains must not be negative; use Reverse for reverse acting loops")
+	}
+	if cfg.SetpointRate < 0 {
+		return fmt.Errorf("setpoint rate must not be negative")
+	}
+	return nil
+}
+
+// SetSetpoint задаёт уставку. С Config.SetpointRate рабочая уставка
+// приближается к ней постепенно при последующих вызовах Update.
+func (c *Controller) SetSetpoint(sp float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.target = sp
+	if c.cfg.SetpointRate == 0 || !c.started {
+		c.current = sp
+	}
+}
+
+// Setpoint возвращает заданную и рабочую уставки.
+func (c *Controller) Setpoint() (target, current float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.target, c.current
+}
+
+// Output возвращает последнее значение выхода.
+func (c *Controller) Output() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.output
+}
+
+// Config возвращает текущие параметры регулятора.
+func (c *Controller) Config() Config {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cfg
+}
+
+// SetTunings изменяет коэффициенты без скачка выхода: интегральная
+// составляющая пересчитывается так, чтобы при неизменном измерении выход
+// остался прежним.
+func (c *Controller) SetTunings(kp, ki, kd float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cfg := c.cfg
+	cfg.Kp, cfg.Ki, cfg.Kd = kp, ki, kd
+	if err := validate(&cfg); err != nil {
+		return err
+	}
+	if c.started {
+		c.iterm += (c.cfg.Kp-kp)*c.lastErr - (c.cfg.Kd-kd)*c.lastRate
+	}
+	c.cfg = cfg
+	return nil
+}
+
+// SetOutputLimits изменяет ограничения выхода; текущий выход приводится к
+// новым ограничениям.
+func (c *Controller) SetOutputLimits(min, max float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if min >= max {
+		return fmt.Errorf("output min %v must be less than max %v", min, max)
+	}
+	c.cfg.OutMin, c.cfg.OutMax = min, max
+	c.output = c.clamp(c.output)
+	return nil
+}
+
+// Track подготавливает безударный переход к автоматическому управлению:
+// следующий Update начнёт с выхода output (например, текущей скорости
+// насоса, установленной вручную) и измерения measurement.
+func (c *Controller) Track(output, measurement float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.output = c.clamp(output)
+	if c.cfg.SetpointRate > 0 {
+		c.current = measurement
+	}
+	e := c.current - measurement
+	if c.cfg.Reverse {
+		e = -e
+	}
+	c.iterm = c.output - c.cfg.Kp*e
+	c.lastMeas, c.lastErr, c.lastRate = measurement, e, 0
+	c.started = false
+}
+
+// Reset сбрасывает накопленное состояние регулятора; уставка и параметры
+// сохраняются.
+func (c *Controller) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.iterm, c.output = 0, 0
+	c.lastMeas, c.lastErr, c.lastRate = 0, 0, 0
+	c.current = c.target
+	c.started = false
+	c.last = time.Time{}
+}
+
+// Update принимает измерение в момент now и возвращает новый выход в
+// пределах ограничений. Первый вызов после New, Track или Reset только
+// запоминает измерение: интегральная и дифференциальная составляющие
+// начинают работать со второго вызова.
+func (c *Controller) Update(measurement float64, now time.Time) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dt := 0.0
+	if c.started {
+		dt = now.Sub(c.last).Seconds()
+	} else {
+		c.lastMeas = measurement
+		if c.cfg.SetpointRate > 0 {
+			c.current = measurement
+		}
+	}
+	c.last = now
+
+	if rate := c.cfg.SetpointRate; rate > 0 && dt > 0 {
+		step := rate * dt
+		c.current += math.Max(-step, math.Min(step, c.target-c.current))
+	}
+
+	e := c.current - measurement
+	dm := measurement - c.lastMeas
+	if c.cfg.Reverse {
+		e, dm = -e, -dm
+	}
+	rate := 0.0
+	if dt > 0 {
+		rate = dm / dt
+	} else if c.started {
+		// Повторный вызов в тот же момент сохраняет дифференциальную составляющую.
+		rate = c.lastRate
+	}
+	pd := c.cfg.Kp*e - c.cfg.Kd*rate
+	if dt > 0 {
+		// Защита от насыщения: интегратор не накапливает ошибку, которая
+		// толкает выход дальше за ограничение.
+		di := c.cfg.Ki * e * dt
+		u := pd + c.iterm + di
+		if !(u > c.cfg.OutMax && di > 0 || u < c.cfg.OutMin && di < 0) {
+			c.iterm += di
+		}
+	}
+
+	c.output = c.clamp(pd + c.iterm)
+	c.lastMeas, c.lastErr, c.lastRate = measurement, e, rate
+	c.started = true
+	return c.output
+}
+
+func (c *Controller) clamp(v float64) float64 {
+	return math.Max(c.cfg.OutMin, math.Min(c.cfg.OutMax, v))
+}
+
+// Sensor – источник измерений. Совместим с pca9685.ValueSource.
+type Sensor interface {
+	Value(ctx context.Context) (float64, error)
+}
+
+// Actuator применяет выход регулятора, например pca9685.(*Pump).SetSpeed.
+type Actuator func(ctx context.Context, output float64) error
+
+// Run замыкает контур: каждые interval читает sensor, вычисляет выход и
+// передаёт его actuator, пока не будет отменён ctx. Ошибка датчика или
+// исполнительного устройства завершает Run; при отмене ctx возвращается
+// ctx.Err().
+func Run(ctx context.Context, c *Controller, interval time.Duration, sensor Sensor, actuator Actuator) error {
+	if interval <= 0 {
+		return fmt.Errorf("control interval must be positive")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		v, err := sensor.Value(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read sensor: %w", err)
+		}
+		if err := actuator(ctx, c.Update(v, time.Now())); err != nil {
+			return fmt.Errorf("failed to apply output: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
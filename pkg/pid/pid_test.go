@@ -0,0 +1,189 @@
+package pid
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// plant – простая модель нагревателя первого порядка.
+type plant struct {
+	temp, ambient, gain, tau float64
+}
+
+func (p *plant) step(power float64, dt time.Duration) {
+	p.temp += (p.ambient + p.gain*power - p.temp) * dt.Seconds() / p.tau
+}
+
+func TestNewValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"LimitsInverted", Config{Kp: 1, OutMin: 10, OutMax: 5}},
+		{"NegativeGain", Config{Kp: -1}},
+		{"NegativeRate", Config{Kp: 1, SetpointRate: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Error("New() expected error")
+			}
+		})
+	}
+	c, err := New(Config{Kp: 1})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if cfg := c.Config(); cfg.OutMin != 0 || cfg.OutMax != 100 {
+		t.Errorf("default limits = %v..%v, want 0..100", cfg.OutMin, cfg.OutMax)
+	}
+}
+
+func TestConvergence(t *testing.T) {
+	c, err := New(Config{Kp: 4, Ki: 0.5, Kd: 1})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	c.SetSetpoint(60)
+	p := &plant{temp: 20, ambient: 20, gain: 1, tau: 10}
+	now := time.Unix(0, 0)
+	dt := 100 * time.Millisecond
+	for i := 0; i < 3000; i++ {
+		out := c.Update(p.temp, now)
+		if out < 0 || out > 100 {
+			t.Fatalf("output %v outside limits", out)
+		}
+		p.step(out, dt)
+		now = now.Add(dt)
+	}
+	if math.Abs(p.temp-60) > 0.1 {
+		t.Errorf("temperature = %v, want 60", p.temp)
+	}
+}
+
+func TestAntiWindup(t *testing.T) {
+	c, err := New(Config{Kp: 1, Ki: 1, OutMax: 10})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	c.SetSetpoint(100)
+	now := time.Unix(0, 0)
+	// Долгое насыщение: выход упирается в ограничение.
+	for i := 0; i < 1000; i++ {
+		if out := c.Update(0, now); out > 10 {
+			t.Fatalf("output = %v, want at most 10", out)
+		}
+		now = now.Add(time.Second)
+	}
+	// После смены знака ошибки выход сразу уходит от ограничения, а не ждёт
+	// разряда накопленного интеграла.
+	c.SetSetpoint(0)
+	now = now.Add(time.Second)
+	if out := c.Update(50, now); out >= 10 {
+		t.Errorf("output after error reversal = %v, want below the limit", out)
+	}
+}
+
+func TestSetpointRamp(t *testing.T) {
+	c, err := New(Config{Kp: 1, SetpointRate: 2, OutMin: -100, OutMax: 100})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	c.SetSetpoint(50)
+	now := time.Unix(0, 0)
+	c.Update(20, now)
+	if _, cur := c.Setpoint(); cur != 20 {
+		t.Errorf("working setpoint at start = %v, want first measurement 20", cur)
+	}
+	now = now.Add(5 * time.Second)
+	if out := c.Update(20, now); out != 10 {
+		t.Errorf("output = %v, want 10 after 5s ramp at 2/s", out)
+	}
+	now = now.Add(time.Minute)
+	c.Update(20, now)
+	if target, cur := c.Setpoint(); target != 50 || cur != 50 {
+		t.Errorf("Setpoint() = %v, %v; want 50, 50", target, cur)
+	}
+}
+
+func TestBumpless(t *testing.T) {
+	c, err := New(Config{Kp: 2, Ki: 0.1, Kd: 0.5})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	c.SetSetpoint(40)
+	now := time.Unix(0, 0)
+	c.Update(30, now)
+	now = now.Add(time.Second)
+	before := c.Update(31, now)
+
+	if err := c.SetTunings(5, 0.2, 1); err != nil {
+		t.Fatalf("SetTunings() error = %v", err)
+	}
+	if err := c.SetTunings(-1, 0, 0); err == nil {
+		t.Error("SetTunings() expected error for negative gain")
+	}
+	// Тот же момент и измерение: выход не меняется.
+	if after := c.Update(31, now); math.Abs(after-before) > 1e-9 {
+		t.Errorf("output after SetTunings = %v, want %v", after, before)
+	}
+
+	// Переход от ручного управления начинается с ручного значения.
+	c.Track(70, 35)
+	if out := c.Update(35, now.Add(time.Second)); math.Abs(out-70) > 1e-9 {
+		t.Errorf("output after Track = %v, want 70", out)
+	}
+}
+
+func TestReverse(t *testing.T) {
+	c, err := New(Config{Kp: 10, Reverse: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	c.SetSetpoint(25)
+	if out := c.Update(30, time.Unix(0, 0)); out != 50 {
+		t.Errorf("reverse output above setpoint = %v, want 50", out)
+	}
+	if out := c.Update(20, time.Unix(1, 0)); out != 0 {
+		t.Errorf("reverse output below setpoint = %v, want 0", out)
+	}
+}
+
+type sensorFunc func(ctx context.Context) (float64, error)
+
+func (f sensorFunc) Value(ctx context.Context) (float64, error) { return f(ctx) }
+
+func TestRun(t *testing.T) {
+	c, err := New(Config{Kp: 1})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	c.SetSetpoint(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	var outputs []float64
+	sensor := sensorFunc(func(context.Context) (float64, error) { return 4, nil })
+	err = Run(ctx, c, time.Millisecond, sensor, func(_ context.Context, out float64) error {
+		outputs = append(outputs, out)
+		if len(outputs) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want context.Canceled", err)
+	}
+	if len(outputs) != 3 || outputs[0] != 6 {
+		t.Errorf("outputs = %v, want three outputs of 6", outputs)
+	}
+
+	failing := sensorFunc(func(context.Context) (float64, error) { return 0, errors.New("sensor offline") })
+	if err := Run(context.Background(), c, time.Millisecond, failing, nil); err == nil {
+		t.Error("Run() expected sensor error")
+	}
+	if err := Run(context.Background(), c, 0, sensor, nil); err == nil {
+		t.Error("Run() expected error for zero interval")
+	}
+}
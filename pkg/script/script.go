@@ -0,0 +1,337 @@
+// Package script позволяет описывать эффекты и автоматизацию для PCA9685
+// на Lua и загружать их во время работы приложения без перекомпиляции.
+//
+// Доступные в сценарии функции:
+//
+//	set(ch, value)            – установить значение off канала (on = 0)
+//	set_pwm(ch, on, off)      – установить значения on/off канала
+//	get(ch)                   – текущее значение off канала
+//	fade(ch, from, to, ms)    – плавное изменение значения канала
+//	led(name)                 – светодиод: :color(r, g, b), :brightness(v), :on(), :off()
+//	pump(name)                – насос: :speed(percent), :stop()
+//	sleep(ms)                 – пауза с учётом отмены контекста
+//	every(ms, fn)             – вызывать fn каждые ms, пока fn не вернёт false
+//	log(fmt, ...)             – запись в лог
+package script
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/snaart/go-pca9685/pkg/pca9685"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	ledTypeName  = "pca9685.led"
+	pumpTypeName = "pca9685.pump"
+)
+
+// Engine выполняет Lua сценарии, управляющие контроллером PCA9685.
+type Engine struct {
+	pca    *pca9685.PCA9685
+	mu     sync.RWMutex
+	leds   map[string]*pca9685.RGBLed
+	pumps  map[string]*pca9685.Pump
+	logger pca9685.Logger
+}
+
+// Option определяет опцию конфигурации движка сценариев.
+type Option func(*Engine)
+
+// WithLogger задаёт логгер движка.
+func WithLogger(logger pca9685.Logger) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+// New создаёт движок сценариев для контроллера pca.
+func New(pca *pca9685.PCA9685, opts ...Option) *Engine {
+	e := &Engine{
+		pca:    pca,
+		leds:   make(map[string]*pca9685.RGBLed),
+		pumps:  make(map[string]*pca9685.Pump),
+		logger: pca9685.NewDefaultLogger(pca9685.LogLevelBasic),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// RegisterLed делает светодиод доступным в сценариях под именем name.
+func (e *Engine) RegisterLed(name string, led *pca9685.RGBLed) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leds[name] = led
+}
+
+// RegisterPump делает насос доступным в сценариях под именем name.
+func (e *Engine) RegisterPump(name string, pump *pca9685.Pump) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pumps[name] = pump
+}
+
+// RunString выполняет сценарий из строки до его завершения или отмены контекста.
+func (e *Engine) RunString(ctx context.Context, source string) error {
+	L := e.newState(ctx)
+	defer L.Close()
+	if err := L.DoString(source); err != nil {
+		e.logger.Error("script: ошибка выполнения сценария: %v", err)
+		return e.wrapError(ctx, err)
+	}
+	return nil
+}
+
+// RunFile выполняет сценарий из файла path до его завершения или отмены контекста.
+func (e *Engine) RunFile(ctx context.Context, path string) error {
+	e.logger.Basic("script: запуск сценария %s", path)
+	L := e.newState(ctx)
+	defer L.Close()
+	if err := L.DoFile(path); err != nil {
+		e.logger.Error("script: ошибка выполнения сценария %s: %v", path, err)
+		return e.wrapError(ctx, err)
+	}
+	return nil
+}
+
+// wrapError возвращает ошибку контекста, если сценарий был прерван отменой.
+func (e *Engine) wrapError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("script failed: %w", err)
+}
+
+func (e *Engine) newState(ctx context.Context) *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	L.SetContext(ctx)
+
+	L.SetGlobal("set", L.NewFunction(e.luaSet))
+	L.SetGlobal("set_pwm", L.NewFunction(e.luaSetPWM))
+	L.SetGlobal("get", L.NewFunction(e.luaGet))
+	L.SetGlobal("fade", L.NewFunction(e.luaFade))
+	L.SetGlobal("led", L.NewFunction(e.luaLed))
+	L.SetGlobal("pump", L.NewFunction(e.luaPump))
+	L.SetGlobal("sleep", L.NewFunction(luaSleep))
+	L.SetGlobal("every", L.NewFunction(luaEvery))
+	L.SetGlobal("log", L.NewFunction(e.luaLog))
+
+	ledMeta := L.NewTypeMetatable(ledTypeName)
+	L.SetField(ledMeta, "__index", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"color":      luaLedColor,
+		"brightness": luaLedBrightness,
+		"on":         luaLedOn,
+		"off":        luaLedOff,
+	}))
+	pumpMeta := L.NewTypeMetatable(pumpTypeName)
+	L.SetField(pumpMeta, "__index", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"speed": luaPumpSpeed,
+		"stop":  luaPumpStop,
+	}))
+	return L
+}
+
+// checkTicks проверяет, что аргумент n – значение PWM от 0 до 4095.
+func checkTicks(L *lua.LState, n int) uint16 {
+	v := L.CheckInt(n)
+	if v < 0 || v >= pca9685.PwmResolution {
+		L.ArgError(n, "value must be between 0 and 4095")
+	}
+	return uint16(v)
+}
+
+// raise прерывает сценарий с ошибкой err.
+func raise(L *lua.LState, err error) int {
+	L.RaiseError("%v", err)
+	return 0
+}
+
+func (e *Engine) luaSet(L *lua.LState) int {
+	if err := e.pca.SetPWM(L.Context(), L.CheckInt(1), 0, checkTicks(L, 2)); err != nil {
+		return raise(L, err)
+	}
+	return 0
+}
+
+func (e *Engine) luaSetPWM(L *lua.LState) int {
+	if err := e.pca.SetPWM(L.Context(), L.CheckInt(1), checkTicks(L, 2), checkTicks(L, 3)); err != nil {
+		return raise(L, err)
+	}
+	return 0
+}
+
+func (e *Engine) luaGet(L *lua.LState) int {
+	_, _, off, err := e.pca.GetChannelState(L.CheckInt(1))
+	if err != nil {
+		return raise(L, err)
+	}
+	L.Push(lua.LNumber(off))
+	return 1
+}
+
+func (e *Engine) luaFade(L *lua.LState) int {
+	duration := time.Duration(L.CheckInt(4)) * time.Millisecond
+	if err := e.pca.FadeChannel(L.Context(), L.CheckInt(1), checkTicks(L, 2), checkTicks(L, 3), duration); err != nil {
+		return raise(L, err)
+	}
+	return 0
+}
+
+func (e *Engine) luaLed(L *lua.LState) int {
+	name := L.CheckString(1)
+	e.mu.RLock()
+	led, ok := e.leds[name]
+	e.mu.RUnlock()
+	if !ok {
+		L.ArgError(1, fmt.Sprintf("unknown LED %q", name))
+	}
+	ud := L.NewUserData()
+	ud.Value = led
+	L.SetMetatable(ud, L.GetTypeMetatable(ledTypeName))
+	L.Push(ud)
+	return 1
+}
+
+func (e *Engine) luaPump(L *lua.LState) int {
+	name := L.CheckString(1)
+	e.mu.RLock()
+	pump, ok := e.pumps[name]
+	e.mu.RUnlock()
+	if !ok {
+		L.ArgError(1, fmt.Sprintf("unknown pump %q", name))
+	}
+	ud := L.NewUserData()
+	ud.Value = pump
+	L.SetMetatable(ud, L.GetTypeMetatable(pumpTypeName))
+	L.Push(ud)
+	return 1
+}
+
+func (e *Engine) luaLog(L *lua.LState) int {
+	args := make([]interface{}, 0, L.GetTop()-1)
+	for i := 2; i <= L.GetTop(); i++ {
+		args = append(args, L.Get(i))
+	}
+	e.logger.Basic("script: "+L.CheckString(1), args...)
+	return 0
+}
+
+func checkLed(L *lua.LState) *pca9685.RGBLed {
+	if led, ok := L.CheckUserData(1).Value.(*pca9685.RGBLed); ok {
+		return led
+	}
+	L.ArgError(1, "LED expected")
+	return nil
+}
+
+func checkPump(L *lua.LState) *pca9685.Pump {
+	if pump, ok := L.CheckUserData(1).Value.(*pca9685.Pump); ok {
+		return pump
+	}
+	L.ArgError(1, "pump expected")
+	return nil
+}
+
+func checkByte(L *lua.LState, n int) uint8 {
+	v := L.CheckInt(n)
+	if v < 0 || v > 255 {
+		L.ArgError(n, "color component must be between 0 and 255")
+	}
+	return uint8(v)
+}
+
+func luaLedColor(L *lua.LState) int {
+	led := checkLed(L)
+	if err := led.SetColor(L.Context(), checkByte(L, 2), checkByte(L, 3), checkByte(L, 4)); err != nil {
+		return raise(L, err)
+	}
+	return 0
+}
+
+func luaLedBrightness(L *lua.LState) int {
+	led := checkLed(L)
+	if err := led.SetBrightness(float64(L.CheckNumber(2))); err != nil {
+		return raise(L, err)
+	}
+	return 0
+}
+
+func luaLedOn(L *lua.LState) int {
+	if err := checkLed(L).On(L.Context()); err != nil {
+		return raise(L, err)
+	}
+	return 0
+}
+
+func luaLedOff(L *lua.LState) int {
+	if err := checkLed(L).Off(L.Context()); err != nil {
+		return raise(L, err)
+	}
+	return 0
+}
+
+func luaPumpSpeed(L *lua.LState) int {
+	pump := checkPump(L)
+	if err := pump.SetSpeed(L.Context(), float64(L.CheckNumber(2))); err != nil {
+		return raise(L, err)
+	}
+	return 0
+}
+
+func luaPumpStop(L *lua.LState) int {
+	if err := checkPump(L).Stop(L.Context()); err != nil {
+		return raise(L, err)
+	}
+	return 0
+}
+
+func luaSleep(L *lua.LState) int {
+	timer := time.NewTimer(time.Duration(L.CheckInt(1)) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-L.Context().Done():
+		return raise(L, L.Context().Err())
+	case <-timer.C:
+	}
+	return 0
+}
+
+func luaEvery(L *lua.LState) int {
+	interval := time.Duration(L.CheckInt(1)) * time.Millisecond
+	fn := L.CheckFunction(2)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := L.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}); err != nil {
+			return raise(L, err)
+		}
+		ret := L.Get(-1)
+		L.Pop(1)
+		if ret == lua.LFalse {
+			return 0
+		}
+		select {
+		case <-L.Context().Done():
+			return raise(L, L.Context().Err())
+		case <-ticker.C:
+		}
+	}
+}
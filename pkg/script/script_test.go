@@ -0,0 +1,103 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/snaart/go-pca9685/pkg/pca9685"
+)
+
+func newTestEngine(t *testing.T) (*Engine, *pca9685.PCA9685) {
+	t.Helper()
+	pca, err := pca9685.New(pca9685.NewTestI2C(), pca9685.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create PCA9685: %v", err)
+	}
+	return New(pca), pca
+}
+
+func TestEngine_Channels(t *testing.T) {
+	engine, pca := newTestEngine(t)
+	src := `
+		set(0, 1000)
+		set_pwm(1, 100, 2000)
+		set(2, get(0) + 500)
+		fade(3, 0, 3000, 10)
+		log("channel 0 = %v", get(0))
+	`
+	if err := engine.RunString(context.Background(), src); err != nil {
+		t.Fatalf("RunString() error = %v", err)
+	}
+
+	want := map[int][2]uint16{0: {0, 1000}, 1: {100, 2000}, 2: {0, 1500}, 3: {0, 3000}}
+	for ch, values := range want {
+		_, on, off, _ := pca.GetChannelState(ch)
+		if on != values[0] || off != values[1] {
+			t.Errorf("channel %d = %d/%d, want %d/%d", ch, on, off, values[0], values[1])
+		}
+	}
+}
+
+func TestEngine_Peripherals(t *testing.T) {
+	engine, pca := newTestEngine(t)
+	led, err := pca9685.NewRGBLed(pca, 0, 1, 2)
+	if err != nil {
+		t.Fatalf("NewRGBLed() error = %v", err)
+	}
+	pump, err := pca9685.NewPump(pca, 3)
+	if err != nil {
+		t.Fatalf("NewPump() error = %v", err)
+	}
+	engine.RegisterLed("hood", led)
+	engine.RegisterPump("doser", pump)
+
+	src := `
+		local hood = led("hood")
+		hood:brightness(0.5)
+		hood:color(255, 0, 0)
+		local n = 0
+		every(1, function()
+			n = n + 1
+			pump("doser"):speed(n * 10)
+			return n < 3
+		end)
+	`
+	if err := engine.RunString(context.Background(), src); err != nil {
+		t.Fatalf("RunString() error = %v", err)
+	}
+	if b := led.GetBrightness(); b != 0.5 {
+		t.Errorf("brightness = %v, want 0.5", b)
+	}
+	if speed, _ := pump.GetCurrentSpeed(); speed != 30 {
+		t.Errorf("pump speed = %v, want 30", speed)
+	}
+
+	if err := engine.RunString(context.Background(), `led("missing"):on()`); err == nil {
+		t.Error("RunString() expected error for unknown LED")
+	}
+	if err := engine.RunString(context.Background(), `set(0, 5000)`); err == nil {
+		t.Error("RunString() expected error for out-of-range value")
+	}
+	if err := engine.RunString(context.Background(), `os.exit(1)`); err == nil {
+		t.Error("RunString() expected error: os library must not be available")
+	}
+}
+
+func TestEngine_RunFileCancel(t *testing.T) {
+	engine, _ := newTestEngine(t)
+	path := filepath.Join(t.TempDir(), "blink.lua")
+	src := "while true do set(0, 4095) sleep(5) set(0, 0) sleep(5) end"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := engine.RunFile(ctx, path); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RunFile() error = %v, want context.DeadlineExceeded", err)
+	}
+}